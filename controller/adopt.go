@@ -0,0 +1,70 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	klog "k8s.io/klog/v2"
+)
+
+// adoptVolume patches the provisioned-by annotation of a PV provisioned under
+// one of AdoptProvisionerNames to the provisioner name. The content hash
+// annotation is updated too, unless it did not match already.
+func (ctrl *ProvisionController) adoptVolume(ctx context.Context, volume *v1.PersistentVolume) (*v1.PersistentVolume, error) {
+	key := ctrl.provisionedByAnnotation
+	provisioner, found := volume.Annotations[key]
+	if !found {
+		key = AnnDynamicallyProvisioned
+		provisioner = volume.Annotations[key]
+	}
+	if !slices.Contains(ctrl.adoptedProvisionerNames, provisioner) {
+		return volume, nil
+	}
+
+	annotations := map[string]string{key: ctrl.provisionerName}
+	if _, found := volume.Annotations[AnnDynamicallyProvisioned]; found {
+		// PVs provisioned with ProvisionedByAnnotation carry both keys.
+		annotations[AnnDynamicallyProvisioned] = ctrl.provisionerName
+	}
+	hashKey := ctrl.contentHashAnnotation()
+	if hash, found := volume.Annotations[hashKey]; found && hash == ctrl.volumeContentHash(volume) {
+		adopted := volume.DeepCopy()
+		for k, v := range annotations {
+			adopted.Annotations[k] = v
+		}
+		annotations[hashKey] = ctrl.volumeContentHash(adopted)
+	}
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{"annotations": annotations},
+	})
+	if err != nil {
+		return volume, err
+	}
+	newVolume, err := ctrl.pvWriteClient.CoreV1().PersistentVolumes().Patch(ctx, volume.Name, types.MergePatchType, patch, metav1.PatchOptions{})
+	if err != nil {
+		return volume, fmt.Errorf("failed to adopt volume %s of provisioner %s: %v", volume.Name, provisioner, err)
+	}
+	klog.FromContext(ctx).V(2).Info("Adopted volume of previous provisioner name", "provisioner", provisioner)
+	return newVolume, nil
+}
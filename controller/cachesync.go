@@ -0,0 +1,130 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"k8s.io/client-go/tools/cache"
+	klog "k8s.io/klog/v2"
+)
+
+// cacheSyncPollInterval is how often waitForCacheSync checks the informers.
+const cacheSyncPollInterval = 100 * time.Millisecond
+
+// requiredPermissions returns the RBAC permissions the controller needs, as
+// "resource: verbs" strings, so that a missing one can be spotted in the log.
+func (ctrl *ProvisionController) requiredPermissions() []string {
+	var permissions []string
+	switch {
+	case ctrl.provisioningDisabled:
+		permissions = append(permissions, "persistentvolumes: get, list, watch, update, patch, delete")
+	case ctrl.deletionDisabled && ctrl.serverSideApply:
+		permissions = append(permissions,
+			"persistentvolumeclaims: get, list, watch, update, patch",
+			"persistentvolumes: get, create, patch")
+	case ctrl.deletionDisabled:
+		permissions = append(permissions,
+			"persistentvolumeclaims: get, list, watch, update, patch",
+			"persistentvolumes: get, create")
+	default:
+		permissions = append(permissions,
+			"persistentvolumeclaims: get, list, watch, update, patch",
+			"persistentvolumes: get, list, watch, create, update, patch, delete")
+	}
+	permissions = append(permissions,
+		"storage.k8s.io/storageclasses: get, list, watch",
+		"events: create, update, patch",
+		"nodes: get, list, watch")
+	if ctrl.storageCapacityTracking && !ctrl.provisioningDisabled {
+		permissions = append(permissions, "storage.k8s.io/csistoragecapacities: get, list, watch")
+	}
+	if ctrl.resolveConsumerPod && !ctrl.provisioningDisabled {
+		permissions = append(permissions, "pods: get, list, watch")
+	}
+	if ctrl.resolveSnapshots && !ctrl.provisioningDisabled {
+		permissions = append(permissions,
+			"snapshot.storage.k8s.io/volumesnapshots: get",
+			"snapshot.storage.k8s.io/volumesnapshotcontents: get")
+	}
+	if ctrl.crossNamespaceSources && !ctrl.provisioningDisabled {
+		permissions = append(permissions, "gateway.networking.k8s.io/referencegrants: list")
+	}
+	if ctrl.leaderElection {
+		permissions = append(permissions, "coordination.k8s.io/leases: get, create, update")
+	}
+	return permissions
+}
+
+// waitForCacheSync waits until the claim, volume and class informers the
+// controller has created have synced. It fails when no informer has synced within cacheSyncTimeout,
+// naming the informers that haven't synced. Each informer that syncs
+// restarts the timeout, slow but progressing syncing is no error.
+func (ctrl *ProvisionController) waitForCacheSync(ctx context.Context) error {
+	logger := klog.FromContext(ctx)
+	type informer struct {
+		resource string
+		synced   cache.InformerSynced
+	}
+	var informers []informer
+	if ctrl.claimInformer != nil {
+		informers = append(informers, informer{"persistentvolumeclaims", ctrl.claimInformer.HasSynced})
+	}
+	if ctrl.volumeInformer != nil {
+		informers = append(informers, informer{"persistentvolumes", ctrl.volumeInformer.HasSynced})
+	}
+	if !ctrl.classesUnavailable.Load() {
+		informers = append(informers, informer{"storage.k8s.io/storageclasses", ctrl.classInformer.HasSynced})
+	}
+	if ctrl.capacityInformer != nil {
+		informers = append(informers, informer{"storage.k8s.io/csistoragecapacities", ctrl.capacityInformer.HasSynced})
+	}
+	if ctrl.podInformer != nil {
+		informers = append(informers, informer{"pods", ctrl.podInformer.HasSynced})
+	}
+	synced := make([]bool, len(informers))
+	deadline := ctrl.clock.Now().Add(ctrl.cacheSyncTimeout)
+	for {
+		var pending []string
+		for i, informer := range informers {
+			if synced[i] {
+				continue
+			}
+			if informer.synced() {
+				synced[i] = true
+				logger.V(2).Info("Informer cache synced", "resource", informer.resource)
+				deadline = ctrl.clock.Now().Add(ctrl.cacheSyncTimeout)
+				continue
+			}
+			pending = append(pending, informer.resource)
+		}
+		if len(pending) == 0 {
+			return nil
+		}
+		if ctrl.cacheSyncTimeout > 0 && ctrl.clock.Now().After(deadline) {
+			return fmt.Errorf("informer caches of %s have not synced within %v, check that the controller is allowed to list and watch them", strings.Join(pending, ", "), ctrl.cacheSyncTimeout)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ctrl.clock.After(cacheSyncPollInterval):
+		}
+	}
+}
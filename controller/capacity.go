@@ -0,0 +1,130 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	storage "k8s.io/api/storage/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/tools/cache"
+)
+
+// defaultStorageCapacityRetryDelay is how long claims wait for capacity
+// reported by CSIStorageCapacity objects, see UseStorageCapacityTracking.
+const defaultStorageCapacityRetryDelay = time.Minute
+
+// capacityClassIndex is the name of the index of CSIStorageCapacity objects
+// by their storage class.
+const capacityClassIndex = "storageClass"
+
+// errNoStorageCapacity is returned when no CSIStorageCapacity object reports
+// enough capacity for a claim. The claim is requeued after
+// storageCapacityRetryDelay, it is not a provisioning failure.
+var errNoStorageCapacity = errors.New("not enough storage capacity")
+
+// newCapacityInformer returns an informer of CSIStorageCapacity objects
+// indexed by storage class, from factory.
+func newCapacityInformer(factory informers.SharedInformerFactory) (cache.SharedIndexInformer, error) {
+	informer := factory.Storage().V1().CSIStorageCapacities().Informer()
+	if _, exists := informer.GetIndexer().GetIndexers()[capacityClassIndex]; exists {
+		return informer, nil
+	}
+	err := informer.AddIndexers(cache.Indexers{
+		capacityClassIndex: func(obj interface{}) ([]string, error) {
+			capacity, ok := obj.(*storage.CSIStorageCapacity)
+			if !ok {
+				return nil, nil
+			}
+			return []string{capacity.StorageClassName}, nil
+		},
+	})
+	return informer, err
+}
+
+// hasStorageCapacity returns whether a CSIStorageCapacity object of class
+// reports enough capacity for claim in the topology segment of node, or in
+// any segment when node is nil, i.e. for Immediate binding. Classes without
+// capacity objects are not checked, their capacity is unknown. Neither are
+// claims that may be provisioned in background already, their volume may
+// take the reported capacity.
+func (ctrl *ProvisionController) hasStorageCapacity(claim *v1.PersistentVolumeClaim, class *storage.StorageClass, node *v1.Node) (bool, error) {
+	if ctrl.capacityInformer == nil {
+		return true, nil
+	}
+	if ctrl.capacityClasses.Len() > 0 && !ctrl.capacityClasses.Has(class.Name) {
+		return true, nil
+	}
+	if _, inProgress := ctrl.claimsInProgress.Load(string(claim.UID)); inProgress {
+		return true, nil
+	}
+	objs, err := ctrl.capacityInformer.GetIndexer().ByIndex(capacityClassIndex, class.Name)
+	if err != nil {
+		return false, err
+	}
+	if len(objs) == 0 {
+		return true, nil
+	}
+	requested := claim.Spec.Resources.Requests[v1.ResourceStorage]
+	for _, obj := range objs {
+		capacity, ok := obj.(*storage.CSIStorageCapacity)
+		if !ok {
+			continue
+		}
+		if node != nil {
+			matches, err := capacityMatchesNode(capacity, node)
+			if err != nil {
+				return false, err
+			}
+			if !matches {
+				continue
+			}
+		}
+		if size := capacitySize(capacity); size != nil && size.Cmp(requested) >= 0 {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// capacityMatchesNode returns true if node is in the topology segment of
+// capacity. A nil NodeTopology matches no node.
+func capacityMatchesNode(capacity *storage.CSIStorageCapacity, node *v1.Node) (bool, error) {
+	if capacity.NodeTopology == nil {
+		return false, nil
+	}
+	selector, err := metav1.LabelSelectorAsSelector(capacity.NodeTopology)
+	if err != nil {
+		return false, fmt.Errorf("invalid node topology of CSIStorageCapacity %s/%s: %v", capacity.Namespace, capacity.Name, err)
+	}
+	return selector.Matches(labels.Set(node.Labels)), nil
+}
+
+// capacitySize returns the size of the largest volume that fits in capacity,
+// or nil if it is unknown.
+func capacitySize(capacity *storage.CSIStorageCapacity) *resource.Quantity {
+	if capacity.MaximumVolumeSize != nil {
+		return capacity.MaximumVolumeSize
+	}
+	return capacity.Capacity
+}
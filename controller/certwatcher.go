@@ -0,0 +1,134 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	klog "k8s.io/klog/v2"
+	"k8s.io/utils/clock"
+)
+
+// DefaultCertWatchInterval is how often the metrics server checks its
+// certificate and key files for changes.
+const DefaultCertWatchInterval = 10 * time.Second
+
+// certWatcher holds a TLS certificate loaded from a cert/key file pair and
+// reloads it whenever one of the files changes on disk, so that rotated
+// certificates (e.g. by cert-manager) are picked up without a restart.
+type certWatcher struct {
+	certFile string
+	keyFile  string
+	interval time.Duration
+	clock    clock.Clock
+
+	lock        sync.RWMutex
+	cert        *tls.Certificate
+	certModTime time.Time
+	keyModTime  time.Time
+}
+
+// newCertWatcher loads the given cert/key pair. It returns an error if the
+// files cannot be read or do not form a valid key pair.
+func newCertWatcher(certFile, keyFile string) (*certWatcher, error) {
+	w := &certWatcher{
+		certFile: certFile,
+		keyFile:  keyFile,
+		interval: DefaultCertWatchInterval,
+		clock:    clock.RealClock{},
+	}
+	if _, err := w.reload(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// GetCertificate returns the currently loaded certificate. It is meant to be
+// used as tls.Config.GetCertificate.
+func (w *certWatcher) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	w.lock.RLock()
+	defer w.lock.RUnlock()
+	return w.cert, nil
+}
+
+// reload loads the cert/key pair again if any of the files has changed since
+// the last load. Returns whether a new certificate was loaded.
+func (w *certWatcher) reload() (bool, error) {
+	certInfo, err := os.Stat(w.certFile)
+	if err != nil {
+		return false, fmt.Errorf("failed to stat certificate file %q: %v", w.certFile, err)
+	}
+	keyInfo, err := os.Stat(w.keyFile)
+	if err != nil {
+		return false, fmt.Errorf("failed to stat key file %q: %v", w.keyFile, err)
+	}
+
+	w.lock.RLock()
+	unchanged := w.cert != nil && certInfo.ModTime().Equal(w.certModTime) && keyInfo.ModTime().Equal(w.keyModTime)
+	w.lock.RUnlock()
+	if unchanged {
+		return false, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(w.certFile, w.keyFile)
+	if err != nil {
+		return false, fmt.Errorf("failed to load certificate %q and key %q: %v", w.certFile, w.keyFile, err)
+	}
+
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	w.cert = &cert
+	w.certModTime = certInfo.ModTime()
+	w.keyModTime = keyInfo.ModTime()
+	return true, nil
+}
+
+// Run periodically checks the cert/key files and reloads them on change until
+// ctx is done. A pair that fails to load is logged and the previous
+// certificate stays in use.
+func (w *certWatcher) Run(ctx context.Context) {
+	logger := klog.FromContext(ctx)
+	untilWithClock(ctx, w.clock, func(ctx context.Context) {
+		reloaded, err := w.reload()
+		if err != nil {
+			logger.Error(err, "Failed to reload metrics server certificate, keeping the previous one")
+			return
+		}
+		if reloaded {
+			logger.Info("Reloaded metrics server certificate", "certFile", w.certFile, "keyFile", w.keyFile)
+		}
+	}, w.interval)
+}
+
+// loadClientCAs reads a PEM bundle of CA certificates used to verify clients.
+func loadClientCAs(caFile string) (*x509.CertPool, error) {
+	data, err := os.ReadFile(caFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read client CA file %q: %v", caFile, err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("no valid certificates found in client CA file %q", caFile)
+	}
+	return pool, nil
+}
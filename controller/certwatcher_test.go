@@ -0,0 +1,227 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/klog/v2/ktesting"
+)
+
+func TestCertWatcherRotation(t *testing.T) {
+	_, ctx := ktesting.NewTestContext(t)
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "tls.crt")
+	keyFile := filepath.Join(dir, "tls.key")
+	certPEM1 := writeTestCert(t, certFile, keyFile, 1, time.Now().Add(-time.Hour))
+
+	watcher, err := newCertWatcher(certFile, keyFile)
+	if err != nil {
+		t.Fatalf("unexpected error loading certificate: %v", err)
+	}
+	watcher.interval = 10 * time.Millisecond
+	go watcher.Run(ctx)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &http.Server{
+		Handler:   http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}),
+		TLSConfig: &tls.Config{GetCertificate: watcher.GetCertificate},
+	}
+	go server.ServeTLS(listener, "", "")
+	defer server.Close()
+	url := "https://" + listener.Addr().String()
+
+	if serial := getServingSerial(t, url, certPEM1); serial != 1 {
+		t.Errorf("expected certificate serial 1, got %d", serial)
+	}
+
+	certPEM2 := writeTestCert(t, certFile, keyFile, 2, time.Now())
+	err = wait.PollUntilContextTimeout(ctx, 10*time.Millisecond, time.Second, true, func(context.Context) (bool, error) {
+		return getServingSerial(t, url, certPEM2) == 2, nil
+	})
+	if err != nil {
+		t.Errorf("rotated certificate was not picked up")
+	}
+}
+
+func TestMetricsTLSConfig(t *testing.T) {
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "tls.crt")
+	keyFile := filepath.Join(dir, "tls.key")
+	otherKeyFile := filepath.Join(dir, "other.key")
+	caFile := filepath.Join(dir, "ca.crt")
+	writeTestCert(t, certFile, keyFile, 1, time.Now())
+	caPEM := writeTestCert(t, filepath.Join(dir, "other.crt"), otherKeyFile, 2, time.Now())
+	if err := os.WriteFile(caFile, caPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name          string
+		options       []func(*ProvisionController) error
+		expectTLS     bool
+		expectMTLS    bool
+		expectedError bool
+	}{
+		{
+			name: "plain HTTP",
+		},
+		{
+			name:      "TLS",
+			options:   []func(*ProvisionController) error{MetricsCertFile(certFile), MetricsKeyFile(keyFile)},
+			expectTLS: true,
+		},
+		{
+			name:       "mTLS",
+			options:    []func(*ProvisionController) error{MetricsCertFile(certFile), MetricsKeyFile(keyFile), MetricsClientCAFile(caFile)},
+			expectTLS:  true,
+			expectMTLS: true,
+		},
+		{
+			name:          "cert without key",
+			options:       []func(*ProvisionController) error{MetricsCertFile(certFile)},
+			expectedError: true,
+		},
+		{
+			name:          "client CA without cert",
+			options:       []func(*ProvisionController) error{MetricsClientCAFile(caFile)},
+			expectedError: true,
+		},
+		{
+			name:          "mismatched cert and key",
+			options:       []func(*ProvisionController) error{MetricsCertFile(certFile), MetricsKeyFile(otherKeyFile)},
+			expectedError: true,
+		},
+		{
+			name:          "missing cert file",
+			options:       []func(*ProvisionController) error{MetricsCertFile(filepath.Join(dir, "missing.crt")), MetricsKeyFile(keyFile)},
+			expectedError: true,
+		},
+		{
+			name:          "invalid client CA",
+			options:       []func(*ProvisionController) error{MetricsCertFile(certFile), MetricsKeyFile(keyFile), MetricsClientCAFile(keyFile)},
+			expectedError: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			logger, ctx := ktesting.NewTestContext(t)
+			ctx, cancel := context.WithCancel(ctx)
+			defer cancel()
+			ctrl := newTestProvisionController(logger, fake.NewSimpleClientset(), "foo.bar/baz", newTestProvisioner(), test.options...)
+
+			tlsConfig, err := ctrl.metricsTLSConfig(ctx)
+			if test.expectedError {
+				if err == nil {
+					t.Errorf("expected error, got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if (tlsConfig != nil) != test.expectTLS {
+				t.Errorf("expected TLS %v, got config %+v", test.expectTLS, tlsConfig)
+			}
+			if tlsConfig != nil && (tlsConfig.ClientAuth == tls.RequireAndVerifyClientCert) != test.expectMTLS {
+				t.Errorf("expected mTLS %v, got client auth %v", test.expectMTLS, tlsConfig.ClientAuth)
+			}
+		})
+	}
+}
+
+// writeTestCert writes a self-signed certificate for 127.0.0.1 with the given
+// serial number and its key and returns the PEM encoded certificate.
+func writeTestCert(t *testing.T, certFile, keyFile string, serial int64, modTime time.Time) []byte {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(serial),
+		Subject:               pkix.Name{CommonName: "metrics"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	if err := os.WriteFile(certFile, certPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	// Make sure the watcher notices the change even on filesystems with
+	// coarse modification time granularity.
+	for _, f := range []string{certFile, keyFile} {
+		if err := os.Chtimes(f, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return certPEM
+}
+
+// getServingSerial connects to url trusting only caPEM and returns serial
+// number of the served certificate, or -1 if the handshake fails.
+func getServingSerial(t *testing.T, url string, caPEM []byte) int64 {
+	pool := x509.NewCertPool()
+	pool.AppendCertsFromPEM(caPEM)
+	client := &http.Client{Transport: &http.Transport{
+		TLSClientConfig:   &tls.Config{RootCAs: pool},
+		DisableKeepAlives: true,
+	}}
+	resp, err := client.Get(url)
+	if err != nil {
+		return -1
+	}
+	defer resp.Body.Close()
+	return resp.TLS.PeerCertificates[0].SerialNumber.Int64()
+}
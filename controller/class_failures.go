@@ -0,0 +1,136 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	storage "k8s.io/api/storage/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/utils/clock"
+)
+
+// classFailureTracker detects provisioning failures with the same error in
+// many claims of a StorageClass, which usually means the class itself (or
+// the backend behind it) is misconfigured.
+type classFailureTracker struct {
+	// Number of failures within window that trigger a class event.
+	threshold int
+	window    time.Duration
+	now       func() time.Time
+
+	lock sync.Mutex
+	// Map class name -> error fingerprint -> failures.
+	classes map[string]map[string]*classFailures
+}
+
+// classFailures are recent failures of a class with the same fingerprint.
+type classFailures struct {
+	failures  []classFailure
+	lastEvent time.Time
+}
+
+type classFailure struct {
+	claimUID types.UID
+	time     time.Time
+}
+
+func newClassFailureTracker(threshold int, window time.Duration) *classFailureTracker {
+	return &classFailureTracker{
+		threshold: threshold,
+		window:    window,
+		now:       clock.RealClock{}.Now,
+		classes:   map[string]map[string]*classFailures{},
+	}
+}
+
+// observe records a failure of the claim and returns the number of distinct
+// claims that failed with the same fingerprint within the window, and
+// whether a class event should be sent now. Events are sent at most once per
+// window for each fingerprint.
+func (t *classFailureTracker) observe(className, fingerprint string, claimUID types.UID) (int, bool) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	now := t.now()
+	fingerprints := t.classes[className]
+	if fingerprints == nil {
+		fingerprints = map[string]*classFailures{}
+		t.classes[className] = fingerprints
+	}
+	// Forget failures outside of the window.
+	for key, f := range fingerprints {
+		recent := f.failures[:0]
+		for _, failure := range f.failures {
+			if now.Sub(failure.time) < t.window {
+				recent = append(recent, failure)
+			}
+		}
+		f.failures = recent
+		if len(f.failures) == 0 && now.Sub(f.lastEvent) >= t.window {
+			delete(fingerprints, key)
+		}
+	}
+
+	f := fingerprints[fingerprint]
+	if f == nil {
+		f = &classFailures{}
+		fingerprints[fingerprint] = f
+	}
+	f.failures = append(f.failures, classFailure{claimUID: claimUID, time: now})
+	if len(f.failures) < t.threshold || (!f.lastEvent.IsZero() && now.Sub(f.lastEvent) < t.window) {
+		return 0, false
+	}
+	f.lastEvent = now
+
+	claims := map[types.UID]bool{}
+	for _, failure := range f.failures {
+		claims[failure.claimUID] = true
+	}
+	return len(claims), true
+}
+
+// errorFingerprint returns the error message of a failed provisioning with
+// the parts specific to the claim replaced, so that the same backend error
+// of different claims has the same fingerprint.
+func errorFingerprint(err error, claim *v1.PersistentVolumeClaim, pvName string) string {
+	return strings.NewReplacer(
+		pvName, "<pv>",
+		string(claim.UID), "<uid>",
+		claim.Namespace+"/"+claim.Name, "<claim>",
+	).Replace(err.Error())
+}
+
+// recordClassFailure tracks a failed provisioning of the claim and sends a
+// Warning event to its StorageClass when the same error is seen in too many
+// claims of the class.
+func (ctrl *ProvisionController) recordClassFailure(class *storage.StorageClass, claim *v1.PersistentVolumeClaim, pvName string, err error) {
+	if ctrl.classFailures == nil {
+		return
+	}
+	fingerprint := errorFingerprint(err, claim, pvName)
+	claims, report := ctrl.classFailures.observe(class.Name, fingerprint, claim.UID)
+	if !report {
+		return
+	}
+	msg := fmt.Sprintf("%d claims failed to provision within %s with the same error: %s", claims, ctrl.classFailures.window, fingerprint)
+	ctrl.event(class, v1.EventTypeWarning, "ProvisioningFailedRepeatedly", msg)
+}
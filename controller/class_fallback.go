@@ -0,0 +1,92 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	storage "k8s.io/api/storage/v1"
+	apierrs "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/cache"
+	klog "k8s.io/klog/v2"
+)
+
+// defaultClassAPICheckInterval is how often StorageClassAPIFallback checks
+// whether storage.k8s.io/v1 StorageClasses can be listed again.
+const defaultClassAPICheckInterval = 5 * time.Minute
+
+// errClassesUnavailable is returned by ClassesLister while the controller
+// runs without class cache, see StorageClassAPIFallback.
+var errClassesUnavailable = fmt.Errorf("storage.k8s.io/v1 StorageClasses are not available, classes are not cached")
+
+// startClassInformer starts the class informer created by the controller.
+// With StorageClassAPIFallback, when the storage.k8s.io/v1 StorageClass API
+// does not exist, it runs without class cache and starts the informer once
+// the API exists, e.g. after the cluster was upgraded.
+func (ctrl *ProvisionController) startClassInformer(ctx context.Context) {
+	if ctrl.customClassInformer {
+		return
+	}
+	if !ctrl.classAPIFallback || ctrl.classAPIAvailable(ctx) {
+		ctrl.goBackground(func() { ctrl.classInformer.Run(ctx.Done()) })
+		return
+	}
+	logger := klog.FromContext(ctx)
+	logger.Info("Warning: storage.k8s.io/v1 StorageClasses are not available, running without class cache. Classes are fetched from storage.k8s.io/v1beta1 for each claim, ValidateTopologyKeys and ClassesLister are disabled and claims are not synced when their class changes")
+	ctrl.classesUnavailable.Store(true)
+	ctrl.goBackground(func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ctrl.clock.After(ctrl.classAPICheckInterval):
+			}
+			if ctrl.classAPIAvailable(ctx) {
+				break
+			}
+		}
+		ctrl.goBackground(func() { ctrl.classInformer.Run(ctx.Done()) })
+		if cache.WaitForCacheSync(ctx.Done(), ctrl.classInformer.HasSynced) {
+			ctrl.classesUnavailable.Store(false)
+			logger.Info("storage.k8s.io/v1 StorageClasses are available, using class cache")
+		}
+	})
+}
+
+// classAPIAvailable returns false when listing storage.k8s.io/v1
+// StorageClasses fails with NotFound. Other errors are left to the informer,
+// which retries them.
+func (ctrl *ProvisionController) classAPIAvailable(ctx context.Context) bool {
+	_, err := ctrl.objectClient.StorageV1().StorageClasses().List(ctx, metav1.ListOptions{Limit: 1})
+	return !apierrs.IsNotFound(err)
+}
+
+// getLegacyStorageClass gets a storage.k8s.io/v1beta1 class from API server
+// while classes are not cached.
+func (ctrl *ProvisionController) getLegacyStorageClass(ctx context.Context, name string) (*storage.StorageClass, error) {
+	class, err := ctrl.objectClient.StorageV1beta1().StorageClasses().Get(ctx, name, metav1.GetOptions{})
+	if apierrs.IsNotFound(err) {
+		return nil, fmt.Errorf("storageClass %q not found", name)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return toStorageClass(class)
+}
@@ -0,0 +1,92 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"sigs.k8s.io/sig-storage-lib-external-provisioner/v10/util"
+)
+
+// ClassPolicy is the retry policy of claims and volumes of a StorageClass,
+// see ClassOverrides. Its fields have the meaning of the options of the same
+// name, a zero threshold retries forever.
+type ClassPolicy struct {
+	FailedProvisionThreshold int
+	FailedDeleteThreshold    int
+	// ProvisionRetryBackoff replaces FailedProvisionThreshold when set.
+	ProvisionRetryBackoff *wait.Backoff
+}
+
+// globalPolicy returns the policy of classes without override.
+func (ctrl *ProvisionController) globalPolicy() ClassPolicy {
+	return ClassPolicy{
+		FailedProvisionThreshold: ctrl.failedProvisionThreshold,
+		FailedDeleteThreshold:    ctrl.failedDeleteThreshold,
+		ProvisionRetryBackoff:    ctrl.provisionRetryBackoff,
+	}
+}
+
+// classPolicy returns the policy of the given class.
+func (ctrl *ProvisionController) classPolicy(class string) ClassPolicy {
+	if policy, found := ctrl.classOverrides[class]; found {
+		return policy
+	}
+	return ctrl.globalPolicy()
+}
+
+// claimPolicy returns the policy of the current class of the claim with the
+// given queue key. The class is resolved on every retry, the class of a
+// pending claim may change in the meantime.
+func (ctrl *ProvisionController) claimPolicy(key string) ClassPolicy {
+	if len(ctrl.classOverrides) == 0 {
+		return ctrl.globalPolicy()
+	}
+	claim := ctrl.claimByKey(key)
+	if claim == nil {
+		return ctrl.globalPolicy()
+	}
+	return ctrl.classPolicy(util.GetPersistentVolumeClaimClass(claim))
+}
+
+// volumePolicy returns the policy of the class of the volume with the given
+// queue key. Volumes cached by VolumeMetadataClient have no class and get
+// the global policy.
+func (ctrl *ProvisionController) volumePolicy(key string) ClassPolicy {
+	if len(ctrl.classOverrides) == 0 {
+		return ctrl.globalPolicy()
+	}
+	volumeObj, exists, err := ctrl.volumes.GetByKey(key)
+	if err != nil || !exists {
+		return ctrl.globalPolicy()
+	}
+	volume, ok := volumeObj.(*v1.PersistentVolume)
+	if !ok {
+		return ctrl.globalPolicy()
+	}
+	return ctrl.classPolicy(util.GetPersistentVolumeClass(volume))
+}
+
+// claimRetryBackoffFor returns the retry backoff of the claim with the given
+// queue key, nil when it's retried up to a threshold.
+func (ctrl *ProvisionController) claimRetryBackoffFor(item interface{}) *wait.Backoff {
+	key, ok := item.(string)
+	if !ok {
+		return ctrl.provisionRetryBackoff
+	}
+	return ctrl.claimPolicy(key).ProvisionRetryBackoff
+}
@@ -0,0 +1,54 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/utils/clock"
+)
+
+// tickerClock returns c if it can create tickers, as the work queues need,
+// and the real clock otherwise.
+func tickerClock(c clock.Clock) clock.WithTicker {
+	if withTicker, ok := c.(clock.WithTicker); ok {
+		return withTicker
+	}
+	return clock.RealClock{}
+}
+
+// untilWithClock is wait.UntilWithContext with the period measured by c.
+func untilWithClock(ctx context.Context, c clock.Clock, f func(context.Context), period time.Duration) {
+	wait.BackoffUntil(func() { f(ctx) }, wait.NewJitteredBackoffManager(period, 0, c), true, ctx.Done())
+}
+
+// exponentialBackoffWithClock is wait.ExponentialBackoff with the delays
+// measured by c.
+func exponentialBackoffWithClock(c clock.Clock, backoff wait.Backoff, condition wait.ConditionFunc) error {
+	for backoff.Steps > 0 {
+		if ok, err := condition(); err != nil || ok {
+			return err
+		}
+		if backoff.Steps == 1 {
+			break
+		}
+		c.Sleep(backoff.Step())
+	}
+	return wait.ErrorInterrupted(nil)
+}
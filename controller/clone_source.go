@@ -0,0 +1,208 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	v1 "k8s.io/api/core/v1"
+	storage "k8s.io/api/storage/v1"
+	apierrs "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/sig-storage-lib-external-provisioner/v10/util"
+)
+
+// CloneSourceInfo describes the claim a new volume is cloned from and its
+// bound PV, see CloneSupporter.
+type CloneSourceInfo struct {
+	// Namespace and name of the source claim.
+	Namespace string
+	Name      string
+	// Name of the PV bound to the source claim.
+	VolumeName string
+	// Volume handle and attributes of a CSI source PV, empty for other PVs.
+	VolumeHandle     string
+	VolumeAttributes map[string]string
+	// Capacity of the source PV.
+	Capacity resource.Quantity
+	// Volume mode of the source PV, the same as of the new claim.
+	VolumeMode v1.PersistentVolumeMode
+}
+
+// cloneError is a clone source that violates a rule of cloning. Provisioning
+// of the claim is not retried, the claim must be fixed.
+type cloneError struct {
+	reason string
+	msg    string
+}
+
+func (e *cloneError) Error() string {
+	return e.msg
+}
+
+// claimDataSource returns the data source of the claim, preferring
+// dataSourceRef over dataSource. The namespace is the claim's namespace
+// unless dataSourceRef sets another one.
+func claimDataSource(claim *v1.PersistentVolumeClaim) (group, kind, namespace, name string, found bool) {
+	namespace = claim.Namespace
+	var apiGroup *string
+	switch {
+	case claim.Spec.DataSourceRef != nil:
+		apiGroup, kind, name = claim.Spec.DataSourceRef.APIGroup, claim.Spec.DataSourceRef.Kind, claim.Spec.DataSourceRef.Name
+		if claim.Spec.DataSourceRef.Namespace != nil && *claim.Spec.DataSourceRef.Namespace != "" {
+			namespace = *claim.Spec.DataSourceRef.Namespace
+		}
+	case claim.Spec.DataSource != nil:
+		apiGroup, kind, name = claim.Spec.DataSource.APIGroup, claim.Spec.DataSource.Kind, claim.Spec.DataSource.Name
+	default:
+		return "", "", "", "", false
+	}
+	if apiGroup != nil {
+		group = *apiGroup
+	}
+	return group, kind, namespace, name, true
+}
+
+// isCloneClaim returns whether the data source of the claim is another claim.
+func isCloneClaim(claim *v1.PersistentVolumeClaim) bool {
+	group, kind, _, _, found := claimDataSource(claim)
+	return found && group == "" && kind == "PersistentVolumeClaim"
+}
+
+// foreignDataSource returns whether the claim has a data source of a kind
+// that the provisioner does not support, i.e. neither a claim nor a
+// VolumeSnapshot nor any of SupportedDataSources. Unless
+// ProvisionForeignDataSources is set, such claims are left to the volume
+// populator of the kind.
+func (ctrl *ProvisionController) foreignDataSource(claim *v1.PersistentVolumeClaim) bool {
+	group, kind, _, _, found := claimDataSource(claim)
+	if !found || ctrl.provisionForeignSources {
+		return false
+	}
+	if (group == "" && kind == "PersistentVolumeClaim") || (group == snapshotGroup && kind == snapshotKind) {
+		return false
+	}
+	return !slices.Contains(ctrl.supportedDataSources, schema.GroupKind{Group: group, Kind: kind})
+}
+
+// supportsClone returns whether the provisioner implements CloneSupporter
+// and supports cloning.
+func (ctrl *ProvisionController) supportsClone(ctx context.Context) bool {
+	if cloneSupporter, ok := ctrl.provisioner.(CloneSupporter); ok {
+		return cloneSupporter.SupportsClone(ctx)
+	}
+	return false
+}
+
+// cloneSource validates the source claim of a claim to be cloned and returns
+// it with its PV. It returns nil for claims that are not cloned, a
+// *cloneError when the source can't be cloned into the claim, and another
+// error while the source does not exist or is not bound yet. A source in
+// another namespace gets here only with CrossNamespaceDataSources, after its
+// ReferenceGrant has been checked.
+func (ctrl *ProvisionController) cloneSource(ctx context.Context, claim *v1.PersistentVolumeClaim, class *storage.StorageClass) (*CloneSourceInfo, error) {
+	if !isCloneClaim(claim) {
+		return nil, nil
+	}
+	_, _, namespace, name, _ := claimDataSource(claim)
+	obj, exists, err := ctrl.claimsIndexer.GetByKey(namespace + "/" + name)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, fmt.Errorf("source claim %s/%s not found", namespace, name)
+	}
+	source, ok := obj.(*v1.PersistentVolumeClaim)
+	if !ok {
+		return nil, fmt.Errorf("expected claim in cache but got %#v", obj)
+	}
+	if source.DeletionTimestamp != nil {
+		return nil, fmt.Errorf("source claim %s/%s is being deleted", namespace, name)
+	}
+	if source.Spec.VolumeName == "" || source.Status.Phase != v1.ClaimBound {
+		return nil, fmt.Errorf("source claim %s/%s is not bound", namespace, name)
+	}
+
+	if sourceClass := util.GetPersistentVolumeClaimClass(source); sourceClass != class.Name {
+		// A claim of another class of the same provisioner can be cloned.
+		other, err := ctrl.getStorageClass(ctx, sourceClass)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get StorageClass %q of source claim %s/%s: %v", sourceClass, namespace, name, err)
+		}
+		if other.Provisioner != class.Provisioner {
+			return nil, &cloneError{"CloneSourceClassMismatch", fmt.Sprintf("StorageClass %q of source claim %s/%s is not provisioned by %s", sourceClass, namespace, name, class.Provisioner)}
+		}
+	}
+
+	volume, err := ctrl.getVolume(ctx, source.Spec.VolumeName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get PV %s of source claim %s/%s: %v", source.Spec.VolumeName, namespace, name, err)
+	}
+	capacity := volume.Spec.Capacity[v1.ResourceStorage]
+	requested := claim.Spec.Resources.Requests[v1.ResourceStorage]
+	if requested.Cmp(capacity) < 0 {
+		return nil, &cloneError{"CloneSizeTooSmall", fmt.Sprintf("requested size %s is smaller than size %s of source claim %s/%s", requested.String(), capacity.String(), namespace, name)}
+	}
+	volumeMode := v1.PersistentVolumeFilesystem
+	if volume.Spec.VolumeMode != nil {
+		volumeMode = *volume.Spec.VolumeMode
+	}
+	claimMode := v1.PersistentVolumeFilesystem
+	if claim.Spec.VolumeMode != nil {
+		claimMode = *claim.Spec.VolumeMode
+	}
+	if volumeMode != claimMode {
+		return nil, &cloneError{"CloneVolumeModeMismatch", fmt.Sprintf("volume mode %s of the claim does not match volume mode %s of source claim %s/%s", claimMode, volumeMode, namespace, name)}
+	}
+
+	info := &CloneSourceInfo{
+		Namespace:  namespace,
+		Name:       name,
+		VolumeName: volume.Name,
+		Capacity:   capacity,
+		VolumeMode: volumeMode,
+	}
+	if csi := volume.Spec.CSI; csi != nil {
+		info.VolumeHandle = csi.VolumeHandle
+		info.VolumeAttributes = csi.VolumeAttributes
+	}
+	return info, nil
+}
+
+// getVolume returns the PV from the cache, or from API server when full PVs
+// are not cached.
+func (ctrl *ProvisionController) getVolume(ctx context.Context, name string) (*v1.PersistentVolume, error) {
+	if ctrl.volumes != nil && ctrl.volumeMetadataClient == nil {
+		obj, exists, err := ctrl.volumes.GetByKey(name)
+		if err != nil {
+			return nil, err
+		}
+		if !exists {
+			return nil, apierrs.NewNotFound(v1.Resource("persistentvolume"), name)
+		}
+		volume, ok := obj.(*v1.PersistentVolume)
+		if !ok {
+			return nil, fmt.Errorf("expected volume in cache but got %#v", obj)
+		}
+		return volume, nil
+	}
+	return ctrl.objectClient.CoreV1().PersistentVolumes().Get(ctx, name, metav1.GetOptions{})
+}
@@ -0,0 +1,393 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"errors"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	corelistersv1 "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/metadata"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/workqueue"
+	"k8s.io/klog/v2"
+	"k8s.io/utils/clock"
+	"sigs.k8s.io/sig-storage-lib-external-provisioner/v10/controller/metrics"
+)
+
+// configValidationName is the provisioner name Validate checks a Config
+// with. The name only matters for the default EventComponent.
+const configValidationName = "config.validation"
+
+// Config holds the settings of the option functions of NewProvisionController
+// as plain fields, for NewProvisionControllerWithConfig. Each field has the
+// meaning of the option of the same name. The zero value of a field means
+// the default of its option, fields whose option accepts a zero value other
+// than the default are pointers.
+type Config struct {
+	// Logger of the controller. Defaults to klog.Background().
+	Logger klog.Logger
+
+	// Informers and caches.
+	ResyncPeriod                 time.Duration
+	ClaimResyncPeriod            *time.Duration
+	VolumeResyncPeriod           *time.Duration
+	ClassResyncPeriod            *time.Duration
+	CacheSyncTimeout             *time.Duration
+	SharedInformerFactory        informers.SharedInformerFactory
+	ClaimsInformer               cache.SharedIndexInformer
+	VolumesInformer              cache.SharedInformer
+	ClassesInformer              cache.SharedInformer
+	NodesLister                  corelistersv1.NodeLister
+	VolumeMetadataClient         metadata.Interface
+	VolumeListWatchLabelSelector string
+	// CachedAnnotationSizeLimit and the annotations it keeps, see the
+	// option of the same name.
+	CachedAnnotationSizeLimit int
+	KeptAnnotations           []string
+
+	DeletionDisabled     bool
+	ProvisioningDisabled bool
+
+	// Workers, queues and retries.
+	Threadiness                 int
+	ProvisionThreadiness        int
+	DeletionThreadiness         int
+	RateLimiter                 workqueue.RateLimiter
+	ClaimQueueRateLimiter       workqueue.RateLimiter
+	VolumeQueueRateLimiter      workqueue.RateLimiter
+	ExponentialBackOffOnError   *bool
+	FailedProvisionThreshold    *int
+	FailedDeleteThreshold       *int
+	ProvisionRetryBackoff       *wait.Backoff
+	PersistRetryState           bool
+	ClassOverrides              map[string]ClassPolicy
+	ProvisionTimeout            time.Duration
+	DeletionTimeout             time.Duration
+	MaxInFlightOperations       int
+	PerNodeProvisionConcurrency int
+	InitialSyncBurstLimit       float64
+	StartupJitter               time.Duration
+	ShutdownGracePeriod         *time.Duration
+	ClaimQueueFairnessThreshold *int
+	Clock                       clock.Clock
+
+	// Saving of provisioned PVs.
+	CreateProvisionedPVRetryCount int
+	CreateProvisionedPVInterval   time.Duration
+	CreateProvisionedPVBackoff    *wait.Backoff
+	CreateProvisionedPVLimiter    workqueue.RateLimiter
+	OnPVSaveFailure               PVSaveFailurePolicy
+	UseServerSideApply            bool
+	VolumeStore                   VolumeStore
+	PVWriteClient                 kubernetes.Interface
+	ObjectClient                  kubernetes.Interface
+	VolumeSavePendingWarningAge   *time.Duration
+	VolumeDriftAuditInterval      time.Duration
+	AddFinalizer                  bool
+	PVFinalizer                   string
+	HonorPVReclaimPolicy          bool
+	ProvisionedByAnnotation       string
+
+	// Claims and their data sources.
+	AdditionalProvisionerNames []string
+	AdoptProvisionerNames      []string
+	AllowLegacyProvisionerName bool
+	TranslatedInTreePluginName string
+	NodeExpansionRequired      bool
+	MissingNodeGracePeriod     *time.Duration
+	StorageClassAPIFallback    bool
+	AvoidUnschedulableNodes    bool
+	// Taints of AvoidUnschedulableNodes, requires it.
+	AvoidedNodeTaints          []v1.Taint
+	UseStorageCapacityTracking bool
+	// Classes of UseStorageCapacityTracking, requires it.
+	StorageCapacityClasses      []string
+	ValidateTopologyKeys        bool
+	RequireSelectedNode         bool
+	ResolveConsumerPod          bool
+	ResolveSnapshotDataSource   bool
+	SnapshotReadyRetryDelay     time.Duration
+	CrossNamespaceDataSources   bool
+	SupportedDataSources        []schema.GroupKind
+	ProvisionForeignDataSources bool
+	DynamicClient               dynamic.Interface
+	RESTMapper                  meta.RESTMapper
+
+	// Whether to pass parameters of VolumeAttributesClasses to Provision.
+	ResolveVolumeAttributesClass bool
+
+	// File systems allowed in the fsType parameter and the default one, see
+	// the option AllowedFSTypes.
+	AllowedFSTypes []string
+	DefaultFSType  string
+
+	// Settings of the clients passed by the caller.
+	ClientQPS   float32
+	ClientBurst int
+	UserAgent   string
+
+	// Events and logging.
+	EventRecorder          record.EventRecorder
+	EventComponent         string
+	EventAggregationWindow time.Duration
+	// Threshold and window of ClassFailureEvents, both must be set.
+	ClassFailureEventsThreshold int
+	ClassFailureEventsWindow    time.Duration
+	SkipLogVerbosity            *int
+	ExplainSkips                bool
+
+	// Leader election.
+	LeaderElection          *bool
+	LeaderElectionNamespace string
+	LeaseDuration           time.Duration
+	RenewDeadline           time.Duration
+	RetryPeriod             time.Duration
+	ReadyWhenNotLeader      *bool
+	ReadyWhenPaused         *bool
+
+	// Metrics, tracing and debugging.
+	TracerProvider       trace.TracerProvider
+	MetricsInstance      *metrics.Metrics
+	MetricsSubsystem     *string
+	MetricsPort          int32
+	MetricsAddress       string
+	MetricsPath          string
+	MetricsServer        *bool
+	EnableProfiling      bool
+	EnableDebugEndpoints bool
+	MetricsCertFile      string
+	MetricsKeyFile       string
+	MetricsClientCAFile  string
+
+	// Features are applied after the fields above and override their
+	// features, e.g. AddFinalizer.
+	Features Features
+}
+
+// NewProvisionControllerWithConfig creates a new provision controller like
+// NewProvisionController does with the options of cfg, but returns an error
+// listing all problems of cfg instead of exiting the process.
+func NewProvisionControllerWithConfig(client kubernetes.Interface, provisionerName string, provisioner Provisioner, cfg Config) (*ProvisionController, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return newProvisionController(cfg.logger(), client, provisionerName, provisioner, cfg.options())
+}
+
+// Validate checks cfg like NewProvisionControllerWithConfig does, without
+// creating any informers. It returns all problems found, not only the first
+// one.
+func (cfg Config) Validate() error {
+	var errs []error
+	if len(cfg.AvoidedNodeTaints) > 0 && !cfg.AvoidUnschedulableNodes {
+		errs = append(errs, errors.New("AvoidedNodeTaints requires AvoidUnschedulableNodes"))
+	}
+	if len(cfg.StorageCapacityClasses) > 0 && !cfg.UseStorageCapacityTracking {
+		errs = append(errs, errors.New("StorageCapacityClasses requires UseStorageCapacityTracking"))
+	}
+	if len(cfg.KeptAnnotations) > 0 && cfg.CachedAnnotationSizeLimit == 0 {
+		errs = append(errs, errors.New("KeptAnnotations requires CachedAnnotationSizeLimit"))
+	}
+	if cfg.DefaultFSType != "" && cfg.AllowedFSTypes == nil {
+		errs = append(errs, errors.New("DefaultFSType requires AllowedFSTypes"))
+	}
+	ctrl := newDefaultProvisionController(cfg.logger(), nil, configValidationName, nil, "")
+	if err := ctrl.applyOptions(cfg.options()); err != nil {
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
+func (cfg Config) logger() klog.Logger {
+	if cfg.Logger.GetSink() == nil {
+		return klog.Background()
+	}
+	return cfg.Logger
+}
+
+// options returns the option functions of the fields set in cfg. Both
+// constructors apply the same options, so that they validate and default
+// fields the same way.
+func (cfg Config) options() []func(*ProvisionController) error {
+	var options []func(*ProvisionController) error
+	add := func(set bool, option func(*ProvisionController) error) {
+		if set {
+			options = append(options, option)
+		}
+	}
+
+	add(cfg.ResyncPeriod != 0, ResyncPeriod(cfg.ResyncPeriod))
+	if cfg.ClaimResyncPeriod != nil {
+		options = append(options, ClaimResyncPeriod(*cfg.ClaimResyncPeriod))
+	}
+	if cfg.VolumeResyncPeriod != nil {
+		options = append(options, VolumeResyncPeriod(*cfg.VolumeResyncPeriod))
+	}
+	if cfg.ClassResyncPeriod != nil {
+		options = append(options, ClassResyncPeriod(*cfg.ClassResyncPeriod))
+	}
+	if cfg.CacheSyncTimeout != nil {
+		options = append(options, CacheSyncTimeout(*cfg.CacheSyncTimeout))
+	}
+	add(cfg.SharedInformerFactory != nil, SharedInformerFactory(cfg.SharedInformerFactory))
+	add(cfg.ClaimsInformer != nil, ClaimsInformer(cfg.ClaimsInformer))
+	add(cfg.VolumesInformer != nil, VolumesInformer(cfg.VolumesInformer))
+	add(cfg.ClassesInformer != nil, ClassesInformer(cfg.ClassesInformer))
+	add(cfg.NodesLister != nil, NodesLister(cfg.NodesLister))
+	add(cfg.VolumeMetadataClient != nil, VolumeMetadataClient(cfg.VolumeMetadataClient))
+	add(cfg.VolumeListWatchLabelSelector != "", VolumeListWatchLabelSelector(cfg.VolumeListWatchLabelSelector))
+	add(cfg.CachedAnnotationSizeLimit != 0, CachedAnnotationSizeLimit(cfg.CachedAnnotationSizeLimit, cfg.KeptAnnotations...))
+	add(cfg.DeletionDisabled, DeletionDisabled(true))
+	add(cfg.ProvisioningDisabled, ProvisioningDisabled(true))
+
+	// Threadiness sets both thread counts, the specific ones override it.
+	add(cfg.Threadiness != 0, Threadiness(cfg.Threadiness))
+	add(cfg.ProvisionThreadiness != 0, ProvisionThreadiness(cfg.ProvisionThreadiness))
+	add(cfg.DeletionThreadiness != 0, DeletionThreadiness(cfg.DeletionThreadiness))
+	add(cfg.RateLimiter != nil, RateLimiter(cfg.RateLimiter))
+	add(cfg.ClaimQueueRateLimiter != nil, ClaimQueueRateLimiter(cfg.ClaimQueueRateLimiter))
+	add(cfg.VolumeQueueRateLimiter != nil, VolumeQueueRateLimiter(cfg.VolumeQueueRateLimiter))
+	if cfg.ExponentialBackOffOnError != nil {
+		options = append(options, ExponentialBackOffOnError(*cfg.ExponentialBackOffOnError))
+	}
+	if cfg.FailedProvisionThreshold != nil {
+		options = append(options, FailedProvisionThreshold(*cfg.FailedProvisionThreshold))
+	}
+	if cfg.FailedDeleteThreshold != nil {
+		options = append(options, FailedDeleteThreshold(*cfg.FailedDeleteThreshold))
+	}
+	if cfg.ProvisionRetryBackoff != nil {
+		options = append(options, ProvisionRetryBackoff(*cfg.ProvisionRetryBackoff))
+	}
+	add(cfg.PersistRetryState, PersistRetryState(true))
+	add(cfg.ClassOverrides != nil, ClassOverrides(cfg.ClassOverrides))
+	add(cfg.ProvisionTimeout != 0, ProvisionTimeout(cfg.ProvisionTimeout))
+	add(cfg.DeletionTimeout != 0, DeletionTimeout(cfg.DeletionTimeout))
+	add(cfg.MaxInFlightOperations != 0, MaxInFlightOperations(cfg.MaxInFlightOperations))
+	add(cfg.PerNodeProvisionConcurrency != 0, PerNodeProvisionConcurrency(cfg.PerNodeProvisionConcurrency))
+	add(cfg.InitialSyncBurstLimit != 0, InitialSyncBurstLimit(cfg.InitialSyncBurstLimit))
+	add(cfg.StartupJitter != 0, StartupJitter(cfg.StartupJitter))
+	if cfg.ShutdownGracePeriod != nil {
+		options = append(options, ShutdownGracePeriod(*cfg.ShutdownGracePeriod))
+	}
+	if cfg.MissingNodeGracePeriod != nil {
+		options = append(options, MissingNodeGracePeriod(*cfg.MissingNodeGracePeriod))
+	}
+	if cfg.ClaimQueueFairnessThreshold != nil {
+		options = append(options, ClaimQueueFairnessThreshold(*cfg.ClaimQueueFairnessThreshold))
+	}
+	add(cfg.Clock != nil, WithClock(cfg.Clock))
+
+	add(cfg.CreateProvisionedPVRetryCount != 0, CreateProvisionedPVRetryCount(cfg.CreateProvisionedPVRetryCount))
+	add(cfg.CreateProvisionedPVInterval != 0, CreateProvisionedPVInterval(cfg.CreateProvisionedPVInterval))
+	if cfg.CreateProvisionedPVBackoff != nil {
+		options = append(options, CreateProvisionedPVBackoff(*cfg.CreateProvisionedPVBackoff))
+	}
+	add(cfg.CreateProvisionedPVLimiter != nil, CreateProvisionedPVLimiter(cfg.CreateProvisionedPVLimiter))
+	add(cfg.OnPVSaveFailure != "", OnPVSaveFailure(cfg.OnPVSaveFailure))
+	add(cfg.UseServerSideApply, UseServerSideApply(true))
+	add(cfg.VolumeStore != nil, WithVolumeStore(cfg.VolumeStore))
+	add(cfg.PVWriteClient != nil, PVWriteClient(cfg.PVWriteClient))
+	add(cfg.ObjectClient != nil, ObjectClient(cfg.ObjectClient))
+	if cfg.VolumeSavePendingWarningAge != nil {
+		options = append(options, VolumeSavePendingWarningAge(*cfg.VolumeSavePendingWarningAge))
+	}
+	add(cfg.VolumeDriftAuditInterval != 0, VolumeDriftAuditInterval(cfg.VolumeDriftAuditInterval))
+	add(cfg.AddFinalizer, AddFinalizer(true))
+	add(cfg.PVFinalizer != "", PVFinalizer(cfg.PVFinalizer))
+	add(cfg.HonorPVReclaimPolicy, HonorPVReclaimPolicy(true))
+	add(cfg.ProvisionedByAnnotation != "", ProvisionedByAnnotation(cfg.ProvisionedByAnnotation))
+
+	add(cfg.AdditionalProvisionerNames != nil, AdditionalProvisionerNames(cfg.AdditionalProvisionerNames))
+	add(cfg.AdoptProvisionerNames != nil, AdoptProvisionerNames(cfg.AdoptProvisionerNames))
+	add(cfg.TranslatedInTreePluginName != "", TranslatedInTreePluginName(cfg.TranslatedInTreePluginName))
+	add(cfg.StorageClassAPIFallback, StorageClassAPIFallback(true))
+	add(cfg.AllowLegacyProvisionerName, AllowLegacyProvisionerName(cfg.AllowLegacyProvisionerName))
+	add(cfg.NodeExpansionRequired, NodeExpansionRequired(cfg.NodeExpansionRequired))
+	add(cfg.AvoidUnschedulableNodes, AvoidUnschedulableNodes(true, cfg.AvoidedNodeTaints...))
+	add(cfg.UseStorageCapacityTracking, UseStorageCapacityTracking(true, cfg.StorageCapacityClasses...))
+	add(cfg.ValidateTopologyKeys, ValidateTopologyKeys(true))
+	add(cfg.RequireSelectedNode, RequireSelectedNode(true))
+	add(cfg.ResolveConsumerPod, ResolveConsumerPod(true))
+	add(cfg.ResolveSnapshotDataSource, ResolveSnapshotDataSource(true))
+	add(cfg.ResolveVolumeAttributesClass, ResolveVolumeAttributesClass(true))
+	add(cfg.AllowedFSTypes != nil, AllowedFSTypes(cfg.AllowedFSTypes, cfg.DefaultFSType))
+	add(cfg.SnapshotReadyRetryDelay != 0, SnapshotReadyRetryDelay(cfg.SnapshotReadyRetryDelay))
+	add(cfg.CrossNamespaceDataSources, CrossNamespaceDataSources(true))
+	add(cfg.SupportedDataSources != nil, SupportedDataSources(cfg.SupportedDataSources...))
+	add(cfg.ProvisionForeignDataSources, ProvisionForeignDataSources(true))
+	add(cfg.DynamicClient != nil, DynamicClient(cfg.DynamicClient))
+	add(cfg.RESTMapper != nil, RESTMapper(cfg.RESTMapper))
+	options = append(options, ClientQPS(cfg.ClientQPS))
+	add(cfg.ClientBurst != 0, ClientBurst(cfg.ClientBurst))
+	add(cfg.UserAgent != "", UserAgent(cfg.UserAgent))
+
+	add(cfg.EventRecorder != nil, WithEventRecorder(cfg.EventRecorder))
+	add(cfg.EventComponent != "", EventComponent(cfg.EventComponent))
+	add(cfg.EventAggregationWindow != 0, EventAggregationWindow(cfg.EventAggregationWindow))
+	add(cfg.ClassFailureEventsThreshold != 0 || cfg.ClassFailureEventsWindow != 0,
+		ClassFailureEvents(cfg.ClassFailureEventsThreshold, cfg.ClassFailureEventsWindow))
+	if cfg.SkipLogVerbosity != nil {
+		options = append(options, SkipLogVerbosity(*cfg.SkipLogVerbosity))
+	}
+	add(cfg.ExplainSkips, ExplainSkips(true))
+
+	if cfg.LeaderElection != nil {
+		options = append(options, LeaderElection(*cfg.LeaderElection))
+	}
+	add(cfg.LeaderElectionNamespace != "", LeaderElectionNamespace(cfg.LeaderElectionNamespace))
+	add(cfg.LeaseDuration != 0, LeaseDuration(cfg.LeaseDuration))
+	add(cfg.RenewDeadline != 0, RenewDeadline(cfg.RenewDeadline))
+	add(cfg.RetryPeriod != 0, RetryPeriod(cfg.RetryPeriod))
+	if cfg.ReadyWhenNotLeader != nil {
+		options = append(options, ReadyWhenNotLeader(*cfg.ReadyWhenNotLeader))
+	}
+	if cfg.ReadyWhenPaused != nil {
+		options = append(options, ReadyWhenPaused(*cfg.ReadyWhenPaused))
+	}
+
+	add(cfg.TracerProvider != nil, WithTracerProvider(cfg.TracerProvider))
+	if cfg.MetricsInstance != nil {
+		options = append(options, MetricsInstance(*cfg.MetricsInstance))
+	}
+	if cfg.MetricsSubsystem != nil {
+		options = append(options, MetricsSubsystem(*cfg.MetricsSubsystem))
+	}
+	add(cfg.MetricsPort != 0, MetricsPort(cfg.MetricsPort))
+	add(cfg.MetricsAddress != "", MetricsAddress(cfg.MetricsAddress))
+	add(cfg.MetricsPath != "", MetricsPath(cfg.MetricsPath))
+	if cfg.MetricsServer != nil {
+		options = append(options, MetricsServer(*cfg.MetricsServer))
+	}
+	add(cfg.EnableProfiling, EnableProfiling(true))
+	add(cfg.EnableDebugEndpoints, EnableDebugEndpoints(true))
+	add(cfg.MetricsCertFile != "", MetricsCertFile(cfg.MetricsCertFile))
+	add(cfg.MetricsKeyFile != "", MetricsKeyFile(cfg.MetricsKeyFile))
+	add(cfg.MetricsClientCAFile != "", MetricsClientCAFile(cfg.MetricsClientCAFile))
+	add(cfg.Features != nil, WithFeatures(cfg.Features))
+	return options
+}
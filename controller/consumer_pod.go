@@ -0,0 +1,102 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"sort"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/tools/cache"
+)
+
+// podClaimIndex is the name of the index of pods by the claims they use, as
+// "<namespace>/<claim name>".
+const podClaimIndex = "claim"
+
+// newPodInformer returns an informer of pods indexed by their claims, from
+// factory.
+func newPodInformer(factory informers.SharedInformerFactory) (cache.SharedIndexInformer, error) {
+	informer := factory.Core().V1().Pods().Informer()
+	if _, exists := informer.GetIndexer().GetIndexers()[podClaimIndex]; exists {
+		return informer, nil
+	}
+	err := informer.AddIndexers(cache.Indexers{
+		podClaimIndex: func(obj interface{}) ([]string, error) {
+			pod, ok := obj.(*v1.Pod)
+			if !ok {
+				return nil, nil
+			}
+			return podClaimKeys(pod), nil
+		},
+	})
+	return informer, err
+}
+
+// podClaimKeys returns the keys of claims used by pod, including claims of
+// its generic ephemeral volumes.
+func podClaimKeys(pod *v1.Pod) []string {
+	var keys []string
+	for _, volume := range pod.Spec.Volumes {
+		switch {
+		case volume.PersistentVolumeClaim != nil:
+			keys = append(keys, pod.Namespace+"/"+volume.PersistentVolumeClaim.ClaimName)
+		case volume.Ephemeral != nil:
+			keys = append(keys, pod.Namespace+"/"+pod.Name+"-"+volume.Name)
+		}
+	}
+	return keys
+}
+
+// consumerPod returns the pod using claim for which node was selected, see
+// ResolveConsumerPod, or nil if there is none. Of the pods using the
+// claim, pods bound to node win over pods not bound yet, older pods over
+// newer ones. Pods bound to other nodes, finished or deleted pods are not
+// returned.
+func (ctrl *ProvisionController) consumerPod(claim *v1.PersistentVolumeClaim, node *v1.Node) *v1.Pod {
+	if ctrl.podInformer == nil || node == nil {
+		return nil
+	}
+	objs, err := ctrl.podInformer.GetIndexer().ByIndex(podClaimIndex, claim.Namespace+"/"+claim.Name)
+	if err != nil {
+		return nil
+	}
+	var pods []*v1.Pod
+	for _, obj := range objs {
+		pod, ok := obj.(*v1.Pod)
+		if !ok || pod.DeletionTimestamp != nil || pod.Status.Phase == v1.PodSucceeded || pod.Status.Phase == v1.PodFailed {
+			continue
+		}
+		if pod.Spec.NodeName != "" && pod.Spec.NodeName != node.Name {
+			continue
+		}
+		pods = append(pods, pod)
+	}
+	if len(pods) == 0 {
+		return nil
+	}
+	sort.Slice(pods, func(i, j int) bool {
+		if bound := pods[i].Spec.NodeName != ""; bound != (pods[j].Spec.NodeName != "") {
+			return bound
+		}
+		if !pods[i].CreationTimestamp.Equal(&pods[j].CreationTimestamp) {
+			return pods[i].CreationTimestamp.Before(&pods[j].CreationTimestamp)
+		}
+		return pods[i].Name < pods[j].Name
+	})
+	return pods[0]
+}
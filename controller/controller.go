@@ -18,36 +18,52 @@ package controller
 
 import (
 	"context"
+	"crypto/tls"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io/ioutil"
+	"math"
 	"net"
 	"net/http"
 	"os"
+	"regexp"
+	"slices"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
+	"unicode"
 
+	"github.com/go-logr/logr"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"golang.org/x/time/rate"
 	v1 "k8s.io/api/core/v1"
 	storage "k8s.io/api/storage/v1"
 	storagebeta "k8s.io/api/storage/v1beta1"
 	apierrs "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/types"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/sets"
 	"k8s.io/apimachinery/pkg/util/strategicpatch"
 	"k8s.io/apimachinery/pkg/util/uuid"
+	"k8s.io/apimachinery/pkg/util/validation"
 	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/informers"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/kubernetes/scheme"
 	corev1 "k8s.io/client-go/kubernetes/typed/core/v1"
 	corelistersv1 "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/metadata"
 	"k8s.io/client-go/tools/cache"
 	"k8s.io/client-go/tools/leaderelection"
 	"k8s.io/client-go/tools/leaderelection/resourcelock"
@@ -55,65 +71,162 @@ import (
 	ref "k8s.io/client-go/tools/reference"
 	"k8s.io/client-go/util/workqueue"
 	"k8s.io/klog/v2"
+	"k8s.io/utils/clock"
 	"sigs.k8s.io/sig-storage-lib-external-provisioner/v10/controller/metrics"
 	"sigs.k8s.io/sig-storage-lib-external-provisioner/v10/util"
 )
 
-// This annotation is added to a PV that has been dynamically provisioned by
-// Kubernetes. Its value is name of volume plugin that created the volume.
-// It serves both user (to show where a PV comes from) and Kubernetes (to
-// recognize dynamically provisioned PVs in its decisions).
-const annDynamicallyProvisioned = "pv.kubernetes.io/provisioned-by"
+// AnnDynamicallyProvisioned is added to a PV that has been dynamically
+// provisioned by Kubernetes. Its value is name of volume plugin that created
+// the volume. It serves both user (to show where a PV comes from) and
+// Kubernetes (to recognize dynamically provisioned PVs in its decisions).
+// The controller can set a different key next to it, see
+// ProvisionedByAnnotation.
+const AnnDynamicallyProvisioned = "pv.kubernetes.io/provisioned-by"
 
 // AnnMigratedTo annotation is added to a PVC that is supposed to be
 // dynamically provisioned/deleted by by its corresponding CSI driver
 // through the CSIMigration feature flags. It allows external provisioners
 // to determine which PVs are considered migrated and safe to operate on for
 // Deletion.
-const annMigratedTo = "pv.kubernetes.io/migrated-to"
+const AnnMigratedTo = "pv.kubernetes.io/migrated-to"
 
-const annBetaStorageProvisioner = "volume.beta.kubernetes.io/storage-provisioner"
-const annStorageProvisioner = "volume.kubernetes.io/storage-provisioner"
+// AnnStorageProvisioner and AnnBetaStorageProvisioner are set on a PVC by
+// Kubernetes to the provisioner that is expected to provision it. The
+// controller reads them with util.GetPersistentVolumeClaimProvisioner and
+// never writes them.
+const (
+	AnnBetaStorageProvisioner = util.AnnBetaStorageProvisioner
+	AnnStorageProvisioner     = util.AnnStorageProvisioner
+)
 
-// This annotation is added to a PVC that has been triggered by scheduler to
+// AnnSelectedNode is added to a PVC that has been triggered by scheduler to
 // be dynamically provisioned. Its value is the name of the selected node.
-const annSelectedNode = "volume.kubernetes.io/selected-node"
+// The controller removes it when provisioning on the node failed and the
+// claim has to be rescheduled.
+const AnnSelectedNode = "volume.kubernetes.io/selected-node"
 
-// This annotation is present on K8s 1.11 release.
-const annAlphaSelectedNode = "volume.alpha.kubernetes.io/selected-node"
+// AnnAlphaSelectedNode is present on K8s 1.11 release.
+const AnnAlphaSelectedNode = "volume.alpha.kubernetes.io/selected-node"
 
 // Finalizer for PVs so we know to clean them up
 const finalizerPV = "external-provisioner.volume.kubernetes.io/finalizer"
 
 const uidIndex = "uid"
 
+// claimVolumeIndex indexes claims by their volume name, only with
+// VolumeMetadataClient.
+const claimVolumeIndex = "volumeName"
+
+const (
+	// ClaimClassIndex is the name of the index of claims by the name of their
+	// StorageClass, see ClaimsByClass.
+	ClaimClassIndex = "class"
+	// ClaimSelectedNodeIndex is the name of the index of claims by their
+	// selected node, see ClaimsBySelectedNode.
+	ClaimSelectedNodeIndex = "selectedNode"
+)
+
 // ControllerSubsystem is prometheus subsystem name.
 const controllerSubsystem = "controller"
 
+// metricsSubsystemRegexp matches subsystems that form valid prometheus metric
+// names. Colons are allowed by prometheus, but reserved for recording rules.
+var metricsSubsystemRegexp = regexp.MustCompile(`^([a-zA-Z_][a-zA-Z0-9_]*)?$`)
+
 var (
 	errStopProvision = errors.New("stop provisioning")
+	// errWaitingForReschedule stops provisioning like errStopProvision,
+	// but it is not a provisioning failure: the selected node was removed
+	// and the claim waits for the scheduler to select another node.
+	errWaitingForReschedule = errors.New("waiting for reschedule")
+)
+
+// Reasons for removing the selected node annotation from a claim, used as
+// label of the claim reschedule metric.
+const (
+	// rescheduleReasonNodeNotFound means the selected node does not exist.
+	rescheduleReasonNodeNotFound = "node_not_found"
+	// rescheduleReasonProvisionFailed means Provision failed with
+	// ProvisioningReschedule.
+	rescheduleReasonProvisionFailed = "provision_failed"
+	// rescheduleReasonProvisionerRequested means Provision returned
+	// ProvisioningReschedule without an error.
+	rescheduleReasonProvisionerRequested = "provisioner_requested"
+	// rescheduleReasonTopologyMismatch means the selected node does not
+	// match AllowedTopologies of the StorageClass.
+	rescheduleReasonTopologyMismatch = "topology_mismatch"
+	// rescheduleReasonNodeTerminating means the selected node is being
+	// deleted.
+	rescheduleReasonNodeTerminating = "node_terminating"
+	// rescheduleReasonNodeUnschedulable means the selected node is cordoned
+	// or tainted, see AvoidUnschedulableNodes.
+	rescheduleReasonNodeUnschedulable = "node_unschedulable"
+	// rescheduleReasonNoCapacity means CapacityChecker reported that the
+	// selected node does not have enough capacity.
+	rescheduleReasonNoCapacity = "no_capacity"
 )
 
 // ProvisionController is a controller that provisions PersistentVolumes for
 // PersistentVolumeClaims.
 type ProvisionController struct {
+	// Client of leader election and events.
 	client kubernetes.Interface
+	// Client of claims, PVs, StorageClasses and everything else the
+	// controller watches or changes, see ObjectClient. It is client unless
+	// the option is set.
+	objectClient kubernetes.Interface
+	// Client that creates, patches and deletes PVs, see PVWriteClient. It is
+	// objectClient unless the option is set.
+	pvWriteClient kubernetes.Interface
 
 	// The name of the provisioner for which this controller dynamically
-	// provisions volumes. The value of annDynamicallyProvisioned and
-	// annStorageProvisioner to set & watch for, respectively
+	// provisions volumes. The value of AnnDynamicallyProvisioned and
+	// AnnStorageProvisioner to set & watch for, respectively
 	provisionerName string
 
 	// additional provisioner names (beyond provisionerName) that the
-	// provisioner should watch for and handle in annStorageProvisioner
+	// provisioner should watch for and handle in AnnStorageProvisioner
 	additionalProvisionerNames []string
 
+	// previous names of the provisioner, see AdoptProvisionerNames
+	adoptedProvisionerNames []string
+
+	// in-tree plugin or CSI driver name that CSI migration translates the
+	// provisioner name from or to, see TranslatedInTreePluginName
+	translatedPluginName string
+
+	// Whether provisionerName is not checked by ValidateProvisionerName, see
+	// AllowLegacyProvisionerName.
+	legacyProvisionerName bool
+
+	// Whether expanded volumes need a file system resize on the node, see
+	// NodeExpansionRequired.
+	nodeExpansionRequired bool
+
+	// Clock of all time measurements and timers, see WithClock.
+	clock clock.Clock
+
+	// How long the node of a volume must be missing before the volume is
+	// deleted with NodeDeleter, see MissingNodeGracePeriod. Map node name ->
+	// time when the node was first found missing.
+	missingNodeGracePeriod time.Duration
+	missingNodes           sync.Map
+
+	// Key of the annotation with the provisioner name set on provisioned
+	// PVs, AnnDynamicallyProvisioned is accepted too.
+	provisionedByAnnotation string
+
 	// The provisioner the controller will use to provision and delete volumes.
 	// Presumably this implementer of Provisioner carries its own
 	// volume-specific options and such that it needs in order to provision
 	// volumes.
 	provisioner Provisioner
 
+	// The logger passed to NewProvisionController. Run uses it when its
+	// context does not carry a logger.
+	logger klog.Logger
+
 	claimInformer  cache.SharedIndexInformer
 	claimsIndexer  cache.Indexer
 	volumeInformer cache.SharedInformer
@@ -121,9 +234,43 @@ type ProvisionController struct {
 	classInformer  cache.SharedInformer
 	nodeLister     corelistersv1.NodeLister
 	classes        cache.Store
+	// Whether to run without class cache when the StorageClass API does
+	// not exist and whether it does now, see StorageClassAPIFallback.
+	classAPIFallback      bool
+	classAPICheckInterval time.Duration
+	classesUnavailable    atomic.Bool
+	// Informer of CSIStorageCapacity objects, nil unless
+	// UseStorageCapacityTracking is set.
+	capacityInformer cache.SharedIndexInformer
+	// Informer of pods, nil unless ResolveConsumerPod is set.
+	podInformer cache.SharedIndexInformer
 
 	// To determine if the informer is internal or external
 	customClaimInformer, customVolumeInformer, customClassInformer bool
+	customCapacityInformer, customPodInformer                      bool
+	// External factory of informers not set individually, may be nil.
+	informerFactory informers.SharedInformerFactory
+	// Label selector of the internal PV informer, nil for all PVs.
+	volumeSelector labels.Selector
+
+	// Client of the PV metadata informer, nil for the full PV informer.
+	volumeMetadataClient metadata.Interface
+
+	// Provision-only and delete-only modes, the informer and the workqueue
+	// of the disabled operation are not created.
+	deletionDisabled, provisioningDisabled bool
+
+	// Annotations of cached PVCs and PVs longer than this are dropped, except
+	// keptAnnotations. Zero keeps all annotations.
+	cachedAnnotationSizeLimit int
+	keptAnnotations           sets.Set[string]
+
+	// nodeLock guards the lazily created node informer.
+	nodeLock sync.Mutex
+	// Factory of the node informer created by Nodes, nil if not created (yet).
+	nodeInformerFactory informers.SharedInformerFactory
+	// Stop channel of the node informer, nil until the controller runs.
+	nodeStopCh <-chan struct{}
 
 	claimQueue  workqueue.RateLimitingInterface
 	volumeQueue workqueue.RateLimitingInterface
@@ -135,35 +282,134 @@ type ProvisionController struct {
 	id            string
 	component     string
 	eventRecorder record.EventRecorder
+	// Whether eventRecorder was injected with WithEventRecorder.
+	customEventRecorder bool
+	// Source component of events created by the default eventRecorder or
+	// by an injected ComponentEventRecorder.
+	eventComponent string
+	// Whether eventComponent was set with EventComponent.
+	customEventComponent bool
+
+	// Events of the same object with the same reason are counted on a single
+	// Event object within this window.
+	eventAggregationWindow time.Duration
 
 	resyncPeriod     time.Duration
 	provisionTimeout time.Duration
 	deletionTimeout  time.Duration
+	cacheSyncTimeout time.Duration
+
+	// Resync periods of individual informers, resyncPeriod is used when nil.
+	claimResyncPeriod, volumeResyncPeriod, classResyncPeriod *time.Duration
 
 	rateLimiter               workqueue.RateLimiter
+	claimRateLimiter          workqueue.RateLimiter
+	volumeRateLimiter         workqueue.RateLimiter
 	exponentialBackOffOnError bool
-	threadiness               int
+	provisionThreadiness      int
+	deletionThreadiness       int
+
+	// Limit of Provision and Delete calls in progress, nil when unlimited.
+	maxInFlightOperations int
+	inFlight              *inFlightLimiter
+	inFlightRetryDelay    time.Duration
+	// Limit of Provision calls per selected node, nil when unlimited.
+	perNodeConcurrency int
+	nodeInFlight       *nodeInFlightLimiter
+
+	// Smoothing of the start, see InitialSyncBurstLimit and StartupJitter.
+	initialSyncBurstLimit float64
+	initialSync           *initialSyncLimiter
+	startupJitter         time.Duration
+
+	// Graceful shutdown, see ShutdownGracePeriod. operations holds names of
+	// provisionings and deletions in progress.
+	shutdownGracePeriod time.Duration
+	operations          sync.Map
+
+	claimFairnessThreshold int
+
+	// Rate limiters the queues were created with.
+	claimQueueLimiter, volumeQueueLimiter workqueue.RateLimiter
 
 	createProvisionedPVBackoff    *wait.Backoff
 	createProvisionedPVRetryCount int
 	createProvisionedPVInterval   time.Duration
 	createProvisionerPVLimiter    workqueue.RateLimiter
+	pendingSaveWarningAge         time.Duration
+	pvSaveFailurePolicy           PVSaveFailurePolicy
+
+	// How often PVs are checked for drift, see VolumeDriftAuditInterval.
+	// driftReported maps PV name -> content hash of its last drift event.
+	driftAuditInterval time.Duration
+	driftReported      sync.Map
 
 	failedProvisionThreshold, failedDeleteThreshold int
+	// Annotations of claims the controller gave up provisioning.
+	annProvisionFailures, annLastError string
+
+	// Retry state of claims in annotations, see PersistRetryState.
+	// retryStateChecked holds claims whose annotations were checked.
+	persistRetryState                    bool
+	annProvisionAttempts, annLastAttempt string
+	retryStateChecked                    sync.Map
+
+	// Reschedule claims from unsuitable nodes, see AvoidUnschedulableNodes.
+	avoidUnschedulableNodes bool
+	avoidedNodeTaints       []v1.Taint
+
+	// Capacity checks of StorageClasses, see UseStorageCapacityTracking.
+	storageCapacityTracking   bool
+	capacityClasses           sets.Set[string]
+	storageCapacityRetryDelay time.Duration
+
+	// Backoff of provision retries, nil for failedProvisionThreshold.
+	provisionRetryBackoff *wait.Backoff
+	claimRetryBackoff     *retryBackoff
+	// Retry policies of individual classes.
+	classOverrides map[string]ClassPolicy
+
+	// The tracer of provisioning and deletion spans, nil when tracing is disabled.
+	tracer trace.Tracer
 
 	// The metrics collection used by this controller.
 	metrics metrics.Metrics
+	// Whether the metrics collection was set by MetricsInstance.
+	customMetrics bool
+	// The prometheus subsystem of metrics created by the controller.
+	metricsSubsystem string
+	// The registry with only the controller's metrics, served by MetricsHandler.
+	metricsRegistry *prometheus.Registry
+	// Collectors of the provisioner, see MetricsProvider.
+	provisionerCollectors []prometheus.Collector
+	// Whether to run the built-in metrics server.
+	metricsServer bool
+	// Whether to serve pprof handlers on the built-in metrics server.
+	enableProfiling bool
+	// Whether to serve debug endpoints, see EnableDebugEndpoints.
+	enableDebugEndpoints bool
 	// The port for metrics server to serve on.
 	metricsPort int32
 	// The IP address for metrics server to serve on.
 	metricsAddress string
 	// The path of metrics endpoint path.
 	metricsPath string
+	// The certificate and key files for serving metrics over TLS.
+	metricsCertFile, metricsKeyFile string
+	// The CA bundle used to verify metrics clients' certificates.
+	metricsClientCAFile string
 
 	// Whether to add a finalizer marking the provisioner as the owner of the PV
 	// with clean up duty.
 	// TODO: upstream and we may have a race b/w applying reclaim policy and not if pv has protection finalizer
 	addFinalizer bool
+	// Key of the finalizer, see PVFinalizer.
+	pvFinalizer string
+	// Whether PVs deleted before their claims are reclaimed, see
+	// HonorPVReclaimPolicy. Map name -> UID of PVs whose storage asset was
+	// deleted but whose finalizer is not removed yet.
+	honorReclaimPolicy bool
+	backendDeleted     sync.Map
 
 	// Whether to do kubernetes leader election at all. It should basically
 	// always be done when possible to avoid duplicate Provision attempts.
@@ -175,10 +421,91 @@ type ProvisionController struct {
 	hasRun     bool
 	hasRunLock *sync.Mutex
 
+	// Whether a controller that is not the leader reports itself as ready.
+	readyWhenNotLeader bool
+	// Whether a paused controller reports itself as ready.
+	readyWhenPaused bool
+	// Runtime state reported by Ready, guarded by stateLock.
+	stateLock      sync.Mutex
+	joinedElection bool
+	leading        bool
+	cachesSynced   bool
+	// State of Pause, guarded by stateLock. unpaused is closed to release
+	// the workers waiting for Resume, it is nil when they do not wait.
+	paused         bool
+	unpaused       chan struct{}
+	workersStopped bool
+	// State of Run, guarded by stateLock. cancelRun cancels the context of
+	// Run while it runs, see Stop. stopped is closed when Run returned.
+	runStarted bool
+	cancelRun  context.CancelFunc
+	stopped    chan struct{}
+	// Goroutines started by Run, it waits for them before it returns.
+	background sync.WaitGroup
+
 	// Map UID -> *PVC with all claims that may be provisioned in the background.
 	claimsInProgress sync.Map
+	// Map UID -> start time of the current provisioning attempt of a claim,
+	// reported by the ProvisioningSucceeded event.
+	provisionStartTimes sync.Map
+
+	// Verbosity of log lines explaining skipped claims.
+	skipLogVerbosity int
+	// Whether to send ProvisioningSkipped events.
+	explainSkips bool
+	// Detector of class-wide provisioning failures, nil when disabled.
+	classFailures *classFailureTracker
+	// Map UID -> skipEvent, the last ProvisioningSkipped event of a claim.
+	skipEvents sync.Map
+	// Whether to pass the pod using a claim to Provision, see
+	// ResolveConsumerPod.
+	resolveConsumerPod bool
+	// Whether to pass the VolumeSnapshot a claim is restored from to
+	// Provision, see ResolveSnapshotDataSource.
+	resolveSnapshots bool
+	dynamicClient    dynamic.Interface
+	// Whether to pass the parameters of the VolumeAttributesClass of a claim
+	// to Provision, see ResolveVolumeAttributesClass.
+	resolveAttributesClass bool
+	// File systems allowed in the fsType parameter of StorageClasses and
+	// the default one, see AllowedFSTypes.
+	allowedFSTypes []string
+	defaultFSType  string
+	// Mapper of data source kinds to resources, see ResolveDataSource.
+	restMapper meta.RESTMapper
+	// Settings of the clients, see ClientQPS, ClientBurst and UserAgent.
+	clientQPS   float32
+	clientBurst int
+	userAgent   string
+	// Delay of retries of claims whose snapshot is not ready and map UID ->
+	// true of claims that got the event about it.
+	snapshotRetryDelay time.Duration
+	snapshotWaits      sync.Map
+	// Whether to allow dataSourceRefs to other namespaces, see
+	// CrossNamespaceDataSources. Map UID -> resourceVersion of claims whose
+	// data source was not granted.
+	crossNamespaceSources bool
+	deniedDataSources     sync.Map
+	// Kinds of data sources supported besides claims and VolumeSnapshots,
+	// see SupportedDataSources and ProvisionForeignDataSources.
+	supportedDataSources    []schema.GroupKind
+	provisionForeignSources bool
+	// Whether to report unknown topology keys of StorageClasses, see
+	// ValidateTopologyKeys. Map class name -> time of the last event.
+	validateTopologyKeys bool
+	topologyKeyEvents    sync.Map
+	// Claims waiting for a selected node, see RequireSelectedNode.
+	requireSelectedNode bool
+	// Map UID -> SkipReason of the last adviseSkip event of a claim.
+	skipAdvised sync.Map
+	// Map UID -> map[string]bool of ProvisioningWarning messages sent to a
+	// claim.
+	provisionWarnings sync.Map
 
 	volumeStore VolumeStore
+	// Whether to save PVs with Apply patches, see UseServerSideApply.
+	serverSideApply bool
+	volumeApplier   volumeApplier
 }
 
 const (
@@ -192,6 +519,14 @@ const (
 	DefaultCreateProvisionedPVRetryCount = 5
 	// DefaultCreateProvisionedPVInterval is used when option function CreateProvisionedPVInterval is omitted
 	DefaultCreateProvisionedPVInterval = 10 * time.Second
+	// DefaultPVSaveFailurePolicy is used when option function OnPVSaveFailure is omitted
+	DefaultPVSaveFailurePolicy = PVSaveFailureDeleteBackendVolume
+	// DefaultUseServerSideApply is used when option function UseServerSideApply is omitted
+	DefaultUseServerSideApply = false
+	// DefaultVolumeSavePendingWarningAge is used when option function VolumeSavePendingWarningAge is omitted
+	DefaultVolumeSavePendingWarningAge = 5 * time.Minute
+	// DefaultVolumeDriftAuditInterval is used when option function VolumeDriftAuditInterval is omitted
+	DefaultVolumeDriftAuditInterval = 0
 	// DefaultFailedProvisionThreshold is used when option function FailedProvisionThreshold is omitted
 	DefaultFailedProvisionThreshold = 15
 	// DefaultFailedDeleteThreshold is used when option function FailedDeleteThreshold is omitted
@@ -210,16 +545,94 @@ const (
 	DefaultMetricsAddress = "0.0.0.0"
 	// DefaultMetricsPath is used when option function MetricsPath is omitted
 	DefaultMetricsPath = "/metrics"
+	// DefaultMetricsServer is used when option function MetricsServer is omitted
+	DefaultMetricsServer = true
+	// DefaultEnableProfiling is used when option function EnableProfiling is omitted
+	DefaultEnableProfiling = false
+	// DefaultEnableDebugEndpoints is used when option function EnableDebugEndpoints is omitted
+	DefaultEnableDebugEndpoints = false
+	// DefaultEventAggregationWindow is used when option function EventAggregationWindow is omitted
+	DefaultEventAggregationWindow = 10 * time.Minute
+	// DefaultSkipLogVerbosity is used when option function SkipLogVerbosity is omitted
+	DefaultSkipLogVerbosity = 4
+	// DefaultExplainSkips is used when option function ExplainSkips is omitted
+	DefaultExplainSkips = false
 	// DefaultAddFinalizer is used when option function AddFinalizer is omitted
 	DefaultAddFinalizer = false
+	// DefaultPVFinalizer is used when option function PVFinalizer is omitted
+	DefaultPVFinalizer = finalizerPV
+	// DefaultHonorPVReclaimPolicy is used when option function HonorPVReclaimPolicy is omitted
+	DefaultHonorPVReclaimPolicy = false
+	// DefaultReadyWhenNotLeader is used when option function ReadyWhenNotLeader is omitted
+	DefaultReadyWhenNotLeader = true
+	// DefaultReadyWhenPaused is used when option function ReadyWhenPaused is omitted
+	DefaultReadyWhenPaused = true
+	// DefaultCacheSyncTimeout is used when option function CacheSyncTimeout is omitted
+	DefaultCacheSyncTimeout = 10 * time.Minute
+	// DefaultDeletionDisabled is used when option function DeletionDisabled is omitted
+	DefaultDeletionDisabled = false
+	// DefaultProvisioningDisabled is used when option function ProvisioningDisabled is omitted
+	DefaultProvisioningDisabled = false
+	// DefaultShutdownGracePeriod is used when option function ShutdownGracePeriod is omitted
+	DefaultShutdownGracePeriod = 20 * time.Second
+	// DefaultClaimQueueFairnessThreshold is used when option function ClaimQueueFairnessThreshold is omitted
+	DefaultClaimQueueFairnessThreshold = 100
+	// DefaultPersistRetryState is used when option function PersistRetryState is omitted
+	DefaultPersistRetryState = false
+	// DefaultAvoidUnschedulableNodes is used when option function AvoidUnschedulableNodes is omitted
+	DefaultAvoidUnschedulableNodes = false
+	// DefaultUseStorageCapacityTracking is used when option function UseStorageCapacityTracking is omitted
+	DefaultUseStorageCapacityTracking = false
+	// DefaultRequireSelectedNode is used when option function RequireSelectedNode is omitted
+	DefaultRequireSelectedNode = false
+	// DefaultValidateTopologyKeys is used when option function ValidateTopologyKeys is omitted
+	DefaultValidateTopologyKeys = false
+	// DefaultResolveConsumerPod is used when option function ResolveConsumerPod is omitted
+	DefaultResolveConsumerPod = false
+	// DefaultResolveSnapshotDataSource is used when option function ResolveSnapshotDataSource is omitted
+	DefaultResolveSnapshotDataSource = false
+	// DefaultResolveVolumeAttributesClass is used when option function ResolveVolumeAttributesClass is omitted
+	DefaultResolveVolumeAttributesClass = false
+	// DefaultSnapshotReadyRetryDelay is used when option function SnapshotReadyRetryDelay is omitted
+	DefaultSnapshotReadyRetryDelay = 15 * time.Second
+	// DefaultCrossNamespaceDataSources is used when option function CrossNamespaceDataSources is omitted
+	DefaultCrossNamespaceDataSources = false
+	// DefaultProvisionForeignDataSources is used when option function ProvisionForeignDataSources is omitted
+	DefaultProvisionForeignDataSources = false
+	// DefaultProvisionedByAnnotation is used when option function ProvisionedByAnnotation is omitted
+	DefaultProvisionedByAnnotation = AnnDynamicallyProvisioned
+	// DefaultClientQPS is used when option function ClientQPS is omitted
+	DefaultClientQPS = 0
+	// DefaultClientBurst is used when option function ClientBurst is omitted
+	DefaultClientBurst = 0
+	// DefaultUserAgent is used when option function UserAgent is omitted
+	DefaultUserAgent = ""
+	// DefaultAllowLegacyProvisionerName is used when option function AllowLegacyProvisionerName is omitted
+	DefaultAllowLegacyProvisionerName = false
+	// DefaultTranslatedInTreePluginName is used when option function TranslatedInTreePluginName is omitted
+	DefaultTranslatedInTreePluginName = ""
+	// DefaultNodeExpansionRequired is used when option function NodeExpansionRequired is omitted
+	DefaultNodeExpansionRequired = false
+	// DefaultMissingNodeGracePeriod is used when option function MissingNodeGracePeriod is omitted
+	DefaultMissingNodeGracePeriod = 10 * time.Minute
+	// DefaultStorageClassAPIFallback is used when option function StorageClassAPIFallback is omitted
+	DefaultStorageClassAPIFallback = false
 )
 
 var errRuntime = fmt.Errorf("cannot call option functions after controller has Run")
 
+var errRunTwice = fmt.Errorf("controller has already been Run, it can be Run only once")
+
+// LibraryVersion is the version of this library reported by the build info
+// metric. Binaries can set it at build time, e.g. with
+// -ldflags "-X sigs.k8s.io/sig-storage-lib-external-provisioner/v10/controller.LibraryVersion=v10.0.0".
+var LibraryVersion = "unknown"
+
 // ResyncPeriod is how often the controller relists PVCs, PVs, & storage
 // classes. OnUpdate will be called even if nothing has changed, meaning failed
 // operations may be retried on a PVC/PV every resyncPeriod regardless of
-// whether it changed. Defaults to 15 minutes.
+// whether it changed. Defaults to 15 minutes. ClaimResyncPeriod,
+// VolumeResyncPeriod and ClassResyncPeriod override it for single informers.
 func ResyncPeriod(resyncPeriod time.Duration) func(*ProvisionController) error {
 	return func(c *ProvisionController) error {
 		if c.HasRun() {
@@ -230,14 +643,164 @@ func ResyncPeriod(resyncPeriod time.Duration) func(*ProvisionController) error {
 	}
 }
 
-// Threadiness is the number of claim and volume workers each to launch.
+// ClaimResyncPeriod is how often the controller relists PVCs, overriding
+// ResyncPeriod. Zero disables resync of PVCs.
+func ClaimResyncPeriod(resyncPeriod time.Duration) func(*ProvisionController) error {
+	return func(c *ProvisionController) error {
+		if c.HasRun() {
+			return errRuntime
+		}
+		if resyncPeriod < 0 {
+			return fmt.Errorf("invalid ClaimResyncPeriod %v: must not be negative", resyncPeriod)
+		}
+		c.claimResyncPeriod = &resyncPeriod
+		return nil
+	}
+}
+
+// VolumeResyncPeriod is how often the controller relists PVs, overriding
+// ResyncPeriod. Zero disables resync of PVs.
+func VolumeResyncPeriod(resyncPeriod time.Duration) func(*ProvisionController) error {
+	return func(c *ProvisionController) error {
+		if c.HasRun() {
+			return errRuntime
+		}
+		if resyncPeriod < 0 {
+			return fmt.Errorf("invalid VolumeResyncPeriod %v: must not be negative", resyncPeriod)
+		}
+		c.volumeResyncPeriod = &resyncPeriod
+		return nil
+	}
+}
+
+// ClassResyncPeriod is how often the controller relists storage classes,
+// overriding ResyncPeriod. Zero disables resync of storage classes.
+func ClassResyncPeriod(resyncPeriod time.Duration) func(*ProvisionController) error {
+	return func(c *ProvisionController) error {
+		if c.HasRun() {
+			return errRuntime
+		}
+		if resyncPeriod < 0 {
+			return fmt.Errorf("invalid ClassResyncPeriod %v: must not be negative", resyncPeriod)
+		}
+		c.classResyncPeriod = &resyncPeriod
+		return nil
+	}
+}
+
+// VolumeMetadataClient makes the internal PersistentVolume informer watch
+// and cache only the metadata of PVs, which saves the memory of PV specs on
+// large clusters. Phase, reclaim policy and the CSI driver of statically
+// provisioned PVs are not part of the metadata, so the controller fetches the
+// full PV from API server when it may have to delete it or change its
+// finalizer. It decides from the metadata and the claim informer first: PVs
+// whose provisioned-by annotation names another provisioner, PVs under
+// deletion without the finalizer of the controller and PVs used by a Bound
+// claim are not fetched. Can't be combined with VolumesInformer or
+// DeletionDisabled.
+// Defaults to the full PV informer.
+func VolumeMetadataClient(client metadata.Interface) func(*ProvisionController) error {
+	return func(c *ProvisionController) error {
+		if c.HasRun() {
+			return errRuntime
+		}
+		c.volumeMetadataClient = client
+		return nil
+	}
+}
+
+// DeletionDisabled runs the controller in provision-only mode, e.g. when
+// another controller deletes the volumes. PVs are not watched nor cached and
+// Delete of the provisioner is never called. Can't be combined with
+// ProvisioningDisabled or VolumesInformer.
+// Defaults to false.
+func DeletionDisabled(disabled bool) func(*ProvisionController) error {
+	return func(c *ProvisionController) error {
+		if c.HasRun() {
+			return errRuntime
+		}
+		c.deletionDisabled = disabled
+		return nil
+	}
+}
+
+// ProvisioningDisabled runs the controller in delete-only mode, e.g. as
+// a central controller that deletes volumes provisioned by provision-only
+// controllers. PVCs are not watched nor cached and Provision of the
+// provisioner is never called. Can't be combined with DeletionDisabled or
+// ClaimsInformer.
+// Defaults to false.
+func ProvisioningDisabled(disabled bool) func(*ProvisionController) error {
+	return func(c *ProvisionController) error {
+		if c.HasRun() {
+			return errRuntime
+		}
+		c.provisioningDisabled = disabled
+		return nil
+	}
+}
+
+// CacheSyncTimeout is how long Run waits for an informer cache to sync,
+// typically only a missing RBAC permission to list or watch a resource
+// prevents it. The controller exits with an error naming the informers that
+// haven't synced. Each informer that syncs restarts the timeout. Zero waits
+// forever. Defaults to 10 minutes.
+func CacheSyncTimeout(timeout time.Duration) func(*ProvisionController) error {
+	return func(c *ProvisionController) error {
+		if c.HasRun() {
+			return errRuntime
+		}
+		if timeout < 0 {
+			return fmt.Errorf("invalid CacheSyncTimeout %v: must not be negative", timeout)
+		}
+		c.cacheSyncTimeout = timeout
+		return nil
+	}
+}
+
+// Threadiness is the number of claim and volume workers each to launch,
+// i.e. it sets both ProvisionThreadiness and DeletionThreadiness.
 // Defaults to 4.
 func Threadiness(threadiness int) func(*ProvisionController) error {
 	return func(c *ProvisionController) error {
 		if c.HasRun() {
 			return errRuntime
 		}
-		c.threadiness = threadiness
+		if threadiness <= 0 {
+			return fmt.Errorf("invalid Threadiness %d: must be positive", threadiness)
+		}
+		c.provisionThreadiness = threadiness
+		c.deletionThreadiness = threadiness
+		return nil
+	}
+}
+
+// ProvisionThreadiness is the number of claim workers to launch, i.e. the
+// number of claims provisioned in parallel. Defaults to Threadiness.
+func ProvisionThreadiness(threadiness int) func(*ProvisionController) error {
+	return func(c *ProvisionController) error {
+		if c.HasRun() {
+			return errRuntime
+		}
+		if threadiness <= 0 {
+			return fmt.Errorf("invalid ProvisionThreadiness %d: must be positive", threadiness)
+		}
+		c.provisionThreadiness = threadiness
+		return nil
+	}
+}
+
+// DeletionThreadiness is the number of volume workers to launch, i.e. the
+// number of volumes deleted in parallel. Defaults to Threadiness.
+func DeletionThreadiness(threadiness int) func(*ProvisionController) error {
+	return func(c *ProvisionController) error {
+		if c.HasRun() {
+			return errRuntime
+		}
+		if threadiness <= 0 {
+			return fmt.Errorf("invalid DeletionThreadiness %d: must be positive", threadiness)
+		}
+		c.deletionThreadiness = threadiness
 		return nil
 	}
 }
@@ -254,6 +817,39 @@ func RateLimiter(rateLimiter workqueue.RateLimiter) func(*ProvisionController) e
 	}
 }
 
+// ClaimQueueRateLimiter is the workqueue.RateLimiter to use for the
+// provisioning work queue. It takes precedence over RateLimiter and
+// ExponentialBackOffOnError for that queue.
+//
+// The limiter only controls spacing of retries of a failed claim, while
+// FailedProvisionThreshold limits their number. The threshold is compared
+// with NumRequeues of the limiter, so a limiter must count the failures
+// reported by When and reset them on Forget for the threshold to work.
+func ClaimQueueRateLimiter(rateLimiter workqueue.RateLimiter) func(*ProvisionController) error {
+	return func(c *ProvisionController) error {
+		if c.HasRun() {
+			return errRuntime
+		}
+		c.claimRateLimiter = rateLimiter
+		return nil
+	}
+}
+
+// VolumeQueueRateLimiter is the workqueue.RateLimiter to use for the
+// deleting work queue. It takes precedence over RateLimiter and
+// ExponentialBackOffOnError for that queue. It interacts with
+// FailedDeleteThreshold the same way as ClaimQueueRateLimiter with
+// FailedProvisionThreshold.
+func VolumeQueueRateLimiter(rateLimiter workqueue.RateLimiter) func(*ProvisionController) error {
+	return func(c *ProvisionController) error {
+		if c.HasRun() {
+			return errRuntime
+		}
+		c.volumeRateLimiter = rateLimiter
+		return nil
+	}
+}
+
 // ExponentialBackOffOnError determines whether to exponentially back off from
 // failures of Provision and Delete. Defaults to true.
 func ExponentialBackOffOnError(exponentialBackOffOnError bool) func(*ProvisionController) error {
@@ -268,7 +864,8 @@ func ExponentialBackOffOnError(exponentialBackOffOnError bool) func(*ProvisionCo
 
 // CreateProvisionedPVRetryCount is the number of retries when we create a PV
 // object for a provisioned volume. Defaults to 5.
-// If PV is not saved after given number of retries, corresponding storage asset (volume) is deleted!
+// If PV is not saved after given number of retries, corresponding storage asset (volume) is deleted,
+// unless OnPVSaveFailure says otherwise!
 // Only one of CreateProvisionedPVInterval+CreateProvisionedPVRetryCount or CreateProvisionedPVBackoff or
 // CreateProvisionedPVLimiter can be used.
 // Deprecated: Use CreateProvisionedPVLimiter instead, it tries indefinitely.
@@ -281,7 +878,10 @@ func CreateProvisionedPVRetryCount(createProvisionedPVRetryCount int) func(*Prov
 			return fmt.Errorf("CreateProvisionedPVBackoff cannot be used together with CreateProvisionedPVRetryCount")
 		}
 		if c.createProvisionerPVLimiter != nil {
-			return fmt.Errorf("CreateProvisionedPVBackoff cannot be used together with CreateProvisionedPVLimiter")
+			return fmt.Errorf("CreateProvisionedPVRetryCount cannot be used together with CreateProvisionedPVLimiter")
+		}
+		if createProvisionedPVRetryCount < 0 {
+			return fmt.Errorf("invalid CreateProvisionedPVRetryCount %d: must not be negative", createProvisionedPVRetryCount)
 		}
 		c.createProvisionedPVRetryCount = createProvisionedPVRetryCount
 		return nil
@@ -290,7 +890,8 @@ func CreateProvisionedPVRetryCount(createProvisionedPVRetryCount int) func(*Prov
 
 // CreateProvisionedPVInterval is the interval between retries when we create a
 // PV object for a provisioned volume. Defaults to 10 seconds.
-// If PV is not saved after given number of retries, corresponding storage asset (volume) is deleted!
+// If PV is not saved after given number of retries, corresponding storage asset (volume) is deleted,
+// unless OnPVSaveFailure says otherwise!
 // Only one of CreateProvisionedPVInterval+CreateProvisionedPVRetryCount or CreateProvisionedPVBackoff or
 // CreateProvisionedPVLimiter can be used.
 // Deprecated: Use CreateProvisionedPVLimiter instead, it tries indefinitely.
@@ -305,6 +906,9 @@ func CreateProvisionedPVInterval(createProvisionedPVInterval time.Duration) func
 		if c.createProvisionerPVLimiter != nil {
 			return fmt.Errorf("CreateProvisionedPVInterval cannot be used together with CreateProvisionedPVLimiter")
 		}
+		if createProvisionedPVInterval < 0 {
+			return fmt.Errorf("invalid CreateProvisionedPVInterval %v: must not be negative", createProvisionedPVInterval)
+		}
 		c.createProvisionedPVInterval = createProvisionedPVInterval
 		return nil
 	}
@@ -312,7 +916,8 @@ func CreateProvisionedPVInterval(createProvisionedPVInterval time.Duration) func
 
 // CreateProvisionedPVBackoff is the configuration of exponential backoff between retries when we create a
 // PV object for a provisioned volume. Defaults to linear backoff, 10 seconds 5 times.
-// If PV is not saved after given number of retries, corresponding storage asset (volume) is deleted!
+// If PV is not saved after given number of retries, corresponding storage asset (volume) is deleted,
+// unless OnPVSaveFailure says otherwise!
 // Only one of CreateProvisionedPVInterval+CreateProvisionedPVRetryCount or CreateProvisionedPVBackoff or
 // CreateProvisionedPVLimiter can be used.
 // Deprecated: Use CreateProvisionedPVLimiter instead, it tries indefinitely.
@@ -330,6 +935,9 @@ func CreateProvisionedPVBackoff(backoff wait.Backoff) func(*ProvisionController)
 		if c.createProvisionerPVLimiter != nil {
 			return fmt.Errorf("CreateProvisionedPVBackoff cannot be used together with CreateProvisionedPVLimiter")
 		}
+		if backoff.Steps < 1 {
+			return fmt.Errorf("invalid CreateProvisionedPVBackoff steps %d: must be at least 1", backoff.Steps)
+		}
 		c.createProvisionedPVBackoff = &backoff
 		return nil
 	}
@@ -361,305 +969,1809 @@ func CreateProvisionedPVLimiter(limiter workqueue.RateLimiter) func(*ProvisionCo
 	}
 }
 
-// FailedProvisionThreshold is the threshold for max number of retries on
-// failures of Provision. Set to 0 to retry indefinitely. Defaults to 15.
-func FailedProvisionThreshold(failedProvisionThreshold int) func(*ProvisionController) error {
+// OnPVSaveFailure sets what happens to the storage asset of a provisioned
+// volume whose PV could not be saved after all retries of
+// CreateProvisionedPVBackoff or CreateProvisionedPVInterval and
+// CreateProvisionedPVRetryCount. Either way the claim gets a Warning event
+// and the attempt counts as a provisioning failure, the claim is provisioned
+// again later. With PVSaveFailureRetain, a provisioner that provisions
+// idempotently by PVName answers that with the kept volume.
+// This option cannot be used with CreateProvisionedPVLimiter, which retries
+// indefinitely. Defaults to PVSaveFailureDeleteBackendVolume.
+func OnPVSaveFailure(policy PVSaveFailurePolicy) func(*ProvisionController) error {
 	return func(c *ProvisionController) error {
 		if c.HasRun() {
 			return errRuntime
 		}
-		c.failedProvisionThreshold = failedProvisionThreshold
+		if policy != PVSaveFailureDeleteBackendVolume && policy != PVSaveFailureRetain {
+			return fmt.Errorf("invalid OnPVSaveFailure %q: must be %q or %q", policy, PVSaveFailureDeleteBackendVolume, PVSaveFailureRetain)
+		}
+		c.pvSaveFailurePolicy = policy
 		return nil
 	}
 }
 
-// FailedDeleteThreshold is the threshold for max number of retries on failures
-// of Delete. Set to 0 to retry indefinitely. Defaults to 15.
-func FailedDeleteThreshold(failedDeleteThreshold int) func(*ProvisionController) error {
+// UseServerSideApply, if true, saves provisioned PVs and later changes of
+// their finalizer with Apply patches of field manager
+// "<provisionerName>-provisioner" instead of creating and patching them, so
+// that fields added by others, e.g. by a mutating webhook, are not
+// overwritten from stale cached copies. A PV that exists already is not
+// applied but compared with the provisioned one, like when a create fails.
+// Conflicts on the finalizer are resolved with force, only for fields the
+// controller owns already. It does not apply to stores set by
+// WithVolumeStore. The provisioner needs permissions to get and patch
+// persistentvolumes. Defaults to false.
+func UseServerSideApply(enabled bool) func(*ProvisionController) error {
 	return func(c *ProvisionController) error {
 		if c.HasRun() {
 			return errRuntime
 		}
-		c.failedDeleteThreshold = failedDeleteThreshold
+		c.serverSideApply = enabled
 		return nil
 	}
 }
 
-// LeaderElection determines whether to enable leader election or not. Defaults
-// to true.
-func LeaderElection(leaderElection bool) func(*ProvisionController) error {
+// WithVolumeStore sets the VolumeStore that saves provisioned PVs to API
+// server, e.g. through another client, instead of the store configured by
+// the CreateProvisionedPV* options. When the store implements
+// VolumeStoreWithHooks, the controller gives it VolumeStoreHooks to send
+// events and report metrics like the built-in stores do.
+// This option cannot be used with any of the CreateProvisionedPV* options.
+func WithVolumeStore(store VolumeStore) func(*ProvisionController) error {
 	return func(c *ProvisionController) error {
 		if c.HasRun() {
 			return errRuntime
 		}
-		c.leaderElection = leaderElection
+		c.volumeStore = store
 		return nil
 	}
 }
 
-// LeaderElectionNamespace is the kubernetes namespace in which to create the
-// leader election object. Defaults to the same namespace in which the
-// the controller runs.
-func LeaderElectionNamespace(leaderElectionNamespace string) func(*ProvisionController) error {
+// WithClock sets the clock the controller measures time and waits with:
+// backoffs and retry delays of its queues and volume stores, grace periods,
+// intervals of periodic checks and durations reported in events and metrics,
+// e.g. to test them with a fake clock from k8s.io/utils/clock/testing. The
+// work queues use the real clock when clk does not implement
+// clock.WithTicker. Timeouts of API calls and of contexts passed to the
+// provisioner are not affected.
+// Defaults to clock.RealClock.
+func WithClock(clk clock.Clock) func(*ProvisionController) error {
 	return func(c *ProvisionController) error {
 		if c.HasRun() {
 			return errRuntime
 		}
-		c.leaderElectionNamespace = leaderElectionNamespace
+		if clk == nil {
+			return fmt.Errorf("invalid clock: must not be nil")
+		}
+		c.clock = clk
 		return nil
 	}
 }
 
-// LeaseDuration is the duration that non-leader candidates will
-// wait to force acquire leadership. This is measured against time of
-// last observed ack. Defaults to 15 seconds.
-func LeaseDuration(leaseDuration time.Duration) func(*ProvisionController) error {
+// PVWriteClient sets the client that creates, patches (e.g. finalizers) and
+// deletes PVs, while the object client, see ObjectClient, does everything else
+// with the objects: informers, Get of PVs and claim updates. Rate limits of a
+// client apply to all of its calls, so during mass provisioning PV creates can
+// starve lease renewals and the controller loses leadership. A separate client,
+// i.e. created from its own rest.Config with its own QPS and Burst, avoids
+// that. The recommended split is to keep the default QPS and Burst for the main
+// client and to give the PV write client the budget for the expected
+// provisioning rate. A custom VolumeStore set by WithVolumeStore does not use
+// this client. Defaults to the object client.
+func PVWriteClient(client kubernetes.Interface) func(*ProvisionController) error {
 	return func(c *ProvisionController) error {
 		if c.HasRun() {
 			return errRuntime
 		}
-		c.leaseDuration = leaseDuration
+		if client == nil {
+			return fmt.Errorf("invalid PV write client: must not be nil")
+		}
+		c.pvWriteClient = client
 		return nil
 	}
 }
 
-// RenewDeadline is the duration that the acting master will retry
-// refreshing leadership before giving up. Defaults to 10 seconds.
-func RenewDeadline(renewDeadline time.Duration) func(*ProvisionController) error {
+// ObjectClient sets the client that watches and changes the objects: claims,
+// PVs, StorageClasses, nodes, pods and CSIStorageCapacities, while the client
+// passed to NewProvisionController is used only for leader election and
+// events. It allows the controller to run in one cluster, e.g. a management
+// cluster of a hosted control plane, and to provision PVs in another one.
+// Leases and events stay in the cluster of the controller, the events refer
+// to objects of the other cluster. Clients set by PVWriteClient,
+// VolumeMetadataClient and DynamicClient and the factory of InformerFactory
+// must be of the same cluster as this client.
+// Defaults to the client passed to NewProvisionController.
+func ObjectClient(client kubernetes.Interface) func(*ProvisionController) error {
 	return func(c *ProvisionController) error {
 		if c.HasRun() {
 			return errRuntime
 		}
-		c.renewDeadline = renewDeadline
+		if client == nil {
+			return fmt.Errorf("invalid object client: must not be nil")
+		}
+		c.objectClient = client
 		return nil
 	}
 }
 
-// RetryPeriod is the duration the LeaderElector clients should wait
-// between tries of actions. Defaults to 2 seconds.
-func RetryPeriod(retryPeriod time.Duration) func(*ProvisionController) error {
+// VolumeSavePendingWarningAge is the time after which a Warning event is sent
+// to a claim whose provisioned PV could not be saved to API server yet. Set to 0
+// to disable the event. Defaults to 5 minutes.
+func VolumeSavePendingWarningAge(age time.Duration) func(*ProvisionController) error {
 	return func(c *ProvisionController) error {
 		if c.HasRun() {
 			return errRuntime
 		}
-		c.retryPeriod = retryPeriod
+		c.pendingSaveWarningAge = age
 		return nil
 	}
 }
 
-// ClaimsInformer sets the informer to use for accessing PersistentVolumeClaims.
-// Defaults to using a internal informer.
-func ClaimsInformer(informer cache.SharedIndexInformer) func(*ProvisionController) error {
+// VolumeDriftAuditInterval enables detection of PVs modified out-of-band,
+// e.g. by admission webhooks or GitOps tools, in ways that break their
+// deletion later. The controller stores a short hash of the provisioned-by
+// annotation, claimRef UID and source identity (driver and handle of CSI
+// volumes, the kind of other sources) of each provisioned PV in its "<provisioner>/content-hash"
+// annotation and checks the cached PVs every interval. A PV whose hash does
+// not match gets a Warning event VolumeDriftDetected, once until it changes
+// again, and is counted in the volume_drift_detected_total metric. PVs are
+// not repaired. PVs provisioned while the audit was disabled are not
+// checked. It requires full PVs in the cache, it can't be combined with
+// DeletionDisabled or VolumeMetadataClient.
+// Defaults to 0, i.e. disabled.
+func VolumeDriftAuditInterval(interval time.Duration) func(*ProvisionController) error {
 	return func(c *ProvisionController) error {
 		if c.HasRun() {
 			return errRuntime
 		}
-		c.claimInformer = informer
-		c.customClaimInformer = true
+		if interval < 0 {
+			return fmt.Errorf("invalid drift audit interval %v: must not be negative", interval)
+		}
+		c.driftAuditInterval = interval
 		return nil
 	}
 }
 
-// VolumesInformer sets the informer to use for accessing PersistentVolumes.
-// Defaults to using a internal informer.
-func VolumesInformer(informer cache.SharedInformer) func(*ProvisionController) error {
+// FailedProvisionThreshold is the threshold for max number of retries on
+// failures of Provision. Set to 0 to retry indefinitely. Defaults to 15.
+// When a claim reaches the threshold, the number of failures and the last
+// error are recorded in its "<provisioner>/provision-failures" and
+// "<provisioner>/last-error" annotations and a Warning event is sent. Updates
+// of the claim spec or annotations and of its StorageClass reset the failures
+// and clear the annotations.
+func FailedProvisionThreshold(failedProvisionThreshold int) func(*ProvisionController) error {
 	return func(c *ProvisionController) error {
 		if c.HasRun() {
 			return errRuntime
 		}
-		c.volumeInformer = informer
-		c.customVolumeInformer = true
+		c.failedProvisionThreshold = failedProvisionThreshold
 		return nil
 	}
 }
 
-// ClassesInformer sets the informer to use for accessing StorageClasses.
-// The informer must use the versioned resource appropriate for the Kubernetes cluster version
-// (that is, v1.StorageClass for >= 1.6, and v1beta1.StorageClass for < 1.6).
-// Defaults to using a internal informer.
-func ClassesInformer(informer cache.SharedInformer) func(*ProvisionController) error {
+// PersistRetryState records the ProvisionRetryBackoff position of claims in
+// annotations "<provisioner name>/provision-attempts" and
+// "<provisioner name>/last-attempt", patched once per failed attempt. A
+// restarted controller continues the backoff where the previous one left
+// off instead of retrying all claims at full speed. Recorded state older
+// than the backoff cap is ignored. Requires ProvisionRetryBackoff, globally
+// or in ClassOverrides, other claims are not affected. Defaults to false.
+func PersistRetryState(persistRetryState bool) func(*ProvisionController) error {
 	return func(c *ProvisionController) error {
 		if c.HasRun() {
 			return errRuntime
 		}
-		c.classInformer = informer
-		c.customClassInformer = true
+		c.persistRetryState = persistRetryState
 		return nil
 	}
 }
 
-// NodesLister sets the informer to use for accessing Nodes.
-// This is needed only for PVCs which have a selected node.
-// Defaults to using a GET instead of an informer.
-//
-// Which approach is better depends on factors like cluster size and
-// ratio of PVCs with a selected node.
-func NodesLister(nodeLister corelistersv1.NodeLister) func(*ProvisionController) error {
+// AvoidUnschedulableNodes, if true, reschedules claims of StorageClasses
+// with WaitForFirstConsumer binding whose selected node is cordoned or has
+// one of the given taints, instead of provisioning a volume that the pod will
+// never use, e.g. on a node-local backend. Taints match by key, and by value
+// and effect if they are set. The selected node annotation of such claims is
+// removed and an event explains why. Cordoning is often temporary, so this
+// defaults to false.
+func AvoidUnschedulableNodes(avoid bool, taints ...v1.Taint) func(*ProvisionController) error {
 	return func(c *ProvisionController) error {
 		if c.HasRun() {
 			return errRuntime
 		}
-		c.nodeLister = nodeLister
+		for _, taint := range taints {
+			if taint.Key == "" {
+				return fmt.Errorf("invalid AvoidUnschedulableNodes taint %q: must have a key", taint.ToString())
+			}
+		}
+		c.avoidUnschedulableNodes = avoid
+		c.avoidedNodeTaints = taints
 		return nil
 	}
 }
 
-// MetricsInstance defines which metrics collection to update. Default: metrics.Metrics.
-func MetricsInstance(m metrics.Metrics) func(*ProvisionController) error {
+// UseStorageCapacityTracking, if true, watches storage.k8s.io/v1
+// CSIStorageCapacity objects and provisions a claim only when one of them
+// reports enough capacity of its StorageClass, in the topology segment of
+// the selected node or, for Immediate binding, in any segment. The
+// nodeTopology selectors of the objects are matched against the node
+// labels, and maximumVolumeSize is used instead of capacity when it is set.
+// Claims that do not fit get a NotEnoughStorageCapacity event and are
+// retried after about a minute, which is not counted as a failure. Only
+// the given classes are checked, all classes if none are given. Classes
+// without any CSIStorageCapacity objects are not checked.
+// Defaults to false.
+func UseStorageCapacityTracking(use bool, classes ...string) func(*ProvisionController) error {
 	return func(c *ProvisionController) error {
 		if c.HasRun() {
 			return errRuntime
 		}
-		c.metrics = m
+		c.storageCapacityTracking = use
+		c.capacityClasses = sets.New(classes...)
 		return nil
 	}
 }
 
-// MetricsPort sets the port that metrics server serves on. Default: 0, set to non-zero to enable.
-func MetricsPort(metricsPort int32) func(*ProvisionController) error {
+// ProvisionRetryBackoff retries failed provisioning of each claim forever
+// with exponential backoff instead of giving up after
+// FailedProvisionThreshold failures. The n-th retry of a claim is delayed by
+// backoff.Duration * backoff.Factor^(n-1), jittered by backoff.Jitter and
+// capped at backoff.Cap, backoff.Steps is ignored. A zero backoff.Cap is
+// replaced by 5 minutes, or backoff.Duration if it's longer. The failures of a
+// claim are reset when it's provisioned or its spec or annotations change.
+// Can't be combined with ClaimQueueRateLimiter. Defaults to
+// FailedProvisionThreshold.
+func ProvisionRetryBackoff(backoff wait.Backoff) func(*ProvisionController) error {
 	return func(c *ProvisionController) error {
 		if c.HasRun() {
 			return errRuntime
 		}
-		c.metricsPort = metricsPort
+		if err := validateRetryBackoff(backoff); err != nil {
+			return err
+		}
+		backoff = withDefaultCap(backoff)
+		c.provisionRetryBackoff = &backoff
 		return nil
 	}
 }
 
-// MetricsAddress sets the ip address that metrics serve serves on.
-func MetricsAddress(metricsAddress string) func(*ProvisionController) error {
+// ClassOverrides sets retry policies of claims and volumes of the given
+// StorageClasses, classes that are not listed use FailedProvisionThreshold,
+// FailedDeleteThreshold and ProvisionRetryBackoff. The policy of a claim is
+// resolved from its current class on each retry. Backoffs without Cap are
+// capped like in ProvisionRetryBackoff.
+func ClassOverrides(overrides map[string]ClassPolicy) func(*ProvisionController) error {
 	return func(c *ProvisionController) error {
 		if c.HasRun() {
 			return errRuntime
 		}
-		c.metricsAddress = metricsAddress
+		copied := make(map[string]ClassPolicy, len(overrides))
+		for class, policy := range overrides {
+			if policy.ProvisionRetryBackoff != nil {
+				if err := validateRetryBackoff(*policy.ProvisionRetryBackoff); err != nil {
+					return fmt.Errorf("class %q: %v", class, err)
+				}
+				backoff := withDefaultCap(*policy.ProvisionRetryBackoff)
+				policy.ProvisionRetryBackoff = &backoff
+			}
+			copied[class] = policy
+		}
+		c.classOverrides = copied
 		return nil
 	}
 }
 
-// MetricsPath sets the endpoint path of metrics server.
-func MetricsPath(metricsPath string) func(*ProvisionController) error {
+func validateRetryBackoff(backoff wait.Backoff) error {
+	if backoff.Duration <= 0 {
+		return fmt.Errorf("invalid ProvisionRetryBackoff duration %v: must be positive", backoff.Duration)
+	}
+	if backoff.Factor < 1 {
+		return fmt.Errorf("invalid ProvisionRetryBackoff factor %v: must be at least 1", backoff.Factor)
+	}
+	if backoff.Cap < 0 {
+		return fmt.Errorf("invalid ProvisionRetryBackoff cap %v: must not be negative", backoff.Cap)
+	}
+	return nil
+}
+
+// FailedDeleteThreshold is the threshold for max number of retries on failures
+// of Delete. Set to 0 to retry indefinitely. Defaults to 15.
+func FailedDeleteThreshold(failedDeleteThreshold int) func(*ProvisionController) error {
 	return func(c *ProvisionController) error {
 		if c.HasRun() {
 			return errRuntime
 		}
-		c.metricsPath = metricsPath
+		c.failedDeleteThreshold = failedDeleteThreshold
 		return nil
 	}
 }
 
-// AdditionalProvisionerNames sets additional names for the provisioner
-func AdditionalProvisionerNames(additionalProvisionerNames []string) func(*ProvisionController) error {
+// ComponentEventRecorder is an event recorder that can record events with a
+// given source component. A recorder injected with WithEventRecorder that
+// implements it records the events of the controller with EventComponent.
+type ComponentEventRecorder interface {
+	record.EventRecorder
+	// WithComponent returns a recorder that records events with the given
+	// source component.
+	WithComponent(component string) record.EventRecorder
+}
+
+// WithEventRecorder sets the recorder of all events emitted on claims and
+// PVs, e.g. to also forward them to an audit log or to assert them in tests.
+// The controller then does not start its own event broadcaster and
+// EventAggregationWindow has no effect. A recorder that implements
+// ComponentEventRecorder is set up with EventComponent. Default: a recorder
+// that writes events to the API server.
+func WithEventRecorder(recorder record.EventRecorder) func(*ProvisionController) error {
 	return func(c *ProvisionController) error {
 		if c.HasRun() {
 			return errRuntime
 		}
-		c.additionalProvisionerNames = additionalProvisionerNames
+		c.eventRecorder = recorder
+		c.customEventRecorder = true
 		return nil
 	}
 }
 
-// AddFinalizer determines whether to add a finalizer marking the provisioner
-// as the owner of the PV with clean up duty. A PV having the finalizer means
-// the provisioner wants to keep it around so that it can reclaim it.
-func AddFinalizer(addFinalizer bool) func(*ProvisionController) error {
+// SkipLogVerbosity is the log verbosity of the line logged each time a claim
+// is evaluated and not provisioned. The line states the SkipReason, e.g. that
+// the claim is waiting for its first consumer. Defaults to 4.
+func SkipLogVerbosity(verbosity int) func(*ProvisionController) error {
 	return func(c *ProvisionController) error {
 		if c.HasRun() {
 			return errRuntime
 		}
-		c.addFinalizer = addFinalizer
+		c.skipLogVerbosity = verbosity
 		return nil
 	}
 }
 
-// ProvisionTimeout sets the amount of time that provisioning a volume may take.
-// The default is unlimited.
-func ProvisionTimeout(timeout time.Duration) func(*ProvisionController) error {
+// ExplainSkips enables Normal ProvisioningSkipped events on claims of this
+// provisioner that are not provisioned yet because the provisioner's
+// Qualifier rejected them or they are waiting for their first consumer. The
+// event is sent when the reason changes and then at most once per 10 minutes.
+// Defaults to false.
+func ExplainSkips(explainSkips bool) func(*ProvisionController) error {
 	return func(c *ProvisionController) error {
 		if c.HasRun() {
 			return errRuntime
 		}
-		c.provisionTimeout = timeout
+		c.explainSkips = explainSkips
 		return nil
 	}
 }
 
-// DeletionTimeout sets the amount of time that deleting a volume may take.
-// The default is unlimited.
-func DeletionTimeout(timeout time.Duration) func(*ProvisionController) error {
+// ResolveConsumerPod, if true, passes the pod that uses a claim to
+// Provision as ProvisionOptions.ConsumerPod, e.g. so that the provisioner can
+// place replicas of the volume by the pod's anti-affinity. Only claims of
+// StorageClasses with WaitForFirstConsumer binding with a selected node get
+// the pod. A pod informer indexed by claims is created, the provisioner
+// needs permissions to list and watch pods. Defaults to false.
+func ResolveConsumerPod(resolveConsumerPod bool) func(*ProvisionController) error {
 	return func(c *ProvisionController) error {
 		if c.HasRun() {
 			return errRuntime
 		}
-		c.deletionTimeout = timeout
+		c.resolveConsumerPod = resolveConsumerPod
 		return nil
 	}
 }
 
-// HasRun returns whether the controller has Run
-func (ctrl *ProvisionController) HasRun() bool {
-	ctrl.hasRunLock.Lock()
-	defer ctrl.hasRunLock.Unlock()
-	return ctrl.hasRun
+// ResolveSnapshotDataSource, if true, passes the VolumeSnapshot and
+// VolumeSnapshotContent a claim is restored from to Provision as
+// ProvisionOptions.SnapshotSource, so that the provisioner does not need to
+// fetch them itself. The controller gets both objects before each Provision
+// call of such a claim and retries the claim while the snapshot does not
+// exist or, see SnapshotReadyRetryDelay, is not ready to use. Requires
+// DynamicClient, the provisioner needs
+// permissions to get volumesnapshots and volumesnapshotcontents.
+// Defaults to false.
+func ResolveSnapshotDataSource(resolve bool) func(*ProvisionController) error {
+	return func(c *ProvisionController) error {
+		if c.HasRun() {
+			return errRuntime
+		}
+		c.resolveSnapshots = resolve
+		return nil
+	}
 }
 
-// NewProvisionController creates a new provision controller using
-// the given configuration parameters and with private (non-shared) informers.
-func NewProvisionController(
-	logger klog.Logger,
-	client kubernetes.Interface,
+// ResolveVolumeAttributesClass, if true, passes the parameters of the
+// VolumeAttributesClass of a claim to Provision as
+// ProvisionOptions.VolumeAttributesClassParameters. The controller gets the
+// class before each Provision call of a claim with volumeAttributesClassName
+// and retries the claim while the class does not exist or is of another
+// driver than the StorageClass. The provisioner needs permissions to get
+// volumeattributesclasses of storage.k8s.io/v1alpha1. Defaults to false.
+func ResolveVolumeAttributesClass(resolve bool) func(*ProvisionController) error {
+	return func(c *ProvisionController) error {
+		if c.HasRun() {
+			return errRuntime
+		}
+		c.resolveAttributesClass = resolve
+		return nil
+	}
+}
+
+// AllowedFSTypes passes the file system requested by the fsType or fstype
+// parameter of the StorageClass to Provision as ProvisionOptions.FSType,
+// resolved by util.GetFSType with allowed and defaultFS. Claims of classes
+// with a file system that is not allowed fail with a ProvisioningFailed
+// event that lists allowed values, before Provision is called. defaultFS
+// must be one of allowed or empty. Without it ProvisionOptions.FSType is
+// empty.
+func AllowedFSTypes(allowed []string, defaultFS string) func(*ProvisionController) error {
+	return func(c *ProvisionController) error {
+		if c.HasRun() {
+			return errRuntime
+		}
+		if len(allowed) == 0 {
+			return fmt.Errorf("invalid AllowedFSTypes %v: must not be empty", allowed)
+		}
+		normalized := make([]string, 0, len(allowed))
+		for _, fsType := range allowed {
+			fsType = strings.ToLower(strings.TrimSpace(fsType))
+			if fsType == "" {
+				return fmt.Errorf("invalid AllowedFSTypes %q: file systems must not be empty", allowed)
+			}
+			normalized = append(normalized, fsType)
+		}
+		defaultFS = strings.ToLower(strings.TrimSpace(defaultFS))
+		if defaultFS != "" && !slices.Contains(normalized, defaultFS) {
+			return fmt.Errorf("invalid default file system %q: must be one of %s", defaultFS, strings.Join(normalized, ", "))
+		}
+		c.allowedFSTypes, c.defaultFSType = normalized, defaultFS
+		return nil
+	}
+}
+
+// StorageClassAPIFallback, if true, keeps the controller running on old
+// clusters without the storage.k8s.io/v1 StorageClass API. When listing
+// v1 StorageClasses fails with NotFound in Run, the class informer is not
+// started and the class of each claim is fetched from
+// storage.k8s.io/v1beta1 instead, ValidateTopologyKeys and ClassesLister
+// are disabled and claims are not synced when their class changes. The API
+// is checked again every 5 minutes, the class informer is started once it
+// exists. It has no effect with ClassesInformer or SharedInformerFactory.
+// Defaults to false.
+func StorageClassAPIFallback(enabled bool) func(*ProvisionController) error {
+	return func(c *ProvisionController) error {
+		if c.HasRun() {
+			return errRuntime
+		}
+		c.classAPIFallback = enabled
+		return nil
+	}
+}
+
+// SnapshotReadyRetryDelay sets how long a claim waits before it is synced
+// again when ResolveSnapshotDataSource finds its VolumeSnapshot not ready to
+// use yet, e.g. while the snapshot is being cut. Such retries are not
+// provisioning failures, they neither increase the backoff nor count towards
+// FailedProvisionThreshold, so that the claim is not given up before the
+// snapshot is ready.
+// Defaults to 15 seconds.
+func SnapshotReadyRetryDelay(delay time.Duration) func(*ProvisionController) error {
+	return func(c *ProvisionController) error {
+		if c.HasRun() {
+			return errRuntime
+		}
+		if delay <= 0 {
+			return fmt.Errorf("invalid SnapshotReadyRetryDelay %v: must be positive", delay)
+		}
+		c.snapshotRetryDelay = delay
+		return nil
+	}
+}
+
+// CrossNamespaceDataSources, if true, provisions claims whose dataSourceRef
+// is in another namespace when a ReferenceGrant
+// (gateway.networking.k8s.io/v1beta1) in that namespace allows claims of the
+// claim's namespace to use the data source. Without a grant, the claim gets
+// a Warning event and is not provisioned until it is changed. When false,
+// such claims are skipped with a Warning event. Requires DynamicClient, the
+// provisioner needs permissions to list referencegrants.
+// Defaults to false.
+func CrossNamespaceDataSources(enabled bool) func(*ProvisionController) error {
+	return func(c *ProvisionController) error {
+		if c.HasRun() {
+			return errRuntime
+		}
+		c.crossNamespaceSources = enabled
+		return nil
+	}
+}
+
+// SupportedDataSources adds kinds of data sources that the provisioner
+// populates itself, besides PersistentVolumeClaims (see CloneSupporter) and
+// VolumeSnapshots. Claims with a data source of another kind, e.g. of a
+// volume populator, are skipped with an event instead of being provisioned
+// as empty volumes, the populator provisions them.
+func SupportedDataSources(kinds ...schema.GroupKind) func(*ProvisionController) error {
+	return func(c *ProvisionController) error {
+		if c.HasRun() {
+			return errRuntime
+		}
+		for _, kind := range kinds {
+			if kind.Kind == "" {
+				return fmt.Errorf("invalid SupportedDataSources %v: kind must not be empty", kind)
+			}
+		}
+		c.supportedDataSources = append(c.supportedDataSources, kinds...)
+		return nil
+	}
+}
+
+// ProvisionForeignDataSources, if true, provisions claims with data sources
+// of any kind, ignoring SupportedDataSources, as older versions of the
+// library did. The provisioner usually creates an empty volume for a data
+// source it does not know. Defaults to false.
+func ProvisionForeignDataSources(provision bool) func(*ProvisionController) error {
+	return func(c *ProvisionController) error {
+		if c.HasRun() {
+			return errRuntime
+		}
+		c.provisionForeignSources = provision
+		return nil
+	}
+}
+
+// DynamicClient sets the client used to get objects of APIs that have no
+// typed client in client-go, e.g. VolumeSnapshots for
+// ResolveSnapshotDataSource or ReferenceGrants for
+// CrossNamespaceDataSources.
+func DynamicClient(client dynamic.Interface) func(*ProvisionController) error {
+	return func(c *ProvisionController) error {
+		if c.HasRun() {
+			return errRuntime
+		}
+		c.dynamicClient = client
+		return nil
+	}
+}
+
+// RESTMapper sets the mapper used by ResolveDataSource to find the resource
+// of a data source kind, e.g. a restmapper.DeferredDiscoveryRESTMapper.
+func RESTMapper(mapper meta.RESTMapper) func(*ProvisionController) error {
+	return func(c *ProvisionController) error {
+		if c.HasRun() {
+			return errRuntime
+		}
+		c.restMapper = mapper
+		return nil
+	}
+}
+
+// ClientQPS records the QPS limit of the Kubernetes clients of the
+// controller. The controller builds no clients itself: the client passed to
+// NewProvisionController, used for all reads, events and leader election,
+// and the clients of PVWriteClient, VolumeMetadataClient and DynamicClient
+// are all created by the caller, who applies the limit to their
+// rest.Config. The controller validates the value and reports it in the
+// client_qps label of the build info metric, so that it can be compared with
+// API server throttling. A negative QPS means no rate limiting and 0 the
+// default of client-go, like in rest.Config. Defaults to 0.
+func ClientQPS(qps float32) func(*ProvisionController) error {
+	return func(c *ProvisionController) error {
+		if c.HasRun() {
+			return errRuntime
+		}
+		if math.IsNaN(float64(qps)) || math.IsInf(float64(qps), 0) {
+			return fmt.Errorf("invalid ClientQPS %v: must be a finite number", qps)
+		}
+		c.clientQPS = qps
+		return nil
+	}
+}
+
+// ClientBurst records the burst of the Kubernetes clients of the controller,
+// see ClientQPS. It is reported in the client_burst label of the build info
+// metric. Must be positive. Defaults to 0, i.e. not reported.
+func ClientBurst(burst int) func(*ProvisionController) error {
+	return func(c *ProvisionController) error {
+		if c.HasRun() {
+			return errRuntime
+		}
+		if burst <= 0 {
+			return fmt.Errorf("invalid ClientBurst %d: must be positive", burst)
+		}
+		c.clientBurst = burst
+		return nil
+	}
+}
+
+// UserAgent records the user agent of the Kubernetes clients of the
+// controller, see ClientQPS, e.g. as set by rest.AddUserAgent. It is
+// reported in the user_agent label of the build info metric. It must not be
+// empty or contain control characters. Defaults to "", i.e. not reported.
+func UserAgent(userAgent string) func(*ProvisionController) error {
+	return func(c *ProvisionController) error {
+		if c.HasRun() {
+			return errRuntime
+		}
+		if userAgent == "" || strings.IndexFunc(userAgent, unicode.IsControl) >= 0 {
+			return fmt.Errorf("invalid UserAgent %q: must not be empty or contain control characters", userAgent)
+		}
+		c.userAgent = userAgent
+		return nil
+	}
+}
+
+// ValidateTopologyKeys, if true, checks the allowedTopologies of
+// StorageClasses of this provisioner against the labels of the nodes in
+// the cluster, when a class is added or changed and every 10 minutes. When
+// no node has a label of a key used there, e.g. because of a typo or
+// because the CSI driver's topology domain changed, claims of the class
+// would wait forever. The class then gets a Warning UnknownTopologyKeys
+// event, at most once per hour. Clusters without nodes are not reported.
+// Like in ClassFailureEvents, the events are created in the "default"
+// namespace. Defaults to false.
+func ValidateTopologyKeys(validateTopologyKeys bool) func(*ProvisionController) error {
+	return func(c *ProvisionController) error {
+		if c.HasRun() {
+			return errRuntime
+		}
+		c.validateTopologyKeys = validateTopologyKeys
+		return nil
+	}
+}
+
+// RequireSelectedNode, if true, provisions volumes only for claims with the
+// volume.kubernetes.io/selected-node annotation, as if all StorageClasses
+// used WaitForFirstConsumer binding. It is meant for node-local backends,
+// where a volume of an Immediate class would be pinned to an arbitrary node.
+// The scheduler selects nodes only for claims of WaitForFirstConsumer
+// classes, other claims wait until someone else sets the annotation. Each
+// such claim gets one Warning SelectedNodeRequired event advising to change
+// its class. Deletion is not affected. Defaults to false.
+func RequireSelectedNode(requireSelectedNode bool) func(*ProvisionController) error {
+	return func(c *ProvisionController) error {
+		if c.HasRun() {
+			return errRuntime
+		}
+		c.requireSelectedNode = requireSelectedNode
+		return nil
+	}
+}
+
+// ClassFailureEvents enables Warning ProvisioningFailedRepeatedly events on
+// a StorageClass when at least threshold provisioning attempts of its claims
+// fail with the same error within window, e.g. because of invalid backend
+// credentials in the class parameters. The event states the error and the
+// number of affected claims and is sent at most once per window for each
+// error. The parts of error messages specific to a claim (its name and UID,
+// the PV name) are ignored when comparing errors.
+//
+// StorageClasses are not namespaced, their events are created in the
+// "default" namespace. The provisioner needs RBAC permissions to create and
+// patch events there.
+//
+// Disabled by default.
+func ClassFailureEvents(threshold int, window time.Duration) func(*ProvisionController) error {
+	return func(c *ProvisionController) error {
+		if c.HasRun() {
+			return errRuntime
+		}
+		if threshold <= 0 || window <= 0 {
+			return fmt.Errorf("ClassFailureEvents requires positive threshold and window, got %d and %v", threshold, window)
+		}
+		c.classFailures = newClassFailureTracker(threshold, window)
+		return nil
+	}
+}
+
+// EventComponent sets the source component of the events emitted by the
+// controller, so that events of several provisioners in a cluster can be told
+// apart. It applies to a recorder injected by WithEventRecorder only if that
+// implements ComponentEventRecorder, setting it for any other injected
+// recorder is an error. Defaults to the provisioner name with characters
+// other than alphanumerics, '-', '_' and '.' replaced by '-'.
+func EventComponent(component string) func(*ProvisionController) error {
+	return func(c *ProvisionController) error {
+		if c.HasRun() {
+			return errRuntime
+		}
+		c.eventComponent = component
+		c.customEventComponent = true
+		return nil
+	}
+}
+
+// EventAggregationWindow is the time window in which repeated events of the
+// same claim or PV are aggregated. Identical events (same reason and message)
+// update the count of the existing Event object instead of creating a new
+// one and are rate limited separately from other events of the object, so
+// that a claim failing over and over against an unavailable backend does not
+// flood the API server. A changed message always produces a new Event. After
+// more than 10 events with the same reason but different messages within the
+// window, they are combined into a single Event too. Must be at least one
+// second. Defaults to 10 minutes.
+func EventAggregationWindow(window time.Duration) func(*ProvisionController) error {
+	return func(c *ProvisionController) error {
+		if c.HasRun() {
+			return errRuntime
+		}
+		c.eventAggregationWindow = window
+		return nil
+	}
+}
+
+// LeaderElection determines whether to enable leader election or not. Defaults
+// to true.
+func LeaderElection(leaderElection bool) func(*ProvisionController) error {
+	return func(c *ProvisionController) error {
+		if c.HasRun() {
+			return errRuntime
+		}
+		c.leaderElection = leaderElection
+		return nil
+	}
+}
+
+// LeaderElectionNamespace is the kubernetes namespace in which to create the
+// leader election object. Defaults to the same namespace in which the
+// the controller runs.
+func LeaderElectionNamespace(leaderElectionNamespace string) func(*ProvisionController) error {
+	return func(c *ProvisionController) error {
+		if c.HasRun() {
+			return errRuntime
+		}
+		c.leaderElectionNamespace = leaderElectionNamespace
+		return nil
+	}
+}
+
+// LeaseDuration is the duration that non-leader candidates will
+// wait to force acquire leadership. This is measured against time of
+// last observed ack. Defaults to 15 seconds.
+func LeaseDuration(leaseDuration time.Duration) func(*ProvisionController) error {
+	return func(c *ProvisionController) error {
+		if c.HasRun() {
+			return errRuntime
+		}
+		c.leaseDuration = leaseDuration
+		return nil
+	}
+}
+
+// RenewDeadline is the duration that the acting master will retry
+// refreshing leadership before giving up. Defaults to 10 seconds.
+func RenewDeadline(renewDeadline time.Duration) func(*ProvisionController) error {
+	return func(c *ProvisionController) error {
+		if c.HasRun() {
+			return errRuntime
+		}
+		c.renewDeadline = renewDeadline
+		return nil
+	}
+}
+
+// RetryPeriod is the duration the LeaderElector clients should wait
+// between tries of actions. Defaults to 2 seconds.
+func RetryPeriod(retryPeriod time.Duration) func(*ProvisionController) error {
+	return func(c *ProvisionController) error {
+		if c.HasRun() {
+			return errRuntime
+		}
+		c.retryPeriod = retryPeriod
+		return nil
+	}
+}
+
+// SharedInformerFactory sets the factory from which the controller obtains
+// its PersistentVolumeClaim, PersistentVolume and StorageClass informers, so
+// that it shares watches and caches with other controllers of the binary.
+// Informers set by ClaimsInformer, VolumesInformer or ClassesInformer take
+// precedence. The caller is responsible for starting the factory after
+// NewProvisionController returns and for stopping it; Run does not start the
+// informers but still waits for their caches to sync.
+// Defaults to using internal informers.
+func SharedInformerFactory(factory informers.SharedInformerFactory) func(*ProvisionController) error {
+	return func(c *ProvisionController) error {
+		if c.HasRun() {
+			return errRuntime
+		}
+		c.informerFactory = factory
+		return nil
+	}
+}
+
+// ClaimsInformer sets the informer to use for accessing PersistentVolumeClaims.
+// The informer is not started by Run, the caller must start it. Run fails
+// when the informer holds objects of another type.
+// Defaults to using a internal informer.
+func ClaimsInformer(informer cache.SharedIndexInformer) func(*ProvisionController) error {
+	return func(c *ProvisionController) error {
+		if c.HasRun() {
+			return errRuntime
+		}
+		c.claimInformer = informer
+		c.customClaimInformer = true
+		return nil
+	}
+}
+
+// VolumesInformer sets the informer to use for accessing PersistentVolumes.
+// The informer is not started by Run, the caller must start it. Run fails
+// when the informer holds objects of another type.
+// Defaults to using a internal informer.
+func VolumesInformer(informer cache.SharedInformer) func(*ProvisionController) error {
+	return func(c *ProvisionController) error {
+		if c.HasRun() {
+			return errRuntime
+		}
+		c.volumeInformer = informer
+		c.customVolumeInformer = true
+		return nil
+	}
+}
+
+// VolumeListWatchLabelSelector sets the label selector of the internal
+// PersistentVolume informer, so that only matching PVs are cached and
+// processed. PVs that do not match are never deleted by the controller, the
+// provisioner must set the labels on the PVs returned by Provision and PVs
+// provisioned before the selector was enabled must be labeled first, e.g. by
+// LabelExistingVolumes. The internal informer is used even when
+// SharedInformerFactory is set; it can't be combined with VolumesInformer.
+// Defaults to no selector.
+func VolumeListWatchLabelSelector(selector string) func(*ProvisionController) error {
+	return func(c *ProvisionController) error {
+		if c.HasRun() {
+			return errRuntime
+		}
+		volumeSelector, err := labels.Parse(selector)
+		if err != nil {
+			return fmt.Errorf("invalid VolumeListWatchLabelSelector %q: %v", selector, err)
+		}
+		if volumeSelector.Empty() {
+			volumeSelector = nil
+		}
+		c.volumeSelector = volumeSelector
+		return nil
+	}
+}
+
+// CachedAnnotationSizeLimit drops annotations with values longer than limit
+// bytes, e.g. kubectl.kubernetes.io/last-applied-configuration, from PVCs
+// and PVs in the internal informer caches to save memory. Annotations read by
+// the controller are always kept, annotations needed by the provisioner must
+// be listed in keep. Objects passed to the provisioner miss the dropped
+// annotations. Managed fields are dropped from the caches regardless of this
+// option. Informers set by ClaimsInformer, VolumesInformer or
+// SharedInformerFactory are not modified.
+// Defaults to 0, i.e. all annotations are kept.
+func CachedAnnotationSizeLimit(limit int, keep ...string) func(*ProvisionController) error {
+	return func(c *ProvisionController) error {
+		if c.HasRun() {
+			return errRuntime
+		}
+		if limit < 0 {
+			return fmt.Errorf("invalid CachedAnnotationSizeLimit %d: must not be negative", limit)
+		}
+		c.cachedAnnotationSizeLimit = limit
+		c.keptAnnotations = sets.New(requiredAnnotations...).Insert(keep...)
+		return nil
+	}
+}
+
+// ClassesInformer sets the informer to use for accessing StorageClasses.
+// The informer must use the versioned resource appropriate for the Kubernetes cluster version
+// (that is, v1.StorageClass for >= 1.6, and v1beta1.StorageClass for < 1.6).
+// The informer is not started by Run, the caller must start it. Run fails
+// when the informer holds objects of another type.
+// Defaults to using a internal informer.
+func ClassesInformer(informer cache.SharedInformer) func(*ProvisionController) error {
+	return func(c *ProvisionController) error {
+		if c.HasRun() {
+			return errRuntime
+		}
+		c.classInformer = informer
+		c.customClassInformer = true
+		return nil
+	}
+}
+
+// NodesLister sets the informer to use for accessing Nodes.
+// This is needed only for PVCs which have a selected node.
+// Nodes missing in the lister are fetched by a GET.
+// Defaults to a node informer created when the first PVC with a selected
+// node is provisioned, see Nodes.
+func NodesLister(nodeLister corelistersv1.NodeLister) func(*ProvisionController) error {
+	return func(c *ProvisionController) error {
+		if c.HasRun() {
+			return errRuntime
+		}
+		c.nodeLister = nodeLister
+		return nil
+	}
+}
+
+// WithTracerProvider enables OpenTelemetry tracing of provisioning and
+// deletion. The controller creates a span for each provisioning attempt with
+// child spans for ShouldProvision, Provision and saving of the PV, and a span
+// for each deletion with child spans for ShouldDelete and Delete. Syncs of
+// PVs that are not deleted create no span. The context passed to
+// Provision and Delete carries the span, so implementations can add their
+// own child spans. Default: no tracing.
+func WithTracerProvider(provider trace.TracerProvider) func(*ProvisionController) error {
+	return func(c *ProvisionController) error {
+		if c.HasRun() {
+			return errRuntime
+		}
+		if provider == nil {
+			return fmt.Errorf("invalid TracerProvider: must not be nil")
+		}
+		c.tracer = provider.Tracer(tracerName)
+		return nil
+	}
+}
+
+// MetricsInstance defines which metrics collection to update. Default: metrics.Metrics.
+// Nil collectors of m are filled from metrics.New with the default subsystem.
+// It cannot be used together with MetricsSubsystem.
+func MetricsInstance(m metrics.Metrics) func(*ProvisionController) error {
+	return func(c *ProvisionController) error {
+		if c.HasRun() {
+			return errRuntime
+		}
+		c.metrics = m.WithDefaults(controllerSubsystem)
+		c.customMetrics = true
+		return nil
+	}
+}
+
+// MetricsSubsystem sets the prometheus subsystem, i.e. the name prefix, of all
+// metrics of the controller. Set it to a unique value when several
+// provisioners are scraped into the same Prometheus. It must be a valid
+// prometheus name component, empty subsystem means no prefix.
+// Default: "controller".
+// It cannot be used together with MetricsInstance.
+func MetricsSubsystem(subsystem string) func(*ProvisionController) error {
+	return func(c *ProvisionController) error {
+		if c.HasRun() {
+			return errRuntime
+		}
+		c.metricsSubsystem = subsystem
+		return nil
+	}
+}
+
+// MetricsPort sets the port that metrics server serves on. Default: 0, set to non-zero to enable.
+func MetricsPort(metricsPort int32) func(*ProvisionController) error {
+	return func(c *ProvisionController) error {
+		if c.HasRun() {
+			return errRuntime
+		}
+		c.metricsPort = metricsPort
+		return nil
+	}
+}
+
+// MetricsAddress sets the ip address that metrics serve serves on.
+func MetricsAddress(metricsAddress string) func(*ProvisionController) error {
+	return func(c *ProvisionController) error {
+		if c.HasRun() {
+			return errRuntime
+		}
+		c.metricsAddress = metricsAddress
+		return nil
+	}
+}
+
+// MetricsPath sets the endpoint path of metrics server.
+func MetricsPath(metricsPath string) func(*ProvisionController) error {
+	return func(c *ProvisionController) error {
+		if c.HasRun() {
+			return errRuntime
+		}
+		c.metricsPath = metricsPath
+		return nil
+	}
+}
+
+// MetricsServer determines whether to run the built-in metrics server on
+// MetricsPort. Disable it to serve MetricsHandler on an HTTP server of your
+// own instead. Default: true.
+func MetricsServer(enabled bool) func(*ProvisionController) error {
+	return func(c *ProvisionController) error {
+		if c.HasRun() {
+			return errRuntime
+		}
+		c.metricsServer = enabled
+		return nil
+	}
+}
+
+// EnableProfiling determines whether to serve the net/http/pprof handlers,
+// i.e. the profile index, cmdline, profile, symbol and trace, under
+// /debug/pprof/ on the built-in metrics server. When disabled, /debug/pprof/
+// is not served even if the binary imports net/http/pprof. Profiles reveal
+// internals of the process (goroutine stacks, allocation sites) and
+// collecting them costs CPU, so anyone who can reach the metrics port can
+// read them and slow down the controller. Enable only when the port is not
+// exposed to untrusted clients, preferably together with MetricsClientCAFile.
+// It requires the built-in metrics server (MetricsPort and MetricsServer).
+// Default: false.
+func EnableProfiling(enable bool) func(*ProvisionController) error {
+	return func(c *ProvisionController) error {
+		if c.HasRun() {
+			return errRuntime
+		}
+		c.enableProfiling = enable
+		return nil
+	}
+}
+
+// EnableDebugEndpoints determines whether to serve debug information as JSON
+// on the built-in metrics server. /debug/pending-volumes lists
+// PendingVolumes, i.e. claims whose provisioned PVs are not saved yet, with
+// the number of attempts, the last error and the time of the next retry.
+// Like EnableProfiling, it requires the built-in metrics server (MetricsPort
+// and MetricsServer) and should not be exposed to untrusted clients, the
+// endpoints reveal names of claims in all namespaces.
+// Default: false.
+func EnableDebugEndpoints(enable bool) func(*ProvisionController) error {
+	return func(c *ProvisionController) error {
+		if c.HasRun() {
+			return errRuntime
+		}
+		c.enableDebugEndpoints = enable
+		return nil
+	}
+}
+
+// MetricsCertFile sets the TLS certificate file of metrics server. If set
+// together with MetricsKeyFile, the metrics server serves HTTPS only. The file
+// is reloaded when it changes on disk.
+func MetricsCertFile(certFile string) func(*ProvisionController) error {
+	return func(c *ProvisionController) error {
+		if c.HasRun() {
+			return errRuntime
+		}
+		c.metricsCertFile = certFile
+		return nil
+	}
+}
+
+// MetricsKeyFile sets the TLS private key file of metrics server. It must be
+// set together with MetricsCertFile.
+func MetricsKeyFile(keyFile string) func(*ProvisionController) error {
+	return func(c *ProvisionController) error {
+		if c.HasRun() {
+			return errRuntime
+		}
+		c.metricsKeyFile = keyFile
+		return nil
+	}
+}
+
+// MetricsClientCAFile sets the CA bundle used to verify client certificates
+// of metrics server. If set, clients must present a valid certificate (mTLS).
+// It requires MetricsCertFile and MetricsKeyFile.
+func MetricsClientCAFile(caFile string) func(*ProvisionController) error {
+	return func(c *ProvisionController) error {
+		if c.HasRun() {
+			return errRuntime
+		}
+		c.metricsClientCAFile = caFile
+		return nil
+	}
+}
+
+// AdditionalProvisionerNames sets additional names for the provisioner
+func AdditionalProvisionerNames(additionalProvisionerNames []string) func(*ProvisionController) error {
+	return func(c *ProvisionController) error {
+		if c.HasRun() {
+			return errRuntime
+		}
+		c.additionalProvisionerNames = additionalProvisionerNames
+		return nil
+	}
+}
+
+// AdoptProvisionerNames sets previous names of the provisioner, e.g. after
+// it was renamed. PVs provisioned under any of the names are owned and
+// deleted by the controller like its own, claims of StorageClasses with any
+// of the names are provisioned and their PVs get the current name. The
+// provisioned-by annotation of existing PVs with a previous name is patched
+// to the current name when the controller syncs them, so that once all PVs
+// were synced, e.g. after a resync period, the option can be dropped. The
+// content hash annotation, see VolumeDriftAuditInterval, is updated with
+// it. Unlike AdditionalProvisionerNames, the names are never written to
+// PVs. Defaults to no names.
+func AdoptProvisionerNames(names []string) func(*ProvisionController) error {
+	return func(c *ProvisionController) error {
+		if c.HasRun() {
+			return errRuntime
+		}
+		for _, name := range names {
+			if name == "" || name == c.provisionerName {
+				return fmt.Errorf("invalid AdoptProvisionerNames %q: names must not be empty or the provisioner name", names)
+			}
+		}
+		c.adoptedProvisionerNames = names
+		return nil
+	}
+}
+
+// TranslatedInTreePluginName sets the counterpart of the provisioner name
+// under CSI migration: the in-tree plugin name, e.g. "kubernetes.io/aws-ebs",
+// for a CSI driver, or the CSI driver name, e.g. "ebs.csi.aws.com", for a
+// provisioner that uses the in-tree name. Claims whose storage-provisioner
+// annotation has either name and claims of StorageClasses with either name
+// are provisioned, so that claims are matched before, during and after
+// migration. PVs always get the provisioner name, PVs provisioned under the
+// counterpart name are not deleted by the controller unless their
+// migrated-to annotation has the provisioner name. Defaults to no name.
+func TranslatedInTreePluginName(name string) func(*ProvisionController) error {
+	return func(c *ProvisionController) error {
+		if c.HasRun() {
+			return errRuntime
+		}
+		if name == c.provisionerName {
+			return fmt.Errorf("invalid TranslatedInTreePluginName %q: must not be the provisioner name", name)
+		}
+		c.translatedPluginName = name
+		return nil
+	}
+}
+
+// AllowLegacyProvisionerName disables the check of the provisioner name by
+// ValidateProvisionerName, for provisioners whose name does not follow the
+// rules but is already used by StorageClasses and PVs. The name must still be
+// non-empty. Defaults to false.
+func AllowLegacyProvisionerName(allow bool) func(*ProvisionController) error {
+	return func(c *ProvisionController) error {
+		if c.HasRun() {
+			return errRuntime
+		}
+		c.legacyProvisionerName = allow
+		return nil
+	}
+}
+
+// ProvisionedByAnnotation sets the key of the annotation that records the
+// provisioner name on provisioned PVs, e.g. when provisioners that used
+// different keys are consolidated. The key must have a domain prefix, e.g.
+// "example.com/provisioned-by". PVs are provisioned with both the key and
+// AnnDynamicallyProvisioned, which Kubernetes relies on. The key takes
+// precedence when a PV is matched, the controller deletes PVs that have
+// either the key or AnnDynamicallyProvisioned, so that PVs provisioned
+// before the key was set remain owned. Defaults to AnnDynamicallyProvisioned.
+func ProvisionedByAnnotation(key string) func(*ProvisionController) error {
+	return func(c *ProvisionController) error {
+		if c.HasRun() {
+			return errRuntime
+		}
+		if msgs := validation.IsQualifiedName(key); len(msgs) > 0 || !strings.Contains(key, "/") {
+			return fmt.Errorf("invalid ProvisionedByAnnotation %q: must be a qualified name with a domain prefix, e.g. example.com/provisioned-by", key)
+		}
+		c.provisionedByAnnotation = key
+		return nil
+	}
+}
+
+// AddFinalizer determines whether to add a finalizer marking the provisioner
+// as the owner of the PV with clean up duty. A PV having the finalizer means
+// the provisioner wants to keep it around so that it can reclaim it.
+func AddFinalizer(addFinalizer bool) func(*ProvisionController) error {
+	return func(c *ProvisionController) error {
+		if c.HasRun() {
+			return errRuntime
+		}
+		c.addFinalizer = addFinalizer
+		return nil
+	}
+}
+
+// PVFinalizer sets the key of the finalizer added by AddFinalizer and
+// HonorPVReclaimPolicy. The key must have a domain prefix. PVs that have the
+// finalizer under a previous key keep it, it must be removed from them
+// manually. Defaults to external-provisioner.volume.kubernetes.io/finalizer,
+// the key of the CSI external-provisioner.
+func PVFinalizer(key string) func(*ProvisionController) error {
+	return func(c *ProvisionController) error {
+		if c.HasRun() {
+			return errRuntime
+		}
+		if msgs := validation.IsQualifiedName(key); len(msgs) > 0 || !strings.Contains(key, "/") {
+			return fmt.Errorf("invalid PVFinalizer %q: must be a qualified name with a domain prefix, e.g. example.com/finalizer", key)
+		}
+		c.pvFinalizer = key
+		return nil
+	}
+}
+
+// HonorPVReclaimPolicy, if true, reclaims the storage assets of PVs with
+// reclaim policy Delete also when the PV object is deleted before its claim,
+// like the HonorPVReclaimPolicy feature of Kubernetes. It implies
+// AddFinalizer: the finalizer keeps a deleted PV until the controller has
+// deleted its storage asset. Besides Released PVs, the controller then
+// deletes the storage asset of PVs with a deletionTimestamp and the finalizer
+// whose claim no longer exists, and removes the finalizer afterwards. The
+// storage asset is deleted only once, also when removing the finalizer
+// fails. PVs with reclaim policy Retain are never deleted. Defaults to false.
+func HonorPVReclaimPolicy(honor bool) func(*ProvisionController) error {
+	return func(c *ProvisionController) error {
+		if c.HasRun() {
+			return errRuntime
+		}
+		c.honorReclaimPolicy = honor
+		return nil
+	}
+}
+
+// ProvisionTimeout sets the amount of time that provisioning a volume may take.
+// The default is unlimited.
+func ProvisionTimeout(timeout time.Duration) func(*ProvisionController) error {
+	return func(c *ProvisionController) error {
+		if c.HasRun() {
+			return errRuntime
+		}
+		c.provisionTimeout = timeout
+		return nil
+	}
+}
+
+// DeletionTimeout sets the amount of time that deleting a volume may take.
+// The default is unlimited.
+func DeletionTimeout(timeout time.Duration) func(*ProvisionController) error {
+	return func(c *ProvisionController) error {
+		if c.HasRun() {
+			return errRuntime
+		}
+		c.deletionTimeout = timeout
+		return nil
+	}
+}
+
+// MaxInFlightOperations limits the number of Provision and Delete calls in
+// progress together, e.g. to stay within an API concurrency quota of the
+// backend. Claims and volumes that would exceed the limit are requeued after
+// about a second, without holding a worker and without counting as a
+// failure. The limit applies on top of ProvisionThreadiness and
+// DeletionThreadiness, the most restrictive one wins.
+// Defaults to 0, i.e. unlimited.
+func MaxInFlightOperations(limit int) func(*ProvisionController) error {
+	return func(c *ProvisionController) error {
+		if c.HasRun() {
+			return errRuntime
+		}
+		if limit < 0 {
+			return fmt.Errorf("invalid MaxInFlightOperations %d: must not be negative", limit)
+		}
+		c.maxInFlightOperations = limit
+		return nil
+	}
+}
+
+// NodeExpansionRequired determines whether volumes grown by ExpandVolume of an
+// Expander need a file system resize on the node. When true, the claim gets
+// the FileSystemResizePending condition and kubelet updates its capacity after
+// growing the file system. When false, the controller sets the capacity of the
+// claim right away. Defaults to false.
+func NodeExpansionRequired(required bool) func(*ProvisionController) error {
+	return func(c *ProvisionController) error {
+		if c.HasRun() {
+			return errRuntime
+		}
+		c.nodeExpansionRequired = required
+		return nil
+	}
+}
+
+// MissingNodeGracePeriod is how long the node of a node-local volume must be
+// missing before the volume is deleted with DeleteVolumeForMissingNode of a
+// NodeDeleter instead of Delete. Until then, Delete is called as usual. Only
+// a node that is deleted counts as missing, not a NotReady one. Defaults to
+// 10 minutes.
+func MissingNodeGracePeriod(gracePeriod time.Duration) func(*ProvisionController) error {
+	return func(c *ProvisionController) error {
+		if c.HasRun() {
+			return errRuntime
+		}
+		if gracePeriod < 0 {
+			return fmt.Errorf("invalid MissingNodeGracePeriod %v: must not be negative", gracePeriod)
+		}
+		c.missingNodeGracePeriod = gracePeriod
+		return nil
+	}
+}
+
+// PerNodeProvisionConcurrency limits the number of Provision calls in
+// progress for claims with the same selected node, e.g. so that volumes of a
+// local-storage backend are not created concurrently on the same disks.
+// Claims over the limit are requeued like with MaxInFlightOperations, while
+// claims of other nodes and claims without a selected node proceed.
+// Defaults to 0, i.e. unlimited.
+func PerNodeProvisionConcurrency(limit int) func(*ProvisionController) error {
+	return func(c *ProvisionController) error {
+		if c.HasRun() {
+			return errRuntime
+		}
+		if limit < 0 {
+			return fmt.Errorf("invalid PerNodeProvisionConcurrency %d: must not be negative", limit)
+		}
+		c.perNodeConcurrency = limit
+		return nil
+	}
+}
+
+// InitialSyncBurstLimit limits how many claims per second are enqueued from
+// the first listing of the claims informer, so that a provisioner started in
+// a cluster with many pending claims does not send all of them to the backend
+// at once. Claims added or changed later are enqueued immediately.
+// Defaults to 0, i.e. unlimited.
+func InitialSyncBurstLimit(perSecond float64) func(*ProvisionController) error {
+	return func(c *ProvisionController) error {
+		if c.HasRun() {
+			return errRuntime
+		}
+		if perSecond < 0 {
+			return fmt.Errorf("invalid InitialSyncBurstLimit %v: must not be negative", perSecond)
+		}
+		c.initialSyncBurstLimit = perSecond
+		return nil
+	}
+}
+
+// StartupJitter delays the start of workers by a random duration up to
+// maxDelay, so that provisioners of many clusters started at the same time
+// do not hit a shared backend in sync. The first enqueue of
+// InitialSyncBurstLimit is delayed with them.
+// Defaults to 0, i.e. workers start as soon as caches are synced.
+func StartupJitter(maxDelay time.Duration) func(*ProvisionController) error {
+	return func(c *ProvisionController) error {
+		if c.HasRun() {
+			return errRuntime
+		}
+		if maxDelay < 0 {
+			return fmt.Errorf("invalid StartupJitter %v: must not be negative", maxDelay)
+		}
+		c.startupJitter = maxDelay
+		return nil
+	}
+}
+
+// ShutdownGracePeriod is how long Run waits after its context is done for
+// Provision and Delete calls in progress to finish and for provisioned
+// volumes to be saved. Workers take no new items meanwhile. Volumes pending in
+// the CreateProvisionedPVLimiter queue or saved with the default backoff are
+// retried without it, those still not saved at the end are logged for manual
+// recovery and their storage assets are kept. When the period
+// expires, the contexts of the remaining calls are cancelled and Run returns
+// an error listing them. Keep it below the termination grace period of the
+// provisioner's Pod. Defaults to 20 seconds.
+func ShutdownGracePeriod(gracePeriod time.Duration) func(*ProvisionController) error {
+	return func(c *ProvisionController) error {
+		if c.HasRun() {
+			return errRuntime
+		}
+		if gracePeriod < 0 {
+			return fmt.Errorf("invalid ShutdownGracePeriod %v: must not be negative", gracePeriod)
+		}
+		c.shutdownGracePeriod = gracePeriod
+		return nil
+	}
+}
+
+// ClaimQueueFairnessThreshold is the number of claims waiting for a worker
+// above which the claims with the oldest creationTimestamp are processed
+// first, e.g. when all claims are retried after a backend outage. Below it
+// claims are processed in the order in which they were queued. Zero
+// processes the oldest claims first always. Defaults to 100.
+func ClaimQueueFairnessThreshold(threshold int) func(*ProvisionController) error {
+	return func(c *ProvisionController) error {
+		if c.HasRun() {
+			return errRuntime
+		}
+		if threshold < 0 {
+			return fmt.Errorf("invalid ClaimQueueFairnessThreshold %d: must not be negative", threshold)
+		}
+		c.claimFairnessThreshold = threshold
+		return nil
+	}
+}
+
+// MetricsHandler returns an http.Handler that serves the controller's
+// metrics. It can be mounted on any HTTP server, typically together with
+// MetricsServer(false).
+func (ctrl *ProvisionController) MetricsHandler() http.Handler {
+	return promhttp.HandlerFor(ctrl.metricsRegistry, promhttp.HandlerOpts{})
+}
+
+// ReadyWhenNotLeader determines whether a controller that has joined leader
+// election but is not the leader reports itself as ready. The controller has
+// joined once the API server answered its first request for the lease.
+// Defaults to true.
+func ReadyWhenNotLeader(ready bool) func(*ProvisionController) error {
+	return func(c *ProvisionController) error {
+		if c.HasRun() {
+			return errRuntime
+		}
+		c.readyWhenNotLeader = ready
+		return nil
+	}
+}
+
+// ReadyWhenPaused determines whether a paused controller, see Pause, reports
+// itself as ready. Set it to false to take the controller out of service
+// while it is paused. Defaults to true.
+func ReadyWhenPaused(ready bool) func(*ProvisionController) error {
+	return func(c *ProvisionController) error {
+		if c.HasRun() {
+			return errRuntime
+		}
+		c.readyWhenPaused = ready
+		return nil
+	}
+}
+
+// Ready returns nil when the controller is ready to do its work, i.e. it has
+// been Run and all its informer caches have synced. When leader election is
+// enabled, a controller that is not the leader is ready once it has joined the
+// election (see ReadyWhenNotLeader). A paused controller is not ready unless
+// ReadyWhenPaused is true.
+func (ctrl *ProvisionController) Ready() error {
+	ctrl.stateLock.Lock()
+	defer ctrl.stateLock.Unlock()
+	if ctrl.paused && !ctrl.readyWhenPaused {
+		return fmt.Errorf("controller is paused")
+	}
+	if ctrl.leaderElection && !ctrl.leading {
+		if !ctrl.joinedElection {
+			return fmt.Errorf("controller has not joined leader election yet")
+		}
+		if !ctrl.readyWhenNotLeader {
+			return fmt.Errorf("controller is not the leader")
+		}
+		return nil
+	}
+	if !ctrl.cachesSynced {
+		return errCachesNotSynced
+	}
+	return nil
+}
+
+// ReadyChecker returns an http.HandlerFunc suitable for a readiness probe. It
+// responds with 200 when Ready returns nil and with 503 otherwise.
+func (ctrl *ProvisionController) ReadyChecker() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := ctrl.Ready(); err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("ok"))
+	}
+}
+
+// HasRun returns whether the controller has Run
+func (ctrl *ProvisionController) HasRun() bool {
+	ctrl.hasRunLock.Lock()
+	defer ctrl.hasRunLock.Unlock()
+	return ctrl.hasRun
+}
+
+// HasSynced returns whether the informer caches of Run have synced. It stays
+// true after Run returned.
+func (ctrl *ProvisionController) HasSynced() bool {
+	ctrl.stateLock.Lock()
+	defer ctrl.stateLock.Unlock()
+	return ctrl.cachesSynced
+}
+
+// IsLeader returns whether the controller runs its control loops now: with
+// LeaderElection while it holds the lease, without it from the start of Run
+// until Run stops.
+func (ctrl *ProvisionController) IsLeader() bool {
+	ctrl.stateLock.Lock()
+	defer ctrl.stateLock.Unlock()
+	return ctrl.leading
+}
+
+// Stop stops a running controller like cancelling the context of Run does.
+// It does not wait for Run to return, see Stopped. Stop does nothing when
+// Run has not been called or has returned.
+func (ctrl *ProvisionController) Stop() {
+	ctrl.stateLock.Lock()
+	defer ctrl.stateLock.Unlock()
+	if ctrl.cancelRun != nil {
+		ctrl.cancelRun()
+	}
+}
+
+// Stopped returns a channel that is closed when Run has returned and all
+// goroutines it started have finished. It is not closed until Run is
+// called.
+func (ctrl *ProvisionController) Stopped() <-chan struct{} {
+	return ctrl.stopped
+}
+
+// startRun marks the controller as running and returns the context Run runs
+// with, Stop cancels it. It returns errRunTwice when Run has been called
+// before.
+func (ctrl *ProvisionController) startRun(ctx context.Context) (context.Context, error) {
+	ctrl.stateLock.Lock()
+	defer ctrl.stateLock.Unlock()
+	if ctrl.runStarted {
+		return nil, errRunTwice
+	}
+	ctrl.runStarted = true
+	ctx, ctrl.cancelRun = context.WithCancel(ctx)
+	if !ctrl.leaderElection {
+		ctrl.leading = true
+	}
+	return ctx, nil
+}
+
+// finishRun waits for the goroutines started by Run and closes stopped.
+func (ctrl *ProvisionController) finishRun() {
+	ctrl.setState(func() {
+		ctrl.cancelRun()
+		ctrl.cancelRun = nil
+		ctrl.leading = false
+	})
+	ctrl.background.Wait()
+	ctrl.nodeLock.Lock()
+	factory := ctrl.nodeInformerFactory
+	ctrl.nodeLock.Unlock()
+	if factory != nil && factory != ctrl.informerFactory {
+		// Informers of a factory passed by SharedInformerFactory may run
+		// with another stopCh, they are not waited for.
+		factory.Shutdown()
+	}
+	close(ctrl.stopped)
+}
+
+// goBackground runs f in a goroutine that Run waits for before it returns.
+func (ctrl *ProvisionController) goBackground(f func()) {
+	ctrl.background.Add(1)
+	go func() {
+		defer ctrl.background.Done()
+		f()
+	}()
+}
+
+// NewProvisionController creates a new provision controller using
+// the given configuration parameters and with private (non-shared) informers.
+// It exits the process when the arguments or options are invalid.
+//
+// Deprecated: use NewProvisionControllerOrError, which takes the same
+// arguments and returns the error instead of exiting, so that a process
+// running several controllers can handle it:
+//
+//	ctrl, err := controller.NewProvisionControllerOrError(logger, client, provisionerName, provisioner, options...)
+//	if err != nil {
+//		return fmt.Errorf("creating provision controller: %w", err)
+//	}
+func NewProvisionController(
+	logger klog.Logger,
+	client kubernetes.Interface,
 	provisionerName string,
 	provisioner Provisioner,
 	options ...func(*ProvisionController) error,
 ) *ProvisionController {
-	id, err := os.Hostname()
+	controller, err := newProvisionController(logger, client, provisionerName, provisioner, options)
 	if err != nil {
-		logger.Error(err, "Error getting hostname")
+		logger.Error(err, "Error creating provision controller")
 		klog.FlushAndExit(klog.ExitFlushTimeout, 1)
 	}
-	// add a uniquifier so that two processes on the same host don't accidentally both become active
-	id = id + "_" + string(uuid.NewUUID())
-	component := provisionerName + "_" + id
+	return controller
+}
 
-	// TODO: Once the following PR is merged, change to use StartLogging and StartRecordingToSinkWithContext
-	// https://github.com/kubernetes/kubernetes/pull/120729
-	v1.AddToScheme(scheme.Scheme)
-	broadcaster := record.NewBroadcaster()
-	broadcaster.StartStructuredLogging(0)
-	broadcaster.StartRecordingToSink(&corev1.EventSinkImpl{Interface: client.CoreV1().Events(v1.NamespaceAll)})
-	eventRecorder := broadcaster.NewRecorder(scheme.Scheme, v1.EventSource{Component: component})
+// NewProvisionControllerOrError creates a new provision controller using
+// the given configuration parameters and with private (non-shared)
+// informers. It returns an error listing all problems when the provisioner
+// name is empty, the client is nil or the options are invalid.
+func NewProvisionControllerOrError(
+	logger klog.Logger,
+	client kubernetes.Interface,
+	provisionerName string,
+	provisioner Provisioner,
+	options ...func(*ProvisionController) error,
+) (*ProvisionController, error) {
+	return newProvisionController(logger, client, provisionerName, provisioner, options)
+}
 
-	controller := &ProvisionController{
+// newDefaultProvisionController returns a controller with the defaults of
+// all options.
+func newDefaultProvisionController(logger klog.Logger, client kubernetes.Interface, provisionerName string, provisioner Provisioner, id string) *ProvisionController {
+	return &ProvisionController{
 		client:                    client,
 		provisionerName:           provisionerName,
 		provisioner:               provisioner,
+		annProvisionFailures:      giveUpAnnotationPrefix(provisionerName) + AnnProvisionFailuresSuffix,
+		annLastError:              giveUpAnnotationPrefix(provisionerName) + AnnLastErrorSuffix,
+		annProvisionAttempts:      giveUpAnnotationPrefix(provisionerName) + AnnProvisionAttemptsSuffix,
+		annLastAttempt:            giveUpAnnotationPrefix(provisionerName) + AnnLastAttemptSuffix,
+		logger:                    logger,
+		clock:                     clock.RealClock{},
 		id:                        id,
-		component:                 component,
-		eventRecorder:             eventRecorder,
+		component:                 provisionerName + "_" + id,
+		eventComponent:            sanitizeEventComponent(provisionerName),
+		eventAggregationWindow:    DefaultEventAggregationWindow,
 		resyncPeriod:              DefaultResyncPeriod,
 		exponentialBackOffOnError: DefaultExponentialBackOffOnError,
-		threadiness:               DefaultThreadiness,
+		provisionThreadiness:      DefaultThreadiness,
+		deletionThreadiness:       DefaultThreadiness,
+		inFlightRetryDelay:        defaultInFlightRetryDelay,
+		shutdownGracePeriod:       DefaultShutdownGracePeriod,
+		claimFairnessThreshold:    DefaultClaimQueueFairnessThreshold,
+		persistRetryState:         DefaultPersistRetryState,
+		avoidUnschedulableNodes:   DefaultAvoidUnschedulableNodes,
+		storageCapacityTracking:   DefaultUseStorageCapacityTracking,
+		requireSelectedNode:       DefaultRequireSelectedNode,
+		validateTopologyKeys:      DefaultValidateTopologyKeys,
+		resolveConsumerPod:        DefaultResolveConsumerPod,
+		resolveSnapshots:          DefaultResolveSnapshotDataSource,
+		resolveAttributesClass:    DefaultResolveVolumeAttributesClass,
+		snapshotRetryDelay:        DefaultSnapshotReadyRetryDelay,
+		crossNamespaceSources:     DefaultCrossNamespaceDataSources,
+		provisionForeignSources:   DefaultProvisionForeignDataSources,
+		provisionedByAnnotation:   DefaultProvisionedByAnnotation,
+		clientQPS:                 DefaultClientQPS,
+		clientBurst:               DefaultClientBurst,
+		userAgent:                 DefaultUserAgent,
+		legacyProvisionerName:     DefaultAllowLegacyProvisionerName,
+		translatedPluginName:      DefaultTranslatedInTreePluginName,
+		nodeExpansionRequired:     DefaultNodeExpansionRequired,
+		missingNodeGracePeriod:    DefaultMissingNodeGracePeriod,
+		classAPIFallback:          DefaultStorageClassAPIFallback,
+		classAPICheckInterval:     defaultClassAPICheckInterval,
+		storageCapacityRetryDelay: defaultStorageCapacityRetryDelay,
 		failedProvisionThreshold:  DefaultFailedProvisionThreshold,
+		pendingSaveWarningAge:     DefaultVolumeSavePendingWarningAge,
+		driftAuditInterval:        DefaultVolumeDriftAuditInterval,
+		pvSaveFailurePolicy:       DefaultPVSaveFailurePolicy,
+		serverSideApply:           DefaultUseServerSideApply,
 		failedDeleteThreshold:     DefaultFailedDeleteThreshold,
 		leaderElection:            DefaultLeaderElection,
 		leaderElectionNamespace:   getInClusterNamespace(),
 		leaseDuration:             DefaultLeaseDuration,
 		renewDeadline:             DefaultRenewDeadline,
 		retryPeriod:               DefaultRetryPeriod,
-		metrics:                   metrics.New(controllerSubsystem),
+		metricsSubsystem:          controllerSubsystem,
 		metricsPort:               DefaultMetricsPort,
 		metricsAddress:            DefaultMetricsAddress,
 		metricsPath:               DefaultMetricsPath,
+		metricsServer:             DefaultMetricsServer,
+		enableProfiling:           DefaultEnableProfiling,
+		enableDebugEndpoints:      DefaultEnableDebugEndpoints,
+		skipLogVerbosity:          DefaultSkipLogVerbosity,
+		explainSkips:              DefaultExplainSkips,
 		addFinalizer:              DefaultAddFinalizer,
+		pvFinalizer:               DefaultPVFinalizer,
+		honorReclaimPolicy:        DefaultHonorPVReclaimPolicy,
+		readyWhenNotLeader:        DefaultReadyWhenNotLeader,
+		readyWhenPaused:           DefaultReadyWhenPaused,
+		cacheSyncTimeout:          DefaultCacheSyncTimeout,
+		deletionDisabled:          DefaultDeletionDisabled,
+		provisioningDisabled:      DefaultProvisioningDisabled,
 		hasRun:                    false,
 		hasRunLock:                &sync.Mutex{},
+		stopped:                   make(chan struct{}),
 	}
+}
 
+// applyOptions applies all options, then checks that they can be used
+// together. It returns all errors found, not only the first one.
+func (ctrl *ProvisionController) applyOptions(options []func(*ProvisionController) error) error {
+	var errs []error
 	for _, option := range options {
-		err := option(controller)
-		if err != nil {
-			logger.Error(err, "Error processing controller options")
-			klog.FlushAndExit(klog.ExitFlushTimeout, 1)
+		if err := option(ctrl); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if err := ctrl.validateOptions(); err != nil {
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
+// ValidateProvisionerName checks that name can be the provisioner of
+// StorageClasses: a lowercase qualified name with a domain prefix, e.g.
+// "example.com/nfs", or a domain, e.g. the name "nfs.csi.example.com" of a CSI
+// driver. Kubernetes uses the same rules for the value of the
+// storage-provisioner annotation of claims, a name that does not follow them
+// may never match the annotation. The constructors call it unless
+// AllowLegacyProvisionerName is set, CLIs may call it to check their flags.
+func ValidateProvisionerName(name string) error {
+	if name == "" {
+		return errors.New("provisioner name must not be empty")
+	}
+	var msgs []string
+	if name != strings.ToLower(name) {
+		msgs = append(msgs, "must be lowercase")
+	}
+	if !strings.ContainsAny(name, "./") {
+		msgs = append(msgs, "must be a domain or have a domain prefix, e.g. 'csi.example.com' or 'example.com/my-provisioner'")
+	}
+	msgs = append(msgs, validation.IsQualifiedName(strings.ToLower(name))...)
+	if len(msgs) > 0 {
+		return fmt.Errorf("invalid provisioner name %q: %s", name, strings.Join(msgs, "; "))
+	}
+	return nil
+}
+
+// newProvisionController creates a controller with the given options, both
+// constructors build on it.
+func newProvisionController(
+	logger klog.Logger,
+	client kubernetes.Interface,
+	provisionerName string,
+	provisioner Provisioner,
+	options []func(*ProvisionController) error,
+) (*ProvisionController, error) {
+	var errs []error
+	if provisionerName == "" {
+		errs = append(errs, errors.New("provisioner name must not be empty"))
+	}
+	if client == nil {
+		errs = append(errs, errors.New("client must not be nil"))
+	}
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	id, err := os.Hostname()
+	if err != nil {
+		return nil, fmt.Errorf("error getting hostname: %w", err)
+	}
+	// add a uniquifier so that two processes on the same host don't accidentally both become active
+	id = id + "_" + string(uuid.NewUUID())
+
+	controller := newDefaultProvisionController(logger, client, provisionerName, provisioner, id)
+	if err := controller.applyOptions(options); err != nil {
+		errs = append(errs, fmt.Errorf("invalid controller options: %w", err))
+	}
+	if controller.honorReclaimPolicy {
+		controller.addFinalizer = true
+	}
+	if !controller.legacyProvisionerName {
+		if err := ValidateProvisionerName(provisionerName); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	if controller.keptAnnotations != nil {
+		controller.keptAnnotations.Insert(controller.provisionedByAnnotation)
+	}
+	if controller.objectClient == nil {
+		controller.objectClient = client
+	}
+	if !controller.customMetrics {
+		controller.metrics = metrics.New(controller.metricsSubsystem)
+	}
+
+	if !controller.customEventRecorder {
+		// TODO: Once the following PR is merged, change to use StartLogging and StartRecordingToSinkWithContext
+		// https://github.com/kubernetes/kubernetes/pull/120729
+		// scheme.Scheme registers core/v1 itself, registering it again here
+		// would race with the informers of other controllers.
+		broadcaster := record.NewBroadcaster(record.WithCorrelatorOptions(record.CorrelatorOptions{
+			MaxIntervalInSeconds: int(controller.eventAggregationWindow / time.Second),
+			SpamKeyFunc:          eventSpamKey,
+		}))
+		broadcaster.StartStructuredLogging(0)
+		broadcaster.StartRecordingToSink(&corev1.EventSinkImpl{Interface: client.CoreV1().Events(v1.NamespaceAll)})
+		controller.eventRecorder = broadcaster.NewRecorder(scheme.Scheme, v1.EventSource{Component: controller.eventComponent, Host: id})
+	} else if recorder, ok := controller.eventRecorder.(ComponentEventRecorder); ok {
+		controller.eventRecorder = recorder.WithComponent(controller.eventComponent)
+	}
+
+	controller.metrics.BuildInfo.With(controller.buildInfoLabels()).Set(1)
+	controller.metricsRegistry = prometheus.NewRegistry()
+	for _, collector := range controller.metrics.Collectors() {
+		if err := controller.metricsRegistry.Register(collector); err != nil {
+			logger.Error(err, "Error registering metrics collector for MetricsHandler")
+		}
+	}
+	if provider, ok := provisioner.(MetricsProvider); ok {
+		controller.provisionerCollectors = provider.Collectors()
+		for _, collector := range controller.provisionerCollectors {
+			if err := controller.metricsRegistry.Register(collector); err != nil {
+				return nil, fmt.Errorf("error registering metrics of the provisioner: %w", err)
+			}
 		}
 	}
 
@@ -678,41 +2790,159 @@ func NewProvisionController(
 			&workqueue.BucketRateLimiter{Limiter: rate.NewLimiter(rate.Limit(10), 100)},
 		)
 	}
-	controller.claimQueue = workqueue.NewNamedRateLimitingQueue(rateLimiter, "claims")
-	controller.volumeQueue = workqueue.NewNamedRateLimitingQueue(rateLimiter, "volumes")
+	claimRateLimiter, volumeRateLimiter := rateLimiter, rateLimiter
+	if controller.claimRateLimiter != nil {
+		claimRateLimiter = controller.claimRateLimiter
+	}
+	if controller.provisionRetryBackoff != nil || len(controller.classOverrides) > 0 {
+		controller.claimRetryBackoff = newRetryBackoff(controller.claimRetryBackoffFor, claimRateLimiter, controller.clock,
+			controller.metrics.PersistentVolumeClaimProvisionRetryFailures, controller.metrics.PersistentVolumeClaimProvisionNextRetryTimestampSeconds)
+		claimRateLimiter = controller.claimRetryBackoff
+	}
+	if controller.volumeRateLimiter != nil {
+		volumeRateLimiter = controller.volumeRateLimiter
+	}
+	controller.claimQueueLimiter, controller.volumeQueueLimiter = claimRateLimiter, volumeRateLimiter
+	queueClock := tickerClock(controller.clock)
+	if !controller.provisioningDisabled {
+		controller.claimQueue = newFairQueue(workqueue.NewRateLimitingQueueWithConfig(claimRateLimiter, workqueue.RateLimitingQueueConfig{Name: "claims", Clock: queueClock}),
+			controller.claimFairnessThreshold, controller.claimCreationTime)
+	}
+	if !controller.deletionDisabled {
+		controller.volumeQueue = workqueue.NewRateLimitingQueueWithConfig(volumeRateLimiter, workqueue.RateLimitingQueueConfig{Name: "volumes", Clock: queueClock})
+	}
+
+	if controller.maxInFlightOperations > 0 {
+		controller.inFlight = newInFlightLimiter(controller.maxInFlightOperations, controller.metrics.InFlightOperations)
+		controller.inFlight.now = controller.clock.Now
+	}
+	if controller.classFailures != nil {
+		controller.classFailures.now = controller.clock.Now
+	}
+	if controller.perNodeConcurrency > 0 {
+		controller.nodeInFlight = newNodeInFlightLimiter(controller.perNodeConcurrency, controller.metrics.PersistentVolumeClaimProvisionInFlightPerNode)
+	}
+	if controller.initialSyncBurstLimit > 0 {
+		controller.initialSync = newInitialSyncLimiter(controller.initialSyncBurstLimit, controller.clock)
+	}
 
-	informer := informers.NewSharedInformerFactory(client, controller.resyncPeriod)
+	claimResyncPeriod := controller.informerResyncPeriod(controller.claimResyncPeriod)
+	volumeResyncPeriod := controller.informerResyncPeriod(controller.volumeResyncPeriod)
+	informer := informers.NewSharedInformerFactoryWithOptions(controller.objectClient, controller.resyncPeriod,
+		informers.WithCustomResyncConfig(map[metav1.Object]time.Duration{
+			&v1.PersistentVolumeClaim{}: claimResyncPeriod,
+			&v1.PersistentVolume{}:      volumeResyncPeriod,
+			&storage.StorageClass{}:     controller.informerResyncPeriod(controller.classResyncPeriod),
+		}))
 
 	// ----------------------
 	// PersistentVolumeClaims
 
-	claimHandler := cache.ResourceEventHandlerFuncs{
-		AddFunc:    func(obj interface{}) { controller.enqueueClaim(obj) },
-		UpdateFunc: func(oldObj, newObj interface{}) { controller.enqueueClaim(newObj) },
+	claimHandler := cache.ResourceEventHandlerDetailedFuncs{
+		AddFunc: func(obj interface{}, isInInitialList bool) {
+			if isInInitialList && controller.initialSync != nil {
+				controller.enqueueInitialClaim(obj)
+				return
+			}
+			controller.enqueueClaim(obj)
+		},
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			controller.resetClaimFailures(oldObj, newObj)
+			if controller.initialClaimWaiting(oldObj, newObj) || controller.ownAnnotationUpdate(oldObj, newObj) ||
+				controller.deferClaimUpdate(oldObj, newObj) {
+				return
+			}
+			controller.enqueueClaim(newObj)
+		},
 		DeleteFunc: func(obj interface{}) {
-			// NOOP. The claim is either in claimsInProgress and in the queue, so it will be processed as usual
+			// The claim is either in claimsInProgress and in the queue, so it will be processed as usual
 			// or it's not in claimsInProgress and then we don't care
+			if uid, err := getObjectUID(obj); err == nil {
+				controller.forgetSkip(types.UID(uid))
+				controller.deniedDataSources.Delete(types.UID(uid))
+				controller.provisionWarnings.Delete(types.UID(uid))
+				controller.snapshotWaits.Delete(types.UID(uid))
+				controller.retryStateChecked.Delete(uid)
+				if controller.initialSync != nil {
+					controller.initialSync.forget(uid)
+				}
+			}
 		},
 	}
 
-	if controller.claimInformer != nil {
-		controller.claimInformer.AddEventHandlerWithResyncPeriod(claimHandler, controller.resyncPeriod)
-	} else {
-		controller.claimInformer = informer.Core().V1().PersistentVolumeClaims().Informer()
-		controller.claimInformer.AddEventHandler(claimHandler)
+	if factory := controller.informerFactory; factory != nil {
+		// Informers of the external factory are started by its owner.
+		if controller.claimInformer == nil && !controller.provisioningDisabled {
+			controller.claimInformer = factory.Core().V1().PersistentVolumeClaims().Informer()
+			controller.customClaimInformer = true
+		}
+		if controller.volumeInformer == nil && controller.volumeSelector == nil && controller.volumeMetadataClient == nil && !controller.deletionDisabled {
+			controller.volumeInformer = factory.Core().V1().PersistentVolumes().Informer()
+			controller.customVolumeInformer = true
+		}
+		if controller.classInformer == nil {
+			controller.classInformer = factory.Storage().V1().StorageClasses().Informer()
+			controller.customClassInformer = true
+		}
 	}
-	err = controller.claimInformer.AddIndexers(cache.Indexers{uidIndex: func(obj interface{}) ([]string, error) {
-		uid, err := getObjectUID(obj)
-		if err != nil {
-			return nil, err
+
+	// The claim informer is not created at all when provisioning is disabled.
+	if !controller.provisioningDisabled {
+		if controller.claimInformer != nil {
+			controller.claimInformer.AddEventHandlerWithResyncPeriod(claimHandler, claimResyncPeriod)
+		} else {
+			controller.claimInformer = informer.Core().V1().PersistentVolumeClaims().Informer()
+			if err := controller.setTransform(controller.claimInformer); err != nil {
+				return nil, err
+			}
+			controller.claimInformer.AddEventHandler(claimHandler)
 		}
-		return []string{uid}, nil
-	}})
-	if err != nil {
-		logger.Error(err, "Error setting indexer for pvc informer", "indexer", uidIndex)
-		klog.FlushAndExit(klog.ExitFlushTimeout, 1)
+		claimIndexers := cache.Indexers{
+			uidIndex: func(obj interface{}) ([]string, error) {
+				uid, err := getObjectUID(obj)
+				if err != nil {
+					return nil, err
+				}
+				return []string{uid}, nil
+			},
+			ClaimClassIndex: func(obj interface{}) ([]string, error) {
+				claim, ok := obj.(*v1.PersistentVolumeClaim)
+				if !ok {
+					return nil, nil
+				}
+				return []string{util.GetPersistentVolumeClaimClass(claim)}, nil
+			},
+			ClaimSelectedNodeIndex: func(obj interface{}) ([]string, error) {
+				claim, ok := obj.(*v1.PersistentVolumeClaim)
+				if !ok {
+					return nil, nil
+				}
+				if node, ok := getString(claim.Annotations, AnnSelectedNode, AnnAlphaSelectedNode); ok {
+					return []string{node}, nil
+				}
+				return nil, nil
+			},
+		}
+		if controller.volumeMetadataClient != nil {
+			claimIndexers[claimVolumeIndex] = func(obj interface{}) ([]string, error) {
+				claim, ok := obj.(*v1.PersistentVolumeClaim)
+				if !ok || claim.Spec.VolumeName == "" {
+					return nil, nil
+				}
+				return []string{claim.Spec.VolumeName}, nil
+			}
+		}
+		for name, indexFunc := range claimIndexers {
+			// A shared informer may already have the index from another controller.
+			if _, exists := controller.claimInformer.GetIndexer().GetIndexers()[name]; exists {
+				continue
+			}
+			if err = controller.claimInformer.AddIndexers(cache.Indexers{name: indexFunc}); err != nil {
+				return nil, fmt.Errorf("error setting indexer %s for pvc informer: %w", name, err)
+			}
+		}
+		controller.claimsIndexer = controller.claimInformer.GetIndexer()
 	}
-	controller.claimsIndexer = controller.claimInformer.GetIndexer()
 
 	// -----------------
 	// PersistentVolumes
@@ -723,26 +2953,101 @@ func NewProvisionController(
 		DeleteFunc: func(obj interface{}) { controller.forgetVolume(obj) },
 	}
 
-	if controller.volumeInformer != nil {
-		controller.volumeInformer.AddEventHandlerWithResyncPeriod(volumeHandler, controller.resyncPeriod)
-	} else {
-		controller.volumeInformer = informer.Core().V1().PersistentVolumes().Informer()
-		controller.volumeInformer.AddEventHandler(volumeHandler)
+	// The volume informer is not created at all when deletion is disabled.
+	if !controller.deletionDisabled {
+		if controller.volumeInformer != nil {
+			controller.volumeInformer.AddEventHandlerWithResyncPeriod(volumeHandler, volumeResyncPeriod)
+		} else {
+			volumeInformers := informer
+			if controller.volumeSelector != nil {
+				selector := controller.volumeSelector.String()
+				volumeInformers = informers.NewSharedInformerFactoryWithOptions(controller.objectClient, volumeResyncPeriod,
+					informers.WithTweakListOptions(func(options *metav1.ListOptions) {
+						options.LabelSelector = selector
+					}))
+			}
+			if controller.volumeMetadataClient != nil {
+				controller.volumeInformer = controller.newVolumeMetadataInformer(volumeResyncPeriod)
+			} else {
+				controller.volumeInformer = volumeInformers.Core().V1().PersistentVolumes().Informer()
+			}
+			if err := controller.setTransform(controller.volumeInformer); err != nil {
+				return nil, err
+			}
+			controller.volumeInformer.AddEventHandler(volumeHandler)
+		}
+		controller.volumes = controller.volumeInformer.GetStore()
 	}
-	controller.volumes = controller.volumeInformer.GetStore()
 
 	// --------------
 	// StorageClasses
 
-	// no resource event handler needed for StorageClasses
+	classHandler := cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			controller.enqueueClaimsOfClass(obj)
+			if controller.validateTopologyKeys {
+				controller.checkClassTopologyKeys(obj)
+			}
+		},
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			// Skip resyncs, they would reset the failure counters of the claims.
+			if oldClass, err := meta.Accessor(oldObj); err == nil {
+				if newClass, err := meta.Accessor(newObj); err == nil && oldClass.GetResourceVersion() == newClass.GetResourceVersion() {
+					return
+				}
+			}
+			controller.enqueueClaimsOfClass(newObj)
+			if controller.validateTopologyKeys {
+				controller.checkClassTopologyKeys(newObj)
+			}
+		},
+	}
+
 	if controller.classInformer == nil {
 		controller.classInformer = informer.Storage().V1().StorageClasses().Informer()
 	}
+	if !controller.provisioningDisabled {
+		controller.classInformer.AddEventHandler(classHandler)
+	}
 	controller.classes = controller.classInformer.GetStore()
 
-	if controller.createProvisionerPVLimiter != nil {
+	if controller.storageCapacityTracking && !controller.provisioningDisabled {
+		capacityFactory := informer
+		if controller.informerFactory != nil {
+			capacityFactory = controller.informerFactory
+			controller.customCapacityInformer = true
+		}
+		if controller.capacityInformer, err = newCapacityInformer(capacityFactory); err != nil {
+			return nil, fmt.Errorf("error setting indexer for CSIStorageCapacity informer: %w", err)
+		}
+	}
+	if controller.resolveConsumerPod && !controller.provisioningDisabled {
+		podFactory := informer
+		if controller.informerFactory != nil {
+			podFactory = controller.informerFactory
+			controller.customPodInformer = true
+		}
+		if controller.podInformer, err = newPodInformer(podFactory); err != nil {
+			return nil, fmt.Errorf("error setting indexer for pod informer: %w", err)
+		}
+	}
+
+	if controller.pvWriteClient == nil {
+		controller.pvWriteClient = controller.objectClient
+	}
+	controller.volumeApplier = controller.pvWriteClient.CoreV1().PersistentVolumes()
+	if controller.volumeStore != nil {
+		logger.V(2).Info("Using custom saving PVs to API server")
+		if store, ok := controller.volumeStore.(VolumeStoreWithHooks); ok {
+			store.SetHooks(controller.volumeStoreHooks())
+		}
+	} else if controller.createProvisionerPVLimiter != nil {
 		logger.V(2).Info("Using saving PVs to API server in background")
-		controller.volumeStore = NewVolumeStoreQueue(client, controller.createProvisionerPVLimiter, controller.claimsIndexer, controller.eventRecorder)
+		store := newVolumeStoreQueue(controller.pvWriteClient, controller.createProvisionerPVLimiter, controller.claimsIndexer, controller.event, &controller.metrics, controller.pendingSaveWarningAge, &controller.provisionStartTimes, controller.clock)
+		if controller.serverSideApply {
+			store.create = controller.createVolumeWithApply
+		}
+		controller.volumeStore = store
 	} else {
 		if controller.createProvisionedPVBackoff == nil {
 			// Use linear backoff with createProvisionedPVInterval and createProvisionedPVRetryCount by default.
@@ -760,10 +3065,144 @@ func NewProvisionController(
 			}
 		}
 		logger.V(2).Info("Using blocking saving PVs to API server")
-		controller.volumeStore = NewBackoffStore(client, controller.eventRecorder, controller.createProvisionedPVBackoff, controller)
+		controller.volumeStore = newBackoffStore(controller.pvWriteClient, controller.event, controller.createProvisionedPVBackoff, controller)
 	}
 
-	return controller
+	return controller, nil
+}
+
+// validateOptions checks that the options given to NewProvisionController can
+// be used together. It returns all conflicts found.
+func (ctrl *ProvisionController) validateOptions() error {
+	var errs []error
+	if ctrl.enableProfiling && (ctrl.metricsPort <= 0 || !ctrl.metricsServer) {
+		errs = append(errs, fmt.Errorf("EnableProfiling requires the built-in metrics server, set MetricsPort and MetricsServer(true)"))
+	}
+	if ctrl.enableDebugEndpoints && (ctrl.metricsPort <= 0 || !ctrl.metricsServer) {
+		errs = append(errs, fmt.Errorf("EnableDebugEndpoints requires the built-in metrics server, set MetricsPort and MetricsServer(true)"))
+	}
+	if ctrl.claimRateLimiter != nil {
+		if ctrl.provisionRetryBackoff != nil {
+			errs = append(errs, fmt.Errorf("ProvisionRetryBackoff cannot be used together with ClaimQueueRateLimiter"))
+		}
+		for class, policy := range ctrl.classOverrides {
+			if policy.ProvisionRetryBackoff != nil {
+				errs = append(errs, fmt.Errorf("ProvisionRetryBackoff of class %q cannot be used together with ClaimQueueRateLimiter", class))
+			}
+		}
+	}
+	if ctrl.persistRetryState {
+		backoff := ctrl.provisionRetryBackoff != nil
+		for _, policy := range ctrl.classOverrides {
+			backoff = backoff || policy.ProvisionRetryBackoff != nil
+		}
+		if !backoff {
+			errs = append(errs, fmt.Errorf("PersistRetryState requires ProvisionRetryBackoff"))
+		}
+	}
+	if ctrl.customMetrics && ctrl.metricsSubsystem != controllerSubsystem {
+		errs = append(errs, fmt.Errorf("MetricsSubsystem cannot be used together with MetricsInstance"))
+	}
+	if !metricsSubsystemRegexp.MatchString(ctrl.metricsSubsystem) {
+		errs = append(errs, fmt.Errorf("invalid MetricsSubsystem %q: must match %s", ctrl.metricsSubsystem, metricsSubsystemRegexp))
+	}
+	if ctrl.volumeSelector != nil && ctrl.volumeInformer != nil {
+		errs = append(errs, fmt.Errorf("VolumeListWatchLabelSelector cannot be used together with VolumesInformer"))
+	}
+	if ctrl.pvSaveFailurePolicy != DefaultPVSaveFailurePolicy && (ctrl.createProvisionerPVLimiter != nil || ctrl.volumeStore != nil) {
+		errs = append(errs, fmt.Errorf("OnPVSaveFailure cannot be used together with CreateProvisionedPVLimiter or WithVolumeStore"))
+	}
+	if ctrl.volumeStore != nil && (ctrl.createProvisionerPVLimiter != nil || ctrl.createProvisionedPVBackoff != nil ||
+		ctrl.createProvisionedPVInterval != 0 || ctrl.createProvisionedPVRetryCount != 0) {
+		errs = append(errs, fmt.Errorf("WithVolumeStore cannot be used together with CreateProvisionedPV* options"))
+	}
+	if ctrl.resolveSnapshots && ctrl.dynamicClient == nil {
+		errs = append(errs, fmt.Errorf("ResolveSnapshotDataSource requires DynamicClient"))
+	}
+	if ctrl.crossNamespaceSources && ctrl.dynamicClient == nil {
+		errs = append(errs, fmt.Errorf("CrossNamespaceDataSources requires DynamicClient"))
+	}
+	if ctrl.deletionDisabled && ctrl.provisioningDisabled {
+		errs = append(errs, fmt.Errorf("DeletionDisabled cannot be used together with ProvisioningDisabled"))
+	}
+	if ctrl.volumeMetadataClient != nil && (ctrl.volumeInformer != nil || ctrl.deletionDisabled) {
+		errs = append(errs, fmt.Errorf("VolumeMetadataClient cannot be used together with VolumesInformer or DeletionDisabled"))
+	}
+	if ctrl.deletionDisabled && ctrl.volumeInformer != nil {
+		errs = append(errs, fmt.Errorf("DeletionDisabled cannot be used together with VolumesInformer"))
+	}
+	if ctrl.driftAuditInterval > 0 && (ctrl.deletionDisabled || ctrl.volumeMetadataClient != nil) {
+		errs = append(errs, fmt.Errorf("VolumeDriftAuditInterval cannot be used together with DeletionDisabled or VolumeMetadataClient"))
+	}
+	if ctrl.provisioningDisabled && ctrl.claimInformer != nil {
+		errs = append(errs, fmt.Errorf("ProvisioningDisabled cannot be used together with ClaimsInformer"))
+	}
+	if ctrl.deletionDisabled && ctrl.failedDeleteThreshold != DefaultFailedDeleteThreshold {
+		errs = append(errs, fmt.Errorf("FailedDeleteThreshold cannot be used together with DeletionDisabled"))
+	}
+	if ctrl.deletionDisabled && ctrl.volumeRateLimiter != nil {
+		errs = append(errs, fmt.Errorf("VolumeQueueRateLimiter cannot be used together with DeletionDisabled"))
+	}
+	if ctrl.provisioningDisabled && ctrl.failedProvisionThreshold != DefaultFailedProvisionThreshold {
+		errs = append(errs, fmt.Errorf("FailedProvisionThreshold cannot be used together with ProvisioningDisabled"))
+	}
+	if ctrl.provisioningDisabled && ctrl.claimRateLimiter != nil {
+		errs = append(errs, fmt.Errorf("ClaimQueueRateLimiter cannot be used together with ProvisioningDisabled"))
+	}
+	if !ctrl.metricsServer && (ctrl.metricsCertFile != "" || ctrl.metricsKeyFile != "" || ctrl.metricsClientCAFile != "") {
+		errs = append(errs, fmt.Errorf("MetricsCertFile, MetricsKeyFile and MetricsClientCAFile cannot be used together with MetricsServer(false)"))
+	}
+	_, componentRecorder := ctrl.eventRecorder.(ComponentEventRecorder)
+	if ctrl.customEventRecorder && !componentRecorder && ctrl.customEventComponent {
+		errs = append(errs, fmt.Errorf("EventComponent cannot be used together with WithEventRecorder of a recorder that does not implement ComponentEventRecorder"))
+	}
+	if (!ctrl.customEventRecorder || componentRecorder) && ctrl.eventComponent == "" {
+		errs = append(errs, fmt.Errorf("EventComponent must not be empty"))
+	}
+	if !ctrl.customEventRecorder && ctrl.eventAggregationWindow < time.Second {
+		errs = append(errs, fmt.Errorf("invalid EventAggregationWindow %v: must be at least 1s", ctrl.eventAggregationWindow))
+	}
+	return errors.Join(errs...)
+}
+
+// setTransform installs transformObject on an internal informer.
+func (ctrl *ProvisionController) setTransform(informer cache.SharedInformer) error {
+	if err := informer.SetTransform(ctrl.transformObject); err != nil {
+		return fmt.Errorf("error setting transform of informer: %w", err)
+	}
+	return nil
+}
+
+// informerResyncPeriod returns the resync period of an informer, period if
+// set by its option or resyncPeriod otherwise.
+func (ctrl *ProvisionController) informerResyncPeriod(period *time.Duration) time.Duration {
+	if period != nil {
+		return *period
+	}
+	return ctrl.resyncPeriod
+}
+
+// buildInfoLabels returns labels of the build info metric. Only options that
+// are safe to expose are included.
+func (ctrl *ProvisionController) buildInfoLabels() prometheus.Labels {
+	return prometheus.Labels{
+		"provisioner":                  ctrl.provisionerName,
+		"library_version":              LibraryVersion,
+		"leader_election":              strconv.FormatBool(ctrl.leaderElection),
+		"provision_threadiness":        strconv.Itoa(ctrl.provisionThreadiness),
+		"deletion_threadiness":         strconv.Itoa(ctrl.deletionThreadiness),
+		"resync_period":                ctrl.resyncPeriod.String(),
+		"exponential_backoff_on_error": strconv.FormatBool(ctrl.exponentialBackOffOnError),
+		"failed_provision_threshold":   strconv.Itoa(ctrl.failedProvisionThreshold),
+		"failed_delete_threshold":      strconv.Itoa(ctrl.failedDeleteThreshold),
+		"add_finalizer":                strconv.FormatBool(ctrl.addFinalizer),
+		"deletion_disabled":            strconv.FormatBool(ctrl.deletionDisabled),
+		"provisioning_disabled":        strconv.FormatBool(ctrl.provisioningDisabled),
+		"client_qps":                   strconv.FormatFloat(float64(ctrl.clientQPS), 'g', -1, 32),
+		"client_burst":                 strconv.Itoa(ctrl.clientBurst),
+		"user_agent":                   ctrl.userAgent,
+		"features":                     ctrl.Features().String(),
+	}
 }
 
 func getObjectUID(obj interface{}) (string, error) {
@@ -792,6 +3231,34 @@ func (ctrl *ProvisionController) enqueueClaim(obj interface{}) {
 	ctrl.claimQueue.Add(uid)
 }
 
+// enqueueClaimsOfClass enqueues pending claims of a StorageClass of this
+// provisioner and resets their failure counters, so that claims created
+// before their class are provisioned without waiting for resync.
+func (ctrl *ProvisionController) enqueueClaimsOfClass(obj interface{}) {
+	class, err := toStorageClass(obj)
+	if err != nil {
+		utilruntime.HandleError(err)
+		return
+	}
+	if !ctrl.knownClaimProvisioner(class.Provisioner) {
+		return
+	}
+	objs, err := ctrl.claimsIndexer.ByIndex(ClaimClassIndex, class.Name)
+	if err != nil {
+		utilruntime.HandleError(err)
+		return
+	}
+	for _, obj := range objs {
+		claim, ok := obj.(*v1.PersistentVolumeClaim)
+		if !ok || claim.Spec.VolumeName != "" {
+			continue
+		}
+		uid := string(claim.UID)
+		ctrl.claimQueue.Forget(uid)
+		ctrl.claimQueue.Add(uid)
+	}
+}
+
 // enqueueVolume takes an obj and converts it into a namespace/name string which
 // is then put onto the given work queue.
 func (ctrl *ProvisionController) enqueueVolume(obj interface{}) {
@@ -815,67 +3282,176 @@ func (ctrl *ProvisionController) forgetVolume(obj interface{}) {
 	}
 	ctrl.volumeQueue.Forget(key)
 	ctrl.volumeQueue.Done(key)
+	// The key of a PV is its name.
+	ctrl.backendDeleted.Delete(key)
 }
 
-// Run starts all of this controller's control loops
-func (ctrl *ProvisionController) Run(ctx context.Context) {
-	run := func(ctx context.Context) {
+// Run starts all of this controller's control loops. The controller logs
+// with the logger of ctx or, if ctx has none, with the logger passed to
+// NewProvisionController. When ctx is done, Run drains the work in progress,
+// see ShutdownGracePeriod, and returns an error if some had to be abandoned.
+// Run returns an error when it cannot start, e.g. when the metrics cannot be
+// registered or the informer caches do not sync within CacheSyncTimeout.
+// With LeaderElection, a leader that fails to start stops renewing its lease.
+// Losing the leader election still exits the process.
+// A controller can be Run only once, Run returns an error when it is called
+// again. Stop stops it like cancelling ctx does, Stopped is closed when Run
+// returned and the goroutines it started, including the metrics server,
+// have finished.
+func (ctrl *ProvisionController) Run(ctx context.Context) error {
+	ctx, err := ctrl.startRun(ctx)
+	if err != nil {
+		return err
+	}
+	defer ctrl.finishRun()
+	if _, err := logr.FromContext(ctx); err != nil {
+		ctx = klog.NewContext(ctx, ctrl.logger)
+	}
+	// Work in progress outlives ctx by up to ShutdownGracePeriod.
+	workCtx, cancelWork := context.WithCancel(context.WithoutCancel(ctx))
+	defer cancelWork()
+	run := func(ctx context.Context) error {
 		logger := klog.FromContext(ctx)
-		logger.Info("Starting provisioner controller", "component", ctrl.component)
+		logger.Info("Starting provisioner controller", "component", ctrl.component, "features", ctrl.Features().String())
+		logger.Info("Required permissions", "permissions", ctrl.requiredPermissions())
 		defer utilruntime.HandleCrash()
-		defer ctrl.claimQueue.ShutDown()
-		defer ctrl.volumeQueue.ShutDown()
+		if ctrl.claimQueue != nil {
+			defer ctrl.claimQueue.ShutDown()
+		}
+		if ctrl.volumeQueue != nil {
+			defer ctrl.volumeQueue.ShutDown()
+		}
+
+		ctrl.hasRunLock.Lock()
+		ctrl.hasRun = true
+		ctrl.hasRunLock.Unlock()
+		if ctrl.metricsPort > 0 && ctrl.metricsServer {
+			for _, collector := range append(ctrl.metrics.Collectors(), ctrl.provisionerCollectors...) {
+				if err := prometheus.Register(collector); err != nil {
+					return fmt.Errorf("error registering metrics: %w", err)
+				}
+			}
+			address := net.JoinHostPort(ctrl.metricsAddress, strconv.FormatInt(int64(ctrl.metricsPort), 10))
+			tlsConfig, err := ctrl.metricsTLSConfig(ctx)
+			if err != nil {
+				return fmt.Errorf("error configuring TLS for metrics server: %w", err)
+			}
+			server := &http.Server{Addr: address, Handler: ctrl.metricsMux(), TLSConfig: tlsConfig}
+			logger.Info("Starting metrics server", "address", address, "tls", tlsConfig != nil)
+			// The metrics server serves until the work is drained.
+			ctrl.goBackground(func() {
+				<-workCtx.Done()
+				server.Close()
+			})
+			ctrl.goBackground(func() {
+				untilWithClock(workCtx, ctrl.clock, func(context.Context) {
+					var err error
+					if tlsConfig != nil {
+						err = server.ListenAndServeTLS("", "")
+					} else {
+						err = server.ListenAndServe()
+					}
+					if err != nil && !errors.Is(err, http.ErrServerClosed) {
+						logger.Error(err, "Failed to listen metrics server", "address", address)
+					}
+				}, 5*time.Second)
+			})
+		}
 
-		ctrl.hasRunLock.Lock()
-		ctrl.hasRun = true
-		ctrl.hasRunLock.Unlock()
-		if ctrl.metricsPort > 0 {
-			prometheus.MustRegister([]prometheus.Collector{
-				ctrl.metrics.PersistentVolumeClaimProvisionTotal,
-				ctrl.metrics.PersistentVolumeClaimProvisionFailedTotal,
-				ctrl.metrics.PersistentVolumeClaimProvisionDurationSeconds,
-				ctrl.metrics.PersistentVolumeDeleteTotal,
-				ctrl.metrics.PersistentVolumeDeleteFailedTotal,
-				ctrl.metrics.PersistentVolumeDeleteDurationSeconds,
-			}...)
-			http.Handle(ctrl.metricsPath, promhttp.Handler())
-			address := net.JoinHostPort(ctrl.metricsAddress, strconv.FormatInt(int64(ctrl.metricsPort), 10))
-			logger.Info("Starting metrics server", "address", address)
-			go wait.Forever(func() {
-				err := http.ListenAndServe(address, nil)
-				if err != nil {
-					logger.Error(err, "Failed to listen metrics server", "address", address)
-				}
-			}, 5*time.Second)
+		startDelay := ctrl.startupDelay()
+		workersStart := ctrl.clock.Now().Add(startDelay)
+		if ctrl.initialSync != nil {
+			ctrl.initialSync.startAt(workersStart)
 		}
 
 		// If a external SharedInformer has been passed in, this controller
 		// should not call Run again
-		if !ctrl.customClaimInformer {
-			go ctrl.claimInformer.Run(ctx.Done())
+		if ctrl.claimInformer != nil && !ctrl.customClaimInformer {
+			ctrl.goBackground(func() { ctrl.claimInformer.Run(ctx.Done()) })
 		}
-		if !ctrl.customVolumeInformer {
-			go ctrl.volumeInformer.Run(ctx.Done())
+		if ctrl.volumeInformer != nil && !ctrl.customVolumeInformer {
+			ctrl.goBackground(func() { ctrl.volumeInformer.Run(ctx.Done()) })
 		}
-		if !ctrl.customClassInformer {
-			go ctrl.classInformer.Run(ctx.Done())
+		ctrl.startClassInformer(ctx)
+		if ctrl.capacityInformer != nil && !ctrl.customCapacityInformer {
+			ctrl.goBackground(func() { ctrl.capacityInformer.Run(ctx.Done()) })
 		}
+		if ctrl.podInformer != nil && !ctrl.customPodInformer {
+			ctrl.goBackground(func() { ctrl.podInformer.Run(ctx.Done()) })
+		}
+		ctrl.startNodeInformer(ctx.Done())
 
-		if !cache.WaitForCacheSync(ctx.Done(), ctrl.claimInformer.HasSynced, ctrl.volumeInformer.HasSynced, ctrl.classInformer.HasSynced) {
-			return
+		if err := ctrl.waitForCacheSync(ctx); err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			logger.Error(err, "Failed to sync informer caches", "requiredPermissions", ctrl.requiredPermissions())
+			return fmt.Errorf("failed to sync informer caches: %w", err)
+		}
+		if err := ctrl.validateInformers(); err != nil {
+			return fmt.Errorf("invalid informer: %w", err)
+		}
+		if initializer, ok := ctrl.provisioner.(Initializer); ok {
+			if err := initializer.Init(ctx, ctrl); err != nil {
+				return fmt.Errorf("failed to initialize provisioner: %w", err)
+			}
+		}
+		if notifier, ok := ctrl.provisioner.(ShutdownNotifier); ok {
+			defer ctrl.notifyShutdown(logger, notifier)
+		}
+		ctrl.setState(func() { ctrl.cachesSynced = true })
+
+		if ctrl.validateTopologyKeys && !ctrl.provisioningDisabled {
+			ctrl.goBackground(func() {
+				ctrl.waitForNodes(ctx)
+				untilWithClock(ctx, ctrl.clock, ctrl.checkTopologyKeys, topologyKeyCheckInterval)
+			})
+		}
+		if ctrl.driftAuditInterval > 0 {
+			ctrl.goBackground(func() { untilWithClock(ctx, ctrl.clock, ctrl.auditVolumes, ctrl.driftAuditInterval) })
+		}
+
+		if startDelay > 0 {
+			logger.Info("Delaying start of workers", "delay", startDelay)
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-ctrl.clock.After(workersStart.Sub(ctrl.clock.Now())):
+			}
 		}
 
-		for i := 0; i < ctrl.threadiness; i++ {
-			go wait.Until(func() { ctrl.runClaimWorker(ctx) }, time.Second, ctx.Done())
-			go wait.Until(func() { ctrl.runVolumeWorker(ctx) }, time.Second, ctx.Done())
+		var workers sync.WaitGroup
+		startWorkers := func(threadiness int, worker func(context.Context)) {
+			for i := 0; i < threadiness; i++ {
+				workers.Add(1)
+				go func() {
+					defer workers.Done()
+					untilWithClock(ctx, ctrl.clock, func(context.Context) { worker(workCtx) }, time.Second)
+				}()
+			}
+		}
+		if ctrl.claimQueue != nil {
+			startWorkers(ctrl.provisionThreadiness, ctrl.runClaimWorker)
+		}
+		if ctrl.volumeQueue != nil {
+			startWorkers(ctrl.deletionThreadiness, ctrl.runVolumeWorker)
 		}
 
 		logger.Info("Started provisioner controller", "component", ctrl.component)
 
 		<-ctx.Done()
+		// Let the workers of both queues finish their current items.
+		if ctrl.claimQueue != nil {
+			ctrl.claimQueue.ShutDown()
+		}
+		if ctrl.volumeQueue != nil {
+			ctrl.volumeQueue.ShutDown()
+		}
+		ctrl.stopPausedWorkers()
+		return ctrl.drain(logger, &workers, cancelWork)
 	}
 
-	go ctrl.volumeStore.Run(ctx, DefaultThreadiness)
+	ctrl.goBackground(func() { ctrl.volumeStore.Run(workCtx, DefaultThreadiness) })
 
 	logger := klog.FromContext(ctx)
 	if ctrl.leaderElection {
@@ -889,27 +3465,156 @@ func (ctrl *ProvisionController) Run(ctx context.Context) {
 				EventRecorder: ctrl.eventRecorder,
 			})
 		if err != nil {
-			logger.Error(err, "Error creating lock")
-			klog.FlushAndExit(klog.ExitFlushTimeout, 1)
+			return fmt.Errorf("error creating lock: %w", err)
 		}
 
-		leaderelection.RunOrDie(ctx, leaderelection.LeaderElectionConfig{
-			Lock:          rl,
+		// Leader election runs run in a goroutine, its result is passed here.
+		electionCtx, stopElection := context.WithCancel(ctx)
+		defer stopElection()
+		var led atomic.Bool
+		runErr := make(chan error, 1)
+		lock := &observedLock{Interface: rl, observed: func() {
+			ctrl.setState(func() { ctrl.joinedElection = true })
+		}}
+		elector, err := leaderelection.NewLeaderElector(leaderelection.LeaderElectionConfig{
+			Lock:          lock,
 			LeaseDuration: ctrl.leaseDuration,
 			RenewDeadline: ctrl.renewDeadline,
 			RetryPeriod:   ctrl.retryPeriod,
 			Callbacks: leaderelection.LeaderCallbacks{
-				OnStartedLeading: run,
+				OnStartedLeading: func(ctx context.Context) {
+					led.Store(true)
+					ctrl.setState(func() { ctrl.leading = true })
+					err := run(ctx)
+					if err != nil && ctx.Err() == nil {
+						// run could not start, stop renewing the lease
+						// so that another instance takes over.
+						stopElection()
+					}
+					runErr <- err
+				},
 				OnStoppedLeading: func() {
+					ctrl.setState(func() { ctrl.leading = false })
+					if electionCtx.Err() != nil {
+						// Shutting down, run drains the work.
+						return
+					}
 					logger.Error(nil, "Leaderelection lost")
 					klog.FlushAndExit(klog.ExitFlushTimeout, 1)
 				},
 			},
 		})
-		panic("unreachable")
-	} else {
-		run(ctx)
+		if err != nil {
+			return fmt.Errorf("invalid leader election configuration: %w", err)
+		}
+		elector.Run(electionCtx)
+		if !led.Load() {
+			return nil
+		}
+		return <-runErr
+	}
+	return run(ctx)
+}
+
+// validateInformers checks that informers passed by ClaimsInformer,
+// VolumesInformer, ClassesInformer or SharedInformerFactory hold objects of
+// the expected type. Informers cannot be asked for their type, it is probed
+// on the objects in their stores, which must have synced already.
+func (ctrl *ProvisionController) validateInformers() error {
+	probe := func(name string, informer cache.SharedInformer, valid func(obj interface{}) bool) error {
+		for _, obj := range informer.GetStore().List() {
+			if !valid(obj) {
+				return fmt.Errorf("%s informer holds objects of unexpected type %T", name, obj)
+			}
+		}
+		return nil
+	}
+	if ctrl.customClaimInformer {
+		if err := probe("claims", ctrl.claimInformer, func(obj interface{}) bool {
+			_, ok := obj.(*v1.PersistentVolumeClaim)
+			return ok
+		}); err != nil {
+			return err
+		}
+	}
+	if ctrl.customVolumeInformer {
+		if err := probe("volumes", ctrl.volumeInformer, func(obj interface{}) bool {
+			_, ok := obj.(*v1.PersistentVolume)
+			return ok
+		}); err != nil {
+			return err
+		}
+	}
+	if ctrl.customClassInformer {
+		if err := probe("classes", ctrl.classInformer, func(obj interface{}) bool {
+			switch obj.(type) {
+			case *storage.StorageClass, *storagebeta.StorageClass:
+				return true
+			}
+			return false
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// metricsMux returns the handler of the built-in metrics server.
+func (ctrl *ProvisionController) metricsMux() *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.Handle(ctrl.metricsPath, promhttp.Handler())
+	ctrl.handleProfiling(mux)
+	if ctrl.enableDebugEndpoints {
+		mux.HandleFunc(pendingVolumesPath, ctrl.servePendingVolumes)
+	}
+	if ctrl.metricsPath != "/" {
+		// Handlers registered on http.DefaultServeMux by the binary are
+		// served too, like before the controller had its own mux.
+		mux.Handle("/", http.DefaultServeMux)
+	}
+	return mux
+}
+
+// metricsTLSConfig returns the TLS configuration of metrics server or nil when
+// metrics are served over plain HTTP. The serving certificate is watched for
+// changes until ctx is done.
+func (ctrl *ProvisionController) metricsTLSConfig(ctx context.Context) (*tls.Config, error) {
+	if ctrl.metricsCertFile == "" && ctrl.metricsKeyFile == "" {
+		if ctrl.metricsClientCAFile != "" {
+			return nil, fmt.Errorf("MetricsClientCAFile requires MetricsCertFile and MetricsKeyFile")
+		}
+		return nil, nil
+	}
+	if ctrl.metricsCertFile == "" || ctrl.metricsKeyFile == "" {
+		return nil, fmt.Errorf("MetricsCertFile and MetricsKeyFile must be used together")
+	}
+
+	watcher, err := newCertWatcher(ctrl.metricsCertFile, ctrl.metricsKeyFile)
+	if err != nil {
+		return nil, err
+	}
+	watcher.clock = ctrl.clock
+	tlsConfig := &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: watcher.GetCertificate,
+	}
+	if ctrl.metricsClientCAFile != "" {
+		clientCAs, err := loadClientCAs(ctrl.metricsClientCAFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.ClientCAs = clientCAs
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
 	}
+	ctrl.goBackground(func() { watcher.Run(ctx) })
+	return tlsConfig, nil
+}
+
+// setState runs update with stateLock held.
+func (ctrl *ProvisionController) setState(update func()) {
+	ctrl.stateLock.Lock()
+	defer ctrl.stateLock.Unlock()
+	update()
 }
 
 func (ctrl *ProvisionController) runClaimWorker(ctx context.Context) {
@@ -922,13 +3627,43 @@ func (ctrl *ProvisionController) runVolumeWorker(ctx context.Context) {
 	}
 }
 
+// addRateLimited requeues a failed obj after the delay of limiter, or after
+// RetryAfter of a RetryableError in err. The limiter records the failure
+// either way. Returns the delay.
+func (ctrl *ProvisionController) addRateLimited(logger klog.Logger, queue workqueue.RateLimitingInterface, limiter workqueue.RateLimiter, queueName string, obj interface{}, err error) time.Duration {
+	delay := limiter.When(obj)
+	if after := retryAfter(err); after > 0 {
+		logger.V(2).Info("Retrying after delay requested by provisioner", "key", obj, "delay", after)
+		ctrl.metrics.RetryAfterRequeuesTotal.WithLabelValues(queueName).Inc()
+		delay = after
+	}
+	queue.AddAfter(obj, delay)
+	return delay
+}
+
+// retryAfter returns RetryAfter of a RetryableError in the chain of err, zero
+// if there is none.
+func retryAfter(err error) time.Duration {
+	var rerr *RetryableError
+	if errors.As(err, &rerr) {
+		return rerr.RetryAfter
+	}
+	return 0
+}
+
 // processNextClaimWorkItem processes items from claimQueue
 func (ctrl *ProvisionController) processNextClaimWorkItem(ctx context.Context) bool {
+	ctrl.waitUntilResumed()
 	obj, shutdown := ctrl.claimQueue.Get()
 
 	if shutdown {
 		return false
 	}
+	if ctrl.claimQueue.ShuttingDown() {
+		// Run is draining, take no new work.
+		ctrl.claimQueue.Done(obj)
+		return false
+	}
 
 	logger := klog.FromContext(ctx)
 	err := func() error {
@@ -946,15 +3681,49 @@ func (ctrl *ProvisionController) processNextClaimWorkItem(ctx context.Context) b
 			return fmt.Errorf("expected string in workqueue but got %#v", obj)
 		}
 
+		if ctrl.claimQueue.NumRequeues(obj) == 0 {
+			if delay, restored := ctrl.restoreRetryState(key); restored {
+				if delay > 0 {
+					logger.V(2).Info("Continuing backoff of claim recorded before restart", "key", key, "failures", ctrl.claimQueue.NumRequeues(obj), "delay", delay)
+					ctrl.claimQueue.AddAfter(obj, delay)
+					return nil
+				}
+			} else {
+				// The failures have been reset or the controller restarted.
+				ctrl.clearGiveUp(ctx, key)
+			}
+		}
+
 		if err := ctrl.syncClaimHandler(ctx, key); err != nil {
-			if ctrl.failedProvisionThreshold == 0 {
+			if errors.Is(err, errInFlightLimit) || errors.Is(err, errNodeInFlightLimit) {
+				logger.V(4).Info("Too many operations in progress, postponing claim", "key", key, "reason", err)
+				ctrl.claimQueue.AddAfter(obj, wait.Jitter(ctrl.inFlightRetryDelay, 1))
+				return nil
+			}
+			if errors.Is(err, errNoStorageCapacity) {
+				logger.V(2).Info("Not enough storage capacity, postponing claim", "key", key, "delay", ctrl.storageCapacityRetryDelay)
+				ctrl.claimQueue.AddAfter(obj, wait.Jitter(ctrl.storageCapacityRetryDelay, 0.1))
+				return nil
+			}
+			if errors.Is(err, errSnapshotNotReady) {
+				logger.V(2).Info("Snapshot not ready, postponing claim", "key", key, "delay", ctrl.snapshotRetryDelay)
+				ctrl.claimQueue.AddAfter(obj, wait.Jitter(ctrl.snapshotRetryDelay, 0.1))
+				return nil
+			}
+			policy := ctrl.claimPolicy(key)
+			if policy.ProvisionRetryBackoff != nil {
+				delay := ctrl.addRateLimited(logger, ctrl.claimQueue, ctrl.claimQueueLimiter, "claims", obj, err)
+				logger.V(2).Info("Retrying syncing claim with backoff", "key", key, "failures", ctrl.claimRetryBackoff.NumRequeues(obj), "delay", delay, "nextRetry", ctrl.clock.Now().Add(delay))
+				ctrl.recordRetryState(ctx, key, ctrl.claimRetryBackoff.NumRequeues(obj))
+			} else if policy.FailedProvisionThreshold == 0 {
 				logger.Info("Retrying syncing claim", "key", key, "failures", ctrl.claimQueue.NumRequeues(obj))
-				ctrl.claimQueue.AddRateLimited(obj)
-			} else if ctrl.claimQueue.NumRequeues(obj) < ctrl.failedProvisionThreshold {
-				logger.Info("Retrying syncing claim because failures < threshold", "key", key, "failures", ctrl.claimQueue.NumRequeues(obj), "threshold", ctrl.failedProvisionThreshold)
-				ctrl.claimQueue.AddRateLimited(obj)
+				ctrl.addRateLimited(logger, ctrl.claimQueue, ctrl.claimQueueLimiter, "claims", obj, err)
+			} else if ctrl.claimQueue.NumRequeues(obj) < policy.FailedProvisionThreshold {
+				logger.Info("Retrying syncing claim because failures < threshold", "key", key, "failures", ctrl.claimQueue.NumRequeues(obj), "threshold", policy.FailedProvisionThreshold)
+				ctrl.addRateLimited(logger, ctrl.claimQueue, ctrl.claimQueueLimiter, "claims", obj, err)
 			} else {
-				logger.Error(nil, "Giving up syncing claim because failures >= threshold", "key", key, "failures", ctrl.claimQueue.NumRequeues(obj), "threshold", ctrl.failedProvisionThreshold)
+				logger.Error(nil, "Giving up syncing claim because failures >= threshold", "key", key, "failures", ctrl.claimQueue.NumRequeues(obj), "threshold", policy.FailedProvisionThreshold)
+				ctrl.recordGiveUp(ctx, key, ctrl.claimQueue.NumRequeues(obj), err)
 				logger.V(2).Info("Removing PVC from claims in progress", "key", key)
 				ctrl.claimsInProgress.Delete(key) // This can leak a volume that's being provisioned in the background!
 				// Done but do not Forget: it will not be in the queue but NumRequeues
@@ -964,6 +3733,9 @@ func (ctrl *ProvisionController) processNextClaimWorkItem(ctx context.Context) b
 		}
 
 		ctrl.claimQueue.Forget(obj)
+		if ctrl.persistRetryState {
+			ctrl.clearGiveUp(ctx, key)
+		}
 		// Silently remove the PVC from list of volumes in progress. The provisioning either succeeded
 		// or the PVC was ignored by this provisioner.
 		ctrl.claimsInProgress.Delete(key)
@@ -980,11 +3752,17 @@ func (ctrl *ProvisionController) processNextClaimWorkItem(ctx context.Context) b
 
 // processNextVolumeWorkItem processes items from volumeQueue
 func (ctrl *ProvisionController) processNextVolumeWorkItem(ctx context.Context) bool {
+	ctrl.waitUntilResumed()
 	obj, shutdown := ctrl.volumeQueue.Get()
 
 	if shutdown {
 		return false
 	}
+	if ctrl.volumeQueue.ShuttingDown() {
+		// Run is draining, take no new work.
+		ctrl.volumeQueue.Done(obj)
+		return false
+	}
 
 	logger := klog.FromContext(ctx)
 	err := func() error {
@@ -1003,14 +3781,20 @@ func (ctrl *ProvisionController) processNextVolumeWorkItem(ctx context.Context)
 		}
 
 		if err := ctrl.syncVolumeHandler(ctx, key); err != nil {
-			if ctrl.failedDeleteThreshold == 0 {
+			if errors.Is(err, errInFlightLimit) {
+				logger.V(4).Info("Too many operations in progress, postponing volume", "key", key)
+				ctrl.volumeQueue.AddAfter(obj, wait.Jitter(ctrl.inFlightRetryDelay, 1))
+				return nil
+			}
+			threshold := ctrl.volumePolicy(key).FailedDeleteThreshold
+			if threshold == 0 {
 				logger.Info("Retrying syncing volume", "key", key, "failures", ctrl.volumeQueue.NumRequeues(obj))
-				ctrl.volumeQueue.AddRateLimited(obj)
-			} else if ctrl.volumeQueue.NumRequeues(obj) < ctrl.failedDeleteThreshold {
-				logger.Info("Retrying syncing volume because failures < threshold", "key", key, "failures", ctrl.volumeQueue.NumRequeues(obj), "threshold", ctrl.failedDeleteThreshold)
-				ctrl.volumeQueue.AddRateLimited(obj)
+				ctrl.addRateLimited(logger, ctrl.volumeQueue, ctrl.volumeQueueLimiter, "volumes", obj, err)
+			} else if ctrl.volumeQueue.NumRequeues(obj) < threshold {
+				logger.Info("Retrying syncing volume because failures < threshold", "key", key, "failures", ctrl.volumeQueue.NumRequeues(obj), "threshold", threshold)
+				ctrl.addRateLimited(logger, ctrl.volumeQueue, ctrl.volumeQueueLimiter, "volumes", obj, err)
 			} else {
-				logger.Info("Giving up syncing volume because failures >= threshold", "key", key, "failures", ctrl.volumeQueue.NumRequeues(obj), "threshold", ctrl.failedDeleteThreshold)
+				logger.Info("Giving up syncing volume because failures >= threshold", "key", key, "failures", ctrl.volumeQueue.NumRequeues(obj), "threshold", threshold)
 				// Done but do not Forget: it will not be in the queue but NumRequeues
 				// will be saved until the obj is deleted from kubernetes
 			}
@@ -1049,6 +3833,19 @@ func (ctrl *ProvisionController) syncClaimHandler(ctx context.Context, key strin
 	return ctrl.syncClaim(ctx, claimObj)
 }
 
+// claimByKey returns the claim with the given queue key from the informer
+// cache or claims in progress, nil if there is none.
+func (ctrl *ProvisionController) claimByKey(key string) *v1.PersistentVolumeClaim {
+	var claimObj interface{}
+	if objs, err := ctrl.claimsIndexer.ByIndex(uidIndex, key); err == nil && len(objs) > 0 {
+		claimObj = objs[0]
+	} else if obj, found := ctrl.claimsInProgress.Load(key); found {
+		claimObj = obj
+	}
+	claim, _ := claimObj.(*v1.PersistentVolumeClaim)
+	return claim
+}
+
 // syncVolumeHandler gets the volume from informer's cache then calls syncVolume
 func (ctrl *ProvisionController) syncVolumeHandler(ctx context.Context, key string) error {
 	volumeObj, exists, err := ctrl.volumes.GetByKey(key)
@@ -1059,25 +3856,52 @@ func (ctrl *ProvisionController) syncVolumeHandler(ctx context.Context, key stri
 		// Already deleted, nothing to do anymore.
 		return nil
 	}
+	if volumeMeta, ok := volumeObj.(*metav1.PartialObjectMetadata); ok {
+		volume, err := ctrl.fullVolume(ctx, volumeMeta)
+		if err != nil || volume == nil {
+			return err
+		}
+		volumeObj = volume
+	}
 
 	return ctrl.syncVolume(ctx, volumeObj)
 }
 
 // syncClaim checks if the claim should have a volume provisioned for it and
 // provisions one if so. Returns an error if the claim is to be requeued.
-func (ctrl *ProvisionController) syncClaim(ctx context.Context, obj interface{}) error {
+func (ctrl *ProvisionController) syncClaim(ctx context.Context, obj interface{}) (err error) {
 	claim, ok := obj.(*v1.PersistentVolumeClaim)
 	if !ok {
 		return fmt.Errorf("expected claim but got %+v", obj)
 	}
+	// All log lines about the claim carry the same keys.
+	logger := klog.LoggerWithValues(klog.FromContext(ctx), "PVC", klog.KObj(claim), "claimUID", claim.UID)
+	ctx = klog.NewContext(ctx, logger)
+
+	if expander, ok := ctrl.provisioner.(Expander); ok && claim.Spec.VolumeName != "" {
+		return ctrl.expandClaim(ctx, expander, claim)
+	}
 
-	should, err := ctrl.shouldProvision(ctx, claim)
+	if claim.Spec.VolumeName == "" {
+		// Bound claims are never provisioned, do not trace them.
+		var claimSpan span
+		ctx, claimSpan = ctrl.startSpan(ctx,
+			func() string { return "Provision " + claim.Namespace + "/" + claim.Name },
+			func() []attribute.KeyValue {
+				return []attribute.KeyValue{attribute.String("claim.uid", string(claim.UID))}
+			})
+		defer func() { claimSpan.end(err) }()
+	}
+
+	shouldCtx, shouldSpan := ctrl.startChildSpan(ctx, spanShouldProvision)
+	should, err := ctrl.shouldProvision(shouldCtx, claim)
+	shouldSpan.setBool("provisioning.should", should)
+	shouldSpan.end(err)
 	if err != nil {
 		ctrl.updateProvisionStats(claim, err, time.Time{})
 		return err
 	} else if should {
-		startTime := time.Now()
-		logger := klog.FromContext(ctx)
+		startTime := ctrl.clock.Now()
 
 		status, err := ctrl.provisionClaimOperation(ctx, claim)
 		ctrl.updateProvisionStats(claim, err, startTime)
@@ -1085,20 +3909,20 @@ func (ctrl *ProvisionController) syncClaim(ctx context.Context, obj interface{})
 			// Provisioning is 100% finished / not in progress.
 			switch err {
 			case nil:
-				logger.V(5).Info("Claim processing succeeded, removing PVC from claims in progress", "claimUID", claim.UID)
-			case errStopProvision:
-				logger.V(5).Info("Stop provisioning, removing PVC from claims in progress", "claimUID", claim.UID)
+				logger.V(5).Info("Claim processing succeeded, removing PVC from claims in progress")
+			case errStopProvision, errWaitingForReschedule:
+				logger.V(5).Info("Stop provisioning, removing PVC from claims in progress")
 				// Our caller would requeue if we pass on this special error; return nil instead.
 				err = nil
 			default:
-				logger.V(2).Info("Final error received, removing PVC from claims in progress", "claimUID", claim.UID)
+				logger.V(2).Info("Final error received, removing PVC from claims in progress")
 			}
 			ctrl.claimsInProgress.Delete(string(claim.UID))
 			return err
 		}
 		if status == ProvisioningInBackground {
 			// Provisioning is in progress in background.
-			logger.V(2).Info("Temporary error received, adding PVC to claims in progress", "claimUID", claim.UID)
+			logger.V(2).Info("Temporary error received, adding PVC to claims in progress")
 			ctrl.claimsInProgress.Store(string(claim.UID), claim)
 		} else {
 			// status == ProvisioningNoChange.
@@ -1112,36 +3936,61 @@ func (ctrl *ProvisionController) syncClaim(ctx context.Context, obj interface{})
 }
 
 // syncVolume checks if the volume should be deleted and deletes if so
-func (ctrl *ProvisionController) syncVolume(ctx context.Context, obj interface{}) error {
+func (ctrl *ProvisionController) syncVolume(ctx context.Context, obj interface{}) (err error) {
 	volume, ok := obj.(*v1.PersistentVolume)
 	if !ok {
 		return fmt.Errorf("expected volume but got %+v", obj)
 	}
+	// All log lines about the volume carry the same keys.
+	ctx = klog.NewContext(ctx, klog.LoggerWithValues(klog.FromContext(ctx), "PV", volume.Name))
 
 	if !ctrl.isProvisionerForVolume(ctx, volume) {
 		// Current provisioner is not responsible for the volume
 		return nil
 	}
-
-	volume, err := ctrl.handleProtectionFinalizer(ctx, volume)
+	volume, err = ctrl.adoptVolume(ctx, volume)
 	if err != nil {
 		return err
 	}
 
-	if ctrl.shouldDelete(ctx, volume) {
-		klog.FromContext(ctx).V(5).Info("shouldDelete", "PV", volume.Name)
-		startTime := time.Now()
-		err = ctrl.deleteVolumeOperation(ctx, volume)
-		ctrl.updateDeleteStats(volume, err, startTime)
+	volume, err = ctrl.handleProtectionFinalizer(ctx, volume)
+	if err != nil {
 		return err
 	}
-	return nil
+
+	// Most syncs do not delete the volume, so its span only starts once
+	// shouldDelete agreed, back-dated together with the ShouldDelete span.
+	shouldStart := time.Now()
+	should := ctrl.shouldDelete(ctx, volume)
+	if !should {
+		return nil
+	}
+	shouldEnd := time.Now()
+	ctx, volumeSpan := ctrl.startSpanAt(ctx, shouldStart, func() string { return "Delete " + volume.Name }, nil)
+	defer func() { volumeSpan.end(err) }()
+	ctrl.recordChildSpan(ctx, spanShouldDelete, shouldStart, shouldEnd, attribute.Bool("deletion.should", true))
+
+	klog.FromContext(ctx).V(5).Info("shouldDelete")
+	startTime := ctrl.clock.Now()
+	err = ctrl.deleteVolumeOperation(ctx, volume)
+	ctrl.updateDeleteStats(volume, err, startTime)
+	return err
+}
+
+// provisionedBy returns the provisioner recorded in the annotations of a PV,
+// from the ProvisionedByAnnotation key or, if missing, from
+// AnnDynamicallyProvisioned.
+func (ctrl *ProvisionController) provisionedBy(annotations map[string]string) (string, bool) {
+	if provisioner, found := annotations[ctrl.provisionedByAnnotation]; found {
+		return provisioner, true
+	}
+	provisioner, found := annotations[AnnDynamicallyProvisioned]
+	return provisioner, found
 }
 
 func (ctrl *ProvisionController) isProvisionerForVolume(ctx context.Context, volume *v1.PersistentVolume) bool {
-	if metav1.HasAnnotation(volume.ObjectMeta, annDynamicallyProvisioned) {
-		provisionPluginName := volume.Annotations[annDynamicallyProvisioned]
-		migratedAnn := volume.Annotations[annMigratedTo]
+	if provisionPluginName, found := ctrl.provisionedBy(volume.Annotations); found {
+		migratedAnn := volume.Annotations[AnnMigratedTo]
 		// Determine if the PV is owned by the current provisioner.
 		if !ctrl.knownProvisioner(provisionPluginName) && !ctrl.knownProvisioner(migratedAnn) {
 			// The current provisioner is not responsible for adding the finalizer
@@ -1156,7 +4005,7 @@ func (ctrl *ProvisionController) isProvisionerForVolume(ctx context.Context, vol
 			}
 		} else {
 			// Check if the volume is being migrated
-			migratedAnn := volume.Annotations[annMigratedTo]
+			migratedAnn := volume.Annotations[AnnMigratedTo]
 			if !ctrl.knownProvisioner(migratedAnn) {
 				// The current provisioner is not responsible for adding the finalizer
 				return false
@@ -1175,13 +4024,13 @@ func (ctrl *ProvisionController) handleProtectionFinalizer(ctx context.Context,
 	// Add the finalizer only if `addFinalizer` config option is enabled, finalizer doesn't exist and PV is not already
 	// under deletion.
 	if ctrl.addFinalizer && reclaimPolicy == v1.PersistentVolumeReclaimDelete && volume.DeletionTimestamp == nil && volume.Status.Phase == v1.VolumeBound {
-		volumeFinalizers, modified = addFinalizer(volumeFinalizers, finalizerPV)
+		volumeFinalizers, modified = addFinalizer(volumeFinalizers, ctrl.pvFinalizer)
 	}
 
 	// Check if the `addFinalizer` config option is disabled, i.e, rollback scenario, or the reclaim policy is changed
 	// to `Retain` or `Recycle`
 	if !ctrl.addFinalizer || reclaimPolicy == v1.PersistentVolumeReclaimRetain || reclaimPolicy == v1.PersistentVolumeReclaimRecycle {
-		volumeFinalizers, modified = removeFinalizer(volumeFinalizers, finalizerPV)
+		volumeFinalizers, modified = removeFinalizer(volumeFinalizers, ctrl.pvFinalizer)
 	}
 
 	if modified {
@@ -1205,57 +4054,39 @@ func (ctrl *ProvisionController) knownProvisioner(provisioner string) bool {
 			return true
 		}
 	}
-	return false
+	return slices.Contains(ctrl.adoptedProvisionerNames, provisioner)
+}
+
+// knownClaimProvisioner checks if claims and StorageClasses with the
+// provisioner name are provisioned by the controller. Unlike
+// knownProvisioner, it accepts the name set by TranslatedInTreePluginName.
+func (ctrl *ProvisionController) knownClaimProvisioner(provisioner string) bool {
+	if ctrl.translatedPluginName != "" && provisioner == ctrl.translatedPluginName {
+		return true
+	}
+	return ctrl.knownProvisioner(provisioner)
 }
 
 // shouldProvision returns whether a claim should have a volume provisioned for
 // it, i.e. whether a Provision is "desired"
 func (ctrl *ProvisionController) shouldProvision(ctx context.Context, claim *v1.PersistentVolumeClaim) (bool, error) {
-	if claim.Spec.VolumeName != "" {
-		return false, nil
-	}
-
-	if qualifier, ok := ctrl.provisioner.(Qualifier); ok {
-		if !qualifier.ShouldProvision(ctx, claim) {
-			return false, nil
-		}
-	}
-
-	provisioner, found := claim.Annotations[annStorageProvisioner]
-	if !found {
-		provisioner, found = claim.Annotations[annBetaStorageProvisioner]
+	reason, err := ctrl.provisionSkipReason(ctx, claim)
+	if err != nil {
+		return false, err
 	}
-
-	if found {
-		if ctrl.knownProvisioner(provisioner) {
-			claimClass := util.GetPersistentVolumeClaimClass(claim)
-			class, err := ctrl.getStorageClass(claimClass)
-			if err != nil {
-				return false, err
-			}
-			if class.VolumeBindingMode != nil && *class.VolumeBindingMode == storage.VolumeBindingWaitForFirstConsumer {
-				// When claim is in delay binding mode, annSelectedNode is
-				// required to provision volume.
-				// Though PV controller set annStorageProvisioner only when
-				// annSelectedNode is set, but provisioner may remove
-				// annSelectedNode to notify scheduler to reschedule again.
-				if selectedNode, ok := claim.Annotations[annSelectedNode]; ok && selectedNode != "" {
-					return true, nil
-				}
-				return false, nil
-			}
-			return true, nil
-		}
+	if reason != "" {
+		ctrl.adviseSkip(claim, reason)
+		ctrl.explainSkip(ctx, claim, reason)
+		return false, nil
 	}
-
-	return false, nil
+	return true, nil
 }
 
 // shouldDelete returns whether a volume should have its backing volume
 // deleted, i.e. whether a Delete is "desired"
 func (ctrl *ProvisionController) shouldDelete(ctx context.Context, volume *v1.PersistentVolume) bool {
 	logger := klog.FromContext(ctx)
-	logger.V(5).Info("shouldDelete", "PV", volume.Name)
+	logger.V(5).Info("shouldDelete")
 	if deletionGuard, ok := ctrl.provisioner.(DeletionGuard); ok {
 		if !deletionGuard.ShouldDelete(ctx, volume) {
 			return false
@@ -1263,29 +4094,29 @@ func (ctrl *ProvisionController) shouldDelete(ctx context.Context, volume *v1.Pe
 	}
 
 	if ctrl.addFinalizer {
-		if !ctrl.checkFinalizer(volume, finalizerPV) && volume.ObjectMeta.DeletionTimestamp != nil {
+		if !ctrl.checkFinalizer(volume, ctrl.pvFinalizer) && volume.ObjectMeta.DeletionTimestamp != nil {
 			// The finalizer was removed, i.e. the volume has been already deleted.
-			logger.V(5).Info("shouldDelete is false: finalizer already removed from volume", "PV", volume.Name)
+			logger.V(5).Info("shouldDelete is false: finalizer already removed from volume")
 			return false
 		}
 	} else {
 		if volume.ObjectMeta.DeletionTimestamp != nil {
-			logger.V(5).Info("shouldDelete is false: DeletionTimestamp != nil", "PV", volume.Name)
+			logger.V(5).Info("shouldDelete is false: DeletionTimestamp != nil")
 			return false
 		}
 	}
 
-	if volume.Status.Phase != v1.VolumeReleased {
-		logger.V(5).Info("shouldDelete is false: PersistentVolumePhase is not Released", "PV", volume.Name)
+	if volume.Status.Phase != v1.VolumeReleased && !ctrl.deletedBeforeClaim(ctx, volume) {
+		logger.V(5).Info("shouldDelete is false: PersistentVolumePhase is not Released")
 		return false
 	}
 
 	if volume.Spec.PersistentVolumeReclaimPolicy != v1.PersistentVolumeReclaimDelete {
-		logger.V(5).Info("shouldDelete is false: volume does not have Delete reclaim policy", "PV", volume.Name)
+		logger.V(5).Info("shouldDelete is false: volume does not have Delete reclaim policy")
 		return false
 	}
 
-	logger.V(5).Info("shouldDelete is true", "PV", volume.Name)
+	logger.V(5).Info("shouldDelete is true")
 	return true
 }
 
@@ -1317,26 +4148,46 @@ func (ctrl *ProvisionController) updateProvisionStats(claim *v1.PersistentVolume
 	if claim.Spec.DataSource != nil {
 		source = claim.Spec.DataSource.Kind
 	}
+	if errors.Is(err, errInFlightLimit) || errors.Is(err, errNodeInFlightLimit) || errors.Is(err, errWaitingForReschedule) || errors.Is(err, errNoStorageCapacity) || errors.Is(err, errSnapshotNotReady) {
+		// Not attempted at all.
+		return
+	}
 	if err != nil {
 		ctrl.metrics.PersistentVolumeClaimProvisionFailedTotal.WithLabelValues(class, source).Inc()
 	} else {
-		ctrl.metrics.PersistentVolumeClaimProvisionDurationSeconds.WithLabelValues(class, source).Observe(time.Since(startTime).Seconds())
+		ctrl.metrics.PersistentVolumeClaimProvisionDurationSeconds.WithLabelValues(class, source).Observe(ctrl.clock.Since(startTime).Seconds())
 		ctrl.metrics.PersistentVolumeClaimProvisionTotal.WithLabelValues(class, source).Inc()
 	}
 }
 
 func (ctrl *ProvisionController) updateDeleteStats(volume *v1.PersistentVolume, err error, startTime time.Time) {
 	class := volume.Spec.StorageClassName
+	if errors.Is(err, errInFlightLimit) {
+		// Not attempted at all.
+		return
+	}
 	if err != nil {
 		ctrl.metrics.PersistentVolumeDeleteFailedTotal.WithLabelValues(class).Inc()
 	} else {
-		ctrl.metrics.PersistentVolumeDeleteDurationSeconds.WithLabelValues(class).Observe(time.Since(startTime).Seconds())
+		ctrl.metrics.PersistentVolumeDeleteDurationSeconds.WithLabelValues(class).Observe(ctrl.clock.Since(startTime).Seconds())
 		ctrl.metrics.PersistentVolumeDeleteTotal.WithLabelValues(class).Inc()
 	}
 }
 
 // patchPersistentVolumeWithFinalizers patches the PersistentVolume with the given finalizers
 func (ctrl *ProvisionController) patchPersistentVolumeWithFinalizers(ctx context.Context, volume *v1.PersistentVolume, finalizers []string) (*v1.PersistentVolume, error) {
+	if ctrl.serverSideApply {
+		add := slices.Contains(finalizers, ctrl.pvFinalizer)
+		pv, err := ctrl.applyVolumeFinalizer(ctx, volume.Name, add)
+		if err != nil || add || !slices.Contains(pv.Finalizers, ctrl.pvFinalizer) {
+			return pv, err
+		}
+		// The finalizer was not added with an Apply patch of the controller,
+		// e.g. before UseServerSideApply was enabled. Remove it with a patch.
+		volume = pv
+		finalizers, _ = removeFinalizer(pv.Finalizers, ctrl.pvFinalizer)
+	}
+
 	oldData, err := json.Marshal(volume)
 	if err != nil {
 		return nil, err
@@ -1353,7 +4204,7 @@ func (ctrl *ProvisionController) patchPersistentVolumeWithFinalizers(ctx context
 	if err != nil {
 		return nil, err
 	}
-	pv, err := ctrl.client.CoreV1().PersistentVolumes().Patch(ctx, volume.Name, types.StrategicMergePatchType, patchBytes, metav1.PatchOptions{})
+	pv, err := ctrl.pvWriteClient.CoreV1().PersistentVolumes().Patch(ctx, volume.Name, types.StrategicMergePatchType, patchBytes, metav1.PatchOptions{})
 	if err != nil {
 		return nil, err
 	}
@@ -1361,9 +4212,10 @@ func (ctrl *ProvisionController) patchPersistentVolumeWithFinalizers(ctx context
 }
 
 // rescheduleProvisioning signal back to the scheduler to retry dynamic provisioning
-// by removing the annSelectedNode annotation
-func (ctrl *ProvisionController) rescheduleProvisioning(ctx context.Context, claim *v1.PersistentVolumeClaim) error {
-	if _, ok := claim.Annotations[annSelectedNode]; !ok {
+// by removing the AnnSelectedNode annotation
+func (ctrl *ProvisionController) rescheduleProvisioning(ctx context.Context, claim *v1.PersistentVolumeClaim, reason string) error {
+	selectedNode, ok := claim.Annotations[AnnSelectedNode]
+	if !ok {
 		// Provisioning not triggered by the scheduler, skip
 		return nil
 	}
@@ -1371,9 +4223,22 @@ func (ctrl *ProvisionController) rescheduleProvisioning(ctx context.Context, cla
 	// The claim from method args can be pointing to watcher cache. We must not
 	// modify these, therefore create a copy.
 	newClaim := claim.DeepCopy()
-	delete(newClaim.Annotations, annSelectedNode)
+	delete(newClaim.Annotations, AnnSelectedNode)
+	// Patch instead of update, the cached claim may miss annotations dropped
+	// by CachedAnnotationSizeLimit. The resource version keeps the update
+	// semantics, the claim must not have changed since it was cached.
+	metadata := map[string]interface{}{
+		"annotations": map[string]interface{}{AnnSelectedNode: nil},
+	}
+	if claim.ResourceVersion != "" {
+		metadata["resourceVersion"] = claim.ResourceVersion
+	}
+	patch, err := json.Marshal(map[string]interface{}{"metadata": metadata})
+	if err != nil {
+		return err
+	}
 	// Try to update the PVC object
-	if _, err := ctrl.client.CoreV1().PersistentVolumeClaims(newClaim.Namespace).Update(ctx, newClaim, metav1.UpdateOptions{}); err != nil {
+	if _, err := ctrl.objectClient.CoreV1().PersistentVolumeClaims(newClaim.Namespace).Patch(ctx, newClaim.Name, types.MergePatchType, patch, metav1.PatchOptions{}); err != nil {
 		return fmt.Errorf("delete annotation 'annSelectedNode' for PersistentVolumeClaim %q: %v", klog.KObj(newClaim), err)
 	}
 
@@ -1388,6 +4253,8 @@ func (ctrl *ProvisionController) rescheduleProvisioning(ctx context.Context, cla
 		klog.FromContext(ctx).Info("Update claim informer cache for PersistentVolumeClaim", "PVC", klog.KObj(newClaim), "err", err)
 	}
 
+	ctrl.metrics.PersistentVolumeClaimRescheduleTotal.WithLabelValues(util.GetPersistentVolumeClaimClass(claim), reason).Inc()
+	ctrl.event(claim, v1.EventTypeNormal, "ProvisioningRescheduled", fmt.Sprintf("Removed selected node %q to reschedule provisioning, reason: %s", selectedNode, reason))
 	return nil
 }
 
@@ -1398,14 +4265,23 @@ func (ctrl *ProvisionController) rescheduleProvisioning(ctx context.Context, cla
 func (ctrl *ProvisionController) provisionClaimOperation(ctx context.Context, claim *v1.PersistentVolumeClaim) (ProvisioningState, error) {
 	// Most code here is identical to that found in controller.go of kube's PV controller...
 	claimClass := util.GetPersistentVolumeClaimClass(claim)
-	logger := klog.LoggerWithValues(klog.FromContext(ctx), "PVC", klog.KObj(claim), "StorageClass", claimClass)
+	logger := klog.LoggerWithValues(klog.FromContext(ctx), "StorageClass", claimClass)
 	logger.V(4).Info("Started")
+	defer ctrl.trackOperation(fmt.Sprintf("provisioning of claim %s", klog.KObj(claim)))()
 
 	//  A previous doProvisionClaim may just have finished while we were waiting for
 	//  the locks. Check that PV (with deterministic name) hasn't been provisioned
 	//  yet.
 	pvName := ctrl.getProvisionedVolumeNameForClaim(claim)
-	_, exists, err := ctrl.volumes.GetByKey(pvName)
+	var exists bool
+	var err error
+	if ctrl.volumes != nil {
+		_, exists, err = ctrl.volumes.GetByKey(pvName)
+	} else {
+		// PVs are not cached in provision-only mode.
+		_, err = ctrl.objectClient.CoreV1().PersistentVolumes().Get(ctx, pvName, metav1.GetOptions{})
+		exists = err == nil
+	}
 	if err == nil && exists {
 		// Volume has been already provisioned, nothing to do.
 		logger.V(4).Info("PersistentVolume already exists, skipping", "PV", pvName)
@@ -1422,44 +4298,120 @@ func (ctrl *ProvisionController) provisionClaimOperation(ctx context.Context, cl
 
 	// Check if this provisioner can provision this claim.
 	if err = ctrl.canProvision(ctx, claim); err != nil {
-		ctrl.eventRecorder.Event(claim, v1.EventTypeWarning, "ProvisioningFailed", err.Error())
+		ctrl.event(claim, v1.EventTypeWarning, "ProvisioningFailed", err.Error())
 		logger.Error(err, "Failed to provision volume")
 		return ProvisioningFinished, errStopProvision
 	}
 
 	// For any issues getting fields from StorageClass (including reclaimPolicy & mountOptions),
 	// retry the claim because the storageClass can be fixed/(re)created independently of the claim
-	class, err := ctrl.getStorageClass(claimClass)
+	class, err := ctrl.getStorageClass(ctx, claimClass)
 	if err != nil {
 		logger.Error(err, "Error getting claim's StorageClass's fields")
 		return ProvisioningFinished, err
 	}
-	if !ctrl.knownProvisioner(class.Provisioner) {
+	if !ctrl.knownClaimProvisioner(class.Provisioner) {
 		// class.Provisioner has either changed since shouldProvision() or
-		// annDynamicallyProvisioned contains different provisioner than
+		// the provisioned-by annotation contains different provisioner than
 		// class.Provisioner.
 		logger.Error(nil, "Unknown provisioner requested in claim's StorageClass", "provisioner", class.Provisioner)
 		return ProvisioningFinished, errStopProvision
 	}
 
+	if namespace, cross := crossNamespaceDataSource(claim); cross {
+		// Checked again only when the claim changes, not on resyncs.
+		if version, denied := ctrl.deniedDataSources.Load(claim.UID); denied && version == claim.ResourceVersion {
+			return ProvisioningFinished, errStopProvision
+		}
+		granted, err := ctrl.dataSourceGranted(ctx, claim)
+		if err != nil {
+			ctrl.event(claim, v1.EventTypeWarning, "ProvisioningFailed", err.Error())
+			return ProvisioningNoChange, err
+		}
+		if !granted {
+			ctrl.deniedDataSources.Store(claim.UID, claim.ResourceVersion)
+			ctrl.event(claim, v1.EventTypeWarning, "DataSourceNotGranted", fmt.Sprintf(
+				"Access to data source %s/%s of kind %s not granted, no ReferenceGrant in namespace %s allows PersistentVolumeClaims in namespace %s to use it",
+				namespace, claim.Spec.DataSourceRef.Name, claim.Spec.DataSourceRef.Kind, namespace, claim.Namespace))
+			return ProvisioningFinished, errStopProvision
+		}
+		ctrl.deniedDataSources.Delete(claim.UID)
+	}
+
+	cloneSource, err := ctrl.cloneSource(ctx, claim, class)
+	if err != nil {
+		var cerr *cloneError
+		if errors.As(err, &cerr) {
+			ctrl.event(claim, v1.EventTypeWarning, cerr.reason, fmt.Sprintf("Cannot clone the source claim: %s", cerr.msg))
+			logger.Error(err, "Invalid clone source")
+			return ProvisioningFinished, errStopProvision
+		}
+		ctrl.event(claim, v1.EventTypeWarning, "ProvisioningFailed", err.Error())
+		return ProvisioningNoChange, err
+	}
+
 	var selectedNode *v1.Node
 	// Get SelectedNode
-	if nodeName, ok := getString(claim.Annotations, annSelectedNode, annAlphaSelectedNode); ok {
-		if ctrl.nodeLister != nil {
-			selectedNode, err = ctrl.nodeLister.Get(nodeName)
-		} else {
-			selectedNode, err = ctrl.client.CoreV1().Nodes().Get(ctx, nodeName, metav1.GetOptions{}) // TODO (verult) cache Nodes
-		}
+	if nodeName, ok := getString(claim.Annotations, AnnSelectedNode, AnnAlphaSelectedNode); ok {
+		selectedNode, err = ctrl.getNode(ctx, nodeName)
 		if err != nil {
-			// if node does not exist, reschedule and remove volume.kubernetes.io/selected-node annotation
+			// If the node does not exist, e.g. a reclaimed spot instance,
+			// remove the volume.kubernetes.io/selected-node annotation to
+			// reschedule. getNode confirms absence with a GET, a stale
+			// lister does not get here.
 			if apierrs.IsNotFound(err) {
 				ctx2 := klog.NewContext(ctx, logger)
-				return ctrl.provisionVolumeErrorHandling(ctx2, ProvisioningReschedule, err, claim)
+				return ctrl.rescheduleUnusableNode(ctx2, claim, fmt.Sprintf("Selected node %q no longer exists, waiting for reschedule", nodeName), rescheduleReasonNodeNotFound)
 			}
 			err = fmt.Errorf("failed to get target node: %v", err)
-			ctrl.eventRecorder.Event(claim, v1.EventTypeWarning, "ProvisioningFailed", err.Error())
+			ctrl.event(claim, v1.EventTypeWarning, "ProvisioningFailed", err.Error())
 			return ProvisioningNoChange, err
 		}
+		if selectedNode.DeletionTimestamp != nil {
+			ctx2 := klog.NewContext(ctx, logger)
+			return ctrl.rescheduleUnusableNode(ctx2, claim, fmt.Sprintf("Selected node %q is being deleted, waiting for reschedule", nodeName), rescheduleReasonNodeTerminating)
+		}
+		if ctrl.canMoveClaim(claim, class) {
+			if ctrl.avoidUnschedulableNodes {
+				// A volume of a node-local backend would be wasted, the pod
+				// would never run there.
+				if reason := ctrl.unschedulableNodeReason(selectedNode); reason != "" {
+					ctx2 := klog.NewContext(ctx, logger)
+					return ctrl.rescheduleUnusableNode(ctx2, claim, fmt.Sprintf("Selected node %q %s, waiting for reschedule", nodeName, reason), rescheduleReasonNodeUnschedulable)
+				}
+			}
+			if checker, ok := ctrl.provisioner.(CapacityChecker); ok {
+				hasCapacity, err := checker.HasCapacity(ctx, selectedNode, claim, class)
+				if err != nil {
+					err = fmt.Errorf("failed to check capacity of node %q: %v", nodeName, err)
+					ctrl.event(claim, v1.EventTypeWarning, "ProvisioningFailed", err.Error())
+					return ProvisioningNoChange, err
+				}
+				if !hasCapacity {
+					ctx2 := klog.NewContext(ctx, logger)
+					return ctrl.rescheduleUnusableNode(ctx2, claim, fmt.Sprintf("Selected node %q does not have enough capacity, waiting for reschedule", nodeName), rescheduleReasonNoCapacity)
+				}
+			}
+		}
+		if !nodeMatchesAllowedTopologies(selectedNode, class.AllowedTopologies) {
+			// E.g. the class or the node labels changed after scheduling.
+			err = fmt.Errorf("selected node %q does not match allowed topologies of StorageClass %q", selectedNode.Name, class.Name)
+			ctx2 := klog.NewContext(ctx, logger)
+			return ctrl.provisionVolumeErrorHandling(ctx2, ProvisioningReschedule, err, claim, rescheduleReasonTopologyMismatch)
+		}
+	}
+
+	if fits, err := ctrl.hasStorageCapacity(claim, class, selectedNode); err != nil {
+		err = fmt.Errorf("failed to check storage capacity: %v", err)
+		ctrl.event(claim, v1.EventTypeWarning, "ProvisioningFailed", err.Error())
+		return ProvisioningNoChange, err
+	} else if !fits {
+		msg := fmt.Sprintf("No CSIStorageCapacity of StorageClass %q reports enough capacity for the claim", class.Name)
+		if selectedNode != nil {
+			msg = fmt.Sprintf("No CSIStorageCapacity of StorageClass %q reports enough capacity for the claim in the topology of node %q", class.Name, selectedNode.Name)
+		}
+		ctrl.event(claim, v1.EventTypeWarning, "NotEnoughStorageCapacity", msg)
+		return ProvisioningNoChange, errNoStorageCapacity
 	}
 
 	options := ProvisionOptions{
@@ -1467,51 +4419,146 @@ func (ctrl *ProvisionController) provisionClaimOperation(ctx context.Context, cl
 		PVName:       pvName,
 		PVC:          claim,
 		SelectedNode: selectedNode,
-	}
+		CloneSource:  cloneSource,
 
-	ctrl.eventRecorder.Event(claim, v1.EventTypeNormal, "Provisioning", fmt.Sprintf("External provisioner is provisioning volume for claim %q", klog.KObj(claim)))
+		VolumeAttributesClassName: claim.Spec.VolumeAttributesClassName,
+	}
+	if class.VolumeBindingMode != nil && *class.VolumeBindingMode == storage.VolumeBindingWaitForFirstConsumer {
+		options.ConsumerPod = ctrl.consumerPod(claim, selectedNode)
+	}
+	if ctrl.resolveAttributesClass && options.VolumeAttributesClassName != nil {
+		options.VolumeAttributesClassParameters, err = ctrl.volumeAttributesClassParameters(ctx, *options.VolumeAttributesClassName, class)
+		if err != nil {
+			ctrl.event(claim, v1.EventTypeWarning, "ProvisioningFailed", err.Error())
+			return ProvisioningNoChange, err
+		}
+	}
+	if ctrl.allowedFSTypes != nil {
+		options.FSType, err = util.GetFSType(class.Parameters, ctrl.allowedFSTypes, ctrl.defaultFSType)
+		if err != nil {
+			err = fmt.Errorf("StorageClass %q: %v", class.Name, err)
+			ctrl.event(claim, v1.EventTypeWarning, "ProvisioningFailed", err.Error())
+			return ProvisioningNoChange, err
+		}
+	}
+	if ctrl.resolveSnapshots {
+		options.SnapshotSource, err = ctrl.snapshotSource(ctx, claim)
+		if errors.Is(err, errSnapshotNotReady) {
+			ctrl.adviseSnapshotWait(claim, err)
+			return ProvisioningNoChange, err
+		}
+		if err != nil {
+			ctrl.event(claim, v1.EventTypeWarning, "ProvisioningFailed", err.Error())
+			return ProvisioningNoChange, err
+		}
+	}
 
-	volume, result, err := ctrl.provisioner.Provision(ctx, options)
+	var nodeName string
+	if selectedNode != nil {
+		nodeName = selectedNode.Name
+	}
+	if !ctrl.nodeInFlight.tryAcquire(nodeName) {
+		return ProvisioningNoChange, errNodeInFlightLimit
+	}
+	if !ctrl.inFlight.tryAcquire(logger) {
+		ctrl.nodeInFlight.release(nodeName)
+		return ProvisioningNoChange, errInFlightLimit
+	}
+	ctrl.event(claim, v1.EventTypeNormal, "Provisioning", fmt.Sprintf("External provisioner is provisioning volume for claim %q", klog.KObj(claim)))
+	ctrl.provisionStartTimes.Store(claim.UID, ctrl.clock.Now())
+
+	provisionCtx, provisionSpan := ctrl.startChildSpan(ctx, spanProvision)
+	ctrl.metrics.PersistentVolumeClaimProvisionInFlight.Inc()
+	volume, warnings, result, err := ctrl.provision(provisionCtx, options)
+	ctrl.metrics.PersistentVolumeClaimProvisionInFlight.Dec()
+	ctrl.inFlight.release()
+	ctrl.nodeInFlight.release(nodeName)
+	provisionSpan.setState(result)
+	provisionSpan.end(err)
 	if err != nil {
+		ctrl.provisionStartTimes.Delete(claim.UID)
 		if ierr, ok := err.(*IgnoredError); ok {
 			// Provision ignored, do nothing and hope another provisioner will provision it.
 			logger.V(4).Info("Volume provision ignored", "reason", ierr)
 			return ProvisioningFinished, errStopProvision
 		}
+		ctrl.recordClassFailure(class, claim, pvName, err)
 
 		ctx2 := klog.NewContext(ctx, logger)
-		err = fmt.Errorf("failed to provision volume with StorageClass %q: %v", claimClass, err)
-		return ctrl.provisionVolumeErrorHandling(ctx2, result, err, claim)
+		err = fmt.Errorf("failed to provision volume with StorageClass %q: %w", claimClass, err)
+		return ctrl.provisionVolumeErrorHandling(ctx2, result, err, claim, rescheduleReasonProvisionFailed)
+	}
+	if result == ProvisioningReschedule {
+		// The provisioner asked for another node without reporting a failure.
+		ctrl.provisionStartTimes.Delete(claim.UID)
+		err := fmt.Errorf("provisioner requested rescheduling of the volume with StorageClass %q", claimClass)
+		return ctrl.provisionVolumeErrorHandling(klog.NewContext(ctx, logger), result, err, claim, rescheduleReasonProvisionerRequested)
+	}
+
+	if err := ValidateProvisionedVolume(volume, claim); err != nil {
+		ctrl.provisionStartTimes.Delete(claim.UID)
+		ctrl.recordClassFailure(class, claim, pvName, err)
+		return ctrl.rejectInvalidVolume(klog.NewContext(ctx, logger), claim, class, volume, err)
 	}
 
 	logger.V(4).Info("Volume is provisioned", "PV", volume.Name)
+	cacheVolume := ctrl.volumeSelector == nil || ctrl.volumeSelector.Matches(labels.Set(volume.Labels))
+	if !cacheVolume {
+		logger.Info("Provisioned volume does not match VolumeListWatchLabelSelector, it will not be deleted by this controller", "PV", volume.Name, "selector", ctrl.volumeSelector.String())
+	}
 
 	// Set ClaimRef and the PV controller will bind and set annBoundByController for us
 	volume.Spec.ClaimRef = claimRef
+	if volume.Spec.VolumeAttributesClassName == nil {
+		volume.Spec.VolumeAttributesClassName = claim.Spec.VolumeAttributesClassName
+	}
 
 	// Add external provisioner finalizer if it doesn't already have it
-	if ctrl.addFinalizer && !ctrl.checkFinalizer(volume, finalizerPV) {
-		volume.ObjectMeta.Finalizers = append(volume.ObjectMeta.Finalizers, finalizerPV)
+	if ctrl.addFinalizer && !ctrl.checkFinalizer(volume, ctrl.pvFinalizer) {
+		volume.ObjectMeta.Finalizers = append(volume.ObjectMeta.Finalizers, ctrl.pvFinalizer)
 	}
 
-	metav1.SetMetaDataAnnotation(&volume.ObjectMeta, annDynamicallyProvisioned, class.Provisioner)
+	provisionedBy := class.Provisioner
+	if slices.Contains(ctrl.adoptedProvisionerNames, provisionedBy) || provisionedBy == ctrl.translatedPluginName {
+		// PVs of adopted provisioners and of the counterpart name under CSI
+		// migration get the current name.
+		provisionedBy = ctrl.provisionerName
+	}
+	// Kubernetes recognizes dynamically provisioned PVs only by
+	// AnnDynamicallyProvisioned, it is set next to ProvisionedByAnnotation.
+	metav1.SetMetaDataAnnotation(&volume.ObjectMeta, AnnDynamicallyProvisioned, provisionedBy)
+	metav1.SetMetaDataAnnotation(&volume.ObjectMeta, ctrl.provisionedByAnnotation, provisionedBy)
+	ctrl.setDataSourceAnnotations(volume, claim, options.SnapshotSource)
 	volume.Spec.StorageClassName = claimClass
+	if ctrl.driftAuditInterval > 0 {
+		metav1.SetMetaDataAnnotation(&volume.ObjectMeta, ctrl.contentHashAnnotation(), ctrl.volumeContentHash(volume))
+	}
 
 	logger.V(4).Info("Succeeded")
 
-	if err := ctrl.volumeStore.StoreVolume(logger, claim, volume); err != nil {
+	_, saveSpan := ctrl.startChildSpan(ctx, spanSaveVolume)
+	err = ctrl.volumeStore.StoreVolume(logger, claim, volume)
+	saveSpan.end(err)
+	if err != nil {
+		ctrl.provisionStartTimes.Delete(claim.UID)
 		return ProvisioningFinished, err
 	}
-	if err = ctrl.volumes.Add(volume); err != nil {
-		utilruntime.HandleError(err)
+	if cacheVolume && ctrl.volumes != nil {
+		if err = ctrl.volumes.Add(ctrl.cachedVolume(volume)); err != nil {
+			utilruntime.HandleError(err)
+		}
 	}
+	ctrl.sendProvisionWarnings(claim, warnings)
 	return ProvisioningFinished, nil
 }
 
-func (ctrl *ProvisionController) provisionVolumeErrorHandling(ctx context.Context, result ProvisioningState, err error, claim *v1.PersistentVolumeClaim) (ProvisioningState, error) {
+// provisionVolumeErrorHandling emits an event for the failed provisioning and
+// removes the selected node of the claim if rescheduling was requested.
+// rescheduleReason tells why rescheduling was requested.
+func (ctrl *ProvisionController) provisionVolumeErrorHandling(ctx context.Context, result ProvisioningState, err error, claim *v1.PersistentVolumeClaim, rescheduleReason string) (ProvisioningState, error) {
 	logger := klog.FromContext(ctx)
-	ctrl.eventRecorder.Event(claim, v1.EventTypeWarning, "ProvisioningFailed", err.Error())
-	if _, ok := claim.Annotations[annSelectedNode]; ok && result == ProvisioningReschedule {
+	ctrl.event(claim, v1.EventTypeWarning, "ProvisioningFailed", err.Error())
+	if _, ok := claim.Annotations[AnnSelectedNode]; ok && result == ProvisioningReschedule {
 		// For dynamic PV provisioning with delayed binding, the provisioner may fail
 		// because the node is wrong (permanent error) or currently unusable (not enough
 		// capacity). If the provisioner wants to give up scheduling with the currently
@@ -1519,7 +4566,7 @@ func (ctrl *ProvisionController) provisionVolumeErrorHandling(ctx context.Contex
 		// as state.
 		//
 		// `selectedNode` must be removed to notify scheduler to schedule again.
-		if errLabel := ctrl.rescheduleProvisioning(ctx, claim); errLabel != nil {
+		if errLabel := ctrl.rescheduleProvisioning(ctx, claim, rescheduleReason); errLabel != nil {
 			logger.Info("Volume rescheduling failed", "err", errLabel)
 			// If unsetting that label fails in ctrl.rescheduleProvisioning, we
 			// keep the volume in the work queue as if the provisioner had
@@ -1544,26 +4591,29 @@ func (ctrl *ProvisionController) provisionVolumeErrorHandling(ctx context.Contex
 // volume. Returns error, which indicates whether deletion should be retried
 // (requeue the volume) or not
 func (ctrl *ProvisionController) deleteVolumeOperation(ctx context.Context, volume *v1.PersistentVolume) error {
-	logger := klog.LoggerWithValues(klog.FromContext(ctx), "PV", volume.Name)
+	logger := klog.FromContext(ctx)
 	logger.V(4).Info("Started")
+	defer ctrl.trackOperation(fmt.Sprintf("deletion of volume %s", volume.Name))()
 
-	err := ctrl.provisioner.Delete(ctx, volume)
-	if err != nil {
-		if ierr, ok := err.(*IgnoredError); ok {
+	var err error
+	if uid, deleted := ctrl.backendDeleted.Load(volume.Name); deleted && uid == volume.UID {
+		// A previous attempt failed to delete the PV or remove its
+		// finalizer after the storage asset was deleted.
+		logger.V(4).Info("Storage asset of the volume already deleted")
+	} else if err = ctrl.deleteStorageAsset(ctx, volume); err != nil {
+		if isIgnoredError(err) {
 			// Delete ignored, do nothing and hope another provisioner will delete it.
-			logger.V(4).Info("Volume deletion ignored", "reason", ierr)
+			logger.V(4).Info("Volume deletion ignored", "reason", err)
 			return nil
 		}
-		// Delete failed, emit an event.
-		logger.Error(err, "Volume deletion failed")
-		ctrl.eventRecorder.Event(volume, v1.EventTypeWarning, "VolumeFailedDelete", err.Error())
 		return err
 	}
+	ctrl.backendDeleted.Store(volume.Name, volume.UID)
 
 	logger.V(4).Info("Volume deleted")
 
 	// Delete the volume
-	if err = ctrl.client.CoreV1().PersistentVolumes().Delete(ctx, volume.Name, metav1.DeleteOptions{}); err != nil {
+	if err = ctrl.pvWriteClient.CoreV1().PersistentVolumes().Delete(ctx, volume.Name, metav1.DeleteOptions{}); err != nil {
 		// Oops, could not delete the volume and therefore the controller will
 		// try to delete the volume again on next update.
 		logger.Info("Failed to delete persistentvolume", "err", err)
@@ -1575,7 +4625,17 @@ func (ctrl *ProvisionController) deleteVolumeOperation(ctx context.Context, volu
 			// Remove external-provisioner finalizer
 
 			// need to get the pv again because the delete has updated the object with a deletion timestamp
-			volumeObj, exists, err := ctrl.volumes.GetByKey(volume.Name)
+			var volumeObj interface{}
+			exists := true
+			if ctrl.volumeMetadataClient != nil {
+				// The cache has no full PVs.
+				volumeObj, err = ctrl.objectClient.CoreV1().PersistentVolumes().Get(ctx, volume.Name, metav1.GetOptions{})
+				if apierrs.IsNotFound(err) {
+					exists, err = false, nil
+				}
+			} else {
+				volumeObj, exists, err = ctrl.volumes.GetByKey(volume.Name)
+			}
 			if err != nil {
 				logger.Info("Failed to get persistentvolume to update finalizer", "err", err)
 				return err
@@ -1588,7 +4648,7 @@ func (ctrl *ProvisionController) deleteVolumeOperation(ctx context.Context, volu
 			if !ok {
 				return fmt.Errorf("expected volume but got %+v", volumeObj)
 			}
-			finalizers, modified := removeFinalizer(newVolume.ObjectMeta.Finalizers, finalizerPV)
+			finalizers, modified := removeFinalizer(newVolume.ObjectMeta.Finalizers, ctrl.pvFinalizer)
 
 			// Only update the finalizers if we actually removed something
 			if modified {
@@ -1608,6 +4668,42 @@ func (ctrl *ProvisionController) deleteVolumeOperation(ctx context.Context, volu
 	return nil
 }
 
+// deleteStorageAsset deletes the storage asset of the volume with Delete of
+// the provisioner or, see NodeDeleter, DeleteVolumeForMissingNode. It sends
+// an event when it fails, except for an IgnoredError.
+func (ctrl *ProvisionController) deleteStorageAsset(ctx context.Context, volume *v1.PersistentVolume) error {
+	logger := klog.FromContext(ctx)
+	if !ctrl.inFlight.tryAcquire(logger) {
+		return errInFlightLimit
+	}
+	missingNode, err := ctrl.missingVolumeNode(ctx, volume)
+	if err != nil {
+		ctrl.inFlight.release()
+		logger.Error(err, "Failed to check the node of the volume")
+		return err
+	}
+	deleteCtx, deleteSpan := ctrl.startChildSpan(ctx, spanDelete)
+	ctrl.metrics.PersistentVolumeDeleteInFlight.Inc()
+	if missingNode != "" {
+		err = ctrl.deleteVolumeForMissingNode(deleteCtx, volume, missingNode)
+	} else {
+		err = ctrl.provisioner.Delete(deleteCtx, volume)
+	}
+	ctrl.metrics.PersistentVolumeDeleteInFlight.Dec()
+	ctrl.inFlight.release()
+	deleteSpan.end(err)
+	if err != nil {
+		if isIgnoredError(err) {
+			return err
+		}
+		// Delete failed, emit an event.
+		logger.Error(err, "Volume deletion failed")
+		ctrl.event(volume, v1.EventTypeWarning, "VolumeFailedDelete", err.Error())
+		return err
+	}
+	return nil
+}
+
 // removeFinalizer removes finalizer from slice, returns slice and whether modified.
 func removeFinalizer(finalizers []string, finalizerToRemove string) ([]string, bool) {
 	for i, finalizer := range finalizers {
@@ -1661,15 +4757,35 @@ func (ctrl *ProvisionController) getProvisionedVolumeNameForClaim(claim *v1.Pers
 	return "pvc-" + string(claim.UID)
 }
 
-// getStorageClass retrives storage class object by name.
-func (ctrl *ProvisionController) getStorageClass(name string) (*storage.StorageClass, error) {
+// getStorageClass retrives storage class object by name from the informer
+// cache. A class missing in the cache, e.g. because it has been created just
+// now, is fetched from API server. The returned class is a copy that callers
+// may pass to provisioners.
+func (ctrl *ProvisionController) getStorageClass(ctx context.Context, name string) (*storage.StorageClass, error) {
+	if ctrl.classesUnavailable.Load() {
+		return ctrl.getLegacyStorageClass(ctx, name)
+	}
 	classObj, found, err := ctrl.classes.GetByKey(name)
 	if err != nil {
 		return nil, err
 	}
 	if !found {
-		return nil, fmt.Errorf("storageClass %q not found", name)
+		class, err := ctrl.objectClient.StorageV1().StorageClasses().Get(ctx, name, metav1.GetOptions{})
+		if apierrs.IsNotFound(err) {
+			return nil, fmt.Errorf("storageClass %q not found", name)
+		}
+		return class, err
+	}
+	class, err := toStorageClass(classObj)
+	if err != nil {
+		return nil, err
 	}
+	return class.DeepCopy(), nil
+}
+
+// toStorageClass converts a cached storage.k8s.io/v1 or v1beta1 class to
+// storage.StorageClass. The result shares data with the cache.
+func toStorageClass(classObj interface{}) (*storage.StorageClass, error) {
 	switch class := classObj.(type) {
 	case *storage.StorageClass:
 		return class, nil
@@ -1699,6 +4815,13 @@ func (ctrl *ProvisionController) supportsBlock(ctx context.Context) bool {
 	return false
 }
 
+func (ctrl *ProvisionController) supportsReadWriteOncePod(ctx context.Context) bool {
+	if supporter, ok := ctrl.provisioner.(ReadWriteOncePodSupporter); ok {
+		return supporter.SupportsReadWriteOncePod(ctx)
+	}
+	return false
+}
+
 func getString(m map[string]string, key string, alts ...string) (string, bool) {
 	if m == nil {
 		return "", false
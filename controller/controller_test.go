@@ -18,34 +18,71 @@ package controller
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"math"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/http/httptest"
 	"reflect"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/go-logr/logr/funcr"
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	dto "github.com/prometheus/client_model/go"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	coordinationv1 "k8s.io/api/coordination/v1"
 	v1 "k8s.io/api/core/v1"
 	storage "k8s.io/api/storage/v1"
+	storagealpha "k8s.io/api/storage/v1alpha1"
+	storagebeta "k8s.io/api/storage/v1beta1"
+	apierrs "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/types"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	"k8s.io/apimachinery/pkg/util/sets"
 	"k8s.io/apimachinery/pkg/util/uuid"
+	"k8s.io/apimachinery/pkg/util/wait"
+	corev1ac "k8s.io/client-go/applyconfigurations/core/v1"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
 	"k8s.io/client-go/informers"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/kubernetes/fake"
 	"k8s.io/client-go/kubernetes/scheme"
+	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
+	corelistersv1 "k8s.io/client-go/listers/core/v1"
+	metadatafake "k8s.io/client-go/metadata/fake"
 	testclient "k8s.io/client-go/testing"
 	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
 	ref "k8s.io/client-go/tools/reference"
 	"k8s.io/client-go/util/workqueue"
 	klog "k8s.io/klog/v2"
 	"k8s.io/klog/v2/ktesting"
 	_ "k8s.io/klog/v2/ktesting/init"
+	"k8s.io/utils/clock"
+	testingclock "k8s.io/utils/clock/testing"
+	"k8s.io/utils/ptr"
 	"sigs.k8s.io/sig-storage-lib-external-provisioner/v10/controller/metrics"
 )
 
@@ -127,11 +164,6 @@ func TestController(t *testing.T) {
 			},
 			provisionerName: "foo.bar/baz",
 			provisioner:     newTestProvisioner(),
-			expectedMetrics: testMetrics{
-				provisioned: counts{
-					"class-1": count{failed: 1},
-				},
-			},
 		},
 		{
 			name: "provision for claim-1 with storage class provisioner name distinct from controller provisioner name",
@@ -154,13 +186,13 @@ func TestController(t *testing.T) {
 		{
 			name: "delete volume-1 but not volume-2",
 			objs: []runtime.Object{
-				newVolume("volume-1", v1.VolumeReleased, v1.PersistentVolumeReclaimDelete, map[string]string{annDynamicallyProvisioned: "foo.bar/baz"}, nil, nil),
-				newVolume("volume-2", v1.VolumeReleased, v1.PersistentVolumeReclaimDelete, map[string]string{annDynamicallyProvisioned: "abc.def/ghi"}, nil, nil),
+				newVolume("volume-1", v1.VolumeReleased, v1.PersistentVolumeReclaimDelete, map[string]string{AnnDynamicallyProvisioned: "foo.bar/baz"}, nil, nil),
+				newVolume("volume-2", v1.VolumeReleased, v1.PersistentVolumeReclaimDelete, map[string]string{AnnDynamicallyProvisioned: "abc.def/ghi"}, nil, nil),
 			},
 			provisionerName: "foo.bar/baz",
 			provisioner:     newTestProvisioner(),
 			expectedVolumes: []v1.PersistentVolume{
-				*newVolume("volume-2", v1.VolumeReleased, v1.PersistentVolumeReclaimDelete, map[string]string{annDynamicallyProvisioned: "abc.def/ghi"}, nil, nil),
+				*newVolume("volume-2", v1.VolumeReleased, v1.PersistentVolumeReclaimDelete, map[string]string{AnnDynamicallyProvisioned: "abc.def/ghi"}, nil, nil),
 			},
 			expectedMetrics: testMetrics{
 				deleted: counts{
@@ -194,23 +226,23 @@ func TestController(t *testing.T) {
 		{
 			name: "don't delete volume-1 because it's still bound",
 			objs: []runtime.Object{
-				newVolume("volume-1", v1.VolumeBound, v1.PersistentVolumeReclaimDelete, map[string]string{annDynamicallyProvisioned: "foo.bar/baz"}, nil, nil),
+				newVolume("volume-1", v1.VolumeBound, v1.PersistentVolumeReclaimDelete, map[string]string{AnnDynamicallyProvisioned: "foo.bar/baz"}, nil, nil),
 			},
 			provisionerName: "foo.bar/baz",
 			provisioner:     newTestProvisioner(),
 			expectedVolumes: []v1.PersistentVolume{
-				*newVolume("volume-1", v1.VolumeBound, v1.PersistentVolumeReclaimDelete, map[string]string{annDynamicallyProvisioned: "foo.bar/baz"}, nil, nil),
+				*newVolume("volume-1", v1.VolumeBound, v1.PersistentVolumeReclaimDelete, map[string]string{AnnDynamicallyProvisioned: "foo.bar/baz"}, nil, nil),
 			},
 		},
 		{
 			name: "don't delete volume-1 because its reclaim policy is not delete",
 			objs: []runtime.Object{
-				newVolume("volume-1", v1.VolumeReleased, v1.PersistentVolumeReclaimRetain, map[string]string{annDynamicallyProvisioned: "foo.bar/baz"}, nil, nil),
+				newVolume("volume-1", v1.VolumeReleased, v1.PersistentVolumeReclaimRetain, map[string]string{AnnDynamicallyProvisioned: "foo.bar/baz"}, nil, nil),
 			},
 			provisionerName: "foo.bar/baz",
 			provisioner:     newTestProvisioner(),
 			expectedVolumes: []v1.PersistentVolume{
-				*newVolume("volume-1", v1.VolumeReleased, v1.PersistentVolumeReclaimRetain, map[string]string{annDynamicallyProvisioned: "foo.bar/baz"}, nil, nil),
+				*newVolume("volume-1", v1.VolumeReleased, v1.PersistentVolumeReclaimRetain, map[string]string{AnnDynamicallyProvisioned: "foo.bar/baz"}, nil, nil),
 			},
 		},
 		{
@@ -231,12 +263,12 @@ func TestController(t *testing.T) {
 		{
 			name: "provisioner fails to delete volume-1: pv is not deleted",
 			objs: []runtime.Object{
-				newVolume("volume-1", v1.VolumeReleased, v1.PersistentVolumeReclaimDelete, map[string]string{annDynamicallyProvisioned: "foo.bar/baz"}, nil, nil),
+				newVolume("volume-1", v1.VolumeReleased, v1.PersistentVolumeReclaimDelete, map[string]string{AnnDynamicallyProvisioned: "foo.bar/baz"}, nil, nil),
 			},
 			provisionerName: "foo.bar/baz",
 			provisioner:     newBadTestProvisioner(),
 			expectedVolumes: []v1.PersistentVolume{
-				*newVolume("volume-1", v1.VolumeReleased, v1.PersistentVolumeReclaimDelete, map[string]string{annDynamicallyProvisioned: "foo.bar/baz"}, nil, nil),
+				*newVolume("volume-1", v1.VolumeReleased, v1.PersistentVolumeReclaimDelete, map[string]string{AnnDynamicallyProvisioned: "foo.bar/baz"}, nil, nil),
 			},
 			expectedMetrics: testMetrics{
 				deleted: counts{
@@ -266,7 +298,7 @@ func TestController(t *testing.T) {
 		{
 			name: "try to delete volume-1 but fail to delete the pv object",
 			objs: []runtime.Object{
-				newVolume("volume-1", v1.VolumeReleased, v1.PersistentVolumeReclaimDelete, map[string]string{annDynamicallyProvisioned: "foo.bar/baz"}, nil, nil),
+				newVolume("volume-1", v1.VolumeReleased, v1.PersistentVolumeReclaimDelete, map[string]string{AnnDynamicallyProvisioned: "foo.bar/baz"}, nil, nil),
 			},
 			provisionerName: "foo.bar/baz",
 			provisioner:     newTestProvisioner(),
@@ -275,7 +307,7 @@ func TestController(t *testing.T) {
 				return true, nil, errors.New("fake error")
 			},
 			expectedVolumes: []v1.PersistentVolume{
-				*newVolume("volume-1", v1.VolumeReleased, v1.PersistentVolumeReclaimDelete, map[string]string{annDynamicallyProvisioned: "foo.bar/baz"}, nil, nil),
+				*newVolume("volume-1", v1.VolumeReleased, v1.PersistentVolumeReclaimDelete, map[string]string{AnnDynamicallyProvisioned: "foo.bar/baz"}, nil, nil),
 			},
 			expectedMetrics: testMetrics{
 				deleted: counts{
@@ -523,13 +555,13 @@ func TestController(t *testing.T) {
 			name: "remove selectedNode and claim on reschedule",
 			objs: []runtime.Object{
 				newStorageClassWithVolumeBindingMode("class-1", "foo.bar/baz", &modeWait),
-				newClaim("claim-1", "uid-1-1", "class-1", "foo.bar/baz", "", map[string]string{annBetaStorageProvisioner: "foo.bar/baz", annSelectedNode: "node-1"}),
+				newClaim("claim-1", "uid-1-1", "class-1", "foo.bar/baz", "", map[string]string{AnnBetaStorageProvisioner: "foo.bar/baz", AnnSelectedNode: "node-1"}),
 				newNode("node-1"),
 			},
 			provisionerName: "foo.bar/baz",
 			provisioner:     newRescheduleTestProvisioner(),
 			expectedClaims: []v1.PersistentVolumeClaim{
-				*newClaim("claim-1", "uid-1-1", "class-1", "foo.bar/baz", "", map[string]string{annBetaStorageProvisioner: "foo.bar/baz"}),
+				*newClaim("claim-1", "uid-1-1", "class-1", "foo.bar/baz", "", map[string]string{AnnBetaStorageProvisioner: "foo.bar/baz"}),
 			},
 			expectedClaimsInProgress: nil, // not in progress anymore
 			expectedMetrics: testMetrics{
@@ -539,16 +571,16 @@ func TestController(t *testing.T) {
 			},
 		},
 		{
-			name: "do not remove selectedNode after final error, only the claim",
+			name: "remove selectedNode when the provisioner requests reschedule",
 			objs: []runtime.Object{
 				newStorageClassWithVolumeBindingMode("class-1", "foo.bar/baz", &modeWait),
-				newClaim("claim-1", "uid-1-1", "class-1", "foo.bar/baz", "", map[string]string{annBetaStorageProvisioner: "foo.bar/baz", annSelectedNode: "node-1"}),
+				newClaim("claim-1", "uid-1-1", "class-1", "foo.bar/baz", "", map[string]string{AnnBetaStorageProvisioner: "foo.bar/baz", AnnSelectedNode: "node-1"}),
 				newNode("node-1"),
 			},
 			provisionerName: "foo.bar/baz",
-			provisioner:     newBadTestProvisioner(),
+			provisioner:     &rescheduleTestProvisioner{noError: true},
 			expectedClaims: []v1.PersistentVolumeClaim{
-				*newClaim("claim-1", "uid-1-1", "class-1", "foo.bar/baz", "", map[string]string{annBetaStorageProvisioner: "foo.bar/baz", annSelectedNode: "node-1"}),
+				*newClaim("claim-1", "uid-1-1", "class-1", "foo.bar/baz", "", map[string]string{AnnBetaStorageProvisioner: "foo.bar/baz"}),
 			},
 			expectedClaimsInProgress: nil, // not in progress anymore
 			expectedMetrics: testMetrics{
@@ -558,15 +590,16 @@ func TestController(t *testing.T) {
 			},
 		},
 		{
-			name: "remove selectedNode if no node exists",
+			name: "do not remove selectedNode after final error, only the claim",
 			objs: []runtime.Object{
 				newStorageClassWithVolumeBindingMode("class-1", "foo.bar/baz", &modeWait),
-				newClaim("claim-1", "uid-1-1", "class-1", "foo.bar/baz", "", map[string]string{annBetaStorageProvisioner: "foo.bar/baz", annSelectedNode: "node-wrong"}),
+				newClaim("claim-1", "uid-1-1", "class-1", "foo.bar/baz", "", map[string]string{AnnBetaStorageProvisioner: "foo.bar/baz", AnnSelectedNode: "node-1"}),
+				newNode("node-1"),
 			},
 			provisionerName: "foo.bar/baz",
 			provisioner:     newBadTestProvisioner(),
 			expectedClaims: []v1.PersistentVolumeClaim{
-				*newClaim("claim-1", "uid-1-1", "class-1", "foo.bar/baz", "", map[string]string{annBetaStorageProvisioner: "foo.bar/baz"}),
+				*newClaim("claim-1", "uid-1-1", "class-1", "foo.bar/baz", "", map[string]string{AnnBetaStorageProvisioner: "foo.bar/baz", AnnSelectedNode: "node-1"}),
 			},
 			expectedClaimsInProgress: nil, // not in progress anymore
 			expectedMetrics: testMetrics{
@@ -575,17 +608,32 @@ func TestController(t *testing.T) {
 				},
 			},
 		},
+		{
+			name: "remove selectedNode if no node exists",
+			objs: []runtime.Object{
+				newStorageClassWithVolumeBindingMode("class-1", "foo.bar/baz", &modeWait),
+				newClaim("claim-1", "uid-1-1", "class-1", "foo.bar/baz", "", map[string]string{AnnBetaStorageProvisioner: "foo.bar/baz", AnnSelectedNode: "node-wrong"}),
+			},
+			provisionerName: "foo.bar/baz",
+			provisioner:     newBadTestProvisioner(),
+			expectedClaims: []v1.PersistentVolumeClaim{
+				*newClaim("claim-1", "uid-1-1", "class-1", "foo.bar/baz", "", map[string]string{AnnBetaStorageProvisioner: "foo.bar/baz"}),
+			},
+			expectedClaimsInProgress: nil, // not in progress anymore
+			// Waiting for reschedule is not a provisioning failure.
+			expectedMetrics: testMetrics{},
+		},
 		{
 			name: "do not remove selectedNode if nothing changes",
 			objs: []runtime.Object{
 				newStorageClassWithVolumeBindingMode("class-1", "foo.bar/baz", &modeWait),
-				newClaim("claim-1", "uid-1-1", "class-1", "foo.bar/baz", "", map[string]string{annBetaStorageProvisioner: "foo.bar/baz", annSelectedNode: "node-1"}),
+				newClaim("claim-1", "uid-1-1", "class-1", "foo.bar/baz", "", map[string]string{AnnBetaStorageProvisioner: "foo.bar/baz", AnnSelectedNode: "node-1"}),
 				newNode("node-1"),
 			},
 			provisionerName: "foo.bar/baz",
 			provisioner:     newNoChangeTestProvisioner(),
 			expectedClaims: []v1.PersistentVolumeClaim{
-				*newClaim("claim-1", "uid-1-1", "class-1", "foo.bar/baz", "", map[string]string{annBetaStorageProvisioner: "foo.bar/baz", annSelectedNode: "node-1"}),
+				*newClaim("claim-1", "uid-1-1", "class-1", "foo.bar/baz", "", map[string]string{AnnBetaStorageProvisioner: "foo.bar/baz", AnnSelectedNode: "node-1"}),
 			},
 			expectedMetrics: testMetrics{
 				provisioned: counts{
@@ -597,30 +645,27 @@ func TestController(t *testing.T) {
 			name: "remove selectedNode if nothing changes and no node exists",
 			objs: []runtime.Object{
 				newStorageClassWithVolumeBindingMode("class-1", "foo.bar/baz", &modeWait),
-				newClaim("claim-1", "uid-1-1", "class-1", "foo.bar/baz", "", map[string]string{annBetaStorageProvisioner: "foo.bar/baz", annSelectedNode: "node-wrong"}),
+				newClaim("claim-1", "uid-1-1", "class-1", "foo.bar/baz", "", map[string]string{AnnBetaStorageProvisioner: "foo.bar/baz", AnnSelectedNode: "node-wrong"}),
 			},
 			provisionerName: "foo.bar/baz",
 			provisioner:     newNoChangeTestProvisioner(),
 			expectedClaims: []v1.PersistentVolumeClaim{
-				*newClaim("claim-1", "uid-1-1", "class-1", "foo.bar/baz", "", map[string]string{annBetaStorageProvisioner: "foo.bar/baz"}),
-			},
-			expectedMetrics: testMetrics{
-				provisioned: counts{
-					"class-1": count{failed: 1},
-				},
+				*newClaim("claim-1", "uid-1-1", "class-1", "foo.bar/baz", "", map[string]string{AnnBetaStorageProvisioner: "foo.bar/baz"}),
 			},
+			// Waiting for reschedule is not a provisioning failure.
+			expectedMetrics: testMetrics{},
 		},
 		{
 			name: "do not remove selectedNode while in progress",
 			objs: []runtime.Object{
 				newStorageClassWithVolumeBindingMode("class-1", "foo.bar/baz", &modeWait),
-				newClaim("claim-1", "uid-1-1", "class-1", "foo.bar/baz", "", map[string]string{annBetaStorageProvisioner: "foo.bar/baz", annSelectedNode: "node-1"}),
+				newClaim("claim-1", "uid-1-1", "class-1", "foo.bar/baz", "", map[string]string{AnnBetaStorageProvisioner: "foo.bar/baz", AnnSelectedNode: "node-1"}),
 				newNode("node-1"),
 			},
 			provisionerName: "foo.bar/baz",
 			provisioner:     newTemporaryTestProvisioner(),
 			expectedClaims: []v1.PersistentVolumeClaim{
-				*newClaim("claim-1", "uid-1-1", "class-1", "foo.bar/baz", "", map[string]string{annBetaStorageProvisioner: "foo.bar/baz", annSelectedNode: "node-1"}),
+				*newClaim("claim-1", "uid-1-1", "class-1", "foo.bar/baz", "", map[string]string{AnnBetaStorageProvisioner: "foo.bar/baz", AnnSelectedNode: "node-1"}),
 			},
 			expectedClaimsInProgress: []string{"uid-1-1"},
 			expectedMetrics: testMetrics{
@@ -650,43 +695,43 @@ func TestController(t *testing.T) {
 		{
 			name: "ensure finalizer is removed if the addFinalizer config option is false",
 			objs: []runtime.Object{
-				newVolume("volume-1", v1.VolumeBound, v1.PersistentVolumeReclaimDelete, map[string]string{annDynamicallyProvisioned: "foo.bar/baz"}, []string{finalizerPV}, nil),
+				newVolume("volume-1", v1.VolumeBound, v1.PersistentVolumeReclaimDelete, map[string]string{AnnDynamicallyProvisioned: "foo.bar/baz"}, []string{finalizerPV}, nil),
 			},
 			addFinalizer:    false,
 			provisionerName: "foo.bar/baz",
 			provisioner:     newTestProvisioner(),
 			expectedVolumes: []v1.PersistentVolume{
-				*newVolume("volume-1", v1.VolumeBound, v1.PersistentVolumeReclaimDelete, map[string]string{annDynamicallyProvisioned: "foo.bar/baz"}, nil, nil),
+				*newVolume("volume-1", v1.VolumeBound, v1.PersistentVolumeReclaimDelete, map[string]string{AnnDynamicallyProvisioned: "foo.bar/baz"}, nil, nil),
 			},
 		},
 		{
 			name: "ensure finalizer is removed if the reclaim policy is Retain or Recycle with addFinalizer enabled",
 			objs: []runtime.Object{
-				newVolume("volume-1", v1.VolumeBound, v1.PersistentVolumeReclaimRetain, map[string]string{annDynamicallyProvisioned: "foo.bar/baz"}, []string{finalizerPV}, nil),
+				newVolume("volume-1", v1.VolumeBound, v1.PersistentVolumeReclaimRetain, map[string]string{AnnDynamicallyProvisioned: "foo.bar/baz"}, []string{finalizerPV}, nil),
 			},
 			addFinalizer:    true,
 			provisionerName: "foo.bar/baz",
 			provisioner:     newTestProvisioner(),
 			expectedVolumes: []v1.PersistentVolume{
-				*newVolume("volume-1", v1.VolumeBound, v1.PersistentVolumeReclaimRetain, map[string]string{annDynamicallyProvisioned: "foo.bar/baz"}, nil, nil),
+				*newVolume("volume-1", v1.VolumeBound, v1.PersistentVolumeReclaimRetain, map[string]string{AnnDynamicallyProvisioned: "foo.bar/baz"}, nil, nil),
 			},
 		},
 		{
 			name: "ensure finalizer is not added if the volume is under deletion, also ensures that volume is not deleted",
 			objs: []runtime.Object{
-				newVolume("volume-1", v1.VolumeReleased, v1.PersistentVolumeReclaimDelete, map[string]string{annDynamicallyProvisioned: "foo.bar/baz"}, nil, &timestamp),
+				newVolume("volume-1", v1.VolumeReleased, v1.PersistentVolumeReclaimDelete, map[string]string{AnnDynamicallyProvisioned: "foo.bar/baz"}, nil, &timestamp),
 			},
 			addFinalizer:    true,
 			provisionerName: "foo.bar/baz",
 			provisioner:     newTestProvisioner(),
 			expectedVolumes: []v1.PersistentVolume{
-				*newVolume("volume-1", v1.VolumeReleased, v1.PersistentVolumeReclaimDelete, map[string]string{annDynamicallyProvisioned: "foo.bar/baz"}, nil, &timestamp),
+				*newVolume("volume-1", v1.VolumeReleased, v1.PersistentVolumeReclaimDelete, map[string]string{AnnDynamicallyProvisioned: "foo.bar/baz"}, nil, &timestamp),
 			},
 		},
 		{
 			name: "ensure volume with finalizer is deleted if it is in a Released state and reclaim policy is Delete",
 			objs: []runtime.Object{
-				newVolume("volume-1", v1.VolumeReleased, v1.PersistentVolumeReclaimDelete, map[string]string{annDynamicallyProvisioned: "foo.bar/baz"}, []string{finalizerPV}, nil),
+				newVolume("volume-1", v1.VolumeReleased, v1.PersistentVolumeReclaimDelete, map[string]string{AnnDynamicallyProvisioned: "foo.bar/baz"}, []string{finalizerPV}, nil),
 			},
 			addFinalizer:    true,
 			provisionerName: "foo.bar/baz",
@@ -700,7 +745,7 @@ func TestController(t *testing.T) {
 		{
 			name: "ensure volume with finalizer is deleted if it is in a Released state and reclaim policy is Delete and already under deletion",
 			objs: []runtime.Object{
-				newVolume("volume-1", v1.VolumeReleased, v1.PersistentVolumeReclaimDelete, map[string]string{annDynamicallyProvisioned: "foo.bar/baz"}, []string{finalizerPV}, &timestamp),
+				newVolume("volume-1", v1.VolumeReleased, v1.PersistentVolumeReclaimDelete, map[string]string{AnnDynamicallyProvisioned: "foo.bar/baz"}, []string{finalizerPV}, &timestamp),
 			},
 			addFinalizer:    true,
 			provisionerName: "foo.bar/baz",
@@ -714,13 +759,13 @@ func TestController(t *testing.T) {
 		{
 			name: "provisioner fails to delete the volume with finalizer, the pv is not deleted",
 			objs: []runtime.Object{
-				newVolume("volume-1", v1.VolumeReleased, v1.PersistentVolumeReclaimDelete, map[string]string{annDynamicallyProvisioned: "foo.bar/baz"}, []string{finalizerPV}, nil),
+				newVolume("volume-1", v1.VolumeReleased, v1.PersistentVolumeReclaimDelete, map[string]string{AnnDynamicallyProvisioned: "foo.bar/baz"}, []string{finalizerPV}, nil),
 			},
 			addFinalizer:    true,
 			provisionerName: "foo.bar/baz",
 			provisioner:     newBadTestProvisioner(),
 			expectedVolumes: []v1.PersistentVolume{
-				*newVolume("volume-1", v1.VolumeReleased, v1.PersistentVolumeReclaimDelete, map[string]string{annDynamicallyProvisioned: "foo.bar/baz"}, []string{finalizerPV}, nil),
+				*newVolume("volume-1", v1.VolumeReleased, v1.PersistentVolumeReclaimDelete, map[string]string{AnnDynamicallyProvisioned: "foo.bar/baz"}, []string{finalizerPV}, nil),
 			},
 			expectedMetrics: testMetrics{
 				deleted: counts{
@@ -731,7 +776,7 @@ func TestController(t *testing.T) {
 		{
 			name: "volume deletion succeeds but the pv deletion fails, the pv still exists",
 			objs: []runtime.Object{
-				newVolume("volume-1", v1.VolumeReleased, v1.PersistentVolumeReclaimDelete, map[string]string{annDynamicallyProvisioned: "foo.bar/baz"}, []string{finalizerPV}, nil),
+				newVolume("volume-1", v1.VolumeReleased, v1.PersistentVolumeReclaimDelete, map[string]string{AnnDynamicallyProvisioned: "foo.bar/baz"}, []string{finalizerPV}, nil),
 			},
 			addFinalizer:    true,
 			provisionerName: "foo.bar/baz",
@@ -741,7 +786,7 @@ func TestController(t *testing.T) {
 				return true, nil, errors.New("fake error")
 			},
 			expectedVolumes: []v1.PersistentVolume{
-				*newVolume("volume-1", v1.VolumeReleased, v1.PersistentVolumeReclaimDelete, map[string]string{annDynamicallyProvisioned: "foo.bar/baz"}, []string{finalizerPV}, nil),
+				*newVolume("volume-1", v1.VolumeReleased, v1.PersistentVolumeReclaimDelete, map[string]string{AnnDynamicallyProvisioned: "foo.bar/baz"}, []string{finalizerPV}, nil),
 			},
 			expectedMetrics: testMetrics{
 				deleted: counts{
@@ -752,25 +797,25 @@ func TestController(t *testing.T) {
 		{
 			name: "ensure finalizer is added on statically provisioned, migrated, in-tree volumes",
 			objs: []runtime.Object{
-				newVolume("volume-1", v1.VolumeBound, v1.PersistentVolumeReclaimDelete, map[string]string{annMigratedTo: "foo.bar/baz"}, nil, nil),
+				newVolume("volume-1", v1.VolumeBound, v1.PersistentVolumeReclaimDelete, map[string]string{AnnMigratedTo: "foo.bar/baz"}, nil, nil),
 			},
 			addFinalizer:    true,
 			provisionerName: "foo.bar/baz",
 			provisioner:     newTestProvisioner(),
 			expectedVolumes: []v1.PersistentVolume{
-				*newVolume("volume-1", v1.VolumeBound, v1.PersistentVolumeReclaimDelete, map[string]string{annMigratedTo: "foo.bar/baz"}, []string{finalizerPV}, nil),
+				*newVolume("volume-1", v1.VolumeBound, v1.PersistentVolumeReclaimDelete, map[string]string{AnnMigratedTo: "foo.bar/baz"}, []string{finalizerPV}, nil),
 			},
 		},
 		{
 			name: "ensure finalizer is added on statically provisioned, migrated, in-tree volumes if it is in a Bound state",
 			objs: []runtime.Object{
-				newVolume("volume-1", v1.VolumeBound, v1.PersistentVolumeReclaimDelete, map[string]string{annMigratedTo: "foo.bar/baz"}, nil, nil),
+				newVolume("volume-1", v1.VolumeBound, v1.PersistentVolumeReclaimDelete, map[string]string{AnnMigratedTo: "foo.bar/baz"}, nil, nil),
 			},
 			addFinalizer:    true,
 			provisionerName: "foo.bar/baz",
 			provisioner:     newTestProvisioner(),
 			expectedVolumes: []v1.PersistentVolume{
-				*newVolume("volume-1", v1.VolumeBound, v1.PersistentVolumeReclaimDelete, map[string]string{annMigratedTo: "foo.bar/baz"}, []string{finalizerPV}, nil),
+				*newVolume("volume-1", v1.VolumeBound, v1.PersistentVolumeReclaimDelete, map[string]string{AnnMigratedTo: "foo.bar/baz"}, []string{finalizerPV}, nil),
 			},
 		},
 		{
@@ -821,7 +866,7 @@ func TestController(t *testing.T) {
 			}
 
 			// Run forever...
-			go ctrl.Run(context.Background())
+			runTestController(t, context.Background(), ctrl.ProvisionController)
 
 			// When we shutdown while something is happening the fake client panics
 			// with send on closed channel...but the test passed, so ignore
@@ -924,7 +969,7 @@ func TestTopologyParams(t *testing.T) {
 			objs: []runtime.Object{
 				newNode("node-1"),
 				newStorageClassWithVolumeBindingMode("class-1", "foo.bar/baz", &modeWait),
-				newClaim("claim-1", "uid-1-1", "class-1", "foo.bar/baz", "", map[string]string{annSelectedNode: "node-1"}),
+				newClaim("claim-1", "uid-1-1", "class-1", "foo.bar/baz", "", map[string]string{AnnSelectedNode: "node-1"}),
 			},
 			expectedParams: &provisionParams{
 				selectedNode: newNode("node-1"),
@@ -933,24 +978,37 @@ func TestTopologyParams(t *testing.T) {
 		{
 			name: "provision with AllowedTopologies and selected node",
 			objs: []runtime.Object{
-				newNode("node-1"),
+				newNodeWithLabels("node-1", map[string]string{"failure-domain.beta.kubernetes.io/zone": "zone1"}),
 				func() *storage.StorageClass {
 					sc := newStorageClassWithVolumeBindingMode("class-1", "foo.bar/baz", &modeWait)
 					sc.AllowedTopologies = dummyAllowedTopology
 					return sc
 				}(),
-				newClaim("claim-1", "uid-1-1", "class-1", "foo.bar/baz", "", map[string]string{annSelectedNode: "node-1"}),
+				newClaim("claim-1", "uid-1-1", "class-1", "foo.bar/baz", "", map[string]string{AnnSelectedNode: "node-1"}),
 			},
 			expectedParams: &provisionParams{
 				allowedTopologies: dummyAllowedTopology,
-				selectedNode:      newNode("node-1"),
+				selectedNode:      newNodeWithLabels("node-1", map[string]string{"failure-domain.beta.kubernetes.io/zone": "zone1"}),
+			},
+		},
+		{
+			name: "provision with AllowedTopologies and selected node in another zone",
+			objs: []runtime.Object{
+				newNodeWithLabels("node-1", map[string]string{"failure-domain.beta.kubernetes.io/zone": "zone2"}),
+				func() *storage.StorageClass {
+					sc := newStorageClassWithVolumeBindingMode("class-1", "foo.bar/baz", &modeWait)
+					sc.AllowedTopologies = dummyAllowedTopology
+					return sc
+				}(),
+				newClaim("claim-1", "uid-1-1", "class-1", "foo.bar/baz", "", map[string]string{AnnSelectedNode: "node-1"}),
 			},
+			expectedParams: nil,
 		},
 		{
 			name: "provision with selected node, but node does not exist",
 			objs: []runtime.Object{
 				newStorageClassWithVolumeBindingMode("class-1", "foo.bar/baz", &modeWait),
-				newClaim("claim-1", "uid-1-1", "class-1", "foo.bar/baz", "", map[string]string{annSelectedNode: "node-1"}),
+				newClaim("claim-1", "uid-1-1", "class-1", "foo.bar/baz", "", map[string]string{AnnSelectedNode: "node-1"}),
 			},
 			expectedParams: nil,
 		},
@@ -962,7 +1020,7 @@ func TestTopologyParams(t *testing.T) {
 			provisioner := newTestProvisioner()
 			ctrl := newTestProvisionController(logger, client, "foo.bar/baz" /* provisionerName */, provisioner)
 			// Run forever...
-			go ctrl.Run(context.Background())
+			runTestController(t, context.Background(), ctrl.ProvisionController)
 
 			// When we shutdown while something is happening the fake client panics
 			// with send on closed channel...but the test passed, so ignore
@@ -1040,7 +1098,7 @@ func TestShouldProvision(t *testing.T) {
 			claim:           newClaim("claim-1", "1-1", "class-1", "abc.def/ghi", "", nil),
 			expectedShould:  false,
 		},
-		// Kubernetes 1.5 provisioning - annBetaStorageProvisioner is set
+		// Kubernetes 1.5 provisioning - AnnBetaStorageProvisioner is set
 		// and only this annotation is evaluated
 		{
 			name:            "unknown provisioner annotation 1.5",
@@ -1048,10 +1106,10 @@ func TestShouldProvision(t *testing.T) {
 			provisioner:     newTestProvisioner(),
 			class:           newStorageClass("class-1", "foo.bar/baz"),
 			claim: newClaim("claim-1", "1-1", "class-1", "", "",
-				map[string]string{annBetaStorageProvisioner: "abc.def/ghi"}),
+				map[string]string{AnnBetaStorageProvisioner: "abc.def/ghi"}),
 			expectedShould: false,
 		},
-		// Kubernetes 1.5 provisioning - annBetaStorageProvisioner is not set
+		// Kubernetes 1.5 provisioning - AnnBetaStorageProvisioner is not set
 		{
 			name:            "no provisioner annotation 1.5",
 			provisionerName: "foo.bar/baz",
@@ -1059,14 +1117,14 @@ func TestShouldProvision(t *testing.T) {
 			claim:           newClaim("claim-1", "1-1", "class-1", "", "", nil),
 			expectedShould:  false,
 		},
-		// Kubernetes 1.23 provisioning - annStorageProvisioner is set
+		// Kubernetes 1.23 provisioning - AnnStorageProvisioner is set
 		{
 			name:            "unknown provisioner annotation 1.23",
 			provisionerName: "foo.bar/baz",
 			provisioner:     newTestProvisioner(),
 			class:           newStorageClass("class-1", "foo.bar/baz"),
 			claim: newClaim("claim-1", "1-1", "class-1", "", "",
-				map[string]string{annStorageProvisioner: "abc.def/ghi"}),
+				map[string]string{AnnStorageProvisioner: "abc.def/ghi"}),
 			expectedShould: false,
 		},
 		{
@@ -1090,7 +1148,7 @@ func TestShouldProvision(t *testing.T) {
 			provisionerName: "foo.bar/baz",
 			provisioner:     newTestProvisioner(),
 			class:           newStorageClassWithVolumeBindingMode("class-1", "foo.bar/baz", &modeWait),
-			claim:           newClaim("claim-1", "1-1", "class-1", "", "", map[string]string{annBetaStorageProvisioner: "foo.bar/baz"}),
+			claim:           newClaim("claim-1", "1-1", "class-1", "", "", map[string]string{AnnBetaStorageProvisioner: "foo.bar/baz"}),
 			expectedShould:  false,
 		},
 		{
@@ -1098,7 +1156,7 @@ func TestShouldProvision(t *testing.T) {
 			provisionerName: "foo.bar/baz",
 			provisioner:     newTestProvisioner(),
 			class:           newStorageClassWithVolumeBindingMode("class-1", "foo.bar/baz", &modeWait),
-			claim:           newClaim("claim-1", "1-1", "class-1", "", "", map[string]string{annBetaStorageProvisioner: "foo.bar/baz", annSelectedNode: "node1"}),
+			claim:           newClaim("claim-1", "1-1", "class-1", "", "", map[string]string{AnnBetaStorageProvisioner: "foo.bar/baz", AnnSelectedNode: "node1"}),
 			expectedShould:  true,
 		},
 		{
@@ -1106,7 +1164,7 @@ func TestShouldProvision(t *testing.T) {
 			provisionerName: "foo.bar/baz",
 			provisioner:     newTestProvisioner(),
 			class:           newStorageClassWithVolumeBindingMode("class-1", "foo.bar/baz", &modeWait),
-			claim:           newClaim("claim-1", "1-1", "class-1", "", "", map[string]string{annStorageProvisioner: "foo.bar/baz", annSelectedNode: "node1"}),
+			claim:           newClaim("claim-1", "1-1", "class-1", "", "", map[string]string{AnnStorageProvisioner: "foo.bar/baz", AnnSelectedNode: "node1"}),
 			expectedShould:  true,
 		},
 	}
@@ -1140,6 +1198,446 @@ func TestShouldProvision(t *testing.T) {
 	}
 }
 
+func TestProvisionSkipReason(t *testing.T) {
+	tests := []struct {
+		name           string
+		provisioner    Provisioner
+		options        []func(*ProvisionController) error
+		class          *storage.StorageClass
+		claim          *v1.PersistentVolumeClaim
+		expectedReason SkipReason
+	}{
+		{
+			name:           "bound claim",
+			provisioner:    newTestProvisioner(),
+			class:          newStorageClass("class-1", "foo.bar/baz"),
+			claim:          newClaim("claim-1", "1-1", "class-1", "foo.bar/baz", "foo", nil),
+			expectedReason: SkipReasonAlreadyBound,
+		},
+		{
+			name:           "rejected by qualifier",
+			provisioner:    newTestQualifiedProvisioner(false),
+			class:          newStorageClass("class-1", "foo.bar/baz"),
+			claim:          newClaim("claim-1", "1-1", "class-1", "foo.bar/baz", "", nil),
+			expectedReason: SkipReasonRejectedByProvisioner,
+		},
+		{
+			name:           "no provisioner annotation",
+			provisioner:    newTestProvisioner(),
+			class:          newStorageClass("class-1", "foo.bar/baz"),
+			claim:          newClaim("claim-1", "1-1", "class-1", "", "", nil),
+			expectedReason: SkipReasonNoProvisionerAnnotation,
+		},
+		{
+			name:           "other provisioner",
+			provisioner:    newTestProvisioner(),
+			class:          newStorageClass("class-1", "abc.def/ghi"),
+			claim:          newClaim("claim-1", "1-1", "class-1", "abc.def/ghi", "", nil),
+			expectedReason: SkipReasonOtherProvisioner,
+		},
+		{
+			name:           "waiting for first consumer",
+			provisioner:    newTestProvisioner(),
+			class:          newStorageClassWithVolumeBindingMode("class-1", "foo.bar/baz", &modeWait),
+			claim:          newClaim("claim-1", "1-1", "class-1", "foo.bar/baz", "", nil),
+			expectedReason: SkipReasonWaitingForFirstConsumer,
+		},
+		{
+			name:           "selected node required",
+			provisioner:    newTestProvisioner(),
+			options:        []func(*ProvisionController) error{RequireSelectedNode(true)},
+			class:          newStorageClass("class-1", "foo.bar/baz"),
+			claim:          newClaim("claim-1", "1-1", "class-1", "foo.bar/baz", "", nil),
+			expectedReason: SkipReasonSelectedNodeRequired,
+		},
+		{
+			name:        "selected node required and present",
+			provisioner: newTestProvisioner(),
+			options:     []func(*ProvisionController) error{RequireSelectedNode(true)},
+			class:       newStorageClass("class-1", "foo.bar/baz"),
+			claim:       newClaim("claim-1", "1-1", "class-1", "foo.bar/baz", "", map[string]string{AnnSelectedNode: "node-1"}),
+		},
+		{
+			name:           "unknown populator",
+			provisioner:    newTestProvisioner(),
+			class:          newStorageClass("class-1", "foo.bar/baz"),
+			claim:          withDataSource(newClaim("claim-1", "1-1", "class-1", "foo.bar/baz", "", nil), "populator.example.com", "Backup"),
+			expectedReason: SkipReasonForeignDataSource,
+		},
+		{
+			name:           "core kind other than claim",
+			provisioner:    newTestProvisioner(),
+			class:          newStorageClass("class-1", "foo.bar/baz"),
+			claim:          withDataSource(newClaim("claim-1", "1-1", "class-1", "foo.bar/baz", "", nil), "", "ConfigMap"),
+			expectedReason: SkipReasonForeignDataSource,
+		},
+		{
+			name:        "supported populator",
+			provisioner: newTestProvisioner(),
+			options:     []func(*ProvisionController) error{SupportedDataSources(schema.GroupKind{Group: "populator.example.com", Kind: "Backup"})},
+			class:       newStorageClass("class-1", "foo.bar/baz"),
+			claim:       withDataSource(newClaim("claim-1", "1-1", "class-1", "foo.bar/baz", "", nil), "populator.example.com", "Backup"),
+		},
+		{
+			name:        "foreign data sources provisioned",
+			provisioner: newTestProvisioner(),
+			options:     []func(*ProvisionController) error{ProvisionForeignDataSources(true)},
+			class:       newStorageClass("class-1", "foo.bar/baz"),
+			claim:       withDataSource(newClaim("claim-1", "1-1", "class-1", "foo.bar/baz", "", nil), "populator.example.com", "Backup"),
+		},
+		{
+			name:        "snapshot",
+			provisioner: newTestProvisioner(),
+			class:       newStorageClass("class-1", "foo.bar/baz"),
+			claim:       withDataSource(newClaim("claim-1", "1-1", "class-1", "foo.bar/baz", "", nil), "snapshot.storage.k8s.io", "VolumeSnapshot"),
+		},
+		{
+			name:        "clone",
+			provisioner: &cloneTestProvisioner{newTestProvisioner()},
+			class:       newStorageClass("class-1", "foo.bar/baz"),
+			claim:       withDataSource(newClaim("claim-1", "1-1", "class-1", "foo.bar/baz", "", nil), "", "PersistentVolumeClaim"),
+		},
+		{
+			name:           "clone not supported",
+			provisioner:    newTestProvisioner(),
+			class:          newStorageClass("class-1", "foo.bar/baz"),
+			claim:          withDataSource(newClaim("claim-1", "1-1", "class-1", "foo.bar/baz", "", nil), "", "PersistentVolumeClaim"),
+			expectedReason: SkipReasonCloneNotSupported,
+		},
+		{
+			name:        "provision",
+			provisioner: newTestProvisioner(),
+			class:       newStorageClass("class-1", "foo.bar/baz"),
+			claim:       newClaim("claim-1", "1-1", "class-1", "foo.bar/baz", "", nil),
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var lines []string
+			logger := funcr.New(func(prefix, args string) {
+				lines = append(lines, args)
+			}, funcr.Options{Verbosity: DefaultSkipLogVerbosity})
+			ctx := klog.NewContext(context.Background(), logger)
+			ctrl := newTestProvisionController(logger, fake.NewSimpleClientset(test.claim), "foo.bar/baz", test.provisioner, test.options...)
+			ctrl.classes.Add(test.class)
+
+			reason, err := ctrl.provisionSkipReason(ctx, test.claim)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if reason != test.expectedReason {
+				t.Errorf("expected reason %q, got %q", test.expectedReason, reason)
+			}
+
+			lines = nil
+			should, err := ctrl.shouldProvision(ctx, test.claim)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if should != (test.expectedReason == "") {
+				t.Errorf("expected should provision %v, got %v", test.expectedReason == "", should)
+			}
+			logged := false
+			for _, line := range lines {
+				if strings.Contains(line, `"msg"="Skipping claim"`) {
+					logged = true
+					if !strings.Contains(line, fmt.Sprintf(`"reason"="%s"`, test.expectedReason)) {
+						t.Errorf("expected reason %q in log line %s", test.expectedReason, line)
+					}
+				}
+			}
+			if logged != (test.expectedReason != "") {
+				t.Errorf("expected skip log line: %v, got lines %v", test.expectedReason != "", lines)
+			}
+		})
+	}
+}
+
+func TestBlockVolumeModeSkip(t *testing.T) {
+	tests := []struct {
+		name          string
+		provisioner   Provisioner
+		volumeMode    v1.PersistentVolumeMode
+		expectedSkip  bool
+		expectedEvent bool
+	}{
+		{
+			name:        "filesystem claim, provisioner w/o BlockProvisioner",
+			provisioner: newTestProvisioner(),
+			volumeMode:  v1.PersistentVolumeFilesystem,
+		},
+		{
+			name:          "block claim, provisioner w/o BlockProvisioner",
+			provisioner:   newTestProvisioner(),
+			volumeMode:    v1.PersistentVolumeBlock,
+			expectedSkip:  true,
+			expectedEvent: true,
+		},
+		{
+			name:        "filesystem claim, BlockProvisioner",
+			provisioner: newTestBlockProvisioner(true),
+			volumeMode:  v1.PersistentVolumeFilesystem,
+		},
+		{
+			name:        "block claim, BlockProvisioner",
+			provisioner: newTestBlockProvisioner(true),
+			volumeMode:  v1.PersistentVolumeBlock,
+		},
+		{
+			name:          "block claim, BlockProvisioner without block support",
+			provisioner:   newTestBlockProvisioner(false),
+			volumeMode:    v1.PersistentVolumeBlock,
+			expectedSkip:  true,
+			expectedEvent: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			logger, ctx := ktesting.NewTestContext(t)
+			class := newStorageClass("class-1", "foo.bar/baz")
+			claim := newClaimWithVolumeMode("claim-1", "uid-1-1", "class-1", "foo.bar/baz", "", nil, test.volumeMode)
+			ctrl := newTestProvisionController(logger, fake.NewSimpleClientset(claim), "foo.bar/baz", test.provisioner)
+			recorder := record.NewFakeRecorder(10)
+			ctrl.eventRecorder = recorder
+			ctrl.classes.Add(class)
+
+			// The second sync must not send the event again.
+			for i := 0; i < 2; i++ {
+				should, err := ctrl.shouldProvision(ctx, claim)
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if should == test.expectedSkip {
+					t.Errorf("expected should provision %v, got %v", !test.expectedSkip, should)
+				}
+			}
+			var events []string
+			for len(recorder.Events) > 0 {
+				events = append(events, <-recorder.Events)
+			}
+			if !test.expectedEvent {
+				if len(events) > 0 {
+					t.Errorf("expected no events, got %v", events)
+				}
+				return
+			}
+			if len(events) != 1 || !strings.HasPrefix(events[0], "Warning BlockVolumeModeNotSupported") || !strings.Contains(events[0], "does not support block volume mode") {
+				t.Errorf("expected one BlockVolumeModeNotSupported event, got %v", events)
+			}
+			if err := ctrl.syncClaim(ctx, claim); err != nil {
+				t.Errorf("expected skipped claim not to be retried, got %v", err)
+			}
+		})
+	}
+}
+
+func TestReadWriteOncePod(t *testing.T) {
+	rwop := []v1.PersistentVolumeAccessMode{v1.ReadWriteOncePod}
+	tests := []struct {
+		name          string
+		provisioner   Provisioner
+		accessModes   []v1.PersistentVolumeAccessMode
+		expectedEvent string
+		expectedError string
+	}{
+		{
+			name:        "RWO claim, provisioner w/o ReadWriteOncePodSupporter",
+			provisioner: newTestProvisioner(),
+			accessModes: []v1.PersistentVolumeAccessMode{v1.ReadWriteOnce},
+		},
+		{
+			name:          "RWOP claim, provisioner w/o ReadWriteOncePodSupporter",
+			provisioner:   newTestProvisioner(),
+			accessModes:   rwop,
+			expectedEvent: "Warning ReadWriteOncePodNotSupported",
+		},
+		{
+			name:          "RWOP claim, ReadWriteOncePodSupporter without support",
+			provisioner:   &rwopTestProvisioner{testProvisioner: newTestProvisioner()},
+			accessModes:   rwop,
+			expectedEvent: "Warning ReadWriteOncePodNotSupported",
+		},
+		{
+			name:        "RWOP claim, ReadWriteOncePodSupporter",
+			provisioner: &rwopTestProvisioner{testProvisioner: newTestProvisioner(), supported: true},
+			accessModes: rwop,
+		},
+		{
+			name:          "RWOP and RWO claim, ReadWriteOncePodSupporter",
+			provisioner:   &rwopTestProvisioner{testProvisioner: newTestProvisioner(), supported: true},
+			accessModes:   []v1.PersistentVolumeAccessMode{v1.ReadWriteOncePod, v1.ReadWriteOnce},
+			expectedEvent: "Warning ReadWriteOncePodWithOtherModes",
+		},
+		{
+			name:          "RWOP claim, ReadWriteOncePodSupporter returning RWO PV",
+			provisioner:   &rwopTestProvisioner{testProvisioner: newTestProvisioner(), supported: true, accessModes: []v1.PersistentVolumeAccessMode{v1.ReadWriteOnce}},
+			accessModes:   rwop,
+			expectedError: "spec.accessModes: Invalid value",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			logger, ctx := ktesting.NewTestContext(t)
+			class := newStorageClass("class-1", "foo.bar/baz")
+			claim := newClaim("claim-1", "uid-1-1", "class-1", "foo.bar/baz", "", nil)
+			claim.Spec.AccessModes = test.accessModes
+			client := fake.NewSimpleClientset(claim)
+			ctrl := newTestProvisionController(logger, client, "foo.bar/baz", test.provisioner)
+			recorder := record.NewFakeRecorder(10)
+			ctrl.eventRecorder = recorder
+			ctrl.classes.Add(class)
+
+			// The second sync must not send the event again.
+			for i := 0; i < 2; i++ {
+				should, err := ctrl.shouldProvision(ctx, claim)
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if should != (test.expectedEvent == "") {
+					t.Errorf("expected should provision %v, got %v", test.expectedEvent == "", should)
+				}
+			}
+			if test.expectedEvent != "" {
+				var events []string
+				for len(recorder.Events) > 0 {
+					events = append(events, <-recorder.Events)
+				}
+				if len(events) != 1 || !strings.HasPrefix(events[0], test.expectedEvent) {
+					t.Errorf("expected one %q event, got %v", test.expectedEvent, events)
+				}
+				return
+			}
+
+			_, err := ctrl.provisionClaimOperation(ctx, claim)
+			if test.expectedError != "" {
+				if err == nil {
+					t.Fatalf("expected error, got none")
+				}
+				var events []string
+				for len(recorder.Events) > 0 {
+					events = append(events, <-recorder.Events)
+				}
+				if len(events) != 2 || !strings.Contains(events[1], test.expectedError) {
+					t.Errorf("expected ProvisioningFailed event with %q, got %v", test.expectedError, events)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			volume, err := client.CoreV1().PersistentVolumes().Get(ctx, "pvc-uid-1-1", metav1.GetOptions{})
+			if err != nil {
+				t.Fatalf("expected PV to be saved: %v", err)
+			}
+			if !reflect.DeepEqual(volume.Spec.AccessModes, test.accessModes) {
+				t.Errorf("expected access modes %v, got %v", test.accessModes, volume.Spec.AccessModes)
+			}
+		})
+	}
+}
+
+func TestAllowedFSTypes(t *testing.T) {
+	tests := []struct {
+		name          string
+		params        map[string]string
+		options       []func(*ProvisionController) error
+		expectedFS    string
+		expectedError string
+	}{
+		{
+			name:   "without AllowedFSTypes",
+			params: map[string]string{"fsType": "XFS"},
+		},
+		{
+			name:       "default",
+			options:    []func(*ProvisionController) error{AllowedFSTypes([]string{"ext4", "xfs"}, "ext4")},
+			expectedFS: "ext4",
+		},
+		{
+			name:       "legacy fstype",
+			params:     map[string]string{"fstype": " XFS"},
+			options:    []func(*ProvisionController) error{AllowedFSTypes([]string{"ext4", "xfs"}, "ext4")},
+			expectedFS: "xfs",
+		},
+		{
+			name:          "not allowed",
+			params:        map[string]string{"fsType": "ntfs"},
+			options:       []func(*ProvisionController) error{AllowedFSTypes([]string{"ext4", "xfs"}, "ext4")},
+			expectedError: `StorageClass "class-1": invalid fsType "ntfs": must be one of ext4, xfs`,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			logger, ctx := ktesting.NewTestContext(t)
+			class := newStorageClass("class-1", "foo.bar/baz")
+			class.Parameters = test.params
+			claim := newClaim("claim-1", "uid-1-1", "class-1", "foo.bar/baz", "", nil)
+			prov := newTestProvisioner()
+			recorder := record.NewFakeRecorder(10)
+			ctrl := newTestProvisionController(logger, fake.NewSimpleClientset(claim), "foo.bar/baz", prov, append(test.options, WithEventRecorder(recorder))...)
+			ctrl.classes.Add(class)
+
+			_, err := ctrl.provisionClaimOperation(ctx, claim)
+			if test.expectedError != "" {
+				if err == nil || err.Error() != test.expectedError {
+					t.Fatalf("expected error %q, got %v", test.expectedError, err)
+				}
+				if len(prov.provisionCalls) != 0 {
+					t.Errorf("expected Provision not to be called")
+				}
+				var events []string
+				for len(recorder.Events) > 0 {
+					events = append(events, <-recorder.Events)
+				}
+				if len(events) != 1 || events[0] != "Warning ProvisioningFailed "+test.expectedError {
+					t.Errorf("expected one ProvisioningFailed event, got %v", events)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if params := <-prov.provisionCalls; params.fsType != test.expectedFS {
+				t.Errorf("expected fsType %q, got %q", test.expectedFS, params.fsType)
+			}
+		})
+	}
+
+	for _, option := range []func(*ProvisionController) error{AllowedFSTypes(nil, ""), AllowedFSTypes([]string{"ext4", " "}, ""), AllowedFSTypes([]string{"ext4"}, "xfs")} {
+		ctrl := &ProvisionController{hasRunLock: &sync.Mutex{}}
+		if err := option(ctrl); err == nil {
+			t.Errorf("expected error, got none")
+		}
+	}
+}
+
+func TestExplainSkips(t *testing.T) {
+	logger, ctx := ktesting.NewTestContext(t)
+	class := newStorageClassWithVolumeBindingMode("class-1", "foo.bar/baz", &modeWait)
+	claim := newClaim("claim-1", "1-1", "class-1", "foo.bar/baz", "", nil)
+	otherClaim := newClaim("claim-2", "1-2", "class-2", "abc.def/ghi", "", nil)
+	recorder := record.NewFakeRecorder(10)
+	ctrl := newTestProvisionController(logger, fake.NewSimpleClientset(claim, otherClaim), "foo.bar/baz", newTestProvisioner(),
+		ExplainSkips(true), WithEventRecorder(recorder))
+	ctrl.classes.Add(class)
+
+	for i := 0; i < 3; i++ {
+		ctrl.shouldProvision(ctx, claim)
+		ctrl.shouldProvision(ctx, otherClaim)
+	}
+
+	var events []string
+	for len(recorder.Events) > 0 {
+		events = append(events, <-recorder.Events)
+	}
+	if len(events) != 1 {
+		t.Fatalf("expected 1 event, got %v", events)
+	}
+	if expected := v1.EventTypeNormal + " ProvisioningSkipped " + string(SkipReasonWaitingForFirstConsumer) + ":"; !strings.HasPrefix(events[0], expected) {
+		t.Errorf("expected event with prefix %q, got %q", expected, events[0])
+	}
+}
+
 func TestShouldDelete(t *testing.T) {
 	timestamp := metav1.NewTime(time.Now())
 	tests := []struct {
@@ -1152,44 +1650,44 @@ func TestShouldDelete(t *testing.T) {
 		{
 			name:            "should delete",
 			provisionerName: "foo.bar/baz",
-			volume:          newVolume("volume-1", v1.VolumeReleased, v1.PersistentVolumeReclaimDelete, map[string]string{annDynamicallyProvisioned: "foo.bar/baz"}, nil, nil),
+			volume:          newVolume("volume-1", v1.VolumeReleased, v1.PersistentVolumeReclaimDelete, map[string]string{AnnDynamicallyProvisioned: "foo.bar/baz"}, nil, nil),
 			expectedShould:  true,
 		},
 		{
 			name:            "failed: shouldn't delete",
 			provisionerName: "foo.bar/baz",
-			volume:          newVolume("volume-1", v1.VolumeFailed, v1.PersistentVolumeReclaimDelete, map[string]string{annDynamicallyProvisioned: "foo.bar/baz"}, nil, nil),
+			volume:          newVolume("volume-1", v1.VolumeFailed, v1.PersistentVolumeReclaimDelete, map[string]string{AnnDynamicallyProvisioned: "foo.bar/baz"}, nil, nil),
 			expectedShould:  false,
 		},
 		{
 			name:            "volume still bound",
 			provisionerName: "foo.bar/baz",
-			volume:          newVolume("volume-1", v1.VolumeBound, v1.PersistentVolumeReclaimDelete, map[string]string{annDynamicallyProvisioned: "foo.bar/baz"}, nil, nil),
+			volume:          newVolume("volume-1", v1.VolumeBound, v1.PersistentVolumeReclaimDelete, map[string]string{AnnDynamicallyProvisioned: "foo.bar/baz"}, nil, nil),
 			expectedShould:  false,
 		},
 		{
 			name:            "non-delete reclaim policy",
 			provisionerName: "foo.bar/baz",
-			volume:          newVolume("volume-1", v1.VolumeReleased, v1.PersistentVolumeReclaimRetain, map[string]string{annDynamicallyProvisioned: "foo.bar/baz"}, nil, nil),
+			volume:          newVolume("volume-1", v1.VolumeReleased, v1.PersistentVolumeReclaimRetain, map[string]string{AnnDynamicallyProvisioned: "foo.bar/baz"}, nil, nil),
 			expectedShould:  false,
 		},
 		{
 			name:              "non-nil deletion timestamp",
 			provisionerName:   "foo.bar/baz",
-			volume:            newVolume("volume-1", v1.VolumeReleased, v1.PersistentVolumeReclaimDelete, map[string]string{annDynamicallyProvisioned: "foo.bar/baz"}, nil, nil),
+			volume:            newVolume("volume-1", v1.VolumeReleased, v1.PersistentVolumeReclaimDelete, map[string]string{AnnDynamicallyProvisioned: "foo.bar/baz"}, nil, nil),
 			deletionTimestamp: &timestamp,
 			expectedShould:    false,
 		},
 		{
 			name:            "nil deletion timestamp",
 			provisionerName: "foo.bar/baz",
-			volume:          newVolume("volume-1", v1.VolumeReleased, v1.PersistentVolumeReclaimDelete, map[string]string{annDynamicallyProvisioned: "foo.bar/baz"}, nil, nil),
+			volume:          newVolume("volume-1", v1.VolumeReleased, v1.PersistentVolumeReclaimDelete, map[string]string{AnnDynamicallyProvisioned: "foo.bar/baz"}, nil, nil),
 			expectedShould:  true,
 		},
 		{
 			name:            "migrated to",
 			provisionerName: "csi.driver",
-			volume:          newVolume("volume-1", v1.VolumeReleased, v1.PersistentVolumeReclaimDelete, map[string]string{annDynamicallyProvisioned: "foo.bar/baz", annMigratedTo: "csi.driver"}, nil, nil),
+			volume:          newVolume("volume-1", v1.VolumeReleased, v1.PersistentVolumeReclaimDelete, map[string]string{AnnDynamicallyProvisioned: "foo.bar/baz", AnnMigratedTo: "csi.driver"}, nil, nil),
 			expectedShould:  true,
 		},
 	}
@@ -1219,37 +1717,37 @@ func TestIsProvisionerForVolume(t *testing.T) {
 		{
 			name:            "known dynamically provisioned in-tree volume",
 			provisionerName: "foo.bar/baz",
-			volume:          newVolume("volume-1", v1.VolumeAvailable, v1.PersistentVolumeReclaimDelete, map[string]string{annDynamicallyProvisioned: "foo.bar/baz"}, nil, nil),
+			volume:          newVolume("volume-1", v1.VolumeAvailable, v1.PersistentVolumeReclaimDelete, map[string]string{AnnDynamicallyProvisioned: "foo.bar/baz"}, nil, nil),
 			expectedShould:  true,
 		},
 		{
 			name:            "known dynamically provisioned in-tree migrated volume",
 			provisionerName: "foo.bar/baz",
-			volume:          newVolume("volume-1", v1.VolumeAvailable, v1.PersistentVolumeReclaimDelete, map[string]string{annDynamicallyProvisioned: "foo.bar/baz", annMigratedTo: "foo.bar/baz"}, nil, nil),
+			volume:          newVolume("volume-1", v1.VolumeAvailable, v1.PersistentVolumeReclaimDelete, map[string]string{AnnDynamicallyProvisioned: "foo.bar/baz", AnnMigratedTo: "foo.bar/baz"}, nil, nil),
 			expectedShould:  true,
 		},
 		{
 			name:            "unknown dynamically provisioned in-tree volume",
 			provisionerName: "foo.bar1/baz1",
-			volume:          newVolume("volume-1", v1.VolumeAvailable, v1.PersistentVolumeReclaimDelete, map[string]string{annDynamicallyProvisioned: "foo.bar/baz"}, nil, nil),
+			volume:          newVolume("volume-1", v1.VolumeAvailable, v1.PersistentVolumeReclaimDelete, map[string]string{AnnDynamicallyProvisioned: "foo.bar/baz"}, nil, nil),
 			expectedShould:  false,
 		},
 		{
 			name:            "unknown dynamically provisioned in-tree migrated volume",
 			provisionerName: "foo.bar1/baz1",
-			volume:          newVolume("volume-1", v1.VolumeAvailable, v1.PersistentVolumeReclaimDelete, map[string]string{annDynamicallyProvisioned: "foo.bar/baz", annMigratedTo: "foo.bar/baz"}, nil, nil),
+			volume:          newVolume("volume-1", v1.VolumeAvailable, v1.PersistentVolumeReclaimDelete, map[string]string{AnnDynamicallyProvisioned: "foo.bar/baz", AnnMigratedTo: "foo.bar/baz"}, nil, nil),
 			expectedShould:  false,
 		},
 		{
 			name:            "known dynamically provisioned csi volume",
 			provisionerName: "foo.bar/baz",
-			volume:          newCSIVolume("volume-1", v1.VolumeBound, v1.PersistentVolumeReclaimDelete, map[string]string{annDynamicallyProvisioned: "foo.bar/baz"}, nil, nil, "foo.bar/baz"),
+			volume:          newCSIVolume("volume-1", v1.VolumeBound, v1.PersistentVolumeReclaimDelete, map[string]string{AnnDynamicallyProvisioned: "foo.bar/baz"}, nil, nil, "foo.bar/baz"),
 			expectedShould:  true,
 		},
 		{
 			name:            "unknown dynamically provisioned csi volume",
 			provisionerName: "foo.bar1/baz1",
-			volume:          newCSIVolume("volume-1", v1.VolumeBound, v1.PersistentVolumeReclaimDelete, map[string]string{annDynamicallyProvisioned: "foo.bar/baz"}, nil, nil, "foo.bar/baz"),
+			volume:          newCSIVolume("volume-1", v1.VolumeBound, v1.PersistentVolumeReclaimDelete, map[string]string{AnnDynamicallyProvisioned: "foo.bar/baz"}, nil, nil, "foo.bar/baz"),
 			expectedShould:  false,
 		},
 		{
@@ -1273,13 +1771,13 @@ func TestIsProvisionerForVolume(t *testing.T) {
 		{
 			name:            "known statically provisioned in-tree migrate volume",
 			provisionerName: "foo.bar/baz",
-			volume:          newVolume("volume-1", v1.VolumeAvailable, v1.PersistentVolumeReclaimDelete, map[string]string{annMigratedTo: "foo.bar/baz"}, nil, nil),
+			volume:          newVolume("volume-1", v1.VolumeAvailable, v1.PersistentVolumeReclaimDelete, map[string]string{AnnMigratedTo: "foo.bar/baz"}, nil, nil),
 			expectedShould:  true,
 		},
 		{
 			name:            "unknown statically provisioned in-tree migrate volume",
 			provisionerName: "foo.bar1/baz1",
-			volume:          newVolume("volume-1", v1.VolumeAvailable, v1.PersistentVolumeReclaimDelete, map[string]string{annMigratedTo: "foo.bar/baz"}, nil, nil),
+			volume:          newVolume("volume-1", v1.VolumeAvailable, v1.PersistentVolumeReclaimDelete, map[string]string{AnnMigratedTo: "foo.bar/baz"}, nil, nil),
 			expectedShould:  false,
 		},
 	}
@@ -1311,7 +1809,7 @@ func TestShouldDeleteWithFinalizer(t *testing.T) {
 			// `Released` state. The PV has the finalizer that was previously added to it by `syncVolume`.
 			name:            "should delete with finalizer present and no deletionTimestamp",
 			provisionerName: "foo.bar/baz",
-			volume:          newVolume("volume-1", v1.VolumeReleased, v1.PersistentVolumeReclaimDelete, map[string]string{annDynamicallyProvisioned: "foo.bar/baz"}, []string{finalizerPV}, nil),
+			volume:          newVolume("volume-1", v1.VolumeReleased, v1.PersistentVolumeReclaimDelete, map[string]string{AnnDynamicallyProvisioned: "foo.bar/baz"}, []string{finalizerPV}, nil),
 			expectedShould:  true,
 		},
 		{
@@ -1320,7 +1818,7 @@ func TestShouldDeleteWithFinalizer(t *testing.T) {
 			// would be in a `Released` state with deletionTimestamp set.
 			name:              "should delete with finalizer present and with deletionTimestamp",
 			provisionerName:   "foo.bar/baz",
-			volume:            newVolume("volume-1", v1.VolumeReleased, v1.PersistentVolumeReclaimDelete, map[string]string{annDynamicallyProvisioned: "foo.bar/baz"}, []string{finalizerPV}, nil),
+			volume:            newVolume("volume-1", v1.VolumeReleased, v1.PersistentVolumeReclaimDelete, map[string]string{AnnDynamicallyProvisioned: "foo.bar/baz"}, []string{finalizerPV}, nil),
 			deletionTimestamp: &timestamp,
 			expectedShould:    true,
 		},
@@ -1329,7 +1827,7 @@ func TestShouldDeleteWithFinalizer(t *testing.T) {
 			// addition or deletion.
 			name:            "should not delete when volume still bound and the finalizer exists with no deletionTimestamp",
 			provisionerName: "foo.bar/baz",
-			volume:          newVolume("volume-1", v1.VolumeBound, v1.PersistentVolumeReclaimDelete, map[string]string{annDynamicallyProvisioned: "foo.bar/baz"}, []string{finalizerPV}, nil),
+			volume:          newVolume("volume-1", v1.VolumeBound, v1.PersistentVolumeReclaimDelete, map[string]string{AnnDynamicallyProvisioned: "foo.bar/baz"}, []string{finalizerPV}, nil),
 			expectedShould:  false,
 		},
 		{
@@ -1337,7 +1835,7 @@ func TestShouldDeleteWithFinalizer(t *testing.T) {
 			// the finalizer. Volume should not be deleted in this case, here, the deletionTimestamp does not matter.
 			name:            "should not delete for non-delete reclaim policy",
 			provisionerName: "foo.bar/baz",
-			volume:          newVolume("volume-1", v1.VolumeReleased, v1.PersistentVolumeReclaimRetain, map[string]string{annDynamicallyProvisioned: "foo.bar/baz"}, []string{}, nil),
+			volume:          newVolume("volume-1", v1.VolumeReleased, v1.PersistentVolumeReclaimRetain, map[string]string{AnnDynamicallyProvisioned: "foo.bar/baz"}, []string{}, nil),
 			expectedShould:  false,
 		},
 	}
@@ -1572,7 +2070,7 @@ func TestControllerSharedInformers(t *testing.T) {
 		{
 			name: "delete volume-1",
 			objs: []runtime.Object{
-				newVolume("volume-1", v1.VolumeReleased, v1.PersistentVolumeReclaimDelete, map[string]string{annDynamicallyProvisioned: "foo.bar/baz"}, nil, nil),
+				newVolume("volume-1", v1.VolumeReleased, v1.PersistentVolumeReclaimDelete, map[string]string{AnnDynamicallyProvisioned: "foo.bar/baz"}, nil, nil),
 			},
 			provisionerName: "foo.bar/baz",
 			expectedVolumes: []v1.PersistentVolume{},
@@ -1590,7 +2088,7 @@ func TestControllerSharedInformers(t *testing.T) {
 			defer close(stopCh)
 
 			// Run forever...
-			go ctrl.Run(context.Background())
+			runTestController(t, context.Background(), ctrl)
 			go informersFactory.Start(context.Background().Done())
 
 			// When we shutdown while something is happening the fake client panics
@@ -1609,69 +2107,7647 @@ func TestControllerSharedInformers(t *testing.T) {
 	}
 }
 
-type testMetrics struct {
-	provisioned counts
-	deleted     counts
-}
-
-type counts map[string]count
-
-type count struct {
-	success float64
-	failed  float64
-}
+func TestMetricsHandler(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := listener.Addr().(*net.TCPAddr).Port
+	listener.Close()
+
+	logger, ctx := ktesting.NewTestContext(t)
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	client := fake.NewSimpleClientset(
+		newStorageClass("class-1", "foo.bar/baz"),
+		newClaim("claim-1", "uid-1-1", "class-1", "foo.bar/baz", "", nil),
+	)
+	ctrl := newTestProvisionController(logger, client, "foo.bar/baz", newTestProvisioner(),
+		LeaderElection(false),
+		MetricsServer(false),
+		MetricsAddress("127.0.0.1"),
+		MetricsPort(int32(port)),
+	)
+	runTestController(t, ctx, ctrl.ProvisionController)
+	utilruntime.ReallyCrash = false
+	err = wait.PollUntilContextTimeout(ctx, 10*time.Millisecond, wait.ForeverTestTimeout, true, func(context.Context) (bool, error) {
+		return testutil.ToFloat64(ctrl.metrics.PersistentVolumeClaimProvisionTotal.WithLabelValues("class-1", "")) == 1, nil
+	})
+	if err != nil {
+		t.Fatalf("expected claim to be provisioned: %v", err)
+	}
 
-type testProvisionController struct {
-	*ProvisionController
-	metrics *metrics.Metrics
-}
+	if conn, err := net.Dial("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(port))); err == nil {
+		conn.Close()
+		t.Errorf("expected no metrics server listening on port %d", port)
+	}
 
-func (ctrl testProvisionController) getMetrics(t *testing.T) testMetrics {
-	var tm testMetrics
-	getCounts(t, ctrl.metrics.PersistentVolumeClaimProvisionTotal, &tm.provisioned, true)
-	getCounts(t, ctrl.metrics.PersistentVolumeClaimProvisionFailedTotal, &tm.provisioned, false)
-	getCounts(t, ctrl.metrics.PersistentVolumeDeleteTotal, &tm.deleted, true)
-	getCounts(t, ctrl.metrics.PersistentVolumeDeleteFailedTotal, &tm.deleted, false)
-	return tm
+	recorder := httptest.NewRecorder()
+	ctrl.MetricsHandler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", recorder.Code)
+	}
+	body := recorder.Body.String()
+	if !strings.Contains(body, "_persistentvolumeclaim_provision_total{class=\"class-1\",source=\"\"} 1") {
+		t.Errorf("expected provision metric in handler output, got:\n%s", body)
+	}
+	if strings.Contains(body, "go_goroutines") {
+		t.Errorf("expected only controller metrics in handler output, got:\n%s", body)
+	}
 }
 
-func getCounts(t *testing.T, vec *prometheus.CounterVec, cts *counts, success bool) {
-	metricCh := make(chan prometheus.Metric)
-	go func() {
-		vec.Collect(metricCh)
-		close(metricCh)
-	}()
-	for metric := range metricCh {
-		var m dto.Metric
-		err := metric.Write(&m)
-		if err != nil {
-			t.Fatalf("unexpected error while extracting Prometheus metrics: %v", err)
-		}
-
-		// Only initialize the map if we actually have a value.
-		if *cts == nil {
-			*cts = counts{}
-		}
+func TestMetricsProvider(t *testing.T) {
+	logger, _ := ktesting.NewTestContext(t)
+	counter := prometheus.NewCounter(prometheus.CounterOpts{Name: "test_backend_calls_total", Help: "Backend calls."})
+	provisioner := &metricsTestProvisioner{testProvisioner: newTestProvisioner(), collectors: []prometheus.Collector{counter}}
+	ctrl := newTestProvisionController(logger, fake.NewSimpleClientset(), "foo.bar/baz", provisioner)
+	counter.Add(3)
+
+	recorder := httptest.NewRecorder()
+	ctrl.MetricsHandler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	body := recorder.Body.String()
+	if !strings.Contains(body, "test_backend_calls_total 3") {
+		t.Errorf("expected provisioner metric in handler output, got:\n%s", body)
+	}
+	if !strings.Contains(body, "_build_info{") {
+		t.Errorf("expected controller metrics in handler output, got:\n%s", body)
+	}
 
-		// We know that our counters have exactly one label.
-		count := (*cts)[*m.Label[0].Value]
-		if success {
-			count.success++
-		} else {
-			count.failed++
-		}
-		(*cts)[*m.Label[0].Value] = count
+	duplicate := &metricsTestProvisioner{testProvisioner: newTestProvisioner(), collectors: []prometheus.Collector{counter, counter}}
+	_, err := NewProvisionControllerOrError(logger, fake.NewSimpleClientset(), "foo.bar/baz", duplicate, MetricsInstance(metrics.New(newTestMetricsSubsystem())))
+	if err == nil || !strings.Contains(err.Error(), "error registering metrics of the provisioner") {
+		t.Errorf("expected registration error, got %v", err)
 	}
 }
 
-func newTestProvisionController(
-	logger klog.Logger,
-	client kubernetes.Interface,
-	provisionerName string,
-	provisioner Provisioner,
-	options ...func(*ProvisionController) error,
+func TestRescheduleMetrics(t *testing.T) {
+	tests := []struct {
+		name           string
+		objs           []runtime.Object
+		provisioner    Provisioner
+		expectedReason string
+	}{
+		{
+			name: "node not found",
+			objs: []runtime.Object{
+				newStorageClassWithVolumeBindingMode("class-1", "foo.bar/baz", &modeWait),
+			},
+			provisioner:    newTestProvisioner(),
+			expectedReason: rescheduleReasonNodeNotFound,
+		},
+		{
+			name: "provision failed",
+			objs: []runtime.Object{
+				newStorageClassWithVolumeBindingMode("class-1", "foo.bar/baz", &modeWait),
+				newNode("node-1"),
+			},
+			provisioner:    newRescheduleTestProvisioner(),
+			expectedReason: rescheduleReasonProvisionFailed,
+		},
+		{
+			name: "provisioner requested",
+			objs: []runtime.Object{
+				newStorageClassWithVolumeBindingMode("class-1", "foo.bar/baz", &modeWait),
+				newNode("node-1"),
+			},
+			provisioner:    &rescheduleTestProvisioner{noError: true},
+			expectedReason: rescheduleReasonProvisionerRequested,
+		},
+		{
+			name: "final error does not reschedule",
+			objs: []runtime.Object{
+				newStorageClassWithVolumeBindingMode("class-1", "foo.bar/baz", &modeWait),
+				newNode("node-1"),
+			},
+			provisioner: newBadTestProvisioner(),
+		},
+		{
+			name: "node does not match allowed topologies",
+			objs: []runtime.Object{
+				func() *storage.StorageClass {
+					class := newStorageClassWithVolumeBindingMode("class-1", "foo.bar/baz", &modeWait)
+					class.AllowedTopologies = []v1.TopologySelectorTerm{{MatchLabelExpressions: []v1.TopologySelectorLabelRequirement{{Key: "zone", Values: []string{"a"}}}}}
+					return class
+				}(),
+				newNodeWithLabels("node-1", map[string]string{"zone": "b"}),
+			},
+			provisioner:    newTestProvisioner(),
+			expectedReason: rescheduleReasonTopologyMismatch,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			logger, ctx := ktesting.NewTestContext(t)
+			claim := newClaim("claim-1", "uid-1-1", "class-1", "foo.bar/baz", "", map[string]string{AnnSelectedNode: "node-1"})
+			client := fake.NewSimpleClientset(append(test.objs, claim)...)
+			ctrl := newTestProvisionController(logger, client, "foo.bar/baz", test.provisioner)
+			recorder := record.NewFakeRecorder(10)
+			ctrl.eventRecorder = recorder
+			for _, obj := range test.objs {
+				if class, ok := obj.(*storage.StorageClass); ok {
+					ctrl.classes.Add(class)
+				}
+			}
+
+			ctrl.provisionClaimOperation(ctx, claim)
+
+			for _, reason := range []string{rescheduleReasonNodeNotFound, rescheduleReasonNodeTerminating, rescheduleReasonNodeUnschedulable, rescheduleReasonNoCapacity, rescheduleReasonProvisionFailed, rescheduleReasonProvisionerRequested, rescheduleReasonTopologyMismatch} {
+				expected := 0.0
+				if reason == test.expectedReason {
+					expected = 1
+				}
+				actual := testutil.ToFloat64(ctrl.metrics.PersistentVolumeClaimRescheduleTotal.WithLabelValues("class-1", reason))
+				if actual != expected {
+					t.Errorf("expected %v reschedules with reason %q, got %v", expected, reason, actual)
+				}
+			}
+
+			rescheduledEvent := false
+			for len(recorder.Events) > 0 {
+				event := <-recorder.Events
+				if strings.HasPrefix(event, v1.EventTypeNormal+" ProvisioningRescheduled") {
+					rescheduledEvent = true
+					if !strings.Contains(event, test.expectedReason) {
+						t.Errorf("expected reason %q in event %q", test.expectedReason, event)
+					}
+				}
+			}
+			if rescheduledEvent != (test.expectedReason != "") {
+				t.Errorf("expected ProvisioningRescheduled event: %v, got: %v", test.expectedReason != "", rescheduledEvent)
+			}
+		})
+	}
+}
+
+func TestVolumeStorePendingMetrics(t *testing.T) {
+	logger, ctx := ktesting.NewTestContext(t)
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	claim := newClaim("claim-1", "uid-1-1", "class-1", "foo.bar/baz", "", nil)
+	client := fake.NewSimpleClientset(claim)
+	failures := 0
+	unblock := make(chan struct{})
+	client.PrependReactor("create", "persistentvolumes", func(action testclient.Action) (handled bool, ret runtime.Object, err error) {
+		if failures < 3 {
+			failures++
+			return true, nil, errors.New("fake error")
+		}
+		<-unblock
+		return false, nil, nil
+	})
+	claimsIndexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{uidIndex: func(obj interface{}) ([]string, error) {
+		uid, err := getObjectUID(obj)
+		return []string{uid}, err
+	}})
+	claimsIndexer.Add(claim)
+	recorder := record.NewFakeRecorder(10)
+	m := metrics.New(newTestMetricsSubsystem())
+	store := newVolumeStoreQueue(client, workqueue.NewItemExponentialFailureRateLimiter(10*time.Millisecond, 10*time.Millisecond), claimsIndexer, recorder.Event, &m, time.Nanosecond, nil, clock.RealClock{})
+
+	volume := newProvisionedVolume(ctx, newStorageClass("class-1", "foo.bar/baz"), claim, nil)
+	if err := store.StoreVolume(logger, claim, volume); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if pending := testutil.ToFloat64(m.PersistentVolumesPendingSave); pending != 1 {
+		t.Errorf("expected 1 volume pending save, got %v", pending)
+	}
+	if store.Len() != 1 {
+		t.Errorf("expected store length 1, got %d", store.Len())
+	}
+
+	go store.Run(ctx, 1)
+	err := wait.PollUntilContextTimeout(ctx, 10*time.Millisecond, 5*time.Second, true, func(context.Context) (bool, error) {
+		return testutil.ToFloat64(m.PersistentVolumeSaveFailedTotal.WithLabelValues("class-1")) == 3, nil
+	})
+	if err != nil {
+		t.Fatalf("expected 3 failed saves, got %v", testutil.ToFloat64(m.PersistentVolumeSaveFailedTotal.WithLabelValues("class-1")))
+	}
+	close(unblock)
+
+	err = wait.PollUntilContextTimeout(ctx, 10*time.Millisecond, 5*time.Second, true, func(context.Context) (bool, error) {
+		return testutil.ToFloat64(m.PersistentVolumesPendingSave) == 0, nil
+	})
+	if err != nil {
+		t.Errorf("expected no volume pending save, got %v", testutil.ToFloat64(m.PersistentVolumesPendingSave))
+	}
+	if store.Len() != 0 {
+		t.Errorf("expected empty store, got length %d", store.Len())
+	}
+
+	var pendingEvents int
+	for len(recorder.Events) > 0 {
+		if event := <-recorder.Events; strings.HasPrefix(event, v1.EventTypeWarning+" ProvisioningSavePending") {
+			pendingEvents++
+		}
+	}
+	if pendingEvents != 1 {
+		t.Errorf("expected 1 ProvisioningSavePending event, got %d", pendingEvents)
+	}
+}
+
+func TestPendingVolumes(t *testing.T) {
+	logger, ctx := ktesting.NewTestContext(t)
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	claim1 := newClaim("claim-1", "uid-1-1", "class-1", "foo.bar/baz", "", nil)
+	claim2 := newClaim("claim-2", "uid-1-2", "class-1", "foo.bar/baz", "", nil)
+	client := fake.NewSimpleClientset(claim1, claim2)
+	var fail atomic.Bool
+	fail.Store(true)
+	client.PrependReactor("create", "persistentvolumes", func(action testclient.Action) (handled bool, ret runtime.Object, err error) {
+		if fail.Load() {
+			return true, nil, errors.New("fake error")
+		}
+		return false, nil, nil
+	})
+	ctrl := newTestProvisionController(logger, client, "foo.bar/baz", newTestProvisioner(), MetricsPort(8080), EnableDebugEndpoints(true))
+	limiter := workqueue.NewItemExponentialFailureRateLimiter(10*time.Millisecond, 10*time.Millisecond)
+	ctrl.volumeStore = newVolumeStoreQueue(client, limiter, ctrl.claimsIndexer, ctrl.event, ctrl.metrics, 0, nil, ctrl.clock)
+	ctrl.claimsIndexer.Add(claim1)
+	ctrl.claimsIndexer.Add(claim2)
+
+	class := newStorageClass("class-1", "foo.bar/baz")
+	for _, claim := range []*v1.PersistentVolumeClaim{claim2, claim1} {
+		if err := ctrl.volumeStore.StoreVolume(logger, claim, newProvisionedVolume(ctx, class, claim, nil)); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	pending := ctrl.PendingVolumes()
+	if len(pending) != 2 {
+		t.Fatalf("expected 2 pending volumes, got %+v", pending)
+	}
+	for i, claim := range []*v1.PersistentVolumeClaim{claim1, claim2} {
+		info := pending[i]
+		if info.ClaimNamespace != claim.Namespace || info.ClaimName != claim.Name || info.VolumeName != "pvc-"+string(claim.UID) {
+			t.Errorf("expected volume of claim %s, got %+v", klog.KObj(claim), info)
+		}
+		if info.Attempts != 1 || !strings.Contains(info.LastError, "fake error") || info.NextRetry == nil {
+			t.Errorf("expected 1 failed attempt with next retry, got %+v", info)
+		}
+	}
+
+	recorder := httptest.NewRecorder()
+	ctrl.metricsMux().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, pendingVolumesPath, nil))
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, recorder.Code)
+	}
+	var served []PendingVolumeInfo
+	if err := json.Unmarshal(recorder.Body.Bytes(), &served); err != nil {
+		t.Fatalf("failed to decode %q: %v", recorder.Body.String(), err)
+	}
+	if len(served) != 2 || served[0].VolumeName != pending[0].VolumeName || served[1].VolumeName != pending[1].VolumeName {
+		t.Errorf("expected served volumes %+v, got %+v", pending, served)
+	}
+	for i, info := range served {
+		if info.NextRetry == nil || !info.NextRetry.Equal(*pending[i].NextRetry) {
+			t.Errorf("expected served next retry %v, got %v", pending[i].NextRetry, info.NextRetry)
+		}
+	}
+	// A volume that is not retried has no next retry instead of a zero time.
+	data, err := json.Marshal(newPendingVolumeInfo(newProvisionedVolume(ctx, class, claim1, nil), 1, errors.New("fake error"), time.Time{}))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if strings.Contains(string(data), "nextRetry") {
+		t.Errorf("expected no nextRetry, got %s", data)
+	}
+
+	go ctrl.volumeStore.Run(ctx, 1)
+	err = wait.PollUntilContextTimeout(ctx, 10*time.Millisecond, 5*time.Second, true, func(context.Context) (bool, error) {
+		pending = ctrl.PendingVolumes()
+		return len(pending) == 2 && pending[0].Attempts > 1 && pending[1].Attempts > 1, nil
+	})
+	if err != nil {
+		t.Fatalf("expected retried volumes, got %+v", pending)
+	}
+
+	fail.Store(false)
+	err = wait.PollUntilContextTimeout(ctx, 10*time.Millisecond, 5*time.Second, true, func(context.Context) (bool, error) {
+		return len(ctrl.PendingVolumes()) == 0, nil
+	})
+	if err != nil {
+		t.Errorf("expected no pending volumes, got %+v", ctrl.PendingVolumes())
+	}
+}
+
+func TestBackoffStorePendingVolumes(t *testing.T) {
+	logger, ctx := ktesting.NewTestContext(t)
+	claim := newClaim("claim-1", "uid-1-1", "class-1", "foo.bar/baz", "", nil)
+	client := fake.NewSimpleClientset(claim)
+	var ctrl testProvisionController
+	var pending []PendingVolumeInfo
+	failures := 0
+	client.PrependReactor("create", "persistentvolumes", func(action testclient.Action) (handled bool, ret runtime.Object, err error) {
+		if failures < 2 {
+			failures++
+			return true, nil, errors.New("fake error")
+		}
+		pending = ctrl.PendingVolumes()
+		return false, nil, nil
+	})
+	ctrl = newTestProvisionController(logger, client, "foo.bar/baz", newTestProvisioner())
+	ctrl.volumeStore = NewBackoffStore(client, ctrl.eventRecorder, &wait.Backoff{Duration: time.Millisecond, Factor: 1, Steps: 5}, ctrl.ProvisionController)
+
+	if err := ctrl.volumeStore.StoreVolume(logger, claim, newProvisionedVolume(ctx, newStorageClass("class-1", "foo.bar/baz"), claim, nil)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(pending) != 1 || pending[0].ClaimName != claim.Name || pending[0].Attempts != 2 || pending[0].NextRetry == nil {
+		t.Errorf("expected 1 pending volume with 2 attempts during the last save, got %+v", pending)
+	}
+	if volumes := ctrl.PendingVolumes(); len(volumes) != 0 {
+		t.Errorf("expected no pending volumes after save, got %+v", volumes)
+	}
+}
+
+func TestBuildInfoMetric(t *testing.T) {
+	logger, _ := ktesting.NewTestContext(t)
+	ctrl := newTestProvisionController(logger, fake.NewSimpleClientset(), "foo.bar/baz", newTestProvisioner(),
+		LeaderElection(false),
+		Threadiness(7),
+		FailedProvisionThreshold(3),
+		AddFinalizer(true),
+	)
+
+	ch := make(chan prometheus.Metric, 1)
+	ctrl.metrics.BuildInfo.Collect(ch)
+	close(ch)
+	var infos []dto.Metric
+	for metric := range ch {
+		var m dto.Metric
+		if err := metric.Write(&m); err != nil {
+			t.Fatalf("unexpected error while extracting Prometheus metrics: %v", err)
+		}
+		infos = append(infos, m)
+	}
+	if len(infos) != 1 {
+		t.Fatalf("expected exactly one build info metric, got %d", len(infos))
+	}
+	if value := infos[0].GetGauge().GetValue(); value != 1 {
+		t.Errorf("expected build info value 1, got %v", value)
+	}
+
+	features := DefaultFeatures()
+	features[FeatureAddFinalizer] = true
+	labels := map[string]string{}
+	for _, label := range infos[0].Label {
+		labels[label.GetName()] = label.GetValue()
+	}
+	expectedLabels := map[string]string{
+		"provisioner":                  "foo.bar/baz",
+		"library_version":              LibraryVersion,
+		"leader_election":              "false",
+		"provision_threadiness":        "7",
+		"deletion_threadiness":         "7",
+		"resync_period":                resyncPeriod.String(),
+		"exponential_backoff_on_error": "true",
+		"failed_provision_threshold":   "3",
+		"failed_delete_threshold":      strconv.Itoa(DefaultFailedDeleteThreshold),
+		"add_finalizer":                "true",
+		"deletion_disabled":            "false",
+		"provisioning_disabled":        "false",
+		"client_qps":                   "0",
+		"client_burst":                 "0",
+		"user_agent":                   "",
+		"features":                     features.String(),
+	}
+	if !reflect.DeepEqual(expectedLabels, labels) {
+		t.Errorf("expected build info labels:\n %v\n but got:\n %v", expectedLabels, labels)
+	}
+}
+
+func TestClientOptions(t *testing.T) {
+	for name, option := range map[string]func(*ProvisionController) error{
+		"NaN QPS":               ClientQPS(float32(math.NaN())),
+		"infinite QPS":          ClientQPS(float32(math.Inf(1))),
+		"zero burst":            ClientBurst(0),
+		"empty user agent":      UserAgent(""),
+		"user agent with lines": UserAgent("provisioner\nversion"),
+	} {
+		if err := option(&ProvisionController{hasRunLock: &sync.Mutex{}}); err == nil {
+			t.Errorf("%s: expected error, got none", name)
+		}
+	}
+
+	for _, qps := range []float32{0, -1} {
+		if err := ClientQPS(qps)(&ProvisionController{hasRunLock: &sync.Mutex{}}); err != nil {
+			t.Errorf("unexpected error of QPS %v: %v", qps, err)
+		}
+	}
+
+	logger, _ := ktesting.NewTestContext(t)
+	ctrl := newTestProvisionController(logger, fake.NewSimpleClientset(), "foo.bar/baz", newTestProvisioner(),
+		ClientQPS(20.5),
+		ClientBurst(40),
+		UserAgent("example-provisioner/v1.2.3 (linux/amd64)"),
+	)
+	ch := make(chan prometheus.Metric, 1)
+	ctrl.metrics.BuildInfo.Collect(ch)
+	close(ch)
+	var m dto.Metric
+	if err := (<-ch).Write(&m); err != nil {
+		t.Fatalf("unexpected error while extracting Prometheus metrics: %v", err)
+	}
+	labels := map[string]string{}
+	for _, label := range m.Label {
+		labels[label.GetName()] = label.GetValue()
+	}
+	for name, expected := range map[string]string{
+		"client_qps":   "20.5",
+		"client_burst": "40",
+		"user_agent":   "example-provisioner/v1.2.3 (linux/amd64)",
+	} {
+		if labels[name] != expected {
+			t.Errorf("expected label %s=%q, got %q", name, expected, labels[name])
+		}
+	}
+}
+
+func TestFeatures(t *testing.T) {
+	newController := func(t *testing.T, options ...func(*ProvisionController) error) *ProvisionController {
+		t.Helper()
+		ctrl, err := NewProvisionControllerOrError(klog.Background(), fake.NewSimpleClientset(), "foo.bar/baz", newTestProvisioner(), options...)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return ctrl
+	}
+
+	t.Run("defaults", func(t *testing.T) {
+		if features := newController(t).Features(); !reflect.DeepEqual(features, DefaultFeatures()) {
+			t.Errorf("expected features %v, got %v", DefaultFeatures(), features)
+		}
+	})
+
+	t.Run("precedence", func(t *testing.T) {
+		ctrl := newController(t, AddFinalizer(true), WithFeatures(Features{FeatureAddFinalizer: false, FeatureExplainSkips: true}), ExplainSkips(false))
+		features := ctrl.Features()
+		if features[FeatureAddFinalizer] || ctrl.addFinalizer {
+			t.Errorf("expected WithFeatures to override AddFinalizer given before it")
+		}
+		if features[FeatureExplainSkips] || ctrl.explainSkips {
+			t.Errorf("expected ExplainSkips given after WithFeatures to override it")
+		}
+		if !newController(t, WithFeatures(Features{FeatureResolveConsumerPod: true})).resolveConsumerPod {
+			t.Errorf("expected WithFeatures to enable ResolveConsumerPod")
+		}
+	})
+
+	t.Run("unknown feature", func(t *testing.T) {
+		_, err := NewProvisionControllerOrError(klog.Background(), fake.NewSimpleClientset(), "foo.bar/baz", newTestProvisioner(), WithFeatures(Features{"Nope": true}))
+		if err == nil || !strings.Contains(err.Error(), `unknown feature "Nope"`) {
+			t.Errorf("expected unknown feature error, got %v", err)
+		}
+	})
+
+	t.Run("string", func(t *testing.T) {
+		features := Features{FeatureValidateTopologyKeys: true, FeatureAddFinalizer: false, FeatureExplainSkips: true}
+		if expected := "AddFinalizer=false,ExplainSkips=true,ValidateTopologyKeys=true"; features.String() != expected {
+			t.Errorf("expected %q, got %q", expected, features.String())
+		}
+		if len(strings.Split(DefaultFeatures().String(), ",")) != len(DefaultFeatures()) {
+			t.Errorf("expected one entry per feature in %q", DefaultFeatures().String())
+		}
+	})
+}
+
+func TestReady(t *testing.T) {
+	otherLeader := func() runtime.Object {
+		now := metav1.NewMicroTime(time.Now())
+		duration := int32(3600)
+		holder := "other"
+		return &coordinationv1.Lease{
+			ObjectMeta: metav1.ObjectMeta{Name: "foo.bar-baz", Namespace: "default"},
+			Spec: coordinationv1.LeaseSpec{
+				HolderIdentity:       &holder,
+				LeaseDurationSeconds: &duration,
+				AcquireTime:          &now,
+				RenewTime:            &now,
+			},
+		}
+	}
+
+	tests := []struct {
+		name          string
+		objs          []runtime.Object
+		options       []func(*ProvisionController) error
+		run           bool
+		unreachable   bool
+		expectedReady bool
+	}{
+		{
+			name:          "not started",
+			expectedReady: false,
+		},
+		{
+			name:          "lease not reached",
+			run:           true,
+			unreachable:   true,
+			expectedReady: false,
+		},
+		{
+			name:          "not started, without leader election",
+			options:       []func(*ProvisionController) error{LeaderElection(false)},
+			expectedReady: false,
+		},
+		{
+			name:          "synced without leader election",
+			options:       []func(*ProvisionController) error{LeaderElection(false)},
+			run:           true,
+			expectedReady: true,
+		},
+		{
+			name:          "leading",
+			run:           true,
+			expectedReady: true,
+		},
+		{
+			name:          "not leader",
+			objs:          []runtime.Object{otherLeader()},
+			run:           true,
+			expectedReady: true,
+		},
+		{
+			name:          "not leader, not ready when not leader",
+			objs:          []runtime.Object{otherLeader()},
+			options:       []func(*ProvisionController) error{ReadyWhenNotLeader(false)},
+			run:           true,
+			expectedReady: false,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			logger, _ := ktesting.NewTestContext(t)
+			client := fake.NewSimpleClientset(test.objs...)
+			if test.unreachable {
+				client.PrependReactor("*", "leases", func(action testclient.Action) (bool, runtime.Object, error) {
+					return true, nil, errors.New("connection refused")
+				})
+			}
+			ctrl := newTestProvisionController(logger, client, "foo.bar/baz", newTestProvisioner(), test.options...)
+			if test.run {
+				runTestController(t, context.Background(), ctrl.ProvisionController)
+				utilruntime.ReallyCrash = false
+				// Wait until the controller is ready or, when it is
+				// not expected to be, tried to get the lease.
+				err := wait.PollUntilContextTimeout(context.Background(), 10*time.Millisecond, wait.ForeverTestTimeout, true, func(context.Context) (bool, error) {
+					if test.expectedReady {
+						return ctrl.Ready() == nil, nil
+					}
+					for _, action := range client.Actions() {
+						if action.GetResource().Resource == "leases" {
+							return true, nil
+						}
+					}
+					return false, nil
+				})
+				if err != nil {
+					t.Fatalf("controller did not reach the expected state: %v", ctrl.Ready())
+				}
+			}
+
+			err := ctrl.Ready()
+			if test.expectedReady != (err == nil) {
+				t.Errorf("expected ready %v, got error %v", test.expectedReady, err)
+			}
+
+			recorder := httptest.NewRecorder()
+			ctrl.ReadyChecker().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+			expectedCode := http.StatusServiceUnavailable
+			if test.expectedReady {
+				expectedCode = http.StatusOK
+			}
+			if recorder.Code != expectedCode {
+				t.Errorf("expected status %d, got %d", expectedCode, recorder.Code)
+			}
+			if ctrl.HasRun() && !test.run {
+				t.Errorf("expected HasRun false before Run")
+			}
+		})
+	}
+}
+
+func TestEnableProfiling(t *testing.T) {
+	tests := []struct {
+		name            string
+		options         []func(*ProvisionController) error
+		expectedInvalid bool
+		expectedCode    int
+	}{
+		{
+			name:         "profiling disabled",
+			options:      []func(*ProvisionController) error{MetricsPort(8080)},
+			expectedCode: http.StatusNotFound,
+		},
+		{
+			name:         "profiling enabled",
+			options:      []func(*ProvisionController) error{MetricsPort(8080), EnableProfiling(true)},
+			expectedCode: http.StatusOK,
+		},
+		{
+			name:            "profiling without metrics port",
+			options:         []func(*ProvisionController) error{EnableProfiling(true)},
+			expectedInvalid: true,
+		},
+		{
+			name:            "profiling with metrics server disabled",
+			options:         []func(*ProvisionController) error{MetricsPort(8080), MetricsServer(false), EnableProfiling(true)},
+			expectedInvalid: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctrl := &ProvisionController{
+				metricsPath:            DefaultMetricsPath,
+				metricsServer:          DefaultMetricsServer,
+				eventComponent:         "foo.bar-baz",
+				eventAggregationWindow: DefaultEventAggregationWindow,
+				hasRunLock:             &sync.Mutex{},
+			}
+			for _, option := range test.options {
+				if err := option(ctrl); err != nil {
+					t.Fatalf("unexpected option error: %v", err)
+				}
+			}
+			err := ctrl.validateOptions()
+			if test.expectedInvalid {
+				if err == nil {
+					t.Errorf("expected validation error, got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected validation error: %v", err)
+			}
+
+			recorder := httptest.NewRecorder()
+			ctrl.metricsMux().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/debug/pprof/goroutine?debug=1", nil))
+			if recorder.Code != test.expectedCode {
+				t.Errorf("expected status %d, got %d", test.expectedCode, recorder.Code)
+			}
+			if test.expectedCode == http.StatusOK && !strings.Contains(recorder.Body.String(), "goroutine profile:") {
+				t.Errorf("expected goroutine profile, got:\n%s", recorder.Body.String())
+			}
+			for _, path := range []string{"/debug/pprof/", "/debug/pprof/cmdline", "/debug/pprof/symbol"} {
+				recorder := httptest.NewRecorder()
+				ctrl.metricsMux().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, path, nil))
+				if recorder.Code != test.expectedCode {
+					t.Errorf("expected status %d of %s, got %d", test.expectedCode, path, recorder.Code)
+				}
+			}
+		})
+	}
+}
+
+func TestMetricsMuxDefaultServeMux(t *testing.T) {
+	path := "/test-" + string(uuid.NewUUID())
+	http.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "default mux")
+	})
+	ctrl := &ProvisionController{metricsPath: DefaultMetricsPath, hasRunLock: &sync.Mutex{}}
+
+	recorder := httptest.NewRecorder()
+	ctrl.metricsMux().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, path, nil))
+	if recorder.Code != http.StatusOK || recorder.Body.String() != "default mux" {
+		t.Errorf("expected handler of http.DefaultServeMux to be served, got %d %q", recorder.Code, recorder.Body.String())
+	}
+	recorder = httptest.NewRecorder()
+	ctrl.metricsMux().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, DefaultMetricsPath, nil))
+	if recorder.Code != http.StatusOK {
+		t.Errorf("expected metrics to be served, got %d", recorder.Code)
+	}
+}
+
+func TestMetricsSubsystem(t *testing.T) {
+	tests := []struct {
+		name            string
+		options         []func(*ProvisionController) error
+		expectedInvalid bool
+		expectedNames   []string
+	}{
+		{
+			name:          "default subsystem",
+			expectedNames: []string{"controller_build_info", "controller_in_flight_operations", "controller_paused", "controller_persistentvolume_delete_in_flight", "controller_persistentvolumeclaim_provision_in_flight", "controller_volumes_pending_save"},
+		},
+		{
+			name:          "custom subsystem",
+			options:       []func(*ProvisionController) error{MetricsSubsystem("foo_provisioner")},
+			expectedNames: []string{"foo_provisioner_build_info", "foo_provisioner_in_flight_operations", "foo_provisioner_paused", "foo_provisioner_persistentvolume_delete_in_flight", "foo_provisioner_persistentvolumeclaim_provision_in_flight", "foo_provisioner_volumes_pending_save"},
+		},
+		{
+			name:          "empty subsystem",
+			options:       []func(*ProvisionController) error{MetricsSubsystem("")},
+			expectedNames: []string{"build_info", "in_flight_operations", "paused", "persistentvolume_delete_in_flight", "persistentvolumeclaim_provision_in_flight", "volumes_pending_save"},
+		},
+		{
+			name:            "invalid subsystem",
+			options:         []func(*ProvisionController) error{MetricsSubsystem("foo-provisioner")},
+			expectedInvalid: true,
+		},
+		{
+			name:            "subsystem with metrics instance",
+			options:         []func(*ProvisionController) error{MetricsSubsystem("foo_provisioner"), MetricsInstance(metrics.New("bar"))},
+			expectedInvalid: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctrl := &ProvisionController{
+				metricsSubsystem:       controllerSubsystem,
+				eventComponent:         "foo.bar-baz",
+				eventAggregationWindow: DefaultEventAggregationWindow,
+				hasRunLock:             &sync.Mutex{},
+			}
+			for _, option := range test.options {
+				if err := option(ctrl); err != nil {
+					t.Fatalf("unexpected option error: %v", err)
+				}
+			}
+			err := ctrl.validateOptions()
+			if test.expectedInvalid {
+				if err == nil {
+					t.Errorf("expected validation error, got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected validation error: %v", err)
+			}
+
+			logger, _ := ktesting.NewTestContext(t)
+			ctrl = NewProvisionController(logger, fake.NewSimpleClientset(), "foo.bar/baz", newTestProvisioner(), test.options...)
+			families, err := ctrl.metricsRegistry.Gather()
+			if err != nil {
+				t.Fatalf("unexpected error gathering metrics: %v", err)
+			}
+			var names []string
+			for _, family := range families {
+				names = append(names, family.GetName())
+			}
+			if !reflect.DeepEqual(test.expectedNames, names) {
+				t.Errorf("expected metric names %v, got %v", test.expectedNames, names)
+			}
+		})
+	}
+}
+
+func TestWithEventRecorder(t *testing.T) {
+	tests := []struct {
+		name           string
+		provisioner    Provisioner
+		expectedEvents []string
+	}{
+		{
+			name:        "success",
+			provisioner: newTestProvisioner(),
+			expectedEvents: []string{
+				v1.EventTypeNormal + " Provisioning",
+				v1.EventTypeNormal + " ProvisioningSucceeded",
+			},
+		},
+		{
+			name:        "failure",
+			provisioner: newBadTestProvisioner(),
+			expectedEvents: []string{
+				v1.EventTypeNormal + " Provisioning",
+				v1.EventTypeWarning + " ProvisioningFailed",
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			logger, ctx := ktesting.NewTestContext(t)
+			class := newStorageClass("class-1", "foo.bar/baz")
+			claim := newClaim("claim-1", "uid-1-1", "class-1", "foo.bar/baz", "", nil)
+			client := fake.NewSimpleClientset(class, claim)
+			recorder := record.NewFakeRecorder(10)
+			ctrl := newTestProvisionController(logger, client, "foo.bar/baz", test.provisioner, WithEventRecorder(recorder))
+			ctrl.classes.Add(class)
+
+			ctrl.provisionClaimOperation(ctx, claim)
+
+			var reasons []string
+			for len(recorder.Events) > 0 {
+				event := <-recorder.Events
+				fields := strings.SplitN(event, " ", 3)
+				reasons = append(reasons, fields[0]+" "+fields[1])
+			}
+			if !reflect.DeepEqual(reasons, test.expectedEvents) {
+				t.Errorf("expected events %v, got %v", test.expectedEvents, reasons)
+			}
+
+			// No broadcaster is started, nothing is written to the API server.
+			if ctrl.eventRecorder != recorder {
+				t.Errorf("expected the injected recorder to be used")
+			}
+			events, err := client.CoreV1().Events(v1.NamespaceAll).List(ctx, metav1.ListOptions{})
+			if err != nil {
+				t.Fatalf("unexpected error listing events: %v", err)
+			}
+			if len(events.Items) != 0 {
+				t.Errorf("expected no events in API server, got %+v", events.Items)
+			}
+		})
+	}
+}
+
+func TestProvisioningSucceededEvent(t *testing.T) {
+	tests := []struct {
+		name          string
+		background    bool
+		failedCreates int
+		expectRetried bool
+	}{
+		{
+			name: "immediate save",
+		},
+		{
+			name:          "delayed save with backoff",
+			failedCreates: 2,
+			expectRetried: true,
+		},
+		{
+			name:          "delayed save in background",
+			background:    true,
+			failedCreates: 2,
+			expectRetried: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			logger, ctx := ktesting.NewTestContext(t)
+			ctx, cancel := context.WithCancel(ctx)
+			defer cancel()
+			class := newStorageClass("class-1", "foo.bar/baz")
+			claim := newClaim("claim-1", "uid-1-1", "class-1", "foo.bar/baz", "", nil)
+			client := fake.NewSimpleClientset(class, claim)
+			failures := 0
+			client.PrependReactor("create", "persistentvolumes", func(action testclient.Action) (handled bool, ret runtime.Object, err error) {
+				if failures < test.failedCreates {
+					failures++
+					return true, nil, errors.New("fake error")
+				}
+				return false, nil, nil
+			})
+			recorder := record.NewFakeRecorder(10)
+			ctrl := newTestProvisionController(logger, client, "foo.bar/baz", newTestProvisioner(), WithEventRecorder(recorder))
+			ctrl.classes.Add(class)
+			ctrl.claimsIndexer.Add(claim)
+			if test.background {
+				limiter := workqueue.NewItemExponentialFailureRateLimiter(10*time.Millisecond, 10*time.Millisecond)
+				ctrl.volumeStore = newVolumeStoreQueue(client, limiter, ctrl.claimsIndexer, recorder.Event, ctrl.metrics, 0, &ctrl.provisionStartTimes, ctrl.clock)
+			}
+			go ctrl.volumeStore.Run(ctx, 1)
+
+			if _, err := ctrl.provisionClaimOperation(ctx, claim); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			expected := regexp.QuoteMeta("Normal ProvisioningSucceeded Successfully provisioned volume pvc-uid-1-1 (StorageClass: class-1, capacity: 1MiB, duration: ") +
+				`[0-9.]+m?s\)`
+			if test.expectRetried {
+				expected += regexp.QuoteMeta(", saving the PV to API server was retried")
+			}
+			expectedRegexp := regexp.MustCompile("^" + expected + "$")
+			var events []string
+			err := wait.PollUntilContextTimeout(ctx, 10*time.Millisecond, 5*time.Second, true, func(context.Context) (bool, error) {
+				for len(recorder.Events) > 0 {
+					event := <-recorder.Events
+					events = append(events, event)
+					if strings.HasPrefix(event, v1.EventTypeNormal+" ProvisioningSucceeded") {
+						return true, nil
+					}
+				}
+				return false, nil
+			})
+			if err != nil {
+				t.Fatalf("expected ProvisioningSucceeded event, got %v", events)
+			}
+			if event := events[len(events)-1]; !expectedRegexp.MatchString(event) {
+				t.Errorf("expected event matching %q, got %q", expectedRegexp, event)
+			}
+		})
+	}
+}
+
+func TestEventComponent(t *testing.T) {
+	tests := []struct {
+		name              string
+		options           []func(*ProvisionController) error
+		expectedComponent string
+	}{
+		{
+			name:              "default",
+			expectedComponent: "foo.bar-baz",
+		},
+		{
+			name:              "custom",
+			options:           []func(*ProvisionController) error{EventComponent("my-provisioner")},
+			expectedComponent: "my-provisioner",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			logger, ctx := ktesting.NewTestContext(t)
+			class := newStorageClass("class-1", "foo.bar/baz")
+			claim := newClaim("claim-1", "uid-1-1", "class-1", "foo.bar/baz", "", nil)
+			client := fake.NewSimpleClientset(class, claim)
+			ctrl := newTestProvisionController(logger, client, "foo.bar/baz", newBadTestProvisioner(), test.options...)
+			ctrl.classes.Add(class)
+
+			ctrl.provisionClaimOperation(ctx, claim)
+
+			var events []v1.Event
+			err := wait.PollUntilContextTimeout(ctx, 10*time.Millisecond, 5*time.Second, true, func(ctx context.Context) (bool, error) {
+				list, err := client.CoreV1().Events(claim.Namespace).List(ctx, metav1.ListOptions{})
+				if err != nil {
+					return false, err
+				}
+				events = list.Items
+				return len(events) == 2, nil
+			})
+			if err != nil {
+				t.Fatalf("expected 2 events, got %+v", events)
+			}
+			for _, event := range events {
+				if event.Source.Component != test.expectedComponent {
+					t.Errorf("expected source component %q of event %q, got %q", test.expectedComponent, event.Reason, event.Source.Component)
+				}
+				if event.Source.Host != ctrl.id {
+					t.Errorf("expected source host %q of event %q, got %q", ctrl.id, event.Reason, event.Source.Host)
+				}
+			}
+		})
+	}
+}
+
+// componentRecorder is a ComponentEventRecorder that records the source
+// component of each event.
+type componentRecorder struct {
+	component string
+	events    chan string
+}
+
+var _ ComponentEventRecorder = &componentRecorder{}
+
+func (r *componentRecorder) WithComponent(component string) record.EventRecorder {
+	return &componentRecorder{component: component, events: r.events}
+}
+
+func (r *componentRecorder) Event(object runtime.Object, eventtype, reason, message string) {
+	r.events <- r.component + " " + eventtype + " " + reason + " " + message
+}
+
+func (r *componentRecorder) Eventf(object runtime.Object, eventtype, reason, messageFmt string, args ...interface{}) {
+	r.Event(object, eventtype, reason, fmt.Sprintf(messageFmt, args...))
+}
+
+func (r *componentRecorder) AnnotatedEventf(object runtime.Object, annotations map[string]string, eventtype, reason, messageFmt string, args ...interface{}) {
+	r.Eventf(object, eventtype, reason, messageFmt, args...)
+}
+
+func TestEventComponentInjectedRecorder(t *testing.T) {
+	tests := []struct {
+		name              string
+		options           []func(*ProvisionController) error
+		expectedComponent string
+	}{
+		{
+			name:              "default",
+			expectedComponent: "foo.bar-baz",
+		},
+		{
+			name:              "custom",
+			options:           []func(*ProvisionController) error{EventComponent("my-provisioner")},
+			expectedComponent: "my-provisioner",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			logger, ctx := ktesting.NewTestContext(t)
+			class := newStorageClass("class-1", "foo.bar/baz")
+			claim := newClaim("claim-1", "uid-1-1", "class-1", "foo.bar/baz", "", nil)
+			recorder := &componentRecorder{events: make(chan string, 10)}
+			ctrl := newTestProvisionController(logger, fake.NewSimpleClientset(class, claim), "foo.bar/baz", newBadTestProvisioner(), append(test.options, WithEventRecorder(recorder))...)
+			ctrl.classes.Add(class)
+
+			ctrl.provisionClaimOperation(ctx, claim)
+
+			if len(recorder.events) != 2 {
+				t.Fatalf("expected 2 events, got %d", len(recorder.events))
+			}
+			for len(recorder.events) > 0 {
+				if event := <-recorder.events; !strings.HasPrefix(event, test.expectedComponent+" ") {
+					t.Errorf("expected source component %q of event %q", test.expectedComponent, event)
+				}
+			}
+		})
+	}
+
+	t.Run("recorder without component", func(t *testing.T) {
+		logger, _ := ktesting.NewTestContext(t)
+		_, err := NewProvisionControllerOrError(logger, fake.NewSimpleClientset(), "foo.bar/baz", newTestProvisioner(),
+			EventComponent("my-provisioner"), WithEventRecorder(record.NewFakeRecorder(10)))
+		if err == nil || !strings.Contains(err.Error(), "EventComponent cannot be used together with WithEventRecorder") {
+			t.Errorf("expected error about EventComponent and WithEventRecorder, got %v", err)
+		}
+	})
+}
+
+func TestClassFailureEvents(t *testing.T) {
+	logger, ctx := ktesting.NewTestContext(t)
+	class := newStorageClass("class-1", "foo.bar/baz")
+	recorder := record.NewFakeRecorder(200)
+	fakeClock := testingclock.NewFakeClock(time.Now())
+	ctrl := newTestProvisionController(logger, fake.NewSimpleClientset(class), "foo.bar/baz", newBadTestProvisioner(),
+		ClassFailureEvents(10, time.Minute), WithEventRecorder(recorder), WithClock(fakeClock))
+	ctrl.classes.Add(class)
+
+	provisionClaims := func(prefix string) {
+		for i := 0; i < 20; i++ {
+			claim := newClaim(fmt.Sprintf("%s-%d", prefix, i), fmt.Sprintf("%s-uid-%d", prefix, i), "class-1", "foo.bar/baz", "", nil)
+			ctrl.provisionClaimOperation(ctx, claim)
+		}
+	}
+	classEvents := func() []string {
+		var events []string
+		for len(recorder.Events) > 0 {
+			if event := <-recorder.Events; strings.Contains(event, "ProvisioningFailedRepeatedly") {
+				events = append(events, event)
+			}
+		}
+		return events
+	}
+
+	provisionClaims("claim")
+	events := classEvents()
+	if len(events) != 1 {
+		t.Fatalf("expected 1 class event, got %v", events)
+	}
+	if expected := "10 claims failed to provision within 1m0s with the same error: fake final error"; !strings.Contains(events[0], expected) {
+		t.Errorf("unexpected class event %q", events[0])
+	}
+
+	// The event is sent again in the next window.
+	fakeClock.Step(time.Minute)
+	provisionClaims("other")
+	if events := classEvents(); len(events) != 1 {
+		t.Errorf("expected 1 class event in the next window, got %v", events)
+	}
+}
+
+func TestSharedInformerFactory(t *testing.T) {
+	logger, ctx := ktesting.NewTestContext(t)
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	class := newStorageClass("class-1", "foo.bar/baz")
+	claim := newClaim("claim-1", "uid-1-1", "class-1", "foo.bar/baz", "", nil)
+	client := fake.NewSimpleClientset(class, claim)
+	factory := informers.NewSharedInformerFactory(client, resyncPeriod)
+	ctrl := newTestProvisionController(logger, client, "foo.bar/baz", newTestProvisioner(), SharedInformerFactory(factory), LeaderElection(false))
+	// A second controller on the same factory must not conflict with the first one.
+	newTestProvisionController(logger, client, "foo.bar/other", newTestProvisioner(), SharedInformerFactory(factory), LeaderElection(false))
+
+	factory.Start(ctx.Done())
+	runTestController(t, ctx, ctrl.ProvisionController)
+
+	err := wait.PollUntilContextTimeout(ctx, 10*time.Millisecond, 5*time.Second, true, func(ctx context.Context) (bool, error) {
+		_, err := client.CoreV1().PersistentVolumes().Get(ctx, "pvc-uid-1-1", metav1.GetOptions{})
+		return err == nil, nil
+	})
+	if err != nil {
+		t.Fatalf("volume was not provisioned")
+	}
+
+	watches := map[string]int{}
+	for _, action := range client.Actions() {
+		if action.GetVerb() == "watch" {
+			watches[action.GetResource().Resource]++
+		}
+	}
+	expectedWatches := map[string]int{"persistentvolumeclaims": 1, "persistentvolumes": 1, "storageclasses": 1}
+	if !reflect.DeepEqual(watches, expectedWatches) {
+		t.Errorf("expected watches %v, got %v", expectedWatches, watches)
+	}
+}
+
+func TestInformerResyncPeriods(t *testing.T) {
+	logger, ctx := ktesting.NewTestContext(t)
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	// Objects of another provisioner, the controller must not update them.
+	class := newStorageClass("class-1", "foo.bar/other")
+	claim := newClaim("claim-1", "uid-1-1", "class-1", "foo.bar/other", "", nil)
+	volume := newVolume("volume-1", v1.VolumeBound, v1.PersistentVolumeReclaimRetain, map[string]string{AnnDynamicallyProvisioned: "foo.bar/other"}, nil, nil)
+	client := fake.NewSimpleClientset(class, claim, volume)
+	ctrl := newTestProvisionController(logger, client, "foo.bar/baz", newTestProvisioner(), LeaderElection(false),
+		ClaimResyncPeriod(time.Second), VolumeResyncPeriod(0), ClassResyncPeriod(time.Hour))
+
+	// Handlers added without a resync period get the resync period of the
+	// informer, but at least 1s.
+	var claimResyncs, volumeResyncs, classResyncs atomic.Int32
+	countResyncs := func(counter *atomic.Int32) cache.ResourceEventHandler {
+		return cache.ResourceEventHandlerFuncs{UpdateFunc: func(oldObj, newObj interface{}) {
+			if reflect.DeepEqual(oldObj, newObj) {
+				counter.Add(1)
+			}
+		}}
+	}
+	ctrl.claimInformer.AddEventHandler(countResyncs(&claimResyncs))
+	ctrl.volumeInformer.AddEventHandler(countResyncs(&volumeResyncs))
+	ctrl.classInformer.AddEventHandler(countResyncs(&classResyncs))
+
+	runTestController(t, ctx, ctrl.ProvisionController)
+
+	err := wait.PollUntilContextTimeout(ctx, 10*time.Millisecond, 5*time.Second, true, func(ctx context.Context) (bool, error) {
+		return claimResyncs.Load() >= 2, nil
+	})
+	if err != nil {
+		t.Errorf("claims were not resynced")
+	}
+	// With the default resync period of the test controller, volumes and
+	// classes would have been resynced as often as claims by now.
+	if resyncs := volumeResyncs.Load(); resyncs != 0 {
+		t.Errorf("expected no resync of volumes, got %d", resyncs)
+	}
+	if resyncs := classResyncs.Load(); resyncs != 0 {
+		t.Errorf("expected no resync of classes, got %d", resyncs)
+	}
+}
+
+func TestInformerResyncPeriodsValidation(t *testing.T) {
+	for _, option := range []func(time.Duration) func(*ProvisionController) error{ClaimResyncPeriod, VolumeResyncPeriod, ClassResyncPeriod} {
+		if err := option(-time.Second)(&ProvisionController{hasRunLock: &sync.Mutex{}}); err == nil {
+			t.Errorf("expected error for negative resync period")
+		}
+	}
+}
+
+func TestVolumeListWatchLabelSelectorValidation(t *testing.T) {
+	if err := VolumeListWatchLabelSelector("owner in (foo")(&ProvisionController{hasRunLock: &sync.Mutex{}}); err == nil {
+		t.Errorf("expected error for invalid selector")
+	}
+}
+
+func TestLabelExistingVolumes(t *testing.T) {
+	_, ctx := ktesting.NewTestContext(t)
+	mine := newVolume("volume-1", v1.VolumeBound, v1.PersistentVolumeReclaimDelete, map[string]string{AnnDynamicallyProvisioned: "foo.bar/baz"}, nil, nil)
+	labeled := newVolume("volume-2", v1.VolumeBound, v1.PersistentVolumeReclaimDelete, map[string]string{AnnDynamicallyProvisioned: "foo.bar/baz"}, nil, nil)
+	labeled.Labels = map[string]string{"owner": "foo", "other": "label"}
+	other := newVolume("volume-3", v1.VolumeBound, v1.PersistentVolumeReclaimDelete, map[string]string{AnnDynamicallyProvisioned: "foo.bar/other"}, nil, nil)
+	overrideKey := newVolume("volume-4", v1.VolumeBound, v1.PersistentVolumeReclaimDelete, map[string]string{"example.com/provisioned-by": "foo.bar/baz"}, nil, nil)
+	// The ProvisionedByAnnotation key takes precedence.
+	adopted := newVolume("volume-5", v1.VolumeBound, v1.PersistentVolumeReclaimDelete, map[string]string{"example.com/provisioned-by": "foo.bar/other", AnnDynamicallyProvisioned: "foo.bar/baz"}, nil, nil)
+	client := fake.NewSimpleClientset(mine, labeled, other, overrideKey, adopted)
+
+	if err := LabelExistingVolumes(ctx, client, "foo.bar/baz", "example.com/provisioned-by", "owner=foo"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expectedLabels := map[string]map[string]string{
+		"volume-1": {"owner": "foo"},
+		"volume-2": {"owner": "foo", "other": "label"},
+		"volume-3": nil,
+		"volume-4": {"owner": "foo"},
+		"volume-5": nil,
+	}
+	for name, expected := range expectedLabels {
+		volume, err := client.CoreV1().PersistentVolumes().Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !reflect.DeepEqual(volume.Labels, expected) {
+			t.Errorf("expected labels %v of %s, got %v", expected, name, volume.Labels)
+		}
+	}
+	patches := 0
+	for _, action := range client.Actions() {
+		if action.GetVerb() == "patch" {
+			patches++
+		}
+	}
+	if patches != 2 {
+		t.Errorf("expected 2 patches, got %d", patches)
+	}
+	if err := LabelExistingVolumes(ctx, client, "foo.bar/baz", AnnDynamicallyProvisioned, ""); err == nil {
+		t.Errorf("expected error for empty label")
+	}
+}
+
+// pagedVolumes serves List of PVs one per page, the fake clientset ignores
+// Limit and Continue.
+type pagedVolumes struct {
+	corev1client.PersistentVolumeInterface
+	lists []metav1.ListOptions
+}
+
+func (v *pagedVolumes) List(ctx context.Context, opts metav1.ListOptions) (*v1.PersistentVolumeList, error) {
+	v.lists = append(v.lists, opts)
+	if opts.Limit == 0 {
+		return nil, errors.New("expected a paged list")
+	}
+	list, err := v.PersistentVolumeInterface.List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	i := 0
+	if opts.Continue != "" {
+		i, _ = strconv.Atoi(opts.Continue)
+	}
+	page := &v1.PersistentVolumeList{Items: list.Items[i : i+1]}
+	if i+1 < len(list.Items) {
+		page.Continue = strconv.Itoa(i + 1)
+	}
+	return page, nil
+}
+
+type pagedCoreV1 struct {
+	corev1client.CoreV1Interface
+	volumes *pagedVolumes
+}
+
+func (c pagedCoreV1) PersistentVolumes() corev1client.PersistentVolumeInterface {
+	return c.volumes
+}
+
+type pagedClient struct {
+	*fake.Clientset
+	core pagedCoreV1
+}
+
+func (c pagedClient) CoreV1() corev1client.CoreV1Interface {
+	return c.core
+}
+
+func TestLabelExistingVolumesPages(t *testing.T) {
+	_, ctx := ktesting.NewTestContext(t)
+	var objs []runtime.Object
+	for i := 0; i < 3; i++ {
+		objs = append(objs, newVolume(fmt.Sprintf("volume-%d", i), v1.VolumeBound, v1.PersistentVolumeReclaimDelete, map[string]string{AnnDynamicallyProvisioned: "foo.bar/baz"}, nil, nil))
+	}
+	fakeClient := fake.NewSimpleClientset(objs...)
+	volumes := &pagedVolumes{PersistentVolumeInterface: fakeClient.CoreV1().PersistentVolumes()}
+	client := pagedClient{Clientset: fakeClient, core: pagedCoreV1{CoreV1Interface: fakeClient.CoreV1(), volumes: volumes}}
+
+	if err := LabelExistingVolumes(ctx, client, "foo.bar/baz", AnnDynamicallyProvisioned, "owner=foo"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(volumes.lists) != len(objs) {
+		t.Errorf("expected %d pages, got %d", len(objs), len(volumes.lists))
+	}
+	list, err := fakeClient.CoreV1().PersistentVolumes().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, volume := range list.Items {
+		if volume.Labels["owner"] != "foo" {
+			t.Errorf("expected label owner=foo of %s, got %v", volume.Name, volume.Labels)
+		}
+	}
+}
+
+func TestInformerTransform(t *testing.T) {
+	logger, ctx := ktesting.NewTestContext(t)
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	managedFields := []metav1.ManagedFieldsEntry{{Manager: "kubectl", Operation: metav1.ManagedFieldsOperationApply}}
+	large := strings.Repeat("x", 200)
+	class := newStorageClass("class-1", "foo.bar/baz")
+	claim := newClaim("claim-1", "uid-1-1", "class-1", "foo.bar/baz", "", map[string]string{
+		AnnBetaStorageProvisioner:                          "foo.bar/baz",
+		"kubectl.kubernetes.io/last-applied-configuration": large,
+		"example.com/keep":                                 large,
+		"example.com/small":                                "small",
+	})
+	claim.ManagedFields = managedFields
+	volume := newVolume("volume-1", v1.VolumeReleased, v1.PersistentVolumeReclaimDelete, map[string]string{AnnDynamicallyProvisioned: "foo.bar/baz"}, nil, nil)
+	volume.ManagedFields = managedFields
+	client := fake.NewSimpleClientset(class, claim, volume)
+	provisioner := &claimRecordingProvisioner{testProvisioner: newTestProvisioner()}
+	ctrl := newTestProvisionController(logger, client, "foo.bar/baz", provisioner, LeaderElection(false), CachedAnnotationSizeLimit(100, "example.com/keep"))
+
+	runTestController(t, ctx, ctrl.ProvisionController)
+
+	err := wait.PollUntilContextTimeout(ctx, 10*time.Millisecond, 5*time.Second, true, func(ctx context.Context) (bool, error) {
+		_, err := client.CoreV1().PersistentVolumes().Get(ctx, "pvc-uid-1-1", metav1.GetOptions{})
+		if err != nil {
+			return false, nil
+		}
+		_, err = client.CoreV1().PersistentVolumes().Get(ctx, "volume-1", metav1.GetOptions{})
+		return apierrs.IsNotFound(err), nil
+	})
+	if err != nil {
+		t.Fatalf("volume was not provisioned or deleted")
+	}
+
+	expectedAnnotations := map[string]string{
+		AnnBetaStorageProvisioner: "foo.bar/baz",
+		"example.com/keep":        large,
+		"example.com/small":       "small",
+	}
+	obj, exists, err := ctrl.claimInformer.GetStore().GetByKey("default/claim-1")
+	if err != nil || !exists {
+		t.Fatalf("claim not in cache: %v", err)
+	}
+	cached := obj.(*v1.PersistentVolumeClaim)
+	if cached.ManagedFields != nil {
+		t.Errorf("expected no managed fields of cached claim, got %v", cached.ManagedFields)
+	}
+	if !reflect.DeepEqual(cached.Annotations, expectedAnnotations) {
+		t.Errorf("expected annotations of cached claim %v, got %v", expectedAnnotations, cached.Annotations)
+	}
+	provisioner.lock.Lock()
+	for _, claim := range provisioner.claims {
+		if claim.ManagedFields != nil || !reflect.DeepEqual(claim.Annotations, expectedAnnotations) {
+			t.Errorf("expected claim without managed fields and annotations %v passed to Provision, got %+v", expectedAnnotations, claim.ObjectMeta)
+		}
+	}
+	provisioner.lock.Unlock()
+
+	// The claim in API server is unchanged.
+	claim, err = client.CoreV1().PersistentVolumeClaims("default").Get(ctx, "claim-1", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if claim.ManagedFields == nil || claim.Annotations["kubectl.kubernetes.io/last-applied-configuration"] != large {
+		t.Errorf("expected unchanged claim in API server, got %+v", claim.ObjectMeta)
+	}
+
+	// PVCs and PVs are transformed the same way, again and again.
+	volume = newVolume("volume-2", v1.VolumeBound, v1.PersistentVolumeReclaimDelete, map[string]string{"kubectl.kubernetes.io/last-applied-configuration": large}, nil, nil)
+	volume.ManagedFields = managedFields
+	transformed, _ := ctrl.transformObject(volume.DeepCopy())
+	again, _ := ctrl.transformObject(transformed.(*v1.PersistentVolume).DeepCopy())
+	if !reflect.DeepEqual(transformed, again) {
+		t.Errorf("expected idempotent transform, got %+v and %+v", transformed, again)
+	}
+	if meta := transformed.(*v1.PersistentVolume).ObjectMeta; meta.ManagedFields != nil || len(meta.Annotations) != 0 {
+		t.Errorf("expected volume without managed fields and annotations, got %+v", meta)
+	}
+}
+
+func TestListers(t *testing.T) {
+	logger, ctx := ktesting.NewTestContext(t)
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	class := newStorageClass("class-1", "example.com/pools")
+	claim1 := newClaim("claim-1", "uid-1-1", "class-1", "example.com/pools", "", nil)
+	claim2 := newClaim("claim-2", "uid-1-2", "class-1", "example.com/pools", "", nil)
+	client := fake.NewSimpleClientset(class, claim1)
+	provisioner := &poolProvisioner{pools: []string{"pool-a", "pool-b"}}
+	ctrl := newTestProvisionController(logger, client, "example.com/pools", provisioner, LeaderElection(false))
+	provisioner.controller = ctrl.ProvisionController
+
+	if _, err := ctrl.ClaimsLister(); err == nil {
+		t.Errorf("expected error before Run")
+	}
+	if _, err := ctrl.VolumesLister(); err == nil {
+		t.Errorf("expected error before Run")
+	}
+	if _, err := ctrl.ClassesLister(); err == nil {
+		t.Errorf("expected error before Run")
+	}
+
+	runTestController(t, ctx, ctrl.ProvisionController)
+
+	err := wait.PollUntilContextTimeout(ctx, 10*time.Millisecond, 5*time.Second, true, func(ctx context.Context) (bool, error) {
+		_, err := client.CoreV1().PersistentVolumes().Get(ctx, "pvc-uid-1-1", metav1.GetOptions{})
+		return err == nil, nil
+	})
+	if err != nil {
+		t.Fatalf("volume 1 was not provisioned")
+	}
+	// The provisioner must see the first volume in the lister and pick another pool.
+	if _, err := client.CoreV1().PersistentVolumeClaims("default").Create(ctx, claim2, metav1.CreateOptions{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var volume2 *v1.PersistentVolume
+	err = wait.PollUntilContextTimeout(ctx, 10*time.Millisecond, 5*time.Second, true, func(ctx context.Context) (bool, error) {
+		volume2, err = client.CoreV1().PersistentVolumes().Get(ctx, "pvc-uid-1-2", metav1.GetOptions{})
+		return err == nil, nil
+	})
+	if err != nil {
+		t.Fatalf("volume 2 was not provisioned")
+	}
+	if pool := volume2.Annotations[annPool]; pool != "pool-b" {
+		t.Errorf("expected volume 2 in pool-b, got %q", pool)
+	}
+
+	claims, err := ctrl.ClaimsLister()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if claim, err := claims.PersistentVolumeClaims("default").Get("claim-1"); err != nil || claim.UID != "uid-1-1" {
+		t.Errorf("expected claim-1, got %v, %v", claim, err)
+	}
+	classes, err := ctrl.ClassesLister()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if class, err := classes.Get("class-1"); err != nil || class.Provisioner != "example.com/pools" {
+		t.Errorf("expected class-1, got %v, %v", class, err)
+	}
+	if _, err := classes.Get("class-missing"); !apierrs.IsNotFound(err) {
+		t.Errorf("expected NotFound error, got %v", err)
+	}
+}
+
+func TestClassesListerV1beta1(t *testing.T) {
+	store := cache.NewStore(cache.MetaNamespaceKeyFunc)
+	store.Add(&storagebeta.StorageClass{ObjectMeta: metav1.ObjectMeta{Name: "class-1", Labels: map[string]string{"foo": "bar"}}, Provisioner: "foo.bar/baz"})
+	store.Add(&storagebeta.StorageClass{ObjectMeta: metav1.ObjectMeta{Name: "class-2"}, Provisioner: "foo.bar/baz"})
+	lister := classLister{store}
+
+	class, err := lister.Get("class-1")
+	if err != nil || class.Provisioner != "foo.bar/baz" {
+		t.Errorf("expected class-1, got %v, %v", class, err)
+	}
+	classes, err := lister.List(labels.SelectorFromSet(labels.Set{"foo": "bar"}))
+	if err != nil || len(classes) != 1 || classes[0].Name != "class-1" {
+		t.Errorf("expected [class-1], got %v, %v", classes, err)
+	}
+}
+
+func TestClassCreatedAfterClaim(t *testing.T) {
+	logger, ctx := ktesting.NewTestContext(t)
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	claim := newClaim("claim-1", "uid-1-1", "class-1", "foo.bar/baz", "", nil)
+	otherClaim := newClaim("claim-2", "uid-1-2", "class-2", "foo.bar/baz", "", nil)
+	client := fake.NewSimpleClientset(claim, otherClaim)
+	ctrl := newTestProvisionController(logger, client, "foo.bar/baz", newTestProvisioner(), LeaderElection(false),
+		ResyncPeriod(time.Hour), FailedProvisionThreshold(1))
+
+	runTestController(t, ctx, ctrl.ProvisionController)
+
+	// Wait until the controller gives up on the claim.
+	err := wait.PollUntilContextTimeout(ctx, 10*time.Millisecond, 5*time.Second, true, func(ctx context.Context) (bool, error) {
+		return ctrl.claimQueue.NumRequeues("uid-1-1") >= 1 && ctrl.claimQueue.Len() == 0, nil
+	})
+	if err != nil {
+		t.Fatalf("claim was not processed")
+	}
+
+	if _, err := client.StorageV1().StorageClasses().Create(ctx, newStorageClass("class-1", "foo.bar/baz"), metav1.CreateOptions{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	err = wait.PollUntilContextTimeout(ctx, 10*time.Millisecond, 2*time.Second, true, func(ctx context.Context) (bool, error) {
+		_, err := client.CoreV1().PersistentVolumes().Get(ctx, "pvc-uid-1-1", metav1.GetOptions{})
+		return err == nil, nil
+	})
+	if err != nil {
+		t.Fatalf("volume was not provisioned after the class was created")
+	}
+	if requeues := ctrl.claimQueue.NumRequeues("uid-1-1"); requeues != 0 {
+		t.Errorf("expected reset failure counter, got %d", requeues)
+	}
+	if requeues := ctrl.claimQueue.NumRequeues("uid-1-2"); requeues == 0 {
+		t.Errorf("expected failure counter of claim of another class to be kept")
+	}
+}
+
+func TestExistingVolumeTopologies(t *testing.T) {
+	logger, _ := ktesting.NewTestContext(t)
+	ctrl := newTestProvisionControllerWithAdditionalNames(logger, fake.NewSimpleClientset(), "foo.bar/baz", newTestProvisioner(), []string{"foo.bar/old"})
+	if _, err := ctrl.ExistingVolumeTopologies(labels.Everything(), v1.LabelTopologyZone); err == nil {
+		t.Errorf("expected error before caches synced")
+	}
+	ctrl.setState(func() { ctrl.cachesSynced = true })
+
+	// PVs of app "db" and "web", bound to claims with the app label.
+	addVolume := func(name, provisioner, app string, zones ...string) {
+		volume := newVolume(name, v1.VolumeBound, v1.PersistentVolumeReclaimDelete, map[string]string{AnnDynamicallyProvisioned: provisioner}, nil, nil)
+		if len(zones) > 0 {
+			volume.Spec.NodeAffinity = &v1.VolumeNodeAffinity{Required: &v1.NodeSelector{NodeSelectorTerms: []v1.NodeSelectorTerm{
+				{MatchExpressions: []v1.NodeSelectorRequirement{{Key: v1.LabelTopologyZone, Operator: v1.NodeSelectorOpIn, Values: zones}}},
+			}}}
+		}
+		if app != "" {
+			claim := newClaim("claim-"+name, "uid-"+name, "class-1", provisioner, name, nil)
+			claim.Labels = map[string]string{"app": app}
+			volume.Spec.ClaimRef = &v1.ObjectReference{Namespace: claim.Namespace, Name: claim.Name, UID: claim.UID}
+			ctrl.claimInformer.GetStore().Add(claim)
+		}
+		ctrl.volumes.Add(volume)
+	}
+	addVolume("volume-1", "foo.bar/baz", "db", "zone-a")
+	addVolume("volume-2", "foo.bar/baz", "db", "zone-a")
+	addVolume("volume-3", "foo.bar/baz", "db", "zone-b")
+	addVolume("volume-4", "foo.bar/old", "web", "zone-c")
+	addVolume("volume-5", "foo.bar/baz", "web", "zone-b", "zone-c")
+	// No node affinity.
+	addVolume("volume-6", "foo.bar/baz", "db")
+	// Not bound.
+	addVolume("volume-7", "foo.bar/baz", "", "zone-a")
+	// Another provisioner.
+	addVolume("volume-8", "other.bar/baz", "db", "zone-c")
+	// Beta zone label.
+	beta := newVolume("volume-9", v1.VolumeBound, v1.PersistentVolumeReclaimDelete, map[string]string{AnnDynamicallyProvisioned: "foo.bar/baz"}, nil, nil)
+	beta.Spec.NodeAffinity = &v1.VolumeNodeAffinity{Required: &v1.NodeSelector{NodeSelectorTerms: []v1.NodeSelectorTerm{
+		{MatchExpressions: []v1.NodeSelectorRequirement{{Key: v1.LabelFailureDomainBetaZone, Operator: v1.NodeSelectorOpIn, Values: []string{"zone-c"}}}},
+	}}}
+	ctrl.volumes.Add(beta)
+
+	tests := []struct {
+		name     string
+		selector labels.Selector
+		key      string
+		expected map[string]int
+	}{
+		{
+			name:     "all volumes",
+			selector: labels.Everything(),
+			key:      v1.LabelTopologyZone,
+			expected: map[string]int{"zone-a": 3, "zone-b": 2, "zone-c": 3},
+		},
+		{
+			name:     "db",
+			selector: labels.SelectorFromSet(labels.Set{"app": "db"}),
+			key:      v1.LabelTopologyZone,
+			expected: map[string]int{"zone-a": 2, "zone-b": 1},
+		},
+		{
+			name:     "web",
+			selector: labels.SelectorFromSet(labels.Set{"app": "web"}),
+			key:      v1.LabelFailureDomainBetaZone,
+			expected: map[string]int{"zone-b": 1, "zone-c": 2},
+		},
+		{
+			name:     "unknown app",
+			selector: labels.SelectorFromSet(labels.Set{"app": "cache"}),
+			key:      v1.LabelTopologyZone,
+			expected: map[string]int{},
+		},
+		{
+			name:     "unknown key",
+			selector: labels.Everything(),
+			key:      "example.com/rack",
+			expected: map[string]int{},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			counts, err := ctrl.ExistingVolumeTopologies(test.selector, test.key)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(counts, test.expected) {
+				t.Errorf("expected %v, got %v", test.expected, counts)
+			}
+		})
+	}
+}
+
+func TestClaimIndexes(t *testing.T) {
+	logger, _ := ktesting.NewTestContext(t)
+	ctrl := newTestProvisionController(logger, fake.NewSimpleClientset(), "foo.bar/baz", newTestProvisioner())
+	if _, err := ctrl.ClaimsByClass("class-1"); err == nil {
+		t.Errorf("expected error before caches synced")
+	}
+	ctrl.setState(func() { ctrl.cachesSynced = true })
+
+	claimNames := func(claims []*v1.PersistentVolumeClaim, err error) []string {
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		names := []string{}
+		for _, claim := range claims {
+			names = append(names, claim.Name)
+		}
+		sort.Strings(names)
+		return names
+	}
+	check := func(byClass, byNode map[string][]string) {
+		t.Helper()
+		for class, expected := range byClass {
+			if names := claimNames(ctrl.ClaimsByClass(class)); !reflect.DeepEqual(names, expected) {
+				t.Errorf("expected claims %v of class %q, got %v", expected, class, names)
+			}
+		}
+		for node, expected := range byNode {
+			if names := claimNames(ctrl.ClaimsBySelectedNode(node)); !reflect.DeepEqual(names, expected) {
+				t.Errorf("expected claims %v of node %q, got %v", expected, node, names)
+			}
+		}
+	}
+
+	claim1 := newClaim("claim-1", "uid-1-1", "class-1", "foo.bar/baz", "", map[string]string{AnnSelectedNode: "node-1"})
+	claim2 := newClaim("claim-2", "uid-1-2", "", "foo.bar/baz", "", map[string]string{v1.BetaStorageClassAnnotation: "class-1", AnnAlphaSelectedNode: "node-1"})
+	claim3 := newClaim("claim-3", "uid-1-3", "", "foo.bar/baz", "", nil)
+	claim3.Spec.StorageClassName = nil
+	for _, claim := range []*v1.PersistentVolumeClaim{claim1, claim2, claim3} {
+		if err := ctrl.claimsIndexer.Add(claim); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	check(map[string][]string{"class-1": {"claim-1", "claim-2"}, "": {"claim-3"}},
+		map[string][]string{"node-1": {"claim-1", "claim-2"}, "node-2": {}})
+
+	claim1 = claim1.DeepCopy()
+	claim1.Annotations[AnnSelectedNode] = "node-2"
+	class2 := "class-2"
+	claim1.Spec.StorageClassName = &class2
+	if err := ctrl.claimsIndexer.Update(claim1); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	check(map[string][]string{"class-1": {"claim-2"}, "class-2": {"claim-1"}},
+		map[string][]string{"node-1": {"claim-2"}, "node-2": {"claim-1"}})
+
+	if err := ctrl.claimsIndexer.Delete(claim2); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	check(map[string][]string{"class-1": {}, "class-2": {"claim-1"}},
+		map[string][]string{"node-1": {}, "node-2": {"claim-1"}})
+}
+
+func TestCacheSyncTimeout(t *testing.T) {
+	logger, ctx := ktesting.NewTestContext(t)
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	client := fake.NewSimpleClientset(newStorageClass("class-1", "foo.bar/baz"))
+	client.PrependReactor("list", "persistentvolumes", func(action testclient.Action) (bool, runtime.Object, error) {
+		return true, nil, apierrs.NewForbidden(v1.Resource("persistentvolumes"), "", errors.New("forbidden"))
+	})
+	ctrl := newTestProvisionController(logger, client, "foo.bar/baz", newTestProvisioner(), CacheSyncTimeout(500*time.Millisecond))
+	go ctrl.claimInformer.Run(ctx.Done())
+	go ctrl.volumeInformer.Run(ctx.Done())
+	go ctrl.classInformer.Run(ctx.Done())
+
+	err := ctrl.waitForCacheSync(ctx)
+	if err == nil {
+		t.Fatalf("expected error")
+	}
+	if !strings.Contains(err.Error(), "informer caches of persistentvolumes have not synced") {
+		t.Errorf("expected error naming persistentvolumes only, got %v", err)
+	}
+	if !ctrl.claimInformer.HasSynced() || !ctrl.classInformer.HasSynced() {
+		t.Errorf("expected synced claims and classes informers")
+	}
+}
+
+// afterClock is a fake clock that hands the durations of After calls to
+// the test, so that it steps the clock only when the caller waits.
+type afterClock struct {
+	*testingclock.FakeClock
+	after chan time.Duration
+}
+
+func (c *afterClock) After(d time.Duration) <-chan time.Time {
+	ch := c.FakeClock.After(d)
+	c.after <- d
+	return ch
+}
+
+func TestCacheSyncTimeoutProgress(t *testing.T) {
+	logger, ctx := ktesting.NewTestContext(t)
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	client := fake.NewSimpleClientset()
+	fakeClock := &afterClock{FakeClock: testingclock.NewFakeClock(time.Now()), after: make(chan time.Duration)}
+	ctrl := newTestProvisionController(logger, client, "foo.bar/baz", newTestProvisioner(), CacheSyncTimeout(300*time.Millisecond), WithClock(fakeClock))
+	// The informers sync one by one, each within the timeout but all of them
+	// together not.
+	runInformer := func(informer cache.SharedInformer) {
+		t.Helper()
+		go informer.Run(ctx.Done())
+		if !cache.WaitForCacheSync(ctx.Done(), informer.HasSynced) {
+			t.Fatalf("informer did not sync")
+		}
+	}
+	synced := make(chan error, 1)
+	// poll lets waitForCacheSync poll the given number of times, unless it
+	// returns.
+	poll := func(polls int) {
+		t.Helper()
+		for i := 0; i < polls; i++ {
+			select {
+			case err := <-synced:
+				synced <- err
+				return
+			case d := <-fakeClock.after:
+				fakeClock.Step(d)
+			case <-time.After(wait.ForeverTestTimeout):
+				t.Fatalf("waitForCacheSync does not poll")
+			}
+		}
+	}
+	runInformer(ctrl.claimInformer)
+	go func() {
+		synced <- ctrl.waitForCacheSync(ctx)
+	}()
+	poll(2)
+	runInformer(ctrl.volumeInformer)
+	poll(2)
+	runInformer(ctrl.classInformer)
+	// The next poll sees all informers synced.
+	poll(1)
+
+	select {
+	case err := <-synced:
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+	case <-time.After(wait.ForeverTestTimeout):
+		t.Fatalf("waitForCacheSync did not return")
+	}
+}
+
+func TestNewProvisionControllerOrError(t *testing.T) {
+	logger, _ := ktesting.NewTestContext(t)
+	client := fake.NewSimpleClientset()
+	tests := []struct {
+		name            string
+		client          kubernetes.Interface
+		provisionerName string
+		provisioner     Provisioner
+		options         []func(*ProvisionController) error
+		expectedErrors  []string
+	}{
+		{
+			name:            "valid",
+			client:          client,
+			provisionerName: "foo.bar/baz",
+			provisioner:     newTestProvisioner(),
+		},
+		{
+			name:           "empty provisioner name and nil client",
+			provisioner:    newTestProvisioner(),
+			expectedErrors: []string{"provisioner name must not be empty", "client must not be nil"},
+		},
+		{
+			name:            "invalid options",
+			client:          client,
+			provisionerName: "foo.bar/baz",
+			provisioner:     newTestProvisioner(),
+			options:         []func(*ProvisionController) error{Threadiness(0), ProvisioningDisabled(true), DeletionDisabled(true)},
+			expectedErrors:  []string{"invalid Threadiness", "DeletionDisabled cannot be used together with ProvisioningDisabled"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			options := append([]func(*ProvisionController) error{MetricsInstance(metrics.New(newTestMetricsSubsystem()))}, test.options...)
+			ctrl, err := NewProvisionControllerOrError(logger, test.client, test.provisionerName, test.provisioner, options...)
+			if len(test.expectedErrors) == 0 {
+				if err != nil || ctrl == nil {
+					t.Errorf("expected controller, got error %v", err)
+				}
+				return
+			}
+			if err == nil || ctrl != nil {
+				t.Fatalf("expected errors %q, got controller", test.expectedErrors)
+			}
+			for _, expected := range test.expectedErrors {
+				if !strings.Contains(err.Error(), expected) {
+					t.Errorf("expected error %q in %q", expected, err)
+				}
+			}
+		})
+	}
+}
+
+func TestValidateProvisionerName(t *testing.T) {
+	tests := []struct {
+		name          string
+		expectedError string
+	}{
+		{name: "example.com/nfs"},
+		{name: "foo.bar/baz"},
+		{name: "kubernetes.io/aws-ebs"},
+		{name: "example.com/nfs_v2.1"},
+		{name: "", expectedError: "must not be empty"},
+		{name: "example.com/NFS", expectedError: "must be lowercase"},
+		{name: "example.com/nfs ", expectedError: "name part must consist of alphanumeric characters"},
+		{name: "nfs.csi.k8s.io"},
+		{name: "nfs", expectedError: "must be a domain or have a domain prefix"},
+		{name: "NFS.csi.k8s.io", expectedError: "must be lowercase"},
+		{name: "example.com/", expectedError: "name part must be non-empty"},
+		{name: "example_com/nfs", expectedError: "prefix part a lowercase RFC 1123 subdomain"},
+		{name: "example.com/" + strings.Repeat("a", 64), expectedError: "name part must be no more than 63 characters"},
+		{name: "a/b/c", expectedError: "a qualified name must consist of"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := ValidateProvisionerName(test.name)
+			if test.expectedError == "" {
+				if err != nil {
+					t.Errorf("expected no error, got %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), test.expectedError) {
+				t.Errorf("expected error containing %q, got %v", test.expectedError, err)
+			}
+		})
+	}
+
+	logger, _ := ktesting.NewTestContext(t)
+	client := fake.NewSimpleClientset()
+	if _, err := NewProvisionControllerOrError(logger, client, "example.com/NFS ", newTestProvisioner()); err == nil || !strings.Contains(err.Error(), "invalid provisioner name") {
+		t.Errorf("expected invalid provisioner name error, got %v", err)
+	}
+	if _, err := NewProvisionControllerOrError(logger, client, "example.com/NFS", newTestProvisioner(),
+		MetricsInstance(metrics.New(newTestMetricsSubsystem())), AllowLegacyProvisionerName(true)); err != nil {
+		t.Errorf("expected legacy provisioner name to be allowed, got %v", err)
+	}
+}
+
+func TestObjectClient(t *testing.T) {
+	logger, ctx := ktesting.NewTestContext(t)
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	class := newStorageClass("class-1", "foo.bar/baz")
+	claim := newClaim("claim-1", "uid-1-1", "class-1", "foo.bar/baz", "", nil)
+	local := fake.NewSimpleClientset()
+	remote := fake.NewSimpleClientset(class, claim)
+	ctrl := newTestProvisionController(logger, local, "foo.bar/baz", newTestProvisioner(), ObjectClient(remote))
+	runTestController(t, ctx, ctrl.ProvisionController)
+
+	err := wait.PollUntilContextTimeout(ctx, 10*time.Millisecond, wait.ForeverTestTimeout, true, func(ctx context.Context) (bool, error) {
+		volumes, err := remote.CoreV1().PersistentVolumes().List(ctx, metav1.ListOptions{})
+		if err != nil || len(volumes.Items) == 0 {
+			return false, err
+		}
+		leases, err := local.CoordinationV1().Leases(metav1.NamespaceAll).List(ctx, metav1.ListOptions{})
+		if err != nil || len(leases.Items) == 0 {
+			return false, err
+		}
+		events, err := local.CoreV1().Events(metav1.NamespaceAll).List(ctx, metav1.ListOptions{})
+		if err != nil {
+			return false, err
+		}
+		for _, event := range events.Items {
+			if event.Reason == "ProvisioningSucceeded" {
+				return true, nil
+			}
+		}
+		return false, nil
+	})
+	if err != nil {
+		t.Fatalf("expected PV in object client, lease and event in local client: %v", err)
+	}
+
+	objectResources := sets.New("persistentvolumeclaims", "persistentvolumes", "storageclasses")
+	for _, action := range local.Actions() {
+		if objectResources.Has(action.GetResource().Resource) {
+			t.Errorf("unexpected action on local client: %s %s", action.GetVerb(), action.GetResource().Resource)
+		}
+	}
+	for _, action := range remote.Actions() {
+		if resource := action.GetResource().Resource; resource == "events" || resource == "leases" {
+			t.Errorf("unexpected action on object client: %s %s", action.GetVerb(), resource)
+		}
+	}
+}
+
+func TestPauseResume(t *testing.T) {
+	logger, ctx := ktesting.NewTestContext(t)
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	objs := []runtime.Object{newStorageClass("class-1", "foo.bar/baz")}
+	for i := 0; i < 6; i++ {
+		objs = append(objs, newClaim(fmt.Sprintf("claim-%d", i), fmt.Sprintf("uid-%d", i), "class-1", "foo.bar/baz", "", nil))
+	}
+	client := fake.NewSimpleClientset(objs...)
+	provisioner := newTestProvisioner()
+	ctrl := newTestProvisionController(logger, client, "foo.bar/baz", provisioner, LeaderElection(false), Threadiness(1), ReadyWhenPaused(false))
+	runTestController(t, ctx, ctrl.ProvisionController)
+
+	countVolumes := func() int {
+		volumes, err := client.CoreV1().PersistentVolumes().List(ctx, metav1.ListOptions{})
+		if err != nil {
+			t.Fatalf("failed to list PVs: %v", err)
+		}
+		return len(volumes.Items)
+	}
+
+	// Pause while the first Provision call is in progress.
+	select {
+	case <-provisioner.provisionCalls:
+	case <-time.After(wait.ForeverTestTimeout):
+		t.Fatalf("expected Provision call")
+	}
+	ctrl.Pause()
+	if !ctrl.Paused() {
+		t.Errorf("expected controller to be paused")
+	}
+	if err := ctrl.Ready(); err == nil || err.Error() != "controller is paused" {
+		t.Errorf("expected paused controller not to be ready, got %v", err)
+	}
+	if n := testutil.ToFloat64(ctrl.metrics.Paused); n != 1 {
+		t.Errorf("expected paused metric 1, got %v", n)
+	}
+	err := wait.PollUntilContextTimeout(ctx, 10*time.Millisecond, wait.ForeverTestTimeout, true, func(ctx context.Context) (bool, error) {
+		return countVolumes() == 1, nil
+	})
+	if err != nil {
+		t.Fatalf("expected the PV in progress to be saved: %v", err)
+	}
+	// The worker is done with the first claim and waits, the others stay queued.
+	err = wait.PollUntilContextTimeout(ctx, 10*time.Millisecond, wait.ForeverTestTimeout, true, func(ctx context.Context) (bool, error) {
+		return ctrl.claimQueue.Len() >= 5, nil
+	})
+	if err != nil {
+		t.Fatalf("expected the remaining claims to be queued, got %d", ctrl.claimQueue.Len())
+	}
+	if n := len(provisioner.provisionCalls); n != 0 {
+		t.Errorf("expected no Provision calls while paused, got %d", n)
+	}
+	if n := countVolumes(); n != 1 {
+		t.Errorf("expected 1 PV while paused, got %d", n)
+	}
+
+	ctrl.Resume()
+	for i := 1; i < 6; i++ {
+		select {
+		case <-provisioner.provisionCalls:
+		case <-time.After(wait.ForeverTestTimeout):
+			t.Fatalf("expected %d Provision calls after Resume, got %d", 5, i-1)
+		}
+	}
+	err = wait.PollUntilContextTimeout(ctx, 10*time.Millisecond, wait.ForeverTestTimeout, true, func(ctx context.Context) (bool, error) {
+		return countVolumes() == 6, nil
+	})
+	if err != nil {
+		t.Errorf("expected all PVs to be saved after Resume: %v", err)
+	}
+	if err := ctrl.Ready(); err != nil {
+		t.Errorf("expected resumed controller to be ready, got %v", err)
+	}
+	if n := testutil.ToFloat64(ctrl.metrics.Paused); n != 0 {
+		t.Errorf("expected paused metric 0, got %v", n)
+	}
+}
+
+func TestExpandVolume(t *testing.T) {
+	newExpansionObjects := func(allowExpansion bool, volumeSize string, conditions ...v1.PersistentVolumeClaimConditionType) (*storage.StorageClass, *v1.PersistentVolumeClaim, *v1.PersistentVolume) {
+		class := newStorageClass("class-1", "foo.bar/baz")
+		class.AllowVolumeExpansion = &allowExpansion
+		claim := newClaim("claim-1", "uid-1-1", "class-1", "foo.bar/baz", "volume-1", nil)
+		claim.Spec.Resources.Requests[v1.ResourceStorage] = resource.MustParse("2Gi")
+		claim.Status = v1.PersistentVolumeClaimStatus{
+			Phase:    v1.ClaimBound,
+			Capacity: v1.ResourceList{v1.ResourceStorage: resource.MustParse("1Gi")},
+		}
+		for _, condition := range conditions {
+			claim.Status.Conditions = append(claim.Status.Conditions, v1.PersistentVolumeClaimCondition{Type: condition, Status: v1.ConditionTrue})
+		}
+		volume := newVolume("volume-1", v1.VolumeBound, v1.PersistentVolumeReclaimDelete, map[string]string{AnnDynamicallyProvisioned: "foo.bar/baz"}, nil, nil)
+		volume.Spec.Capacity[v1.ResourceStorage] = resource.MustParse(volumeSize)
+		volume.Spec.ClaimRef = &v1.ObjectReference{Namespace: claim.Namespace, Name: claim.Name, UID: claim.UID}
+		volume.Spec.StorageClassName = "class-1"
+		return class, claim, volume
+	}
+
+	tests := []struct {
+		name                   string
+		allowExpansion         bool
+		volumeSize             string
+		conditions             []v1.PersistentVolumeClaimConditionType
+		nodeExpansion          bool
+		result                 string
+		err                    error
+		expectedCalls          []string
+		expectedError          bool
+		expectedVolumeSize     string
+		expectedClaimSize      string
+		expectedClaimCondition v1.PersistentVolumeClaimConditionType
+		expectedEvent          string
+	}{
+		{
+			name:               "grow",
+			allowExpansion:     true,
+			volumeSize:         "1Gi",
+			result:             "2Gi",
+			expectedCalls:      []string{"2Gi"},
+			expectedVolumeSize: "2Gi",
+			expectedClaimSize:  "2Gi",
+			expectedEvent:      "Normal VolumeResizeSuccessful",
+		},
+		{
+			name:               "backend reports larger size",
+			allowExpansion:     true,
+			volumeSize:         "1Gi",
+			result:             "3Gi",
+			expectedCalls:      []string{"2Gi"},
+			expectedVolumeSize: "3Gi",
+			expectedClaimSize:  "3Gi",
+			expectedEvent:      "Normal VolumeResizeSuccessful",
+		},
+		{
+			name:                   "node expansion required",
+			allowExpansion:         true,
+			volumeSize:             "1Gi",
+			nodeExpansion:          true,
+			result:                 "2Gi",
+			expectedCalls:          []string{"2Gi"},
+			expectedVolumeSize:     "2Gi",
+			expectedClaimSize:      "1Gi",
+			expectedClaimCondition: v1.PersistentVolumeClaimFileSystemResizePending,
+			expectedEvent:          "Normal FileSystemResizeRequired",
+		},
+		{
+			name:                   "failure",
+			allowExpansion:         true,
+			volumeSize:             "1Gi",
+			err:                    errors.New("backend is down"),
+			expectedCalls:          []string{"2Gi"},
+			expectedError:          true,
+			expectedVolumeSize:     "1Gi",
+			expectedClaimSize:      "1Gi",
+			expectedClaimCondition: v1.PersistentVolumeClaimResizing,
+			expectedEvent:          "Warning VolumeResizeFailed",
+		},
+		{
+			name:                   "backend reports smaller size",
+			allowExpansion:         true,
+			volumeSize:             "1Gi",
+			result:                 "1Gi",
+			expectedCalls:          []string{"2Gi"},
+			expectedError:          true,
+			expectedVolumeSize:     "1Gi",
+			expectedClaimSize:      "1Gi",
+			expectedClaimCondition: v1.PersistentVolumeClaimResizing,
+			expectedEvent:          "Warning VolumeResizeFailed",
+		},
+		{
+			name:               "expansion disabled",
+			allowExpansion:     false,
+			volumeSize:         "1Gi",
+			expectedVolumeSize: "1Gi",
+			expectedClaimSize:  "1Gi",
+		},
+		{
+			name:                   "waiting for node expansion",
+			allowExpansion:         true,
+			volumeSize:             "2Gi",
+			conditions:             []v1.PersistentVolumeClaimConditionType{v1.PersistentVolumeClaimFileSystemResizePending},
+			expectedVolumeSize:     "2Gi",
+			expectedClaimSize:      "1Gi",
+			expectedClaimCondition: v1.PersistentVolumeClaimFileSystemResizePending,
+		},
+		{
+			name:               "claim status not saved after expansion",
+			allowExpansion:     true,
+			volumeSize:         "2Gi",
+			conditions:         []v1.PersistentVolumeClaimConditionType{v1.PersistentVolumeClaimResizing},
+			expectedVolumeSize: "2Gi",
+			expectedClaimSize:  "2Gi",
+			expectedEvent:      "Normal VolumeResizeSuccessful",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			logger, ctx := ktesting.NewTestContext(t)
+			class, claim, volume := newExpansionObjects(test.allowExpansion, test.volumeSize, test.conditions...)
+			client := fake.NewSimpleClientset(class, claim, volume)
+			expander := &expandTestProvisioner{testProvisioner: newTestProvisioner(), results: []expandResult{{size: test.result, err: test.err}}}
+			fakeClock := testingclock.NewFakeClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+			ctrl := newTestProvisionController(logger, client, "foo.bar/baz", expander, NodeExpansionRequired(test.nodeExpansion), WithClock(fakeClock))
+			recorder := record.NewFakeRecorder(10)
+			ctrl.eventRecorder = recorder
+			ctrl.classes.Add(class)
+			ctrl.volumes.Add(volume)
+
+			err := ctrl.syncClaim(ctx, claim)
+			if (err != nil) != test.expectedError {
+				t.Errorf("expected error %v, got %v", test.expectedError, err)
+			}
+			if calls := expander.expandCalls(); !reflect.DeepEqual(calls, test.expectedCalls) {
+				t.Errorf("expected ExpandVolume calls %v, got %v", test.expectedCalls, calls)
+			}
+			newVolume, err := client.CoreV1().PersistentVolumes().Get(ctx, volume.Name, metav1.GetOptions{})
+			if err != nil {
+				t.Fatalf("failed to get PV: %v", err)
+			}
+			if size := newVolume.Spec.Capacity[v1.ResourceStorage]; size.Cmp(resource.MustParse(test.expectedVolumeSize)) != 0 {
+				t.Errorf("expected PV capacity %s, got %s", test.expectedVolumeSize, size.String())
+			}
+			newClaim, err := client.CoreV1().PersistentVolumeClaims(claim.Namespace).Get(ctx, claim.Name, metav1.GetOptions{})
+			if err != nil {
+				t.Fatalf("failed to get claim: %v", err)
+			}
+			if size := newClaim.Status.Capacity[v1.ResourceStorage]; size.Cmp(resource.MustParse(test.expectedClaimSize)) != 0 {
+				t.Errorf("expected claim capacity %s, got %s", test.expectedClaimSize, size.String())
+			}
+			var conditions []v1.PersistentVolumeClaimConditionType
+			for _, condition := range newClaim.Status.Conditions {
+				conditions = append(conditions, condition.Type)
+				if len(test.conditions) == 0 && !condition.LastTransitionTime.Time.Equal(fakeClock.Now()) {
+					t.Errorf("expected last transition time %v of condition %q, got %v", fakeClock.Now(), condition.Type, condition.LastTransitionTime)
+				}
+			}
+			if test.expectedClaimCondition == "" && len(conditions) > 0 || test.expectedClaimCondition != "" && !reflect.DeepEqual(conditions, []v1.PersistentVolumeClaimConditionType{test.expectedClaimCondition}) {
+				t.Errorf("expected claim condition %q, got %v", test.expectedClaimCondition, conditions)
+			}
+			found := test.expectedEvent == ""
+			for len(recorder.Events) > 0 {
+				if event := <-recorder.Events; test.expectedEvent != "" && strings.HasPrefix(event, test.expectedEvent) {
+					found = true
+				}
+			}
+			if !found {
+				t.Errorf("expected event %q", test.expectedEvent)
+			}
+		})
+	}
+
+	t.Run("retry after failure", func(t *testing.T) {
+		logger, ctx := ktesting.NewTestContext(t)
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		class, claim, volume := newExpansionObjects(true, "1Gi")
+		client := fake.NewSimpleClientset(class, claim, volume)
+		expander := &expandTestProvisioner{testProvisioner: newTestProvisioner(), results: []expandResult{{err: errors.New("backend is down")}, {size: "2Gi"}}}
+		rateLimiter := workqueue.NewItemExponentialFailureRateLimiter(10*time.Millisecond, 10*time.Millisecond)
+		ctrl := newTestProvisionController(logger, client, "foo.bar/baz", expander, LeaderElection(false), RateLimiter(rateLimiter))
+		runTestController(t, ctx, ctrl.ProvisionController)
+
+		err := wait.PollUntilContextTimeout(ctx, 10*time.Millisecond, wait.ForeverTestTimeout, true, func(ctx context.Context) (bool, error) {
+			claim, err := client.CoreV1().PersistentVolumeClaims(claim.Namespace).Get(ctx, claim.Name, metav1.GetOptions{})
+			if err != nil {
+				return false, err
+			}
+			size := claim.Status.Capacity[v1.ResourceStorage]
+			return size.Cmp(resource.MustParse("2Gi")) == 0, nil
+		})
+		if err != nil {
+			t.Fatalf("expected claim to be expanded after retry: %v", err)
+		}
+		if calls := expander.expandCalls(); !reflect.DeepEqual(calls, []string{"2Gi", "2Gi"}) {
+			t.Errorf("expected 2 ExpandVolume calls, got %v", calls)
+		}
+	})
+}
+
+func TestProvisionWarnings(t *testing.T) {
+	longWarning := strings.Repeat("x", 300)
+	tests := []struct {
+		name           string
+		warnings       []string
+		expectedEvents []string
+	}{
+		{
+			name:     "two warnings",
+			warnings: []string{"requested ext3, provisioned ext4", "size rounded up to 10Gi"},
+			expectedEvents: []string{
+				"Normal ProvisioningWarning requested ext3, provisioned ext4",
+				"Normal ProvisioningWarning size rounded up to 10Gi",
+			},
+		},
+		{
+			name:     "duplicate and empty warnings",
+			warnings: []string{"size rounded up to 10Gi", "", "size rounded up to 10Gi"},
+			expectedEvents: []string{
+				"Normal ProvisioningWarning size rounded up to 10Gi",
+			},
+		},
+		{
+			name:     "capped and truncated",
+			warnings: []string{"1", "2", "3", "4", longWarning, "6"},
+			expectedEvents: []string{
+				"Normal ProvisioningWarning 1",
+				"Normal ProvisioningWarning 2",
+				"Normal ProvisioningWarning 3",
+				"Normal ProvisioningWarning 4",
+				"Normal ProvisioningWarning " + longWarning[:maxProvisionWarningLength-3] + "...",
+			},
+		},
+		{
+			name: "no warnings",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			logger, ctx := ktesting.NewTestContext(t)
+			class := newStorageClass("class-1", "foo.bar/baz")
+			claim := newClaim("claim-1", "uid-1-1", "class-1", "foo.bar/baz", "", nil)
+			client := fake.NewSimpleClientset(claim)
+			provisioner := &warningTestProvisioner{testProvisioner: newTestProvisioner(), warnings: test.warnings}
+			ctrl := newTestProvisionController(logger, client, "foo.bar/baz", provisioner)
+			recorder := record.NewFakeRecorder(20)
+			ctrl.eventRecorder = recorder
+			ctrl.classes.Add(class)
+
+			// The second attempt provisions the claim again after its PV
+			// was deleted, it must not send the warnings again.
+			for i := 0; i < 2; i++ {
+				if _, err := ctrl.provisionClaimOperation(ctx, claim); err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				pvName := ctrl.getProvisionedVolumeNameForClaim(claim)
+				if err := client.CoreV1().PersistentVolumes().Delete(ctx, pvName, metav1.DeleteOptions{}); err != nil {
+					t.Fatalf("PV %s was not saved: %v", pvName, err)
+				}
+				if obj, exists, _ := ctrl.volumes.GetByKey(pvName); exists {
+					ctrl.volumes.Delete(obj)
+				}
+			}
+			var events []string
+			for len(recorder.Events) > 0 {
+				if event := <-recorder.Events; strings.Contains(event, "ProvisioningWarning") {
+					events = append(events, event)
+				}
+			}
+			if !reflect.DeepEqual(events, test.expectedEvents) {
+				t.Errorf("expected events %q, got %q", test.expectedEvents, events)
+			}
+		})
+	}
+}
+
+func TestTranslatedInTreePluginName(t *testing.T) {
+	tests := []struct {
+		name                string
+		translatedName      string
+		claimProvisioner    string
+		classProvisioner    string
+		expectedProvisioned bool
+	}{
+		{
+			name:                "CSI claim, CSI class",
+			translatedName:      "kubernetes.io/aws-ebs",
+			claimProvisioner:    "ebs.csi.aws.com",
+			classProvisioner:    "ebs.csi.aws.com",
+			expectedProvisioned: true,
+		},
+		{
+			name:                "in-tree claim, in-tree class",
+			translatedName:      "kubernetes.io/aws-ebs",
+			claimProvisioner:    "kubernetes.io/aws-ebs",
+			classProvisioner:    "kubernetes.io/aws-ebs",
+			expectedProvisioned: true,
+		},
+		{
+			name:                "CSI claim, in-tree class",
+			translatedName:      "kubernetes.io/aws-ebs",
+			claimProvisioner:    "ebs.csi.aws.com",
+			classProvisioner:    "kubernetes.io/aws-ebs",
+			expectedProvisioned: true,
+		},
+		{
+			name:                "in-tree claim, CSI class",
+			translatedName:      "kubernetes.io/aws-ebs",
+			claimProvisioner:    "kubernetes.io/aws-ebs",
+			classProvisioner:    "ebs.csi.aws.com",
+			expectedProvisioned: true,
+		},
+		{
+			name:             "other in-tree claim",
+			translatedName:   "kubernetes.io/aws-ebs",
+			claimProvisioner: "kubernetes.io/gce-pd",
+			classProvisioner: "kubernetes.io/gce-pd",
+		},
+		{
+			name:             "in-tree claim without translation",
+			claimProvisioner: "kubernetes.io/aws-ebs",
+			classProvisioner: "kubernetes.io/aws-ebs",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			logger, ctx := ktesting.NewTestContext(t)
+			class := newStorageClass("class-1", test.classProvisioner)
+			claim := newClaim("claim-1", "uid-1-1", "class-1", test.claimProvisioner, "", nil)
+			client := fake.NewSimpleClientset(claim)
+			ctrl := newTestProvisionController(logger, client, "ebs.csi.aws.com", newTestProvisioner(), TranslatedInTreePluginName(test.translatedName))
+			ctrl.classes.Add(class)
+
+			should, err := ctrl.shouldProvision(ctx, claim)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if should != test.expectedProvisioned {
+				t.Fatalf("expected should provision %v, got %v", test.expectedProvisioned, should)
+			}
+			if !should {
+				return
+			}
+			if _, err := ctrl.provisionClaimOperation(ctx, claim); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			volume, err := client.CoreV1().PersistentVolumes().Get(ctx, "pvc-uid-1-1", metav1.GetOptions{})
+			if err != nil {
+				t.Fatalf("expected PV to be saved: %v", err)
+			}
+			if provisionedBy := volume.Annotations[AnnDynamicallyProvisioned]; provisionedBy != "ebs.csi.aws.com" {
+				t.Errorf("expected PV provisioned by ebs.csi.aws.com, got %q", provisionedBy)
+			}
+		})
+	}
+}
+
+func TestStorageProvisionerAnnotations(t *testing.T) {
+	tests := []struct {
+		name                string
+		annotations         map[string]string
+		expectedProvisioned bool
+		expectedWarning     bool
+	}{
+		{
+			name:                "beta only",
+			annotations:         map[string]string{AnnBetaStorageProvisioner: "foo.bar/baz"},
+			expectedProvisioned: true,
+		},
+		{
+			name:                "GA only",
+			annotations:         map[string]string{AnnStorageProvisioner: "foo.bar/baz"},
+			expectedProvisioned: true,
+		},
+		{
+			name:                "both agree",
+			annotations:         map[string]string{AnnStorageProvisioner: "foo.bar/baz", AnnBetaStorageProvisioner: "foo.bar/baz"},
+			expectedProvisioned: true,
+		},
+		{
+			name:                "both disagree, GA matches",
+			annotations:         map[string]string{AnnStorageProvisioner: "foo.bar/baz", AnnBetaStorageProvisioner: "foo.bar/old"},
+			expectedProvisioned: true,
+			expectedWarning:     true,
+		},
+		{
+			name:            "both disagree, beta matches",
+			annotations:     map[string]string{AnnStorageProvisioner: "foo.bar/old", AnnBetaStorageProvisioner: "foo.bar/baz"},
+			expectedWarning: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var lines []string
+			logger := funcr.New(func(prefix, args string) {
+				lines = append(lines, args)
+			}, funcr.Options{})
+			ctx := klog.NewContext(context.Background(), logger)
+			class := newStorageClass("class-1", "foo.bar/baz")
+			claim := newClaim("claim-1", "uid-1-1", "class-1", "", "", test.annotations)
+			client := fake.NewSimpleClientset(claim)
+			ctrl := newTestProvisionController(logger, client, "foo.bar/baz", newTestProvisioner())
+			ctrl.classes.Add(class)
+
+			should, err := ctrl.shouldProvision(ctx, claim)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if should != test.expectedProvisioned {
+				t.Errorf("expected should provision %v, got %v", test.expectedProvisioned, should)
+			}
+			var warned bool
+			for _, line := range lines {
+				if strings.Contains(line, "storage-provisioner annotations of the claim disagree") {
+					warned = true
+				}
+			}
+			if warned != test.expectedWarning {
+				t.Errorf("expected warning %v, got log %q", test.expectedWarning, lines)
+			}
+			if !should {
+				return
+			}
+			if _, err := ctrl.provisionClaimOperation(ctx, claim); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			volume, err := client.CoreV1().PersistentVolumes().Get(ctx, "pvc-uid-1-1", metav1.GetOptions{})
+			if err != nil {
+				t.Fatalf("expected PV to be saved: %v", err)
+			}
+			for _, key := range []string{AnnStorageProvisioner, AnnBetaStorageProvisioner} {
+				if _, found := volume.Annotations[key]; found {
+					t.Errorf("expected no annotation %s on PV, got %v", key, volume.Annotations)
+				}
+			}
+		})
+	}
+}
+
+func TestVolumeAttributesClass(t *testing.T) {
+	gold := &storagealpha.VolumeAttributesClass{
+		ObjectMeta: metav1.ObjectMeta{Name: "gold"},
+		DriverName: "foo.bar/baz",
+		Parameters: map[string]string{"iops": "5000"},
+	}
+	otherDriver := &storagealpha.VolumeAttributesClass{
+		ObjectMeta: metav1.ObjectMeta{Name: "gold"},
+		DriverName: "abc.def/ghi",
+	}
+	tests := []struct {
+		name               string
+		vacName            *string
+		objs               []runtime.Object
+		resolve            bool
+		expectedErr        bool
+		expectedParameters map[string]string
+	}{
+		{
+			name:    "claim without class",
+			resolve: true,
+		},
+		{
+			name:    "claim with class, not resolved",
+			vacName: ptr.To("gold"),
+		},
+		{
+			name:               "claim with class, resolved",
+			vacName:            ptr.To("gold"),
+			objs:               []runtime.Object{gold},
+			resolve:            true,
+			expectedParameters: map[string]string{"iops": "5000"},
+		},
+		{
+			name:        "class not found",
+			vacName:     ptr.To("gold"),
+			resolve:     true,
+			expectedErr: true,
+		},
+		{
+			name:        "class of another driver",
+			vacName:     ptr.To("gold"),
+			objs:        []runtime.Object{otherDriver},
+			resolve:     true,
+			expectedErr: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			logger, ctx := ktesting.NewTestContext(t)
+			class := newStorageClass("class-1", "foo.bar/baz")
+			claim := newClaim("claim-1", "uid-1-1", "class-1", "foo.bar/baz", "", nil)
+			claim.Spec.VolumeAttributesClassName = test.vacName
+			client := fake.NewSimpleClientset(append(test.objs, claim)...)
+			provisioner := newTestProvisioner()
+			ctrl := newTestProvisionController(logger, client, "foo.bar/baz", provisioner, ResolveVolumeAttributesClass(test.resolve))
+			ctrl.classes.Add(class)
+
+			state, err := ctrl.provisionClaimOperation(ctx, claim)
+			if test.expectedErr {
+				// Resolution failures are retried.
+				if err == nil || state != ProvisioningNoChange {
+					t.Errorf("expected retryable error, got state %s, error %v", state, err)
+				}
+				if len(provisioner.provisionCalls) != 0 {
+					t.Errorf("expected no Provision call")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			params := <-provisioner.provisionCalls
+			if !reflect.DeepEqual(params.vacName, test.vacName) {
+				t.Errorf("expected VolumeAttributesClassName %v, got %v", test.vacName, params.vacName)
+			}
+			if !reflect.DeepEqual(params.vacParameters, test.expectedParameters) {
+				t.Errorf("expected VolumeAttributesClassParameters %v, got %v", test.expectedParameters, params.vacParameters)
+			}
+			volume, err := client.CoreV1().PersistentVolumes().Get(ctx, "pvc-uid-1-1", metav1.GetOptions{})
+			if err != nil {
+				t.Fatalf("expected PV to be saved: %v", err)
+			}
+			if !reflect.DeepEqual(volume.Spec.VolumeAttributesClassName, test.vacName) {
+				t.Errorf("expected PV volumeAttributesClassName %v, got %v", test.vacName, volume.Spec.VolumeAttributesClassName)
+			}
+		})
+	}
+}
+
+func TestStopBeforeRun(t *testing.T) {
+	logger, ctx := ktesting.NewTestContext(t)
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	ctrl := newTestProvisionController(logger, fake.NewSimpleClientset(), "foo.bar/baz", newTestProvisioner(), LeaderElection(false))
+
+	ctrl.Stop()
+	select {
+	case <-ctrl.Stopped():
+		t.Fatalf("expected controller not stopped before Run")
+	default:
+	}
+	if ctrl.HasSynced() || ctrl.IsLeader() {
+		t.Errorf("expected controller neither synced nor leader before Run, got synced %v, leader %v", ctrl.HasSynced(), ctrl.IsLeader())
+	}
+
+	// Stop before Run does not stop Run.
+	runErr := make(chan error, 1)
+	go func() {
+		runErr <- ctrl.Run(ctx)
+	}()
+	if !cache.WaitForCacheSync(ctx.Done(), ctrl.HasSynced) {
+		t.Fatalf("controller did not sync")
+	}
+	if !ctrl.IsLeader() {
+		t.Errorf("expected controller without leader election to lead while it runs")
+	}
+	if err := ctrl.Run(ctx); !errors.Is(err, errRunTwice) {
+		t.Errorf("expected error %v of second Run, got %v", errRunTwice, err)
+	}
+	ctrl.Stop()
+	if err := <-runErr; err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	<-ctrl.Stopped()
+	if ctrl.IsLeader() || !ctrl.HasSynced() {
+		t.Errorf("expected stopped controller synced and not leader, got synced %v, leader %v", ctrl.HasSynced(), ctrl.IsLeader())
+	}
+	// Stop after Run does nothing.
+	ctrl.Stop()
+}
+
+func TestRunStopRestart(t *testing.T) {
+	logger, ctx := ktesting.NewTestContext(t)
+	client := fake.NewSimpleClientset(newStorageClass("class-1", "foo.bar/baz"))
+	for i := 0; i < 20; i++ {
+		ctrl := newTestProvisionController(logger, client, "foo.bar/baz", newTestProvisioner(), LeaderElection(i%2 == 0))
+		runCtx, cancel := context.WithCancel(ctx)
+		runErr := make(chan error, 1)
+		go func() {
+			runErr <- ctrl.Run(runCtx)
+		}()
+		// The accessors are safe while Run starts and stops.
+		accessorsDone := make(chan struct{})
+		go func() {
+			defer close(accessorsDone)
+			for {
+				select {
+				case <-ctrl.Stopped():
+					return
+				default:
+					ctrl.HasSynced()
+					ctrl.IsLeader()
+					ctrl.Ready()
+				}
+			}
+		}()
+
+		switch i % 3 {
+		case 0:
+			// Stop while the controller starts.
+			cancel()
+		case 1:
+			if !cache.WaitForCacheSync(ctx.Done(), ctrl.HasSynced) {
+				t.Fatalf("controller did not sync")
+			}
+			ctrl.Stop()
+		case 2:
+			if !cache.WaitForCacheSync(ctx.Done(), ctrl.IsLeader) {
+				t.Fatalf("controller did not lead")
+			}
+			cancel()
+		}
+		select {
+		case <-ctrl.Stopped():
+		case <-time.After(wait.ForeverTestTimeout):
+			t.Fatalf("controller %d did not stop", i)
+		}
+		if err := <-runErr; err != nil {
+			t.Errorf("controller %d: unexpected error: %v", i, err)
+		}
+		<-accessorsDone
+		if ctrl.IsLeader() {
+			t.Errorf("expected stopped controller %d not to lead", i)
+		}
+		if err := ctrl.Run(ctx); !errors.Is(err, errRunTwice) {
+			t.Errorf("expected error %v of Run of stopped controller %d, got %v", errRunTwice, i, err)
+		}
+		cancel()
+	}
+}
+
+func TestPartialMetricsInstance(t *testing.T) {
+	logger, _ := ktesting.NewTestContext(t)
+	full := metrics.New(newTestMetricsSubsystem())
+	partial := metrics.Metrics{
+		PersistentVolumeClaimProvisionTotal:           full.PersistentVolumeClaimProvisionTotal,
+		PersistentVolumeClaimProvisionFailedTotal:     full.PersistentVolumeClaimProvisionFailedTotal,
+		PersistentVolumeClaimProvisionDurationSeconds: full.PersistentVolumeClaimProvisionDurationSeconds,
+		PersistentVolumeDeleteTotal:                   full.PersistentVolumeDeleteTotal,
+		PersistentVolumeDeleteFailedTotal:             full.PersistentVolumeDeleteFailedTotal,
+		PersistentVolumeDeleteDurationSeconds:         full.PersistentVolumeDeleteDurationSeconds,
+	}
+	if n := len(partial.Collectors()); n != 6 {
+		t.Errorf("expected 6 collectors of partial metrics, got %d", n)
+	}
+
+	ctrl, err := NewProvisionControllerOrError(logger, fake.NewSimpleClientset(), "foo.bar/baz", newTestProvisioner(), MetricsInstance(partial))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if ctrl.metrics.PersistentVolumeClaimProvisionTotal != full.PersistentVolumeClaimProvisionTotal {
+		t.Errorf("expected collectors of the instance to be kept")
+	}
+	if ctrl.metrics.BuildInfo == nil || ctrl.metrics.Paused == nil {
+		t.Errorf("expected nil collectors to be filled, got %+v", ctrl.metrics)
+	}
+	if got, want := len(ctrl.metrics.Collectors()), len(full.Collectors()); got != want {
+		t.Errorf("expected %d collectors, got %d", want, got)
+	}
+}
+
+func TestNodeDeleter(t *testing.T) {
+	notReadyNode := &v1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "node-1", Labels: map[string]string{v1.LabelHostname: "node-1"}},
+		Status: v1.NodeStatus{Conditions: []v1.NodeCondition{
+			{Type: v1.NodeReady, Status: v1.ConditionFalse},
+		}},
+	}
+	renamedNode := &v1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "node-1.example.com", Labels: map[string]string{v1.LabelHostname: "node-1"}},
+	}
+	tests := []struct {
+		name              string
+		nodes             []runtime.Object
+		gracePeriod       time.Duration
+		missingNodeErr    error
+		expectedCall      string
+		expectedErr       bool
+		expectedEvent     string
+		expectedPVDeleted bool
+	}{
+		{
+			name:              "node deleted",
+			expectedCall:      "DeleteVolumeForMissingNode",
+			expectedEvent:     "Warning DeletingVolumeForMissingNode Node \"node-1\" of the volume no longer exists, forcing cleanup with DeleteVolumeForMissingNode instead of Delete",
+			expectedPVDeleted: true,
+		},
+		{
+			name:              "node NotReady",
+			nodes:             []runtime.Object{notReadyNode},
+			expectedCall:      "Delete",
+			expectedPVDeleted: true,
+		},
+		{
+			name:              "node with another name than its hostname",
+			nodes:             []runtime.Object{renamedNode},
+			expectedCall:      "Delete",
+			expectedPVDeleted: true,
+		},
+		{
+			name:              "node deleted within grace period",
+			gracePeriod:       time.Hour,
+			expectedCall:      "Delete",
+			expectedPVDeleted: true,
+		},
+		{
+			name:           "forced cleanup fails",
+			missingNodeErr: errors.New("backend unreachable"),
+			expectedCall:   "DeleteVolumeForMissingNode",
+			expectedErr:    true,
+			expectedEvent:  "Warning VolumeFailedDelete forced cleanup of volume of missing node \"node-1\" failed: backend unreachable",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			logger, ctx := ktesting.NewTestContext(t)
+			volume := newVolume("volume-1", v1.VolumeReleased, v1.PersistentVolumeReclaimDelete, map[string]string{AnnDynamicallyProvisioned: "foo.bar/baz"}, nil, nil)
+			volume.Spec.NodeAffinity = &v1.VolumeNodeAffinity{Required: &v1.NodeSelector{NodeSelectorTerms: []v1.NodeSelectorTerm{{
+				MatchExpressions: []v1.NodeSelectorRequirement{{Key: v1.LabelHostname, Operator: v1.NodeSelectorOpIn, Values: []string{"node-1"}}},
+			}}}}
+			client := fake.NewSimpleClientset(append(test.nodes, volume)...)
+			provisioner := &nodeDeleterTestProvisioner{missingNodeErr: test.missingNodeErr}
+			ctrl := newTestProvisionController(logger, client, "foo.bar/baz", provisioner, MissingNodeGracePeriod(test.gracePeriod))
+			recorder := record.NewFakeRecorder(10)
+			ctrl.eventRecorder = recorder
+
+			err := ctrl.deleteVolumeOperation(ctx, volume)
+			if test.expectedErr != (err != nil) {
+				t.Errorf("expected error %v, got %v", test.expectedErr, err)
+			}
+			if !reflect.DeepEqual(provisioner.calls, []string{test.expectedCall}) {
+				t.Errorf("expected call %s, got %v", test.expectedCall, provisioner.calls)
+			}
+			_, err = client.CoreV1().PersistentVolumes().Get(ctx, volume.Name, metav1.GetOptions{})
+			if deleted := apierrs.IsNotFound(err); deleted != test.expectedPVDeleted {
+				t.Errorf("expected PV deleted %v, got %v", test.expectedPVDeleted, deleted)
+			}
+			var events []string
+			for len(recorder.Events) > 0 {
+				events = append(events, <-recorder.Events)
+			}
+			if test.expectedEvent == "" && len(events) > 0 {
+				t.Errorf("expected no events, got %v", events)
+			}
+			if test.expectedEvent != "" && !slices.Contains(events, test.expectedEvent) {
+				t.Errorf("expected event %q, got %v", test.expectedEvent, events)
+			}
+		})
+	}
+}
+
+func TestMissingNodeGracePeriodClock(t *testing.T) {
+	logger, ctx := ktesting.NewTestContext(t)
+	volume := newVolume("volume-1", v1.VolumeReleased, v1.PersistentVolumeReclaimDelete, map[string]string{AnnDynamicallyProvisioned: "foo.bar/baz"}, nil, nil)
+	volume.Spec.NodeAffinity = &v1.VolumeNodeAffinity{Required: &v1.NodeSelector{NodeSelectorTerms: []v1.NodeSelectorTerm{{
+		MatchExpressions: []v1.NodeSelectorRequirement{{Key: v1.LabelHostname, Operator: v1.NodeSelectorOpIn, Values: []string{"node-1"}}},
+	}}}}
+	fakeClock := testingclock.NewFakeClock(time.Now())
+	ctrl := newTestProvisionController(logger, fake.NewSimpleClientset(volume), "foo.bar/baz", &nodeDeleterTestProvisioner{},
+		MissingNodeGracePeriod(time.Hour), WithClock(fakeClock))
+
+	for _, step := range []struct {
+		elapsed      time.Duration
+		expectedNode string
+	}{
+		{expectedNode: ""},
+		{elapsed: time.Hour - time.Second, expectedNode: ""},
+		{elapsed: time.Second, expectedNode: "node-1"},
+	} {
+		fakeClock.Step(step.elapsed)
+		node, err := ctrl.missingVolumeNode(ctx, volume)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if node != step.expectedNode {
+			t.Errorf("expected missing node %q after %v, got %q", step.expectedNode, step.elapsed, node)
+		}
+	}
+}
+
+func TestWithClock(t *testing.T) {
+	if err := WithClock(nil)(&ProvisionController{hasRunLock: &sync.Mutex{}}); err == nil {
+		t.Errorf("expected error for nil clock")
+	}
+}
+
+func TestHonorPVReclaimPolicy(t *testing.T) {
+	now := metav1.Now()
+	tests := []struct {
+		name            string
+		honor           bool
+		phase           v1.PersistentVolumePhase
+		policy          v1.PersistentVolumeReclaimPolicy
+		deleted         bool
+		claimExists     bool
+		expectedDeletes int
+	}{
+		{
+			name:            "PV deleted first",
+			honor:           true,
+			phase:           v1.VolumeBound,
+			policy:          v1.PersistentVolumeReclaimDelete,
+			deleted:         true,
+			expectedDeletes: 1,
+		},
+		{
+			name:        "PV deleted first, claim exists",
+			honor:       true,
+			phase:       v1.VolumeBound,
+			policy:      v1.PersistentVolumeReclaimDelete,
+			deleted:     true,
+			claimExists: true,
+		},
+		{
+			name:            "claim deleted first",
+			honor:           true,
+			phase:           v1.VolumeReleased,
+			policy:          v1.PersistentVolumeReclaimDelete,
+			expectedDeletes: 1,
+		},
+		{
+			name:    "PV deleted first, Retain policy",
+			honor:   true,
+			phase:   v1.VolumeBound,
+			policy:  v1.PersistentVolumeReclaimRetain,
+			deleted: true,
+		},
+		{
+			name:   "claim deleted first, Retain policy",
+			honor:  true,
+			phase:  v1.VolumeReleased,
+			policy: v1.PersistentVolumeReclaimRetain,
+		},
+		{
+			name:    "PV deleted first, AddFinalizer only",
+			phase:   v1.VolumeBound,
+			policy:  v1.PersistentVolumeReclaimDelete,
+			deleted: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			logger, ctx := ktesting.NewTestContext(t)
+			class := newStorageClass("class-1", "foo.bar/baz")
+			claim := newClaim("claim-1", "uid-1-1", "class-1", "foo.bar/baz", "", nil)
+			volume := newProvisionedVolume(ctx, class, claim, []string{finalizerPV})
+			volume.Spec.PersistentVolumeReclaimPolicy = test.policy
+			volume.Status.Phase = test.phase
+			if test.deleted {
+				volume.DeletionTimestamp = &now
+			}
+			objs := []runtime.Object{class, volume}
+			if test.claimExists {
+				objs = append(objs, claim)
+			}
+			client := fake.NewSimpleClientset(objs...)
+			prov := &deleteCountingProvisioner{testProvisioner: newTestProvisioner()}
+			ctrl := newTestProvisionController(logger, client, "foo.bar/baz", prov, AddFinalizer(true), HonorPVReclaimPolicy(test.honor))
+			ctrl.volumes.Add(volume)
+
+			if err := ctrl.syncVolume(ctx, volume); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(prov.deleted) != test.expectedDeletes {
+				t.Errorf("expected %d deletes, got %v", test.expectedDeletes, prov.deleted)
+			}
+		})
+	}
+}
+
+func TestHonorPVReclaimPolicyDeletesOnce(t *testing.T) {
+	logger, ctx := ktesting.NewTestContext(t)
+	class := newStorageClass("class-1", "foo.bar/baz")
+	claim := newClaim("claim-1", "uid-1-1", "class-1", "foo.bar/baz", "", nil)
+	volume := newProvisionedVolume(ctx, class, claim, []string{"example.com/finalizer"})
+	volume.Status.Phase = v1.VolumeBound
+	now := metav1.Now()
+	volume.DeletionTimestamp = &now
+	client := fake.NewSimpleClientset(class, volume)
+	pvDeletes := 0
+	client.PrependReactor("delete", "persistentvolumes", func(action testclient.Action) (bool, runtime.Object, error) {
+		pvDeletes++
+		if pvDeletes == 1 {
+			return true, nil, errors.New("fake error")
+		}
+		return false, nil, nil
+	})
+	prov := &deleteCountingProvisioner{testProvisioner: newTestProvisioner()}
+	ctrl := newTestProvisionController(logger, client, "foo.bar/baz", prov, HonorPVReclaimPolicy(true), PVFinalizer("example.com/finalizer"))
+	ctrl.volumes.Add(volume)
+
+	if err := ctrl.syncVolume(ctx, volume); err == nil {
+		t.Fatalf("expected error deleting the PV")
+	}
+	if err := ctrl.syncVolume(ctx, volume); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(prov.deleted) != 1 {
+		t.Errorf("expected storage asset deleted once, got %v", prov.deleted)
+	}
+	if pvDeletes != 2 {
+		t.Errorf("expected PV deleted twice, got %d", pvDeletes)
+	}
+}
+
+func TestPVFinalizer(t *testing.T) {
+	logger, ctx := ktesting.NewTestContext(t)
+	class := newStorageClass("class-1", "foo.bar/baz")
+	claim := newClaim("claim-1", "uid-1-1", "class-1", "foo.bar/baz", "", nil)
+	client := fake.NewSimpleClientset(claim)
+	ctrl := newTestProvisionController(logger, client, "foo.bar/baz", newTestProvisioner(), HonorPVReclaimPolicy(true), PVFinalizer("example.com/finalizer"))
+	ctrl.classes.Add(class)
+
+	if _, err := ctrl.provisionClaimOperation(ctx, claim); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	volume, err := client.CoreV1().PersistentVolumes().Get(ctx, "pvc-uid-1-1", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("expected PV to be saved: %v", err)
+	}
+	if !reflect.DeepEqual(volume.Finalizers, []string{"example.com/finalizer"}) {
+		t.Errorf("expected finalizer example.com/finalizer, got %v", volume.Finalizers)
+	}
+
+	if _, err := NewProvisionControllerOrError(logger, client, "foo.bar/baz", newTestProvisioner(), PVFinalizer("finalizer")); err == nil {
+		t.Errorf("expected error for finalizer without domain prefix")
+	}
+}
+
+func TestDeletionDisabled(t *testing.T) {
+	logger, ctx := ktesting.NewTestContext(t)
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	class := newStorageClass("class-1", "foo.bar/baz")
+	claim := newClaim("claim-1", "uid-1-1", "class-1", "foo.bar/baz", "", nil)
+	released := newVolume("volume-1", v1.VolumeReleased, v1.PersistentVolumeReclaimDelete, map[string]string{AnnDynamicallyProvisioned: "foo.bar/baz"}, nil, nil)
+	client := fake.NewSimpleClientset(class, claim, released)
+	ctrl := newTestProvisionController(logger, client, "foo.bar/baz", newTestProvisioner(), LeaderElection(false), DeletionDisabled(true))
+	if ctrl.volumeInformer != nil || ctrl.volumeQueue != nil {
+		t.Errorf("expected no volume informer and queue")
+	}
+
+	runTestController(t, ctx, ctrl.ProvisionController)
+
+	err := wait.PollUntilContextTimeout(ctx, 10*time.Millisecond, 5*time.Second, true, func(ctx context.Context) (bool, error) {
+		_, err := client.CoreV1().PersistentVolumes().Get(ctx, "pvc-uid-1-1", metav1.GetOptions{})
+		return err == nil, nil
+	})
+	if err != nil {
+		t.Fatalf("volume was not provisioned")
+	}
+	// Without a volume queue, nothing can delete the released volume.
+	if _, err := client.CoreV1().PersistentVolumes().Get(ctx, "volume-1", metav1.GetOptions{}); err != nil {
+		t.Errorf("released volume was deleted: %v", err)
+	}
+	for _, action := range client.Actions() {
+		if action.GetResource().Resource == "persistentvolumes" && (action.GetVerb() == "list" || action.GetVerb() == "watch") {
+			t.Errorf("unexpected %s of persistentvolumes", action.GetVerb())
+		}
+	}
+	if _, err := ctrl.VolumesLister(); err == nil {
+		t.Errorf("expected error of VolumesLister")
+	}
+}
+
+func TestProvisioningDisabled(t *testing.T) {
+	logger, ctx := ktesting.NewTestContext(t)
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	class := newStorageClass("class-1", "foo.bar/baz")
+	claim := newClaim("claim-1", "uid-1-1", "class-1", "foo.bar/baz", "", nil)
+	released := newVolume("volume-1", v1.VolumeReleased, v1.PersistentVolumeReclaimDelete, map[string]string{AnnDynamicallyProvisioned: "foo.bar/baz"}, nil, nil)
+	client := fake.NewSimpleClientset(class, claim, released)
+	ctrl := newTestProvisionController(logger, client, "foo.bar/baz", newTestProvisioner(), LeaderElection(false), ProvisioningDisabled(true))
+	if ctrl.claimInformer != nil || ctrl.claimQueue != nil {
+		t.Errorf("expected no claim informer and queue")
+	}
+
+	runTestController(t, ctx, ctrl.ProvisionController)
+
+	err := wait.PollUntilContextTimeout(ctx, 10*time.Millisecond, 5*time.Second, true, func(ctx context.Context) (bool, error) {
+		_, err := client.CoreV1().PersistentVolumes().Get(ctx, "volume-1", metav1.GetOptions{})
+		return apierrs.IsNotFound(err), nil
+	})
+	if err != nil {
+		t.Fatalf("released volume was not deleted")
+	}
+	// Without a claim queue, nothing can provision the claim.
+	if _, err := client.CoreV1().PersistentVolumes().Get(ctx, "pvc-uid-1-1", metav1.GetOptions{}); !apierrs.IsNotFound(err) {
+		t.Errorf("expected no provisioned volume, got %v", err)
+	}
+	for _, action := range client.Actions() {
+		if action.GetResource().Resource == "persistentvolumeclaims" {
+			t.Errorf("unexpected %s of persistentvolumeclaims", action.GetVerb())
+		}
+	}
+}
+
+func TestProvisioningAndDeletionDisabled(t *testing.T) {
+	logger, _ := ktesting.NewTestContext(t)
+	ctrl := newTestProvisionController(logger, fake.NewSimpleClientset(), "foo.bar/baz", newTestProvisioner())
+	ctrl.deletionDisabled = true
+	ctrl.provisioningDisabled = true
+	if err := ctrl.validateOptions(); err == nil {
+		t.Errorf("expected error")
+	}
+}
+
+func TestVolumeMetadataClient(t *testing.T) {
+	logger, ctx := ktesting.NewTestContext(t)
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	class := newStorageClass("class-1", "foo.bar/baz")
+	claim := newClaim("claim-1", "uid-1-1", "class-1", "foo.bar/baz", "", nil)
+	released := newVolume("volume-1", v1.VolumeReleased, v1.PersistentVolumeReclaimDelete, map[string]string{AnnDynamicallyProvisioned: "foo.bar/baz"}, nil, nil)
+	other := newVolume("volume-2", v1.VolumeReleased, v1.PersistentVolumeReclaimDelete, map[string]string{AnnDynamicallyProvisioned: "other.io/x"}, nil, nil)
+	boundClaim := newClaim("claim-3", "uid-3-3", "class-1", "foo.bar/baz", "volume-3", nil)
+	boundClaim.Status.Phase = v1.ClaimBound
+	bound := newVolume("volume-3", v1.VolumeBound, v1.PersistentVolumeReclaimDelete, map[string]string{AnnDynamicallyProvisioned: "foo.bar/baz"}, nil, nil)
+	client := fake.NewSimpleClientset(class, claim, released, other, boundClaim, bound)
+	var otherGets, boundGets int32
+	client.PrependReactor("get", "persistentvolumes", func(action testclient.Action) (bool, runtime.Object, error) {
+		switch action.(testclient.GetAction).GetName() {
+		case "volume-2":
+			atomic.AddInt32(&otherGets, 1)
+		case "volume-3":
+			atomic.AddInt32(&boundGets, 1)
+		}
+		return false, nil, nil
+	})
+	scheme := metadatafake.NewTestScheme()
+	metav1.AddMetaToScheme(scheme)
+	metadataClient := metadatafake.NewSimpleMetadataClient(scheme, volumeMetadata(released), volumeMetadata(other), volumeMetadata(bound))
+	ctrl := newTestProvisionController(logger, client, "foo.bar/baz", newTestProvisioner(), LeaderElection(false), VolumeMetadataClient(metadataClient))
+	otherResyncs := watchUpdates(t, ctrl.volumeInformer, "volume-2")
+	boundResyncs := watchUpdates(t, ctrl.volumeInformer, "volume-3")
+
+	runTestController(t, ctx, ctrl.ProvisionController)
+
+	err := wait.PollUntilContextTimeout(ctx, 10*time.Millisecond, 5*time.Second, true, func(ctx context.Context) (bool, error) {
+		_, err := client.CoreV1().PersistentVolumes().Get(ctx, "volume-1", metav1.GetOptions{})
+		return apierrs.IsNotFound(err), nil
+	})
+	if err != nil {
+		t.Fatalf("released volume was not deleted")
+	}
+	err = wait.PollUntilContextTimeout(ctx, 10*time.Millisecond, 5*time.Second, true, func(ctx context.Context) (bool, error) {
+		_, err := client.CoreV1().PersistentVolumes().Get(ctx, "pvc-uid-1-1", metav1.GetOptions{})
+		return err == nil, nil
+	})
+	if err != nil {
+		t.Fatalf("volume was not provisioned")
+	}
+	obj, exists, err := ctrl.volumes.GetByKey("pvc-uid-1-1")
+	if err != nil || !exists {
+		t.Fatalf("provisioned volume is not cached: %v", err)
+	}
+	if _, ok := obj.(*metav1.PartialObjectMetadata); !ok {
+		t.Errorf("expected cached volume metadata, got %T", obj)
+	}
+	otherResyncs(ctx, 2)
+	boundResyncs(ctx, 2)
+	if n := atomic.LoadInt32(&otherGets); n != 0 {
+		t.Errorf("expected no GET of volume of other provisioner, got %d", n)
+	}
+	if n := atomic.LoadInt32(&boundGets); n != 0 {
+		t.Errorf("expected no GET of volume of bound claim, got %d", n)
+	}
+	for _, action := range client.Actions() {
+		if action.GetResource().Resource == "persistentvolumes" && (action.GetVerb() == "list" || action.GetVerb() == "watch") {
+			t.Errorf("unexpected %s of full persistentvolumes", action.GetVerb())
+		}
+	}
+	if _, err := ctrl.VolumesLister(); err == nil {
+		t.Errorf("expected error of VolumesLister")
+	}
+}
+
+func TestVolumeMetadataNeedsSync(t *testing.T) {
+	now := metav1.Now()
+	boundClaim := newClaim("claim-1", "uid-1-1", "class-1", "foo.bar/baz", "volume-1", nil)
+	boundClaim.Status.Phase = v1.ClaimBound
+	deletedClaim := boundClaim.DeepCopy()
+	deletedClaim.DeletionTimestamp = &now
+	tests := []struct {
+		name          string
+		options       []func(*ProvisionController) error
+		annotations   map[string]string
+		finalizers    []string
+		deleted       bool
+		claim         *v1.PersistentVolumeClaim
+		expectedFetch bool
+	}{
+		{
+			name:        "other provisioner",
+			annotations: map[string]string{AnnDynamicallyProvisioned: "other.io/x"},
+		},
+		{
+			name:          "no claim",
+			annotations:   map[string]string{AnnDynamicallyProvisioned: "foo.bar/baz"},
+			expectedFetch: true,
+		},
+		{
+			name:          "static volume without claim",
+			expectedFetch: true,
+		},
+		{
+			name:        "bound claim",
+			annotations: map[string]string{AnnDynamicallyProvisioned: "foo.bar/baz"},
+			claim:       boundClaim,
+		},
+		{
+			name:          "bound claim being deleted",
+			annotations:   map[string]string{AnnDynamicallyProvisioned: "foo.bar/baz"},
+			claim:         deletedClaim,
+			expectedFetch: true,
+		},
+		{
+			name:          "bound claim, finalizer to add",
+			options:       []func(*ProvisionController) error{AddFinalizer(true)},
+			annotations:   map[string]string{AnnDynamicallyProvisioned: "foo.bar/baz"},
+			claim:         boundClaim,
+			expectedFetch: true,
+		},
+		{
+			name:        "bound claim with finalizer",
+			options:     []func(*ProvisionController) error{AddFinalizer(true)},
+			annotations: map[string]string{AnnDynamicallyProvisioned: "foo.bar/baz"},
+			finalizers:  []string{finalizerPV},
+			claim:       boundClaim,
+		},
+		{
+			name:          "bound claim, finalizer to remove",
+			annotations:   map[string]string{AnnDynamicallyProvisioned: "foo.bar/baz"},
+			finalizers:    []string{finalizerPV},
+			claim:         boundClaim,
+			expectedFetch: true,
+		},
+		{
+			name:        "deleted without finalizer",
+			annotations: map[string]string{AnnDynamicallyProvisioned: "foo.bar/baz"},
+			deleted:     true,
+		},
+		{
+			name:          "deleted with finalizer",
+			annotations:   map[string]string{AnnDynamicallyProvisioned: "foo.bar/baz"},
+			finalizers:    []string{finalizerPV},
+			deleted:       true,
+			expectedFetch: true,
+		},
+		{
+			name:          "adopted provisioner",
+			options:       []func(*ProvisionController) error{AdoptProvisionerNames([]string{"old.bar/baz"})},
+			annotations:   map[string]string{AnnDynamicallyProvisioned: "old.bar/baz"},
+			claim:         boundClaim,
+			expectedFetch: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			logger, ctx := ktesting.NewTestContext(t)
+			volume := newVolume("volume-1", v1.VolumeBound, v1.PersistentVolumeReclaimDelete, test.annotations, nil, nil)
+			volume.Finalizers = test.finalizers
+			if test.deleted {
+				volume.DeletionTimestamp = &now
+			}
+			client := fake.NewSimpleClientset(volume)
+			metadataClient := metadatafake.NewSimpleMetadataClient(metadatafake.NewTestScheme())
+			options := append([]func(*ProvisionController) error{VolumeMetadataClient(metadataClient)}, test.options...)
+			ctrl := newTestProvisionController(logger, client, "foo.bar/baz", newTestProvisioner(), options...)
+			if test.claim != nil {
+				ctrl.claimInformer.GetIndexer().Add(test.claim)
+			}
+
+			fetched, err := ctrl.fullVolume(ctx, volumeMetadata(volume))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if (fetched != nil) != test.expectedFetch {
+				t.Errorf("expected fetch %v, got %v", test.expectedFetch, fetched != nil)
+			}
+			gets := 0
+			for _, action := range client.Actions() {
+				if action.GetVerb() == "get" && action.GetResource().Resource == "persistentvolumes" {
+					gets++
+				}
+			}
+			if test.expectedFetch != (gets == 1) || gets > 1 {
+				t.Errorf("expected fetch %v, got %d GETs", test.expectedFetch, gets)
+			}
+		})
+	}
+}
+
+func TestVolumeMetadataClientValidation(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	metadataClient := metadatafake.NewSimpleMetadataClient(metadatafake.NewTestScheme())
+	volumeInformer := informers.NewSharedInformerFactory(client, 0).Core().V1().PersistentVolumes().Informer()
+	tests := []struct {
+		name    string
+		options []func(*ProvisionController) error
+	}{
+		{
+			name:    "with VolumesInformer",
+			options: []func(*ProvisionController) error{VolumeMetadataClient(metadataClient), VolumesInformer(volumeInformer)},
+		},
+		{
+			name:    "with DeletionDisabled",
+			options: []func(*ProvisionController) error{VolumeMetadataClient(metadataClient), DeletionDisabled(true)},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctrl := &ProvisionController{hasRunLock: &sync.Mutex{}}
+			for _, option := range test.options {
+				if err := option(ctrl); err != nil {
+					t.Fatalf("unexpected error of option: %v", err)
+				}
+			}
+			if err := ctrl.validateOptions(); err == nil {
+				t.Errorf("expected error, got none")
+			}
+		})
+	}
+}
+
+func TestQueueRateLimiters(t *testing.T) {
+	logger, ctx := ktesting.NewTestContext(t)
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	class := newStorageClass("class-1", "foo.bar/baz")
+	claim := newClaim("claim-1", "uid-1-1", "class-1", "foo.bar/baz", "", nil)
+	released := newVolume("volume-1", v1.VolumeReleased, v1.PersistentVolumeReclaimDelete, map[string]string{AnnDynamicallyProvisioned: "foo.bar/baz"}, nil, nil)
+	client := fake.NewSimpleClientset(class, claim, released)
+	claimLimiter := newCountingRateLimiter()
+	volumeLimiter := newCountingRateLimiter()
+	ctrl := newTestProvisionController(logger, client, "foo.bar/baz", newBadTestProvisioner(), LeaderElection(false),
+		ClaimQueueRateLimiter(claimLimiter), VolumeQueueRateLimiter(volumeLimiter),
+		FailedProvisionThreshold(3), FailedDeleteThreshold(3))
+
+	runTestController(t, ctx, ctrl.ProvisionController)
+
+	err := wait.PollUntilContextTimeout(ctx, 10*time.Millisecond, 5*time.Second, true, func(context.Context) (bool, error) {
+		return claimLimiter.whenCalls("uid-1-1") >= 3 && volumeLimiter.whenCalls("volume-1") >= 3, nil
+	})
+	if err != nil {
+		t.Fatalf("rate limiters were not consulted for requeues: claim %d, volume %d", claimLimiter.whenCalls("uid-1-1"), volumeLimiter.whenCalls("volume-1"))
+	}
+	if n := claimLimiter.whenCalls("volume-1"); n != 0 {
+		t.Errorf("expected volume not to be rate limited by claim limiter, got %d calls", n)
+	}
+	if n := volumeLimiter.whenCalls("uid-1-1"); n != 0 {
+		t.Errorf("expected claim not to be rate limited by volume limiter, got %d calls", n)
+	}
+}
+
+func TestRetryBackoff(t *testing.T) {
+	fakeClock := testingclock.NewFakePassiveClock(time.Unix(1000, 0))
+	m := metrics.New(controllerSubsystem)
+	backoff := newRetryBackoff(func(interface{}) *wait.Backoff {
+		return &wait.Backoff{Duration: time.Second, Factor: 2, Cap: 5 * time.Second}
+	}, workqueue.DefaultControllerRateLimiter(), fakeClock,
+		m.PersistentVolumeClaimProvisionRetryFailures, m.PersistentVolumeClaimProvisionNextRetryTimestampSeconds)
+
+	for i, expected := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second} {
+		delay := backoff.When("uid-1")
+		if delay != expected {
+			t.Errorf("failure %d: expected delay %v, got %v", i+1, expected, delay)
+		}
+		if failures := testutil.ToFloat64(m.PersistentVolumeClaimProvisionRetryFailures.WithLabelValues("uid-1")); failures != float64(i+1) {
+			t.Errorf("failure %d: expected failures metric %d, got %v", i+1, i+1, failures)
+		}
+		expectedRetry := float64(fakeClock.Now().Add(expected).Unix())
+		if nextRetry := testutil.ToFloat64(m.PersistentVolumeClaimProvisionNextRetryTimestampSeconds.WithLabelValues("uid-1")); nextRetry != expectedRetry {
+			t.Errorf("failure %d: expected next retry metric %v, got %v", i+1, expectedRetry, nextRetry)
+		}
+		fakeClock.SetTime(fakeClock.Now().Add(delay))
+	}
+	if n := backoff.NumRequeues("uid-1"); n != 5 {
+		t.Errorf("expected 5 requeues, got %d", n)
+	}
+	if delay := backoff.When("uid-2"); delay != time.Second {
+		t.Errorf("expected independent delay %v of another claim, got %v", time.Second, delay)
+	}
+
+	backoff.Forget("uid-1")
+	if n := backoff.NumRequeues("uid-1"); n != 0 {
+		t.Errorf("expected no requeues after Forget, got %d", n)
+	}
+	if n := testutil.CollectAndCount(m.PersistentVolumeClaimProvisionRetryFailures); n != 1 {
+		t.Errorf("expected failures metric of 1 claim after Forget, got %d", n)
+	}
+	if delay := backoff.When("uid-1"); delay != time.Second {
+		t.Errorf("expected delay %v after Forget, got %v", time.Second, delay)
+	}
+}
+
+func TestProvisionRetryBackoff(t *testing.T) {
+	logger, ctx := ktesting.NewTestContext(t)
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	class := newStorageClass("class-1", "foo.bar/baz")
+	claim := newClaim("claim-1", "uid-1-1", "class-1", "foo.bar/baz", "", nil)
+	client := fake.NewSimpleClientset(class, claim)
+	ctrl := newTestProvisionController(logger, client, "foo.bar/baz", newBadTestProvisioner(), LeaderElection(false),
+		FailedProvisionThreshold(2), ProvisionRetryBackoff(wait.Backoff{Duration: time.Millisecond, Factor: 1}))
+
+	runTestController(t, ctx, ctrl.ProvisionController)
+
+	// Retries don't stop at the threshold.
+	err := wait.PollUntilContextTimeout(ctx, 10*time.Millisecond, 5*time.Second, true, func(context.Context) (bool, error) {
+		return ctrl.claimQueue.NumRequeues("uid-1-1") > 5, nil
+	})
+	if err != nil {
+		t.Fatalf("expected more than 5 retries, got %d", ctrl.claimQueue.NumRequeues("uid-1-1"))
+	}
+}
+
+func TestProvisionRetryBackoffClaimUpdate(t *testing.T) {
+	logger, _ := ktesting.NewTestContext(t)
+	claim := newClaim("claim-1", "uid-1-1", "class-1", "foo.bar/baz", "", nil)
+	ctrl := newTestProvisionController(logger, fake.NewSimpleClientset(), "foo.bar/baz", newTestProvisioner(),
+		ProvisionRetryBackoff(wait.Backoff{Duration: time.Second, Factor: 2}))
+	ctrl.claimRetryBackoff.When("uid-1-1")
+	ctrl.claimRetryBackoff.When("uid-1-1")
+
+	updated := claim.DeepCopy()
+	metav1.SetMetaDataAnnotation(&updated.ObjectMeta, ctrl.annProvisionFailures, "2")
+	metav1.SetMetaDataAnnotation(&updated.ObjectMeta, ctrl.annLastError, "fake error")
+	ctrl.resetClaimFailures(claim, updated)
+	if n := ctrl.claimRetryBackoff.NumRequeues("uid-1-1"); n != 2 {
+		t.Errorf("expected update of give up annotations to keep 2 failures, got %d", n)
+	}
+	updated.Spec.Resources.Requests[v1.ResourceStorage] = resource.MustParse("2Gi")
+	ctrl.resetClaimFailures(claim, updated)
+	if n := ctrl.claimRetryBackoff.NumRequeues("uid-1-1"); n != 0 {
+		t.Errorf("expected update of spec to reset the backoff, got %d failures", n)
+	}
+	if delay := ctrl.claimRetryBackoff.When("uid-1-1"); delay != time.Second {
+		t.Errorf("expected delay %v after reset, got %v", time.Second, delay)
+	}
+
+	updated = claim.DeepCopy()
+	metav1.SetMetaDataAnnotation(&updated.ObjectMeta, "foo", "bar")
+	ctrl.resetClaimFailures(claim, updated)
+	if n := ctrl.claimRetryBackoff.NumRequeues("uid-1-1"); n != 0 {
+		t.Errorf("expected update of annotations to reset the backoff, got %d failures", n)
+	}
+}
+
+func TestProvisionRetryBackoffValidation(t *testing.T) {
+	for _, backoff := range []wait.Backoff{{Duration: 0, Factor: 2}, {Duration: time.Second, Factor: 0.5}, {Duration: time.Second, Factor: 2, Cap: -time.Second}} {
+		ctrl := &ProvisionController{hasRunLock: &sync.Mutex{}}
+		if err := ProvisionRetryBackoff(backoff)(ctrl); err == nil {
+			t.Errorf("expected error for backoff %+v, got none", backoff)
+		}
+	}
+	ctrl := &ProvisionController{hasRunLock: &sync.Mutex{}}
+	for _, option := range []func(*ProvisionController) error{
+		ProvisionRetryBackoff(wait.Backoff{Duration: time.Second, Factor: 2}),
+		ClaimQueueRateLimiter(workqueue.DefaultControllerRateLimiter()),
+	} {
+		if err := option(ctrl); err != nil {
+			t.Fatalf("unexpected error of option: %v", err)
+		}
+	}
+	if err := ctrl.validateOptions(); err == nil {
+		t.Errorf("expected error, got none")
+	}
+}
+
+func TestProvisionRetryBackoffDefaultCap(t *testing.T) {
+	backoff := wait.Backoff{Duration: 5 * time.Second, Factor: 2, Jitter: 0.5}
+	for _, failures := range []int{0, 10, 40, 100, 10000} {
+		if delay := backoffDelay(backoff, failures); delay <= 0 || delay > defaultRetryBackoffCap {
+			t.Errorf("expected delay after %d failures in (0, %v], got %v", failures, defaultRetryBackoffCap, delay)
+		}
+	}
+
+	ctrl := &ProvisionController{hasRunLock: &sync.Mutex{}}
+	slow := wait.Backoff{Duration: time.Hour, Factor: 2}
+	overrides := map[string]ClassPolicy{"slow": {ProvisionRetryBackoff: &slow}}
+	for _, option := range []func(*ProvisionController) error{
+		ProvisionRetryBackoff(backoff),
+		ClassOverrides(overrides),
+	} {
+		if err := option(ctrl); err != nil {
+			t.Fatalf("unexpected error of option: %v", err)
+		}
+	}
+	if ctrl.provisionRetryBackoff.Cap != defaultRetryBackoffCap {
+		t.Errorf("expected cap %v, got %v", defaultRetryBackoffCap, ctrl.provisionRetryBackoff.Cap)
+	}
+	if got := ctrl.classOverrides["slow"].ProvisionRetryBackoff.Cap; got != time.Hour {
+		t.Errorf("expected cap of class slow %v, got %v", time.Hour, got)
+	}
+	if slow.Cap != 0 {
+		t.Errorf("expected backoff of overrides to be unchanged, got cap %v", slow.Cap)
+	}
+}
+
+func TestClassOverrides(t *testing.T) {
+	logger, ctx := ktesting.NewTestContext(t)
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	fast := newStorageClass("fast", "foo.bar/baz")
+	slow := newStorageClass("slow", "foo.bar/baz")
+	fastClaim := newClaim("claim-1", "uid-1-1", "fast", "foo.bar/baz", "", nil)
+	slowClaim := newClaim("claim-2", "uid-1-2", "slow", "foo.bar/baz", "", nil)
+	fastVolume := newVolume("volume-1", v1.VolumeReleased, v1.PersistentVolumeReclaimDelete, map[string]string{AnnDynamicallyProvisioned: "foo.bar/baz"}, nil, nil)
+	fastVolume.Spec.StorageClassName = "fast"
+	client := fake.NewSimpleClientset(fast, slow, fastClaim, slowClaim, fastVolume)
+	ctrl := newTestProvisionController(logger, client, "foo.bar/baz", newBadTestProvisioner(), LeaderElection(false),
+		RateLimiter(workqueue.NewItemExponentialFailureRateLimiter(time.Millisecond, time.Millisecond)),
+		FailedProvisionThreshold(10), FailedDeleteThreshold(10),
+		ClassOverrides(map[string]ClassPolicy{
+			"fast": {FailedProvisionThreshold: 2, FailedDeleteThreshold: 3},
+			"slow": {FailedProvisionThreshold: 5},
+		}))
+	fastResyncs := watchUpdates(t, ctrl.claimInformer, "claim-1")
+	slowResyncs := watchUpdates(t, ctrl.claimInformer, "claim-2")
+	volumeResyncs := watchUpdates(t, ctrl.volumeInformer, "volume-1")
+
+	runTestController(t, ctx, ctrl.ProvisionController)
+
+	err := wait.PollUntilContextTimeout(ctx, 10*time.Millisecond, 5*time.Second, true, func(context.Context) (bool, error) {
+		return ctrl.claimQueue.NumRequeues("uid-1-1") >= 2 && ctrl.claimQueue.NumRequeues("uid-1-2") >= 5 && ctrl.volumeQueue.NumRequeues("volume-1") >= 3, nil
+	})
+	if err != nil {
+		t.Fatalf("claims and volume were not retried")
+	}
+	// Resyncs give the claims and the volume another try, but don't retry them.
+	fastResyncs(ctx, 2)
+	slowResyncs(ctx, 2)
+	volumeResyncs(ctx, 2)
+	for key, expected := range map[string]int{"uid-1-1": 2, "uid-1-2": 5} {
+		if n := ctrl.claimQueue.NumRequeues(key); n != expected {
+			t.Errorf("expected %d retries of claim %s, got %d", expected, key, n)
+		}
+	}
+	if n := ctrl.volumeQueue.NumRequeues("volume-1"); n != 3 {
+		t.Errorf("expected 3 retries of volume, got %d", n)
+	}
+}
+
+func TestClassOverridesClassChange(t *testing.T) {
+	logger, _ := ktesting.NewTestContext(t)
+	ctrl := newTestProvisionController(logger, fake.NewSimpleClientset(), "foo.bar/baz", newTestProvisioner(),
+		FailedProvisionThreshold(10),
+		ClassOverrides(map[string]ClassPolicy{
+			"fast": {FailedProvisionThreshold: 2},
+			"slow": {ProvisionRetryBackoff: &wait.Backoff{Duration: time.Second, Factor: 2}},
+		}))
+	claim := newClaim("claim-1", "uid-1-1", "fast", "foo.bar/baz", "", nil)
+	if err := ctrl.claimsIndexer.Add(claim); err != nil {
+		t.Fatal(err)
+	}
+	if policy := ctrl.claimPolicy("uid-1-1"); policy.FailedProvisionThreshold != 2 || policy.ProvisionRetryBackoff != nil {
+		t.Errorf("expected policy of class fast, got %+v", policy)
+	}
+
+	claim = claim.DeepCopy()
+	slowClass := "slow"
+	claim.Spec.StorageClassName = &slowClass
+	if err := ctrl.claimsIndexer.Update(claim); err != nil {
+		t.Fatal(err)
+	}
+	if policy := ctrl.claimPolicy("uid-1-1"); policy.ProvisionRetryBackoff == nil {
+		t.Errorf("expected policy of class slow, got %+v", policy)
+	}
+	if delay := ctrl.claimRetryBackoff.When("uid-1-1"); delay != time.Second {
+		t.Errorf("expected backoff delay %v, got %v", time.Second, delay)
+	}
+
+	claim = claim.DeepCopy()
+	otherClass := "other"
+	claim.Spec.StorageClassName = &otherClass
+	if err := ctrl.claimsIndexer.Update(claim); err != nil {
+		t.Fatal(err)
+	}
+	if policy := ctrl.claimPolicy("uid-1-1"); policy.FailedProvisionThreshold != 10 || policy.ProvisionRetryBackoff != nil {
+		t.Errorf("expected global policy, got %+v", policy)
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	tests := []struct {
+		name           string
+		volume         bool
+		retryAfter     time.Duration
+		expectedDelay  time.Duration
+		expectedMetric float64
+	}{
+		{
+			name:           "claim with retry after",
+			retryAfter:     30 * time.Second,
+			expectedDelay:  30 * time.Second,
+			expectedMetric: 1,
+		},
+		{
+			name:          "claim with zero retry after",
+			expectedDelay: 10 * time.Second,
+		},
+		{
+			name:          "claim with negative retry after",
+			retryAfter:    -time.Second,
+			expectedDelay: 10 * time.Second,
+		},
+		{
+			name:           "volume with retry after",
+			volume:         true,
+			retryAfter:     30 * time.Second,
+			expectedDelay:  30 * time.Second,
+			expectedMetric: 1,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			logger, ctx := ktesting.NewTestContext(t)
+			class := newStorageClass("class-1", "foo.bar/baz")
+			claim := newClaim("claim-1", "uid-1-1", "class-1", "foo.bar/baz", "", nil)
+			volume := newVolume("volume-1", v1.VolumeReleased, v1.PersistentVolumeReclaimDelete, map[string]string{AnnDynamicallyProvisioned: "foo.bar/baz"}, nil, nil)
+			client := fake.NewSimpleClientset(class, claim, volume)
+			fakeClock := testingclock.NewFakeClock(time.Now())
+			ctrl := newTestProvisionController(logger, client, "foo.bar/baz", &retryAfterProvisioner{retryAfter: test.retryAfter},
+				RateLimiter(workqueue.NewItemExponentialFailureRateLimiter(10*time.Second, 10*time.Second)),
+				FailedProvisionThreshold(0), FailedDeleteThreshold(0), WithClock(fakeClock))
+			queueName, key := "claims", "uid-1-1"
+			var queue workqueue.RateLimitingInterface
+			if test.volume {
+				queueName, key = "volumes", "volume-1"
+				queue = ctrl.volumeQueue
+				if err := ctrl.volumes.Add(volume); err != nil {
+					t.Fatal(err)
+				}
+			} else {
+				queue = ctrl.claimQueue
+				if err := ctrl.claimsIndexer.Add(claim); err != nil {
+					t.Fatal(err)
+				}
+			}
+			defer queue.ShutDown()
+
+			queue.Add(key)
+			if test.volume {
+				ctrl.processNextVolumeWorkItem(ctx)
+			} else {
+				ctrl.processNextClaimWorkItem(ctx)
+			}
+			if n := queue.NumRequeues(key); n != 1 {
+				t.Errorf("expected the failure to be counted, got %d requeues", n)
+			}
+
+			// A sentinel due just before the item shows that the queue
+			// saw the step, items become ready in the order they are due.
+			queue.AddAfter("sentinel", test.expectedDelay-time.Millisecond)
+			fakeClock.Step(test.expectedDelay - time.Millisecond)
+			err := wait.PollUntilContextTimeout(ctx, 10*time.Millisecond, 5*time.Second, true, func(context.Context) (bool, error) {
+				return queue.Len() > 0, nil
+			})
+			if err != nil {
+				t.Fatalf("expected sentinel after %v", test.expectedDelay-time.Millisecond)
+			}
+			if item, _ := queue.Get(); item != "sentinel" || queue.Len() != 0 {
+				t.Errorf("expected no item before %v, got %v", test.expectedDelay, item)
+			} else {
+				queue.Done(item)
+			}
+			fakeClock.Step(time.Millisecond)
+			err = wait.PollUntilContextTimeout(ctx, 10*time.Millisecond, 5*time.Second, true, func(context.Context) (bool, error) {
+				return queue.Len() == 1, nil
+			})
+			if err != nil {
+				t.Errorf("expected item after %v", test.expectedDelay)
+			}
+			if n := testutil.ToFloat64(ctrl.metrics.RetryAfterRequeuesTotal.WithLabelValues(queueName)); n != test.expectedMetric {
+				t.Errorf("expected %v retry after requeues, got %v", test.expectedMetric, n)
+			}
+		})
+	}
+}
+
+func TestGiveUp(t *testing.T) {
+	logger, ctx := ktesting.NewTestContext(t)
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	class := newStorageClass("class-1", "foo.bar/baz")
+	// The fake client doesn't set resource versions, class resyncs are
+	// told from updates by them.
+	class.ResourceVersion = "1"
+	claim := newClaim("claim-1", "uid-1-1", "class-1", "foo.bar/baz", "", nil)
+	client := fake.NewSimpleClientset(class, claim)
+	recorder := record.NewFakeRecorder(100)
+	prov := &failingProvisioner{testProvisioner: newTestProvisioner()}
+	prov.failing.Store(true)
+	ctrl := newTestProvisionController(logger, client, "foo.bar/baz", prov, LeaderElection(false), WithEventRecorder(recorder),
+		RateLimiter(workqueue.NewItemExponentialFailureRateLimiter(time.Millisecond, time.Millisecond)),
+		FailedProvisionThreshold(2), ClaimResyncPeriod(time.Hour))
+	if ctrl.annProvisionFailures != "foo.bar-baz/provision-failures" {
+		t.Errorf("unexpected annotation %q", ctrl.annProvisionFailures)
+	}
+
+	runTestController(t, ctx, ctrl.ProvisionController)
+
+	err := wait.PollUntilContextTimeout(ctx, 10*time.Millisecond, 5*time.Second, true, func(ctx context.Context) (bool, error) {
+		claim, err := client.CoreV1().PersistentVolumeClaims(claim.Namespace).Get(ctx, claim.Name, metav1.GetOptions{})
+		return err == nil && claim.Annotations[ctrl.annProvisionFailures] == "2", nil
+	})
+	if err != nil {
+		t.Fatalf("giving up was not recorded on the claim")
+	}
+	updated, err := client.CoreV1().PersistentVolumeClaims(claim.Namespace).Get(ctx, claim.Name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lastError := updated.Annotations[ctrl.annLastError]; !strings.Contains(lastError, "backend down") {
+		t.Errorf("expected last error annotation with the provisioner error, got %q", lastError)
+	}
+	var stopped int
+	for len(recorder.Events) > 0 {
+		if event := <-recorder.Events; strings.HasPrefix(event, v1.EventTypeWarning+" ProvisioningStopped ") {
+			stopped++
+		}
+	}
+	if stopped != 1 {
+		t.Errorf("expected 1 ProvisioningStopped event, got %d", stopped)
+	}
+
+	// Fixing the class restarts provisioning without waiting for resync.
+	prov.failing.Store(false)
+	class = class.DeepCopy()
+	class.Parameters = map[string]string{"fixed": "true"}
+	class.ResourceVersion = "2"
+	if _, err := client.StorageV1().StorageClasses().Update(ctx, class, metav1.UpdateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	err = wait.PollUntilContextTimeout(ctx, 10*time.Millisecond, 5*time.Second, true, func(ctx context.Context) (bool, error) {
+		_, err := client.CoreV1().PersistentVolumes().Get(ctx, "pvc-uid-1-1", metav1.GetOptions{})
+		return err == nil, nil
+	})
+	if err != nil {
+		t.Fatalf("volume was not provisioned after class update")
+	}
+	err = wait.PollUntilContextTimeout(ctx, 10*time.Millisecond, 5*time.Second, true, func(ctx context.Context) (bool, error) {
+		claim, err := client.CoreV1().PersistentVolumeClaims(claim.Namespace).Get(ctx, claim.Name, metav1.GetOptions{})
+		if err != nil {
+			return false, nil
+		}
+		_, hasFailures := claim.Annotations[ctrl.annProvisionFailures]
+		_, hasError := claim.Annotations[ctrl.annLastError]
+		return !hasFailures && !hasError, nil
+	})
+	if err != nil {
+		t.Errorf("give up annotations were not cleared")
+	}
+}
+
+func TestGiveUpAnnotationPrefix(t *testing.T) {
+	for name, expected := range map[string]string{
+		"foo.bar/baz":     "foo.bar-baz",
+		"Example.COM/nfs": "example.com-nfs",
+		"/odd_name/":      "odd-name",
+	} {
+		if prefix := giveUpAnnotationPrefix(name); prefix != expected {
+			t.Errorf("%q: expected prefix %q, got %q", name, expected, prefix)
+		}
+	}
+}
+
+func TestSelectedNodeRequeue(t *testing.T) {
+	logger, ctx := ktesting.NewTestContext(t)
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	class := newStorageClassWithVolumeBindingMode("class-1", "foo.bar/baz", &modeWait)
+	claim := newClaim("claim-1", "uid-1-1", "class-1", "foo.bar/baz", "", map[string]string{AnnSelectedNode: "node-1"})
+	client := fake.NewSimpleClientset(class, claim, newNode("node-1"), newNode("node-2"))
+	prov := &failingProvisioner{testProvisioner: newTestProvisioner()}
+	prov.failing.Store(true)
+	// After the first failure the claim would be retried in an hour.
+	ctrl := newTestProvisionController(logger, client, "foo.bar/baz", prov, LeaderElection(false),
+		ProvisionRetryBackoff(wait.Backoff{Duration: time.Hour, Factor: 1}), ClaimResyncPeriod(time.Hour))
+
+	runTestController(t, ctx, ctrl.ProvisionController)
+
+	err := wait.PollUntilContextTimeout(ctx, 10*time.Millisecond, 5*time.Second, true, func(context.Context) (bool, error) {
+		return ctrl.claimQueue.NumRequeues("uid-1-1") > 0, nil
+	})
+	if err != nil {
+		t.Fatalf("provisioning did not fail")
+	}
+	prov.failing.Store(false)
+	updated := claim.DeepCopy()
+	updated.Annotations[AnnSelectedNode] = "node-2"
+	if _, err := client.CoreV1().PersistentVolumeClaims(claim.Namespace).Update(ctx, updated, metav1.UpdateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case call := <-prov.provisionCalls:
+		if node := call.selectedNode; node == nil || node.Name != "node-2" {
+			t.Errorf("expected provisioning on node-2, got %v", node)
+		}
+	case <-time.After(resyncPeriod):
+		t.Fatalf("expected Provision call within %v of the selected node change", resyncPeriod)
+	}
+}
+
+func TestThreadiness(t *testing.T) {
+	logger, ctx := ktesting.NewTestContext(t)
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	objs := []runtime.Object{newStorageClass("class-1", "foo.bar/baz")}
+	for i := 0; i < 6; i++ {
+		objs = append(objs,
+			newClaim(fmt.Sprintf("claim-%d", i), fmt.Sprintf("uid-%d", i), "class-1", "foo.bar/baz", "", nil),
+			newVolume(fmt.Sprintf("volume-%d", i), v1.VolumeReleased, v1.PersistentVolumeReclaimDelete, map[string]string{AnnDynamicallyProvisioned: "foo.bar/baz"}, nil, nil))
+	}
+	client := fake.NewSimpleClientset(objs...)
+	prov := &blockingProvisioner{release: make(chan struct{})}
+	ctrl := newTestProvisionController(logger, client, "foo.bar/baz", prov, LeaderElection(false),
+		Threadiness(1), ProvisionThreadiness(2), DeletionThreadiness(4))
+
+	done := make(chan struct{})
+	go func() {
+		ctrl.Run(ctx)
+		close(done)
+	}()
+
+	inFlight := func() (float64, float64) {
+		return testutil.ToFloat64(ctrl.metrics.PersistentVolumeClaimProvisionInFlight), testutil.ToFloat64(ctrl.metrics.PersistentVolumeDeleteInFlight)
+	}
+	err := wait.PollUntilContextTimeout(ctx, 10*time.Millisecond, 5*time.Second, true, func(context.Context) (bool, error) {
+		provisions, deletions := inFlight()
+		return provisions == 2 && deletions == 4, nil
+	})
+	if err != nil {
+		provisions, deletions := inFlight()
+		t.Fatalf("expected 2 provisions and 4 deletions in flight, got %v and %v", provisions, deletions)
+	}
+	// All workers are blocked, resyncs cannot start more calls.
+	if provisions, deletions := inFlight(); provisions != 2 || deletions != 4 {
+		t.Errorf("expected 2 provisions and 4 deletions in flight, got %v and %v", provisions, deletions)
+	}
+
+	// Run waits for the workers of both queues.
+	cancel()
+	select {
+	case <-done:
+		t.Fatalf("Run returned with calls in progress")
+	case <-time.After(3 * resyncPeriod):
+	}
+	close(prov.release)
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Run did not return after calls finished")
+	}
+}
+
+func TestStorageClassAPIFallback(t *testing.T) {
+	logger, ctx := ktesting.NewTestContext(t)
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	betaClass := &storagebeta.StorageClass{
+		ObjectMeta:    metav1.ObjectMeta{Name: "class-1"},
+		Provisioner:   "foo.bar/baz",
+		ReclaimPolicy: ptr.To(v1.PersistentVolumeReclaimDelete),
+	}
+	claim := newClaim("claim-1", "uid-1-1", "class-1", "foo.bar/baz", "", nil)
+	client := fake.NewSimpleClientset(betaClass, claim)
+	var v1Available atomic.Bool
+	client.PrependReactor("list", "storageclasses", func(action testclient.Action) (bool, runtime.Object, error) {
+		if action.GetResource().Version == "v1" && !v1Available.Load() {
+			return true, nil, apierrs.NewNotFound(storage.Resource("storageclasses"), "")
+		}
+		return false, nil, nil
+	})
+	ctrl := newTestProvisionController(logger, client, "foo.bar/baz", newTestProvisioner(), LeaderElection(false), StorageClassAPIFallback(true))
+	ctrl.classAPICheckInterval = 100 * time.Millisecond
+	runTestController(t, ctx, ctrl.ProvisionController)
+
+	err := wait.PollUntilContextTimeout(ctx, 10*time.Millisecond, 5*time.Second, true, func(ctx context.Context) (bool, error) {
+		_, err := client.CoreV1().PersistentVolumes().Get(ctx, "pvc-uid-1-1", metav1.GetOptions{})
+		return err == nil, nil
+	})
+	if err != nil {
+		t.Fatalf("expected claim to be provisioned without class cache: %v", err)
+	}
+	if _, err := ctrl.ClassesLister(); err == nil {
+		t.Errorf("expected ClassesLister to fail without class cache")
+	}
+
+	// The cluster got the v1 API.
+	if _, err := client.StorageV1().StorageClasses().Create(ctx, newStorageClass("class-1", "foo.bar/baz"), metav1.CreateOptions{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	v1Available.Store(true)
+	err = wait.PollUntilContextTimeout(ctx, 10*time.Millisecond, 5*time.Second, true, func(context.Context) (bool, error) {
+		lister, err := ctrl.ClassesLister()
+		if err != nil {
+			return false, nil
+		}
+		_, err = lister.Get("class-1")
+		return err == nil, nil
+	})
+	if err != nil {
+		t.Fatalf("expected class cache after the API became available: %v", err)
+	}
+}
+
+func TestThreadinessValidation(t *testing.T) {
+	for _, option := range []func(*ProvisionController) error{Threadiness(0), ProvisionThreadiness(0), DeletionThreadiness(-1)} {
+		ctrl := &ProvisionController{hasRunLock: &sync.Mutex{}}
+		if err := option(ctrl); err == nil {
+			t.Errorf("expected error, got none")
+		}
+	}
+}
+
+func TestMaxInFlightOperations(t *testing.T) {
+	logger, ctx := ktesting.NewTestContext(t)
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	objs := []runtime.Object{newStorageClass("class-1", "foo.bar/baz")}
+	for i := 0; i < 8; i++ {
+		objs = append(objs,
+			newClaim(fmt.Sprintf("claim-%d", i), fmt.Sprintf("uid-%d", i), "class-1", "foo.bar/baz", "", nil),
+			newVolume(fmt.Sprintf("volume-%d", i), v1.VolumeReleased, v1.PersistentVolumeReclaimDelete, map[string]string{AnnDynamicallyProvisioned: "foo.bar/baz"}, nil, nil))
+	}
+	client := fake.NewSimpleClientset(objs...)
+	prov := newConcurrencyProvisioner(3)
+	ctrl := newTestProvisionController(logger, client, "foo.bar/baz", prov, LeaderElection(false),
+		Threadiness(4), MaxInFlightOperations(3))
+	ctrl.inFlightRetryDelay = 10 * time.Millisecond
+	runTestController(t, ctx, ctrl.ProvisionController)
+
+	err := wait.PollUntilContextTimeout(ctx, 10*time.Millisecond, 10*time.Second, true, func(context.Context) (bool, error) {
+		return prov.provisions.Load() == 8 && prov.deletions.Load() == 8, nil
+	})
+	if err != nil {
+		t.Fatalf("expected 8 provisions and 8 deletions, got %d and %d", prov.provisions.Load(), prov.deletions.Load())
+	}
+	if max := prov.maxInFlight.Load(); max != 3 {
+		t.Errorf("expected 3 calls in flight, got %d", max)
+	}
+	if gauge := testutil.ToFloat64(ctrl.metrics.InFlightOperations); gauge != 0 {
+		t.Errorf("expected no operations in flight, got %v", gauge)
+	}
+	// Postponed calls are not failures.
+	failures := testutil.CollectAndCount(ctrl.metrics.PersistentVolumeClaimProvisionFailedTotal) + testutil.CollectAndCount(ctrl.metrics.PersistentVolumeDeleteFailedTotal)
+	if failures != 0 {
+		t.Errorf("expected no failures, got %d", failures)
+	}
+}
+
+func TestInFlightLimiterLog(t *testing.T) {
+	logger, _ := ktesting.NewTestContext(t)
+	now := time.Now()
+	limiter := newInFlightLimiter(1, prometheus.NewGauge(prometheus.GaugeOpts{Name: "test"}))
+	limiter.now = func() time.Time { return now }
+
+	if !limiter.tryAcquire(logger) {
+		t.Fatalf("expected first call to get a slot")
+	}
+	start := now
+	for i := 0; i < 90; i++ {
+		if limiter.tryAcquire(logger) {
+			t.Fatalf("expected call to be rejected")
+		}
+		now = now.Add(time.Second)
+	}
+	if expected := start.Add(inFlightLimitLogInterval); !limiter.lastLog.Equal(expected) {
+		t.Errorf("expected log at %v, got %v", expected, limiter.lastLog)
+	}
+
+	// A long pause without rejections starts a new period.
+	now = now.Add(2 * inFlightLimitLogInterval)
+	limiter.tryAcquire(logger)
+	if !limiter.limitedSince.Equal(now) {
+		t.Errorf("expected new period at %v, got %v", now, limiter.limitedSince)
+	}
+	limiter.release()
+	if !limiter.tryAcquire(logger) {
+		t.Errorf("expected released slot to be available")
+	}
+}
+
+func TestMaxInFlightOperationsValidation(t *testing.T) {
+	ctrl := &ProvisionController{hasRunLock: &sync.Mutex{}}
+	if err := MaxInFlightOperations(-1)(ctrl); err == nil {
+		t.Errorf("expected error, got none")
+	}
+}
+
+func TestPerNodeProvisionConcurrency(t *testing.T) {
+	logger, ctx := ktesting.NewTestContext(t)
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	mode := storage.VolumeBindingWaitForFirstConsumer
+	objs := []runtime.Object{
+		newStorageClassWithVolumeBindingMode("class-1", "foo.bar/baz", &mode),
+		newNode("node-1"),
+		newNode("node-2"),
+	}
+	for i := 0; i < 6; i++ {
+		node := fmt.Sprintf("node-%d", i%2+1)
+		objs = append(objs, newClaim(fmt.Sprintf("claim-%d", i), fmt.Sprintf("uid-%d", i), "class-1", "foo.bar/baz", "", map[string]string{AnnSelectedNode: node}))
+	}
+	client := fake.NewSimpleClientset(objs...)
+	prov := &nodeConcurrencyProvisioner{nodes: map[string]*concurrencyProvisioner{
+		"node-1": newConcurrencyProvisioner(2),
+		"node-2": newConcurrencyProvisioner(2),
+	}}
+	ctrl := newTestProvisionController(logger, client, "foo.bar/baz", prov, LeaderElection(false),
+		Threadiness(6), PerNodeProvisionConcurrency(2))
+	ctrl.inFlightRetryDelay = 10 * time.Millisecond
+	runTestController(t, ctx, ctrl.ProvisionController)
+
+	err := wait.PollUntilContextTimeout(ctx, 10*time.Millisecond, 10*time.Second, true, func(context.Context) (bool, error) {
+		return prov.nodes["node-1"].provisions.Load()+prov.nodes["node-2"].provisions.Load() == 6, nil
+	})
+	if err != nil {
+		t.Fatalf("expected 6 provisions, got %d and %d", prov.nodes["node-1"].provisions.Load(), prov.nodes["node-2"].provisions.Load())
+	}
+	for name, node := range prov.nodes {
+		if provisions := node.provisions.Load(); provisions != 3 {
+			t.Errorf("expected 3 provisions on %s, got %d", name, provisions)
+		}
+		if max := node.maxInFlight.Load(); max != 2 {
+			t.Errorf("expected 2 calls in flight on %s, got %d", name, max)
+		}
+	}
+	// Only nodes with calls in progress are reported.
+	if series := testutil.CollectAndCount(ctrl.metrics.PersistentVolumeClaimProvisionInFlightPerNode); series != 0 {
+		t.Errorf("expected no nodes with calls in flight, got %d", series)
+	}
+	if failures := testutil.CollectAndCount(ctrl.metrics.PersistentVolumeClaimProvisionFailedTotal); failures != 0 {
+		t.Errorf("expected no failures, got %d", failures)
+	}
+}
+
+func TestNodeInFlightLimiter(t *testing.T) {
+	gauge := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "test"}, []string{"node"})
+	limiter := newNodeInFlightLimiter(1, gauge)
+
+	if !limiter.tryAcquire("node-1") {
+		t.Fatalf("expected first call on node-1 to get a slot")
+	}
+	if limiter.tryAcquire("node-1") {
+		t.Errorf("expected second call on node-1 to be rejected")
+	}
+	if !limiter.tryAcquire("node-2") {
+		t.Errorf("expected call on node-2 to get a slot")
+	}
+	if !limiter.tryAcquire("") {
+		t.Errorf("expected call without node to be unlimited")
+	}
+	if value := testutil.ToFloat64(gauge.WithLabelValues("node-1")); value != 1 {
+		t.Errorf("expected 1 call in flight on node-1, got %v", value)
+	}
+	limiter.release("node-1")
+	limiter.release("node-2")
+	limiter.release("")
+	if series := testutil.CollectAndCount(gauge); series != 0 {
+		t.Errorf("expected released nodes to be removed from the gauge, got %d series", series)
+	}
+	if !limiter.tryAcquire("node-1") {
+		t.Errorf("expected released slot to be available")
+	}
+
+	var unlimited *nodeInFlightLimiter
+	if !unlimited.tryAcquire("node-1") || !unlimited.tryAcquire("node-1") {
+		t.Errorf("expected nil limiter to be unlimited")
+	}
+}
+
+func TestPerNodeProvisionConcurrencyValidation(t *testing.T) {
+	ctrl := &ProvisionController{hasRunLock: &sync.Mutex{}}
+	if err := PerNodeProvisionConcurrency(-1)(ctrl); err == nil {
+		t.Errorf("expected error, got none")
+	}
+}
+
+func TestInitialSyncBurstLimit(t *testing.T) {
+	logger, ctx := ktesting.NewTestContext(t)
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	objs := []runtime.Object{newStorageClass("class-1", "foo.bar/baz")}
+	for i := 0; i < 1000; i++ {
+		objs = append(objs, newClaim(fmt.Sprintf("claim-%d", i), fmt.Sprintf("uid-%d", i), "class-1", "foo.bar/baz", "", nil))
+	}
+	client := fake.NewSimpleClientset(objs...)
+	fakeClock := testingclock.NewFakeClock(time.Now())
+	ctrl := newTestProvisionController(logger, client, "foo.bar/baz", newTestProvisioner(), InitialSyncBurstLimit(100), WithClock(fakeClock))
+	defer ctrl.claimQueue.ShutDown()
+
+	resyncs := watchUpdates(t, ctrl.claimInformer, "claim-999")
+	// Only the informer runs, nothing takes claims from the queue.
+	go ctrl.claimInformer.Run(ctx.Done())
+	if !cache.WaitForCacheSync(ctx.Done(), ctrl.claimInformer.HasSynced) {
+		t.Fatalf("claim informer did not sync")
+	}
+
+	var expectedResyncs int32
+	expectQueued := func(expected int) {
+		t.Helper()
+		err := wait.PollUntilContextTimeout(ctx, 10*time.Millisecond, 5*time.Second, true, func(context.Context) (bool, error) {
+			return ctrl.claimQueue.Len() >= expected, nil
+		})
+		// Resyncs must not enqueue claims before their slots. Wait for
+		// two resyncs the first time and one more each time after, see
+		// watchUpdates.
+		if expectedResyncs == 0 {
+			expectedResyncs++
+		}
+		expectedResyncs++
+		resyncs(ctx, expectedResyncs)
+		if queued := ctrl.claimQueue.Len(); err != nil || queued != expected {
+			t.Errorf("expected %d claims in the queue, got %d", expected, queued)
+		}
+	}
+	// Slots are 10ms apart, the first one is now.
+	expectQueued(1)
+	fakeClock.Step(time.Second)
+	expectQueued(101)
+	fakeClock.Step(4 * time.Second)
+	expectQueued(501)
+
+	// Claims created later are not limited.
+	if _, err := client.CoreV1().PersistentVolumeClaims("default").Create(ctx, newClaim("claim-new", "uid-new", "class-1", "foo.bar/baz", "", nil), metav1.CreateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	expectQueued(502)
+
+	fakeClock.Step(5 * time.Second)
+	expectQueued(1001)
+}
+
+func TestInitialSyncBurstLimitStart(t *testing.T) {
+	now := time.Now()
+	limiter := newInitialSyncLimiter(2, testingclock.NewFakePassiveClock(now))
+	limiter.startAt(now.Add(time.Minute))
+	for i, expected := range []time.Duration{time.Minute, time.Minute + 500*time.Millisecond, time.Minute + time.Second} {
+		if delay := limiter.reserve(strconv.Itoa(i)); delay != expected {
+			t.Errorf("expected delay %v of claim %d, got %v", expected, i, delay)
+		}
+	}
+	if !limiter.waiting("1") {
+		t.Errorf("expected claim 1 to wait for its slot")
+	}
+	limiter.forget("1")
+	if limiter.waiting("1") {
+		t.Errorf("expected forgotten claim 1 not to wait")
+	}
+}
+
+func TestStartupSmoothingValidation(t *testing.T) {
+	for _, option := range []func(*ProvisionController) error{InitialSyncBurstLimit(-1), StartupJitter(-time.Second)} {
+		ctrl := &ProvisionController{hasRunLock: &sync.Mutex{}}
+		if err := option(ctrl); err == nil {
+			t.Errorf("expected error, got none")
+		}
+	}
+}
+
+func TestShutdownGracePeriod(t *testing.T) {
+	tests := []struct {
+		name          string
+		release       bool
+		expectedError bool
+	}{
+		{
+			name:    "provision finishes within grace period",
+			release: true,
+		},
+		{
+			name:          "provision exceeds grace period",
+			expectedError: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			logger, ctx := ktesting.NewTestContext(t)
+			ctx, cancel := context.WithCancel(ctx)
+			defer cancel()
+			client := fake.NewSimpleClientset(newStorageClass("class-1", "foo.bar/baz"), newClaim("claim-1", "uid-1-1", "class-1", "foo.bar/baz", "", nil))
+			prov := &drainingProvisioner{
+				started:   make(chan struct{}, 1),
+				release:   make(chan struct{}),
+				cancelled: make(chan error, 1),
+			}
+			ctrl := newTestProvisionController(logger, client, "foo.bar/baz", prov, LeaderElection(false), ShutdownGracePeriod(time.Second))
+
+			runErr := make(chan error)
+			go func() { runErr <- ctrl.Run(ctx) }()
+			select {
+			case <-prov.started:
+			case <-time.After(5 * time.Second):
+				t.Fatalf("Provision was not called")
+			}
+
+			cancel()
+			if test.release {
+				// Release Provision once Run is draining.
+				err := wait.PollUntilContextTimeout(context.Background(), 10*time.Millisecond, wait.ForeverTestTimeout, true, func(context.Context) (bool, error) {
+					return ctrl.claimQueue.ShuttingDown(), nil
+				})
+				if err != nil {
+					t.Fatalf("Run did not start draining")
+				}
+				close(prov.release)
+			}
+			var err error
+			select {
+			case err = <-runErr:
+			case <-time.After(5 * time.Second):
+				t.Fatalf("Run did not return")
+			}
+
+			if test.expectedError {
+				if err == nil || !strings.Contains(err.Error(), "provisioning of claim default/claim-1") {
+					t.Errorf("expected error about abandoned claim-1, got %v", err)
+				}
+				select {
+				case err := <-prov.cancelled:
+					if !errors.Is(err, context.Canceled) {
+						t.Errorf("expected Provision to be cancelled, got %v", err)
+					}
+				case <-time.After(5 * time.Second):
+					t.Errorf("Provision was not cancelled")
+				}
+				return
+			}
+			if err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+			// The PV must be saved by the time Run returns.
+			if _, err := client.CoreV1().PersistentVolumes().Get(context.Background(), "pvc-uid-1-1", metav1.GetOptions{}); err != nil {
+				t.Errorf("expected provisioned volume to be saved, got %v", err)
+			}
+		})
+	}
+}
+
+func TestShutdownDrainsVolumeStore(t *testing.T) {
+	logger := ktesting.NewLogger(t, ktesting.NewConfig(ktesting.BufferLogs(true)))
+	client := fake.NewSimpleClientset()
+	var creates atomic.Int32
+	client.PrependReactor("create", "persistentvolumes", func(action testclient.Action) (handled bool, ret runtime.Object, err error) {
+		volume := action.(testclient.CreateAction).GetObject().(*v1.PersistentVolume)
+		// The first save of each volume and the first drain round fail,
+		// then the API server recovers except for pv-3.
+		if creates.Add(1) <= 6 || volume.Name == "pv-3" {
+			return true, nil, errors.New("fake error")
+		}
+		return false, nil, nil
+	})
+	ctrl := newTestProvisionController(logger, client, "foo.bar/baz", newTestProvisioner(), ShutdownGracePeriod(time.Second))
+	// The limiter would not retry before the end of the grace period.
+	limiter := workqueue.NewItemExponentialFailureRateLimiter(time.Hour, time.Hour)
+	ctrl.volumeStore = newVolumeStoreQueue(client, limiter, ctrl.claimsIndexer, ctrl.event, ctrl.metrics, 0, nil, ctrl.clock)
+	for i := 1; i <= 3; i++ {
+		volume := newVolume(fmt.Sprintf("pv-%d", i), v1.VolumePending, v1.PersistentVolumeReclaimDelete, nil, nil, nil)
+		volume.Spec.StorageClassName = "class-1"
+		volume.Spec.ClaimRef = &v1.ObjectReference{Namespace: "default", Name: fmt.Sprintf("claim-%d", i), UID: types.UID(fmt.Sprintf("uid-%d", i))}
+		volume.Spec.PersistentVolumeSource = v1.PersistentVolumeSource{CSI: &v1.CSIPersistentVolumeSource{Driver: "foo.bar/baz", VolumeHandle: fmt.Sprintf("handle-%d", i)}}
+		if err := ctrl.volumeStore.StoreVolume(logger, nil, volume); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	err := ctrl.drain(logger, &sync.WaitGroup{}, func() {})
+	if err == nil || !strings.Contains(err.Error(), "1 volumes not saved") {
+		t.Errorf("expected error about 1 unsaved volume, got %v", err)
+	}
+	for _, name := range []string{"pv-1", "pv-2"} {
+		if _, err := client.CoreV1().PersistentVolumes().Get(context.Background(), name, metav1.GetOptions{}); err != nil {
+			t.Errorf("expected %s to be saved during drain, got %v", name, err)
+		}
+	}
+	if abandoned := testutil.ToFloat64(ctrl.metrics.PersistentVolumesAbandonedTotal.WithLabelValues("class-1")); abandoned != 1 {
+		t.Errorf("expected 1 abandoned volume in metrics, got %v", abandoned)
+	}
+	logs := logger.GetSink().(ktesting.Underlier).GetBuffer().String()
+	for _, detail := range []string{`PV="pv-3"`, `claimUID="uid-3"`, `volumeHandle="handle-3"`} {
+		if !strings.Contains(logs, detail) {
+			t.Errorf("expected %s in the log of the abandoned volume, got:\n%s", detail, logs)
+		}
+	}
+	if strings.Contains(logs, `recovered manually" PV="pv-1"`) || strings.Contains(logs, `recovered manually" PV="pv-2"`) {
+		t.Errorf("expected only pv-3 to be logged as abandoned, got:\n%s", logs)
+	}
+}
+
+func TestShutdownDrainsBackoffStore(t *testing.T) {
+	logger := ktesting.NewLogger(t, ktesting.NewConfig(ktesting.BufferLogs(true)))
+	client := fake.NewSimpleClientset()
+	var creates atomic.Int32
+	client.PrependReactor("create", "persistentvolumes", func(action testclient.Action) (handled bool, ret runtime.Object, err error) {
+		volume := action.(testclient.CreateAction).GetObject().(*v1.PersistentVolume)
+		// The first save of each volume fails, then the API server
+		// recovers except for pv-3.
+		if creates.Add(1) <= 3 || volume.Name == "pv-3" {
+			return true, nil, errors.New("fake error")
+		}
+		return false, nil, nil
+	})
+	provisioner := &deleteCountingProvisioner{testProvisioner: newTestProvisioner()}
+	ctrl := newTestProvisionController(logger, client, "foo.bar/baz", provisioner, ShutdownGracePeriod(time.Second))
+	// The backoff would not retry before the end of the grace period.
+	ctrl.volumeStore = NewBackoffStore(client, ctrl.eventRecorder, &wait.Backoff{Duration: time.Hour, Factor: 1, Steps: 5}, ctrl.ProvisionController)
+	var workers sync.WaitGroup
+	storeErrs := make([]error, 3)
+	for i := 1; i <= 3; i++ {
+		claim := newClaim(fmt.Sprintf("claim-%d", i), fmt.Sprintf("uid-%d", i), "class-1", "foo.bar/baz", "", nil)
+		volume := newVolume(fmt.Sprintf("pv-%d", i), v1.VolumePending, v1.PersistentVolumeReclaimDelete, nil, nil, nil)
+		volume.Spec.StorageClassName = "class-1"
+		volume.Spec.ClaimRef = &v1.ObjectReference{Namespace: "default", Name: claim.Name, UID: claim.UID}
+		volume.Spec.PersistentVolumeSource = v1.PersistentVolumeSource{CSI: &v1.CSIPersistentVolumeSource{Driver: "foo.bar/baz", VolumeHandle: fmt.Sprintf("handle-%d", i)}}
+		workers.Add(1)
+		go func(i int) {
+			defer workers.Done()
+			storeErrs[i-1] = ctrl.volumeStore.StoreVolume(logger, claim, volume)
+		}(i)
+	}
+	err := wait.PollUntilContextTimeout(context.Background(), 10*time.Millisecond, wait.ForeverTestTimeout, true, func(context.Context) (bool, error) {
+		return creates.Load() >= 3, nil
+	})
+	if err != nil {
+		t.Fatalf("expected 3 failed saves, got %d", creates.Load())
+	}
+
+	err = ctrl.drain(logger, &workers, func() {})
+	if err == nil || !strings.Contains(err.Error(), "1 volumes not saved") {
+		t.Errorf("expected error about 1 unsaved volume, got %v", err)
+	}
+	workers.Wait()
+	for i, name := range []string{"pv-1", "pv-2"} {
+		if _, err := client.CoreV1().PersistentVolumes().Get(context.Background(), name, metav1.GetOptions{}); err != nil || storeErrs[i] != nil {
+			t.Errorf("expected %s to be saved during drain, got %v and %v", name, err, storeErrs[i])
+		}
+	}
+	if storeErrs[2] == nil {
+		t.Errorf("expected error of abandoned pv-3")
+	}
+	if len(provisioner.deleted) != 0 {
+		t.Errorf("expected storage asset of the abandoned volume to be kept, got Delete of %v", provisioner.deleted)
+	}
+	if abandoned := testutil.ToFloat64(ctrl.metrics.PersistentVolumesAbandonedTotal.WithLabelValues("class-1")); abandoned != 1 {
+		t.Errorf("expected 1 abandoned volume in metrics, got %v", abandoned)
+	}
+	logs := logger.GetSink().(ktesting.Underlier).GetBuffer().String()
+	for _, detail := range []string{`PV="pv-3"`, `claimUID="uid-3"`, `volumeHandle="handle-3"`} {
+		if !strings.Contains(logs, detail) {
+			t.Errorf("expected %s in the log of the abandoned volume, got:\n%s", detail, logs)
+		}
+	}
+}
+
+func TestShutdownGracePeriodValidation(t *testing.T) {
+	ctrl := &ProvisionController{hasRunLock: &sync.Mutex{}}
+	if err := ShutdownGracePeriod(-time.Second)(ctrl); err == nil {
+		t.Errorf("expected error, got none")
+	}
+}
+
+func TestClaimQueueFairness(t *testing.T) {
+	logger, ctx := ktesting.NewTestContext(t)
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	const claims = 10
+	objs := []runtime.Object{newStorageClass("class-1", "foo.bar/baz")}
+	created := time.Now().Add(-time.Hour)
+	for _, i := range rand.Perm(claims) {
+		claim := newClaim(fmt.Sprintf("claim-%d", i), fmt.Sprintf("uid-%d", i), "class-1", "foo.bar/baz", "", nil)
+		claim.CreationTimestamp = metav1.NewTime(created.Add(time.Duration(i) * time.Minute))
+		objs = append(objs, claim)
+	}
+	client := fake.NewSimpleClientset(objs...)
+	prov := &orderingProvisioner{gate: make(chan struct{}), provisioned: map[string]bool{}}
+	prov.failing.Store(true)
+	ctrl := newTestProvisionController(logger, client, "foo.bar/baz", prov, LeaderElection(false),
+		ProvisionThreadiness(1), ClaimQueueFairnessThreshold(0),
+		ClaimQueueRateLimiter(workqueue.NewItemExponentialFailureRateLimiter(500*time.Millisecond, 500*time.Millisecond)))
+	runTestController(t, ctx, ctrl.ProvisionController)
+
+	// The backend is down, all claims fail once.
+	err := wait.PollUntilContextTimeout(ctx, 10*time.Millisecond, 5*time.Second, true, func(context.Context) (bool, error) {
+		return prov.failures.Load() >= claims, nil
+	})
+	if err != nil {
+		t.Fatalf("expected %d failures, got %d", claims, prov.failures.Load())
+	}
+	// The backend recovers. The first retried claim holds the only worker
+	// until all others are queued.
+	prov.failing.Store(false)
+	err = wait.PollUntilContextTimeout(ctx, 10*time.Millisecond, 5*time.Second, true, func(context.Context) (bool, error) {
+		return ctrl.claimQueue.Len() == claims-1, nil
+	})
+	if err != nil {
+		t.Fatalf("expected %d queued claims, got %d", claims-1, ctrl.claimQueue.Len())
+	}
+	close(prov.gate)
+	err = wait.PollUntilContextTimeout(ctx, 10*time.Millisecond, 5*time.Second, true, func(context.Context) (bool, error) {
+		return len(prov.getOrder()) == claims, nil
+	})
+	if err != nil {
+		t.Fatalf("expected %d provisioned claims, got %v", claims, prov.getOrder())
+	}
+
+	order := prov.getOrder()[1:]
+	if !sort.SliceIsSorted(order, func(i, j int) bool { return order[i] < order[j] }) {
+		t.Errorf("expected older claims to be provisioned first, got %v", order)
+	}
+}
+
+func TestFairQueue(t *testing.T) {
+	created := map[string]time.Time{}
+	start := time.Now()
+	// Added in the reverse order of creation.
+	items := []string{"d", "c", "b", "a"}
+	for i, item := range items {
+		created[item] = start.Add(-time.Duration(i) * time.Minute)
+	}
+	tests := []struct {
+		name          string
+		threshold     int
+		expectedOrder []string
+	}{
+		{
+			name:          "below threshold",
+			threshold:     4,
+			expectedOrder: []string{"d", "c", "b", "a"},
+		},
+		{
+			name:          "above threshold",
+			threshold:     1,
+			expectedOrder: []string{"a", "b", "c", "d"},
+		},
+		{
+			name:          "down to threshold",
+			threshold:     2,
+			expectedOrder: []string{"a", "b", "d", "c"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			q := newFairQueue(workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter()), test.threshold, func(item interface{}) time.Time {
+				return created[item.(string)]
+			})
+			defer q.ShutDown()
+			q.start()
+			for _, item := range items {
+				q.Add(item)
+			}
+			if err := wait.PollUntilContextTimeout(context.Background(), 10*time.Millisecond, 5*time.Second, true, func(context.Context) (bool, error) {
+				q.lock.Lock()
+				defer q.lock.Unlock()
+				return q.ready == len(items), nil
+			}); err != nil {
+				t.Fatalf("items were not moved from the wrapped queue")
+			}
+			var order []string
+			for range items {
+				item, shutdown := q.Get()
+				if shutdown {
+					t.Fatalf("unexpected shutdown")
+				}
+				order = append(order, item.(string))
+			}
+			if !reflect.DeepEqual(order, test.expectedOrder) {
+				t.Errorf("expected order %v, got %v", test.expectedOrder, order)
+			}
+
+			// An item added while it's processed is handed out again after Done.
+			q.Add(order[0])
+			if l := q.Len(); l != 0 {
+				t.Errorf("expected no items waiting, got %d", l)
+			}
+			for _, item := range order {
+				q.Done(item)
+			}
+			if item, shutdown := q.Get(); shutdown || item != order[0] {
+				t.Errorf("expected re-added item %v, got %v, %v", order[0], item, shutdown)
+			}
+			q.Done(order[0])
+			q.ShutDown()
+			if _, shutdown := q.Get(); !shutdown {
+				t.Errorf("expected shutdown")
+			}
+		})
+	}
+}
+
+func TestPersistRetryState(t *testing.T) {
+	backoff := wait.Backoff{Duration: 2 * time.Second, Factor: 2, Cap: time.Minute}
+	const (
+		annAttempts    = "foo.bar-baz/provision-attempts"
+		annLastAttempt = "foo.bar-baz/last-attempt"
+	)
+	getClaim := func(t *testing.T, client *fake.Clientset) *v1.PersistentVolumeClaim {
+		claim, err := client.CoreV1().PersistentVolumeClaims(v1.NamespaceDefault).Get(context.Background(), "claim-1", metav1.GetOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return claim
+	}
+
+	t.Run("restart mid-backoff", func(t *testing.T) {
+		logger, ctx := ktesting.NewTestContext(t)
+		client := fake.NewSimpleClientset(newStorageClass("class-1", "foo.bar/baz"), newClaim("claim-1", "uid-1-1", "class-1", "foo.bar/baz", "", nil))
+
+		// The first controller fails once and is stopped.
+		firstCtx, stopFirst := context.WithCancel(ctx)
+		failing := &failingProvisioner{testProvisioner: newTestProvisioner()}
+		failing.failing.Store(true)
+		first := newTestProvisionController(logger, client, "foo.bar/baz", failing, LeaderElection(false),
+			ProvisionRetryBackoff(backoff), PersistRetryState(true), ClaimResyncPeriod(0))
+		firstDone := make(chan error)
+		go func() { firstDone <- first.Run(firstCtx) }()
+		err := wait.PollUntilContextTimeout(ctx, 10*time.Millisecond, 5*time.Second, true, func(context.Context) (bool, error) {
+			return getClaim(t, client).Annotations[annAttempts] == "1", nil
+		})
+		if err != nil {
+			t.Fatalf("expected 1 recorded attempt, got annotations %v", getClaim(t, client).Annotations)
+		}
+		stopFirst()
+		<-firstDone
+		lastAttempt, err := time.Parse(time.RFC3339Nano, getClaim(t, client).Annotations[annLastAttempt])
+		if err != nil {
+			t.Fatalf("invalid last attempt: %v", err)
+		}
+
+		// The second controller waits for the rest of the first delay. Resyncs
+		// are disabled, they retry claims regardless of the backoff.
+		secondCtx, stopSecond := context.WithCancel(ctx)
+		defer stopSecond()
+		prov := newTestProvisioner()
+		second := newTestProvisionController(logger, client, "foo.bar/baz", prov, LeaderElection(false),
+			ProvisionRetryBackoff(backoff), PersistRetryState(true), ClaimResyncPeriod(0))
+		runTestController(t, secondCtx, second.ProvisionController)
+		select {
+		case <-prov.provisionCalls:
+			if elapsed := time.Since(lastAttempt); elapsed < backoff.Duration-100*time.Millisecond {
+				t.Errorf("expected retry %v after the last attempt, got %v", backoff.Duration, elapsed)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("claim was not retried")
+		}
+
+		// Provisioned claims lose the state.
+		err = wait.PollUntilContextTimeout(ctx, 10*time.Millisecond, 5*time.Second, true, func(context.Context) (bool, error) {
+			annotations := getClaim(t, client).Annotations
+			_, attempts := annotations[annAttempts]
+			_, last := annotations[annLastAttempt]
+			return !attempts && !last, nil
+		})
+		if err != nil {
+			t.Errorf("expected retry state to be removed, got annotations %v", getClaim(t, client).Annotations)
+		}
+	})
+
+	t.Run("stale state", func(t *testing.T) {
+		logger, ctx := ktesting.NewTestContext(t)
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		claim := newClaim("claim-1", "uid-1-1", "class-1", "foo.bar/baz", "", map[string]string{
+			annAttempts:    "5",
+			annLastAttempt: time.Now().Add(-2 * backoff.Cap).Format(time.RFC3339Nano),
+		})
+		client := fake.NewSimpleClientset(newStorageClass("class-1", "foo.bar/baz"), claim)
+		prov := newTestProvisioner()
+		ctrl := newTestProvisionController(logger, client, "foo.bar/baz", prov, LeaderElection(false),
+			ProvisionRetryBackoff(backoff), PersistRetryState(true), ClaimResyncPeriod(0))
+		runTestController(t, ctx, ctrl.ProvisionController)
+		select {
+		case <-prov.provisionCalls:
+		case <-time.After(backoff.Duration):
+			t.Fatalf("claim with stale retry state was not provisioned immediately")
+		}
+	})
+}
+
+func TestPersistRetryStateValidation(t *testing.T) {
+	ctrl := &ProvisionController{hasRunLock: &sync.Mutex{}}
+	if err := PersistRetryState(true)(ctrl); err != nil {
+		t.Fatal(err)
+	}
+	if err := ctrl.validateOptions(); err == nil {
+		t.Errorf("expected error without ProvisionRetryBackoff, got none")
+	}
+}
+
+func TestClaimUpdateBackoff(t *testing.T) {
+	logger, ctx := ktesting.NewTestContext(t)
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	claim := newClaim("claim-1", "uid-1-1", "class-1", "foo.bar/baz", "", nil)
+	claim.ResourceVersion = "1"
+	client := fake.NewSimpleClientset(newStorageClass("class-1", "foo.bar/baz"), claim)
+	prov := &orderingProvisioner{gate: make(chan struct{}), provisioned: map[string]bool{}}
+	prov.failing.Store(true)
+	ctrl := newTestProvisionController(logger, client, "foo.bar/baz", prov, LeaderElection(false), ClaimResyncPeriod(0),
+		ProvisionRetryBackoff(wait.Backoff{Duration: time.Hour, Factor: 2}))
+	runTestController(t, ctx, ctrl.ProvisionController)
+
+	expectFailures := func(expected int32) {
+		t.Helper()
+		err := wait.PollUntilContextTimeout(ctx, 10*time.Millisecond, 5*time.Second, true, func(context.Context) (bool, error) {
+			return prov.failures.Load() >= expected, nil
+		})
+		if failures := prov.failures.Load(); err != nil || failures != expected {
+			t.Fatalf("expected %d attempts, got %d", expected, failures)
+		}
+		if n := ctrl.claimQueue.NumRequeues("uid-1-1"); n != 1 {
+			t.Errorf("expected 1 failure in the queue, got %d", n)
+		}
+	}
+	expectFailures(1)
+
+	// A status update waits for the backoff.
+	updated := claim.DeepCopy()
+	updated.ResourceVersion = "2"
+	updated.Status.Conditions = []v1.PersistentVolumeClaimCondition{{Type: v1.PersistentVolumeClaimResizing, Status: v1.ConditionFalse}}
+	updates := watchUpdates(t, ctrl.claimInformer, "claim-1")
+	if _, err := client.CoreV1().PersistentVolumeClaims(v1.NamespaceDefault).UpdateStatus(ctx, updated, metav1.UpdateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	updates(ctx, 1)
+	expectFailures(1)
+
+	// An annotation edit resets the backoff and retries right away.
+	updated = updated.DeepCopy()
+	updated.ResourceVersion = "3"
+	metav1.SetMetaDataAnnotation(&updated.ObjectMeta, "foo.bar/parameter", "fixed")
+	if _, err := client.CoreV1().PersistentVolumeClaims(v1.NamespaceDefault).Update(ctx, updated, metav1.UpdateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	expectFailures(2)
+}
+
+func TestFlattenAllowedTopologies(t *testing.T) {
+	term := func(requirements ...v1.TopologySelectorLabelRequirement) v1.TopologySelectorTerm {
+		return v1.TopologySelectorTerm{MatchLabelExpressions: requirements}
+	}
+	requirement := func(key string, values ...string) v1.TopologySelectorLabelRequirement {
+		return v1.TopologySelectorLabelRequirement{Key: key, Values: values}
+	}
+	tests := []struct {
+		name          string
+		terms         []v1.TopologySelectorTerm
+		expected      map[string][]string
+		expectedError bool
+	}{
+		{
+			name: "no allowed topologies",
+		},
+		{
+			name:     "single term",
+			terms:    []v1.TopologySelectorTerm{term(requirement("zone", "b", "a"), requirement("rack", "1"))},
+			expected: map[string][]string{"zone": {"a", "b"}, "rack": {"1"}},
+		},
+		{
+			name: "multiple terms",
+			terms: []v1.TopologySelectorTerm{
+				term(requirement("zone", "a"), requirement("rack", "1")),
+				term(requirement("zone", "c", "a"), requirement("rack", "2")),
+			},
+			expected: map[string][]string{"zone": {"a", "c"}, "rack": {"1", "2"}},
+		},
+		{
+			name:     "repeated key in a term",
+			terms:    []v1.TopologySelectorTerm{term(requirement("zone", "a", "b"), requirement("zone", "b", "c"))},
+			expected: map[string][]string{"zone": {"b"}},
+		},
+		{
+			name:          "contradictory key in a term",
+			terms:         []v1.TopologySelectorTerm{term(requirement("zone", "a"), requirement("zone", "b"))},
+			expectedError: true,
+		},
+		{
+			name: "terms with different keys",
+			terms: []v1.TopologySelectorTerm{
+				term(requirement("zone", "a")),
+				term(requirement("region", "x")),
+			},
+			expectedError: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			class := newStorageClassWithAllowedTopologies("class-1", "foo.bar/baz", test.terms)
+			flat, err := FlattenAllowedTopologies(class)
+			if test.expectedError {
+				if err == nil {
+					t.Errorf("expected error, got %v", flat)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(flat, test.expected) {
+				t.Errorf("expected %v, got %v", test.expected, flat)
+			}
+
+		})
+	}
+}
+
+func TestNodeMatchesAllowedTopologies(t *testing.T) {
+	terms := []v1.TopologySelectorTerm{
+		{MatchLabelExpressions: []v1.TopologySelectorLabelRequirement{{Key: "zone", Values: []string{"a", "b"}}, {Key: "rack", Values: []string{"1"}}}},
+		{MatchLabelExpressions: []v1.TopologySelectorLabelRequirement{{Key: "zone", Values: []string{"c"}}}},
+	}
+	tests := []struct {
+		labels   map[string]string
+		expected bool
+	}{
+		{labels: map[string]string{"zone": "a", "rack": "1"}, expected: true},
+		{labels: map[string]string{"zone": "b", "rack": "1", "other": "x"}, expected: true},
+		{labels: map[string]string{"zone": "c"}, expected: true},
+		{labels: map[string]string{"zone": "a", "rack": "2"}},
+		{labels: map[string]string{"zone": "a"}},
+		{labels: map[string]string{"zone": "d", "rack": "1"}},
+		{labels: nil},
+	}
+	for _, test := range tests {
+		if matches := nodeMatchesAllowedTopologies(newNodeWithLabels("node-1", test.labels), terms); matches != test.expected {
+			t.Errorf("expected node with labels %v to match: %v, got %v", test.labels, test.expected, matches)
+		}
+	}
+	if !nodeMatchesAllowedTopologies(newNode("node-1"), nil) {
+		t.Errorf("expected node to match empty allowed topologies")
+	}
+
+	zoneTerms := []v1.TopologySelectorTerm{
+		{MatchLabelExpressions: []v1.TopologySelectorLabelRequirement{{Key: v1.LabelTopologyZone, Values: []string{"a"}}}},
+	}
+	zoneTests := []struct {
+		labels   map[string]string
+		expected bool
+	}{
+		{labels: map[string]string{v1.LabelFailureDomainBetaZone: "a"}, expected: true},
+		{labels: map[string]string{v1.LabelTopologyZone: "a"}, expected: true},
+		{labels: map[string]string{v1.LabelTopologyZone: "a", v1.LabelFailureDomainBetaZone: "b"}, expected: true},
+		{labels: map[string]string{v1.LabelTopologyZone: "b", v1.LabelFailureDomainBetaZone: "a"}},
+	}
+	for _, test := range zoneTests {
+		if matches := nodeMatchesAllowedTopologies(newNodeWithLabels("node-1", test.labels), zoneTerms); matches != test.expected {
+			t.Errorf("expected node with labels %v to match: %v, got %v", test.labels, test.expected, matches)
+		}
+	}
+}
+
+func TestSelectedNodeGone(t *testing.T) {
+	terminating := newNode("node-1")
+	terminating.DeletionTimestamp = &metav1.Time{Time: time.Now()}
+	terminating.Finalizers = []string{"example.com/drain"}
+	tests := []struct {
+		name            string
+		node            *v1.Node
+		listerNode      bool
+		expectedReason  string
+		expectedMessage string
+	}{
+		{
+			name:            "node deleted before provisioning",
+			expectedReason:  rescheduleReasonNodeNotFound,
+			expectedMessage: `Selected node "node-1" no longer exists, waiting for reschedule`,
+		},
+		{
+			name:            "node terminating",
+			node:            terminating,
+			listerNode:      true,
+			expectedReason:  rescheduleReasonNodeTerminating,
+			expectedMessage: `Selected node "node-1" is being deleted, waiting for reschedule`,
+		},
+		{
+			name: "lister stale but node exists",
+			node: newNode("node-1"),
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			logger, ctx := ktesting.NewTestContext(t)
+			class := newStorageClassWithVolumeBindingMode("class-1", "foo.bar/baz", &modeWait)
+			claim := newClaim("claim-1", "uid-1-1", "class-1", "foo.bar/baz", "", map[string]string{AnnBetaStorageProvisioner: "foo.bar/baz", AnnSelectedNode: "node-1"})
+			objs := []runtime.Object{class, claim}
+			if test.node != nil {
+				objs = append(objs, test.node)
+			}
+			client := fake.NewSimpleClientset(objs...)
+			ctrl := newTestProvisionController(logger, client, "foo.bar/baz", newTestProvisioner())
+			recorder := record.NewFakeRecorder(10)
+			ctrl.eventRecorder = recorder
+			ctrl.classes.Add(class)
+			ctrl.claimInformer.GetStore().Add(claim)
+			// The node informer is not running, its cache is empty unless
+			// the node is added explicitly.
+			nodes := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+			if test.listerNode {
+				nodes.Add(test.node)
+			}
+			ctrl.nodeLister = corelistersv1.NewNodeLister(nodes)
+
+			if err := ctrl.syncClaim(ctx, claim); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			updated, err := client.CoreV1().PersistentVolumeClaims(claim.Namespace).Get(ctx, claim.Name, metav1.GetOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, selected := updated.Annotations[AnnSelectedNode]
+			if selected != (test.expectedReason == "") {
+				t.Errorf("expected selected node annotation: %v, got annotations %v", test.expectedReason == "", updated.Annotations)
+			}
+			_, pvErr := client.CoreV1().PersistentVolumes().Get(ctx, "pvc-uid-1-1", metav1.GetOptions{})
+			if provisioned := pvErr == nil; provisioned != (test.expectedReason == "") {
+				t.Errorf("expected volume provisioned: %v, got %v", test.expectedReason == "", provisioned)
+			}
+			if failed := testutil.ToFloat64(ctrl.metrics.PersistentVolumeClaimProvisionFailedTotal.WithLabelValues("class-1", "")); failed != 0 {
+				t.Errorf("expected no provisioning failures, got %v", failed)
+			}
+			if test.expectedReason != "" {
+				if reschedules := testutil.ToFloat64(ctrl.metrics.PersistentVolumeClaimRescheduleTotal.WithLabelValues("class-1", test.expectedReason)); reschedules != 1 {
+					t.Errorf("expected 1 reschedule with reason %q, got %v", test.expectedReason, reschedules)
+				}
+			}
+
+			waitingEvent := ""
+			for len(recorder.Events) > 0 {
+				event := <-recorder.Events
+				if strings.HasPrefix(event, v1.EventTypeWarning+" ProvisioningFailed") {
+					t.Errorf("unexpected event %q", event)
+				}
+				if strings.HasPrefix(event, v1.EventTypeNormal+" WaitingForReschedule") {
+					waitingEvent = event
+				}
+			}
+			if test.expectedMessage != "" && !strings.Contains(waitingEvent, test.expectedMessage) {
+				t.Errorf("expected event with message %q, got %q", test.expectedMessage, waitingEvent)
+			}
+			if test.expectedMessage == "" && waitingEvent != "" {
+				t.Errorf("unexpected event %q", waitingEvent)
+			}
+		})
+	}
+}
+
+func TestAvoidUnschedulableNodes(t *testing.T) {
+	cordoned := newNode("node-1")
+	cordoned.Spec.Unschedulable = true
+	tainted := newNode("node-1")
+	tainted.Spec.Taints = []v1.Taint{{Key: "example.com/decommission", Value: "true", Effect: v1.TaintEffectNoSchedule}}
+	otherTaint := newNode("node-1")
+	otherTaint.Spec.Taints = []v1.Taint{{Key: "example.com/gpu", Effect: v1.TaintEffectNoSchedule}}
+	avoid := AvoidUnschedulableNodes(true, v1.Taint{Key: "example.com/decommission", Effect: v1.TaintEffectNoSchedule})
+	tests := []struct {
+		name            string
+		node            *v1.Node
+		option          func(*ProvisionController) error
+		expectedMessage string
+	}{
+		{
+			name:            "cordoned",
+			node:            cordoned,
+			option:          avoid,
+			expectedMessage: `Selected node "node-1" is cordoned, waiting for reschedule`,
+		},
+		{
+			name:            "tainted with the configured taint",
+			node:            tainted,
+			option:          avoid,
+			expectedMessage: `Selected node "node-1" has taint example.com/decommission=true:NoSchedule, waiting for reschedule`,
+		},
+		{
+			name:   "tainted with another taint",
+			node:   otherTaint,
+			option: avoid,
+		},
+		{
+			name:   "healthy",
+			node:   newNode("node-1"),
+			option: avoid,
+		},
+		{
+			name:   "cordoned, disabled",
+			node:   cordoned,
+			option: AvoidUnschedulableNodes(false),
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			logger, ctx := ktesting.NewTestContext(t)
+			class := newStorageClassWithVolumeBindingMode("class-1", "foo.bar/baz", &modeWait)
+			claim := newClaim("claim-1", "uid-1-1", "class-1", "foo.bar/baz", "", map[string]string{AnnBetaStorageProvisioner: "foo.bar/baz", AnnSelectedNode: "node-1"})
+			client := fake.NewSimpleClientset(class, claim, test.node)
+			ctrl := newTestProvisionController(logger, client, "foo.bar/baz", newTestProvisioner(), test.option)
+			recorder := record.NewFakeRecorder(10)
+			ctrl.eventRecorder = recorder
+			ctrl.classes.Add(class)
+			ctrl.claimInformer.GetStore().Add(claim)
+
+			if err := ctrl.syncClaim(ctx, claim); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			rescheduled := test.expectedMessage != ""
+			updated, err := client.CoreV1().PersistentVolumeClaims(claim.Namespace).Get(ctx, claim.Name, metav1.GetOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, selected := updated.Annotations[AnnSelectedNode]; selected == rescheduled {
+				t.Errorf("expected selected node annotation: %v, got annotations %v", !rescheduled, updated.Annotations)
+			}
+			_, pvErr := client.CoreV1().PersistentVolumes().Get(ctx, "pvc-uid-1-1", metav1.GetOptions{})
+			if provisioned := pvErr == nil; provisioned == rescheduled {
+				t.Errorf("expected volume provisioned: %v, got %v", !rescheduled, provisioned)
+			}
+			expectedReschedules := 0.0
+			if rescheduled {
+				expectedReschedules = 1
+			}
+			if reschedules := testutil.ToFloat64(ctrl.metrics.PersistentVolumeClaimRescheduleTotal.WithLabelValues("class-1", rescheduleReasonNodeUnschedulable)); reschedules != expectedReschedules {
+				t.Errorf("expected %v reschedules, got %v", expectedReschedules, reschedules)
+			}
+
+			waitingEvent := ""
+			for len(recorder.Events) > 0 {
+				if event := <-recorder.Events; strings.HasPrefix(event, v1.EventTypeNormal+" WaitingForReschedule") {
+					waitingEvent = event
+				}
+			}
+			if !strings.Contains(waitingEvent, test.expectedMessage) || (waitingEvent != "") != rescheduled {
+				t.Errorf("expected event with message %q, got %q", test.expectedMessage, waitingEvent)
+			}
+		})
+	}
+}
+
+func TestAvoidUnschedulableNodesValidation(t *testing.T) {
+	ctrl := &ProvisionController{hasRunLock: &sync.Mutex{}}
+	if err := AvoidUnschedulableNodes(true, v1.Taint{Effect: v1.TaintEffectNoSchedule})(ctrl); err == nil {
+		t.Errorf("expected error for taint without key")
+	}
+}
+
+func TestCapacityChecker(t *testing.T) {
+	tests := []struct {
+		name              string
+		capacity          string
+		immediate         bool
+		inProgress        bool
+		checkErr          error
+		expectedChecks    int32
+		expectProvisioned bool
+		expectRescheduled bool
+		expectedError     bool
+	}{
+		{
+			name:              "enough capacity",
+			capacity:          "10Mi",
+			expectedChecks:    1,
+			expectProvisioned: true,
+		},
+		{
+			name:              "node full",
+			capacity:          "512Ki",
+			expectedChecks:    1,
+			expectRescheduled: true,
+		},
+		{
+			name:           "check error",
+			capacity:       "10Mi",
+			checkErr:       errors.New("fake capacity error"),
+			expectedChecks: 1,
+			expectedError:  true,
+		},
+		{
+			name:              "immediate binding",
+			capacity:          "512Ki",
+			immediate:         true,
+			expectProvisioned: true,
+		},
+		{
+			name:              "provisioning in background",
+			capacity:          "512Ki",
+			inProgress:        true,
+			expectProvisioned: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			logger, ctx := ktesting.NewTestContext(t)
+			class := newStorageClassWithVolumeBindingMode("class-1", "foo.bar/baz", &modeWait)
+			annotations := map[string]string{AnnBetaStorageProvisioner: "foo.bar/baz", AnnSelectedNode: "node-1"}
+			if test.immediate {
+				class = newStorageClass("class-1", "foo.bar/baz")
+				delete(annotations, AnnSelectedNode)
+			}
+			claim := newClaim("claim-1", "uid-1-1", "class-1", "foo.bar/baz", "", annotations)
+			node := newNode("node-1")
+			node.Annotations = map[string]string{annTestFreeCapacity: test.capacity}
+			client := fake.NewSimpleClientset(class, claim, node)
+			provisioner := &capacityTestProvisioner{testProvisioner: newTestProvisioner(), err: test.checkErr}
+			ctrl := newTestProvisionController(logger, client, "foo.bar/baz", provisioner)
+			ctrl.classes.Add(class)
+			ctrl.claimInformer.GetStore().Add(claim)
+			if test.inProgress {
+				ctrl.claimsInProgress.Store(string(claim.UID), claim)
+			}
+
+			err := ctrl.syncClaim(ctx, claim)
+			if (err != nil) != test.expectedError {
+				t.Fatalf("expected error: %v, got %v", test.expectedError, err)
+			}
+
+			if checks := provisioner.checks.Load(); checks != test.expectedChecks {
+				t.Errorf("expected %d capacity checks, got %d", test.expectedChecks, checks)
+			}
+			_, pvErr := client.CoreV1().PersistentVolumes().Get(ctx, "pvc-uid-1-1", metav1.GetOptions{})
+			if provisioned := pvErr == nil; provisioned != test.expectProvisioned {
+				t.Errorf("expected volume provisioned: %v, got %v", test.expectProvisioned, provisioned)
+			}
+			updated, err := client.CoreV1().PersistentVolumeClaims(claim.Namespace).Get(ctx, claim.Name, metav1.GetOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, selected := updated.Annotations[AnnSelectedNode]
+			if rescheduled := !test.immediate && !selected; rescheduled != test.expectRescheduled {
+				t.Errorf("expected rescheduled: %v, got annotations %v", test.expectRescheduled, updated.Annotations)
+			}
+			expectedFailures := 0.0
+			if test.expectedError {
+				expectedFailures = 1
+			}
+			if failed := testutil.ToFloat64(ctrl.metrics.PersistentVolumeClaimProvisionFailedTotal.WithLabelValues("class-1", "")); failed != expectedFailures {
+				t.Errorf("expected %v provisioning failures, got %v", expectedFailures, failed)
+			}
+		})
+	}
+}
+
+func TestStorageCapacityTracking(t *testing.T) {
+	newCapacity := func(name, class, zone, capacity, maxSize string) *storage.CSIStorageCapacity {
+		c := &storage.CSIStorageCapacity{
+			ObjectMeta:       metav1.ObjectMeta{Name: name, Namespace: "kube-system"},
+			StorageClassName: class,
+			NodeTopology:     &metav1.LabelSelector{MatchLabels: map[string]string{"zone": zone}},
+		}
+		if capacity != "" {
+			q := resource.MustParse(capacity)
+			c.Capacity = &q
+		}
+		if maxSize != "" {
+			q := resource.MustParse(maxSize)
+			c.MaximumVolumeSize = &q
+		}
+		return c
+	}
+	// The claims request 1Mi.
+	tests := []struct {
+		name              string
+		option            func(*ProvisionController) error
+		immediate         bool
+		capacities        []*storage.CSIStorageCapacity
+		expectProvisioned bool
+	}{
+		{
+			name:              "fits in segment of selected node",
+			option:            UseStorageCapacityTracking(true),
+			capacities:        []*storage.CSIStorageCapacity{newCapacity("c1", "class-1", "a", "10Mi", ""), newCapacity("c2", "class-1", "b", "0", "")},
+			expectProvisioned: true,
+		},
+		{
+			name:       "fits only in other segment",
+			option:     UseStorageCapacityTracking(true),
+			capacities: []*storage.CSIStorageCapacity{newCapacity("c1", "class-1", "a", "512Ki", ""), newCapacity("c2", "class-1", "b", "10Mi", "")},
+		},
+		{
+			name:       "maximum volume size too small",
+			option:     UseStorageCapacityTracking(true),
+			capacities: []*storage.CSIStorageCapacity{newCapacity("c1", "class-1", "a", "10Mi", "512Ki")},
+		},
+		{
+			name:       "unknown capacity",
+			option:     UseStorageCapacityTracking(true),
+			capacities: []*storage.CSIStorageCapacity{newCapacity("c1", "class-1", "a", "", "")},
+		},
+		{
+			name:              "capacity of other class",
+			option:            UseStorageCapacityTracking(true),
+			capacities:        []*storage.CSIStorageCapacity{newCapacity("c1", "class-2", "a", "0", "")},
+			expectProvisioned: true,
+		},
+		{
+			name:              "class not tracked",
+			option:            UseStorageCapacityTracking(true, "class-2"),
+			capacities:        []*storage.CSIStorageCapacity{newCapacity("c1", "class-1", "a", "0", "")},
+			expectProvisioned: true,
+		},
+		{
+			name:              "immediate binding fits in any segment",
+			option:            UseStorageCapacityTracking(true),
+			immediate:         true,
+			capacities:        []*storage.CSIStorageCapacity{newCapacity("c1", "class-1", "a", "0", ""), newCapacity("c2", "class-1", "b", "10Mi", "")},
+			expectProvisioned: true,
+		},
+		{
+			name:       "immediate binding fits nowhere",
+			option:     UseStorageCapacityTracking(true),
+			immediate:  true,
+			capacities: []*storage.CSIStorageCapacity{newCapacity("c1", "class-1", "a", "0", ""), newCapacity("c2", "class-1", "b", "512Ki", "")},
+		},
+		{
+			name:              "disabled",
+			option:            UseStorageCapacityTracking(false),
+			capacities:        []*storage.CSIStorageCapacity{newCapacity("c1", "class-1", "a", "0", "")},
+			expectProvisioned: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			logger, ctx := ktesting.NewTestContext(t)
+			class := newStorageClassWithVolumeBindingMode("class-1", "foo.bar/baz", &modeWait)
+			annotations := map[string]string{AnnBetaStorageProvisioner: "foo.bar/baz", AnnSelectedNode: "node-1"}
+			if test.immediate {
+				class = newStorageClass("class-1", "foo.bar/baz")
+				delete(annotations, AnnSelectedNode)
+			}
+			claim := newClaim("claim-1", "uid-1-1", "class-1", "foo.bar/baz", "", annotations)
+			client := fake.NewSimpleClientset(class, claim, newNodeWithLabels("node-1", map[string]string{"zone": "a"}))
+			ctrl := newTestProvisionController(logger, client, "foo.bar/baz", newTestProvisioner(), test.option)
+			recorder := record.NewFakeRecorder(10)
+			ctrl.eventRecorder = recorder
+			ctrl.classes.Add(class)
+			ctrl.claimInformer.GetStore().Add(claim)
+			if ctrl.capacityInformer != nil {
+				for _, capacity := range test.capacities {
+					ctrl.capacityInformer.GetIndexer().Add(capacity)
+				}
+			}
+
+			err := ctrl.syncClaim(ctx, claim)
+			if test.expectProvisioned && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !test.expectProvisioned && !errors.Is(err, errNoStorageCapacity) {
+				t.Fatalf("expected errNoStorageCapacity, got %v", err)
+			}
+			_, pvErr := client.CoreV1().PersistentVolumes().Get(ctx, "pvc-uid-1-1", metav1.GetOptions{})
+			if provisioned := pvErr == nil; provisioned != test.expectProvisioned {
+				t.Errorf("expected volume provisioned: %v, got %v", test.expectProvisioned, provisioned)
+			}
+			if failed := testutil.ToFloat64(ctrl.metrics.PersistentVolumeClaimProvisionFailedTotal.WithLabelValues("class-1", "")); failed != 0 {
+				t.Errorf("expected no provisioning failures, got %v", failed)
+			}
+			capacityEvent := false
+			for len(recorder.Events) > 0 {
+				if event := <-recorder.Events; strings.HasPrefix(event, v1.EventTypeWarning+" NotEnoughStorageCapacity") {
+					capacityEvent = true
+				}
+			}
+			if capacityEvent == test.expectProvisioned {
+				t.Errorf("expected NotEnoughStorageCapacity event: %v, got %v", !test.expectProvisioned, capacityEvent)
+			}
+		})
+	}
+}
+
+func TestStorageCapacityRetry(t *testing.T) {
+	logger, ctx := ktesting.NewTestContext(t)
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	class := newStorageClass("class-1", "foo.bar/baz")
+	claim := newClaim("claim-1", "uid-1-1", "class-1", "foo.bar/baz", "", nil)
+	small := resource.MustParse("512Ki")
+	capacity := &storage.CSIStorageCapacity{
+		ObjectMeta:       metav1.ObjectMeta{Name: "c1", Namespace: "kube-system"},
+		StorageClassName: "class-1",
+		NodeTopology:     &metav1.LabelSelector{},
+		Capacity:         &small,
+	}
+	client := fake.NewSimpleClientset(class, claim, capacity)
+	ctrl := newTestProvisionController(logger, client, "foo.bar/baz", newTestProvisioner(), UseStorageCapacityTracking(true), LeaderElection(false), ClaimResyncPeriod(0))
+	ctrl.storageCapacityRetryDelay = 200 * time.Millisecond
+	recorder := record.NewFakeRecorder(100)
+	ctrl.eventRecorder = recorder
+	runTestController(t, ctx, ctrl.ProvisionController)
+
+	select {
+	case event := <-recorder.Events:
+		if !strings.HasPrefix(event, v1.EventTypeWarning+" NotEnoughStorageCapacity") {
+			t.Fatalf("expected NotEnoughStorageCapacity event, got %q", event)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("claim was not processed")
+	}
+	if _, err := client.CoreV1().PersistentVolumes().Get(ctx, "pvc-uid-1-1", metav1.GetOptions{}); err == nil {
+		t.Fatalf("expected no volume without capacity")
+	}
+
+	large := resource.MustParse("10Mi")
+	capacity = capacity.DeepCopy()
+	capacity.Capacity = &large
+	if _, err := client.StorageV1().CSIStorageCapacities("kube-system").Update(ctx, capacity, metav1.UpdateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	err := wait.PollUntilContextTimeout(ctx, 10*time.Millisecond, 5*time.Second, true, func(ctx context.Context) (bool, error) {
+		_, err := client.CoreV1().PersistentVolumes().Get(ctx, "pvc-uid-1-1", metav1.GetOptions{})
+		return err == nil, nil
+	})
+	if err != nil {
+		t.Errorf("volume was not provisioned after capacity was added")
+	}
+	if failed := testutil.ToFloat64(ctrl.metrics.PersistentVolumeClaimProvisionFailedTotal.WithLabelValues("class-1", "")); failed != 0 {
+		t.Errorf("expected no provisioning failures, got %v", failed)
+	}
+}
+
+func TestRequireSelectedNode(t *testing.T) {
+	logger, ctx := ktesting.NewTestContext(t)
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	class := newStorageClass("class-1", "foo.bar/baz")
+	claim := newClaim("claim-1", "uid-1-1", "class-1", "foo.bar/baz", "", nil)
+	volume := newVolume("volume-1", v1.VolumeReleased, v1.PersistentVolumeReclaimDelete, map[string]string{AnnDynamicallyProvisioned: "foo.bar/baz"}, nil, nil)
+	client := fake.NewSimpleClientset(class, claim, volume, newNode("node-1"))
+	recorder := record.NewFakeRecorder(100)
+	ctrl := newTestProvisionController(logger, client, "foo.bar/baz", newTestProvisioner(), RequireSelectedNode(true), LeaderElection(false), WithEventRecorder(recorder))
+	resyncs := watchUpdates(t, ctrl.claimInformer, "claim-1")
+	runTestController(t, ctx, ctrl.ProvisionController)
+
+	// Deletion is not affected.
+	err := wait.PollUntilContextTimeout(ctx, 10*time.Millisecond, 5*time.Second, true, func(ctx context.Context) (bool, error) {
+		_, err := client.CoreV1().PersistentVolumes().Get(ctx, "volume-1", metav1.GetOptions{})
+		return apierrs.IsNotFound(err), nil
+	})
+	if err != nil {
+		t.Errorf("volume was not deleted")
+	}
+
+	// The claim waits, repeated syncs must not repeat the event.
+	resyncs(ctx, 2)
+	if _, err := client.CoreV1().PersistentVolumes().Get(ctx, "pvc-uid-1-1", metav1.GetOptions{}); err == nil {
+		t.Fatalf("expected no volume for claim without selected node")
+	}
+	advised := 0
+	for len(recorder.Events) > 0 {
+		if event := <-recorder.Events; strings.HasPrefix(event, v1.EventTypeWarning+" SelectedNodeRequired") {
+			advised++
+			if !strings.Contains(event, "WaitForFirstConsumer") {
+				t.Errorf("expected advice to use WaitForFirstConsumer in event %q", event)
+			}
+		}
+	}
+	if advised != 1 {
+		t.Errorf("expected 1 SelectedNodeRequired event, got %d", advised)
+	}
+
+	claim = claim.DeepCopy()
+	claim.Annotations[AnnSelectedNode] = "node-1"
+	claim.ResourceVersion = "2"
+	if _, err := client.CoreV1().PersistentVolumeClaims(claim.Namespace).Update(ctx, claim, metav1.UpdateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	err = wait.PollUntilContextTimeout(ctx, 10*time.Millisecond, 5*time.Second, true, func(ctx context.Context) (bool, error) {
+		_, err := client.CoreV1().PersistentVolumes().Get(ctx, "pvc-uid-1-1", metav1.GetOptions{})
+		return err == nil, nil
+	})
+	if err != nil {
+		t.Errorf("volume was not provisioned after a node was selected")
+	}
+}
+
+func TestValidateTopologyKeys(t *testing.T) {
+	newClass := func(provisioner string, keys ...string) *storage.StorageClass {
+		class := newStorageClass("class-1", provisioner)
+		for _, key := range keys {
+			class.AllowedTopologies = append(class.AllowedTopologies, v1.TopologySelectorTerm{
+				MatchLabelExpressions: []v1.TopologySelectorLabelRequirement{{Key: key, Values: []string{"a"}}},
+			})
+		}
+		return class
+	}
+	nodes := []*v1.Node{
+		newNodeWithLabels("node-1", map[string]string{"example.com/rack": "1"}),
+		newNodeWithLabels("node-2", map[string]string{v1.LabelFailureDomainBetaZone: "a"}),
+	}
+	tests := []struct {
+		name            string
+		class           *storage.StorageClass
+		nodes           []*v1.Node
+		expectedMessage string
+	}{
+		{
+			name:  "keys present",
+			class: newClass("foo.bar/baz", "example.com/rack", v1.LabelTopologyZone),
+			nodes: nodes,
+		},
+		{
+			name:            "key absent",
+			class:           newClass("foo.bar/baz", "example.com/rack", "example.com/rakc", "example.org/zone"),
+			nodes:           nodes,
+			expectedMessage: "No node has label example.com/rakc, example.org/zone used in allowedTopologies",
+		},
+		{
+			name:  "no nodes",
+			class: newClass("foo.bar/baz", "example.com/rakc"),
+		},
+		{
+			name:  "no allowed topologies",
+			class: newClass("foo.bar/baz"),
+			nodes: nodes,
+		},
+		{
+			name:  "other provisioner",
+			class: newClass("abc.def/ghi", "example.com/rakc"),
+			nodes: nodes,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			logger, _ := ktesting.NewTestContext(t)
+			recorder := record.NewFakeRecorder(10)
+			fakeClock := testingclock.NewFakeClock(time.Now())
+			ctrl := newTestProvisionController(logger, fake.NewSimpleClientset(), "foo.bar/baz", newTestProvisioner(), ValidateTopologyKeys(true), WithEventRecorder(recorder), WithClock(fakeClock))
+			indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+			for _, node := range test.nodes {
+				indexer.Add(node)
+			}
+			ctrl.nodeLister = corelistersv1.NewNodeLister(indexer)
+
+			ctrl.checkClassTopologyKeys(test.class)
+			// Repeated checks are rate limited.
+			ctrl.checkClassTopologyKeys(test.class)
+
+			var events []string
+			for len(recorder.Events) > 0 {
+				events = append(events, <-recorder.Events)
+			}
+			if test.expectedMessage == "" {
+				if len(events) != 0 {
+					t.Errorf("expected no events, got %v", events)
+				}
+				return
+			}
+			if len(events) != 1 || !strings.HasPrefix(events[0], v1.EventTypeWarning+" UnknownTopologyKeys") || !strings.Contains(events[0], test.expectedMessage) {
+				t.Fatalf("expected one UnknownTopologyKeys event with message %q, got %v", test.expectedMessage, events)
+			}
+
+			fakeClock.Step(topologyKeyEventInterval)
+			ctrl.checkClassTopologyKeys(test.class)
+			if len(recorder.Events) != 1 {
+				t.Errorf("expected another event after %v", topologyKeyEventInterval)
+			}
+		})
+	}
+}
+
+func TestResolveConsumerPod(t *testing.T) {
+	newPod := func(name, nodeName string, age time.Duration, claims ...string) *v1.Pod {
+		pod := &v1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default", CreationTimestamp: metav1.NewTime(time.Now().Add(-age))},
+			Spec:       v1.PodSpec{NodeName: nodeName},
+		}
+		for _, claim := range claims {
+			pod.Spec.Volumes = append(pod.Spec.Volumes, v1.Volume{
+				Name:         "vol-" + claim,
+				VolumeSource: v1.VolumeSource{PersistentVolumeClaim: &v1.PersistentVolumeClaimVolumeSource{ClaimName: claim}},
+			})
+		}
+		return pod
+	}
+	ephemeral := newPod("pod-eph", "", time.Minute)
+	ephemeral.Spec.Volumes = []v1.Volume{{Name: "data", VolumeSource: v1.VolumeSource{Ephemeral: &v1.EphemeralVolumeSource{}}}}
+	finished := newPod("pod-finished", "node-1", time.Hour, "claim-1")
+	finished.Status.Phase = v1.PodSucceeded
+	tests := []struct {
+		name        string
+		claimName   string
+		immediate   bool
+		disabled    bool
+		pods        []*v1.Pod
+		expectedPod string
+	}{
+		{
+			name:        "found",
+			claimName:   "claim-1",
+			pods:        []*v1.Pod{newPod("pod-1", "", time.Minute, "claim-1"), newPod("pod-other", "", time.Hour, "claim-2")},
+			expectedPod: "pod-1",
+		},
+		{
+			name:      "not found",
+			claimName: "claim-1",
+			pods:      []*v1.Pod{newPod("pod-other", "", time.Minute, "claim-2")},
+		},
+		{
+			name:      "multiple pods",
+			claimName: "claim-1",
+			pods: []*v1.Pod{
+				newPod("pod-newer", "", time.Minute, "claim-1"),
+				newPod("pod-older", "", time.Hour, "claim-1"),
+				newPod("pod-other-node", "node-2", 2*time.Hour, "claim-1"),
+				finished,
+			},
+			expectedPod: "pod-older",
+		},
+		{
+			name:      "pod bound to the node wins",
+			claimName: "claim-1",
+			pods: []*v1.Pod{
+				newPod("pod-pending", "", time.Hour, "claim-1"),
+				newPod("pod-bound", "node-1", time.Minute, "claim-1"),
+			},
+			expectedPod: "pod-bound",
+		},
+		{
+			name:        "generic ephemeral volume",
+			claimName:   "pod-eph-data",
+			pods:        []*v1.Pod{ephemeral},
+			expectedPod: "pod-eph",
+		},
+		{
+			name:      "immediate binding",
+			claimName: "claim-1",
+			immediate: true,
+			pods:      []*v1.Pod{newPod("pod-1", "", time.Minute, "claim-1")},
+		},
+		{
+			name:      "disabled",
+			claimName: "claim-1",
+			disabled:  true,
+			pods:      []*v1.Pod{newPod("pod-1", "", time.Minute, "claim-1")},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			logger, ctx := ktesting.NewTestContext(t)
+			class := newStorageClassWithVolumeBindingMode("class-1", "foo.bar/baz", &modeWait)
+			if test.immediate {
+				class = newStorageClass("class-1", "foo.bar/baz")
+			}
+			claim := newClaim(test.claimName, "uid-1-1", "class-1", "foo.bar/baz", "", map[string]string{AnnBetaStorageProvisioner: "foo.bar/baz", AnnSelectedNode: "node-1"})
+			client := fake.NewSimpleClientset(class, claim, newNode("node-1"))
+			prov := newTestProvisioner()
+			ctrl := newTestProvisionController(logger, client, "foo.bar/baz", prov, ResolveConsumerPod(!test.disabled))
+			if test.disabled {
+				if ctrl.podInformer != nil {
+					t.Fatalf("expected no pod informer")
+				}
+			} else {
+				for _, pod := range test.pods {
+					ctrl.podInformer.GetIndexer().Add(pod)
+				}
+			}
+			ctrl.classes.Add(class)
+			ctrl.claimInformer.GetStore().Add(claim)
+
+			if err := ctrl.syncClaim(ctx, claim); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			select {
+			case call := <-prov.provisionCalls:
+				pod := ""
+				if call.consumerPod != nil {
+					pod = call.consumerPod.Name
+				}
+				if pod != test.expectedPod {
+					t.Errorf("expected consumer pod %q, got %q", test.expectedPod, pod)
+				}
+			default:
+				t.Fatalf("expected a Provision call")
+			}
+		})
+	}
+}
+
+func TestResolveSnapshotDataSource(t *testing.T) {
+	newSnapshot := func(name string, ready bool, content string) *unstructured.Unstructured {
+		snapshot := &unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": "snapshot.storage.k8s.io/v1",
+			"kind":       "VolumeSnapshot",
+			"metadata":   map[string]interface{}{"name": name, "namespace": "default"},
+			"status": map[string]interface{}{
+				"readyToUse":  ready,
+				"restoreSize": "2Gi",
+			},
+		}}
+		if content != "" {
+			unstructured.SetNestedField(snapshot.Object, content, "status", "boundVolumeSnapshotContentName")
+		}
+		return snapshot
+	}
+	content := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "snapshot.storage.k8s.io/v1",
+		"kind":       "VolumeSnapshotContent",
+		"metadata":   map[string]interface{}{"name": "content-1"},
+		"spec": map[string]interface{}{
+			"driver":           "foo.bar/baz",
+			"sourceVolumeMode": "Block",
+		},
+		"status": map[string]interface{}{
+			"snapshotHandle": "snap-1234",
+			"restoreSize":    int64(1 << 30),
+		},
+	}}
+	snapshotGroup := "snapshot.storage.k8s.io"
+	populatorGroup := "example.com"
+	blockMode := v1.PersistentVolumeBlock
+	restoreSize := resource.MustParse("2Gi")
+	tests := []struct {
+		name          string
+		snapshots     []runtime.Object
+		dataSource    *v1.TypedLocalObjectReference
+		expected      *SnapshotSourceInfo
+		expectedError bool
+		expectedEvent string
+	}{
+		{
+			name:       "ready",
+			snapshots:  []runtime.Object{newSnapshot("snapshot-1", true, "content-1"), content},
+			dataSource: &v1.TypedLocalObjectReference{APIGroup: &snapshotGroup, Kind: "VolumeSnapshot", Name: "snapshot-1"},
+			expected: &SnapshotSourceInfo{
+				Namespace:        "default",
+				Name:             "snapshot-1",
+				ContentName:      "content-1",
+				Driver:           "foo.bar/baz",
+				SnapshotHandle:   "snap-1234",
+				RestoreSize:      &restoreSize,
+				SourceVolumeMode: &blockMode,
+			},
+		},
+		{
+			name:          "not ready",
+			snapshots:     []runtime.Object{newSnapshot("snapshot-1", false, ""), content},
+			dataSource:    &v1.TypedLocalObjectReference{APIGroup: &snapshotGroup, Kind: "VolumeSnapshot", Name: "snapshot-1"},
+			expectedError: true,
+			expectedEvent: "WaitingForSnapshot",
+		},
+		{
+			name:          "missing snapshot",
+			dataSource:    &v1.TypedLocalObjectReference{APIGroup: &snapshotGroup, Kind: "VolumeSnapshot", Name: "snapshot-1"},
+			expectedError: true,
+		},
+		{
+			name:          "missing content",
+			snapshots:     []runtime.Object{newSnapshot("snapshot-1", true, "content-1")},
+			dataSource:    &v1.TypedLocalObjectReference{APIGroup: &snapshotGroup, Kind: "VolumeSnapshot", Name: "snapshot-1"},
+			expectedError: true,
+		},
+		{
+			name:       "other data source",
+			snapshots:  []runtime.Object{newSnapshot("snapshot-1", true, "content-1"), content},
+			dataSource: &v1.TypedLocalObjectReference{APIGroup: &populatorGroup, Kind: "Data", Name: "data-1"},
+		},
+		{
+			name:      "no data source",
+			snapshots: []runtime.Object{newSnapshot("snapshot-1", true, "content-1"), content},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			logger, ctx := ktesting.NewTestContext(t)
+			class := newStorageClass("class-1", "foo.bar/baz")
+			claim := newClaim("claim-1", "uid-1-1", "class-1", "foo.bar/baz", "", map[string]string{AnnBetaStorageProvisioner: "foo.bar/baz"})
+			claim.Spec.DataSource = test.dataSource
+			client := fake.NewSimpleClientset(class, claim)
+			dynamicClient := dynamicfake.NewSimpleDynamicClient(runtime.NewScheme(), test.snapshots...)
+			prov := newTestProvisioner()
+			ctrl := newTestProvisionController(logger, client, "foo.bar/baz", prov, ResolveSnapshotDataSource(true), DynamicClient(dynamicClient),
+				SupportedDataSources(schema.GroupKind{Group: populatorGroup, Kind: "Data"}))
+			recorder := record.NewFakeRecorder(10)
+			ctrl.eventRecorder = recorder
+			ctrl.classes.Add(class)
+			ctrl.claimInformer.GetStore().Add(claim)
+
+			err := ctrl.syncClaim(ctx, claim)
+			if test.expectedError {
+				if err == nil {
+					t.Fatalf("expected error, got none")
+				}
+				if len(prov.provisionCalls) != 0 {
+					t.Errorf("expected no Provision call")
+				}
+				expectedEvent := test.expectedEvent
+				if expectedEvent == "" {
+					expectedEvent = "ProvisioningFailed"
+				}
+				select {
+				case event := <-recorder.Events:
+					if !strings.Contains(event, expectedEvent) {
+						t.Errorf("expected %s event, got %q", expectedEvent, event)
+					}
+				default:
+					t.Errorf("expected %s event", expectedEvent)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			select {
+			case call := <-prov.provisionCalls:
+				if !reflect.DeepEqual(call.snapshotSource, test.expected) {
+					t.Errorf("expected snapshot source %+v, got %+v", test.expected, call.snapshotSource)
+				}
+			default:
+				t.Fatalf("expected a Provision call")
+			}
+			if test.expected == nil {
+				if actions := dynamicClient.Actions(); len(actions) != 0 {
+					t.Errorf("expected no API calls for snapshots, got %v", actions)
+				}
+			}
+		})
+	}
+}
+
+func TestSnapshotReadyRetry(t *testing.T) {
+	logger, ctx := ktesting.NewTestContext(t)
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	snapshotGroup := "snapshot.storage.k8s.io"
+	class := newStorageClass("class-1", "foo.bar/baz")
+	claim := newClaim("claim-1", "uid-1-1", "class-1", "foo.bar/baz", "", nil)
+	claim.Spec.DataSource = &v1.TypedLocalObjectReference{APIGroup: &snapshotGroup, Kind: "VolumeSnapshot", Name: "snapshot-1"}
+	snapshot := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "snapshot.storage.k8s.io/v1",
+		"kind":       "VolumeSnapshot",
+		"metadata":   map[string]interface{}{"name": "snapshot-1", "namespace": "default"},
+		"status":     map[string]interface{}{"readyToUse": false},
+	}}
+	content := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "snapshot.storage.k8s.io/v1",
+		"kind":       "VolumeSnapshotContent",
+		"metadata":   map[string]interface{}{"name": "content-1"},
+		"status":     map[string]interface{}{"snapshotHandle": "snap-1234"},
+	}}
+	client := fake.NewSimpleClientset(class, claim)
+	dynamicClient := dynamicfake.NewSimpleDynamicClient(runtime.NewScheme(), snapshot, content)
+	recorder := record.NewFakeRecorder(100)
+	// A single failure would give up the claim.
+	ctrl := newTestProvisionController(logger, client, "foo.bar/baz", newTestProvisioner(), LeaderElection(false),
+		ResolveSnapshotDataSource(true), DynamicClient(dynamicClient), SnapshotReadyRetryDelay(20*time.Millisecond),
+		FailedProvisionThreshold(1), WithEventRecorder(recorder))
+	runTestController(t, ctx, ctrl.ProvisionController)
+
+	snapshotGets := func() int {
+		gets := 0
+		for _, action := range dynamicClient.Actions() {
+			if action.GetVerb() == "get" && action.GetResource().Resource == "volumesnapshots" {
+				gets++
+			}
+		}
+		return gets
+	}
+	err := wait.PollUntilContextTimeout(ctx, 10*time.Millisecond, 5*time.Second, true, func(context.Context) (bool, error) {
+		return snapshotGets() >= 4, nil
+	})
+	if err != nil {
+		t.Fatalf("expected the claim to be requeued while the snapshot is not ready, got %d checks", snapshotGets())
+	}
+
+	ready := snapshot.DeepCopy()
+	unstructured.SetNestedField(ready.Object, true, "status", "readyToUse")
+	unstructured.SetNestedField(ready.Object, "content-1", "status", "boundVolumeSnapshotContentName")
+	if _, err := dynamicClient.Resource(snapshotResource).Namespace("default").Update(ctx, ready, metav1.UpdateOptions{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	err = wait.PollUntilContextTimeout(ctx, 10*time.Millisecond, 5*time.Second, true, func(ctx context.Context) (bool, error) {
+		_, err := client.CoreV1().PersistentVolumes().Get(ctx, "pvc-uid-1-1", metav1.GetOptions{})
+		return err == nil, nil
+	})
+	if err != nil {
+		t.Fatalf("volume was not provisioned after the snapshot became ready")
+	}
+	if failures := testutil.CollectAndCount(ctrl.metrics.PersistentVolumeClaimProvisionFailedTotal); failures != 0 {
+		t.Errorf("expected no failures, got %d", failures)
+	}
+	waits := 0
+	for len(recorder.Events) > 0 {
+		if event := <-recorder.Events; strings.Contains(event, "WaitingForSnapshot") {
+			waits++
+		}
+	}
+	if waits != 1 {
+		t.Errorf("expected a single WaitingForSnapshot event, got %d", waits)
+	}
+}
+
+func TestSnapshotReadyRetryDelayValidation(t *testing.T) {
+	ctrl := &ProvisionController{hasRunLock: &sync.Mutex{}}
+	if err := SnapshotReadyRetryDelay(0)(ctrl); err == nil {
+		t.Errorf("expected error, got none")
+	}
+}
+
+func TestResolveSnapshotDataSourceValidation(t *testing.T) {
+	ctrl := &ProvisionController{hasRunLock: &sync.Mutex{}, metricsSubsystem: controllerSubsystem}
+	if err := ResolveSnapshotDataSource(true)(ctrl); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := ctrl.validateOptions(); err == nil || !strings.Contains(err.Error(), "DynamicClient") {
+		t.Errorf("expected error about DynamicClient, got %v", err)
+	}
+}
+
+func TestCloneSource(t *testing.T) {
+	blockMode := v1.PersistentVolumeBlock
+	otherNamespace := "other"
+	newSource := func(class string, bound bool) *v1.PersistentVolumeClaim {
+		source := newClaim("source", "uid-source", class, "foo.bar/baz", "", nil)
+		if bound {
+			source.Spec.VolumeName = "source-volume"
+			source.Status.Phase = v1.ClaimBound
+		}
+		return source
+	}
+	newSourceVolume := func(size string, mode *v1.PersistentVolumeMode) *v1.PersistentVolume {
+		volume := newVolume("source-volume", v1.VolumeBound, v1.PersistentVolumeReclaimDelete, map[string]string{AnnDynamicallyProvisioned: "foo.bar/baz"}, nil, nil)
+		volume.Spec.Capacity[v1.ResourceStorage] = resource.MustParse(size)
+		volume.Spec.VolumeMode = mode
+		volume.Spec.PersistentVolumeSource = v1.PersistentVolumeSource{CSI: &v1.CSIPersistentVolumeSource{
+			Driver:           "foo.bar/baz",
+			VolumeHandle:     "vol-1234",
+			VolumeAttributes: map[string]string{"pool": "a"},
+		}}
+		return volume
+	}
+	tests := []struct {
+		name           string
+		notSupported   bool
+		source         *v1.PersistentVolumeClaim
+		sourceVolume   *v1.PersistentVolume
+		dataSourceRef  *v1.TypedObjectReference
+		expected       *CloneSourceInfo
+		expectedEvent  string
+		expectedRetry  bool
+		expectedNoCall bool
+	}{
+		{
+			name:         "valid",
+			source:       newSource("class-1", true),
+			sourceVolume: newSourceVolume("1Mi", nil),
+			expected: &CloneSourceInfo{
+				Namespace:        "default",
+				Name:             "source",
+				VolumeName:       "source-volume",
+				VolumeHandle:     "vol-1234",
+				VolumeAttributes: map[string]string{"pool": "a"},
+				Capacity:         resource.MustParse("1Mi"),
+				VolumeMode:       v1.PersistentVolumeFilesystem,
+			},
+		},
+		{
+			name:         "source of another class of the provisioner",
+			source:       newSource("class-2", true),
+			sourceVolume: newSourceVolume("1Ki", nil),
+			expected: &CloneSourceInfo{
+				Namespace:        "default",
+				Name:             "source",
+				VolumeName:       "source-volume",
+				VolumeHandle:     "vol-1234",
+				VolumeAttributes: map[string]string{"pool": "a"},
+				Capacity:         resource.MustParse("1Ki"),
+				VolumeMode:       v1.PersistentVolumeFilesystem,
+			},
+		},
+		{
+			name:           "provisioner does not support cloning",
+			notSupported:   true,
+			source:         newSource("class-1", true),
+			sourceVolume:   newSourceVolume("1Mi", nil),
+			expectedEvent:  "Warning CloneNotSupported",
+			expectedNoCall: true,
+		},
+		{
+			name:         "source in another namespace",
+			source:       newSource("class-1", true),
+			sourceVolume: newSourceVolume("1Mi", nil),
+			dataSourceRef: &v1.TypedObjectReference{
+				Kind:      "PersistentVolumeClaim",
+				Name:      "source",
+				Namespace: &otherNamespace,
+			},
+			expectedEvent:  "Warning CrossNamespaceDataSource",
+			expectedNoCall: true,
+		},
+		{
+			name:           "source not found",
+			expectedEvent:  "Warning ProvisioningFailed",
+			expectedRetry:  true,
+			expectedNoCall: true,
+		},
+		{
+			name:           "source not bound",
+			source:         newSource("class-1", false),
+			expectedEvent:  "Warning ProvisioningFailed",
+			expectedRetry:  true,
+			expectedNoCall: true,
+		},
+		{
+			name:           "source PV not found",
+			source:         newSource("class-1", true),
+			expectedEvent:  "Warning ProvisioningFailed",
+			expectedRetry:  true,
+			expectedNoCall: true,
+		},
+		{
+			name:           "source of another provisioner",
+			source:         newSource("class-other", true),
+			sourceVolume:   newSourceVolume("1Mi", nil),
+			expectedEvent:  "Warning CloneSourceClassMismatch",
+			expectedNoCall: true,
+		},
+		{
+			name:           "source larger than the claim",
+			source:         newSource("class-1", true),
+			sourceVolume:   newSourceVolume("2Mi", nil),
+			expectedEvent:  "Warning CloneSizeTooSmall",
+			expectedNoCall: true,
+		},
+		{
+			name:           "volume mode mismatch",
+			source:         newSource("class-1", true),
+			sourceVolume:   newSourceVolume("1Mi", &blockMode),
+			expectedEvent:  "Warning CloneVolumeModeMismatch",
+			expectedNoCall: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			logger, ctx := ktesting.NewTestContext(t)
+			classes := []*storage.StorageClass{
+				newStorageClass("class-1", "foo.bar/baz"),
+				newStorageClass("class-2", "foo.bar/baz"),
+				newStorageClass("class-other", "other.bar/baz"),
+			}
+			claim := newClaim("claim-1", "uid-1-1", "class-1", "foo.bar/baz", "", nil)
+			claim.Spec.DataSource = &v1.TypedLocalObjectReference{Kind: "PersistentVolumeClaim", Name: "source"}
+			claim.Spec.DataSourceRef = test.dataSourceRef
+			client := fake.NewSimpleClientset(claim)
+			var prov Provisioner = &cloneTestProvisioner{newTestProvisioner()}
+			calls := prov.(*cloneTestProvisioner).provisionCalls
+			if test.notSupported {
+				testProv := newTestProvisioner()
+				prov, calls = testProv, testProv.provisionCalls
+			}
+			ctrl := newTestProvisionController(logger, client, "foo.bar/baz", prov)
+			recorder := record.NewFakeRecorder(10)
+			ctrl.eventRecorder = recorder
+			for _, class := range classes {
+				ctrl.classes.Add(class)
+			}
+			ctrl.claimInformer.GetStore().Add(claim)
+			if test.source != nil {
+				ctrl.claimInformer.GetStore().Add(test.source)
+			}
+			if test.sourceVolume != nil {
+				ctrl.volumes.Add(test.sourceVolume)
+			}
+
+			err := ctrl.syncClaim(ctx, claim)
+			if test.expectedRetry != (err != nil) {
+				t.Errorf("expected retry %v, got error %v", test.expectedRetry, err)
+			}
+			select {
+			case call := <-calls:
+				if test.expectedNoCall {
+					t.Errorf("expected no Provision call")
+				} else if !reflect.DeepEqual(call.cloneSource, test.expected) {
+					t.Errorf("expected clone source %+v, got %+v", test.expected, call.cloneSource)
+				}
+			default:
+				if !test.expectedNoCall {
+					t.Errorf("expected a Provision call")
+				}
+			}
+			if test.expectedEvent != "" {
+				select {
+				case event := <-recorder.Events:
+					if !strings.HasPrefix(event, test.expectedEvent) {
+						t.Errorf("expected event %q, got %q", test.expectedEvent, event)
+					}
+				default:
+					t.Errorf("expected event %q", test.expectedEvent)
+				}
+			}
+		})
+	}
+}
+
+func TestCrossNamespaceDataSources(t *testing.T) {
+	snapshotGroup := "snapshot.storage.k8s.io"
+	sourceNamespace := "source"
+	newGrant := func(name, fromNamespace, toKind, toName string) *unstructured.Unstructured {
+		to := map[string]interface{}{"group": snapshotGroup, "kind": toKind}
+		if toName != "" {
+			to["name"] = toName
+		}
+		return &unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": "gateway.networking.k8s.io/v1beta1",
+			"kind":       "ReferenceGrant",
+			"metadata":   map[string]interface{}{"name": name, "namespace": sourceNamespace},
+			"spec": map[string]interface{}{
+				"from": []interface{}{map[string]interface{}{"group": "", "kind": "PersistentVolumeClaim", "namespace": fromNamespace}},
+				"to":   []interface{}{to},
+			},
+		}}
+	}
+	tests := []struct {
+		name           string
+		disabled       bool
+		grants         []runtime.Object
+		expectedCall   bool
+		expectedEvent  string
+		expectedListed bool
+	}{
+		{
+			name:           "granted for the snapshot",
+			grants:         []runtime.Object{newGrant("grant-1", "default", "VolumeSnapshot", "snapshot-1")},
+			expectedCall:   true,
+			expectedListed: true,
+		},
+		{
+			name:           "granted for all snapshots",
+			grants:         []runtime.Object{newGrant("grant-1", "default", "VolumeSnapshot", "")},
+			expectedCall:   true,
+			expectedListed: true,
+		},
+		{
+			name:           "no grant",
+			expectedEvent:  "Warning DataSourceNotGranted",
+			expectedListed: true,
+		},
+		{
+			name: "grants of other namespace, kind and name",
+			grants: []runtime.Object{
+				newGrant("grant-1", "other", "VolumeSnapshot", ""),
+				newGrant("grant-2", "default", "VolumeSnapshotContent", ""),
+				newGrant("grant-3", "default", "VolumeSnapshot", "snapshot-2"),
+			},
+			expectedEvent:  "Warning DataSourceNotGranted",
+			expectedListed: true,
+		},
+		{
+			name:          "disabled",
+			disabled:      true,
+			grants:        []runtime.Object{newGrant("grant-1", "default", "VolumeSnapshot", "")},
+			expectedEvent: "Warning CrossNamespaceDataSource",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			logger, ctx := ktesting.NewTestContext(t)
+			class := newStorageClass("class-1", "foo.bar/baz")
+			claim := newClaim("claim-1", "uid-1-1", "class-1", "foo.bar/baz", "", nil)
+			claim.Spec.DataSourceRef = &v1.TypedObjectReference{APIGroup: &snapshotGroup, Kind: "VolumeSnapshot", Name: "snapshot-1", Namespace: &sourceNamespace}
+			client := fake.NewSimpleClientset(class, claim)
+			dynamicClient := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+				map[schema.GroupVersionResource]string{referenceGrantResource: "ReferenceGrantList"}, test.grants...)
+			prov := newTestProvisioner()
+			ctrl := newTestProvisionController(logger, client, "foo.bar/baz", prov, CrossNamespaceDataSources(!test.disabled), DynamicClient(dynamicClient))
+			recorder := record.NewFakeRecorder(10)
+			ctrl.eventRecorder = recorder
+			ctrl.classes.Add(class)
+			ctrl.claimInformer.GetStore().Add(claim)
+
+			if err := ctrl.syncClaim(ctx, claim); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if called := len(prov.provisionCalls) > 0; called != test.expectedCall {
+				t.Errorf("expected Provision call %v, got %v", test.expectedCall, called)
+			}
+			if listed := len(dynamicClient.Actions()) > 0; listed != test.expectedListed {
+				t.Errorf("expected ReferenceGrants listed %v, got actions %v", test.expectedListed, dynamicClient.Actions())
+			}
+			if test.expectedEvent != "" {
+				select {
+				case event := <-recorder.Events:
+					if !strings.HasPrefix(event, test.expectedEvent) {
+						t.Errorf("expected event %q, got %q", test.expectedEvent, event)
+					}
+				default:
+					t.Errorf("expected event %q", test.expectedEvent)
+				}
+			}
+			if test.expectedCall || test.disabled {
+				return
+			}
+
+			// A resync of the denied claim does not check again, an update does.
+			dynamicClient.ClearActions()
+			if err := ctrl.syncClaim(ctx, claim); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if actions := dynamicClient.Actions(); len(actions) != 0 {
+				t.Errorf("expected no check of an unchanged claim, got actions %v", actions)
+			}
+			updated := claim.DeepCopy()
+			updated.ResourceVersion = "1"
+			ctrl.claimInformer.GetStore().Update(updated)
+			if err := ctrl.syncClaim(ctx, updated); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if actions := dynamicClient.Actions(); len(actions) != 1 {
+				t.Errorf("expected a check of the updated claim, got actions %v", actions)
+			}
+		})
+	}
+}
+
+func TestForeignDataSourceEvent(t *testing.T) {
+	logger, ctx := ktesting.NewTestContext(t)
+	class := newStorageClass("class-1", "foo.bar/baz")
+	claim := newClaim("claim-1", "uid-1-1", "class-1", "foo.bar/baz", "", nil)
+	populatorGroup := "populator.example.com"
+	claim.Spec.DataSourceRef = &v1.TypedObjectReference{APIGroup: &populatorGroup, Kind: "Backup", Name: "backup-1"}
+	client := fake.NewSimpleClientset(class, claim)
+	prov := newTestProvisioner()
+	ctrl := newTestProvisionController(logger, client, "foo.bar/baz", prov)
+	recorder := record.NewFakeRecorder(10)
+	ctrl.eventRecorder = recorder
+	ctrl.classes.Add(class)
+	ctrl.claimInformer.GetStore().Add(claim)
+
+	for i := 0; i < 3; i++ {
+		if err := ctrl.syncClaim(ctx, claim); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if len(prov.provisionCalls) != 0 {
+		t.Errorf("expected no Provision call")
+	}
+	if len(recorder.Events) != 1 {
+		t.Fatalf("expected a single event, got %d", len(recorder.Events))
+	}
+	if event := <-recorder.Events; !strings.HasPrefix(event, "Normal ForeignDataSource") {
+		t.Errorf("expected ForeignDataSource event, got %q", event)
+	}
+}
+
+func TestSupportedDataSourcesValidation(t *testing.T) {
+	ctrl := &ProvisionController{hasRunLock: &sync.Mutex{}}
+	if err := SupportedDataSources(schema.GroupKind{Group: "populator.example.com"})(ctrl); err == nil {
+		t.Errorf("expected error, got none")
+	}
+}
+
+func TestResolveDataSource(t *testing.T) {
+	snapshotGroup := "snapshot.storage.k8s.io"
+	populatorGroup := "populator.example.com"
+	otherNamespace := "other"
+	mapper := meta.NewDefaultRESTMapper([]schema.GroupVersion{{Version: "v1"}, {Group: snapshotGroup, Version: "v1"}, {Group: populatorGroup, Version: "v1alpha1"}})
+	mapper.Add(schema.GroupVersionKind{Version: "v1", Kind: "PersistentVolumeClaim"}, meta.RESTScopeNamespace)
+	mapper.Add(schema.GroupVersionKind{Group: snapshotGroup, Version: "v1", Kind: "VolumeSnapshot"}, meta.RESTScopeNamespace)
+	mapper.Add(schema.GroupVersionKind{Group: populatorGroup, Version: "v1alpha1", Kind: "Data"}, meta.RESTScopeNamespace)
+	newObject := func(apiVersion, kind, namespace string) *unstructured.Unstructured {
+		return &unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": apiVersion,
+			"kind":       kind,
+			"metadata":   map[string]interface{}{"name": "source", "namespace": namespace},
+		}}
+	}
+	grant := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "gateway.networking.k8s.io/v1beta1",
+		"kind":       "ReferenceGrant",
+		"metadata":   map[string]interface{}{"name": "grant-1", "namespace": otherNamespace},
+		"spec": map[string]interface{}{
+			"from": []interface{}{map[string]interface{}{"group": "", "kind": "PersistentVolumeClaim", "namespace": "default"}},
+			"to":   []interface{}{map[string]interface{}{"group": populatorGroup, "kind": "Data"}},
+		},
+	}}
+	objects := []runtime.Object{
+		newObject("v1", "PersistentVolumeClaim", "default"),
+		newObject(snapshotGroup+"/v1", "VolumeSnapshot", "default"),
+		newObject(populatorGroup+"/v1alpha1", "Data", "default"),
+		newObject(populatorGroup+"/v1alpha1", "Data", otherNamespace),
+	}
+	tests := []struct {
+		name              string
+		group             string
+		kind              string
+		namespace         string
+		sourceName        string
+		grants            []runtime.Object
+		disabled          bool
+		expectedAPI       string
+		expectedError     bool
+		expectedNotFound  bool
+		expectedForbidden bool
+	}{
+		{
+			name:        "claim",
+			kind:        "PersistentVolumeClaim",
+			expectedAPI: "v1",
+		},
+		{
+			name:        "snapshot",
+			group:       snapshotGroup,
+			kind:        "VolumeSnapshot",
+			expectedAPI: snapshotGroup + "/v1",
+		},
+		{
+			name:        "custom resource",
+			group:       populatorGroup,
+			kind:        "Data",
+			expectedAPI: populatorGroup + "/v1alpha1",
+		},
+		{
+			name:        "granted custom resource in another namespace",
+			group:       populatorGroup,
+			kind:        "Data",
+			namespace:   otherNamespace,
+			grants:      []runtime.Object{grant},
+			expectedAPI: populatorGroup + "/v1alpha1",
+		},
+		{
+			name:              "custom resource in another namespace without grant",
+			group:             populatorGroup,
+			kind:              "Data",
+			namespace:         otherNamespace,
+			expectedError:     true,
+			expectedForbidden: true,
+		},
+		{
+			name:              "cross namespace data sources disabled",
+			group:             populatorGroup,
+			kind:              "Data",
+			namespace:         otherNamespace,
+			grants:            []runtime.Object{grant},
+			disabled:          true,
+			expectedError:     true,
+			expectedForbidden: true,
+		},
+		{
+			name:             "missing object",
+			group:            snapshotGroup,
+			kind:             "VolumeSnapshot",
+			sourceName:       "missing",
+			expectedError:    true,
+			expectedNotFound: true,
+		},
+		{
+			name:          "unknown kind",
+			group:         populatorGroup,
+			kind:          "Unknown",
+			expectedError: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			logger, ctx := ktesting.NewTestContext(t)
+			objs := append(append([]runtime.Object{}, objects...), test.grants...)
+			dynamicClient := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+				map[schema.GroupVersionResource]string{referenceGrantResource: "ReferenceGrantList"}, objs...)
+			ctrl := newTestProvisionController(logger, fake.NewSimpleClientset(), "foo.bar/baz", newTestProvisioner(),
+				DynamicClient(dynamicClient), RESTMapper(mapper), CrossNamespaceDataSources(!test.disabled))
+			claim := newClaim("claim-1", "uid-1-1", "class-1", "foo.bar/baz", "", nil)
+			claim.Spec.DataSourceRef = &v1.TypedObjectReference{Kind: test.kind, Name: "source"}
+			if test.sourceName != "" {
+				claim.Spec.DataSourceRef.Name = test.sourceName
+			}
+			if test.group != "" {
+				claim.Spec.DataSourceRef.APIGroup = &test.group
+			}
+			if test.namespace != "" {
+				claim.Spec.DataSourceRef.Namespace = &test.namespace
+			}
+
+			obj, err := ctrl.ResolveDataSource(ctx, claim)
+			if test.expectedError {
+				if err == nil {
+					t.Fatalf("expected error, got object %v", obj)
+				}
+				if apierrs.IsNotFound(err) != test.expectedNotFound {
+					t.Errorf("expected NotFound %v, got error %v", test.expectedNotFound, err)
+				}
+				if apierrs.IsForbidden(err) != test.expectedForbidden {
+					t.Errorf("expected Forbidden %v, got error %v", test.expectedForbidden, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if obj.GetAPIVersion() != test.expectedAPI || obj.GetKind() != test.kind || obj.GetName() != "source" {
+				t.Errorf("expected %s %s source, got %v", test.expectedAPI, test.kind, obj)
+			}
+		})
+	}
+
+	t.Run("no data source", func(t *testing.T) {
+		logger, ctx := ktesting.NewTestContext(t)
+		ctrl := newTestProvisionController(logger, fake.NewSimpleClientset(), "foo.bar/baz", newTestProvisioner(),
+			DynamicClient(dynamicfake.NewSimpleDynamicClient(runtime.NewScheme())), RESTMapper(mapper))
+		obj, err := ctrl.ResolveDataSource(ctx, newClaim("claim-1", "uid-1-1", "class-1", "foo.bar/baz", "", nil))
+		if obj != nil || err != nil {
+			t.Errorf("expected no object and no error, got %v, %v", obj, err)
+		}
+	})
+}
+
+func TestValidateProvisionedVolume(t *testing.T) {
+	claim := newClaim("claim-1", "uid-1-1", "class-1", "foo.bar/baz", "", nil)
+	tests := []struct {
+		name          string
+		modify        func(volume *v1.PersistentVolume)
+		nilVolume     bool
+		expectedError string
+	}{
+		{
+			name: "valid volume",
+		},
+		{
+			name: "valid volume with claimRef",
+			modify: func(volume *v1.PersistentVolume) {
+				volume.Spec.ClaimRef = &v1.ObjectReference{Namespace: claim.Namespace, Name: claim.Name, UID: claim.UID}
+			},
+		},
+		{
+			name:          "nil volume",
+			nilVolume:     true,
+			expectedError: "persistentVolume: Required value",
+		},
+		{
+			name:          "missing name",
+			modify:        func(volume *v1.PersistentVolume) { volume.Name = "" },
+			expectedError: "metadata.name: Required value",
+		},
+		{
+			name:          "invalid name",
+			modify:        func(volume *v1.PersistentVolume) { volume.Name = "PVC_1" },
+			expectedError: `metadata.name: Invalid value: "PVC_1"`,
+		},
+		{
+			name:          "missing capacity",
+			modify:        func(volume *v1.PersistentVolume) { volume.Spec.Capacity = nil },
+			expectedError: "spec.capacity[storage]: Required value",
+		},
+		{
+			name:          "zero capacity",
+			modify:        func(volume *v1.PersistentVolume) { volume.Spec.Capacity[v1.ResourceStorage] = resource.MustParse("0") },
+			expectedError: `spec.capacity[storage]: Invalid value: "0": must be greater than zero`,
+		},
+		{
+			name:          "missing source",
+			modify:        func(volume *v1.PersistentVolume) { volume.Spec.PersistentVolumeSource = v1.PersistentVolumeSource{} },
+			expectedError: "spec.persistentVolumeSource: Required value: exactly one volume source must be set",
+		},
+		{
+			name: "two sources",
+			modify: func(volume *v1.PersistentVolume) {
+				volume.Spec.CSI = &v1.CSIPersistentVolumeSource{Driver: "foo.bar/baz", VolumeHandle: "volume-1"}
+			},
+			expectedError: "spec.persistentVolumeSource: Forbidden: exactly one volume source must be set, got nfs, csi",
+		},
+		{
+			name:          "missing access modes",
+			modify:        func(volume *v1.PersistentVolume) { volume.Spec.AccessModes = nil },
+			expectedError: "spec.accessModes: Required value",
+		},
+		{
+			name: "invalid access mode",
+			modify: func(volume *v1.PersistentVolume) {
+				volume.Spec.AccessModes = append(volume.Spec.AccessModes, "ReadWriteSometimes")
+			},
+			expectedError: `spec.accessModes[2]: Unsupported value: "ReadWriteSometimes"`,
+		},
+		{
+			name: "claimRef of another claim",
+			modify: func(volume *v1.PersistentVolume) {
+				volume.Spec.ClaimRef = &v1.ObjectReference{Namespace: claim.Namespace, Name: "claim-2"}
+			},
+			expectedError: `spec.claimRef: Invalid value: "default/claim-2": must refer to claim default/claim-1`,
+		},
+		{
+			name: "claimRef with another UID",
+			modify: func(volume *v1.PersistentVolume) {
+				volume.Spec.ClaimRef = &v1.ObjectReference{Namespace: claim.Namespace, Name: claim.Name, UID: "uid-1-2"}
+			},
+			expectedError: `spec.claimRef.uid: Invalid value: "uid-1-2"`,
+		},
+		{
+			name: "several violations",
+			modify: func(volume *v1.PersistentVolume) {
+				volume.Spec.Capacity = nil
+				volume.Spec.AccessModes = nil
+			},
+			expectedError: "[spec.capacity[storage]: Required value, spec.accessModes: Required value]",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			volume := &v1.PersistentVolume{
+				ObjectMeta: metav1.ObjectMeta{Name: "pvc-uid-1-1"},
+				Spec: v1.PersistentVolumeSpec{
+					AccessModes:            claim.Spec.AccessModes,
+					Capacity:               v1.ResourceList{v1.ResourceStorage: resource.MustParse("1Mi")},
+					PersistentVolumeSource: v1.PersistentVolumeSource{NFS: &v1.NFSVolumeSource{Server: "foo", Path: "bar"}},
+				},
+			}
+			if test.modify != nil {
+				test.modify(volume)
+			}
+			if test.nilVolume {
+				volume = nil
+			}
+			err := ValidateProvisionedVolume(volume, claim)
+			if test.expectedError == "" {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), test.expectedError) {
+				t.Errorf("expected error containing %q, got %v", test.expectedError, err)
+			}
+		})
+	}
+}
+
+func TestInvalidProvisionedVolume(t *testing.T) {
+	tests := []struct {
+		name            string
+		policy          PVSaveFailurePolicy
+		deleteErr       error
+		expectedDeletes int
+		expectedEvents  []string
+	}{
+		{
+			name:            "volume deleted",
+			policy:          PVSaveFailureDeleteBackendVolume,
+			expectedDeletes: 1,
+			expectedEvents: []string{
+				"Warning ProvisioningFailed Provisioner foo.bar/baz returned an invalid PersistentVolume: spec.capacity[storage]: Required value. Deleting the volume.",
+			},
+		},
+		{
+			name:            "volume not deleted",
+			policy:          PVSaveFailureDeleteBackendVolume,
+			deleteErr:       errors.New("fake error"),
+			expectedDeletes: 1,
+			expectedEvents: []string{
+				"Warning ProvisioningFailed Provisioner foo.bar/baz returned an invalid PersistentVolume: spec.capacity[storage]: Required value. Deleting the volume.",
+				"Warning ProvisioningCleanupFailed Error cleaning provisioned volume pvc-uid-1-1 for claim default/claim-1: fake error. Please delete manually.",
+			},
+		},
+		{
+			name:   "volume retained",
+			policy: PVSaveFailureRetain,
+			expectedEvents: []string{
+				"Warning ProvisioningFailed Provisioner foo.bar/baz returned an invalid PersistentVolume: spec.capacity[storage]: Required value. Volume pvc-uid-1-1 is kept in the storage backend.",
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			logger, ctx := ktesting.NewTestContext(t)
+			class := newStorageClass("class-1", "foo.bar/baz")
+			claim := newClaim("claim-1", "uid-1-1", "class-1", "foo.bar/baz", "", nil)
+			client := fake.NewSimpleClientset(claim)
+			provisioner := &invalidVolumeProvisioner{
+				deleteCountingProvisioner: &deleteCountingProvisioner{testProvisioner: newTestProvisioner(), err: test.deleteErr},
+				modify:                    func(volume *v1.PersistentVolume) { volume.Spec.Capacity = nil },
+			}
+			recorder := record.NewFakeRecorder(10)
+			ctrl := newTestProvisionController(logger, client, "foo.bar/baz", provisioner, WithEventRecorder(recorder))
+			ctrl.pvSaveFailurePolicy = test.policy
+			ctrl.classes.Add(class)
+
+			if _, err := ctrl.provisionClaimOperation(ctx, claim); err != errStopProvision {
+				t.Errorf("expected errStopProvision, got %v", err)
+			}
+			if len(provisioner.deleted) != test.expectedDeletes {
+				t.Errorf("expected %d deletes, got %v", test.expectedDeletes, provisioner.deleted)
+			}
+			if _, err := client.CoreV1().PersistentVolumes().Get(ctx, "pvc-uid-1-1", metav1.GetOptions{}); !apierrs.IsNotFound(err) {
+				t.Errorf("expected no saved volume, got error %v", err)
+			}
+			var events []string
+			for len(recorder.Events) > 0 {
+				if event := <-recorder.Events; strings.HasPrefix(event, v1.EventTypeWarning) {
+					events = append(events, event)
+				}
+			}
+			if !reflect.DeepEqual(events, test.expectedEvents) {
+				t.Errorf("expected events %q, got %q", test.expectedEvents, events)
+			}
+		})
+	}
+}
+
+func TestVolumeDriftAudit(t *testing.T) {
+	logger, ctx := ktesting.NewTestContext(t)
+	class := newStorageClass("class-1", "foo.bar/baz")
+	claim := newClaim("claim-1", "uid-1-1", "class-1", "foo.bar/baz", "", nil)
+	client := fake.NewSimpleClientset(claim)
+	recorder := record.NewFakeRecorder(10)
+	ctrl := newTestProvisionController(logger, client, "foo.bar/baz", newTestProvisioner(), WithEventRecorder(recorder), VolumeDriftAuditInterval(time.Hour))
+	ctrl.classes.Add(class)
+
+	if _, err := ctrl.provisionClaimOperation(ctx, claim); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	volume, err := client.CoreV1().PersistentVolumes().Get(ctx, "pvc-uid-1-1", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("expected saved volume, got error %v", err)
+	}
+	if hash := volume.Annotations["foo.bar-baz"+AnnContentHashSuffix]; hash != ctrl.volumeContentHash(volume) {
+		t.Fatalf("expected content hash %q, got %q", ctrl.volumeContentHash(volume), hash)
+	}
+	for len(recorder.Events) > 0 {
+		<-recorder.Events
+	}
+
+	driftEvents := func() int {
+		count := 0
+		for len(recorder.Events) > 0 {
+			if event := <-recorder.Events; strings.HasPrefix(event, v1.EventTypeWarning+" VolumeDriftDetected") {
+				count++
+			}
+		}
+		return count
+	}
+	ctrl.auditVolumes(ctx)
+	if count := driftEvents(); count != 0 {
+		t.Errorf("expected no drift events of unmodified volume, got %d", count)
+	}
+
+	modified := volume.DeepCopy()
+	modified.Spec.ClaimRef.UID = "uid-1-2"
+	ctrl.volumes.Update(modified)
+	ctrl.auditVolumes(ctx)
+	ctrl.auditVolumes(ctx)
+	if count := driftEvents(); count != 1 {
+		t.Errorf("expected 1 drift event, got %d", count)
+	}
+	if drifted := testutil.ToFloat64(ctrl.metrics.PersistentVolumeDriftDetectedTotal.WithLabelValues("class-1")); drifted != 1 {
+		t.Errorf("expected 1 drifted volume in metrics, got %v", drifted)
+	}
+
+	// Repaired and modified again.
+	ctrl.volumes.Update(volume)
+	ctrl.auditVolumes(ctx)
+	ctrl.volumes.Update(modified)
+	ctrl.auditVolumes(ctx)
+	if count := driftEvents(); count != 1 {
+		t.Errorf("expected 1 drift event after repeated modification, got %d", count)
+	}
+}
+
+func TestVolumeDriftAuditValidation(t *testing.T) {
+	if err := VolumeDriftAuditInterval(-time.Second)(&ProvisionController{hasRunLock: &sync.Mutex{}}); err == nil {
+		t.Errorf("expected error for negative interval, got none")
+	}
+	ctrl := &ProvisionController{hasRunLock: &sync.Mutex{}, metricsSubsystem: controllerSubsystem}
+	for _, option := range []func(*ProvisionController) error{VolumeDriftAuditInterval(time.Hour), DeletionDisabled(true)} {
+		if err := option(ctrl); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if err := ctrl.validateOptions(); err == nil || !strings.Contains(err.Error(), "VolumeDriftAuditInterval") {
+		t.Errorf("expected error about VolumeDriftAuditInterval, got %v", err)
+	}
+}
+
+func TestConfigValidate(t *testing.T) {
+	tests := []struct {
+		name           string
+		cfg            Config
+		expectedErrors []string
+	}{
+		{
+			name: "zero config",
+		},
+		{
+			name: "valid config",
+			cfg: Config{
+				Threadiness:              2,
+				FailedProvisionThreshold: ptr.To(0),
+				LeaderElection:           ptr.To(false),
+				MetricsPort:              8080,
+				EnableDebugEndpoints:     true,
+			},
+		},
+		{
+			name: "invalid values",
+			cfg: Config{
+				Threadiness:            -1,
+				ShutdownGracePeriod:    ptr.To(-time.Second),
+				EventAggregationWindow: time.Millisecond,
+			},
+			expectedErrors: []string{"invalid Threadiness", "invalid ShutdownGracePeriod", "invalid EventAggregationWindow"},
+		},
+		{
+			name: "contradictions",
+			cfg: Config{
+				DeletionDisabled:      true,
+				FailedDeleteThreshold: ptr.To(3),
+				MetricsServer:         ptr.To(false),
+				MetricsCertFile:       "tls.crt",
+				EnableProfiling:       true,
+			},
+			expectedErrors: []string{
+				"FailedDeleteThreshold cannot be used together with DeletionDisabled",
+				"MetricsCertFile, MetricsKeyFile and MetricsClientCAFile cannot be used together with MetricsServer(false)",
+				"EnableProfiling requires the built-in metrics server",
+			},
+		},
+		{
+			name: "provisioning disabled",
+			cfg: Config{
+				ProvisioningDisabled:     true,
+				FailedProvisionThreshold: ptr.To(3),
+			},
+			expectedErrors: []string{"FailedProvisionThreshold cannot be used together with ProvisioningDisabled"},
+		},
+		{
+			name: "fields without their option",
+			cfg: Config{
+				AvoidedNodeTaints:      []v1.Taint{{Key: "maintenance", Effect: v1.TaintEffectNoSchedule}},
+				StorageCapacityClasses: []string{"class-1"},
+				KeptAnnotations:        []string{"example.com/keep"},
+				DefaultFSType:          "ext4",
+			},
+			expectedErrors: []string{
+				"AvoidedNodeTaints requires AvoidUnschedulableNodes",
+				"StorageCapacityClasses requires UseStorageCapacityTracking",
+				"KeptAnnotations requires CachedAnnotationSizeLimit",
+				"DefaultFSType requires AllowedFSTypes",
+			},
+		},
+		{
+			name: "invalid values and contradictions",
+			cfg: Config{
+				CreateProvisionedPVRetryCount: 3,
+				CreateProvisionedPVLimiter:    workqueue.DefaultControllerRateLimiter(),
+				ResolveSnapshotDataSource:     true,
+				MetricsSubsystem:              ptr.To("invalid-subsystem"),
+			},
+			expectedErrors: []string{
+				"CreateProvisionedPVLimiter cannot be used together with CreateProvisionedPVRetryCount",
+				"ResolveSnapshotDataSource requires DynamicClient",
+				"invalid MetricsSubsystem",
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := test.cfg.Validate()
+			if len(test.expectedErrors) == 0 {
+				if err != nil {
+					t.Errorf("expected no error, got %v", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("expected errors %q, got none", test.expectedErrors)
+			}
+			for _, expected := range test.expectedErrors {
+				if !strings.Contains(err.Error(), expected) {
+					t.Errorf("expected error %q in %q", expected, err)
+				}
+			}
+			if lines := strings.Count(err.Error(), "\n") + 1; lines != len(test.expectedErrors) {
+				t.Errorf("expected %d errors, got %d: %q", len(test.expectedErrors), lines, err)
+			}
+		})
+	}
+}
+
+func TestNewProvisionControllerWithConfig(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	m := metrics.New(newTestMetricsSubsystem())
+	ctrl, err := NewProvisionControllerWithConfig(client, "foo.bar/baz", newTestProvisioner(), Config{
+		MetricsInstance:          &m,
+		ProvisionThreadiness:     2,
+		FailedProvisionThreshold: ptr.To(0),
+		LeaderElection:           ptr.To(false),
+		ClaimResyncPeriod:        ptr.To(time.Duration(0)),
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if ctrl.provisionThreadiness != 2 || ctrl.deletionThreadiness != DefaultThreadiness {
+		t.Errorf("expected threadiness 2/%d, got %d/%d", DefaultThreadiness, ctrl.provisionThreadiness, ctrl.deletionThreadiness)
+	}
+	if ctrl.failedProvisionThreshold != 0 || ctrl.failedDeleteThreshold != DefaultFailedDeleteThreshold {
+		t.Errorf("expected thresholds 0/%d, got %d/%d", DefaultFailedDeleteThreshold, ctrl.failedProvisionThreshold, ctrl.failedDeleteThreshold)
+	}
+	if ctrl.leaderElection || ctrl.resyncPeriod != DefaultResyncPeriod || ctrl.informerResyncPeriod(ctrl.claimResyncPeriod) != 0 {
+		t.Errorf("unexpected leader election %v, resync periods %v/%v", ctrl.leaderElection, ctrl.resyncPeriod, ctrl.informerResyncPeriod(ctrl.claimResyncPeriod))
+	}
+
+	_, err = NewProvisionControllerWithConfig(client, "foo.bar/baz", newTestProvisioner(), Config{
+		Threadiness:      -1,
+		DeletionDisabled: true,
+		VolumesInformer:  informers.NewSharedInformerFactory(client, 0).Core().V1().PersistentVolumes().Informer(),
+	})
+	if err == nil || !strings.Contains(err.Error(), "invalid Threadiness") || !strings.Contains(err.Error(), "DeletionDisabled cannot be used together with VolumesInformer") {
+		t.Errorf("expected errors about threadiness and VolumesInformer, got %v", err)
+	}
+}
+
+func TestProvisionedByAnnotation(t *testing.T) {
+	for _, key := range []string{"", "provisioned-by", "example.com/", "Example_Com/provisioned-by"} {
+		if err := ProvisionedByAnnotation(key)(&ProvisionController{hasRunLock: &sync.Mutex{}}); err == nil {
+			t.Errorf("expected error for key %q, got none", key)
+		}
+	}
+
+	logger, ctx := ktesting.NewTestContext(t)
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	const key = "example.com/provisioned-by"
+	class := newStorageClass("class-1", "foo.bar/baz")
+	claim := newClaim("claim-1", "uid-1-1", "class-1", "foo.bar/baz", "", nil)
+	defaultKeyVolume := newVolume("volume-1", v1.VolumeReleased, v1.PersistentVolumeReclaimDelete, map[string]string{AnnDynamicallyProvisioned: "foo.bar/baz"}, nil, nil)
+	overrideKeyVolume := newVolume("volume-2", v1.VolumeReleased, v1.PersistentVolumeReclaimDelete, map[string]string{key: "foo.bar/baz"}, nil, nil)
+	foreignVolume := newVolume("volume-3", v1.VolumeReleased, v1.PersistentVolumeReclaimDelete, map[string]string{key: "abc.def/ghi"}, nil, nil)
+	client := fake.NewSimpleClientset(class, claim, defaultKeyVolume, overrideKeyVolume, foreignVolume)
+	ctrl := newTestProvisionController(logger, client, "foo.bar/baz", newTestProvisioner(), LeaderElection(false), ProvisionedByAnnotation(key))
+
+	runTestController(t, ctx, ctrl.ProvisionController)
+
+	var volume *v1.PersistentVolume
+	err := wait.PollUntilContextTimeout(ctx, 10*time.Millisecond, 5*time.Second, true, func(ctx context.Context) (bool, error) {
+		var err error
+		volume, err = client.CoreV1().PersistentVolumes().Get(ctx, "pvc-uid-1-1", metav1.GetOptions{})
+		return err == nil, nil
+	})
+	if err != nil {
+		t.Fatalf("volume was not provisioned")
+	}
+	if volume.Annotations[key] != "foo.bar/baz" {
+		t.Errorf("expected annotation %s=foo.bar/baz, got %v", key, volume.Annotations)
+	}
+	if volume.Annotations[AnnDynamicallyProvisioned] != "foo.bar/baz" {
+		t.Errorf("expected annotation %s=foo.bar/baz, got %v", AnnDynamicallyProvisioned, volume.Annotations)
+	}
+
+	err = wait.PollUntilContextTimeout(ctx, 10*time.Millisecond, 5*time.Second, true, func(ctx context.Context) (bool, error) {
+		volumes, err := client.CoreV1().PersistentVolumes().List(ctx, metav1.ListOptions{})
+		if err != nil {
+			return false, err
+		}
+		return len(volumes.Items) == 2, nil
+	})
+	if err != nil {
+		t.Fatalf("released volumes were not deleted")
+	}
+	for _, name := range []string{"volume-1", "volume-2"} {
+		if _, err := client.CoreV1().PersistentVolumes().Get(ctx, name, metav1.GetOptions{}); !apierrs.IsNotFound(err) {
+			t.Errorf("expected volume %s to be deleted, got %v", name, err)
+		}
+	}
+	if _, err := client.CoreV1().PersistentVolumes().Get(ctx, "volume-3", metav1.GetOptions{}); err != nil {
+		t.Errorf("volume of another provisioner was deleted: %v", err)
+	}
+}
+
+func TestAdoptProvisionerNames(t *testing.T) {
+	for _, names := range [][]string{{""}, {"old.bar/baz", "foo.bar/baz"}} {
+		if err := AdoptProvisionerNames(names)(&ProvisionController{hasRunLock: &sync.Mutex{}, provisionerName: "foo.bar/baz"}); err == nil {
+			t.Errorf("expected error for names %q, got none", names)
+		}
+	}
+
+	logger, ctx := ktesting.NewTestContext(t)
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	class := newStorageClass("class-1", "old.bar/baz")
+	claim := newClaim("claim-1", "uid-1-1", "class-1", "old.bar/baz", "", nil)
+	released := newVolume("volume-1", v1.VolumeReleased, v1.PersistentVolumeReclaimDelete, map[string]string{AnnDynamicallyProvisioned: "old.bar/baz"}, nil, nil)
+	foreign := newVolume("volume-3", v1.VolumeReleased, v1.PersistentVolumeReclaimDelete, map[string]string{AnnDynamicallyProvisioned: "abc.def/ghi"}, nil, nil)
+	client := fake.NewSimpleClientset(class, claim, released, foreign)
+	ctrl := newTestProvisionController(logger, client, "foo.bar/baz", newTestProvisioner(), LeaderElection(false),
+		AdoptProvisionerNames([]string{"old.bar/baz"}), VolumeDriftAuditInterval(time.Hour))
+	bound := newVolume("volume-2", v1.VolumeBound, v1.PersistentVolumeReclaimDelete, map[string]string{AnnDynamicallyProvisioned: "old.bar/baz"}, nil, nil)
+	bound.Annotations[ctrl.contentHashAnnotation()] = ctrl.volumeContentHash(bound)
+	if _, err := client.CoreV1().PersistentVolumes().Create(ctx, bound, metav1.CreateOptions{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	runTestController(t, ctx, ctrl.ProvisionController)
+
+	err := wait.PollUntilContextTimeout(ctx, 10*time.Millisecond, 5*time.Second, true, func(ctx context.Context) (bool, error) {
+		_, err := client.CoreV1().PersistentVolumes().Get(ctx, "volume-1", metav1.GetOptions{})
+		return apierrs.IsNotFound(err), nil
+	})
+	if err != nil {
+		t.Errorf("volume of the previous provisioner name was not deleted")
+	}
+
+	var adopted *v1.PersistentVolume
+	err = wait.PollUntilContextTimeout(ctx, 10*time.Millisecond, 5*time.Second, true, func(ctx context.Context) (bool, error) {
+		var err error
+		adopted, err = client.CoreV1().PersistentVolumes().Get(ctx, "volume-2", metav1.GetOptions{})
+		return err == nil && adopted.Annotations[AnnDynamicallyProvisioned] == "foo.bar/baz", nil
+	})
+	if err != nil {
+		t.Fatalf("volume was not adopted: %v", adopted.Annotations)
+	}
+	if hash := adopted.Annotations[ctrl.contentHashAnnotation()]; hash != ctrl.volumeContentHash(adopted) {
+		t.Errorf("expected content hash %q of adopted volume, got %q", ctrl.volumeContentHash(adopted), hash)
+	}
+
+	var provisioned *v1.PersistentVolume
+	err = wait.PollUntilContextTimeout(ctx, 10*time.Millisecond, 5*time.Second, true, func(ctx context.Context) (bool, error) {
+		var err error
+		provisioned, err = client.CoreV1().PersistentVolumes().Get(ctx, "pvc-uid-1-1", metav1.GetOptions{})
+		return err == nil, nil
+	})
+	if err != nil {
+		t.Fatalf("volume was not provisioned")
+	}
+	if provisioner := provisioned.Annotations[AnnDynamicallyProvisioned]; provisioner != "foo.bar/baz" {
+		t.Errorf("expected provisioned volume of foo.bar/baz, got %q", provisioner)
+	}
+	savedClaim, err := client.CoreV1().PersistentVolumeClaims(claim.Namespace).Get(ctx, claim.Name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if provisioner := savedClaim.Annotations[AnnBetaStorageProvisioner]; provisioner != "old.bar/baz" {
+		t.Errorf("expected claim annotation to be left alone, got %q", provisioner)
+	}
+	if _, err := client.CoreV1().PersistentVolumes().Get(ctx, "volume-3", metav1.GetOptions{}); err != nil {
+		t.Errorf("volume of another provisioner was deleted: %v", err)
+	}
+}
+
+func TestAdoptVolumeProvisionedByAnnotation(t *testing.T) {
+	logger, ctx := ktesting.NewTestContext(t)
+	const key = "example.com/provisioned-by"
+	volume := newVolume("volume-1", v1.VolumeBound, v1.PersistentVolumeReclaimDelete, map[string]string{key: "old.bar/baz", AnnDynamicallyProvisioned: "old.bar/baz"}, nil, nil)
+	client := fake.NewSimpleClientset(volume)
+	ctrl := newTestProvisionController(logger, client, "foo.bar/baz", newTestProvisioner(), ProvisionedByAnnotation(key), AdoptProvisionerNames([]string{"old.bar/baz"}))
+
+	adopted, err := ctrl.adoptVolume(ctx, volume)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, annotation := range []string{key, AnnDynamicallyProvisioned} {
+		if provisioner := adopted.Annotations[annotation]; provisioner != "foo.bar/baz" {
+			t.Errorf("expected annotation %s=foo.bar/baz, got %v", annotation, adopted.Annotations)
+		}
+	}
+}
+
+func TestDataSourceAnnotations(t *testing.T) {
+	snapshotGroup := "snapshot.storage.k8s.io"
+	ready := map[string]interface{}{"readyToUse": true, "boundVolumeSnapshotContentName": "content-1"}
+	snapshot := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "snapshot.storage.k8s.io/v1",
+		"kind":       "VolumeSnapshot",
+		"metadata":   map[string]interface{}{"name": "snapshot-1", "namespace": "default"},
+		"status":     ready,
+	}}
+	content := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "snapshot.storage.k8s.io/v1",
+		"kind":       "VolumeSnapshotContent",
+		"metadata":   map[string]interface{}{"name": "content-1"},
+		"status":     map[string]interface{}{"snapshotHandle": "snap-1234"},
+	}}
+	source := newClaim("source", "uid-source", "class-1", "foo.bar/baz", "", nil)
+	source.Spec.VolumeName = "source-volume"
+	source.Status.Phase = v1.ClaimBound
+	sourceVolume := newVolume("source-volume", v1.VolumeBound, v1.PersistentVolumeReclaimDelete, map[string]string{AnnDynamicallyProvisioned: "foo.bar/baz"}, nil, nil)
+
+	tests := []struct {
+		name                string
+		dataSource          *v1.TypedLocalObjectReference
+		resolveSnapshots    bool
+		provisionerSet      map[string]string
+		expectedAnnotations map[string]string
+	}{
+		{
+			name:                "no data source",
+			expectedAnnotations: map[string]string{},
+		},
+		{
+			name:       "snapshot",
+			dataSource: &v1.TypedLocalObjectReference{APIGroup: &snapshotGroup, Kind: "VolumeSnapshot", Name: "snapshot-1"},
+			expectedAnnotations: map[string]string{
+				"foo.bar-baz/source-kind":      "VolumeSnapshot.snapshot.storage.k8s.io",
+				"foo.bar-baz/source-name":      "snapshot-1",
+				"foo.bar-baz/source-namespace": "default",
+			},
+		},
+		{
+			name:             "resolved snapshot",
+			dataSource:       &v1.TypedLocalObjectReference{APIGroup: &snapshotGroup, Kind: "VolumeSnapshot", Name: "snapshot-1"},
+			resolveSnapshots: true,
+			expectedAnnotations: map[string]string{
+				"foo.bar-baz/source-kind":            "VolumeSnapshot.snapshot.storage.k8s.io",
+				"foo.bar-baz/source-name":            "snapshot-1",
+				"foo.bar-baz/source-namespace":       "default",
+				"foo.bar-baz/source-snapshot-handle": "snap-1234",
+			},
+		},
+		{
+			name:       "clone",
+			dataSource: &v1.TypedLocalObjectReference{Kind: "PersistentVolumeClaim", Name: "source"},
+			expectedAnnotations: map[string]string{
+				"foo.bar-baz/source-kind":      "PersistentVolumeClaim",
+				"foo.bar-baz/source-name":      "source",
+				"foo.bar-baz/source-namespace": "default",
+			},
+		},
+		{
+			name:           "set by the provisioner",
+			dataSource:     &v1.TypedLocalObjectReference{Kind: "PersistentVolumeClaim", Name: "source"},
+			provisionerSet: map[string]string{"foo.bar-baz/source-name": "original", "foo.bar-baz/source-namespace": ""},
+			expectedAnnotations: map[string]string{
+				"foo.bar-baz/source-kind":      "PersistentVolumeClaim",
+				"foo.bar-baz/source-name":      "original",
+				"foo.bar-baz/source-namespace": "",
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			logger, ctx := ktesting.NewTestContext(t)
+			class := newStorageClass("class-1", "foo.bar/baz")
+			claim := newClaim("claim-1", "uid-1-1", "class-1", "foo.bar/baz", "", nil)
+			claim.Spec.DataSource = test.dataSource
+			client := fake.NewSimpleClientset(claim)
+			prov := &annotatingProvisioner{&cloneTestProvisioner{newTestProvisioner()}, test.provisionerSet}
+			ctrl := newTestProvisionController(logger, client, "foo.bar/baz", prov, ResolveSnapshotDataSource(test.resolveSnapshots),
+				DynamicClient(dynamicfake.NewSimpleDynamicClient(runtime.NewScheme(), snapshot, content)))
+			ctrl.classes.Add(class)
+			ctrl.claimInformer.GetStore().Add(claim)
+			ctrl.claimInformer.GetStore().Add(source)
+			ctrl.volumes.Add(sourceVolume)
+
+			if err := ctrl.syncClaim(ctx, claim); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			volume, err := client.CoreV1().PersistentVolumes().Get(ctx, "pvc-uid-1-1", metav1.GetOptions{})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			annotations := map[string]string{}
+			for key, value := range volume.Annotations {
+				if strings.HasPrefix(key, "foo.bar-baz/source-") {
+					annotations[key] = value
+				}
+			}
+			if !reflect.DeepEqual(annotations, test.expectedAnnotations) {
+				t.Errorf("expected annotations %v, got %v", test.expectedAnnotations, annotations)
+			}
+		})
+	}
+}
+
+func TestWithVolumeStore(t *testing.T) {
+	logger, ctx := ktesting.NewTestContext(t)
+	class := newStorageClass("class-1", "foo.bar/baz")
+	claim := newClaim("claim-1", "uid-1-1", "class-1", "foo.bar/baz", "", nil)
+	client := fake.NewSimpleClientset(claim)
+	store := &flakyVolumeStore{client: client, failures: 2}
+	// Not newTestProvisionController, its CreateProvisionedPVInterval
+	// conflicts with WithVolumeStore.
+	ctrl := NewProvisionController(logger, client, "foo.bar/baz", newTestProvisioner(),
+		MetricsInstance(metrics.New(newTestMetricsSubsystem())), WithVolumeStore(store))
+	recorder := record.NewFakeRecorder(10)
+	ctrl.eventRecorder = recorder
+	ctrl.classes.Add(class)
+	ctrl.claimInformer.GetStore().Add(claim)
+
+	for i := 0; i < store.failures; i++ {
+		if err := ctrl.syncClaim(ctx, claim); err == nil {
+			t.Fatalf("expected error of save %d, got none", i+1)
+		}
+	}
+	if err := ctrl.syncClaim(ctx, claim); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := client.CoreV1().PersistentVolumes().Get(ctx, "pvc-uid-1-1", metav1.GetOptions{}); err != nil {
+		t.Errorf("expected saved volume, got error %v", err)
+	}
+	if store.attempts != store.failures+1 {
+		t.Errorf("expected %d saves, got %d", store.failures+1, store.attempts)
+	}
+	if failures := testutil.ToFloat64(ctrl.metrics.PersistentVolumeSaveFailedTotal.WithLabelValues("class-1")); failures != float64(store.failures) {
+		t.Errorf("expected %d failed saves in metrics, got %v", store.failures, failures)
+	}
+	succeeded := 0
+	for len(recorder.Events) > 0 {
+		if event := <-recorder.Events; strings.HasPrefix(event, "Normal ProvisioningSucceeded") {
+			succeeded++
+		}
+	}
+	if succeeded != 1 {
+		t.Errorf("expected a single ProvisioningSucceeded event, got %d", succeeded)
+	}
+}
+
+func TestWithVolumeStoreValidation(t *testing.T) {
+	ctrl := &ProvisionController{hasRunLock: &sync.Mutex{}, metricsSubsystem: controllerSubsystem}
+	for _, option := range []func(*ProvisionController) error{
+		WithVolumeStore(&flakyVolumeStore{}),
+		CreateProvisionedPVLimiter(workqueue.DefaultControllerRateLimiter()),
+	} {
+		if err := option(ctrl); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if err := ctrl.validateOptions(); err == nil || !strings.Contains(err.Error(), "WithVolumeStore") {
+		t.Errorf("expected error about WithVolumeStore, got %v", err)
+	}
+}
+
+func TestPVWriteClient(t *testing.T) {
+	tests := []struct {
+		name    string
+		options []func(*ProvisionController) error
+	}{
+		{
+			name: "blocking store",
+		},
+		{
+			name:    "background store",
+			options: []func(*ProvisionController) error{CreateProvisionedPVLimiter(workqueue.DefaultControllerRateLimiter())},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			logger, ctx := ktesting.NewTestContext(t)
+			class := newStorageClass("class-1", "foo.bar/baz")
+			claim := newClaim("claim-1", "uid-1-1", "class-1", "foo.bar/baz", "", nil)
+			client := fake.NewSimpleClientset(claim)
+			writeClient := fake.NewSimpleClientset()
+			options := append([]func(*ProvisionController) error{
+				MetricsInstance(metrics.New(newTestMetricsSubsystem())), PVWriteClient(writeClient),
+			}, test.options...)
+			ctrl := NewProvisionController(logger, client, "foo.bar/baz", newTestProvisioner(), options...)
+			ctrl.classes.Add(class)
+			ctrl.claimInformer.GetStore().Add(claim)
+
+			if err := ctrl.syncClaim(ctx, claim); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			volume, err := writeClient.CoreV1().PersistentVolumes().Get(ctx, "pvc-uid-1-1", metav1.GetOptions{})
+			if err != nil {
+				t.Fatalf("expected volume saved by the PV write client, got error %v", err)
+			}
+			if err := ctrl.deleteVolumeOperation(ctx, volume); err != nil {
+				t.Fatalf("unexpected delete error: %v", err)
+			}
+			if _, err := writeClient.CoreV1().PersistentVolumes().Get(ctx, volume.Name, metav1.GetOptions{}); !apierrs.IsNotFound(err) {
+				t.Errorf("expected volume deleted by the PV write client, got error %v", err)
+			}
+			for _, action := range client.Actions() {
+				if action.GetResource().Resource == "persistentvolumes" && action.GetVerb() != "get" && action.GetVerb() != "list" && action.GetVerb() != "watch" {
+					t.Errorf("unexpected %s of PV with the main client", action.GetVerb())
+				}
+			}
+		})
+	}
+}
+
+func TestCreateProvisionedPVBackoff(t *testing.T) {
+	tests := []struct {
+		name            string
+		failedCreates   int
+		policy          PVSaveFailurePolicy
+		deleteErr       error
+		expectedSaved   bool
+		expectedDeletes int
+		expectedEvent   string
+	}{
+		{
+			name:          "saved after failures",
+			failedCreates: 2,
+			expectedSaved: true,
+			expectedEvent: "Normal ProvisioningSucceeded",
+		},
+		{
+			name:            "retries exhausted, delete volume",
+			failedCreates:   3,
+			policy:          PVSaveFailureDeleteBackendVolume,
+			expectedDeletes: 1,
+			expectedEvent:   "Warning ProvisioningRolledBack",
+		},
+		{
+			name:            "retries exhausted, delete ignored",
+			failedCreates:   3,
+			deleteErr:       &IgnoredError{Reason: "test"},
+			expectedDeletes: 1,
+			expectedEvent:   "Warning ProvisioningRolledBack",
+		},
+		{
+			name:            "retries exhausted, delete failed",
+			failedCreates:   3,
+			deleteErr:       errors.New("fake delete error"),
+			expectedDeletes: 3,
+			expectedEvent:   "Warning ProvisioningCleanupFailed",
+		},
+		{
+			name:          "retries exhausted, keep volume",
+			failedCreates: 3,
+			policy:        PVSaveFailureRetain,
+			expectedEvent: "Warning ProvisioningSaveFailed",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			logger, ctx := ktesting.NewTestContext(t)
+			class := newStorageClass("class-1", "foo.bar/baz")
+			claim := newClaim("claim-1", "uid-1-1", "class-1", "foo.bar/baz", "", nil)
+			client := fake.NewSimpleClientset(class, claim)
+			creates := 0
+			client.PrependReactor("create", "persistentvolumes", func(action testclient.Action) (handled bool, ret runtime.Object, err error) {
+				creates++
+				if creates <= test.failedCreates {
+					return true, nil, errors.New("fake error")
+				}
+				return false, nil, nil
+			})
+			prov := &deleteCountingProvisioner{testProvisioner: newTestProvisioner(), err: test.deleteErr}
+			recorder := record.NewFakeRecorder(10)
+			options := []func(*ProvisionController) error{
+				MetricsInstance(metrics.New(newTestMetricsSubsystem())),
+				WithEventRecorder(recorder),
+				CreateProvisionedPVBackoff(wait.Backoff{Duration: time.Millisecond, Factor: 2, Steps: 3}),
+			}
+			if test.policy != "" {
+				options = append(options, OnPVSaveFailure(test.policy))
+			}
+			ctrl := NewProvisionController(logger, client, "foo.bar/baz", prov, options...)
+			ctrl.classes.Add(class)
+			ctrl.claimInformer.GetStore().Add(claim)
+
+			_, err := ctrl.provisionClaimOperation(ctx, claim)
+			if test.expectedSaved != (err == nil) {
+				t.Errorf("expected saved %v, got error %v", test.expectedSaved, err)
+			}
+			if _, err := client.CoreV1().PersistentVolumes().Get(ctx, "pvc-uid-1-1", metav1.GetOptions{}); test.expectedSaved != (err == nil) {
+				t.Errorf("expected saved PV %v, got error %v", test.expectedSaved, err)
+			}
+			if expected := min(test.failedCreates+1, 3); creates != expected {
+				t.Errorf("expected %d creates, got %d", expected, creates)
+			}
+			if len(prov.deleted) != test.expectedDeletes {
+				t.Errorf("expected %d deletes, got %v", test.expectedDeletes, prov.deleted)
+			}
+			for _, name := range prov.deleted {
+				if name != "pvc-uid-1-1" {
+					t.Errorf("expected delete of the unsaved volume pvc-uid-1-1, got %s", name)
+				}
+			}
+			var events []string
+			for len(recorder.Events) > 0 {
+				events = append(events, <-recorder.Events)
+			}
+			if len(events) == 0 || !strings.HasPrefix(events[len(events)-1], test.expectedEvent) {
+				t.Errorf("expected last event %q, got %v", test.expectedEvent, events)
+			}
+		})
+	}
+}
+
+func TestOnPVSaveFailureValidation(t *testing.T) {
+	ctrl := &ProvisionController{hasRunLock: &sync.Mutex{}, metricsSubsystem: controllerSubsystem}
+	if err := OnPVSaveFailure("Unknown")(ctrl); err == nil {
+		t.Errorf("expected error of unknown policy, got none")
+	}
+	for _, option := range []func(*ProvisionController) error{
+		OnPVSaveFailure(PVSaveFailureRetain),
+		CreateProvisionedPVLimiter(workqueue.DefaultControllerRateLimiter()),
+	} {
+		if err := option(ctrl); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if err := ctrl.validateOptions(); err == nil || !strings.Contains(err.Error(), "OnPVSaveFailure") {
+		t.Errorf("expected error about OnPVSaveFailure, got %v", err)
+	}
+	if err := CreateProvisionedPVBackoff(wait.Backoff{Duration: time.Second})(&ProvisionController{hasRunLock: &sync.Mutex{}}); err == nil {
+		t.Errorf("expected error of backoff without steps, got none")
+	}
+}
+
+func TestUseServerSideApply(t *testing.T) {
+	fieldManager := "foo.bar/baz-provisioner"
+	// managedFields of a volume with spec.persistentVolumeReclaimPolicy and
+	// the finalizer applied by the controller.
+	ownedFields := []metav1.ManagedFieldsEntry{{
+		Manager:    fieldManager,
+		Operation:  metav1.ManagedFieldsOperationApply,
+		APIVersion: "v1",
+		FieldsType: "FieldsV1",
+		FieldsV1: &metav1.FieldsV1{Raw: []byte(`{"f:metadata":{"f:finalizers":{"v:\"` + finalizerPV +
+			`\"":{}}},"f:spec":{"f:persistentVolumeReclaimPolicy":{}}}`)},
+	}}
+
+	t.Run("create", func(t *testing.T) {
+		logger, ctx := ktesting.NewTestContext(t)
+		class := newStorageClass("class-1", "foo.bar/baz")
+		claim := newClaim("claim-1", "uid-1-1", "class-1", "foo.bar/baz", "", nil)
+		client := fake.NewSimpleClientset(claim)
+		ctrl := newTestProvisionController(logger, client, "foo.bar/baz", newTestProvisioner(), UseServerSideApply(true))
+		applier := &fakeVolumeApplier{}
+		ctrl.volumeApplier = applier
+		ctrl.classes.Add(class)
+		ctrl.claimInformer.GetStore().Add(claim)
+
+		if _, err := ctrl.provisionClaimOperation(ctx, claim); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(applier.applies) != 1 {
+			t.Fatalf("expected 1 Apply, got %d", len(applier.applies))
+		}
+		apply := applier.applies[0]
+		if apply.opts.FieldManager != fieldManager || apply.opts.Force {
+			t.Errorf("expected Apply of field manager %q without force, got %+v", fieldManager, apply.opts)
+		}
+		config := apply.config
+		if *config.Name != "pvc-uid-1-1" || *config.Kind != "PersistentVolume" || *config.APIVersion != "v1" {
+			t.Errorf("expected v1 PersistentVolume pvc-uid-1-1, got %s %s %s", *config.APIVersion, *config.Kind, *config.Name)
+		}
+		if config.Spec == nil || config.Spec.ClaimRef == nil || *config.Spec.ClaimRef.Name != "claim-1" || *config.Spec.StorageClassName != "class-1" {
+			t.Errorf("expected spec with claimRef and class, got %+v", config.Spec)
+		}
+		if config.Annotations[AnnDynamicallyProvisioned] != "foo.bar/baz" || config.Status != nil {
+			t.Errorf("expected provisioned-by annotation and no status, got %v, %+v", config.Annotations, config.Status)
+		}
+		for _, action := range client.Actions() {
+			if action.GetResource().Resource == "persistentvolumes" {
+				t.Errorf("expected no PV request of the clientset, got %v", action)
+			}
+		}
+	})
+
+	t.Run("create existing", func(t *testing.T) {
+		_, ctx := ktesting.NewTestContext(t)
+		class := newStorageClass("class-1", "foo.bar/baz")
+		claim := newClaim("claim-1", "uid-1-1", "class-1", "foo.bar/baz", "", nil)
+		volume := newProvisionedVolume(ctx, class, claim, nil)
+		for name, test := range map[string]struct {
+			modify           func(existing *v1.PersistentVolume)
+			expectedMismatch bool
+		}{
+			"equivalent": {modify: func(*v1.PersistentVolume) {}},
+			"foreign":    {modify: func(existing *v1.PersistentVolume) { existing.Spec.ClaimRef.UID = "uid-2-2" }, expectedMismatch: true},
+		} {
+			t.Run(name, func(t *testing.T) {
+				logger, ctx := ktesting.NewTestContext(t)
+				existing := volume.DeepCopy()
+				test.modify(existing)
+				ctrl := newTestProvisionController(logger, fake.NewSimpleClientset(), "foo.bar/baz", newTestProvisioner(), UseServerSideApply(true))
+				applier := &fakeVolumeApplier{volume: existing}
+				ctrl.volumeApplier = applier
+
+				err := ctrl.createVolumeWithApply(ctx, volume)
+				var mismatch *volumeMismatchError
+				if errors.As(err, &mismatch) != test.expectedMismatch || !test.expectedMismatch && err != nil {
+					t.Errorf("expected mismatch %v, got error %v", test.expectedMismatch, err)
+				}
+				if len(applier.applies) != 0 {
+					t.Errorf("expected no Apply of an existing PV, got %d", len(applier.applies))
+				}
+			})
+		}
+	})
+
+	t.Run("create conflict", func(t *testing.T) {
+		logger, ctx := ktesting.NewTestContext(t)
+		volume := newVolume("volume-1", v1.VolumeBound, v1.PersistentVolumeReclaimDelete, nil, nil, nil)
+		ctrl := newTestProvisionController(logger, fake.NewSimpleClientset(), "foo.bar/baz", newTestProvisioner(), UseServerSideApply(true))
+		applier := &fakeVolumeApplier{conflicts: 1}
+		ctrl.volumeApplier = applier
+
+		if err := ctrl.createVolumeWithApply(ctx, volume); !apierrs.IsConflict(err) {
+			t.Errorf("expected conflict, got %v", err)
+		}
+		if len(applier.applies) != 1 || applier.applies[0].opts.Force {
+			t.Errorf("expected 1 Apply without force, got %+v", applier.applies)
+		}
+	})
+
+	t.Run("finalizer removal", func(t *testing.T) {
+		logger, ctx := ktesting.NewTestContext(t)
+		volume := newVolume("volume-1", v1.VolumeReleased, v1.PersistentVolumeReclaimDelete, nil, []string{"other", finalizerPV}, nil)
+		volume.ManagedFields = ownedFields
+		ctrl := newTestProvisionController(logger, fake.NewSimpleClientset(), "foo.bar/baz", newTestProvisioner(), UseServerSideApply(true))
+		applier := &fakeVolumeApplier{volume: volume}
+		ctrl.volumeApplier = applier
+
+		if _, err := ctrl.patchPersistentVolumeWithFinalizers(ctx, volume, []string{"other"}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(applier.applies) != 1 {
+			t.Fatalf("expected 1 Apply, got %d", len(applier.applies))
+		}
+		config := applier.applies[0].config
+		if len(config.Finalizers) != 0 {
+			t.Errorf("expected no finalizers owned by the controller, got %v", config.Finalizers)
+		}
+		if config.Spec == nil || config.Spec.PersistentVolumeReclaimPolicy == nil || config.Spec.Capacity != nil {
+			t.Errorf("expected only the owned reclaim policy in spec, got %+v", config.Spec)
+		}
+	})
+
+	t.Run("finalizer not owned", func(t *testing.T) {
+		logger, ctx := ktesting.NewTestContext(t)
+		volume := newVolume("volume-1", v1.VolumeReleased, v1.PersistentVolumeReclaimDelete, nil, []string{"other", finalizerPV}, nil)
+		client := fake.NewSimpleClientset(volume)
+		ctrl := newTestProvisionController(logger, client, "foo.bar/baz", newTestProvisioner(), UseServerSideApply(true))
+		// An Apply without the finalizer does not remove it if the
+		// controller does not own it.
+		ctrl.volumeApplier = &fakeVolumeApplier{volume: volume, keepFinalizers: true}
+
+		if _, err := ctrl.patchPersistentVolumeWithFinalizers(ctx, volume, []string{"other"}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		saved, err := client.CoreV1().PersistentVolumes().Get(ctx, "volume-1", metav1.GetOptions{})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !reflect.DeepEqual(saved.Finalizers, []string{"other"}) {
+			t.Errorf("expected the finalizer to be removed by a patch, got %v", saved.Finalizers)
+		}
+	})
+
+	t.Run("conflict", func(t *testing.T) {
+		logger, ctx := ktesting.NewTestContext(t)
+		volume := newVolume("volume-1", v1.VolumeBound, v1.PersistentVolumeReclaimDelete, nil, nil, nil)
+		volume.ManagedFields = ownedFields
+		ctrl := newTestProvisionController(logger, fake.NewSimpleClientset(), "foo.bar/baz", newTestProvisioner(), UseServerSideApply(true))
+		applier := &fakeVolumeApplier{volume: volume, conflicts: 1}
+		ctrl.volumeApplier = applier
+
+		if _, err := ctrl.patchPersistentVolumeWithFinalizers(ctx, volume, []string{finalizerPV}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(applier.applies) != 2 {
+			t.Fatalf("expected 2 Applies, got %d", len(applier.applies))
+		}
+		if applier.applies[0].opts.Force || !applier.applies[1].opts.Force {
+			t.Errorf("expected only the retry to force, got %+v and %+v", applier.applies[0].opts, applier.applies[1].opts)
+		}
+		if config := applier.applies[1].config; !reflect.DeepEqual(config.Finalizers, []string{finalizerPV}) {
+			t.Errorf("expected the finalizer to be applied, got %v", config.Finalizers)
+		}
+	})
+}
+
+func TestAdoptExistingVolume(t *testing.T) {
+	_, ctx := ktesting.NewTestContext(t)
+	newISCSIVolume := func() *v1.PersistentVolume {
+		volume := newProvisionedVolume(ctx, newStorageClass("class-1", "foo.bar/baz"), newClaim("claim-1", "uid-1-1", "class-1", "foo.bar/baz", "", nil), nil)
+		volume.Spec.PersistentVolumeSource = v1.PersistentVolumeSource{ISCSI: &v1.ISCSIPersistentVolumeSource{TargetPortal: "10.0.0.1:3260", IQN: "iqn.2026-01.io.example:vol-1", Lun: 1}}
+		return volume
+	}
+	tests := []struct {
+		name           string
+		modify         func(existing *v1.PersistentVolume)
+		expectedError  string
+		expectedSource bool
+	}{
+		{
+			name:   "exact match",
+			modify: func(existing *v1.PersistentVolume) {},
+		},
+		{
+			name: "server defaulted fields",
+			modify: func(existing *v1.PersistentVolume) {
+				existing.ResourceVersion = "12"
+				existing.CreationTimestamp = metav1.Now()
+				existing.Annotations["pv.kubernetes.io/bound-by-controller"] = "yes"
+				existing.Spec.ISCSI.ISCSIInterface = "default"
+				existing.Status.Phase = v1.VolumeBound
+			},
+		},
+		{
+			name: "other claim with the same source",
+			modify: func(existing *v1.PersistentVolume) {
+				existing.Spec.ClaimRef.UID = "uid-other"
+			},
+			expectedError:  `claimRef UID "uid-other", provisioned "uid-1-1"`,
+			expectedSource: true,
+		},
+		{
+			name: "other capacity, source and annotation",
+			modify: func(existing *v1.PersistentVolume) {
+				existing.Spec.Capacity[v1.ResourceStorage] = resource.MustParse("2Mi")
+				existing.Spec.ISCSI.Lun = 2
+				existing.Annotations[AnnDynamicallyProvisioned] = "other.bar/baz"
+			},
+			expectedError: `annotation pv.kubernetes.io/provisioned-by "other.bar/baz", provisioned "foo.bar/baz"; capacity 2Mi, provisioned 1Mi; source`,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			logger, ctx := ktesting.NewTestContext(t)
+			existing := newISCSIVolume()
+			test.modify(existing)
+			client := fake.NewSimpleClientset(existing)
+
+			err := adoptExistingVolume(ctx, logger, client, newISCSIVolume())
+			if test.expectedError == "" {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+			var mismatch *volumeMismatchError
+			if !errors.As(err, &mismatch) || !strings.Contains(err.Error(), test.expectedError) {
+				t.Fatalf("expected mismatch error containing %q, got %v", test.expectedError, err)
+			}
+			if mismatch.sameSource != test.expectedSource {
+				t.Errorf("expected same source %v, got %v", test.expectedSource, mismatch.sameSource)
+			}
+		})
+	}
+}
+
+func TestBackoffStoreExistingVolume(t *testing.T) {
+	tests := []struct {
+		name            string
+		claimUID        types.UID
+		expectedError   bool
+		expectedDeletes int
+	}{
+		{
+			name: "equivalent PV is adopted",
+		},
+		{
+			name:          "PV of another claim keeps the volume",
+			claimUID:      "uid-other",
+			expectedError: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			logger, ctx := ktesting.NewTestContext(t)
+			class := newStorageClass("class-1", "foo.bar/baz")
+			claim := newClaim("claim-1", "uid-1-1", "class-1", "foo.bar/baz", "", nil)
+			existing := newProvisionedVolume(ctx, class, claim, nil)
+			if test.claimUID != "" {
+				existing.Spec.ClaimRef.UID = test.claimUID
+			}
+			client := fake.NewSimpleClientset(class, claim, existing)
+			prov := &deleteCountingProvisioner{testProvisioner: newTestProvisioner()}
+			ctrl := newTestProvisionController(logger, client, "foo.bar/baz", prov)
+
+			err := ctrl.volumeStore.StoreVolume(logger, claim, newProvisionedVolume(ctx, class, claim, nil))
+			if test.expectedError != (err != nil) {
+				t.Errorf("expected error %v, got %v", test.expectedError, err)
+			}
+			if len(prov.deleted) != test.expectedDeletes {
+				t.Errorf("expected %d deletes, got %v", test.expectedDeletes, prov.deleted)
+			}
+		})
+	}
+}
+
+func TestStorageClassLookups(t *testing.T) {
+	for _, claims := range []int{1, 12} {
+		t.Run(strconv.Itoa(claims), func(t *testing.T) {
+			logger, ctx := ktesting.NewTestContext(t)
+			ctx, cancel := context.WithCancel(ctx)
+			defer cancel()
+			objs := []runtime.Object{newStorageClass("class-1", "foo.bar/baz"), newStorageClass("class-2", "foo.bar/baz")}
+			for i := 0; i < claims; i++ {
+				class := fmt.Sprintf("class-%d", i%2+1)
+				objs = append(objs, newClaim(fmt.Sprintf("claim-%d", i), fmt.Sprintf("uid-%d", i), class, "foo.bar/baz", "", nil))
+			}
+			client := fake.NewSimpleClientset(objs...)
+			var classGets atomic.Int32
+			client.PrependReactor("get", "storageclasses", func(action testclient.Action) (bool, runtime.Object, error) {
+				classGets.Add(1)
+				return false, nil, nil
+			})
+			ctrl := newTestProvisionController(logger, client, "foo.bar/baz", newTestProvisioner(), LeaderElection(false))
+
+			// The informer is not running yet, the class must be fetched from API server.
+			class, err := ctrl.getStorageClass(ctx, "class-1")
+			if err != nil || class.Name != "class-1" {
+				t.Fatalf("expected class-1, got %v, %v", class, err)
+			}
+			if _, err := ctrl.getStorageClass(ctx, "class-missing"); err == nil {
+				t.Errorf("expected error for missing class")
+			}
+			if gets := classGets.Load(); gets != 2 {
+				t.Errorf("expected 2 GETs of StorageClasses, got %d", gets)
+			}
+			classGets.Store(0)
+
+			runTestController(t, ctx, ctrl.ProvisionController)
+
+			err = wait.PollUntilContextTimeout(ctx, 10*time.Millisecond, 5*time.Second, true, func(ctx context.Context) (bool, error) {
+				volumes, err := client.CoreV1().PersistentVolumes().List(ctx, metav1.ListOptions{})
+				return err == nil && len(volumes.Items) == claims, nil
+			})
+			if err != nil {
+				t.Fatalf("volumes were not provisioned")
+			}
+			if gets := classGets.Load(); gets != 0 {
+				t.Errorf("expected no GETs of StorageClasses, got %d", gets)
+			}
+		})
+	}
+}
+
+func TestNodeInformer(t *testing.T) {
+	logger, ctx := ktesting.NewTestContext(t)
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	class := newStorageClassWithVolumeBindingMode("class-1", "foo.bar/baz", &modeWait)
+	claim := newClaim("claim-1", "uid-1-1", "class-1", "foo.bar/baz", "", map[string]string{AnnBetaStorageProvisioner: "foo.bar/baz", AnnSelectedNode: "node-1"})
+	client := fake.NewSimpleClientset(class, claim, newNode("node-1"))
+	ctrl := newTestProvisionController(logger, client, "foo.bar/baz", newTestProvisioner(), LeaderElection(false))
+
+	// The informer is not running yet, the node must be fetched from API server.
+	node, err := ctrl.getNode(ctx, "node-1")
+	if err != nil || node.Name != "node-1" {
+		t.Fatalf("expected node-1, got %v, %v", node, err)
+	}
+	if ctrl.Nodes() == nil {
+		t.Fatalf("expected a nodes lister")
+	}
+
+	runTestController(t, ctx, ctrl.ProvisionController)
+
+	err = wait.PollUntilContextTimeout(ctx, 10*time.Millisecond, 5*time.Second, true, func(ctx context.Context) (bool, error) {
+		_, err := client.CoreV1().PersistentVolumes().Get(ctx, "pvc-uid-1-1", metav1.GetOptions{})
+		return err == nil, nil
+	})
+	if err != nil {
+		t.Fatalf("volume was not provisioned")
+	}
+	err = wait.PollUntilContextTimeout(ctx, 10*time.Millisecond, 5*time.Second, true, func(ctx context.Context) (bool, error) {
+		_, err := ctrl.Nodes().Get("node-1")
+		return err == nil, nil
+	})
+	if err != nil {
+		t.Errorf("node informer was not started")
+	}
+}
+
+func TestClaimsInformerOnly(t *testing.T) {
+	logger, ctx := ktesting.NewTestContext(t)
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	class := newStorageClass("class-1", "foo.bar/baz")
+	claim := newClaim("claim-1", "uid-1-1", "class-1", "foo.bar/baz", "", nil)
+	client := fake.NewSimpleClientset(class, claim)
+	factory := informers.NewSharedInformerFactory(client, resyncPeriod)
+	claimInformer := factory.Core().V1().PersistentVolumeClaims().Informer()
+	ctrl := newTestProvisionController(logger, client, "foo.bar/baz", newTestProvisioner(), ClaimsInformer(claimInformer), LeaderElection(false))
+
+	if ctrl.claimInformer != claimInformer || !ctrl.customClaimInformer {
+		t.Errorf("expected the supplied claims informer to be used")
+	}
+	if ctrl.customVolumeInformer || ctrl.customClassInformer {
+		t.Errorf("expected internal volumes and classes informers")
+	}
+
+	factory.Start(ctx.Done())
+	runTestController(t, ctx, ctrl.ProvisionController)
+
+	err := wait.PollUntilContextTimeout(ctx, 10*time.Millisecond, 5*time.Second, true, func(ctx context.Context) (bool, error) {
+		_, err := client.CoreV1().PersistentVolumes().Get(ctx, "pvc-uid-1-1", metav1.GetOptions{})
+		return err == nil, nil
+	})
+	if err != nil {
+		t.Fatalf("volume was not provisioned")
+	}
+	if err := ctrl.validateInformers(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestValidateInformers(t *testing.T) {
+	logger, ctx := ktesting.NewTestContext(t)
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	client := fake.NewSimpleClientset(newStorageClass("class-1", "foo.bar/baz"), newClaim("claim-1", "uid-1-1", "class-1", "foo.bar/baz", "", nil))
+	factory := informers.NewSharedInformerFactory(client, resyncPeriod)
+	// Claims informer that holds StorageClasses.
+	ctrl := newTestProvisionController(logger, client, "foo.bar/baz", newTestProvisioner(),
+		ClaimsInformer(factory.Storage().V1().StorageClasses().Informer()))
+	factory.Start(ctx.Done())
+	factory.WaitForCacheSync(ctx.Done())
+
+	if err := ctrl.validateInformers(); err == nil {
+		t.Errorf("expected error for claims informer with StorageClasses, got none")
+	}
+}
+
+func TestEventAggregation(t *testing.T) {
+	logger, ctx := ktesting.NewTestContext(t)
+	class := newStorageClass("class-1", "foo.bar/baz")
+	claim := newClaim("claim-1", "uid-1-1", "class-1", "foo.bar/baz", "", nil)
+	client := fake.NewSimpleClientset(class, claim)
+	ctrl := newTestProvisionController(logger, client, "foo.bar/baz", newBadTestProvisioner())
+	ctrl.classes.Add(class)
+
+	const failures = 50
+	for i := 0; i < failures; i++ {
+		ctrl.provisionClaimOperation(ctx, claim)
+	}
+	ctrl.eventRecorder.Event(claim, v1.EventTypeWarning, "ProvisioningFailed", "a different error")
+
+	// Events are sent asynchronously by the broadcaster.
+	var failedEvents []v1.Event
+	err := wait.PollUntilContextTimeout(ctx, 10*time.Millisecond, 5*time.Second, true, func(ctx context.Context) (bool, error) {
+		events, err := client.CoreV1().Events(claim.Namespace).List(ctx, metav1.ListOptions{})
+		if err != nil {
+			return false, err
+		}
+		failedEvents = nil
+		var count int32
+		for _, event := range events.Items {
+			if event.Reason == "ProvisioningFailed" {
+				failedEvents = append(failedEvents, event)
+				count += event.Count
+			}
+		}
+		// The burst of the spam filter limits how many of the identical
+		// events are counted.
+		return len(failedEvents) == 2 && count > 20, nil
+	})
+	if err != nil {
+		t.Fatalf("expected one aggregated and one different ProvisioningFailed event, got %+v", failedEvents)
+	}
+	for _, event := range failedEvents {
+		if event.Message == "a different error" {
+			if event.Count != 1 {
+				t.Errorf("expected count 1 of the different event, got %d", event.Count)
+			}
+		} else if event.Count <= 1 {
+			t.Errorf("expected accumulated count of the repeated event, got %d", event.Count)
+		}
+	}
+}
+
+func TestEventAggregationWindow(t *testing.T) {
+	ctrl := &ProvisionController{eventComponent: "foo.bar-baz", hasRunLock: &sync.Mutex{}}
+	if err := EventAggregationWindow(time.Millisecond)(ctrl); err != nil {
+		t.Fatalf("unexpected option error: %v", err)
+	}
+	if err := ctrl.validateOptions(); err == nil {
+		t.Errorf("expected error for a window shorter than a second, got none")
+	}
+}
+
+func TestTracing(t *testing.T) {
+	logger, ctx := ktesting.NewTestContext(t)
+	class := newStorageClass("class-1", "foo.bar/baz")
+	claim := newClaim("claim-1", "uid-1-1", "class-1", "foo.bar/baz", "", nil)
+	client := fake.NewSimpleClientset(class, claim)
+	recorder := tracetest.NewSpanRecorder()
+	provisioner := &spanCheckingProvisioner{testProvisioner: newTestProvisioner()}
+	ctrl := newTestProvisionController(logger, client, "foo.bar/baz", provisioner,
+		WithTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))))
+	ctrl.classes.Add(class)
+
+	if err := ctrl.syncClaim(ctx, claim); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	volume := newProvisionedVolume(ctx, class, claim, nil)
+	volume.Status.Phase = v1.VolumeReleased
+	if err := ctrl.syncVolume(ctx, volume); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	spans := map[string]sdktrace.ReadOnlySpan{}
+	for _, span := range recorder.Ended() {
+		spans[span.Name()] = span
+	}
+	expectedParents := map[string]string{
+		"Provision default/claim-1": "",
+		spanShouldProvision:         "Provision default/claim-1",
+		spanProvision:               "Provision default/claim-1",
+		spanSaveVolume:              "Provision default/claim-1",
+		"Delete " + volume.Name:     "",
+		spanShouldDelete:            "Delete " + volume.Name,
+		spanDelete:                  "Delete " + volume.Name,
+	}
+	for name, parent := range expectedParents {
+		span, ok := spans[name]
+		if !ok {
+			t.Errorf("expected span %q, got %v", name, recorder.Ended())
+			continue
+		}
+		if span.Status().Code != codes.Ok {
+			t.Errorf("expected span %q to succeed, got status %+v", name, span.Status())
+		}
+		if parent == "" {
+			if span.Parent().IsValid() {
+				t.Errorf("expected span %q to be a root span", name)
+			}
+		} else if parentSpan, ok := spans[parent]; ok && span.Parent().SpanID() != parentSpan.SpanContext().SpanID() {
+			t.Errorf("expected span %q to be a child of %q", name, parent)
+		}
+	}
+	if len(spans) != len(expectedParents) {
+		t.Errorf("expected %d spans, got %d", len(expectedParents), len(spans))
+	}
+	if len(provisioner.spanContexts) != 1 || !provisioner.spanContexts[0].Equal(spans[spanProvision].SpanContext()) {
+		t.Errorf("expected Provision to be called with the context of span %q", spanProvision)
+	}
+}
+
+func TestTracingKeptVolume(t *testing.T) {
+	logger, ctx := ktesting.NewTestContext(t)
+	class := newStorageClass("class-1", "foo.bar/baz")
+	claim := newClaim("claim-1", "uid-1-1", "class-1", "foo.bar/baz", "", nil)
+	recorder := tracetest.NewSpanRecorder()
+	ctrl := newTestProvisionController(logger, fake.NewSimpleClientset(class, claim), "foo.bar/baz", newTestProvisioner(),
+		WithTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))))
+
+	volume := newProvisionedVolume(ctx, class, claim, nil)
+	volume.Status.Phase = v1.VolumeBound
+	if err := ctrl.syncVolume(ctx, volume); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if spans := recorder.Ended(); len(spans) != 0 {
+		t.Errorf("expected no spans for a volume that is not deleted, got %v", spans)
+	}
+}
+
+func TestTracerProviderNil(t *testing.T) {
+	ctrl := &ProvisionController{hasRunLock: &sync.Mutex{}}
+	if err := WithTracerProvider(nil)(ctrl); err == nil {
+		t.Errorf("expected error for nil TracerProvider, got none")
+	}
+}
+
+func TestTracingError(t *testing.T) {
+	logger, ctx := ktesting.NewTestContext(t)
+	class := newStorageClass("class-1", "foo.bar/baz")
+	claim := newClaim("claim-1", "uid-1-1", "class-1", "foo.bar/baz", "", nil)
+	recorder := tracetest.NewSpanRecorder()
+	ctrl := newTestProvisionController(logger, fake.NewSimpleClientset(class, claim), "foo.bar/baz", newBadTestProvisioner(),
+		WithTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))))
+	ctrl.classes.Add(class)
+
+	if err := ctrl.syncClaim(ctx, claim); err == nil {
+		t.Fatalf("expected error, got none")
+	}
+
+	for _, span := range recorder.Ended() {
+		switch span.Name() {
+		case "Provision default/claim-1", spanProvision:
+			if span.Status().Code != codes.Error {
+				t.Errorf("expected span %q to fail, got status %+v", span.Name(), span.Status())
+			}
+		}
+	}
+}
+
+type testMetrics struct {
+	provisioned counts
+	deleted     counts
+}
+
+type counts map[string]count
+
+type count struct {
+	success float64
+	failed  float64
+}
+
+type testProvisionController struct {
+	*ProvisionController
+	metrics *metrics.Metrics
+}
+
+func (ctrl testProvisionController) getMetrics(t *testing.T) testMetrics {
+	var tm testMetrics
+	getCounts(t, ctrl.metrics.PersistentVolumeClaimProvisionTotal, &tm.provisioned, true)
+	getCounts(t, ctrl.metrics.PersistentVolumeClaimProvisionFailedTotal, &tm.provisioned, false)
+	getCounts(t, ctrl.metrics.PersistentVolumeDeleteTotal, &tm.deleted, true)
+	getCounts(t, ctrl.metrics.PersistentVolumeDeleteFailedTotal, &tm.deleted, false)
+	return tm
+}
+
+func getCounts(t *testing.T, vec *prometheus.CounterVec, cts *counts, success bool) {
+	metricCh := make(chan prometheus.Metric)
+	go func() {
+		vec.Collect(metricCh)
+		close(metricCh)
+	}()
+	for metric := range metricCh {
+		var m dto.Metric
+		err := metric.Write(&m)
+		if err != nil {
+			t.Fatalf("unexpected error while extracting Prometheus metrics: %v", err)
+		}
+
+		// Only initialize the map if we actually have a value.
+		if *cts == nil {
+			*cts = counts{}
+		}
+
+		// We know that our counters have exactly one label.
+		count := (*cts)[*m.Label[0].Value]
+		if success {
+			count.success++
+		} else {
+			count.failed++
+		}
+		(*cts)[*m.Label[0].Value] = count
+	}
+}
+
+// newTestMetricsSubsystem returns a unique, valid prometheus subsystem
+// name so that metrics of separate test controllers do not interfere.
+func newTestMetricsSubsystem() string {
+	return "test_" + strings.ReplaceAll(string(uuid.NewUUID()), "-", "_")
+}
+
+// runTestController runs ctrl in a goroutine and, when the test finishes,
+// stops it and waits until all its goroutines are done.
+func runTestController(t testing.TB, ctx context.Context, ctrl *ProvisionController) {
+	ctx, cancel := context.WithCancel(ctx)
+	go ctrl.Run(ctx)
+	t.Cleanup(func() {
+		cancel()
+		<-ctrl.Stopped()
+	})
+}
+
+// watchUpdates counts the update notifications, e.g. resyncs, that informer
+// delivers for the object with the given name from now on. The returned
+// function waits until there were n of them. The handlers of the controller
+// get them at the same time: after two resyncs, the controller has handled at
+// least the first one, so that tests can check how it did without sleeping.
+func watchUpdates(t testing.TB, informer cache.SharedInformer, name string) func(ctx context.Context, n int32) {
+	var updates atomic.Int32
+	registration, err := informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			if object, err := meta.Accessor(newObj); err == nil && object.GetName() == name {
+				updates.Add(1)
+			}
+		},
+	})
+	if err != nil {
+		t.Fatalf("failed to watch updates of %s: %v", name, err)
+	}
+	t.Cleanup(func() { informer.RemoveEventHandler(registration) })
+	return func(ctx context.Context, n int32) {
+		t.Helper()
+		err := wait.PollUntilContextTimeout(ctx, 10*time.Millisecond, wait.ForeverTestTimeout, true, func(context.Context) (bool, error) {
+			return updates.Load() >= n, nil
+		})
+		if err != nil {
+			t.Fatalf("expected %d updates of %s, got %d", n, name, updates.Load())
+		}
+	}
+}
+
+func newTestProvisionController(
+	logger klog.Logger,
+	client kubernetes.Interface,
+	provisionerName string,
+	provisioner Provisioner,
+	options ...func(*ProvisionController) error,
 ) testProvisionController {
-	m := metrics.New(string(uuid.NewUUID()))
+	m := metrics.New(newTestMetricsSubsystem())
 	provisionerOptions := []func(*ProvisionController) error{
 		MetricsInstance(m),
 		ResyncPeriod(resyncPeriod),
@@ -1703,7 +9779,7 @@ func newTestProvisionControllerWithAdditionalNames(
 	additionalProvisionerNames []string,
 	options ...func(*ProvisionController) error,
 ) testProvisionController {
-	m := metrics.New(string(uuid.NewUUID()))
+	m := metrics.New(newTestMetricsSubsystem())
 	provisionerOptions := []func(*ProvisionController) error{
 		MetricsInstance(m),
 		ResyncPeriod(resyncPeriod),
@@ -1837,7 +9913,7 @@ func newClaim(name, claimUID, class, provisioner, volumeName string, annotations
 		},
 	}
 	if provisioner != "" {
-		claim.Annotations[annBetaStorageProvisioner] = provisioner
+		claim.Annotations[AnnBetaStorageProvisioner] = provisioner
 	}
 	// Allow overwriting of above annotations
 	for k, v := range annotations {
@@ -1921,7 +9997,7 @@ func newProvisionedVolume(ctx context.Context, storageClass *storage.StorageClas
 	volume := constructProvisionedVolumeWithoutStorageClassInfo(ctx, claim, v1.PersistentVolumeReclaimDelete)
 
 	// pv.Annotations["pv.kubernetes.io/provisioned-by"] MUST be set to name of the external provisioner. This provisioner will be used to delete the volume.
-	volume.Annotations = map[string]string{annDynamicallyProvisioned: storageClass.Provisioner}
+	volume.Annotations = map[string]string{AnnDynamicallyProvisioned: storageClass.Provisioner}
 	// pv.Spec.StorageClassName must be set to the name of the storage class requested by the claim
 	volume.Spec.StorageClassName = storageClass.Name
 	volume.ObjectMeta.Finalizers = pvFinalizers
@@ -1932,7 +10008,7 @@ func newProvisionedVolumeWithReclaimPolicy(ctx context.Context, storageClass *st
 	volume := constructProvisionedVolumeWithoutStorageClassInfo(ctx, claim, *storageClass.ReclaimPolicy)
 
 	// pv.Annotations["pv.kubernetes.io/provisioned-by"] MUST be set to name of the external provisioner. This provisioner will be used to delete the volume.
-	volume.Annotations = map[string]string{annDynamicallyProvisioned: storageClass.Provisioner}
+	volume.Annotations = map[string]string{AnnDynamicallyProvisioned: storageClass.Provisioner}
 	// pv.Spec.StorageClassName must be set to the name of the storage class requested by the claim
 	volume.Spec.StorageClassName = storageClass.Name
 	volume.ObjectMeta.Finalizers = pvFinalizers
@@ -1951,7 +10027,6 @@ func constructProvisionedVolumeWithoutStorageClassInfo(ctx context.Context, clai
 	volume, _, _ := newTestProvisioner().Provision(ctx, options)
 
 	// pv.Spec.ClaimRef MUST point to the claim that led to its creation (including the claim UID).
-	v1.AddToScheme(scheme.Scheme)
 	volume.Spec.ClaimRef, _ = ref.GetReference(scheme.Scheme, claim)
 
 	// TODO implement options.ProvisionerSelector parsing
@@ -1971,9 +10046,21 @@ func newNode(nodeName string) *v1.Node {
 	}
 }
 
+func newNodeWithLabels(nodeName string, labels map[string]string) *v1.Node {
+	node := newNode(nodeName)
+	node.Labels = labels
+	return node
+}
+
 type provisionParams struct {
 	selectedNode      *v1.Node
 	allowedTopologies []v1.TopologySelectorTerm
+	consumerPod       *v1.Pod
+	snapshotSource    *SnapshotSourceInfo
+	cloneSource       *CloneSourceInfo
+	vacName           *string
+	vacParameters     map[string]string
+	fsType            string
 }
 
 func newTestProvisioner() *testProvisioner {
@@ -2018,10 +10105,38 @@ func (p *testBlockProvisioner) SupportsBlock(ctx context.Context) bool {
 	return p.answer
 }
 
+// rwopTestProvisioner supports ReadWriteOncePod when supported is set and
+// returns PVs with accessModes, if set, instead of those of the claim.
+type rwopTestProvisioner struct {
+	*testProvisioner
+	supported   bool
+	accessModes []v1.PersistentVolumeAccessMode
+}
+
+var _ ReadWriteOncePodSupporter = &rwopTestProvisioner{}
+
+func (p *rwopTestProvisioner) SupportsReadWriteOncePod(ctx context.Context) bool {
+	return p.supported
+}
+
+func (p *rwopTestProvisioner) Provision(ctx context.Context, options ProvisionOptions) (*v1.PersistentVolume, ProvisioningState, error) {
+	volume, state, err := p.testProvisioner.Provision(ctx, options)
+	if volume != nil && p.accessModes != nil {
+		volume.Spec.AccessModes = p.accessModes
+	}
+	return volume, state, err
+}
+
 func (p *testProvisioner) Provision(ctx context.Context, options ProvisionOptions) (*v1.PersistentVolume, ProvisioningState, error) {
 	p.provisionCalls <- provisionParams{
 		selectedNode:      options.SelectedNode,
 		allowedTopologies: options.StorageClass.AllowedTopologies,
+		consumerPod:       options.ConsumerPod,
+		snapshotSource:    options.SnapshotSource,
+		cloneSource:       options.CloneSource,
+		vacName:           options.VolumeAttributesClassName,
+		vacParameters:     options.VolumeAttributesClassParameters,
+		fsType:            options.FSType,
 	}
 
 	// Sleep to simulate work done by Provision...for long enough that
@@ -2095,11 +10210,16 @@ func newRescheduleTestProvisioner() Provisioner {
 
 type rescheduleTestProvisioner struct {
 	badTestProvisioner
+	// noError makes Provision request rescheduling without failing.
+	noError bool
 }
 
 var _ Provisioner = &rescheduleTestProvisioner{}
 
 func (p *rescheduleTestProvisioner) Provision(ctx context.Context, options ProvisionOptions) (*v1.PersistentVolume, ProvisioningState, error) {
+	if p.noError {
+		return nil, ProvisioningReschedule, nil
+	}
 	return nil, ProvisioningReschedule, errors.New("fake error, reschedule")
 }
 
@@ -2199,3 +10319,547 @@ func contextFromKtesting(t *testing.T) context.Context {
 	_, ctx := ktesting.NewTestContext(t)
 	return ctx
 }
+
+// spanCheckingProvisioner records the span context passed to Provision.
+type spanCheckingProvisioner struct {
+	*testProvisioner
+	spanContexts []trace.SpanContext
+}
+
+var _ Provisioner = &spanCheckingProvisioner{}
+
+func (p *spanCheckingProvisioner) Provision(ctx context.Context, options ProvisionOptions) (*v1.PersistentVolume, ProvisioningState, error) {
+	p.spanContexts = append(p.spanContexts, trace.SpanContextFromContext(ctx))
+	return p.testProvisioner.Provision(ctx, options)
+}
+
+// claimRecordingProvisioner records PVCs passed to Provision.
+type claimRecordingProvisioner struct {
+	*testProvisioner
+	lock   sync.Mutex
+	claims []*v1.PersistentVolumeClaim
+}
+
+var _ Provisioner = &claimRecordingProvisioner{}
+
+func (p *claimRecordingProvisioner) Provision(ctx context.Context, options ProvisionOptions) (*v1.PersistentVolume, ProvisioningState, error) {
+	p.lock.Lock()
+	p.claims = append(p.claims, options.PVC)
+	p.lock.Unlock()
+	return p.testProvisioner.Provision(ctx, options)
+}
+
+// BenchmarkVolumeCache compares memory of caching full PVs with large CSI
+// attributes and caching only their metadata.
+func BenchmarkVolumeCache(b *testing.B) {
+	const volumes = 3000
+	attributes := make(map[string]string)
+	for i := 0; i < 20; i++ {
+		attributes[fmt.Sprintf("attribute-%d", i)] = strings.Repeat("x", 256)
+	}
+	pvs := make([]*v1.PersistentVolume, 0, volumes)
+	for i := 0; i < volumes; i++ {
+		pv := newVolume(fmt.Sprintf("volume-%d", i), v1.VolumeBound, v1.PersistentVolumeReclaimDelete, map[string]string{AnnDynamicallyProvisioned: "foo.bar/baz"}, nil, nil)
+		pv.Spec.PersistentVolumeSource = v1.PersistentVolumeSource{
+			CSI: &v1.CSIPersistentVolumeSource{Driver: "foo.bar/baz", VolumeHandle: pv.Name, VolumeAttributes: attributes},
+		}
+		pvs = append(pvs, pv)
+	}
+	for _, metadataOnly := range []bool{false, true} {
+		name := "full"
+		ctrl := &ProvisionController{}
+		if metadataOnly {
+			name = "metadata"
+			ctrl.volumeMetadataClient = metadatafake.NewSimpleMetadataClient(metadatafake.NewTestScheme())
+		}
+		b.Run(name, func(b *testing.B) {
+			b.ReportAllocs()
+			for n := 0; n < b.N; n++ {
+				store := cache.NewStore(cache.MetaNamespaceKeyFunc)
+				for _, pv := range pvs {
+					if err := store.Add(ctrl.cachedVolume(pv)); err != nil {
+						b.Fatal(err)
+					}
+				}
+			}
+		})
+	}
+}
+
+// volumeMetadata returns the metadata of volume as the metadata client
+// returns them.
+func volumeMetadata(volume *v1.PersistentVolume) *metav1.PartialObjectMetadata {
+	return &metav1.PartialObjectMetadata{
+		TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "PersistentVolume"},
+		ObjectMeta: *volume.ObjectMeta.DeepCopy(),
+	}
+}
+
+// countingRateLimiter is a workqueue.RateLimiter with short delays that
+// counts calls of When per item.
+type countingRateLimiter struct {
+	workqueue.RateLimiter
+	lock  sync.Mutex
+	calls map[interface{}]int
+}
+
+func newCountingRateLimiter() *countingRateLimiter {
+	return &countingRateLimiter{
+		RateLimiter: workqueue.NewItemExponentialFailureRateLimiter(time.Millisecond, time.Millisecond),
+		calls:       map[interface{}]int{},
+	}
+}
+
+func (l *countingRateLimiter) When(item interface{}) time.Duration {
+	l.lock.Lock()
+	l.calls[item]++
+	l.lock.Unlock()
+	return l.RateLimiter.When(item)
+}
+
+func (l *countingRateLimiter) whenCalls(item interface{}) int {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	return l.calls[item]
+}
+
+// retryAfterProvisioner fails all calls with a RetryableError.
+type retryAfterProvisioner struct {
+	retryAfter time.Duration
+}
+
+var _ Provisioner = &retryAfterProvisioner{}
+
+func (p *retryAfterProvisioner) Provision(ctx context.Context, options ProvisionOptions) (*v1.PersistentVolume, ProvisioningState, error) {
+	return nil, ProvisioningFinished, NewRetryableError(errors.New("backend busy"), p.retryAfter)
+}
+
+func (p *retryAfterProvisioner) Delete(ctx context.Context, volume *v1.PersistentVolume) error {
+	return NewRetryableError(errors.New("backend busy"), p.retryAfter)
+}
+
+// failingProvisioner fails provisioning while failing is set.
+type failingProvisioner struct {
+	*testProvisioner
+	failing atomic.Bool
+}
+
+func (p *failingProvisioner) Provision(ctx context.Context, options ProvisionOptions) (*v1.PersistentVolume, ProvisioningState, error) {
+	if p.failing.Load() {
+		return nil, ProvisioningFinished, errors.New("backend down")
+	}
+	return p.testProvisioner.Provision(ctx, options)
+}
+
+type metricsTestProvisioner struct {
+	*testProvisioner
+	collectors []prometheus.Collector
+}
+
+var _ MetricsProvider = &metricsTestProvisioner{}
+
+func (p *metricsTestProvisioner) Collectors() []prometheus.Collector {
+	return p.collectors
+}
+
+// warningTestProvisioner returns warnings from ProvisionExt.
+type warningTestProvisioner struct {
+	*testProvisioner
+	warnings []string
+}
+
+var _ ProvisionerExt = &warningTestProvisioner{}
+
+func (p *warningTestProvisioner) ProvisionExt(ctx context.Context, options ProvisionOptions) (*ProvisionResult, ProvisioningState, error) {
+	volume, state, err := p.testProvisioner.Provision(ctx, options)
+	if err != nil {
+		return nil, state, err
+	}
+	return &ProvisionResult{Volume: volume, Warnings: p.warnings}, state, nil
+}
+
+// nodeDeleterTestProvisioner records calls of Delete and
+// DeleteVolumeForMissingNode.
+type nodeDeleterTestProvisioner struct {
+	testProvisioner
+	missingNodeErr error
+	calls          []string
+}
+
+var _ NodeDeleter = &nodeDeleterTestProvisioner{}
+
+func (p *nodeDeleterTestProvisioner) Delete(ctx context.Context, volume *v1.PersistentVolume) error {
+	p.calls = append(p.calls, "Delete")
+	return nil
+}
+
+func (p *nodeDeleterTestProvisioner) DeleteVolumeForMissingNode(ctx context.Context, volume *v1.PersistentVolume) error {
+	p.calls = append(p.calls, "DeleteVolumeForMissingNode")
+	return p.missingNodeErr
+}
+
+type expandResult struct {
+	size string
+	err  error
+}
+
+// expandTestProvisioner returns results from ExpandVolume in order, the last
+// one is repeated.
+type expandTestProvisioner struct {
+	*testProvisioner
+	lock    sync.Mutex
+	results []expandResult
+	calls   []string
+}
+
+var _ Expander = &expandTestProvisioner{}
+
+func (p *expandTestProvisioner) ExpandVolume(ctx context.Context, pv *v1.PersistentVolume, newSize resource.Quantity) (resource.Quantity, error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.calls = append(p.calls, newSize.String())
+	result := p.results[0]
+	if len(p.results) > 1 {
+		p.results = p.results[1:]
+	}
+	if result.err != nil {
+		return resource.Quantity{}, result.err
+	}
+	return resource.MustParse(result.size), nil
+}
+
+func (p *expandTestProvisioner) expandCalls() []string {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return p.calls
+}
+
+// blockingProvisioner fails all calls once release is closed, ignoring
+// cancellation of their context.
+type blockingProvisioner struct {
+	release chan struct{}
+}
+
+var _ Provisioner = &blockingProvisioner{}
+
+func (p *blockingProvisioner) Provision(ctx context.Context, options ProvisionOptions) (*v1.PersistentVolume, ProvisioningState, error) {
+	<-p.release
+	return nil, ProvisioningFinished, errors.New("released")
+}
+
+func (p *blockingProvisioner) Delete(ctx context.Context, volume *v1.PersistentVolume) error {
+	<-p.release
+	return errors.New("released")
+}
+
+// concurrencyProvisioner records the highest number of concurrent Provision
+// and Delete calls. Calls wait until limit of them are in flight at once, so
+// that a controller that allows more calls is caught with them in flight.
+type concurrencyProvisioner struct {
+	inFlight, maxInFlight, provisions, deletions atomic.Int32
+	limit                                        int32
+	full                                         chan struct{}
+	fullOnce                                     sync.Once
+}
+
+var _ Provisioner = &concurrencyProvisioner{}
+
+func newConcurrencyProvisioner(limit int32) *concurrencyProvisioner {
+	return &concurrencyProvisioner{limit: limit, full: make(chan struct{})}
+}
+
+func (p *concurrencyProvisioner) call() {
+	n := p.inFlight.Add(1)
+	for {
+		max := p.maxInFlight.Load()
+		if n <= max || p.maxInFlight.CompareAndSwap(max, n) {
+			break
+		}
+	}
+	if n >= p.limit {
+		p.fullOnce.Do(func() { close(p.full) })
+	}
+	<-p.full
+	p.inFlight.Add(-1)
+}
+
+func (p *concurrencyProvisioner) Provision(ctx context.Context, options ProvisionOptions) (*v1.PersistentVolume, ProvisioningState, error) {
+	p.call()
+	p.provisions.Add(1)
+	return &v1.PersistentVolume{
+		ObjectMeta: metav1.ObjectMeta{Name: options.PVName},
+		Spec: v1.PersistentVolumeSpec{
+			PersistentVolumeReclaimPolicy: *options.StorageClass.ReclaimPolicy,
+			AccessModes:                   options.PVC.Spec.AccessModes,
+			Capacity:                      v1.ResourceList{v1.ResourceStorage: options.PVC.Spec.Resources.Requests[v1.ResourceStorage]},
+			PersistentVolumeSource:        v1.PersistentVolumeSource{NFS: &v1.NFSVolumeSource{Server: "foo", Path: "bar"}},
+		},
+	}, ProvisioningFinished, nil
+}
+
+func (p *concurrencyProvisioner) Delete(ctx context.Context, volume *v1.PersistentVolume) error {
+	p.call()
+	p.deletions.Add(1)
+	return nil
+}
+
+// drainingProvisioner provisions when released, or fails when its context
+// is cancelled first.
+type drainingProvisioner struct {
+	started   chan struct{}
+	release   chan struct{}
+	cancelled chan error
+}
+
+var _ Provisioner = &drainingProvisioner{}
+
+func (p *drainingProvisioner) Provision(ctx context.Context, options ProvisionOptions) (*v1.PersistentVolume, ProvisioningState, error) {
+	select {
+	case p.started <- struct{}{}:
+	default:
+	}
+	select {
+	case <-p.release:
+		return &v1.PersistentVolume{
+			ObjectMeta: metav1.ObjectMeta{Name: options.PVName},
+			Spec: v1.PersistentVolumeSpec{
+				PersistentVolumeReclaimPolicy: *options.StorageClass.ReclaimPolicy,
+				AccessModes:                   options.PVC.Spec.AccessModes,
+				Capacity:                      v1.ResourceList{v1.ResourceStorage: options.PVC.Spec.Resources.Requests[v1.ResourceStorage]},
+				PersistentVolumeSource:        v1.PersistentVolumeSource{NFS: &v1.NFSVolumeSource{Server: "foo", Path: "bar"}},
+			},
+		}, ProvisioningFinished, nil
+	case <-ctx.Done():
+		p.cancelled <- ctx.Err()
+		return nil, ProvisioningFinished, ctx.Err()
+	}
+}
+
+func (p *drainingProvisioner) Delete(ctx context.Context, volume *v1.PersistentVolume) error {
+	return nil
+}
+
+// orderingProvisioner fails while failing is set. Afterwards it records the
+// order of provisioned claims, the first call waits for gate.
+type orderingProvisioner struct {
+	failing  atomic.Bool
+	failures atomic.Int32
+	gate     chan struct{}
+
+	lock        sync.Mutex
+	order       []string
+	provisioned map[string]bool
+}
+
+var _ Provisioner = &orderingProvisioner{}
+
+func (p *orderingProvisioner) Provision(ctx context.Context, options ProvisionOptions) (*v1.PersistentVolume, ProvisioningState, error) {
+	if p.failing.Load() {
+		p.failures.Add(1)
+		return nil, ProvisioningFinished, errors.New("backend down")
+	}
+	<-p.gate
+	p.lock.Lock()
+	if !p.provisioned[options.PVC.Name] {
+		p.provisioned[options.PVC.Name] = true
+		p.order = append(p.order, options.PVC.Name)
+	}
+	p.lock.Unlock()
+	return &v1.PersistentVolume{
+		ObjectMeta: metav1.ObjectMeta{Name: options.PVName},
+		Spec: v1.PersistentVolumeSpec{
+			PersistentVolumeReclaimPolicy: *options.StorageClass.ReclaimPolicy,
+			AccessModes:                   options.PVC.Spec.AccessModes,
+			Capacity:                      v1.ResourceList{v1.ResourceStorage: options.PVC.Spec.Resources.Requests[v1.ResourceStorage]},
+			PersistentVolumeSource:        v1.PersistentVolumeSource{NFS: &v1.NFSVolumeSource{Server: "foo", Path: "bar"}},
+		},
+	}, ProvisioningFinished, nil
+}
+
+func (p *orderingProvisioner) getOrder() []string {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return append([]string(nil), p.order...)
+}
+
+func (p *orderingProvisioner) Delete(ctx context.Context, volume *v1.PersistentVolume) error {
+	return nil
+}
+
+// annTestFreeCapacity is the node annotation read by capacityTestProvisioner.
+const annTestFreeCapacity = "example.com/free-capacity"
+
+// capacityTestProvisioner is a reference CapacityChecker that compares the
+// requested size of a claim with free capacity in a node annotation.
+type capacityTestProvisioner struct {
+	*testProvisioner
+	err    error
+	checks atomic.Int32
+}
+
+var _ CapacityChecker = &capacityTestProvisioner{}
+
+func (p *capacityTestProvisioner) HasCapacity(ctx context.Context, node *v1.Node, claim *v1.PersistentVolumeClaim, class *storage.StorageClass) (bool, error) {
+	p.checks.Add(1)
+	if p.err != nil {
+		return false, p.err
+	}
+	free, err := resource.ParseQuantity(node.Annotations[annTestFreeCapacity])
+	if err != nil {
+		return false, fmt.Errorf("invalid annotation %s of node %q: %v", annTestFreeCapacity, node.Name, err)
+	}
+	requested := claim.Spec.Resources.Requests[v1.ResourceStorage]
+	return requested.Cmp(free) <= 0, nil
+}
+
+// nodeConcurrencyProvisioner records the highest number of concurrent
+// Provision calls per selected node.
+type nodeConcurrencyProvisioner struct {
+	nodes map[string]*concurrencyProvisioner
+}
+
+var _ Provisioner = &nodeConcurrencyProvisioner{}
+
+func (p *nodeConcurrencyProvisioner) Provision(ctx context.Context, options ProvisionOptions) (*v1.PersistentVolume, ProvisioningState, error) {
+	return p.nodes[options.SelectedNode.Name].Provision(ctx, options)
+}
+
+func (p *nodeConcurrencyProvisioner) Delete(ctx context.Context, volume *v1.PersistentVolume) error {
+	return errors.New("not implemented")
+}
+
+// cloneTestProvisioner is a testProvisioner that supports cloning.
+type cloneTestProvisioner struct {
+	*testProvisioner
+}
+
+var _ CloneSupporter = &cloneTestProvisioner{}
+
+func (p *cloneTestProvisioner) SupportsClone(ctx context.Context) bool {
+	return true
+}
+
+// withDataSource sets the dataSourceRef of claim to an object of group and
+// kind.
+func withDataSource(claim *v1.PersistentVolumeClaim, group, kind string) *v1.PersistentVolumeClaim {
+	claim.Spec.DataSourceRef = &v1.TypedObjectReference{Kind: kind, Name: "source"}
+	if group != "" {
+		claim.Spec.DataSourceRef.APIGroup = &group
+	}
+	return claim
+}
+
+// annotatingProvisioner sets annotations on the volumes it provisions.
+type annotatingProvisioner struct {
+	*cloneTestProvisioner
+	annotations map[string]string
+}
+
+func (p *annotatingProvisioner) Provision(ctx context.Context, options ProvisionOptions) (*v1.PersistentVolume, ProvisioningState, error) {
+	volume, state, err := p.cloneTestProvisioner.Provision(ctx, options)
+	for key, value := range p.annotations {
+		metav1.SetMetaDataAnnotation(&volume.ObjectMeta, key, value)
+	}
+	return volume, state, err
+}
+
+// flakyVolumeStore is a VolumeStore that fails the first saves.
+type flakyVolumeStore struct {
+	client   kubernetes.Interface
+	failures int
+	attempts int
+	hooks    VolumeStoreHooks
+}
+
+var _ VolumeStoreWithHooks = &flakyVolumeStore{}
+
+func (s *flakyVolumeStore) SetHooks(hooks VolumeStoreHooks) {
+	s.hooks = hooks
+}
+
+func (s *flakyVolumeStore) StoreVolume(logger klog.Logger, claim *v1.PersistentVolumeClaim, volume *v1.PersistentVolume) error {
+	s.attempts++
+	if s.attempts <= s.failures {
+		err := fmt.Errorf("save %d failed", s.attempts)
+		s.hooks.SaveFailed(claim, volume, err)
+		return err
+	}
+	if _, err := s.client.CoreV1().PersistentVolumes().Create(context.Background(), volume, metav1.CreateOptions{}); err != nil {
+		return err
+	}
+	s.hooks.Saved(claim, volume, s.attempts > 1)
+	return nil
+}
+
+func (s *flakyVolumeStore) Run(ctx context.Context, threadiness int) {
+}
+
+func (s *flakyVolumeStore) Len() int {
+	return 0
+}
+
+// deleteCountingProvisioner records the volumes given to Delete and returns
+// err.
+type deleteCountingProvisioner struct {
+	*testProvisioner
+	err     error
+	deleted []string
+}
+
+func (p *deleteCountingProvisioner) Delete(ctx context.Context, volume *v1.PersistentVolume) error {
+	p.deleted = append(p.deleted, volume.Name)
+	return p.err
+}
+
+// fakeVolumeApplier records Apply patches of volume. The first conflicts
+// Applies without force fail with a conflict.
+type fakeVolumeApplier struct {
+	volume         *v1.PersistentVolume
+	conflicts      int
+	keepFinalizers bool
+	applies        []volumeApply
+}
+
+type volumeApply struct {
+	config *corev1ac.PersistentVolumeApplyConfiguration
+	opts   metav1.ApplyOptions
+}
+
+func (a *fakeVolumeApplier) Get(ctx context.Context, name string, opts metav1.GetOptions) (*v1.PersistentVolume, error) {
+	if a.volume == nil || a.volume.Name != name {
+		return nil, apierrs.NewNotFound(v1.Resource("persistentvolumes"), name)
+	}
+	return a.volume.DeepCopy(), nil
+}
+
+func (a *fakeVolumeApplier) Apply(ctx context.Context, config *corev1ac.PersistentVolumeApplyConfiguration, opts metav1.ApplyOptions) (*v1.PersistentVolume, error) {
+	a.applies = append(a.applies, volumeApply{config, opts})
+	if !opts.Force && a.conflicts > 0 {
+		a.conflicts--
+		return nil, apierrs.NewConflict(v1.Resource("persistentvolumes"), *config.Name, errors.New("fake conflict"))
+	}
+	data, err := json.Marshal(config)
+	if err != nil {
+		return nil, err
+	}
+	volume := &v1.PersistentVolume{}
+	if err := json.Unmarshal(data, volume); err != nil {
+		return nil, err
+	}
+	if a.keepFinalizers && a.volume != nil {
+		volume.Finalizers = a.volume.Finalizers
+	}
+	return volume, nil
+}
+
+// invalidVolumeProvisioner modifies provisioned volumes to make them invalid.
+type invalidVolumeProvisioner struct {
+	*deleteCountingProvisioner
+	modify func(volume *v1.PersistentVolume)
+}
+
+func (p *invalidVolumeProvisioner) Provision(ctx context.Context, options ProvisionOptions) (*v1.PersistentVolume, ProvisioningState, error) {
+	volume, state, err := p.testProvisioner.Provision(ctx, options)
+	p.modify(volume)
+	return volume, state, err
+}
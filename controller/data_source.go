@@ -0,0 +1,99 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	v1 "k8s.io/api/core/v1"
+	apierrs "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// Suffixes of the annotations recording on a PV provisioned from a data
+// source where its data came from, prefixed by the provisioner name. The
+// controller sets them unless the provisioner already did.
+const (
+	AnnSourceKindSuffix           = "/source-kind"
+	AnnSourceNameSuffix           = "/source-name"
+	AnnSourceNamespaceSuffix      = "/source-namespace"
+	AnnSourceSnapshotHandleSuffix = "/source-snapshot-handle"
+)
+
+// setDataSourceAnnotations records the data source of the claim on the
+// volume. The snapshot handle is known only with ResolveSnapshotDataSource.
+func (ctrl *ProvisionController) setDataSourceAnnotations(volume *v1.PersistentVolume, claim *v1.PersistentVolumeClaim, snapshot *SnapshotSourceInfo) {
+	group, kind, namespace, name, found := claimDataSource(claim)
+	if !found {
+		return
+	}
+	prefix := giveUpAnnotationPrefix(ctrl.provisionerName)
+	values := map[string]string{
+		prefix + AnnSourceKindSuffix:      schema.GroupKind{Group: group, Kind: kind}.String(),
+		prefix + AnnSourceNameSuffix:      name,
+		prefix + AnnSourceNamespaceSuffix: namespace,
+	}
+	if snapshot != nil {
+		values[prefix+AnnSourceSnapshotHandleSuffix] = snapshot.SnapshotHandle
+	}
+	for key, value := range values {
+		if _, ok := volume.Annotations[key]; !ok {
+			metav1.SetMetaDataAnnotation(&volume.ObjectMeta, key, value)
+		}
+	}
+}
+
+// ResolveDataSource fetches the data source of the claim, of any kind known
+// to the RESTMapper, for the provisioner to interpret. It returns nil when
+// the claim has no data source. A data source in another namespace is
+// fetched only with CrossNamespaceDataSources and when a ReferenceGrant
+// allows it. Use apierrs.IsNotFound and apierrs.IsForbidden to tell a
+// missing data source from one the claim may not use. Requires DynamicClient
+// and RESTMapper.
+func (ctrl *ProvisionController) ResolveDataSource(ctx context.Context, claim *v1.PersistentVolumeClaim) (*unstructured.Unstructured, error) {
+	if ctrl.dynamicClient == nil || ctrl.restMapper == nil {
+		return nil, fmt.Errorf("ResolveDataSource requires DynamicClient and RESTMapper")
+	}
+	group, kind, namespace, name, found := claimDataSource(claim)
+	if !found {
+		return nil, nil
+	}
+	mapping, err := ctrl.restMapper.RESTMapping(schema.GroupKind{Group: group, Kind: kind})
+	if err != nil {
+		return nil, fmt.Errorf("failed to find resource of data source %s/%s: %w", schema.GroupKind{Group: group, Kind: kind}, name, err)
+	}
+	if _, cross := crossNamespaceDataSource(claim); cross {
+		granted := false
+		if ctrl.crossNamespaceSources {
+			if granted, err = ctrl.dataSourceGranted(ctx, claim); err != nil {
+				return nil, err
+			}
+		}
+		if !granted {
+			return nil, apierrs.NewForbidden(mapping.Resource.GroupResource(), name,
+				fmt.Errorf("claims in namespace %s may not use data sources in namespace %s", claim.Namespace, namespace))
+		}
+	}
+	obj, err := ctrl.dynamicClient.Resource(mapping.Resource).Namespace(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get data source %s %s/%s: %w", kind, namespace, name, err)
+	}
+	return obj, nil
+}
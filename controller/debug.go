@@ -0,0 +1,119 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+// pendingVolumesPath is the path of the pending volumes endpoint on the
+// metrics server.
+const pendingVolumesPath = "/debug/pending-volumes"
+
+// PendingVolumeInfo describes a provisioned volume whose PV is not saved to
+// API server yet, see PendingVolumes. It holds no part of the PV spec, so
+// that it is safe to expose.
+type PendingVolumeInfo struct {
+	// Namespace and name of the claim of the volume.
+	ClaimNamespace string `json:"claimNamespace"`
+	ClaimName      string `json:"claimName"`
+	// Name of the PV.
+	VolumeName string `json:"volumeName"`
+	// Number of failed attempts to save the PV.
+	Attempts int `json:"attempts"`
+	// Error of the last failed attempt.
+	LastError string `json:"lastError,omitempty"`
+	// When the store tries to save the PV next, nil if it does not retry.
+	NextRetry *time.Time `json:"nextRetry,omitempty"`
+}
+
+// PendingVolumeLister is a VolumeStore that can list its pending volumes.
+// The built-in stores implement it, a custom store set by WithVolumeStore
+// may implement it to be reported by PendingVolumes.
+type PendingVolumeLister interface {
+	VolumeStore
+
+	// PendingVolumes returns the volumes that are not saved yet. It is
+	// called concurrently with StoreVolume and the store's workers.
+	PendingVolumes() []PendingVolumeInfo
+}
+
+// PendingVolumes returns the provisioned volumes whose PVs are not saved to
+// API server yet, sorted by name of the PV, e.g. to find out why claims
+// stay Pending. It returns nil if the volume store does not implement
+// PendingVolumeLister.
+func (ctrl *ProvisionController) PendingVolumes() []PendingVolumeInfo {
+	lister, ok := ctrl.volumeStore.(PendingVolumeLister)
+	if !ok {
+		return nil
+	}
+	volumes := lister.PendingVolumes()
+	sort.Slice(volumes, func(i, j int) bool {
+		return volumes[i].VolumeName < volumes[j].VolumeName
+	})
+	return volumes
+}
+
+// servePendingVolumes writes PendingVolumes as a JSON array.
+func (ctrl *ProvisionController) servePendingVolumes(w http.ResponseWriter, _ *http.Request) {
+	volumes := ctrl.PendingVolumes()
+	if volumes == nil {
+		volumes = []PendingVolumeInfo{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	if err := json.NewEncoder(w).Encode(volumes); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// newPendingVolumeInfo returns info of volume with the claim from its
+// claimRef. A zero nextRetry means no retry.
+func newPendingVolumeInfo(volume *v1.PersistentVolume, attempts int, err error, nextRetry time.Time) PendingVolumeInfo {
+	info := PendingVolumeInfo{
+		VolumeName: volume.Name,
+		Attempts:   attempts,
+	}
+	if !nextRetry.IsZero() {
+		info.NextRetry = &nextRetry
+	}
+	if claimRef := volume.Spec.ClaimRef; claimRef != nil {
+		info.ClaimNamespace, info.ClaimName = claimRef.Namespace, claimRef.Name
+	}
+	if err != nil {
+		info.LastError = err.Error()
+	}
+	return info
+}
+
+// listPendingVolumes returns the values of a map volume name ->
+// PendingVolumeInfo. The values are never modified, only replaced, so each
+// of them is consistent.
+func listPendingVolumes(m *sync.Map) []PendingVolumeInfo {
+	var volumes []PendingVolumeInfo
+	m.Range(func(_, value interface{}) bool {
+		volumes = append(volumes, value.(PendingVolumeInfo))
+		return true
+	})
+	return volumes
+}
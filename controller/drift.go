@@ -0,0 +1,111 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	klog "k8s.io/klog/v2"
+)
+
+// AnnContentHashSuffix is the suffix of the annotation with the hash of the
+// fields of a PV the controller depends on, prefixed by the provisioner
+// name, see VolumeDriftAuditInterval.
+const AnnContentHashSuffix = "/content-hash"
+
+// contentHashAnnotation returns the key of the content hash annotation.
+func (ctrl *ProvisionController) contentHashAnnotation() string {
+	return giveUpAnnotationPrefix(ctrl.provisionerName) + AnnContentHashSuffix
+}
+
+// volumeSourceIdentity returns what identifies the storage asset of the
+// volume: driver and handle of a CSI volume, only the kind of other sources.
+// In-tree sources are not compared as a whole, API server defaults some of
+// their fields after the hash is computed.
+func volumeSourceIdentity(volume *v1.PersistentVolume) string {
+	if csi := volume.Spec.CSI; csi != nil {
+		return "csi/" + csi.Driver + "/" + csi.VolumeHandle
+	}
+	return strings.Join(volumeSources(&volume.Spec.PersistentVolumeSource), ",")
+}
+
+func volumeClaimUID(volume *v1.PersistentVolume) types.UID {
+	if volume.Spec.ClaimRef == nil {
+		return ""
+	}
+	return volume.Spec.ClaimRef.UID
+}
+
+// volumeContentHash returns a short hash of the provisioned-by annotation,
+// claimRef UID and source identity of the volume.
+func (ctrl *ProvisionController) volumeContentHash(volume *v1.PersistentVolume) string {
+	provisioner, _ := ctrl.provisionedBy(volume.Annotations)
+	hash := sha256.New()
+	for _, field := range []string{provisioner, string(volumeClaimUID(volume)), volumeSourceIdentity(volume)} {
+		// The length keeps the fields apart.
+		fmt.Fprintf(hash, "%d:%s;", len(field), field)
+	}
+	return hex.EncodeToString(hash.Sum(nil))[:16]
+}
+
+// auditVolumes checks the content hash of all cached PVs that have one and
+// sends a Warning event to each PV whose hash does not match, i.e. whose
+// provisioned-by annotation, claimRef or source was changed after it was
+// saved. A drifted PV is reported once until it changes again. Nothing is
+// repaired.
+func (ctrl *ProvisionController) auditVolumes(ctx context.Context) {
+	logger := klog.FromContext(ctx)
+	key := ctrl.contentHashAnnotation()
+	drifted := map[string]bool{}
+	for _, obj := range ctrl.volumes.List() {
+		volume, ok := obj.(*v1.PersistentVolume)
+		if !ok {
+			continue
+		}
+		saved, ok := volume.Annotations[key]
+		if !ok {
+			continue
+		}
+		current := ctrl.volumeContentHash(volume)
+		if current == saved {
+			continue
+		}
+		drifted[volume.Name] = true
+		if reported, found := ctrl.driftReported.Load(volume.Name); found && reported == current {
+			continue
+		}
+		ctrl.driftReported.Store(volume.Name, current)
+		provisioner, _ := ctrl.provisionedBy(volume.Annotations)
+		msg := fmt.Sprintf("PV was modified after it was provisioned, deleting it may fail or delete the wrong storage asset: provisioned-by annotation %q, claimRef UID %q, source %s",
+			provisioner, volumeClaimUID(volume), volumeSourceIdentity(volume))
+		logger.Info("Detected drift of PV", "PV", volume.Name, "savedHash", saved, "hash", current)
+		ctrl.event(volume, v1.EventTypeWarning, "VolumeDriftDetected", msg)
+		ctrl.metrics.PersistentVolumeDriftDetectedTotal.WithLabelValues(volume.Spec.StorageClassName).Inc()
+	}
+	ctrl.driftReported.Range(func(name, _ interface{}) bool {
+		if !drifted[name.(string)] {
+			ctrl.driftReported.Delete(name)
+		}
+		return true
+	})
+}
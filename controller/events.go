@@ -0,0 +1,98 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"fmt"
+	"hash/fnv"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/utils/clock"
+	"sigs.k8s.io/sig-storage-lib-external-provisioner/v10/util"
+)
+
+// eventFunc emits an event on a claim or PV, see ProvisionController.event.
+type eventFunc func(object runtime.Object, eventType, reason, message string)
+
+// event emits an event on a claim or PV. All events of the controller go
+// through here, the built-in volume stores get it as their eventFunc.
+func (ctrl *ProvisionController) event(object runtime.Object, eventType, reason, message string) {
+	ctrl.eventRecorder.Event(object, eventType, reason, message)
+}
+
+// sanitizeEventComponent returns provisionerName with characters other than
+// alphanumerics, '-', '_' and '.' replaced by '-', used as the default source
+// component of events.
+func sanitizeEventComponent(provisionerName string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_', r == '.':
+			return r
+		default:
+			return '-'
+		}
+	}, provisionerName)
+}
+
+// eventSpamKey is used by the event correlator to rate limit events. Unlike
+// the client-go default, which limits all events of an object together, it
+// keys by reason and a hash of the message, so that a flood of identical
+// failures of a claim does not suppress its other events.
+func eventSpamKey(event *v1.Event) string {
+	hash := fnv.New64a()
+	hash.Write([]byte(event.Message))
+	return strings.Join([]string{
+		event.Source.Component,
+		event.Source.Host,
+		event.InvolvedObject.Kind,
+		event.InvolvedObject.Namespace,
+		event.InvolvedObject.Name,
+		string(event.InvolvedObject.UID),
+		event.InvolvedObject.APIVersion,
+		event.Reason,
+		strconv.FormatUint(hash.Sum64(), 16),
+	}, "")
+}
+
+// provisioningSucceededMessage returns the message of the ProvisioningSucceeded
+// event of a saved volume. Users grep for it, keep the format stable. The
+// duration is taken from (and removed from) startTimes, which maps claim UIDs
+// to the start of provisioning by clock and may be nil. retried tells that
+// saving the PV to API server did not succeed on the first attempt.
+func provisioningSucceededMessage(clock clock.PassiveClock, startTimes *sync.Map, volume *v1.PersistentVolume, retried bool) string {
+	duration := "unknown"
+	if startTimes != nil && volume.Spec.ClaimRef != nil {
+		if start, ok := startTimes.LoadAndDelete(volume.Spec.ClaimRef.UID); ok {
+			duration = clock.Since(start.(time.Time)).Round(time.Millisecond).String()
+		}
+	}
+	capacity := "unknown"
+	if size, ok := volume.Spec.Capacity[v1.ResourceStorage]; ok {
+		capacity = util.FormatSize(size.Value())
+	}
+	msg := fmt.Sprintf("Successfully provisioned volume %s (StorageClass: %s, capacity: %s, duration: %s)",
+		volume.Name, util.GetPersistentVolumeClass(volume), capacity, duration)
+	if retried {
+		msg += ", saving the PV to API server was retried"
+	}
+	return msg
+}
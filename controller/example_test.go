@@ -0,0 +1,95 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes/fake"
+	klog "k8s.io/klog/v2"
+)
+
+// poolProvisioner places volumes of claims of the same namespace on
+// different backend pools. It finds the pools already in use with the
+// volumes lister of the controller.
+type poolProvisioner struct {
+	controller *ProvisionController
+	pools      []string
+}
+
+const annPool = "example.com/pool"
+
+func (p *poolProvisioner) Provision(ctx context.Context, options ProvisionOptions) (*v1.PersistentVolume, ProvisioningState, error) {
+	volumes, err := p.controller.VolumesLister()
+	if err != nil {
+		return nil, ProvisioningFinished, err
+	}
+	all, err := volumes.List(labels.Everything())
+	if err != nil {
+		return nil, ProvisioningFinished, err
+	}
+	used := map[string]bool{}
+	for _, volume := range all {
+		if ref := volume.Spec.ClaimRef; ref != nil && ref.Namespace == options.PVC.Namespace {
+			used[volume.Annotations[annPool]] = true
+		}
+	}
+	for _, pool := range p.pools {
+		if used[pool] {
+			continue
+		}
+		// Create the volume in pool...
+		return &v1.PersistentVolume{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        options.PVName,
+				Annotations: map[string]string{annPool: pool},
+			},
+			Spec: v1.PersistentVolumeSpec{
+				PersistentVolumeReclaimPolicy: *options.StorageClass.ReclaimPolicy,
+				AccessModes:                   options.PVC.Spec.AccessModes,
+				Capacity:                      v1.ResourceList{v1.ResourceStorage: options.PVC.Spec.Resources.Requests[v1.ResourceStorage]},
+				PersistentVolumeSource: v1.PersistentVolumeSource{
+					NFS: &v1.NFSVolumeSource{Server: pool, Path: "/" + options.PVName},
+				},
+			},
+		}, ProvisioningFinished, nil
+	}
+	return nil, ProvisioningFinished, fmt.Errorf("all pools are used by claims of namespace %s", options.PVC.Namespace)
+}
+
+func (p *poolProvisioner) Delete(ctx context.Context, volume *v1.PersistentVolume) error {
+	// Delete the volume from its pool...
+	return nil
+}
+
+func ExampleProvisionController_VolumesLister() {
+	logger := klog.Background()
+	client := fake.NewSimpleClientset()
+	provisioner := &poolProvisioner{pools: []string{"pool-a", "pool-b"}}
+	controller, err := NewProvisionControllerOrError(logger, client, "example.com/pools", provisioner)
+	if err != nil {
+		logger.Error(err, "Failed to create provision controller")
+		return
+	}
+	provisioner.controller = controller
+
+	go provisioner.controller.Run(context.Background())
+}
@@ -0,0 +1,168 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	klog "k8s.io/klog/v2"
+)
+
+// fileSystemResizePendingMessage is the message of the
+// FileSystemResizePending condition, the same as of the Kubernetes resizer.
+const fileSystemResizePendingMessage = "Waiting for user to (re-)start a pod to finish file system resize of volume on node."
+
+// expandClaim grows the PV of a bound claim when the claim requests more
+// than the capacity of the PV, see Expander. A non-nil error triggers
+// requeuing of the claim.
+func (ctrl *ProvisionController) expandClaim(ctx context.Context, expander Expander, claim *v1.PersistentVolumeClaim) error {
+	logger := klog.FromContext(ctx)
+	if claim.Status.Phase != v1.ClaimBound {
+		return nil
+	}
+	requested, ok := claim.Spec.Resources.Requests[v1.ResourceStorage]
+	if !ok {
+		return nil
+	}
+	if capacity, ok := claim.Status.Capacity[v1.ResourceStorage]; ok && requested.Cmp(capacity) <= 0 {
+		return nil
+	}
+
+	volume, err := ctrl.getVolume(ctx, claim.Spec.VolumeName)
+	if err != nil {
+		return fmt.Errorf("failed to get PV %s of the claim: %w", claim.Spec.VolumeName, err)
+	}
+	if claimRef := volume.Spec.ClaimRef; claimRef == nil || claimRef.UID != claim.UID {
+		return nil
+	}
+	if _, found := ctrl.provisionedBy(volume.Annotations); !found || !ctrl.isProvisionerForVolume(ctx, volume) {
+		return nil
+	}
+	capacity := volume.Spec.Capacity[v1.ResourceStorage]
+	if requested.Cmp(capacity) <= 0 {
+		if hasClaimCondition(claim, v1.PersistentVolumeClaimResizing) {
+			// The PV was expanded, but updating the claim failed.
+			return ctrl.finishExpansion(ctx, claim, volume.Name, capacity)
+		}
+		// Already expanded, the node may still be growing the file system.
+		return nil
+	}
+	class, err := ctrl.getStorageClass(ctx, volume.Spec.StorageClassName)
+	if err != nil {
+		return err
+	}
+	if class.AllowVolumeExpansion == nil || !*class.AllowVolumeExpansion {
+		logger.V(4).Info("Not expanding volume, StorageClass does not allow volume expansion", "PV", volume.Name, "class", class.Name)
+		return nil
+	}
+
+	logger.Info("Expanding volume", "PV", volume.Name, "capacity", capacity.String(), "requested", requested.String())
+	if claim, err = ctrl.patchClaimResizeStatus(ctx, claim, v1.PersistentVolumeClaimResizing, "", nil); err != nil {
+		return err
+	}
+	ctrl.event(claim, v1.EventTypeNormal, "Resizing", fmt.Sprintf("Resizing volume %s", volume.Name))
+
+	newSize, err := expander.ExpandVolume(ctx, volume.DeepCopy(), requested)
+	if err == nil && newSize.Cmp(requested) < 0 {
+		err = fmt.Errorf("ExpandVolume returned size %s smaller than requested %s", newSize.String(), requested.String())
+	}
+	if err != nil {
+		ctrl.event(claim, v1.EventTypeWarning, "VolumeResizeFailed", err.Error())
+		return fmt.Errorf("failed to expand volume %s: %w", volume.Name, err)
+	}
+
+	patch, err := json.Marshal(map[string]interface{}{
+		"spec": map[string]interface{}{
+			"capacity": v1.ResourceList{v1.ResourceStorage: newSize},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	if _, err := ctrl.pvWriteClient.CoreV1().PersistentVolumes().Patch(ctx, volume.Name, types.MergePatchType, patch, metav1.PatchOptions{}); err != nil {
+		return fmt.Errorf("failed to save capacity %s of PV %s: %w", newSize.String(), volume.Name, err)
+	}
+	return ctrl.finishExpansion(ctx, claim, volume.Name, newSize)
+}
+
+// finishExpansion updates the status of the claim after its PV was expanded
+// to newSize.
+func (ctrl *ProvisionController) finishExpansion(ctx context.Context, claim *v1.PersistentVolumeClaim, volumeName string, newSize resource.Quantity) error {
+	logger := klog.FromContext(ctx)
+	if ctrl.nodeExpansionRequired {
+		if _, err := ctrl.patchClaimResizeStatus(ctx, claim, v1.PersistentVolumeClaimFileSystemResizePending, fileSystemResizePendingMessage, nil); err != nil {
+			return err
+		}
+		logger.Info("Expanded volume, file system resize on the node is required", "PV", volumeName, "capacity", newSize.String())
+		ctrl.event(claim, v1.EventTypeNormal, "FileSystemResizeRequired", "Require file system resize of volume on node")
+		return nil
+	}
+	if _, err := ctrl.patchClaimResizeStatus(ctx, claim, "", "", &newSize); err != nil {
+		return err
+	}
+	logger.Info("Expanded volume", "PV", volumeName, "capacity", newSize.String())
+	ctrl.event(claim, v1.EventTypeNormal, "VolumeResizeSuccessful", "Resize volume succeeded")
+	return nil
+}
+
+func hasClaimCondition(claim *v1.PersistentVolumeClaim, conditionType v1.PersistentVolumeClaimConditionType) bool {
+	for _, condition := range claim.Status.Conditions {
+		if condition.Type == conditionType {
+			return true
+		}
+	}
+	return false
+}
+
+// patchClaimResizeStatus replaces the resize conditions of the claim with a
+// condition of conditionType, if not empty, and sets its capacity, if not
+// nil. It returns the patched claim.
+func (ctrl *ProvisionController) patchClaimResizeStatus(ctx context.Context, claim *v1.PersistentVolumeClaim, conditionType v1.PersistentVolumeClaimConditionType, message string, capacity *resource.Quantity) (*v1.PersistentVolumeClaim, error) {
+	conditions := []v1.PersistentVolumeClaimCondition{}
+	for _, condition := range claim.Status.Conditions {
+		if condition.Type != v1.PersistentVolumeClaimResizing && condition.Type != v1.PersistentVolumeClaimFileSystemResizePending {
+			conditions = append(conditions, condition)
+		}
+	}
+	if conditionType != "" {
+		conditions = append(conditions, v1.PersistentVolumeClaimCondition{
+			Type:               conditionType,
+			Status:             v1.ConditionTrue,
+			LastTransitionTime: metav1.NewTime(ctrl.clock.Now()),
+			Message:            message,
+		})
+	}
+	status := map[string]interface{}{"conditions": conditions}
+	if capacity != nil {
+		status["capacity"] = v1.ResourceList{v1.ResourceStorage: *capacity}
+	}
+	patch, err := json.Marshal(map[string]interface{}{"status": status})
+	if err != nil {
+		return nil, err
+	}
+	newClaim, err := ctrl.objectClient.CoreV1().PersistentVolumeClaims(claim.Namespace).Patch(ctx, claim.Name, types.MergePatchType, patch, metav1.PatchOptions{}, "status")
+	if err != nil {
+		return nil, fmt.Errorf("failed to update status of claim: %w", err)
+	}
+	return newClaim, nil
+}
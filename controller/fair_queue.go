@@ -0,0 +1,186 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"container/heap"
+	"sync"
+	"time"
+
+	"k8s.io/client-go/util/workqueue"
+)
+
+// fairQueue hands out the items of a queue in FIFO order, but the ones with
+// the oldest creation time first while more than threshold items are ready,
+// so that old claims do not starve behind new ones after mass requeues.
+//
+// A pump moves ready items from the wrapped queue to fairQueue. The wrapped
+// queue considers them in processing until Done, so it still deduplicates
+// items added meanwhile and never hands out one item twice at a time.
+type fairQueue struct {
+	workqueue.RateLimitingInterface
+	threshold int
+	created   func(item interface{}) time.Time
+
+	startPump sync.Once
+	lock      sync.Mutex
+	cond      *sync.Cond
+	seq       uint64
+	// Ready items, both in arrival order and in a heap by creation time.
+	// Items taken from one of them are skipped in fifo or removed from byAge.
+	fifo  []*fairItem
+	byAge fairHeap
+	ready int
+	// drained is set when the wrapped queue is shut down and empty.
+	drained bool
+}
+
+type fairItem struct {
+	item    interface{}
+	created time.Time
+	seq     uint64
+	taken   bool
+	index   int
+}
+
+func newFairQueue(queue workqueue.RateLimitingInterface, threshold int, created func(item interface{}) time.Time) *fairQueue {
+	q := &fairQueue{
+		RateLimitingInterface: queue,
+		threshold:             threshold,
+		created:               created,
+	}
+	q.cond = sync.NewCond(&q.lock)
+	return q
+}
+
+// start starts the pump, once.
+func (q *fairQueue) start() {
+	q.startPump.Do(func() { go q.pump() })
+}
+
+// pump moves items from the wrapped queue until it's shut down.
+func (q *fairQueue) pump() {
+	for {
+		item, shutdown := q.RateLimitingInterface.Get()
+		var created time.Time
+		if !shutdown {
+			created = q.created(item)
+		}
+
+		q.lock.Lock()
+		if shutdown {
+			q.drained = true
+			q.cond.Broadcast()
+			q.lock.Unlock()
+			return
+		}
+		q.seq++
+		it := &fairItem{item: item, created: created, seq: q.seq}
+		q.fifo = append(q.fifo, it)
+		heap.Push(&q.byAge, it)
+		q.ready++
+		q.cond.Signal()
+		q.lock.Unlock()
+	}
+}
+
+// Get blocks until an item is ready and returns it, see fairQueue for the
+// order.
+func (q *fairQueue) Get() (interface{}, bool) {
+	q.start()
+
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	for q.ready == 0 && !q.drained {
+		q.cond.Wait()
+	}
+	if q.ready == 0 {
+		return nil, true
+	}
+
+	var it *fairItem
+	if q.ready > q.threshold {
+		it = heap.Pop(&q.byAge).(*fairItem)
+	} else {
+		for q.fifo[0].taken {
+			q.fifo = q.fifo[1:]
+		}
+		it = q.fifo[0]
+		q.fifo = q.fifo[1:]
+		heap.Remove(&q.byAge, it.index)
+	}
+	it.taken = true
+	q.ready--
+	if q.ready == 0 {
+		q.fifo = nil
+	}
+	return it.item, false
+}
+
+// Len returns the number of items waiting for Get.
+func (q *fairQueue) Len() int {
+	q.lock.Lock()
+	ready := q.ready
+	q.lock.Unlock()
+	return q.RateLimitingInterface.Len() + ready
+}
+
+// fairHeap orders items by creation time, then by arrival.
+type fairHeap []*fairItem
+
+func (h fairHeap) Len() int { return len(h) }
+
+func (h fairHeap) Less(i, j int) bool {
+	if !h[i].created.Equal(h[j].created) {
+		return h[i].created.Before(h[j].created)
+	}
+	return h[i].seq < h[j].seq
+}
+
+func (h fairHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *fairHeap) Push(x interface{}) {
+	it := x.(*fairItem)
+	it.index = len(*h)
+	*h = append(*h, it)
+}
+
+func (h *fairHeap) Pop() interface{} {
+	old := *h
+	it := old[len(old)-1]
+	old[len(old)-1] = nil
+	*h = old[:len(old)-1]
+	return it
+}
+
+// claimCreationTime returns creationTimestamp of the claim of a claimQueue
+// key, zero for unknown claims.
+func (ctrl *ProvisionController) claimCreationTime(item interface{}) time.Time {
+	key, ok := item.(string)
+	if !ok {
+		return time.Time{}
+	}
+	claim := ctrl.claimByKey(key)
+	if claim == nil {
+		return time.Time{}
+	}
+	return claim.CreationTimestamp.Time
+}
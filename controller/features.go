@@ -0,0 +1,143 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// FeatureName is the name of an opt-in behavior of the controller, see
+// WithFeatures.
+type FeatureName string
+
+// Names of the features. Each one is also enabled by the option of the same
+// name.
+const (
+	FeatureAddFinalizer                FeatureName = "AddFinalizer"
+	FeatureAvoidUnschedulableNodes     FeatureName = "AvoidUnschedulableNodes"
+	FeatureCrossNamespaceDataSources   FeatureName = "CrossNamespaceDataSources"
+	FeatureEnableDebugEndpoints        FeatureName = "EnableDebugEndpoints"
+	FeatureEnableProfiling             FeatureName = "EnableProfiling"
+	FeatureExplainSkips                FeatureName = "ExplainSkips"
+	FeaturePersistRetryState           FeatureName = "PersistRetryState"
+	FeatureProvisionForeignDataSources FeatureName = "ProvisionForeignDataSources"
+	FeatureRequireSelectedNode         FeatureName = "RequireSelectedNode"
+	FeatureResolveConsumerPod          FeatureName = "ResolveConsumerPod"
+	FeatureResolveSnapshotDataSource   FeatureName = "ResolveSnapshotDataSource"
+	FeatureUseServerSideApply          FeatureName = "UseServerSideApply"
+	FeatureUseStorageCapacityTracking  FeatureName = "UseStorageCapacityTracking"
+	FeatureValidateTopologyKeys        FeatureName = "ValidateTopologyKeys"
+)
+
+// Features enables or disables features by name. Features that are not in
+// the map keep their current state.
+type Features map[FeatureName]bool
+
+// DefaultFeatures returns the state of all features when neither
+// WithFeatures nor their options are given.
+func DefaultFeatures() Features {
+	return Features{
+		FeatureAddFinalizer:                DefaultAddFinalizer,
+		FeatureAvoidUnschedulableNodes:     DefaultAvoidUnschedulableNodes,
+		FeatureCrossNamespaceDataSources:   DefaultCrossNamespaceDataSources,
+		FeatureEnableDebugEndpoints:        DefaultEnableDebugEndpoints,
+		FeatureEnableProfiling:             DefaultEnableProfiling,
+		FeatureExplainSkips:                DefaultExplainSkips,
+		FeaturePersistRetryState:           DefaultPersistRetryState,
+		FeatureProvisionForeignDataSources: DefaultProvisionForeignDataSources,
+		FeatureRequireSelectedNode:         DefaultRequireSelectedNode,
+		FeatureResolveConsumerPod:          DefaultResolveConsumerPod,
+		FeatureResolveSnapshotDataSource:   DefaultResolveSnapshotDataSource,
+		FeatureUseServerSideApply:          DefaultUseServerSideApply,
+		FeatureUseStorageCapacityTracking:  DefaultUseStorageCapacityTracking,
+		FeatureValidateTopologyKeys:        DefaultValidateTopologyKeys,
+	}
+}
+
+// String returns the features sorted by name, e.g.
+// "AddFinalizer=true,ExplainSkips=false".
+func (f Features) String() string {
+	names := make([]string, 0, len(f))
+	for name := range f {
+		names = append(names, string(name))
+	}
+	sort.Strings(names)
+	for i, name := range names {
+		names[i] = name + "=" + strconv.FormatBool(f[FeatureName(name)])
+	}
+	return strings.Join(names, ",")
+}
+
+// featureFields returns the fields holding the state of each feature, the
+// options of the features set the same fields.
+func (ctrl *ProvisionController) featureFields() map[FeatureName]*bool {
+	return map[FeatureName]*bool{
+		FeatureAddFinalizer:                &ctrl.addFinalizer,
+		FeatureAvoidUnschedulableNodes:     &ctrl.avoidUnschedulableNodes,
+		FeatureCrossNamespaceDataSources:   &ctrl.crossNamespaceSources,
+		FeatureEnableDebugEndpoints:        &ctrl.enableDebugEndpoints,
+		FeatureEnableProfiling:             &ctrl.enableProfiling,
+		FeatureExplainSkips:                &ctrl.explainSkips,
+		FeaturePersistRetryState:           &ctrl.persistRetryState,
+		FeatureProvisionForeignDataSources: &ctrl.provisionForeignSources,
+		FeatureRequireSelectedNode:         &ctrl.requireSelectedNode,
+		FeatureResolveConsumerPod:          &ctrl.resolveConsumerPod,
+		FeatureResolveSnapshotDataSource:   &ctrl.resolveSnapshots,
+		FeatureUseServerSideApply:          &ctrl.serverSideApply,
+		FeatureUseStorageCapacityTracking:  &ctrl.storageCapacityTracking,
+		FeatureValidateTopologyKeys:        &ctrl.validateTopologyKeys,
+	}
+}
+
+// Features returns the state of all features of the controller. It is
+// logged when the controller starts and reported in the features label of
+// the build info metric.
+func (ctrl *ProvisionController) Features() Features {
+	features := Features{}
+	for name, field := range ctrl.featureFields() {
+		features[name] = *field
+	}
+	return features
+}
+
+// WithFeatures enables or disables the given features, see the options of
+// the same names for what they do. It sets the same state as those options:
+// options are applied in order, so WithFeatures overrides the options given
+// before it and the options given after it override WithFeatures. Settings
+// of the options other than a bool, e.g. the taints of
+// AvoidUnschedulableNodes, are not changed. Unknown feature names are
+// rejected. Defaults to DefaultFeatures.
+func WithFeatures(features Features) func(*ProvisionController) error {
+	return func(c *ProvisionController) error {
+		if c.HasRun() {
+			return errRuntime
+		}
+		fields := c.featureFields()
+		for name := range features {
+			if _, ok := fields[name]; !ok {
+				return fmt.Errorf("unknown feature %q", name)
+			}
+		}
+		for name, enabled := range features {
+			*fields[name] = enabled
+		}
+		return nil
+	}
+}
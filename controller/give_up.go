@@ -0,0 +1,192 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	klog "k8s.io/klog/v2"
+)
+
+const (
+	// Suffixes of the annotations recording on a claim that the controller
+	// gave up provisioning it, prefixed by the provisioner name.
+	AnnProvisionFailuresSuffix = "/provision-failures"
+	AnnLastErrorSuffix         = "/last-error"
+
+	// maxLastErrorLength is the maximum length of the last error annotation.
+	maxLastErrorLength = 1024
+)
+
+// giveUpAnnotationPrefix returns provisionerName usable as prefix of
+// annotation keys, i.e. a lower case DNS subdomain.
+func giveUpAnnotationPrefix(provisionerName string) string {
+	prefix := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '-', r == '.':
+			return r
+		case r >= 'A' && r <= 'Z':
+			return r - 'A' + 'a'
+		default:
+			return '-'
+		}
+	}, provisionerName)
+	return strings.Trim(prefix, "-.")
+}
+
+// recordGiveUp records on the claim with the given queue key that the
+// controller stopped retrying to provision it and sends a Warning event.
+// Claims that already record the same number of failures, i.e. that failed
+// again after a resync, are left alone.
+func (ctrl *ProvisionController) recordGiveUp(ctx context.Context, key string, failures int, syncErr error) {
+	claim := ctrl.claimByKey(key)
+	if claim == nil {
+		return
+	}
+	count := strconv.Itoa(failures)
+	if claim.Annotations[ctrl.annProvisionFailures] == count {
+		return
+	}
+	message := syncErr.Error()
+	if len(message) > maxLastErrorLength {
+		message = message[:maxLastErrorLength-3] + "..."
+	}
+	if err := ctrl.patchClaimAnnotations(ctx, claim, map[string]interface{}{
+		ctrl.annProvisionFailures: count,
+		ctrl.annLastError:         message,
+	}); err != nil {
+		klog.FromContext(ctx).Error(err, "Failed to record giving up on claim", "PVC", klog.KObj(claim))
+	}
+	ctrl.event(claim, v1.EventTypeWarning, "ProvisioningStopped",
+		fmt.Sprintf("Stopped retrying to provision volume after %d failures: %s. Provisioning is retried when the claim or its StorageClass is updated", failures, message))
+}
+
+// clearGiveUp removes the annotations of recordGiveUp and recordRetryState
+// from the claim with the given queue key, if any.
+func (ctrl *ProvisionController) clearGiveUp(ctx context.Context, key string) {
+	claim := ctrl.claimByKey(key)
+	if claim == nil {
+		return
+	}
+	remove := map[string]interface{}{}
+	for _, ann := range ctrl.failureAnnotations() {
+		if _, found := claim.Annotations[ann]; found {
+			remove[ann] = nil
+		}
+	}
+	if len(remove) == 0 {
+		return
+	}
+	if err := ctrl.patchClaimAnnotations(ctx, claim, remove); err != nil {
+		klog.FromContext(ctx).Error(err, "Failed to clear give up annotations of claim", "PVC", klog.KObj(claim))
+	}
+}
+
+func (ctrl *ProvisionController) patchClaimAnnotations(ctx context.Context, claim *v1.PersistentVolumeClaim, annotations map[string]interface{}) error {
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{"annotations": annotations},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = ctrl.objectClient.CoreV1().PersistentVolumeClaims(claim.Namespace).Patch(ctx, claim.Name, types.MergePatchType, patch, metav1.PatchOptions{})
+	return err
+}
+
+// resetClaimFailures resets the failures of a claim whose spec or annotations
+// have changed, e.g. whose selected node appeared or changed, the change may
+// have fixed the provisioning failures. The annotations of recordGiveUp are
+// ignored, they are cleared by the next sync of the claim.
+func (ctrl *ProvisionController) resetClaimFailures(oldObj, newObj interface{}) {
+	oldClaim, ok := oldObj.(*v1.PersistentVolumeClaim)
+	if !ok {
+		return
+	}
+	newClaim, ok := newObj.(*v1.PersistentVolumeClaim)
+	if !ok {
+		return
+	}
+	if !ctrl.claimChanged(oldClaim, newClaim) {
+		return
+	}
+	// A new selected node is the most latency sensitive change, a pod waits
+	// for the volume. The claim handler adds the claim without rate limiting.
+	if node := selectedNode(newClaim); node != "" && node != selectedNode(oldClaim) {
+		ctrl.logger.V(2).Info("Selected node of claim changed, retrying provisioning immediately", "PVC", klog.KObj(newClaim), "node", node, "failures", ctrl.claimQueue.NumRequeues(string(newClaim.UID)))
+	}
+	ctrl.claimQueue.Forget(string(newClaim.UID))
+}
+
+// deferClaimUpdate returns true for an update of a failed claim that changed
+// neither its spec nor its annotations, e.g. of its status. The claim is
+// retried when its backoff expires, retrying it right away would defeat the
+// rate limiter. Resyncs are not deferred, they retry claims regardless of
+// their failures.
+func (ctrl *ProvisionController) deferClaimUpdate(oldObj, newObj interface{}) bool {
+	oldClaim, ok := oldObj.(*v1.PersistentVolumeClaim)
+	if !ok {
+		return false
+	}
+	newClaim, ok := newObj.(*v1.PersistentVolumeClaim)
+	if !ok || oldClaim.ResourceVersion == newClaim.ResourceVersion {
+		return false
+	}
+	return !ctrl.claimChanged(oldClaim, newClaim) && ctrl.claimQueue.NumRequeues(string(newClaim.UID)) > 0
+}
+
+// claimChanged returns true when the spec or annotations of a claim changed,
+// i.e. its requested size, class, selected node or parameters of the
+// provisioner. Changes of its status or other metadata don't count.
+func (ctrl *ProvisionController) claimChanged(oldClaim, newClaim *v1.PersistentVolumeClaim) bool {
+	return !equality.Semantic.DeepEqual(oldClaim.Spec, newClaim.Spec) ||
+		!equality.Semantic.DeepEqual(ctrl.userAnnotations(oldClaim), ctrl.userAnnotations(newClaim))
+}
+
+// selectedNode returns the node selected by the scheduler for the claim.
+func selectedNode(claim *v1.PersistentVolumeClaim) string {
+	if node, ok := claim.Annotations[AnnSelectedNode]; ok {
+		return node
+	}
+	return claim.Annotations[AnnAlphaSelectedNode]
+}
+
+// failureAnnotations returns keys of the annotations of recordGiveUp and
+// recordRetryState.
+func (ctrl *ProvisionController) failureAnnotations() []string {
+	return []string{ctrl.annProvisionFailures, ctrl.annLastError, ctrl.annProvisionAttempts, ctrl.annLastAttempt}
+}
+
+// userAnnotations returns annotations of the claim without those of
+// recordGiveUp and recordRetryState.
+func (ctrl *ProvisionController) userAnnotations(claim *v1.PersistentVolumeClaim) map[string]string {
+	annotations := make(map[string]string, len(claim.Annotations))
+	for key, value := range claim.Annotations {
+		annotations[key] = value
+	}
+	for _, ann := range ctrl.failureAnnotations() {
+		delete(annotations, ann)
+	}
+	return annotations
+}
@@ -0,0 +1,325 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller_test
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr/funcr"
+	v1 "k8s.io/api/core/v1"
+	storage "k8s.io/api/storage/v1"
+	apierrs "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	testclient "k8s.io/client-go/testing"
+	"k8s.io/klog/v2/ktesting"
+	"sigs.k8s.io/sig-storage-lib-external-provisioner/v10/controller"
+	"sigs.k8s.io/sig-storage-lib-external-provisioner/v10/controller/testutil"
+)
+
+// runHarness runs the controller of h until the test ends and waits until it
+// is Ready.
+func runHarness(t *testing.T, ctx context.Context, h *testutil.Harness) {
+	t.Helper()
+	t.Cleanup(func() {
+		if err := h.Stop(); err != nil {
+			t.Errorf("unexpected error of Run: %v", err)
+		}
+	})
+	if err := h.RunUntil(ctx); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestClaimLogging(t *testing.T) {
+	var lock sync.Mutex
+	var lines []string
+	logger := funcr.New(func(prefix, args string) {
+		lock.Lock()
+		defer lock.Unlock()
+		lines = append(lines, args)
+	}, funcr.Options{Verbosity: 5})
+
+	class := testutil.NewStorageClass("class-1", "foo.bar/baz")
+	claim := testutil.NewClaim("claim-1", class)
+	h, err := testutil.NewHarness(logger, "foo.bar/baz", nil, []runtime.Object{class, claim})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	// The context carries no logger, the one passed to NewProvisionController
+	// must be used.
+	runHarness(t, ctx, h)
+	if _, err := h.WaitForPV("pvc-uid-claim-1"); err != nil {
+		t.Fatalf("volume was not provisioned: %v", err)
+	}
+
+	lock.Lock()
+	defer lock.Unlock()
+	expectedKeys := []string{`"PVC"={"name"="claim-1" "namespace"="default"}`, `"claimUID"="uid-claim-1"`}
+	for _, msg := range []string{`"msg"="Started"`, `"msg"="Volume is provisioned"`, `"msg"="Succeeded"`, `"msg"="Persistentvolume saved"`} {
+		found := false
+		for _, line := range lines {
+			if !strings.Contains(line, msg) {
+				continue
+			}
+			found = true
+			for _, key := range expectedKeys {
+				if !strings.Contains(line, key) {
+					t.Errorf("expected %s in log line %s", key, line)
+				}
+			}
+		}
+		if !found {
+			t.Errorf("expected log line with %s, got %v", msg, lines)
+		}
+	}
+}
+
+// recordingDeletionGuard records PVs passed to ShouldDelete.
+type recordingDeletionGuard struct {
+	testutil.FakeProvisioner
+	lock    sync.Mutex
+	volumes []string
+}
+
+var _ controller.DeletionGuard = &recordingDeletionGuard{}
+
+func (p *recordingDeletionGuard) ShouldDelete(ctx context.Context, volume *v1.PersistentVolume) bool {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.volumes = append(p.volumes, volume.Name)
+	return true
+}
+
+func TestVolumeListWatchLabelSelector(t *testing.T) {
+	logger, ctx := ktesting.NewTestContext(t)
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	class := testutil.NewStorageClass("class-1", "foo.bar/baz")
+	labeled := testutil.NewVolume("volume-1", testutil.NewClaim("claim-1", class), class)
+	labeled.Labels = map[string]string{"owner": "foo"}
+	labeled.Status.Phase = v1.VolumeReleased
+	unlabeled := testutil.NewVolume("volume-2", testutil.NewClaim("claim-2", class), class)
+	unlabeled.Status.Phase = v1.VolumeReleased
+	provisioner := &recordingDeletionGuard{}
+	h, err := testutil.NewHarness(logger, "foo.bar/baz", provisioner, []runtime.Object{labeled, unlabeled}, controller.VolumeListWatchLabelSelector("owner=foo"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	runHarness(t, ctx, h)
+
+	if err := h.WaitForPVDeleted("volume-1"); err != nil {
+		t.Fatalf("labeled volume was not deleted: %v", err)
+	}
+	// The controller syncs only volumes of its informer, which never lists
+	// the unlabeled one.
+	volumes, err := h.Controller.VolumesLister()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := volumes.Get("volume-2"); !apierrs.IsNotFound(err) {
+		t.Errorf("expected unlabeled volume not to be cached, got %v", err)
+	}
+	if _, err := h.Client.CoreV1().PersistentVolumes().Get(ctx, "volume-2", metav1.GetOptions{}); err != nil {
+		t.Errorf("unlabeled volume was deleted: %v", err)
+	}
+	provisioner.lock.Lock()
+	defer provisioner.lock.Unlock()
+	for _, volume := range provisioner.volumes {
+		if volume != "volume-1" {
+			t.Errorf("expected ShouldDelete only for volume-1, got %s", volume)
+		}
+	}
+}
+
+func TestRunStartFailure(t *testing.T) {
+	tests := []struct {
+		name          string
+		options       []func(*controller.ProvisionController) error
+		expectedError string
+	}{
+		{
+			name:          "cache sync",
+			options:       []func(*controller.ProvisionController) error{controller.CacheSyncTimeout(300 * time.Millisecond)},
+			expectedError: "failed to sync informer caches",
+		},
+		{
+			name:          "cache sync of leader",
+			options:       []func(*controller.ProvisionController) error{controller.LeaderElection(true), controller.CacheSyncTimeout(300 * time.Millisecond)},
+			expectedError: "failed to sync informer caches",
+		},
+		{
+			name:          "leader election configuration",
+			options:       []func(*controller.ProvisionController) error{controller.LeaderElection(true), controller.LeaseDuration(time.Second), controller.RenewDeadline(2 * time.Second)},
+			expectedError: "invalid leader election configuration",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			logger, ctx := ktesting.NewTestContext(t)
+			h, err := testutil.NewHarness(logger, "foo.bar/baz", nil, nil, test.options...)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			h.Client.PrependReactor("list", "persistentvolumes", func(action testclient.Action) (bool, runtime.Object, error) {
+				return true, nil, apierrs.NewForbidden(v1.Resource("persistentvolumes"), "", errors.New("forbidden"))
+			})
+			if err := h.RunUntil(ctx); err == nil || !strings.Contains(err.Error(), test.expectedError) {
+				t.Errorf("expected error %q, got %v", test.expectedError, err)
+			}
+		})
+	}
+}
+
+func TestStorageClassAPIWithoutFallback(t *testing.T) {
+	logger, ctx := ktesting.NewTestContext(t)
+	h, err := testutil.NewHarness(logger, "foo.bar/baz", nil, nil, controller.CacheSyncTimeout(time.Second))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	h.Client.PrependReactor("list", "storageclasses", func(action testclient.Action) (bool, runtime.Object, error) {
+		return true, nil, apierrs.NewNotFound(storage.Resource("storageclasses"), "")
+	})
+	if err := h.RunUntil(ctx); err == nil || !strings.Contains(err.Error(), "storage.k8s.io/storageclasses") {
+		t.Errorf("expected class informer not to sync, got %v", err)
+	}
+}
+
+func TestPausedShutdown(t *testing.T) {
+	logger, ctx := ktesting.NewTestContext(t)
+	h, err := testutil.NewHarness(logger, "foo.bar/baz", nil, []runtime.Object{testutil.NewStorageClass("class-1", "foo.bar/baz")})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	h.Controller.Pause()
+	if err := h.RunUntil(ctx); err != nil {
+		t.Fatalf("expected paused controller to be ready with ReadyWhenPaused(true): %v", err)
+	}
+	if err := h.Stop(); err != nil {
+		t.Errorf("expected no error, got %v", err)
+	}
+}
+
+// lifecycleProvisioner records calls of Init, Provision and Shutdown.
+type lifecycleProvisioner struct {
+	testutil.FakeProvisioner
+	initErr        error
+	initController *controller.ProvisionController
+	lock           sync.Mutex
+	calls          []string
+}
+
+var _ controller.Initializer = &lifecycleProvisioner{}
+var _ controller.ShutdownNotifier = &lifecycleProvisioner{}
+
+func (p *lifecycleProvisioner) record(call string) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.calls = append(p.calls, call)
+}
+
+func (p *lifecycleProvisioner) lifecycleCalls() []string {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return append([]string(nil), p.calls...)
+}
+
+func (p *lifecycleProvisioner) Init(ctx context.Context, c *controller.ProvisionController) error {
+	p.record("Init")
+	p.lock.Lock()
+	p.initController = c
+	p.lock.Unlock()
+	return p.initErr
+}
+
+func (p *lifecycleProvisioner) Provision(ctx context.Context, options controller.ProvisionOptions) (*v1.PersistentVolume, controller.ProvisioningState, error) {
+	p.record("Provision")
+	return p.FakeProvisioner.Provision(ctx, options)
+}
+
+func (p *lifecycleProvisioner) Shutdown(ctx context.Context) {
+	p.record("Shutdown")
+}
+
+func TestLifecycleHooks(t *testing.T) {
+	logger, ctx := ktesting.NewTestContext(t)
+	class := testutil.NewStorageClass("class-1", "foo.bar/baz")
+	provisioner := &lifecycleProvisioner{}
+	h, err := testutil.NewHarness(logger, "foo.bar/baz", provisioner, []runtime.Object{class, testutil.NewClaim("claim-1", class)})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := h.RunUntil(ctx); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := h.WaitForPV("pvc-uid-claim-1"); err != nil {
+		t.Fatalf("expected PV to be provisioned: %v", err)
+	}
+	if err := h.Stop(); err != nil {
+		t.Errorf("expected no error, got %v", err)
+	}
+	if calls := provisioner.lifecycleCalls(); !reflect.DeepEqual(calls, []string{"Init", "Provision", "Shutdown"}) {
+		t.Errorf("expected calls Init, Provision, Shutdown, got %v", calls)
+	}
+	if provisioner.initController != h.Controller {
+		t.Errorf("expected Init to get the controller")
+	}
+}
+
+func TestInitializerError(t *testing.T) {
+	logger, ctx := ktesting.NewTestContext(t)
+	class := testutil.NewStorageClass("class-1", "foo.bar/baz")
+	provisioner := &lifecycleProvisioner{initErr: errors.New("backend unreachable")}
+	h, err := testutil.NewHarness(logger, "foo.bar/baz", provisioner, []runtime.Object{class, testutil.NewClaim("claim-1", class)})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := h.RunUntil(ctx); err == nil || !strings.Contains(err.Error(), "failed to initialize provisioner: backend unreachable") {
+		t.Errorf("expected Init error, got %v", err)
+	}
+	if calls := provisioner.lifecycleCalls(); !reflect.DeepEqual(calls, []string{"Init"}) {
+		t.Errorf("expected only Init call, got %v", calls)
+	}
+}
+
+func TestValidateTopologyKeysRun(t *testing.T) {
+	logger, ctx := ktesting.NewTestContext(t)
+	class := testutil.NewStorageClass("class-1", "foo.bar/baz")
+	class.AllowedTopologies = []v1.TopologySelectorTerm{{MatchLabelExpressions: []v1.TopologySelectorLabelRequirement{{Key: "example.com/rakc", Values: []string{"1"}}}}}
+	node := &v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node-1", Labels: map[string]string{"example.com/rack": "1"}}}
+	h, err := testutil.NewHarness(logger, "foo.bar/baz", nil, []runtime.Object{class, node}, controller.ValidateTopologyKeys(true))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	runHarness(t, ctx, h)
+
+	event, err := h.WaitForEvent("UnknownTopologyKeys")
+	if err != nil {
+		t.Fatalf("class was not validated: %v", err)
+	}
+	if event.Type != v1.EventTypeWarning {
+		t.Errorf("expected Warning event, got %v", event)
+	}
+}
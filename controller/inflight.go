@@ -0,0 +1,164 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	klog "k8s.io/klog/v2"
+	"k8s.io/utils/clock"
+)
+
+const (
+	// defaultInFlightRetryDelay is the delay of claims and volumes that
+	// were not synced because of MaxInFlightOperations, jittered.
+	defaultInFlightRetryDelay = time.Second
+
+	// inFlightLimitLogInterval is how long the limit must reject operations
+	// before it's logged, and how often it's logged then.
+	inFlightLimitLogInterval = time.Minute
+)
+
+var (
+	// errInFlightLimit is returned by provisionClaimOperation and
+	// deleteVolumeOperation when MaxInFlightOperations calls are in progress.
+	// It's not a failure of the claim or volume, the worker requeues them.
+	errInFlightLimit = errors.New("too many Provision and Delete calls in progress")
+	// errNodeInFlightLimit is returned by provisionClaimOperation when
+	// PerNodeProvisionConcurrency calls are in progress on the selected
+	// node of the claim. It is handled like errInFlightLimit.
+	errNodeInFlightLimit = errors.New("too many Provision calls in progress on the selected node")
+)
+
+// inFlightLimiter limits the number of Provision and Delete calls in
+// progress. A nil limiter doesn't limit anything.
+type inFlightLimiter struct {
+	limit int
+	gauge prometheus.Gauge
+	now   func() time.Time
+
+	lock     sync.Mutex
+	inFlight int
+	// Start of the current period of rejected calls, the last rejected call
+	// and the last log about them.
+	limitedSince, lastRejected, lastLog time.Time
+}
+
+func newInFlightLimiter(limit int, gauge prometheus.Gauge) *inFlightLimiter {
+	return &inFlightLimiter{
+		limit: limit,
+		gauge: gauge,
+		now:   clock.RealClock{}.Now,
+	}
+}
+
+// tryAcquire takes a slot for a call, without waiting. It returns false
+// when all slots are taken.
+func (l *inFlightLimiter) tryAcquire(logger klog.Logger) bool {
+	if l == nil {
+		return true
+	}
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if l.inFlight < l.limit {
+		l.inFlight++
+		l.gauge.Set(float64(l.inFlight))
+		return true
+	}
+
+	now := l.now()
+	if l.limitedSince.IsZero() || now.Sub(l.lastRejected) > inFlightLimitLogInterval {
+		l.limitedSince = now
+	}
+	l.lastRejected = now
+	if now.Sub(l.limitedSince) >= inFlightLimitLogInterval && now.Sub(l.lastLog) >= inFlightLimitLogInterval {
+		logger.Info("MaxInFlightOperations limits Provision and Delete calls", "limit", l.limit, "since", l.limitedSince)
+		l.lastLog = now
+	}
+	return false
+}
+
+// release returns a slot of tryAcquire.
+func (l *inFlightLimiter) release() {
+	if l == nil {
+		return
+	}
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	l.inFlight--
+	l.gauge.Set(float64(l.inFlight))
+}
+
+// nodeInFlightLimiter limits the number of Provision calls in progress on
+// each selected node. Calls without a node are not limited, neither are any
+// calls by a nil limiter.
+type nodeInFlightLimiter struct {
+	limit int
+	gauge *prometheus.GaugeVec
+
+	lock sync.Mutex
+	// Map node name -> calls in progress, only nodes with calls are kept.
+	inFlight map[string]int
+}
+
+func newNodeInFlightLimiter(limit int, gauge *prometheus.GaugeVec) *nodeInFlightLimiter {
+	return &nodeInFlightLimiter{
+		limit:    limit,
+		gauge:    gauge,
+		inFlight: map[string]int{},
+	}
+}
+
+// tryAcquire takes a slot of node for a call, without waiting. It returns
+// false when all slots of the node are taken.
+func (l *nodeInFlightLimiter) tryAcquire(node string) bool {
+	if l == nil || node == "" {
+		return true
+	}
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if l.inFlight[node] >= l.limit {
+		return false
+	}
+	l.inFlight[node]++
+	l.gauge.WithLabelValues(node).Set(float64(l.inFlight[node]))
+	return true
+}
+
+// release returns a slot of tryAcquire. Nodes without calls are removed from
+// the gauge to keep its cardinality low.
+func (l *nodeInFlightLimiter) release(node string) {
+	if l == nil || node == "" {
+		return
+	}
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	l.inFlight[node]--
+	if l.inFlight[node] > 0 {
+		l.gauge.WithLabelValues(node).Set(float64(l.inFlight[node]))
+		return
+	}
+	delete(l.inFlight, node)
+	l.gauge.DeleteLabelValues(node)
+}
@@ -0,0 +1,138 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/utils/clock"
+)
+
+// initialSyncLimiter spreads claims of the first listing of the claim
+// informer over time, see InitialSyncBurstLimit. Each claim gets a slot, the
+// slots are interval apart.
+type initialSyncLimiter struct {
+	interval time.Duration
+	clock    clock.PassiveClock
+
+	lock sync.Mutex
+	// next is the next free slot.
+	next time.Time
+	// slots of claims that may still wait for them.
+	slots map[string]time.Time
+}
+
+func newInitialSyncLimiter(perSecond float64, clock clock.PassiveClock) *initialSyncLimiter {
+	return &initialSyncLimiter{
+		interval: time.Duration(float64(time.Second) / perSecond),
+		clock:    clock,
+		slots:    map[string]time.Time{},
+	}
+}
+
+// startAt moves the first slot to start, e.g. after the startup jitter.
+func (l *initialSyncLimiter) startAt(start time.Time) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if l.next.Before(start) {
+		l.next = start
+	}
+}
+
+// reserve gives uid the next free slot and returns how long it has to wait
+// for it.
+func (l *initialSyncLimiter) reserve(uid string) time.Duration {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	now := l.clock.Now()
+	if l.next.Before(now) {
+		l.next = now
+	}
+	slot := l.next
+	l.next = l.next.Add(l.interval)
+	l.slots[uid] = slot
+	return slot.Sub(now)
+}
+
+// waiting returns true when uid has a slot that's still in the future.
+func (l *initialSyncLimiter) waiting(uid string) bool {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if len(l.slots) == 0 {
+		return false
+	}
+	now := l.clock.Now()
+	if !now.Before(l.next) {
+		// All slots have passed.
+		l.slots = map[string]time.Time{}
+		return false
+	}
+	slot, ok := l.slots[uid]
+	if ok && !now.Before(slot) {
+		delete(l.slots, uid)
+		return false
+	}
+	return ok
+}
+
+// forget drops the slot of a deleted claim.
+func (l *initialSyncLimiter) forget(uid string) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	delete(l.slots, uid)
+}
+
+// enqueueInitialClaim enqueues a claim of the first listing of the claim
+// informer in its InitialSyncBurstLimit slot.
+func (ctrl *ProvisionController) enqueueInitialClaim(obj interface{}) {
+	uid, err := getObjectUID(obj)
+	if err != nil {
+		utilruntime.HandleError(err)
+		return
+	}
+	ctrl.claimQueue.AddAfter(uid, ctrl.initialSync.reserve(uid))
+}
+
+// initialClaimWaiting returns true when a resync of a claim comes before its
+// InitialSyncBurstLimit slot. The claim is enqueued in the slot anyway.
+func (ctrl *ProvisionController) initialClaimWaiting(oldObj, newObj interface{}) bool {
+	if ctrl.initialSync == nil {
+		return false
+	}
+	oldClaim, ok := oldObj.(*v1.PersistentVolumeClaim)
+	if !ok {
+		return false
+	}
+	newClaim, ok := newObj.(*v1.PersistentVolumeClaim)
+	if !ok || oldClaim.ResourceVersion != newClaim.ResourceVersion {
+		return false
+	}
+	return ctrl.initialSync.waiting(string(newClaim.UID))
+}
+
+// startupDelay returns a random delay of the start of workers up to
+// StartupJitter.
+func (ctrl *ProvisionController) startupDelay() time.Duration {
+	if ctrl.startupJitter <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(ctrl.startupJitter)))
+}
@@ -0,0 +1,221 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"fmt"
+
+	v1 "k8s.io/api/core/v1"
+	storage "k8s.io/api/storage/v1"
+	apierrs "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/labels"
+	corelistersv1 "k8s.io/client-go/listers/core/v1"
+	storagelistersv1 "k8s.io/client-go/listers/storage/v1"
+	"k8s.io/client-go/tools/cache"
+
+	"sigs.k8s.io/sig-storage-lib-external-provisioner/v10/topology"
+)
+
+var (
+	errCachesNotSynced      = fmt.Errorf("informer caches have not synced yet")
+	errProvisioningDisabled = fmt.Errorf("PVCs are not cached when provisioning is disabled")
+	errDeletionDisabled     = fmt.Errorf("PVs are not cached when deletion is disabled")
+)
+
+// ClaimsLister returns a lister of PersistentVolumeClaims backed by the cache
+// of the controller, e.g. for provisioners that need to look at other claims
+// in Provision. Objects returned by the lister are shared with the cache and
+// must not be modified. It returns an error until Run has synced the caches.
+func (ctrl *ProvisionController) ClaimsLister() (corelistersv1.PersistentVolumeClaimLister, error) {
+	if err := ctrl.checkCachesSynced(); err != nil {
+		return nil, err
+	}
+	if ctrl.claimsIndexer == nil {
+		return nil, errProvisioningDisabled
+	}
+	return corelistersv1.NewPersistentVolumeClaimLister(ctrl.claimsIndexer), nil
+}
+
+// VolumesLister returns a lister of PersistentVolumes backed by the cache of
+// the controller. Objects returned by the lister are shared with the cache
+// and must not be modified. With VolumeListWatchLabelSelector, only matching
+// PVs are listed. It returns an error until Run has synced the caches.
+func (ctrl *ProvisionController) VolumesLister() (corelistersv1.PersistentVolumeLister, error) {
+	if err := ctrl.checkCachesSynced(); err != nil {
+		return nil, err
+	}
+	if ctrl.volumes == nil {
+		return nil, errDeletionDisabled
+	}
+	if ctrl.volumeMetadataClient != nil {
+		return nil, fmt.Errorf("only metadata of PVs are cached with VolumeMetadataClient")
+	}
+	indexer, ok := ctrl.volumes.(cache.Indexer)
+	if !ok {
+		return nil, fmt.Errorf("volumes informer does not provide an indexer")
+	}
+	return corelistersv1.NewPersistentVolumeLister(indexer), nil
+}
+
+// ExistingVolumeTopologies counts the PVs provisioned by the controller, i.e.
+// with the pv.kubernetes.io/provisioned-by annotation set to one of its
+// provisioner names, per value of topologyKey in their node affinity. A
+// provisioner can use it in Provision to spread the volumes of an application
+// across failure domains, e.g. by picking the least-loaded zone. The selector
+// is matched against labels of the claims the PVs are bound to; PVs whose
+// claim is not in the cache are counted only for an empty selector. PVs
+// without node affinity or without a requirement of topologyKey are not
+// counted, a PV allowed in several domains is counted in each of them. It
+// returns an error until Run has synced the caches.
+func (ctrl *ProvisionController) ExistingVolumeTopologies(selector labels.Selector, topologyKey string) (map[string]int, error) {
+	lister, err := ctrl.VolumesLister()
+	if err != nil {
+		return nil, err
+	}
+	if !selector.Empty() && ctrl.claimsIndexer == nil {
+		return nil, errProvisioningDisabled
+	}
+	volumes, err := lister.List(labels.Everything())
+	if err != nil {
+		return nil, err
+	}
+	counts := map[string]int{}
+	for _, volume := range volumes {
+		if provisioner, _ := ctrl.provisionedBy(volume.Annotations); !ctrl.knownProvisioner(provisioner) {
+			continue
+		}
+		if !selector.Empty() && !selector.Matches(labels.Set(ctrl.boundClaimLabels(volume))) {
+			continue
+		}
+		for _, value := range topology.AffinityValues(volume.Spec.NodeAffinity, topologyKey) {
+			counts[value]++
+		}
+	}
+	return counts, nil
+}
+
+// boundClaimLabels returns labels of the claim in the cache that volume is
+// bound to, or nil.
+func (ctrl *ProvisionController) boundClaimLabels(volume *v1.PersistentVolume) map[string]string {
+	if volume.Spec.ClaimRef == nil || volume.Spec.ClaimRef.UID == "" {
+		return nil
+	}
+	objs, err := ctrl.claimsIndexer.ByIndex(uidIndex, string(volume.Spec.ClaimRef.UID))
+	if err != nil || len(objs) == 0 {
+		return nil
+	}
+	claim, ok := objs[0].(*v1.PersistentVolumeClaim)
+	if !ok {
+		return nil
+	}
+	return claim.Labels
+}
+
+// ClassesLister returns a lister of StorageClasses backed by the cache of the
+// controller. Objects returned by the lister are shared with the cache and
+// must not be modified; classes of a storage.k8s.io/v1beta1 informer set by
+// ClassesInformer are converted on each call. It returns an error until Run
+// has synced the caches and while StorageClassAPIFallback runs without class
+// cache.
+func (ctrl *ProvisionController) ClassesLister() (storagelistersv1.StorageClassLister, error) {
+	if err := ctrl.checkCachesSynced(); err != nil {
+		return nil, err
+	}
+	if ctrl.classesUnavailable.Load() {
+		return nil, errClassesUnavailable
+	}
+	return classLister{ctrl.classes}, nil
+}
+
+// ClaimsByClass returns claims of the StorageClass, including claims with
+// the legacy volume.beta.kubernetes.io/storage-class annotation. Claims
+// without a class are returned for the class "". The claims are shared with
+// the cache and must not be modified. It returns an error until Run has
+// synced the caches.
+func (ctrl *ProvisionController) ClaimsByClass(class string) ([]*v1.PersistentVolumeClaim, error) {
+	return ctrl.claimsByIndex(ClaimClassIndex, class)
+}
+
+// ClaimsBySelectedNode returns claims with the selected node annotation, or
+// its legacy alpha version, set to node. The claims are shared with the cache
+// and must not be modified. It returns an error until Run has synced the
+// caches.
+func (ctrl *ProvisionController) ClaimsBySelectedNode(node string) ([]*v1.PersistentVolumeClaim, error) {
+	return ctrl.claimsByIndex(ClaimSelectedNodeIndex, node)
+}
+
+func (ctrl *ProvisionController) claimsByIndex(index, key string) ([]*v1.PersistentVolumeClaim, error) {
+	if err := ctrl.checkCachesSynced(); err != nil {
+		return nil, err
+	}
+	if ctrl.claimsIndexer == nil {
+		return nil, errProvisioningDisabled
+	}
+	objs, err := ctrl.claimsIndexer.ByIndex(index, key)
+	if err != nil {
+		return nil, err
+	}
+	claims := make([]*v1.PersistentVolumeClaim, 0, len(objs))
+	for _, obj := range objs {
+		if claim, ok := obj.(*v1.PersistentVolumeClaim); ok {
+			claims = append(claims, claim)
+		}
+	}
+	return claims, nil
+}
+
+func (ctrl *ProvisionController) checkCachesSynced() error {
+	ctrl.stateLock.Lock()
+	defer ctrl.stateLock.Unlock()
+	if !ctrl.cachesSynced {
+		return errCachesNotSynced
+	}
+	return nil
+}
+
+// classLister lists StorageClasses of a store with storage.k8s.io/v1 or
+// v1beta1 objects.
+type classLister struct {
+	store cache.Store
+}
+
+var _ storagelistersv1.StorageClassLister = classLister{}
+
+func (l classLister) List(selector labels.Selector) ([]*storage.StorageClass, error) {
+	var classes []*storage.StorageClass
+	for _, obj := range l.store.List() {
+		class, err := toStorageClass(obj)
+		if err != nil {
+			return nil, err
+		}
+		if selector.Matches(labels.Set(class.Labels)) {
+			classes = append(classes, class)
+		}
+	}
+	return classes, nil
+}
+
+func (l classLister) Get(name string) (*storage.StorageClass, error) {
+	obj, exists, err := l.store.GetByKey(name)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, apierrs.NewNotFound(storage.Resource("storageclass"), name)
+	}
+	return toStorageClass(obj)
+}
@@ -17,6 +17,8 @@ limitations under the License.
 package metrics
 
 import (
+	"reflect"
+
 	"github.com/prometheus/client_golang/prometheus"
 )
 
@@ -28,12 +30,60 @@ type Metrics struct {
 	PersistentVolumeClaimProvisionFailedTotal *prometheus.CounterVec
 	// PersistentVolumeClaimProvisionDurationSeconds is used to collect latency in seconds to provision persistent volumes.
 	PersistentVolumeClaimProvisionDurationSeconds *prometheus.HistogramVec
+	// PersistentVolumeClaimProvisionRetryFailures is used to collect current number of consecutive provision failures of claims retried with backoff.
+	PersistentVolumeClaimProvisionRetryFailures *prometheus.GaugeVec
+	// PersistentVolumeClaimProvisionNextRetryTimestampSeconds is used to collect time of the next provision retry of claims retried with backoff.
+	PersistentVolumeClaimProvisionNextRetryTimestampSeconds *prometheus.GaugeVec
+	// PersistentVolumeClaimProvisionInFlight is used to collect current number of Provision calls in progress.
+	PersistentVolumeClaimProvisionInFlight prometheus.Gauge
+	// PersistentVolumeDeleteInFlight is used to collect current number of Delete calls in progress.
+	PersistentVolumeDeleteInFlight prometheus.Gauge
+	// InFlightOperations is used to collect current number of Provision and Delete calls limited by MaxInFlightOperations.
+	InFlightOperations prometheus.Gauge
+	// PersistentVolumeClaimProvisionInFlightPerNode is used to collect current number of Provision calls limited by PerNodeProvisionConcurrency.
+	PersistentVolumeClaimProvisionInFlightPerNode *prometheus.GaugeVec
 	// PersistentVolumeDeleteTotal is used to collect accumulated count of persistent volumes deleted.
 	PersistentVolumeDeleteTotal *prometheus.CounterVec
 	// PersistentVolumeDeleteFailedTotal is used to collect accumulated count of persistent volume delete failed attempts.
 	PersistentVolumeDeleteFailedTotal *prometheus.CounterVec
 	// PersistentVolumeDeleteDurationSeconds is used to collect latency in seconds to delete persistent volumes.
 	PersistentVolumeDeleteDurationSeconds *prometheus.HistogramVec
+	// PersistentVolumeClaimRescheduleTotal is used to collect accumulated count of claims whose selected node was removed.
+	PersistentVolumeClaimRescheduleTotal *prometheus.CounterVec
+	// PersistentVolumesPendingSave is used to collect current number of provisioned persistent volumes not saved to API server yet.
+	PersistentVolumesPendingSave prometheus.Gauge
+	// PersistentVolumeSaveFailedTotal is used to collect accumulated count of failed attempts to save persistent volumes to API server.
+	PersistentVolumeSaveFailedTotal *prometheus.CounterVec
+	// PersistentVolumesAbandonedTotal is used to collect accumulated count of provisioned persistent volumes not saved to API server before shutdown.
+	PersistentVolumesAbandonedTotal *prometheus.CounterVec
+	// PersistentVolumeDriftDetectedTotal is used to collect accumulated count of persistent volumes modified out-of-band after they were provisioned.
+	PersistentVolumeDriftDetectedTotal *prometheus.CounterVec
+	// RetryAfterRequeuesTotal is used to collect accumulated count of requeues delayed by RetryAfter of a provisioner error.
+	RetryAfterRequeuesTotal *prometheus.CounterVec
+	// Paused is used to expose whether the controller is paused, 1 when it is and 0 otherwise.
+	Paused prometheus.Gauge
+	// BuildInfo is used to expose library version and configuration of the controller, its value is always 1.
+	BuildInfo *prometheus.GaugeVec
+}
+
+// BuildInfoLabels are the labels of BuildInfo metric.
+var BuildInfoLabels = []string{
+	"provisioner",
+	"library_version",
+	"leader_election",
+	"provision_threadiness",
+	"deletion_threadiness",
+	"resync_period",
+	"exponential_backoff_on_error",
+	"failed_provision_threshold",
+	"failed_delete_threshold",
+	"add_finalizer",
+	"deletion_disabled",
+	"provisioning_disabled",
+	"client_qps",
+	"client_burst",
+	"user_agent",
+	"features",
 }
 
 // New creates a new set of metrics with the goven subsystem name.
@@ -64,6 +114,51 @@ func New(subsystem string) Metrics {
 			},
 			[]string{"class", "source"},
 		),
+		PersistentVolumeClaimProvisionRetryFailures: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Subsystem: subsystem,
+				Name:      "persistentvolumeclaim_provision_retry_failures",
+				Help:      "Number of consecutive provision failures of claims retried with backoff. Broken down by UID of the claim.",
+			},
+			[]string{"claim"},
+		),
+		PersistentVolumeClaimProvisionNextRetryTimestampSeconds: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Subsystem: subsystem,
+				Name:      "persistentvolumeclaim_provision_next_retry_timestamp_seconds",
+				Help:      "Unix time of the next provision retry of claims retried with backoff. Broken down by UID of the claim.",
+			},
+			[]string{"claim"},
+		),
+		PersistentVolumeClaimProvisionInFlight: prometheus.NewGauge(
+			prometheus.GaugeOpts{
+				Subsystem: subsystem,
+				Name:      "persistentvolumeclaim_provision_in_flight",
+				Help:      "Number of Provision calls in progress.",
+			},
+		),
+		PersistentVolumeDeleteInFlight: prometheus.NewGauge(
+			prometheus.GaugeOpts{
+				Subsystem: subsystem,
+				Name:      "persistentvolume_delete_in_flight",
+				Help:      "Number of Delete calls in progress.",
+			},
+		),
+		InFlightOperations: prometheus.NewGauge(
+			prometheus.GaugeOpts{
+				Subsystem: subsystem,
+				Name:      "in_flight_operations",
+				Help:      "Number of Provision and Delete calls in progress that count towards MaxInFlightOperations.",
+			},
+		),
+		PersistentVolumeClaimProvisionInFlightPerNode: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Subsystem: subsystem,
+				Name:      "persistentvolumeclaim_provision_in_flight_per_node",
+				Help:      "Number of Provision calls in progress that count towards PerNodeProvisionConcurrency. Broken down by selected node, only nodes with calls in progress are reported.",
+			},
+			[]string{"node"},
+		),
 		PersistentVolumeDeleteTotal: prometheus.NewCounterVec(
 			prometheus.CounterOpts{
 				Subsystem: subsystem,
@@ -89,5 +184,118 @@ func New(subsystem string) Metrics {
 			},
 			[]string{"class"},
 		),
+		PersistentVolumeClaimRescheduleTotal: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Subsystem: subsystem,
+				Name:      "claim_reschedule_total",
+				Help:      "Total number of claims whose selected node was removed to let the scheduler pick another node. Broken down by storage class name and reason.",
+			},
+			[]string{"class", "reason"},
+		),
+		PersistentVolumesPendingSave: prometheus.NewGauge(
+			prometheus.GaugeOpts{
+				Subsystem: subsystem,
+				Name:      "volumes_pending_save",
+				Help:      "Number of provisioned persistent volumes that are not saved to API server yet.",
+			},
+		),
+		PersistentVolumeSaveFailedTotal: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Subsystem: subsystem,
+				Name:      "volume_save_failures_total",
+				Help:      "Total number of failed attempts to save provisioned persistent volumes to API server. Broken down by storage class name.",
+			},
+			[]string{"class"},
+		),
+		PersistentVolumesAbandonedTotal: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Subsystem: subsystem,
+				Name:      "volumes_abandoned_total",
+				Help:      "Total number of provisioned persistent volumes that were not saved to API server before shutdown and whose storage assets must be recovered manually. Broken down by storage class name.",
+			},
+			[]string{"class"},
+		),
+		PersistentVolumeDriftDetectedTotal: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Subsystem: subsystem,
+				Name:      "volume_drift_detected_total",
+				Help:      "Total number of persistent volumes whose provisioned-by annotation, claimRef or source was modified after they were provisioned. Broken down by storage class name.",
+			},
+			[]string{"class"},
+		),
+		RetryAfterRequeuesTotal: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Subsystem: subsystem,
+				Name:      "retry_after_requeues_total",
+				Help:      "Total number of claims and volumes requeued after the delay requested by a provisioner error instead of the rate limiter. Broken down by work queue.",
+			},
+			[]string{"queue"},
+		),
+		Paused: prometheus.NewGauge(
+			prometheus.GaugeOpts{
+				Subsystem: subsystem,
+				Name:      "paused",
+				Help:      "Whether the controller is paused and takes no new claims and volumes from its queues, 1 when it is and 0 otherwise.",
+			},
+		),
+		BuildInfo: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Subsystem: subsystem,
+				Name:      "build_info",
+				Help:      "A metric with a constant '1' value labeled by provisioner name, library version and options the controller runs with.",
+			},
+			BuildInfoLabels,
+		),
+	}
+}
+
+// WithDefaults returns m with its nil collectors replaced by the ones of
+// New(subsystem), e.g. for collections that were created before the newer
+// fields were added.
+func (m Metrics) WithDefaults(subsystem string) Metrics {
+	defaults := New(subsystem)
+	value := reflect.ValueOf(&m).Elem()
+	for i := 0; i < value.NumField(); i++ {
+		if field := value.Field(i); field.IsNil() {
+			field.Set(reflect.ValueOf(defaults).Field(i))
+		}
+	}
+	return m
+}
+
+// Collectors returns all non-nil collectors of the metrics collection, e.g. to
+// register them with a prometheus.Registerer.
+func (m Metrics) Collectors() []prometheus.Collector {
+	var collectors []prometheus.Collector
+	for _, collector := range m.allCollectors() {
+		if collector != nil && !reflect.ValueOf(collector).IsNil() {
+			collectors = append(collectors, collector)
+		}
+	}
+	return collectors
+}
+
+func (m Metrics) allCollectors() []prometheus.Collector {
+	return []prometheus.Collector{
+		m.PersistentVolumeClaimProvisionTotal,
+		m.PersistentVolumeClaimProvisionFailedTotal,
+		m.PersistentVolumeClaimProvisionDurationSeconds,
+		m.PersistentVolumeClaimProvisionRetryFailures,
+		m.PersistentVolumeClaimProvisionNextRetryTimestampSeconds,
+		m.PersistentVolumeClaimProvisionInFlight,
+		m.PersistentVolumeDeleteInFlight,
+		m.InFlightOperations,
+		m.PersistentVolumeClaimProvisionInFlightPerNode,
+		m.PersistentVolumeDeleteTotal,
+		m.PersistentVolumeDeleteFailedTotal,
+		m.PersistentVolumeDeleteDurationSeconds,
+		m.PersistentVolumeClaimRescheduleTotal,
+		m.PersistentVolumesPendingSave,
+		m.PersistentVolumeSaveFailedTotal,
+		m.PersistentVolumesAbandonedTotal,
+		m.PersistentVolumeDriftDetectedTotal,
+		m.RetryAfterRequeuesTotal,
+		m.Paused,
+		m.BuildInfo,
 	}
 }
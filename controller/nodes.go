@@ -0,0 +1,215 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	storage "k8s.io/api/storage/v1"
+	apierrs "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/informers"
+	corelistersv1 "k8s.io/client-go/listers/core/v1"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/sig-storage-lib-external-provisioner/v10/topology"
+)
+
+// Nodes returns a lister of Nodes for provisioners that need node data, e.g.
+// for topology-aware provisioning. It returns the lister passed by
+// NodesLister if any. Otherwise a node informer is created on the first call,
+// from the factory passed by SharedInformerFactory if any, and started when
+// the controller runs. Its cache may not be synced yet, callers should fall
+// back to a GET when a node is not found.
+//
+// The controller itself uses the lister only for claims with a selected
+// node, i.e. claims of StorageClasses with WaitForFirstConsumer binding, and
+// for deleted volumes of a NodeDeleter, so no node watch is opened unless
+// such claims, volumes or provisioners need it.
+func (ctrl *ProvisionController) Nodes() corelistersv1.NodeLister {
+	ctrl.nodeLock.Lock()
+	defer ctrl.nodeLock.Unlock()
+	if ctrl.nodeLister != nil {
+		return ctrl.nodeLister
+	}
+
+	factory := ctrl.informerFactory
+	if factory == nil {
+		factory = informers.NewSharedInformerFactory(ctrl.objectClient, ctrl.resyncPeriod)
+	}
+	ctrl.nodeInformerFactory = factory
+	ctrl.nodeLister = factory.Core().V1().Nodes().Lister()
+	if ctrl.nodeStopCh != nil {
+		factory.Start(ctrl.nodeStopCh)
+	}
+	return ctrl.nodeLister
+}
+
+// startNodeInformer starts the node informer created by Nodes, now or when
+// it is created.
+func (ctrl *ProvisionController) startNodeInformer(stopCh <-chan struct{}) {
+	ctrl.nodeLock.Lock()
+	defer ctrl.nodeLock.Unlock()
+	ctrl.nodeStopCh = stopCh
+	if ctrl.nodeInformerFactory != nil {
+		// Start is a no-op for informers that are already running.
+		ctrl.nodeInformerFactory.Start(stopCh)
+	}
+}
+
+// waitForNodes waits until the node informer created by Nodes has synced.
+// It returns immediately when the lister was passed by NodesLister, its
+// informer is not known.
+func (ctrl *ProvisionController) waitForNodes(ctx context.Context) {
+	ctrl.Nodes()
+	ctrl.nodeLock.Lock()
+	factory := ctrl.nodeInformerFactory
+	ctrl.nodeLock.Unlock()
+	if factory != nil {
+		factory.WaitForCacheSync(ctx.Done())
+	}
+}
+
+// getNode returns the node from the lister or, if it is not in the cache
+// (yet), from API server.
+func (ctrl *ProvisionController) getNode(ctx context.Context, name string) (*v1.Node, error) {
+	node, err := ctrl.Nodes().Get(name)
+	if err == nil || !apierrs.IsNotFound(err) {
+		return node, err
+	}
+	return ctrl.objectClient.CoreV1().Nodes().Get(ctx, name, metav1.GetOptions{})
+}
+
+// missingVolumeNode returns the node of a node-local volume, see NodeDeleter,
+// when it has been missing for longer than missingNodeGracePeriod. It returns
+// "" when the provisioner does not implement NodeDeleter, the volume is not
+// node-local or its node exists or was not missing for long enough.
+func (ctrl *ProvisionController) missingVolumeNode(ctx context.Context, volume *v1.PersistentVolume) (string, error) {
+	if _, ok := ctrl.provisioner.(NodeDeleter); !ok {
+		return "", nil
+	}
+	hostnames := topology.AffinityValues(volume.Spec.NodeAffinity, v1.LabelHostname)
+	if len(hostnames) != 1 {
+		return "", nil
+	}
+	nodeName := hostnames[0]
+	exists, err := ctrl.nodeExists(ctx, nodeName)
+	if err != nil {
+		return "", err
+	}
+	if exists {
+		ctrl.missingNodes.Delete(nodeName)
+		return "", nil
+	}
+	since, _ := ctrl.missingNodes.LoadOrStore(nodeName, ctrl.clock.Now())
+	if ctrl.clock.Since(since.(time.Time)) < ctrl.missingNodeGracePeriod {
+		klog.FromContext(ctx).V(4).Info("Node of the volume is missing, deleting the volume normally until the grace period expires", "node", nodeName, "missingSince", since)
+		return "", nil
+	}
+	return nodeName, nil
+}
+
+// nodeExists returns whether a node with the given hostname label exists. A
+// node missing in the lister, which may be stale or not synced yet, is
+// confirmed by a GET of the node by name and, because the hostname label may
+// differ from the name, a list of nodes with the label.
+func (ctrl *ProvisionController) nodeExists(ctx context.Context, hostname string) (bool, error) {
+	selector := labels.SelectorFromSet(labels.Set{v1.LabelHostname: hostname})
+	nodes, err := ctrl.Nodes().List(selector)
+	if err != nil || len(nodes) > 0 {
+		return len(nodes) > 0, err
+	}
+	_, err = ctrl.objectClient.CoreV1().Nodes().Get(ctx, hostname, metav1.GetOptions{})
+	if err == nil || !apierrs.IsNotFound(err) {
+		return err == nil, err
+	}
+	list, err := ctrl.objectClient.CoreV1().Nodes().List(ctx, metav1.ListOptions{LabelSelector: selector.String()})
+	if err != nil {
+		return false, err
+	}
+	return len(list.Items) > 0, nil
+}
+
+// deleteVolumeForMissingNode deletes a volume whose node is missing with
+// DeleteVolumeForMissingNode of the provisioner.
+func (ctrl *ProvisionController) deleteVolumeForMissingNode(ctx context.Context, volume *v1.PersistentVolume, nodeName string) error {
+	klog.FromContext(ctx).Info("Node of the volume is missing, deleting the volume with DeleteVolumeForMissingNode", "node", nodeName)
+	ctrl.event(volume, v1.EventTypeWarning, "DeletingVolumeForMissingNode", fmt.Sprintf(
+		"Node %q of the volume no longer exists, forcing cleanup with DeleteVolumeForMissingNode instead of Delete", nodeName))
+	if err := ctrl.provisioner.(NodeDeleter).DeleteVolumeForMissingNode(ctx, volume); err != nil {
+		if isIgnoredError(err) {
+			return err
+		}
+		return fmt.Errorf("forced cleanup of volume of missing node %q failed: %w", nodeName, err)
+	}
+	return nil
+}
+
+// rescheduleUnusableNode removes the selected node annotation of claim whose
+// selected node cannot be used, e.g. it was deleted. Unlike a reschedule
+// requested by the provisioner, this is not a provisioning failure: the
+// claim is not retried with backoff, it waits for the scheduler to select
+// another node.
+func (ctrl *ProvisionController) rescheduleUnusableNode(ctx context.Context, claim *v1.PersistentVolumeClaim, message, reason string) (ProvisioningState, error) {
+	logger := klog.FromContext(ctx)
+	if err := ctrl.rescheduleProvisioning(ctx, claim, reason); err != nil {
+		logger.Info("Volume rescheduling failed", "err", err)
+		return ProvisioningFinished, err
+	}
+	ctrl.event(claim, v1.EventTypeNormal, "WaitingForReschedule", message)
+	logger.V(2).Info("Volume rescheduled", "reason", message)
+	return ProvisioningFinished, errWaitingForReschedule
+}
+
+// canMoveClaim returns true if claim can be moved to another node before
+// calling Provision, i.e. its StorageClass uses WaitForFirstConsumer binding
+// and provisioning has not started in background. A volume that may be
+// provisioned already must stay on its node.
+func (ctrl *ProvisionController) canMoveClaim(claim *v1.PersistentVolumeClaim, class *storage.StorageClass) bool {
+	if class.VolumeBindingMode == nil || *class.VolumeBindingMode != storage.VolumeBindingWaitForFirstConsumer {
+		return false
+	}
+	_, inProgress := ctrl.claimsInProgress.Load(string(claim.UID))
+	return !inProgress
+}
+
+// unschedulableNodeReason returns why new pods cannot run on node, i.e. it
+// is cordoned or has one of the taints set by AvoidUnschedulableNodes, or ""
+// when they can.
+func (ctrl *ProvisionController) unschedulableNodeReason(node *v1.Node) string {
+	if node.Spec.Unschedulable {
+		return "is cordoned"
+	}
+	for _, avoided := range ctrl.avoidedNodeTaints {
+		for _, taint := range node.Spec.Taints {
+			if taint.Key != avoided.Key {
+				continue
+			}
+			if avoided.Value != "" && taint.Value != avoided.Value {
+				continue
+			}
+			if avoided.Effect != "" && taint.Effect != avoided.Effect {
+				continue
+			}
+			return fmt.Sprintf("has taint %s", taint.ToString())
+		}
+	}
+	return ""
+}
@@ -0,0 +1,85 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+// Pause stops the workers from taking new claims and volumes from the queues,
+// e.g. during a maintenance window of the storage backend, until Resume is
+// called. Provision and Delete calls in progress complete normally.
+// Informers, leader election and the queues keep running: claims and volumes
+// that change while paused are queued and processed after Resume, their
+// retry state is kept. The Paused metric is 1 while paused and Ready fails if
+// ReadyWhenPaused is false. It may be called before Run and from any
+// goroutine, pausing a paused controller does nothing.
+func (ctrl *ProvisionController) Pause() {
+	ctrl.setState(func() {
+		if ctrl.paused {
+			return
+		}
+		ctrl.paused = true
+		if !ctrl.workersStopped {
+			ctrl.unpaused = make(chan struct{})
+		}
+	})
+	ctrl.metrics.Paused.Set(1)
+}
+
+// Resume lets the workers process the claims and volumes queued since Pause.
+// Resuming a controller that is not paused does nothing.
+func (ctrl *ProvisionController) Resume() {
+	ctrl.setState(func() {
+		if !ctrl.paused {
+			return
+		}
+		ctrl.paused = false
+		ctrl.releaseWorkers()
+	})
+	ctrl.metrics.Paused.Set(0)
+}
+
+// Paused returns whether the controller is paused, see Pause.
+func (ctrl *ProvisionController) Paused() bool {
+	ctrl.stateLock.Lock()
+	defer ctrl.stateLock.Unlock()
+	return ctrl.paused
+}
+
+// waitUntilResumed blocks a worker while the controller is paused.
+func (ctrl *ProvisionController) waitUntilResumed() {
+	ctrl.stateLock.Lock()
+	unpaused := ctrl.unpaused
+	ctrl.stateLock.Unlock()
+	if unpaused != nil {
+		<-unpaused
+	}
+}
+
+// stopPausedWorkers releases the workers blocked by Pause so that they see
+// the shut down queues and exit. Run calls it when it stops.
+func (ctrl *ProvisionController) stopPausedWorkers() {
+	ctrl.setState(func() {
+		ctrl.workersStopped = true
+		ctrl.releaseWorkers()
+	})
+}
+
+// releaseWorkers unblocks waitUntilResumed, stateLock must be held.
+func (ctrl *ProvisionController) releaseWorkers() {
+	if ctrl.unpaused != nil {
+		close(ctrl.unpaused)
+		ctrl.unpaused = nil
+	}
+}
@@ -0,0 +1,41 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"net/http"
+	"net/http/pprof"
+)
+
+// profilingPath is the prefix of profiling endpoints on the metrics server.
+const profilingPath = "/debug/pprof/"
+
+// handleProfiling mounts the net/http/pprof handlers under profilingPath of
+// mux when profiling is enabled. Importing net/http/pprof also registers them
+// on http.DefaultServeMux, which the metrics server falls back to, so they are
+// hidden when profiling is disabled.
+func (ctrl *ProvisionController) handleProfiling(mux *http.ServeMux) {
+	if !ctrl.enableProfiling {
+		mux.Handle(profilingPath, http.NotFoundHandler())
+		return
+	}
+	mux.HandleFunc(profilingPath, pprof.Index)
+	mux.HandleFunc(profilingPath+"cmdline", pprof.Cmdline)
+	mux.HandleFunc(profilingPath+"profile", pprof.Profile)
+	mux.HandleFunc(profilingPath+"symbol", pprof.Symbol)
+	mux.HandleFunc(profilingPath+"trace", pprof.Trace)
+}
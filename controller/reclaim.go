@@ -0,0 +1,52 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+
+	v1 "k8s.io/api/core/v1"
+	apierrs "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	klog "k8s.io/klog/v2"
+)
+
+// deletedBeforeClaim returns whether the volume was deleted before its claim
+// and its storage asset must be deleted although it is not Released, see
+// HonorPVReclaimPolicy. That is when the volume has a deletionTimestamp and
+// the finalizer and its claim no longer exists. A claim that may exist keeps
+// the storage asset, it may still be used.
+func (ctrl *ProvisionController) deletedBeforeClaim(ctx context.Context, volume *v1.PersistentVolume) bool {
+	if !ctrl.honorReclaimPolicy || volume.DeletionTimestamp == nil || !ctrl.checkFinalizer(volume, ctrl.pvFinalizer) {
+		return false
+	}
+	claimRef := volume.Spec.ClaimRef
+	if claimRef == nil {
+		return true
+	}
+	claim, err := ctrl.objectClient.CoreV1().PersistentVolumeClaims(claimRef.Namespace).Get(ctx, claimRef.Name, metav1.GetOptions{})
+	if apierrs.IsNotFound(err) {
+		return true
+	}
+	if err != nil {
+		klog.FromContext(ctx).Error(err, "Failed to get the claim of the deleted volume", "PVC", klog.KRef(claimRef.Namespace, claimRef.Name))
+		return false
+	}
+	// A claim with the same name that replaced the claim of the volume
+	// does not use it.
+	return claimRef.UID != "" && claim.UID != claimRef.UID
+}
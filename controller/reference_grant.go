@@ -0,0 +1,91 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+var referenceGrantResource = schema.GroupVersionResource{Group: "gateway.networking.k8s.io", Version: "v1beta1", Resource: "referencegrants"}
+
+// crossNamespaceDataSource returns the namespace of the data source of the
+// claim if it is not the claim's namespace.
+func crossNamespaceDataSource(claim *v1.PersistentVolumeClaim) (string, bool) {
+	_, _, namespace, _, found := claimDataSource(claim)
+	if !found || namespace == claim.Namespace {
+		return "", false
+	}
+	return namespace, true
+}
+
+// dataSourceGranted returns whether a ReferenceGrant in the namespace of the
+// claim's data source allows claims of the claim's namespace to use it.
+func (ctrl *ProvisionController) dataSourceGranted(ctx context.Context, claim *v1.PersistentVolumeClaim) (bool, error) {
+	group, kind, namespace, name, _ := claimDataSource(claim)
+	grants, err := ctrl.dynamicClient.Resource(referenceGrantResource).Namespace(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return false, fmt.Errorf("failed to list ReferenceGrants in namespace %s: %v", namespace, err)
+	}
+	for _, grant := range grants.Items {
+		if referenceGrantAllows(grant, claim.Namespace, group, kind, name) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// referenceGrantAllows returns whether grant has a "from" entry of claims in
+// namespace and a "to" entry of the object with group, kind and name, or of
+// all objects of the group and kind.
+func referenceGrantAllows(grant unstructured.Unstructured, namespace, group, kind, name string) bool {
+	froms, _, _ := unstructured.NestedSlice(grant.Object, "spec", "from")
+	from := false
+	for _, obj := range froms {
+		entry, ok := obj.(map[string]interface{})
+		if ok && entryField(entry, "group") == "" && entryField(entry, "kind") == "PersistentVolumeClaim" && entryField(entry, "namespace") == namespace {
+			from = true
+			break
+		}
+	}
+	if !from {
+		return false
+	}
+	tos, _, _ := unstructured.NestedSlice(grant.Object, "spec", "to")
+	for _, obj := range tos {
+		entry, ok := obj.(map[string]interface{})
+		if !ok || entryField(entry, "group") != group || entryField(entry, "kind") != kind {
+			continue
+		}
+		if toName := entryField(entry, "name"); toName == "" || toName == name {
+			return true
+		}
+	}
+	return false
+}
+
+// entryField returns a string field of a from or to entry of a
+// ReferenceGrant, "" when it is not set.
+func entryField(entry map[string]interface{}, field string) string {
+	value, _ := entry[field].(string)
+	return value
+}
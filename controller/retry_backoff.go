@@ -0,0 +1,170 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/util/workqueue"
+	"k8s.io/utils/clock"
+)
+
+// retryBackoff is the workqueue.RateLimiter of claims with
+// ProvisionRetryBackoff, globally or in ClassOverrides. The delay of the n-th
+// retry of a claim with backoff is backoff.Duration * backoff.Factor^(n-1),
+// jittered and capped at backoff.Cap. backoff.Steps is ignored, claims are
+// retried forever. Claims without backoff are delayed by the base limiter.
+type retryBackoff struct {
+	// backoffFor returns the current backoff of a claim, nil for base.
+	backoffFor func(item interface{}) *wait.Backoff
+	base       workqueue.RateLimiter
+	clock      clock.PassiveClock
+
+	// Failures and next retry time per claim, can be nil.
+	failuresGauge  *prometheus.GaugeVec
+	nextRetryGauge *prometheus.GaugeVec
+
+	lock     sync.Mutex
+	failures map[interface{}]int
+}
+
+var _ workqueue.RateLimiter = &retryBackoff{}
+
+func newRetryBackoff(backoffFor func(item interface{}) *wait.Backoff, base workqueue.RateLimiter, clock clock.PassiveClock, failuresGauge, nextRetryGauge *prometheus.GaugeVec) *retryBackoff {
+	return &retryBackoff{
+		backoffFor:     backoffFor,
+		base:           base,
+		clock:          clock,
+		failuresGauge:  failuresGauge,
+		nextRetryGauge: nextRetryGauge,
+		failures:       make(map[interface{}]int),
+	}
+}
+
+// When records a failure of item and returns the delay of its next retry.
+func (b *retryBackoff) When(item interface{}) time.Duration {
+	// Resolved before locking, backoffFor may look up the claim.
+	backoff := b.backoffFor(item)
+
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	failures := b.failures[item]
+	b.failures[item] = failures + 1
+
+	var delay time.Duration
+	if backoff != nil {
+		delay = backoffDelay(*backoff, failures)
+	} else {
+		delay = b.base.When(item)
+	}
+
+	key := fmt.Sprint(item)
+	if b.failuresGauge != nil {
+		b.failuresGauge.WithLabelValues(key).Set(float64(failures + 1))
+	}
+	if b.nextRetryGauge != nil {
+		b.nextRetryGauge.WithLabelValues(key).Set(float64(b.clock.Now().Add(delay).UnixNano()) / float64(time.Second))
+	}
+	return delay
+}
+
+// Forget resets the failures of item, e.g. after the claim was provisioned
+// or updated.
+func (b *retryBackoff) Forget(item interface{}) {
+	b.base.Forget(item)
+
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if _, found := b.failures[item]; !found {
+		return
+	}
+	delete(b.failures, item)
+	key := fmt.Sprint(item)
+	if b.failuresGauge != nil {
+		b.failuresGauge.DeleteLabelValues(key)
+	}
+	if b.nextRetryGauge != nil {
+		b.nextRetryGauge.DeleteLabelValues(key)
+	}
+}
+
+// restore sets the failures of item, e.g. recorded by a previous instance of
+// the controller.
+func (b *retryBackoff) restore(item interface{}, failures int) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.failures[item] = failures
+	if b.failuresGauge != nil {
+		b.failuresGauge.WithLabelValues(fmt.Sprint(item)).Set(float64(failures))
+	}
+}
+
+// NumRequeues returns the number of failures of item.
+func (b *retryBackoff) NumRequeues(item interface{}) int {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	return b.failures[item]
+}
+
+// defaultRetryBackoffCap replaces a zero Cap of ProvisionRetryBackoff and
+// ClassOverrides, delays of uncapped backoffs overflow after enough failures.
+const defaultRetryBackoffCap = 5 * time.Minute
+
+// withDefaultCap returns backoff with Cap set to defaultRetryBackoffCap, or
+// backoff.Duration if it's longer, when it's not set.
+func withDefaultCap(backoff wait.Backoff) wait.Backoff {
+	if backoff.Cap <= 0 {
+		backoff.Cap = defaultRetryBackoffCap
+		if backoff.Duration > backoff.Cap {
+			backoff.Cap = backoff.Duration
+		}
+	}
+	return backoff
+}
+
+// backoffDelay returns the delay of a retry after the given number of
+// previous failures. The delay is computed as float64 and clamped at
+// backoff.Cap, or defaultRetryBackoffCap if it's not set, before it's
+// converted to time.Duration so it can't overflow.
+func backoffDelay(backoff wait.Backoff, failures int) time.Duration {
+	backoff = withDefaultCap(backoff)
+	factor := backoff.Factor
+	if factor < 1 {
+		factor = 1
+	}
+	limit := float64(backoff.Cap)
+	delay := float64(backoff.Duration)
+	for i := 0; i < failures && delay < limit; i++ {
+		delay *= factor
+	}
+	if backoff.Jitter > 0 {
+		delay += rand.Float64() * backoff.Jitter * delay
+	}
+	if delay > limit {
+		return backoff.Cap
+	}
+	return time.Duration(delay)
+}
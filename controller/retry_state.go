@@ -0,0 +1,118 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrs "k8s.io/apimachinery/pkg/api/errors"
+	klog "k8s.io/klog/v2"
+)
+
+const (
+	// Suffixes of the annotations recording the ProvisionRetryBackoff
+	// position of a claim with PersistRetryState, prefixed by the
+	// provisioner name like those of recordGiveUp.
+	AnnProvisionAttemptsSuffix = "/provision-attempts"
+	AnnLastAttemptSuffix       = "/last-attempt"
+)
+
+// recordRetryState records on the claim with the given queue key how many
+// provisioning attempts failed and when the last one did.
+func (ctrl *ProvisionController) recordRetryState(ctx context.Context, key string, failures int) {
+	if !ctrl.persistRetryState {
+		return
+	}
+	claim := ctrl.claimByKey(key)
+	if claim == nil {
+		return
+	}
+	// A merge patch has no resourceVersion precondition, it can't conflict
+	// with other writers of the claim.
+	err := ctrl.patchClaimAnnotations(ctx, claim, map[string]interface{}{
+		ctrl.annProvisionAttempts: strconv.Itoa(failures),
+		ctrl.annLastAttempt:       ctrl.clock.Now().UTC().Format(time.RFC3339Nano),
+	})
+	if err != nil && !apierrs.IsNotFound(err) {
+		// The claim is retried anyway, only a restart would retry it early.
+		klog.FromContext(ctx).Error(err, "Failed to record retry state of claim", "PVC", klog.KObj(claim))
+	}
+}
+
+// restoreRetryState continues the backoff of the claim with the given queue
+// key from its annotations, once per claim after the controller started.
+// Returns the remaining delay of the next attempt and whether the state was
+// restored. State older than the backoff cap is ignored.
+func (ctrl *ProvisionController) restoreRetryState(key string) (time.Duration, bool) {
+	if !ctrl.persistRetryState {
+		return 0, false
+	}
+	if _, checked := ctrl.retryStateChecked.LoadOrStore(key, struct{}{}); checked {
+		return 0, false
+	}
+	claim := ctrl.claimByKey(key)
+	if claim == nil {
+		return 0, false
+	}
+	backoff := ctrl.claimRetryBackoffFor(key)
+	if backoff == nil {
+		return 0, false
+	}
+	failures, err := strconv.Atoi(claim.Annotations[ctrl.annProvisionAttempts])
+	if err != nil || failures <= 0 {
+		return 0, false
+	}
+	lastAttempt, err := time.Parse(time.RFC3339Nano, claim.Annotations[ctrl.annLastAttempt])
+	if err != nil {
+		return 0, false
+	}
+	elapsed := ctrl.clock.Since(lastAttempt)
+	if backoff.Cap > 0 && elapsed > backoff.Cap {
+		return 0, false
+	}
+	ctrl.claimRetryBackoff.restore(key, failures)
+	return backoffDelay(*backoff, failures-1) - elapsed, true
+}
+
+// ownAnnotationUpdate returns true when an update of a claim changed only
+// the annotations of recordGiveUp and recordRetryState. The controller's own
+// writes must not retry the claim right away, bypassing its backoff.
+func (ctrl *ProvisionController) ownAnnotationUpdate(oldObj, newObj interface{}) bool {
+	oldClaim, ok := oldObj.(*v1.PersistentVolumeClaim)
+	if !ok {
+		return false
+	}
+	newClaim, ok := newObj.(*v1.PersistentVolumeClaim)
+	if !ok {
+		return false
+	}
+	changed := false
+	for _, ann := range ctrl.failureAnnotations() {
+		changed = changed || oldClaim.Annotations[ann] != newClaim.Annotations[ann]
+	}
+	return changed &&
+		equality.Semantic.DeepEqual(oldClaim.Spec, newClaim.Spec) &&
+		equality.Semantic.DeepEqual(oldClaim.Status, newClaim.Status) &&
+		equality.Semantic.DeepEqual(oldClaim.Labels, newClaim.Labels) &&
+		equality.Semantic.DeepEqual(oldClaim.Finalizers, newClaim.Finalizers) &&
+		equality.Semantic.DeepEqual(oldClaim.DeletionTimestamp, newClaim.DeletionTimestamp) &&
+		equality.Semantic.DeepEqual(ctrl.userAnnotations(oldClaim), ctrl.userAnnotations(newClaim))
+}
@@ -0,0 +1,107 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+
+	v1 "k8s.io/api/core/v1"
+	apierrs "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	corev1ac "k8s.io/client-go/applyconfigurations/core/v1"
+	klog "k8s.io/klog/v2"
+)
+
+// volumeApplier is the part of the PV client used with UseServerSideApply.
+// Tests replace it, the fake clientset can't create objects with Apply
+// patches.
+type volumeApplier interface {
+	Get(ctx context.Context, name string, opts metav1.GetOptions) (*v1.PersistentVolume, error)
+	Apply(ctx context.Context, volume *corev1ac.PersistentVolumeApplyConfiguration, opts metav1.ApplyOptions) (*v1.PersistentVolume, error)
+}
+
+// fieldManager returns the field manager of the Apply patches of the
+// controller.
+func (ctrl *ProvisionController) fieldManager() string {
+	return ctrl.provisionerName + "-provisioner"
+}
+
+// applyVolume applies config, which holds only fields the field manager of
+// the controller already owns, see corev1ac.ExtractPersistentVolume. On a
+// conflict with another field manager, the fields are applied again with
+// force.
+func (ctrl *ProvisionController) applyVolume(ctx context.Context, config *corev1ac.PersistentVolumeApplyConfiguration) (*v1.PersistentVolume, error) {
+	opts := metav1.ApplyOptions{FieldManager: ctrl.fieldManager()}
+	volume, err := ctrl.volumeApplier.Apply(ctx, config, opts)
+	if apierrs.IsConflict(err) {
+		klog.FromContext(ctx).V(2).Info("Conflict applying volume, forcing fields owned by the controller", "PV", *config.Name, "err", err)
+		opts.Force = true
+		volume, err = ctrl.volumeApplier.Apply(ctx, config, opts)
+	}
+	return volume, err
+}
+
+// createVolumeWithApply saves a provisioned volume with an Apply patch. All
+// its fields are set by the provisioner or the controller and owned by the
+// controller. Apply would also overwrite a PV that exists already, so an
+// existing PV is compared with volume like by adoptExistingVolume instead.
+// The Apply is never forced, a conflict means that someone else created the
+// PV meanwhile and the next attempt compares it.
+func (ctrl *ProvisionController) createVolumeWithApply(ctx context.Context, volume *v1.PersistentVolume) error {
+	existing, err := ctrl.volumeApplier.Get(ctx, volume.Name, metav1.GetOptions{})
+	if err == nil {
+		return checkExistingVolume(klog.FromContext(ctx), existing, volume)
+	}
+	if !apierrs.IsNotFound(err) {
+		return fmt.Errorf("failed to get existing PV %s: %v", volume.Name, err)
+	}
+	data, err := json.Marshal(volume)
+	if err != nil {
+		return err
+	}
+	config := corev1ac.PersistentVolume(volume.Name)
+	if err := json.Unmarshal(data, config); err != nil {
+		return err
+	}
+	// Status is not applied to the main resource.
+	config.Status = nil
+	_, err = ctrl.volumeApplier.Apply(ctx, config, metav1.ApplyOptions{FieldManager: ctrl.fieldManager()})
+	return err
+}
+
+// applyVolumeFinalizer adds or removes the PV finalizer with an Apply patch of the
+// fields the controller owns in the current volume, so that fields set by
+// others since the volume was cached are left alone.
+func (ctrl *ProvisionController) applyVolumeFinalizer(ctx context.Context, name string, add bool) (*v1.PersistentVolume, error) {
+	current, err := ctrl.volumeApplier.Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	config, err := corev1ac.ExtractPersistentVolume(current, ctrl.fieldManager())
+	if err != nil {
+		return nil, err
+	}
+	finalizers := slices.DeleteFunc(config.Finalizers, func(finalizer string) bool { return finalizer == ctrl.pvFinalizer })
+	if add {
+		finalizers = append(finalizers, ctrl.pvFinalizer)
+	}
+	config.Finalizers = finalizers
+	return ctrl.applyVolume(ctx, config)
+}
@@ -0,0 +1,167 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	klog "k8s.io/klog/v2"
+)
+
+// shutdownPollInterval is how often drain checks the volume store.
+const shutdownPollInterval = 100 * time.Millisecond
+
+// trackOperation records a provisioning or deletion in progress, so that
+// drain can report it when it's abandoned. Call the returned func when the
+// operation finishes.
+func (ctrl *ProvisionController) trackOperation(name string) func() {
+	ctrl.operations.Store(name, struct{}{})
+	return func() { ctrl.operations.Delete(name) }
+}
+
+// runningOperations returns sorted names of operations in progress.
+func (ctrl *ProvisionController) runningOperations() []string {
+	var names []string
+	ctrl.operations.Range(func(key, _ interface{}) bool {
+		names = append(names, key.(string))
+		return true
+	})
+	sort.Strings(names)
+	return names
+}
+
+// drain waits up to ShutdownGracePeriod for the workers to finish their
+// current items and for the volume store to save pending volumes. Then it
+// cancels the remaining work and returns an error listing what was
+// abandoned. A DrainableVolumeStore is drained while the workers finish, the
+// blocking store saves in the workers.
+func (ctrl *ProvisionController) drain(logger klog.Logger, workers *sync.WaitGroup, cancel context.CancelFunc) error {
+	defer cancel()
+	deadline := ctrl.clock.NewTimer(ctrl.shutdownGracePeriod)
+	defer deadline.Stop()
+	// The deadline is measured by the clock of the controller, not by the
+	// context.
+	drainCtx, cancelDrain := context.WithCancel(klog.NewContext(context.Background(), logger))
+	defer cancelDrain()
+	go func() {
+		select {
+		case <-deadline.C():
+			cancelDrain()
+		case <-drainCtx.Done():
+		}
+	}()
+
+	logger.Info("Stopping provisioner controller", "gracePeriod", ctrl.shutdownGracePeriod)
+	workersDone := make(chan struct{})
+	go func() {
+		workers.Wait()
+		close(workersDone)
+	}()
+	store, drainable := ctrl.volumeStore.(DrainableVolumeStore)
+	unsaved := make(chan []*v1.PersistentVolume, 1)
+	if drainable {
+		go func() { unsaved <- store.Drain(drainCtx) }()
+	}
+	// drained returns the volumes the store could not save. Volumes stored
+	// by the workers after the first Drain returned are drained again.
+	drained := func() []*v1.PersistentVolume {
+		if !drainable {
+			return nil
+		}
+		if volumes := <-unsaved; len(volumes) > 0 {
+			return volumes
+		}
+		return store.Drain(drainCtx)
+	}
+	select {
+	case <-workersDone:
+	case <-drainCtx.Done():
+		return ctrl.abandon(logger, drained())
+	}
+
+	if drainable {
+		if volumes := drained(); len(volumes) > 0 {
+			return ctrl.abandon(logger, volumes)
+		}
+		logger.Info("Stopped provisioner controller")
+		return nil
+	}
+
+	for ctrl.volumeStore.Len() > 0 {
+		select {
+		case <-ctrl.clock.After(shutdownPollInterval):
+		case <-drainCtx.Done():
+			return ctrl.abandon(logger, nil)
+		}
+	}
+	logger.Info("Stopped provisioner controller")
+	return nil
+}
+
+// notifyShutdown calls Shutdown of the provisioner, see ShutdownNotifier.
+func (ctrl *ProvisionController) notifyShutdown(logger klog.Logger, notifier ShutdownNotifier) {
+	ctx, cancel := context.WithTimeout(klog.NewContext(context.Background(), logger), ctrl.shutdownGracePeriod)
+	defer cancel()
+	logger.V(2).Info("Shutting down provisioner")
+	notifier.Shutdown(ctx)
+}
+
+// abandon logs and returns the work that did not finish within
+// ShutdownGracePeriod. Each of the unsaved volumes returned by Drain is
+// logged with what is needed to recover its storage asset manually.
+func (ctrl *ProvisionController) abandon(logger klog.Logger, unsaved []*v1.PersistentVolume) error {
+	operations := ctrl.runningOperations()
+	pending := ctrl.volumeStore.Len()
+	if pending < len(unsaved) {
+		// Abandoned saves of the blocking store may have returned already.
+		pending = len(unsaved)
+	}
+	sort.Slice(unsaved, func(i, j int) bool { return unsaved[i].Name < unsaved[j].Name })
+	for _, volume := range unsaved {
+		ctrl.metrics.PersistentVolumesAbandonedTotal.WithLabelValues(volume.Spec.StorageClassName).Inc()
+		logger.Error(nil, "Provisioned volume was not saved to API server before shutdown, its storage asset must be recovered manually",
+			append([]interface{}{"PV", volume.Name}, abandonedVolumeDetails(volume)...)...)
+	}
+	logger.Error(nil, "Shutdown grace period expired, abandoning work", "operations", operations, "unsavedVolumes", pending)
+	return fmt.Errorf("shutdown grace period %v expired with %d operations in progress [%s] and %d volumes not saved",
+		ctrl.shutdownGracePeriod, len(operations), strings.Join(operations, ", "), pending)
+}
+
+// abandonedVolumeDetails returns log key/value pairs that identify an unsaved
+// volume, its claim and its storage asset.
+func abandonedVolumeDetails(volume *v1.PersistentVolume) []interface{} {
+	details := []interface{}{
+		"storageClass", volume.Spec.StorageClassName,
+		"capacity", volume.Spec.Capacity.Storage().String(),
+		"accessModes", volume.Spec.AccessModes,
+	}
+	if claimRef := volume.Spec.ClaimRef; claimRef != nil {
+		details = append(details, "PVC", klog.KRef(claimRef.Namespace, claimRef.Name), "claimUID", claimRef.UID)
+	}
+	if csi := volume.Spec.CSI; csi != nil {
+		details = append(details, "driver", csi.Driver, "volumeHandle", csi.VolumeHandle)
+	} else {
+		details = append(details, "source", volume.Spec.PersistentVolumeSource)
+	}
+	return details
+}
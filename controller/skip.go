@@ -0,0 +1,230 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-logr/logr"
+
+	v1 "k8s.io/api/core/v1"
+	storage "k8s.io/api/storage/v1"
+	"k8s.io/apimachinery/pkg/types"
+	klog "k8s.io/klog/v2"
+	"sigs.k8s.io/sig-storage-lib-external-provisioner/v10/util"
+)
+
+// SkipReason tells why the controller did not provision a volume for a
+// claim. It is logged as "reason" and used in ProvisioningSkipped events.
+type SkipReason string
+
+const (
+	// SkipReasonAlreadyBound means the claim is already bound to a PV.
+	SkipReasonAlreadyBound SkipReason = "AlreadyBound"
+	// SkipReasonRejectedByProvisioner means ShouldProvision of the
+	// provisioner's Qualifier returned false.
+	SkipReasonRejectedByProvisioner SkipReason = "RejectedByProvisioner"
+	// SkipReasonNoProvisionerAnnotation means the claim has no storage
+	// provisioner annotation yet, i.e. the PV controller has not asked for
+	// dynamic provisioning.
+	SkipReasonNoProvisionerAnnotation SkipReason = "NoProvisionerAnnotation"
+	// SkipReasonOtherProvisioner means the storage provisioner annotation of
+	// the claim names a provisioner not handled by this controller.
+	SkipReasonOtherProvisioner SkipReason = "OtherProvisioner"
+	// SkipReasonWaitingForFirstConsumer means the StorageClass of the claim
+	// uses WaitForFirstConsumer binding and no node is selected yet.
+	SkipReasonWaitingForFirstConsumer SkipReason = "WaitingForFirstConsumer"
+	// SkipReasonSelectedNodeRequired means RequireSelectedNode is set and
+	// no node is selected yet for the claim of a StorageClass with
+	// Immediate binding.
+	SkipReasonSelectedNodeRequired SkipReason = "SelectedNodeRequired"
+	// SkipReasonCloneNotSupported means the data source of the claim is
+	// another claim and the provisioner does not implement CloneSupporter.
+	SkipReasonCloneNotSupported SkipReason = "CloneNotSupported"
+	// SkipReasonCrossNamespaceDataSource means the dataSourceRef of the
+	// claim is in another namespace and CrossNamespaceDataSources is not
+	// enabled.
+	SkipReasonCrossNamespaceDataSource SkipReason = "CrossNamespaceDataSource"
+	// SkipReasonForeignDataSource means the data source of the claim is of
+	// a kind the provisioner does not support, e.g. the CRD of a volume
+	// populator, which provisions the claim itself.
+	SkipReasonForeignDataSource SkipReason = "ForeignDataSource"
+	// SkipReasonBlockNotSupported means the claim requests volumeMode Block
+	// and the provisioner does not implement BlockProvisioner or its
+	// SupportsBlock returns false.
+	SkipReasonBlockNotSupported SkipReason = "BlockVolumeModeNotSupported"
+	// SkipReasonReadWriteOncePodNotSupported means the claim requests
+	// access mode ReadWriteOncePod and the provisioner does not implement
+	// ReadWriteOncePodSupporter or its SupportsReadWriteOncePod returns
+	// false.
+	SkipReasonReadWriteOncePodNotSupported SkipReason = "ReadWriteOncePodNotSupported"
+	// SkipReasonReadWriteOncePodWithOtherModes means the claim requests
+	// access mode ReadWriteOncePod together with other access modes.
+	SkipReasonReadWriteOncePodWithOtherModes SkipReason = "ReadWriteOncePodWithOtherModes"
+)
+
+// skipEventInterval is the minimum interval between ProvisioningSkipped
+// events of a claim with the same reason.
+const skipEventInterval = 10 * time.Minute
+
+// skipMessages are messages of ProvisioningSkipped events.
+var skipMessages = map[SkipReason]string{
+	SkipReasonRejectedByProvisioner:    "The provisioner does not want to provision volume for the claim yet",
+	SkipReasonWaitingForFirstConsumer:  "Waiting for a pod to be scheduled before provisioning volume for the claim",
+	SkipReasonSelectedNodeRequired:     "Waiting for a node to be selected before provisioning volume for the claim",
+	SkipReasonCloneNotSupported:        "The provisioner does not support cloning volumes from the claim's data source",
+	SkipReasonCrossNamespaceDataSource: "The provisioner does not support data sources in other namespaces",
+	SkipReasonForeignDataSource:        "The claim's data source is not supported by the provisioner, waiting for its volume populator",
+	SkipReasonBlockNotSupported:        "The provisioner does not support block volume mode",
+
+	SkipReasonReadWriteOncePodNotSupported:   "The provisioner does not support ReadWriteOncePod access mode",
+	SkipReasonReadWriteOncePodWithOtherModes: "The claim requests ReadWriteOncePod access mode with other access modes",
+}
+
+// skipAdvice are the events of adviseSkip, with messages formatted with the
+// StorageClass of the claim.
+var skipAdvice = map[SkipReason]struct {
+	eventType string
+	message   string
+}{
+	SkipReasonSelectedNodeRequired:     {v1.EventTypeWarning, "StorageClass %q uses Immediate volume binding, but the provisioner provisions only for a selected node. The claim waits for annotation " + AnnSelectedNode + ", change the StorageClass to WaitForFirstConsumer volume binding mode"},
+	SkipReasonCloneNotSupported:        {v1.EventTypeWarning, "The provisioner of StorageClass %q does not support cloning volumes, the claim with a PersistentVolumeClaim data source is not provisioned"},
+	SkipReasonCrossNamespaceDataSource: {v1.EventTypeWarning, "The provisioner of StorageClass %q does not support data sources in other namespaces, the claim with a dataSourceRef to another namespace is not provisioned"},
+	SkipReasonForeignDataSource:        {v1.EventTypeNormal, "The provisioner of StorageClass %q does not support the claim's data source, an empty volume is not provisioned. The volume populator of the data source is expected to provision the claim"},
+	SkipReasonBlockNotSupported:        {v1.EventTypeWarning, "The provisioner of StorageClass %q does not support block volume mode, the claim with volumeMode Block is not provisioned"},
+
+	SkipReasonReadWriteOncePodNotSupported:   {v1.EventTypeWarning, "The provisioner of StorageClass %q does not support ReadWriteOncePod access mode, the claim with access mode ReadWriteOncePod is not provisioned"},
+	SkipReasonReadWriteOncePodWithOtherModes: {v1.EventTypeWarning, "ReadWriteOncePod access mode of the claim of StorageClass %q cannot be combined with other access modes, the claim is not provisioned"},
+}
+
+// skipEvent is the last ProvisioningSkipped event sent to a claim.
+type skipEvent struct {
+	reason SkipReason
+	time   time.Time
+}
+
+// provisionSkipReason returns why a volume should not be provisioned for the
+// claim or an empty string when it should be.
+func (ctrl *ProvisionController) provisionSkipReason(ctx context.Context, claim *v1.PersistentVolumeClaim) (SkipReason, error) {
+	if claim.Spec.VolumeName != "" {
+		return SkipReasonAlreadyBound, nil
+	}
+
+	if qualifier, ok := ctrl.provisioner.(Qualifier); ok {
+		if !qualifier.ShouldProvision(ctx, claim) {
+			return SkipReasonRejectedByProvisioner, nil
+		}
+	}
+
+	provisioner, found := util.GetPersistentVolumeClaimProvisioner(klog.FromContext(ctx), claim)
+	if !found {
+		return SkipReasonNoProvisionerAnnotation, nil
+	}
+	if !ctrl.knownClaimProvisioner(provisioner) {
+		return SkipReasonOtherProvisioner, nil
+	}
+	if ctrl.foreignDataSource(claim) {
+		return SkipReasonForeignDataSource, nil
+	}
+	if isCloneClaim(claim) && !ctrl.supportsClone(ctx) {
+		return SkipReasonCloneNotSupported, nil
+	}
+	if util.CheckPersistentVolumeClaimModeBlock(claim) && !ctrl.supportsBlock(ctx) {
+		return SkipReasonBlockNotSupported, nil
+	}
+	if util.AccessModesContains(claim.Spec.AccessModes, v1.ReadWriteOncePod) {
+		if len(claim.Spec.AccessModes) > 1 {
+			return SkipReasonReadWriteOncePodWithOtherModes, nil
+		}
+		if !ctrl.supportsReadWriteOncePod(ctx) {
+			return SkipReasonReadWriteOncePodNotSupported, nil
+		}
+	}
+	if _, cross := crossNamespaceDataSource(claim); cross && !ctrl.crossNamespaceSources {
+		return SkipReasonCrossNamespaceDataSource, nil
+	}
+
+	claimClass := util.GetPersistentVolumeClaimClass(claim)
+	class, err := ctrl.getStorageClass(ctx, claimClass)
+	if err != nil {
+		return "", err
+	}
+	delayedBinding := class.VolumeBindingMode != nil && *class.VolumeBindingMode == storage.VolumeBindingWaitForFirstConsumer
+	if delayedBinding || ctrl.requireSelectedNode {
+		// When claim is in delay binding mode, AnnSelectedNode is
+		// required to provision volume.
+		// Though PV controller set AnnStorageProvisioner only when
+		// AnnSelectedNode is set, but provisioner may remove
+		// AnnSelectedNode to notify scheduler to reschedule again.
+		if selectedNode, ok := claim.Annotations[AnnSelectedNode]; !ok || selectedNode == "" {
+			if !delayedBinding {
+				return SkipReasonSelectedNodeRequired, nil
+			}
+			return SkipReasonWaitingForFirstConsumer, nil
+		}
+	}
+	return "", nil
+}
+
+// adviseSkip sends an event to a claim skipped for a reason in skipAdvice,
+// i.e. one that needs a change of the claim or of its StorageClass or that
+// hands the claim over to another component. Unlike explainSkip, it does
+// not depend on ExplainSkips and the event is sent once per claim and
+// reason.
+func (ctrl *ProvisionController) adviseSkip(claim *v1.PersistentVolumeClaim, reason SkipReason) {
+	advice, ok := skipAdvice[reason]
+	if !ok {
+		return
+	}
+	if last, sent := ctrl.skipAdvised.Swap(claim.UID, reason); sent && last.(SkipReason) == reason {
+		return
+	}
+	ctrl.event(claim, advice.eventType, string(reason), fmt.Sprintf(advice.message, util.GetPersistentVolumeClaimClass(claim)))
+}
+
+// explainSkip logs why the claim is skipped and, with ExplainSkips enabled,
+// sends a ProvisioningSkipped event to claims of this provisioner. Events are
+// sent when the reason changes and then at most once per skipEventInterval.
+func (ctrl *ProvisionController) explainSkip(ctx context.Context, claim *v1.PersistentVolumeClaim, reason SkipReason) {
+	klog.FromContext(ctx).V(ctrl.skipLogVerbosity).Info("Skipping claim", "reason", reason)
+
+	msg, ok := skipMessages[reason]
+	if !ctrl.explainSkips || !ok {
+		return
+	}
+	// provisionSkipReason has logged disagreeing annotations.
+	if provisioner, found := util.GetPersistentVolumeClaimProvisioner(logr.Discard(), claim); !found || !ctrl.knownClaimProvisioner(provisioner) {
+		// Do not explain claims of other provisioners.
+		return
+	}
+	now := ctrl.clock.Now()
+	if last, found := ctrl.skipEvents.Load(claim.UID); found {
+		if last := last.(skipEvent); last.reason == reason && now.Sub(last.time) < skipEventInterval {
+			return
+		}
+	}
+	ctrl.skipEvents.Store(claim.UID, skipEvent{reason: reason, time: now})
+	ctrl.event(claim, v1.EventTypeNormal, "ProvisioningSkipped", fmt.Sprintf("%s: %s", reason, msg))
+}
+
+// forgetSkip removes the skip events sent to a deleted claim.
+func (ctrl *ProvisionController) forgetSkip(uid types.UID) {
+	ctrl.skipEvents.Delete(uid)
+	ctrl.skipAdvised.Delete(uid)
+}
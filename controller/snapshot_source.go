@@ -0,0 +1,134 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+const (
+	snapshotGroup = "snapshot.storage.k8s.io"
+	snapshotKind  = "VolumeSnapshot"
+)
+
+// errSnapshotNotReady is returned while the VolumeSnapshot a claim is restored
+// from is not ready to use. The claim is requeued after
+// SnapshotReadyRetryDelay, it is not a provisioning failure.
+var errSnapshotNotReady = errors.New("VolumeSnapshot is not ready to use")
+
+var (
+	snapshotResource        = schema.GroupVersionResource{Group: snapshotGroup, Version: "v1", Resource: "volumesnapshots"}
+	snapshotContentResource = schema.GroupVersionResource{Group: snapshotGroup, Version: "v1", Resource: "volumesnapshotcontents"}
+)
+
+// SnapshotSourceInfo describes the VolumeSnapshot a claim is restored from,
+// see ResolveSnapshotDataSource.
+type SnapshotSourceInfo struct {
+	// Namespace and name of the VolumeSnapshot.
+	Namespace string
+	Name      string
+	// Name of the VolumeSnapshotContent bound to the snapshot.
+	ContentName string
+	// Driver that created the snapshot, from the content.
+	Driver string
+	// Handle of the snapshot in the storage backend, from the content.
+	SnapshotHandle string
+	// Minimum size of a volume restored from the snapshot, nil if unknown.
+	RestoreSize *resource.Quantity
+	// Volume mode of the snapshotted volume, nil if the content does not
+	// record it.
+	SourceVolumeMode *v1.PersistentVolumeMode
+}
+
+// snapshotDataSource returns namespace and name of the VolumeSnapshot the
+// claim is restored from.
+func snapshotDataSource(claim *v1.PersistentVolumeClaim) (string, string, bool) {
+	group, kind, namespace, name, found := claimDataSource(claim)
+	if !found || group != snapshotGroup || kind != snapshotKind {
+		return "", "", false
+	}
+	return namespace, name, true
+}
+
+// snapshotSource fetches the VolumeSnapshot the claim is restored from and
+// its content. It returns nil for claims without a snapshot data source,
+// errSnapshotNotReady while the snapshot is not ready to use and an error,
+// retried like any other provisioning error, while it does not exist.
+func (ctrl *ProvisionController) snapshotSource(ctx context.Context, claim *v1.PersistentVolumeClaim) (*SnapshotSourceInfo, error) {
+	namespace, name, ok := snapshotDataSource(claim)
+	if !ok {
+		return nil, nil
+	}
+	snapshot, err := ctrl.dynamicClient.Resource(snapshotResource).Namespace(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get VolumeSnapshot %s/%s: %v", namespace, name, err)
+	}
+	ready, _, _ := unstructured.NestedBool(snapshot.Object, "status", "readyToUse")
+	contentName, _, _ := unstructured.NestedString(snapshot.Object, "status", "boundVolumeSnapshotContentName")
+	if !ready || contentName == "" {
+		return nil, fmt.Errorf("%w: %s/%s", errSnapshotNotReady, namespace, name)
+	}
+	content, err := ctrl.dynamicClient.Resource(snapshotContentResource).Get(ctx, contentName, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get VolumeSnapshotContent %s of VolumeSnapshot %s/%s: %v", contentName, namespace, name, err)
+	}
+	handle, _, _ := unstructured.NestedString(content.Object, "status", "snapshotHandle")
+	if handle == "" {
+		return nil, fmt.Errorf("VolumeSnapshotContent %s of VolumeSnapshot %s/%s has no snapshot handle", contentName, namespace, name)
+	}
+
+	info := &SnapshotSourceInfo{
+		Namespace:      namespace,
+		Name:           name,
+		ContentName:    contentName,
+		SnapshotHandle: handle,
+	}
+	info.Driver, _, _ = unstructured.NestedString(content.Object, "spec", "driver")
+	if mode, found, _ := unstructured.NestedString(content.Object, "spec", "sourceVolumeMode"); found && mode != "" {
+		volumeMode := v1.PersistentVolumeMode(mode)
+		info.SourceVolumeMode = &volumeMode
+	}
+	// The snapshot reports the size as a quantity, the content in bytes.
+	if size, found, _ := unstructured.NestedString(snapshot.Object, "status", "restoreSize"); found {
+		if quantity, err := resource.ParseQuantity(size); err == nil {
+			info.RestoreSize = &quantity
+		}
+	}
+	if info.RestoreSize == nil {
+		if size, found, _ := unstructured.NestedInt64(content.Object, "status", "restoreSize"); found {
+			info.RestoreSize = resource.NewQuantity(size, resource.BinarySI)
+		}
+	}
+	return info, nil
+}
+
+// adviseSnapshotWait sends an event to a claim that waits for its
+// VolumeSnapshot to become ready. The event is sent once per claim.
+func (ctrl *ProvisionController) adviseSnapshotWait(claim *v1.PersistentVolumeClaim, err error) {
+	if _, sent := ctrl.snapshotWaits.LoadOrStore(claim.UID, true); sent {
+		return
+	}
+	ctrl.event(claim, v1.EventTypeNormal, "WaitingForSnapshot", fmt.Sprintf("Waiting for snapshot to be ready: %v", err))
+}
@@ -0,0 +1,22 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package testutil helps to test provisioners built on the controller
+// package: FakeProvisioner records calls and returns configurable results,
+// Harness runs a ProvisionController against a fake clientset and waits for
+// its results, and NewClaim, NewStorageClass and NewVolume build objects
+// with sensible defaults.
+package testutil // import "sigs.k8s.io/sig-storage-lib-external-provisioner/v10/controller/testutil"
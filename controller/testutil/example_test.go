@@ -0,0 +1,54 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package testutil_test
+
+import (
+	"context"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	klog "k8s.io/klog/v2"
+	"sigs.k8s.io/sig-storage-lib-external-provisioner/v10/controller/testutil"
+)
+
+func ExampleHarness() {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	class := testutil.NewStorageClass("fast", "example.com/nfs")
+	claim := testutil.NewClaim("data", class)
+	h, err := testutil.NewHarness(klog.Background(), "example.com/nfs", nil, []runtime.Object{class, claim})
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	defer h.Stop()
+	if err := h.RunUntil(ctx); err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	volume, err := h.WaitForPV("pvc-" + string(claim.UID))
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	fmt.Println(volume.Name, volume.Spec.ClaimRef.Name)
+	fmt.Println(len(h.FakeProvisioner().ProvisionCalls()))
+	// Output:
+	// pvc-uid-data data
+	// 1
+}
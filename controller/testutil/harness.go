@@ -0,0 +1,237 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package testutil
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	apierrs "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes/fake"
+	klog "k8s.io/klog/v2"
+	"sigs.k8s.io/sig-storage-lib-external-provisioner/v10/controller"
+)
+
+const (
+	// DefaultTimeout is how long RunUntil and the Wait functions of Harness
+	// wait unless Harness.Timeout is set.
+	DefaultTimeout = 10 * time.Second
+
+	// ResyncPeriod is the resync period of controllers of NewHarness.
+	ResyncPeriod = 100 * time.Millisecond
+
+	pollInterval = 10 * time.Millisecond
+)
+
+// Event is an event sent by the controller of a Harness.
+type Event struct {
+	Object  runtime.Object
+	Type    string
+	Reason  string
+	Message string
+}
+
+// Harness runs a ProvisionController against a fake clientset and waits
+// for its results, so that tests need neither informer priming nor sleeps.
+type Harness struct {
+	Client      *fake.Clientset
+	Provisioner controller.Provisioner
+	Controller  *controller.ProvisionController
+	// Timeout of RunUntil, WaitForPV and WaitForEvent, DefaultTimeout when
+	// zero.
+	Timeout time.Duration
+
+	recorder *eventRecorder
+	cancel   context.CancelFunc
+	// done is closed when Run returned runErr.
+	done   chan struct{}
+	runErr error
+}
+
+// NewHarness creates a controller for provisioner, a FakeProvisioner when
+// nil, with a fake clientset that holds objects. The controller runs
+// without leader election, with ResyncPeriod and retries saving PVs
+// quickly, its events are recorded by the harness. options are applied
+// after these defaults.
+func NewHarness(logger klog.Logger, provisionerName string, provisioner controller.Provisioner, objects []runtime.Object, options ...func(*controller.ProvisionController) error) (*Harness, error) {
+	if provisioner == nil {
+		provisioner = &FakeProvisioner{}
+	}
+	h := &Harness{
+		Client:      fake.NewSimpleClientset(objects...),
+		Provisioner: provisioner,
+		recorder:    &eventRecorder{},
+	}
+	defaults := []func(*controller.ProvisionController) error{
+		controller.LeaderElection(false),
+		controller.ResyncPeriod(ResyncPeriod),
+		controller.CreateProvisionedPVInterval(pollInterval),
+		controller.WithEventRecorder(h.recorder),
+	}
+	ctrl, err := controller.NewProvisionControllerOrError(logger, h.Client, provisionerName, provisioner, append(defaults, options...)...)
+	if err != nil {
+		return nil, err
+	}
+	h.Controller = ctrl
+	return h, nil
+}
+
+// FakeProvisioner returns the provisioner of the harness when it is a
+// FakeProvisioner, nil otherwise.
+func (h *Harness) FakeProvisioner() *FakeProvisioner {
+	provisioner, _ := h.Provisioner.(*FakeProvisioner)
+	return provisioner
+}
+
+// RunUntil runs the controller in the background until ctx is done or Stop
+// is called and waits until it is Ready. It fails when Run returns before.
+func (h *Harness) RunUntil(ctx context.Context) error {
+	ctx, h.cancel = context.WithCancel(ctx)
+	h.done = make(chan struct{})
+	go func() {
+		defer close(h.done)
+		h.runErr = h.Controller.Run(ctx)
+	}()
+	err := h.poll(ctx, func(context.Context) (bool, error) {
+		select {
+		case <-h.done:
+			err := h.runErr
+			if err == nil {
+				err = errors.New("Run returned")
+			}
+			return false, fmt.Errorf("controller stopped: %w", err)
+		default:
+		}
+		return h.Controller.Ready() == nil, nil
+	})
+	if err != nil {
+		return fmt.Errorf("controller is not ready: %w", err)
+	}
+	return nil
+}
+
+// Stop stops the controller started by RunUntil, waits until it is Stopped
+// and returns the error of Run. Tests call it on cleanup, so that no
+// goroutine of the controller outlives them.
+func (h *Harness) Stop() error {
+	if h.done == nil {
+		return nil
+	}
+	h.cancel()
+	<-h.done
+	if h.runErr == nil {
+		<-h.Controller.Stopped()
+	}
+	return h.runErr
+}
+
+// WaitForPV waits until the PV with the given name exists and returns it.
+func (h *Harness) WaitForPV(name string) (*v1.PersistentVolume, error) {
+	var volume *v1.PersistentVolume
+	err := h.poll(context.Background(), func(ctx context.Context) (bool, error) {
+		var err error
+		volume, err = h.Client.CoreV1().PersistentVolumes().Get(ctx, name, metav1.GetOptions{})
+		if apierrs.IsNotFound(err) {
+			return false, nil
+		}
+		return err == nil, err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("PV %q was not saved: %w", name, err)
+	}
+	return volume, nil
+}
+
+// WaitForPVDeleted waits until the PV with the given name does not exist.
+func (h *Harness) WaitForPVDeleted(name string) error {
+	err := h.poll(context.Background(), func(ctx context.Context) (bool, error) {
+		_, err := h.Client.CoreV1().PersistentVolumes().Get(ctx, name, metav1.GetOptions{})
+		if apierrs.IsNotFound(err) {
+			return true, nil
+		}
+		return false, err
+	})
+	if err != nil {
+		return fmt.Errorf("PV %q was not deleted: %w", name, err)
+	}
+	return nil
+}
+
+// WaitForEvent waits until the controller sent an event with the given
+// reason and returns the first one.
+func (h *Harness) WaitForEvent(reason string) (Event, error) {
+	var event Event
+	err := h.poll(context.Background(), func(context.Context) (bool, error) {
+		for _, e := range h.Events() {
+			if e.Reason == reason {
+				event = e
+				return true, nil
+			}
+		}
+		return false, nil
+	})
+	if err != nil {
+		return Event{}, fmt.Errorf("no event %s was sent: %w", reason, err)
+	}
+	return event, nil
+}
+
+// Events returns all events sent by the controller, in order.
+func (h *Harness) Events() []Event {
+	return h.recorder.list()
+}
+
+func (h *Harness) poll(ctx context.Context, condition wait.ConditionWithContextFunc) error {
+	timeout := h.Timeout
+	if timeout == 0 {
+		timeout = DefaultTimeout
+	}
+	return wait.PollUntilContextTimeout(ctx, pollInterval, timeout, true, condition)
+}
+
+// eventRecorder is a record.EventRecorder that keeps all events.
+type eventRecorder struct {
+	lock   sync.Mutex
+	events []Event
+}
+
+func (r *eventRecorder) Event(object runtime.Object, eventtype, reason, message string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.events = append(r.events, Event{Object: object, Type: eventtype, Reason: reason, Message: message})
+}
+
+func (r *eventRecorder) Eventf(object runtime.Object, eventtype, reason, messageFmt string, args ...interface{}) {
+	r.Event(object, eventtype, reason, fmt.Sprintf(messageFmt, args...))
+}
+
+func (r *eventRecorder) AnnotatedEventf(object runtime.Object, annotations map[string]string, eventtype, reason, messageFmt string, args ...interface{}) {
+	r.Event(object, eventtype, reason, fmt.Sprintf(messageFmt, args...))
+}
+
+func (r *eventRecorder) list() []Event {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return append([]Event(nil), r.events...)
+}
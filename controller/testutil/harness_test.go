@@ -0,0 +1,127 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package testutil
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/klog/v2/ktesting"
+	"sigs.k8s.io/sig-storage-lib-external-provisioner/v10/controller"
+)
+
+func TestHarness(t *testing.T) {
+	logger, ctx := ktesting.NewTestContext(t)
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	class := NewStorageClass("class-1", "example.com/fake")
+	claim := NewClaim("claim-1", class)
+	released := NewVolume("pv-released", NewClaim("claim-0", class), class)
+	released.Status.Phase = v1.VolumeReleased
+	h, err := NewHarness(logger, "example.com/fake", nil, []runtime.Object{class, claim, released})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer func() {
+		if err := h.Stop(); err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+	}()
+	if err := h.RunUntil(ctx); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	volume, err := h.WaitForPV("pvc-uid-claim-1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if ref := volume.Spec.ClaimRef; ref == nil || ref.UID != claim.UID {
+		t.Errorf("expected PV bound to the claim, got claimRef %v", ref)
+	}
+	if _, err := h.WaitForEvent("ProvisioningSucceeded"); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err := h.WaitForPVDeleted("pv-released"); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if calls := h.FakeProvisioner().DeleteCalls(); len(calls) != 1 || calls[0].Name != "pv-released" {
+		t.Errorf("expected Delete of the released PV, got %v", calls)
+	}
+}
+
+func TestHarnessProvisioningFailure(t *testing.T) {
+	logger, ctx := ktesting.NewTestContext(t)
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	class := NewStorageClass("class-1", "example.com/fake")
+	provisioner := &FakeProvisioner{}
+	provisioner.QueueProvisionResponses(ProvisionResponse{State: controller.ProvisioningFinished, Err: errors.New("no space left")})
+	h, err := NewHarness(logger, "example.com/fake", provisioner, []runtime.Object{class, NewClaim("claim-1", class)})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer func() {
+		if err := h.Stop(); err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+	}()
+	if err := h.RunUntil(ctx); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	event, err := h.WaitForEvent("ProvisioningFailed")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if event.Type != v1.EventTypeWarning {
+		t.Errorf("expected Warning event, got %v", event)
+	}
+	// The claim is retried.
+	if _, err := h.WaitForPV("pvc-uid-claim-1"); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+// initFailingProvisioner fails to initialize, so that Run fails.
+type initFailingProvisioner struct {
+	FakeProvisioner
+}
+
+func (p *initFailingProvisioner) Init(ctx context.Context, c *controller.ProvisionController) error {
+	return errors.New("backend unreachable")
+}
+
+func TestHarnessRunFailure(t *testing.T) {
+	logger, ctx := ktesting.NewTestContext(t)
+	h, err := NewHarness(logger, "example.com/fake", &initFailingProvisioner{}, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := h.RunUntil(ctx); err == nil || !strings.Contains(err.Error(), "backend unreachable") {
+		t.Errorf("expected error of Init, got %v", err)
+	}
+	if err := h.Stop(); err == nil || !strings.Contains(err.Error(), "backend unreachable") {
+		t.Errorf("expected Stop to return the error of Init, got %v", err)
+	}
+	if h.FakeProvisioner() != nil {
+		t.Errorf("expected no FakeProvisioner")
+	}
+}
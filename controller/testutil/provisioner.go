@@ -0,0 +1,181 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package testutil
+
+import (
+	"context"
+	"sync"
+
+	v1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/sig-storage-lib-external-provisioner/v10/controller"
+)
+
+// ProvisionResponse is what FakeProvisioner returns from a Provision call.
+type ProvisionResponse struct {
+	// Volume to return. When nil and Err is nil, NewVolume of the claim is
+	// returned, without claimRef and status like Provision would.
+	Volume *v1.PersistentVolume
+	State  controller.ProvisioningState
+	Err    error
+}
+
+// FakeProvisioner is a controller.Provisioner that records its calls. By
+// default Provision returns NewVolume of the claim and Delete succeeds,
+// QueueProvisionResponses and QueueDeleteErrors change the results of the
+// next calls. Block makes calls wait until Release. The zero value is ready
+// to use and it is safe for concurrent use.
+type FakeProvisioner struct {
+	lock           sync.Mutex
+	provisionQueue []ProvisionResponse
+	deleteQueue    []error
+	provisionCalls []controller.ProvisionOptions
+	deleteCalls    []*v1.PersistentVolume
+	inFlight       int
+	// Closed by Release, nil when calls do not block.
+	released chan struct{}
+}
+
+var _ controller.Provisioner = &FakeProvisioner{}
+
+// QueueProvisionResponses sets the results of the next Provision calls, one
+// per call, in order. Calls after the queue is drained get the default
+// result.
+func (p *FakeProvisioner) QueueProvisionResponses(responses ...ProvisionResponse) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.provisionQueue = append(p.provisionQueue, responses...)
+}
+
+// QueueDeleteErrors sets the results of the next Delete calls, one per
+// call, in order, nil for success.
+func (p *FakeProvisioner) QueueDeleteErrors(errs ...error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.deleteQueue = append(p.deleteQueue, errs...)
+}
+
+// Block makes the following Provision and Delete calls wait, after they are
+// recorded, until Release is called or their context is done.
+func (p *FakeProvisioner) Block() {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if p.released == nil {
+		p.released = make(chan struct{})
+	}
+}
+
+// Release lets blocked calls return and stops blocking new ones.
+func (p *FakeProvisioner) Release() {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if p.released != nil {
+		close(p.released)
+		p.released = nil
+	}
+}
+
+// InFlight returns the number of Provision and Delete calls in progress,
+// e.g. blocked ones.
+func (p *FakeProvisioner) InFlight() int {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return p.inFlight
+}
+
+// ProvisionCalls returns the options of all Provision calls, in order.
+func (p *FakeProvisioner) ProvisionCalls() []controller.ProvisionOptions {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return append([]controller.ProvisionOptions(nil), p.provisionCalls...)
+}
+
+// DeleteCalls returns the PVs of all Delete calls, in order.
+func (p *FakeProvisioner) DeleteCalls() []*v1.PersistentVolume {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return append([]*v1.PersistentVolume(nil), p.deleteCalls...)
+}
+
+// Provision records the call and returns the next queued response or
+// NewVolume of the claim.
+func (p *FakeProvisioner) Provision(ctx context.Context, options controller.ProvisionOptions) (*v1.PersistentVolume, controller.ProvisioningState, error) {
+	p.lock.Lock()
+	p.provisionCalls = append(p.provisionCalls, options)
+	response := ProvisionResponse{State: controller.ProvisioningFinished}
+	if len(p.provisionQueue) > 0 {
+		response, p.provisionQueue = p.provisionQueue[0], p.provisionQueue[1:]
+	}
+	released := p.startCall()
+	p.lock.Unlock()
+	defer p.endCall()
+
+	if err := waitReleased(ctx, released); err != nil {
+		return nil, controller.ProvisioningInBackground, err
+	}
+	if response.Volume == nil && response.Err == nil {
+		response.Volume = NewVolume(options.PVName, options.PVC, options.StorageClass)
+		response.Volume.Annotations = nil
+		response.Volume.Spec.ClaimRef = nil
+		response.Volume.Status = v1.PersistentVolumeStatus{}
+	}
+	return response.Volume, response.State, response.Err
+}
+
+// Delete records the call and returns the next queued error, nil when
+// there is none.
+func (p *FakeProvisioner) Delete(ctx context.Context, volume *v1.PersistentVolume) error {
+	p.lock.Lock()
+	p.deleteCalls = append(p.deleteCalls, volume)
+	var err error
+	if len(p.deleteQueue) > 0 {
+		err, p.deleteQueue = p.deleteQueue[0], p.deleteQueue[1:]
+	}
+	released := p.startCall()
+	p.lock.Unlock()
+	defer p.endCall()
+
+	if waitErr := waitReleased(ctx, released); waitErr != nil {
+		return waitErr
+	}
+	return err
+}
+
+// startCall counts a call in flight and returns the channel it has to
+// wait for, nil when it does not block. It must be called with the lock.
+func (p *FakeProvisioner) startCall() chan struct{} {
+	p.inFlight++
+	return p.released
+}
+
+func (p *FakeProvisioner) endCall() {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.inFlight--
+}
+
+// waitReleased waits until released is closed, if it is not nil, or ctx is done.
+func waitReleased(ctx context.Context, released chan struct{}) error {
+	if released == nil {
+		return nil
+	}
+	select {
+	case <-released:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
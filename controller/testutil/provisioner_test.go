@@ -0,0 +1,95 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package testutil
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"sigs.k8s.io/sig-storage-lib-external-provisioner/v10/controller"
+)
+
+func TestFakeProvisioner(t *testing.T) {
+	ctx := context.Background()
+	class := NewStorageClass("class-1", "example.com/fake")
+	claim := NewClaim("claim-1", class)
+	options := controller.ProvisionOptions{StorageClass: class, PVName: "pvc-uid-claim-1", PVC: claim}
+	p := &FakeProvisioner{}
+	p.QueueProvisionResponses(ProvisionResponse{State: controller.ProvisioningInBackground, Err: errors.New("timeout")})
+	p.QueueDeleteErrors(errors.New("busy"))
+
+	if _, state, err := p.Provision(ctx, options); err == nil || state != controller.ProvisioningInBackground {
+		t.Errorf("expected queued response, got %v and %v", state, err)
+	}
+	volume, state, err := p.Provision(ctx, options)
+	if err != nil || state != controller.ProvisioningFinished {
+		t.Fatalf("expected default response, got %v and %v", state, err)
+	}
+	if err := controller.ValidateProvisionedVolume(volume, claim); err != nil {
+		t.Errorf("expected valid volume, got %v", err)
+	}
+	if volume.Spec.ClaimRef != nil {
+		t.Errorf("expected volume without claimRef, got %v", volume.Spec.ClaimRef)
+	}
+	if err := p.Delete(ctx, volume); err == nil {
+		t.Errorf("expected queued delete error")
+	}
+	if err := p.Delete(ctx, volume); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if calls := p.ProvisionCalls(); len(calls) != 2 || calls[1].PVName != "pvc-uid-claim-1" {
+		t.Errorf("expected 2 Provision calls, got %v", calls)
+	}
+	if calls := p.DeleteCalls(); len(calls) != 2 || calls[0].Name != "pvc-uid-claim-1" {
+		t.Errorf("expected 2 Delete calls, got %v", calls)
+	}
+}
+
+func TestFakeProvisionerBlock(t *testing.T) {
+	class := NewStorageClass("class-1", "example.com/fake")
+	claim := NewClaim("claim-1", class)
+	volume := NewVolume("pv-1", claim, class)
+	p := &FakeProvisioner{}
+	p.Block()
+
+	done := make(chan error)
+	go func() { done <- p.Delete(context.Background(), volume) }()
+	select {
+	case <-done:
+		t.Fatalf("expected Delete to block")
+	case <-time.After(100 * time.Millisecond):
+	}
+	if inFlight := p.InFlight(); inFlight != 1 {
+		t.Errorf("expected 1 call in flight, got %d", inFlight)
+	}
+	p.Release()
+	if err := <-done; err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	p.Block()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := p.Delete(ctx, volume); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected blocked call to return with its context, got %v", err)
+	}
+	if inFlight := p.InFlight(); inFlight != 0 {
+		t.Errorf("expected no calls in flight, got %d", inFlight)
+	}
+}
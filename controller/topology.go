@@ -0,0 +1,187 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	storage "k8s.io/api/storage/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"sigs.k8s.io/sig-storage-lib-external-provisioner/v10/topology"
+)
+
+const (
+	// topologyKeyCheckInterval is how often ValidateTopologyKeys checks all
+	// StorageClasses.
+	topologyKeyCheckInterval = 10 * time.Minute
+	// topologyKeyEventInterval is the minimum interval between events about
+	// unknown topology keys of a StorageClass.
+	topologyKeyEventInterval = time.Hour
+)
+
+// FlattenAllowedTopologies merges AllowedTopologies of a StorageClass into
+// the allowed values of each topology key, sorted. E.g. terms zone=a and
+// zone in (b, c) give zone: [a, b, c]. A class without AllowedTopologies
+// gives nil, i.e. all topologies are allowed.
+//
+// The terms are ORed, which the flat form can express only when all terms
+// restrict the same keys. It returns an error for terms with different keys
+// and for a term that requires a key to have values from disjoint sets.
+func FlattenAllowedTopologies(class *storage.StorageClass) (map[string][]string, error) {
+	if class == nil || len(class.AllowedTopologies) == 0 {
+		return nil, nil
+	}
+	allowed := map[string]sets.Set[string]{}
+	for i, term := range class.AllowedTopologies {
+		values, err := termValues(term)
+		if err != nil {
+			return nil, fmt.Errorf("allowed topology term %d: %v", i, err)
+		}
+		if i > 0 && !sets.KeySet(values).Equal(sets.KeySet(allowed)) {
+			return nil, fmt.Errorf("allowed topology term %d restricts keys %v, other terms %v", i, sets.List(sets.KeySet(values)), sets.List(sets.KeySet(allowed)))
+		}
+		for key, keyValues := range values {
+			if allowed[key] == nil {
+				allowed[key] = sets.New[string]()
+			}
+			allowed[key] = allowed[key].Union(keyValues)
+		}
+	}
+	flat := make(map[string][]string, len(allowed))
+	for key, values := range allowed {
+		flat[key] = sets.List(values)
+	}
+	return flat, nil
+}
+
+// termValues returns the allowed values of each key of a topology term. The
+// requirements of a term are ANDed, repeated keys get the intersection of
+// their values.
+func termValues(term v1.TopologySelectorTerm) (map[string]sets.Set[string], error) {
+	values := map[string]sets.Set[string]{}
+	for _, requirement := range term.MatchLabelExpressions {
+		requirementValues := sets.New(requirement.Values...)
+		if existing, found := values[requirement.Key]; found {
+			requirementValues = existing.Intersection(requirementValues)
+			if requirementValues.Len() == 0 {
+				return nil, fmt.Errorf("contradictory values of key %q", requirement.Key)
+			}
+		}
+		values[requirement.Key] = requirementValues
+	}
+	return values, nil
+}
+
+// nodeMatchesAllowedTopologies returns true if the labels of node match at
+// least one of the topology terms, or there are none.
+func nodeMatchesAllowedTopologies(node *v1.Node, terms []v1.TopologySelectorTerm) bool {
+	if len(terms) == 0 {
+		return true
+	}
+	for _, term := range terms {
+		if nodeMatchesTopologyTerm(node, term) {
+			return true
+		}
+	}
+	return false
+}
+
+// nodeMatchesTopologyTerm returns true if node matches all requirements of
+// term. Zone and region are read from the GA or beta labels of the node,
+// whichever it has, see topology.SelectedNodeTopology.
+func nodeMatchesTopologyTerm(node *v1.Node, term v1.TopologySelectorTerm) bool {
+	keys := make([]string, 0, len(term.MatchLabelExpressions))
+	for _, requirement := range term.MatchLabelExpressions {
+		keys = append(keys, requirement.Key)
+	}
+	nodeTopology := topology.SelectedNodeTopology(node, keys)
+	for _, requirement := range term.MatchLabelExpressions {
+		value, found := nodeTopology[requirement.Key]
+		if !found {
+			return false
+		}
+		if !slices.Contains(requirement.Values, value) {
+			return false
+		}
+	}
+	return true
+}
+
+// checkTopologyKeys checks AllowedTopologies of all StorageClasses of this
+// provisioner, see checkClassTopologyKeys.
+func (ctrl *ProvisionController) checkTopologyKeys(ctx context.Context) {
+	if ctrl.classesUnavailable.Load() {
+		return
+	}
+	for _, obj := range ctrl.classes.List() {
+		ctrl.checkClassTopologyKeys(obj)
+	}
+}
+
+// checkClassTopologyKeys sends a Warning event to a StorageClass of this
+// provisioner when its AllowedTopologies use a key that no node has a label
+// of, e.g. a typo, so that its claims would never be provisioned. Zone and
+// region keys are looked up like in topology.SelectedNodeTopology. Nothing is
+// reported without nodes, e.g. before the node cache has synced. Events of a
+// class are sent at most once per topologyKeyEventInterval.
+func (ctrl *ProvisionController) checkClassTopologyKeys(obj interface{}) {
+	class, err := toStorageClass(obj)
+	if err != nil {
+		utilruntime.HandleError(err)
+		return
+	}
+	if !ctrl.knownClaimProvisioner(class.Provisioner) || len(class.AllowedTopologies) == 0 {
+		return
+	}
+	missing := sets.New[string]()
+	for _, term := range class.AllowedTopologies {
+		for _, requirement := range term.MatchLabelExpressions {
+			missing.Insert(requirement.Key)
+		}
+	}
+	nodes, err := ctrl.Nodes().List(labels.Everything())
+	if err != nil {
+		utilruntime.HandleError(err)
+		return
+	}
+	if len(nodes) == 0 {
+		return
+	}
+	for _, node := range nodes {
+		for key := range topology.SelectedNodeTopology(node, sets.List(missing)) {
+			missing.Delete(key)
+		}
+		if missing.Len() == 0 {
+			return
+		}
+	}
+
+	now := ctrl.clock.Now()
+	if last, found := ctrl.topologyKeyEvents.Load(class.Name); found && now.Sub(last.(time.Time)) < topologyKeyEventInterval {
+		return
+	}
+	ctrl.topologyKeyEvents.Store(class.Name, now)
+	ctrl.event(class, v1.EventTypeWarning, "UnknownTopologyKeys", fmt.Sprintf(
+		"No node has label %s used in allowedTopologies, claims of the class restricted to it cannot be provisioned", strings.Join(sets.List(missing), ", ")))
+}
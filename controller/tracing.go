@@ -0,0 +1,118 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracerName is the instrumentation scope of spans created by the controller.
+const tracerName = "sigs.k8s.io/sig-storage-lib-external-provisioner/v10/controller"
+
+// Names of child spans.
+const (
+	spanShouldProvision = "ShouldProvision"
+	spanProvision       = "Provisioner.Provision"
+	spanSaveVolume      = "SaveVolume"
+	spanShouldDelete    = "ShouldDelete"
+	spanDelete          = "Provisioner.Delete"
+)
+
+// span wraps trace.Span so that callers do not need to check whether tracing
+// is enabled. All methods of a zero span are no-ops.
+type span struct {
+	span trace.Span
+}
+
+// startSpan starts a span named by name() when the controller has a tracer.
+// name is not evaluated when tracing is disabled.
+func (ctrl *ProvisionController) startSpan(ctx context.Context, name func() string, attrs func() []attribute.KeyValue) (context.Context, span) {
+	return ctrl.startSpanAt(ctx, time.Time{}, name, attrs)
+}
+
+// startSpanAt is startSpan for a span that began at start, before the
+// controller knew that the work deserves a span. A zero start means now.
+func (ctrl *ProvisionController) startSpanAt(ctx context.Context, start time.Time, name func() string, attrs func() []attribute.KeyValue) (context.Context, span) {
+	if ctrl.tracer == nil {
+		return ctx, span{}
+	}
+	var opts []trace.SpanStartOption
+	if !start.IsZero() {
+		opts = append(opts, trace.WithTimestamp(start))
+	}
+	if attrs != nil {
+		opts = append(opts, trace.WithAttributes(attrs()...))
+	}
+	ctx, s := ctrl.tracer.Start(ctx, name(), opts...)
+	return ctx, span{span: s}
+}
+
+// startChildSpan starts a span with a constant name when the controller has a
+// tracer.
+func (ctrl *ProvisionController) startChildSpan(ctx context.Context, name string) (context.Context, span) {
+	if ctrl.tracer == nil {
+		return ctx, span{}
+	}
+	ctx, s := ctrl.tracer.Start(ctx, name)
+	return ctx, span{span: s}
+}
+
+// recordChildSpan records a successful child span with a constant name that
+// ran from start to end, when the controller has a tracer.
+func (ctrl *ProvisionController) recordChildSpan(ctx context.Context, name string, start, end time.Time, attrs ...attribute.KeyValue) {
+	if ctrl.tracer == nil {
+		return
+	}
+	_, s := ctrl.tracer.Start(ctx, name, trace.WithTimestamp(start), trace.WithAttributes(attrs...))
+	s.SetStatus(codes.Ok, "")
+	s.End(trace.WithTimestamp(end))
+}
+
+// setState records the provisioning state returned by the provisioner.
+func (s span) setState(state ProvisioningState) {
+	if s.span == nil {
+		return
+	}
+	s.span.SetAttributes(attribute.String("provisioning.state", string(state)))
+}
+
+// setBool records a boolean outcome, e.g. of ShouldProvision.
+func (s span) setBool(key string, value bool) {
+	if s.span == nil {
+		return
+	}
+	s.span.SetAttributes(attribute.Bool(key, value))
+}
+
+// end records err as the outcome of the span and ends it.
+func (s span) end(err error) {
+	if s.span == nil {
+		return
+	}
+	if err != nil {
+		s.span.RecordError(err)
+		s.span.SetStatus(codes.Error, err.Error())
+	} else {
+		s.span.SetStatus(codes.Ok, "")
+	}
+	s.span.End()
+}
@@ -0,0 +1,66 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// requiredAnnotations are never dropped from cached objects because the
+// controller reads them.
+var requiredAnnotations = []string{
+	AnnDynamicallyProvisioned,
+	AnnMigratedTo,
+	AnnStorageProvisioner,
+	AnnBetaStorageProvisioner,
+	AnnSelectedNode,
+	AnnAlphaSelectedNode,
+	v1.BetaStorageClassAnnotation,
+}
+
+// transformObject strips data the controller doesn't use from PVCs and PVs
+// before they are stored in the informer caches: managed fields and, with
+// CachedAnnotationSizeLimit, large annotations. It is idempotent, so objects
+// from the caches are always stripped the same way. Informers transform
+// cached objects again on resync while workers read them, so an object that
+// is stripped already must not be written to.
+func (ctrl *ProvisionController) transformObject(obj interface{}) (interface{}, error) {
+	var meta *metav1.ObjectMeta
+	switch o := obj.(type) {
+	case *v1.PersistentVolumeClaim:
+		meta = &o.ObjectMeta
+	case *v1.PersistentVolume:
+		meta = &o.ObjectMeta
+	case *metav1.PartialObjectMetadata:
+		meta = &o.ObjectMeta
+	default:
+		return obj, nil
+	}
+
+	if meta.ManagedFields != nil {
+		meta.ManagedFields = nil
+	}
+	if ctrl.cachedAnnotationSizeLimit > 0 {
+		for key, value := range meta.Annotations {
+			if len(value) > ctrl.cachedAnnotationSizeLimit && !ctrl.keptAnnotations.Has(key) {
+				delete(meta.Annotations, key)
+			}
+		}
+	}
+	return obj, nil
+}
@@ -19,9 +19,12 @@ package controller
 import (
 	"context"
 	"fmt"
+	"time"
 
+	"github.com/prometheus/client_golang/prometheus"
 	"k8s.io/api/core/v1"
 	storageapis "k8s.io/api/storage/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
 )
 
 // Provisioner is an interface that creates templates for PersistentVolumes
@@ -37,6 +40,9 @@ type Provisioner interface {
 	// provisioning the volume. The provisioner must return either final error (with
 	// ProvisioningFinished) or success eventually, otherwise the controller will try
 	// forever (unless FailedProvisionThreshold is set).
+	// The returned PV must pass ValidateProvisionedVolume. Otherwise the
+	// controller does not save it, deletes the storage asset (unless
+	// OnPVSaveFailure is Retain) and does not retry until the claim changes.
 	Provision(context.Context, ProvisionOptions) (*v1.PersistentVolume, ProvisioningState, error)
 	// Delete removes the storage asset that was created by Provision backing the
 	// given PV. Does not delete the PV object itself.
@@ -46,6 +52,47 @@ type Provisioner interface {
 	Delete(context.Context, *v1.PersistentVolume) error
 }
 
+// NodeDeleter is an optional interface implemented by provisioners of
+// node-local volumes, e.g. hostPath or LVM, whose Delete must run on the node
+// of the volume. The node of a volume is the single value of the
+// kubernetes.io/hostname requirement of its node affinity. When no node with
+// that hostname label is found in the node lister nor by a GET of the node by
+// that name and a list from API server, for longer than
+// MissingNodeGracePeriod, the controller calls
+// DeleteVolumeForMissingNode instead of Delete and sends a
+// DeletingVolumeForMissingNode Warning event to the PV, so that PVs of
+// removed nodes do not stay Released forever.
+type NodeDeleter interface {
+	Provisioner
+	// DeleteVolumeForMissingNode cleans up what is left of the volume
+	// outside of its node, e.g. records in the backend. Like Delete, it may
+	// return IgnoredError. The PV is deleted when it succeeds.
+	DeleteVolumeForMissingNode(ctx context.Context, pv *v1.PersistentVolume) error
+}
+
+// ProvisionerExt is an optional interface implemented by provisioners that
+// report warnings of successful provisioning, e.g. when the size was rounded
+// up or another file system was used than requested. When it is implemented,
+// the controller calls ProvisionExt instead of Provision.
+type ProvisionerExt interface {
+	Provisioner
+	// ProvisionExt is Provision that returns the PV with warnings in a
+	// ProvisionResult. The result is ignored when the error is not nil.
+	ProvisionExt(context.Context, ProvisionOptions) (*ProvisionResult, ProvisioningState, error)
+}
+
+// ProvisionResult is the result of ProvisionExt.
+type ProvisionResult struct {
+	// Volume is the PV of the provisioned volume, like the one returned by
+	// Provision.
+	Volume *v1.PersistentVolume
+	// Warnings are sent to the claim as Normal ProvisioningWarning events
+	// after its PV is stored. At most 5 warnings are sent to a claim, each
+	// truncated to 256 characters, and each message is sent to a claim only
+	// once, also when provisioning is retried.
+	Warnings []string
+}
+
 // Qualifier is an optional interface implemented by provisioners to determine
 // whether a claim should be provisioned as early as possible (e.g. prior to
 // leader election).
@@ -64,12 +111,112 @@ type DeletionGuard interface {
 
 // BlockProvisioner is an optional interface implemented by provisioners to determine
 // whether it supports block volume.
+//
+// Provisioners that do not implement it are assumed to support only
+// filesystem volumes: claims with volumeMode Block are skipped with a single
+// BlockVolumeModeNotSupported Warning event and Provision is not called for
+// them. Provisioners that support block volumes must implement it.
 type BlockProvisioner interface {
 	Provisioner
 	// SupportsBlock returns whether provisioner supports block volume.
 	SupportsBlock(context.Context) bool
 }
 
+// ReadWriteOncePodSupporter is an optional interface implemented by
+// provisioners whose volumes can be used by a single pod only. Claims with
+// access mode ReadWriteOncePod are skipped with a single
+// ReadWriteOncePodNotSupported Warning event when the provisioner does not
+// implement it, instead of being provisioned as ReadWriteOnce volumes. The PV
+// returned for such a claim must have exactly the ReadWriteOncePod mode.
+type ReadWriteOncePodSupporter interface {
+	Provisioner
+	// SupportsReadWriteOncePod returns whether provisioner supports
+	// ReadWriteOncePod access mode.
+	SupportsReadWriteOncePod(context.Context) bool
+}
+
+// CloneSupporter is an optional interface implemented by provisioners that
+// can clone volumes, i.e. provision claims whose data source is another
+// claim. The controller checks the source claim and its PV before calling
+// Provision and passes them as ProvisionOptions.CloneSource. Claims to be
+// cloned are skipped when the provisioner does not implement it.
+type CloneSupporter interface {
+	Provisioner
+	// SupportsClone returns whether provisioner supports cloning.
+	SupportsClone(context.Context) bool
+}
+
+// CapacityChecker is an optional interface implemented by provisioners to
+// check the capacity of the node selected by the scheduler before
+// provisioning, e.g. free space of local disks. It is called only for claims
+// of StorageClasses with WaitForFirstConsumer binding, with a selected node.
+type CapacityChecker interface {
+	// HasCapacity returns whether a volume for the claim fits on the node.
+	// When it does not, the controller removes the selected node from the
+	// claim so that the scheduler picks another one, this is not counted
+	// as a provisioning failure. Errors are retried like failed
+	// provisioning.
+	HasCapacity(ctx context.Context, node *v1.Node, claim *v1.PersistentVolumeClaim, class *storageapis.StorageClass) (bool, error)
+}
+
+// Expander is an optional interface implemented by provisioners that can
+// grow volumes. When it is implemented, the controller watches bound claims
+// of StorageClasses with allowVolumeExpansion whose requested size exceeds
+// the capacity of their PV, provisioned by this provisioner. It calls
+// ExpandVolume, saves the returned size to the capacity of the PV and updates
+// the status of the claim like the Kubernetes resize flow: its capacity, or
+// the FileSystemResizePending condition when the file system must still be
+// grown on the node, see NodeExpansionRequired. Errors are retried like failed
+// provisioning. Claims are not expanded with ProvisioningDisabled, there
+// is no claim informer then.
+type Expander interface {
+	Provisioner
+	// ExpandVolume grows the storage asset of the PV to at least newSize and
+	// returns its new size, which may be larger than newSize, e.g. when the
+	// backend rounds sizes up. It must be idempotent, the controller calls
+	// it again when saving the new size fails.
+	ExpandVolume(ctx context.Context, pv *v1.PersistentVolume, newSize resource.Quantity) (resource.Quantity, error)
+}
+
+// MetricsProvider is an optional interface implemented by provisioners with
+// metrics of their own, e.g. of calls to the storage backend. The controller
+// registers the collectors with the registry of MetricsHandler when it is
+// created and with the default prometheus registry served by the built-in
+// metrics server when it runs, so that one endpoint serves the metrics of both.
+// Registration errors, e.g. duplicate metrics, fail the constructor.
+type MetricsProvider interface {
+	// Collectors returns the collectors to register. It is called once.
+	Collectors() []prometheus.Collector
+}
+
+// Initializer is an optional interface implemented by provisioners that must
+// prepare before their first Provision or Delete call, e.g. open connections
+// to the storage backend. Run calls Init once, after the informer caches have
+// synced and before any worker starts, so before Ready reports the controller
+// as ready. With leader election, Init is called from OnStartedLeading, i.e.
+// only by the leader after it acquired the lease, with a context that is
+// cancelled when the controller stops or loses the lease. Controllers that
+// are not the leader never call it. An error aborts Run, which returns it.
+type Initializer interface {
+	// Init prepares the provisioner, c is the controller that runs it.
+	Init(ctx context.Context, c *ProvisionController) error
+}
+
+// ShutdownNotifier is an optional interface implemented by provisioners that
+// must clean up when the controller stops, e.g. close connections opened by
+// Init. Run calls Shutdown once when its context is cancelled, after the
+// workers have finished their operations in progress and the volume store has
+// saved the pending volumes, see ShutdownGracePeriod. When the grace period
+// expires, Shutdown is called after the remaining work is cancelled, while
+// abandoned operations may still be running. It is called only when Init,
+// if implemented, succeeded. With leader election it is called only by the
+// leader; losing the lease exits the process without calling it.
+type ShutdownNotifier interface {
+	// Shutdown cleans up the provisioner. The context expires after
+	// ShutdownGracePeriod.
+	Shutdown(ctx context.Context)
+}
+
 // ProvisioningState is state of volume provisioning. It tells the controller if
 // provisioning could be in progress in the background after Provision() call
 // returns or the provisioning is 100% finished (either with success or error).
@@ -95,7 +242,9 @@ const (
 	// to pick a different node. This only makes sense for volumes with a selected
 	// node, i.e. those with late binding, and must only be returned when it is certain
 	// that provisioning does not continue in the background. The error returned together
-	// with this state contains further information why rescheduling is needed.
+	// with this state contains further information why rescheduling is needed;
+	// without an error, rescheduling is reported as requested by the provisioner
+	// instead of as a provisioning failure.
 	ProvisioningReschedule ProvisioningState = "Reschedule"
 )
 
@@ -112,10 +261,41 @@ func (e *IgnoredError) Error() string {
 	return fmt.Sprintf("ignored because %s", e.Reason)
 }
 
+// isIgnoredError returns whether a Delete error tells that the volume is
+// deleted by another provisioner.
+func isIgnoredError(err error) bool {
+	_, ok := err.(*IgnoredError)
+	return ok
+}
+
+// RetryableError is the value for Provision and Delete to return to ask the
+// controller to retry the call after RetryAfter instead of the delay of its
+// rate limiter, e.g. when the backend asked to slow down. The retry still
+// counts as a failure towards failure thresholds and retry backoff. A zero or
+// negative RetryAfter leaves the delay to the rate limiter.
+type RetryableError struct {
+	Err        error
+	RetryAfter time.Duration
+}
+
+// NewRetryableError returns a RetryableError of err.
+func NewRetryableError(err error, retryAfter time.Duration) error {
+	return &RetryableError{Err: err, RetryAfter: retryAfter}
+}
+
+func (e *RetryableError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *RetryableError) Unwrap() error {
+	return e.Err
+}
+
 // ProvisionOptions contains all information required to provision a volume
 type ProvisionOptions struct {
 	// StorageClass is a reference to the storage class that is used for
-	// provisioning for this volume
+	// provisioning for this volume. Volumes must be placed within its
+	// AllowedTopologies, FlattenAllowedTopologies parses them.
 	StorageClass *storageapis.StorageClass
 
 	// PV.Name of the appropriate PersistentVolume. Used to generate cloud
@@ -128,6 +308,43 @@ type ProvisionOptions struct {
 	// so on.
 	PVC *v1.PersistentVolumeClaim
 
-	// Node selected by the scheduler for the volume.
+	// Node selected by the scheduler for the volume. It matches
+	// AllowedTopologies of StorageClass, the controller reschedules claims
+	// whose selected node doesn't.
 	SelectedNode *v1.Node
+
+	// Pod that uses the claim, for whose scheduling the node was selected.
+	// Set only with ResolveConsumerPod for claims with a selected node and
+	// only if the pod is in the informer cache, nil otherwise. The pod is
+	// usually not bound to the node yet, the scheduler binds it after the
+	// volume is provisioned.
+	ConsumerPod *v1.Pod
+
+	// VolumeSnapshot the claim is restored from, with the handle of the
+	// snapshot in the backend. Set only with ResolveSnapshotDataSource for
+	// claims whose data source is a VolumeSnapshot, nil otherwise.
+	SnapshotSource *SnapshotSourceInfo
+
+	// Claim the volume is cloned from, with its PV. Set only for claims
+	// whose data source is a PersistentVolumeClaim when the provisioner
+	// implements CloneSupporter, nil otherwise. The controller has checked
+	// that the source is bound, of a StorageClass of the same provisioner,
+	// not larger than the claim and of the same volume mode. A source in
+	// another namespace is allowed by CrossNamespaceDataSources.
+	CloneSource *CloneSourceInfo
+
+	// VolumeAttributesClassName of the claim, nil when it has none. The
+	// controller sets volumeAttributesClassName of the returned PV to it
+	// when the provisioner did not set it.
+	VolumeAttributesClassName *string
+
+	// Parameters of the VolumeAttributesClass named by
+	// VolumeAttributesClassName. Set only with ResolveVolumeAttributesClass,
+	// nil otherwise.
+	VolumeAttributesClassParameters map[string]string
+
+	// File system requested by the fsType or fstype parameter of
+	// StorageClass, lowercased, or the default one. Set only with
+	// AllowedFSTypes, empty otherwise.
+	FSType string
 }
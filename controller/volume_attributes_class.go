@@ -0,0 +1,40 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	storage "k8s.io/api/storage/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// volumeAttributesClassParameters returns the parameters of the
+// VolumeAttributesClass with the given name, see
+// ResolveVolumeAttributesClass. The class must be of the provisioner of the
+// StorageClass.
+func (ctrl *ProvisionController) volumeAttributesClassParameters(ctx context.Context, name string, class *storage.StorageClass) (map[string]string, error) {
+	attributesClass, err := ctrl.objectClient.StorageV1alpha1().VolumeAttributesClasses().Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get VolumeAttributesClass %q: %v", name, err)
+	}
+	if attributesClass.DriverName != class.Provisioner {
+		return nil, fmt.Errorf("VolumeAttributesClass %q is of driver %q, not of provisioner %q of StorageClass %q", name, attributesClass.DriverName, class.Provisioner, class.Name)
+	}
+	return attributesClass.Parameters, nil
+}
@@ -0,0 +1,85 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/pager"
+	klog "k8s.io/klog/v2"
+)
+
+// LabelExistingVolumes adds label, in the form "key=value[,key=value...]", to
+// all PVs provisioned by provisionerName, i.e. PVs with the annotation key
+// set to it or, if missing, pv.kubernetes.io/provisioned-by, the same way the
+// controller matches PVs. annotation is the ProvisionedByAnnotation of the
+// controller, AnnDynamicallyProvisioned by default. It is meant to be run
+// before enabling VolumeListWatchLabelSelector with the same label, so that
+// PVs provisioned earlier are still deleted by the controller.
+func LabelExistingVolumes(ctx context.Context, client kubernetes.Interface, provisionerName, annotation, label string) error {
+	logger := klog.FromContext(ctx)
+	set, err := labels.ConvertSelectorToLabelsMap(label)
+	if err != nil {
+		return fmt.Errorf("invalid label %q: %v", label, err)
+	}
+	if len(set) == 0 {
+		return fmt.Errorf("label must not be empty")
+	}
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{"labels": set},
+	})
+	if err != nil {
+		return err
+	}
+
+	selector := set.AsSelector()
+	// PVs are listed in pages, so that clusters with many PVs are not
+	// loaded at once.
+	volumes := pager.New(pager.SimplePageFunc(func(opts metav1.ListOptions) (runtime.Object, error) {
+		list, err := client.CoreV1().PersistentVolumes().List(ctx, opts)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list PVs: %v", err)
+		}
+		return list, nil
+	}))
+	return volumes.EachListItem(ctx, metav1.ListOptions{}, func(obj runtime.Object) error {
+		volume, ok := obj.(*v1.PersistentVolume)
+		if !ok {
+			return fmt.Errorf("unexpected object %T", obj)
+		}
+		provisioner, found := volume.Annotations[annotation]
+		if !found {
+			provisioner = volume.Annotations[AnnDynamicallyProvisioned]
+		}
+		if provisioner != provisionerName || selector.Matches(labels.Set(volume.Labels)) {
+			return nil
+		}
+		if _, err := client.CoreV1().PersistentVolumes().Patch(ctx, volume.Name, types.MergePatchType, patch, metav1.PatchOptions{}); err != nil {
+			return fmt.Errorf("failed to label PV %s: %v", volume.Name, err)
+		}
+		logger.V(2).Info("Labeled volume", "PV", volume.Name, "label", label)
+		return nil
+	})
+}
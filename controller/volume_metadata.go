@@ -0,0 +1,114 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"slices"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	apierrs "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/metadata/metadatainformer"
+	"k8s.io/client-go/tools/cache"
+)
+
+// newVolumeMetadataInformer returns an informer of PV metadata, optionally
+// filtered by label selector.
+func (ctrl *ProvisionController) newVolumeMetadataInformer(resyncPeriod time.Duration) cache.SharedIndexInformer {
+	var tweak metadatainformer.TweakListOptionsFunc
+	if ctrl.volumeSelector != nil {
+		selector := ctrl.volumeSelector.String()
+		tweak = func(options *metav1.ListOptions) {
+			options.LabelSelector = selector
+		}
+	}
+	return metadatainformer.NewFilteredMetadataInformer(ctrl.volumeMetadataClient, v1.SchemeGroupVersion.WithResource("persistentvolumes"),
+		metav1.NamespaceAll, resyncPeriod, cache.Indexers{}, tweak).Informer()
+}
+
+// fullVolume returns the PV to sync for a cached PV metadata, nil when the
+// metadata show that syncVolume would do nothing with it. Everything else,
+// i.e. phase, reclaim policy and the CSI driver of statically provisioned
+// PVs, is only in the full PV, which is fetched from API server.
+func (ctrl *ProvisionController) fullVolume(ctx context.Context, volumeMeta *metav1.PartialObjectMetadata) (*v1.PersistentVolume, error) {
+	if !ctrl.volumeMetadataNeedsSync(volumeMeta) {
+		return nil, nil
+	}
+	volume, err := ctrl.objectClient.CoreV1().PersistentVolumes().Get(ctx, volumeMeta.Name, metav1.GetOptions{})
+	if apierrs.IsNotFound(err) {
+		// Already deleted, nothing to do anymore.
+		return nil, nil
+	}
+	return volume, err
+}
+
+// volumeMetadataNeedsSync returns whether the full PV of volumeMeta may be
+// deleted, adopted or get its finalizer added or removed. It's false for PVs
+// provisioned by another provisioner, for PVs under deletion without the
+// finalizer of the controller and for PVs that a Bound claim in the claim
+// informer uses, unless their finalizer must be added or removed. PVs skipped
+// because of a stale claim informer are checked again on resync.
+func (ctrl *ProvisionController) volumeMetadataNeedsSync(volumeMeta *metav1.PartialObjectMetadata) bool {
+	if provisioner, found := ctrl.provisionedBy(volumeMeta.Annotations); found {
+		if !ctrl.knownProvisioner(provisioner) && !ctrl.knownProvisioner(volumeMeta.Annotations[AnnMigratedTo]) {
+			return false
+		}
+		if slices.Contains(ctrl.adoptedProvisionerNames, provisioner) {
+			return true
+		}
+	}
+	hasFinalizer := slices.Contains(volumeMeta.Finalizers, ctrl.pvFinalizer)
+	if volumeMeta.DeletionTimestamp != nil {
+		// Deleted with HonorPVReclaimPolicy or the finalizer is removed.
+		return hasFinalizer
+	}
+	if ctrl.claimsIndexer == nil {
+		return true
+	}
+	objs, err := ctrl.claimsIndexer.ByIndex(claimVolumeIndex, volumeMeta.Name)
+	if err != nil {
+		return true
+	}
+	for _, obj := range objs {
+		claim, ok := obj.(*v1.PersistentVolumeClaim)
+		if ok && claim.Status.Phase == v1.ClaimBound && claim.DeletionTimestamp == nil {
+			// The PV is not Released, only its finalizer may change.
+			return ctrl.addFinalizer != hasFinalizer
+		}
+	}
+	return true
+}
+
+// cachedVolume returns a PV created by the controller as the volume informer
+// would store it.
+func (ctrl *ProvisionController) cachedVolume(volume *v1.PersistentVolume) interface{} {
+	if ctrl.customVolumeInformer {
+		return volume
+	}
+	if ctrl.volumeMetadataClient != nil {
+		volumeMeta := &metav1.PartialObjectMetadata{
+			TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "PersistentVolume"},
+			ObjectMeta: *volume.ObjectMeta.DeepCopy(),
+		}
+		cached, _ := ctrl.transformObject(volumeMeta)
+		return cached
+	}
+	cached, _ := ctrl.transformObject(volume.DeepCopy())
+	return cached
+}
@@ -18,13 +18,20 @@ package controller
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"reflect"
+	"sort"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	v1 "k8s.io/api/core/v1"
 	apierrs "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/client-go/kubernetes"
@@ -32,6 +39,8 @@ import (
 	"k8s.io/client-go/tools/record"
 	"k8s.io/client-go/util/workqueue"
 	klog "k8s.io/klog/v2"
+	"k8s.io/utils/clock"
+	"sigs.k8s.io/sig-storage-lib-external-provisioner/v10/controller/metrics"
 )
 
 // VolumeStore is an interface that's used to save PersistentVolumes to API server.
@@ -50,7 +59,77 @@ type VolumeStore interface {
 	StoreVolume(logger klog.Logger, claim *v1.PersistentVolumeClaim, volume *v1.PersistentVolume) error
 
 	// Runs any background goroutines for implementation of the interface.
+	// The goroutines must stop when ctx is done, the controller does not
+	// save volumes after that. Run of the controller waits for Run to
+	// return.
 	Run(ctx context.Context, threadiness int)
+
+	// Len returns the number of volumes that are not saved to API server yet.
+	Len() int
+}
+
+// DrainableVolumeStore is a VolumeStore that can flush volumes it has not
+// saved yet during graceful shutdown, see ShutdownGracePeriod. Drain is called
+// while the workers finish their items and again when they are done, both
+// the queue store and the default blocking store implement it.
+type DrainableVolumeStore interface {
+	VolumeStore
+
+	// Drain retries saving all pending volumes on a fast schedule until they
+	// are saved or ctx is done. It returns the volumes that are still not
+	// saved.
+	Drain(ctx context.Context) []*v1.PersistentVolume
+}
+
+// drainRetryInterval is how often Drain of the queue and blocking stores
+// retries saving pending volumes, regardless of the store's rate limiter or
+// backoff.
+const drainRetryInterval = 50 * time.Millisecond
+
+// PVSaveFailurePolicy tells what the blocking VolumeStore does with the
+// storage asset of a volume whose PV could not be saved, see OnPVSaveFailure.
+type PVSaveFailurePolicy string
+
+const (
+	// PVSaveFailureDeleteBackendVolume rolls provisioning back, i.e. deletes
+	// the storage asset with Delete of the provisioner, given the PV that
+	// was not saved.
+	PVSaveFailureDeleteBackendVolume PVSaveFailurePolicy = "DeleteBackendVolume"
+	// PVSaveFailureRetain leaves the storage asset in the backend and
+	// sends a Warning event to the claim.
+	PVSaveFailureRetain PVSaveFailurePolicy = "Retain"
+)
+
+// VolumeStoreWithHooks is a VolumeStore that reports saved volumes to the
+// controller, see WithVolumeStore.
+type VolumeStoreWithHooks interface {
+	VolumeStore
+
+	// SetHooks is called once, before Run and StoreVolume.
+	SetHooks(hooks VolumeStoreHooks)
+}
+
+// VolumeStoreHooks are callbacks of the controller for a custom VolumeStore.
+type VolumeStoreHooks struct {
+	// Saved sends the ProvisioningSucceeded event to the claim of a saved
+	// volume. retried tells that a previous attempt to save it failed.
+	Saved func(claim *v1.PersistentVolumeClaim, volume *v1.PersistentVolume, retried bool)
+	// SaveFailed counts a failed attempt to save a volume in metrics.
+	SaveFailed func(claim *v1.PersistentVolumeClaim, volume *v1.PersistentVolume, err error)
+}
+
+// volumeStoreHooks returns hooks that send events and report metrics like
+// the built-in stores do.
+func (ctrl *ProvisionController) volumeStoreHooks() VolumeStoreHooks {
+	return VolumeStoreHooks{
+		Saved: func(claim *v1.PersistentVolumeClaim, volume *v1.PersistentVolume, retried bool) {
+			msg := provisioningSucceededMessage(ctrl.clock, &ctrl.provisionStartTimes, volume, retried)
+			ctrl.event(claim, v1.EventTypeNormal, "ProvisioningSucceeded", msg)
+		},
+		SaveFailed: func(_ *v1.PersistentVolumeClaim, volume *v1.PersistentVolume, _ error) {
+			ctrl.metrics.PersistentVolumeSaveFailedTotal.WithLabelValues(volume.Spec.StorageClassName).Inc()
+		},
+	}
 }
 
 // queueStore is implementation of VolumeStore that re-tries saving
@@ -59,13 +138,29 @@ type VolumeStore interface {
 type queueStore struct {
 	client        kubernetes.Interface
 	queue         workqueue.RateLimitingInterface
-	eventRecorder record.EventRecorder
+	limiter       workqueue.RateLimiter
+	event         eventFunc
 	claimsIndexer cache.Indexer
+	metrics       *metrics.Metrics
+	// Age of an unsaved volume after which a warning event is sent to its claim.
+	pendingWarningAge time.Duration
+	// Map claim UID -> start of provisioning, may be nil.
+	provisionStartTimes *sync.Map
+	clock               clock.Clock
 
 	volumes sync.Map
+	// Map volume name -> time of the first failed save.
+	pendingSince sync.Map
+	// Map volume name -> PendingVolumeInfo of the last failed save.
+	saveStates sync.Map
+	// Set by Drain, the workers leave pending volumes to Drain then.
+	draining atomic.Bool
+	// Saves a volume instead of Create of client, if not nil.
+	create func(ctx context.Context, volume *v1.PersistentVolume) error
 }
 
-var _ VolumeStore = &queueStore{}
+var _ DrainableVolumeStore = &queueStore{}
+var _ PendingVolumeLister = &queueStore{}
 
 // NewVolumeStoreQueue returns VolumeStore that uses asynchronous workqueue to save PVs.
 func NewVolumeStoreQueue(
@@ -74,18 +169,43 @@ func NewVolumeStoreQueue(
 	claimsIndexer cache.Indexer,
 	eventRecorder record.EventRecorder,
 ) VolumeStore {
+	return newVolumeStoreQueue(client, limiter, claimsIndexer, eventRecorder.Event, nil, 0, nil, clock.RealClock{})
+}
 
+// newVolumeStoreQueue returns queueStore that reports unsaved volumes to the
+// given metrics (if not nil) and warns claims whose volume is still not
+// saved after pendingWarningAge (if not zero). provisionStartTimes (if not
+// nil) is used to report the provisioning duration in success events. The
+// store emits events with event and measures time and waits with clk.
+func newVolumeStoreQueue(
+	client kubernetes.Interface,
+	limiter workqueue.RateLimiter,
+	claimsIndexer cache.Indexer,
+	event eventFunc,
+	metrics *metrics.Metrics,
+	pendingWarningAge time.Duration,
+	provisionStartTimes *sync.Map,
+	clk clock.Clock,
+) *queueStore {
 	return &queueStore{
-		client:        client,
-		queue:         workqueue.NewNamedRateLimitingQueue(limiter, "unsavedpvs"),
-		claimsIndexer: claimsIndexer,
-		eventRecorder: eventRecorder,
+		client:              client,
+		queue:               workqueue.NewRateLimitingQueueWithConfig(limiter, workqueue.RateLimitingQueueConfig{Name: "unsavedpvs", Clock: tickerClock(clk)}),
+		limiter:             limiter,
+		claimsIndexer:       claimsIndexer,
+		event:               event,
+		metrics:             metrics,
+		pendingWarningAge:   pendingWarningAge,
+		provisionStartTimes: provisionStartTimes,
+		clock:               clk,
 	}
 }
 
 func (q *queueStore) StoreVolume(logger klog.Logger, _ *v1.PersistentVolumeClaim, volume *v1.PersistentVolume) error {
-	if err := q.doSaveVolume(logger, volume); err != nil {
+	if err := q.doSaveVolume(logger, volume, false); err != nil {
 		q.volumes.Store(volume.Name, volume)
+		q.pendingSince.LoadOrStore(volume.Name, q.clock.Now())
+		q.saveStates.Store(volume.Name, newPendingVolumeInfo(volume, 1, err, q.clock.Now()))
+		q.updatePendingMetric()
 		q.queue.Add(volume.Name)
 		logger.Error(err, "Failed to save volume", "volume", volume.Name)
 	}
@@ -93,13 +213,47 @@ func (q *queueStore) StoreVolume(logger klog.Logger, _ *v1.PersistentVolumeClaim
 	return nil
 }
 
+func (q *queueStore) Len() int {
+	count := 0
+	q.volumes.Range(func(key, value interface{}) bool {
+		count++
+		return true
+	})
+	return count
+}
+
+func (q *queueStore) PendingVolumes() []PendingVolumeInfo {
+	return listPendingVolumes(&q.saveStates)
+}
+
+// recordFailedSave updates PendingVolumes after a failed retry of volume.
+func (q *queueStore) recordFailedSave(volume *v1.PersistentVolume, err error, delay time.Duration) {
+	attempts := 1
+	if obj, found := q.saveStates.Load(volume.Name); found {
+		attempts = obj.(PendingVolumeInfo).Attempts + 1
+	}
+	q.saveStates.Store(volume.Name, newPendingVolumeInfo(volume, attempts, err, q.clock.Now().Add(delay)))
+}
+
+func (q *queueStore) updatePendingMetric() {
+	if q.metrics != nil {
+		q.metrics.PersistentVolumesPendingSave.Set(float64(q.Len()))
+	}
+}
+
 func (q *queueStore) Run(ctx context.Context, threadiness int) {
 	logger := klog.FromContext(ctx)
 	logger.Info("Starting save volume queue")
+	var workers sync.WaitGroup
+	defer workers.Wait()
 	defer q.queue.ShutDown()
 
 	for i := 0; i < threadiness; i++ {
-		go wait.UntilWithContext(ctx, q.saveVolumeWorker, time.Second)
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			untilWithClock(ctx, q.clock, q.saveVolumeWorker, time.Second)
+		}()
 	}
 	<-ctx.Done()
 	logger.Info("Stopped save volume queue")
@@ -117,6 +271,10 @@ func (q *queueStore) processNextWorkItem(ctx context.Context) bool {
 	if shutdown {
 		return false
 	}
+	if q.draining.Load() {
+		q.queue.Forget(obj)
+		return true
+	}
 
 	var volumeName string
 	var ok bool
@@ -141,29 +299,220 @@ func (q *queueStore) processNextWorkItem(ctx context.Context) bool {
 	}
 
 	logger := klog.FromContext(ctx)
-	if err := q.doSaveVolume(logger, volume); err != nil {
-		q.queue.AddRateLimited(volumeName)
+	if claimRef := volume.Spec.ClaimRef; claimRef != nil {
+		// Use the same keys as the controller's log lines about the claim.
+		logger = klog.LoggerWithValues(logger, "PVC", klog.KRef(claimRef.Namespace, claimRef.Name), "claimUID", claimRef.UID)
+	}
+	if err := q.doSaveVolume(logger, volume, true); err != nil {
+		// Like AddRateLimited, the delay is needed for PendingVolumes.
+		delay := q.limiter.When(volumeName)
+		q.recordFailedSave(volume, err, delay)
+		q.queue.AddAfter(volumeName, delay)
 		utilruntime.HandleError(err)
 		logger.V(5).Info("Volume enqueued", "volume", volume.Name)
+		q.warnIfPendingTooLong(logger, volume, err)
 		return true
 	}
 	q.volumes.Delete(volumeName)
+	q.pendingSince.Delete(volumeName)
+	q.saveStates.Delete(volumeName)
+	q.updatePendingMetric()
 	q.queue.Forget(volumeName)
 	return true
 }
 
-func (q *queueStore) doSaveVolume(logger klog.Logger, volume *v1.PersistentVolume) error {
+func (q *queueStore) Drain(ctx context.Context) []*v1.PersistentVolume {
+	logger := klog.FromContext(ctx)
+	q.draining.Store(true)
+	logger.Info("Draining save volume queue", "volumes", q.Len())
+	for {
+		var pending []*v1.PersistentVolume
+		q.volumes.Range(func(key, value interface{}) bool {
+			volume := value.(*v1.PersistentVolume)
+			if err := q.doSaveVolume(logger, volume, true); err != nil {
+				logger.V(4).Info("Failed to save volume during drain", "volume", volume.Name, "err", err)
+				q.recordFailedSave(volume, err, drainRetryInterval)
+				pending = append(pending, volume)
+				return true
+			}
+			q.volumes.Delete(key)
+			q.pendingSince.Delete(key)
+			q.saveStates.Delete(key)
+			return true
+		})
+		q.updatePendingMetric()
+		if len(pending) == 0 {
+			return nil
+		}
+		select {
+		case <-q.clock.After(drainRetryInterval):
+		case <-ctx.Done():
+			return pending
+		}
+	}
+}
+
+// volumeMismatchError is returned when a PV with the name of a provisioned
+// volume already exists and is not equivalent to it.
+type volumeMismatchError struct {
+	name  string
+	diffs []string
+	// Whether the existing PV uses the same storage asset.
+	sameSource bool
+}
+
+func (e *volumeMismatchError) Error() string {
+	return fmt.Sprintf("PV %s already exists and differs from the provisioned volume: %s", e.name, strings.Join(e.diffs, "; "))
+}
+
+// adoptExistingVolume is called when volume could not be created because a
+// PV with its name exists, e.g. saved before a crash of the controller. It
+// returns nil when the existing PV is equivalent to volume, see
+// checkExistingVolume, so that the existing one can be used.
+func adoptExistingVolume(ctx context.Context, logger klog.Logger, client kubernetes.Interface, volume *v1.PersistentVolume) error {
+	existing, err := client.CoreV1().PersistentVolumes().Get(ctx, volume.Name, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to get existing PV %s: %v", volume.Name, err)
+	}
+	return checkExistingVolume(logger, existing, volume)
+}
+
+// checkExistingVolume returns nil when the existing PV is equivalent to
+// volume, i.e. has the same claim UID, capacity and source and all its
+// annotations, ignoring fields defaulted by API server, and a
+// volumeMismatchError otherwise.
+func checkExistingVolume(logger klog.Logger, existing, volume *v1.PersistentVolume) error {
+	var diffs []string
+	var existingUID, newUID types.UID
+	if existing.Spec.ClaimRef != nil {
+		existingUID = existing.Spec.ClaimRef.UID
+	}
+	if volume.Spec.ClaimRef != nil {
+		newUID = volume.Spec.ClaimRef.UID
+	}
+	if existingUID != newUID {
+		diffs = append(diffs, fmt.Sprintf("claimRef UID %q, provisioned %q", existingUID, newUID))
+	}
+	existingCapacity, newCapacity := existing.Spec.Capacity[v1.ResourceStorage], volume.Spec.Capacity[v1.ResourceStorage]
+	if existingCapacity.Cmp(newCapacity) != 0 {
+		diffs = append(diffs, fmt.Sprintf("capacity %s, provisioned %s", existingCapacity.String(), newCapacity.String()))
+	}
+	sameSource, err := jsonSubset(volume.Spec.PersistentVolumeSource, existing.Spec.PersistentVolumeSource)
+	if err != nil {
+		return err
+	}
+	if !sameSource {
+		existingSource, _ := json.Marshal(existing.Spec.PersistentVolumeSource)
+		newSource, _ := json.Marshal(volume.Spec.PersistentVolumeSource)
+		diffs = append(diffs, fmt.Sprintf("source %s, provisioned %s", existingSource, newSource))
+	}
+	for key, value := range volume.Annotations {
+		if existingValue, ok := existing.Annotations[key]; !ok || existingValue != value {
+			diffs = append(diffs, fmt.Sprintf("annotation %s %q, provisioned %q", key, existingValue, value))
+		}
+	}
+	if len(diffs) > 0 {
+		sort.Strings(diffs)
+		return &volumeMismatchError{name: volume.Name, diffs: diffs, sameSource: sameSource}
+	}
+	logger.V(2).Info("Adopted existing PV", "PV", volume.Name)
+	return nil
+}
+
+// jsonSubset returns whether all fields set in want have the same values in
+// got, in their JSON representation. Fields set only in got, e.g. defaulted
+// by API server, are ignored.
+func jsonSubset(want, got interface{}) (bool, error) {
+	var wantValue, gotValue interface{}
+	for _, v := range []struct {
+		obj   interface{}
+		value *interface{}
+	}{{want, &wantValue}, {got, &gotValue}} {
+		data, err := json.Marshal(v.obj)
+		if err != nil {
+			return false, err
+		}
+		if err := json.Unmarshal(data, v.value); err != nil {
+			return false, err
+		}
+	}
+	return jsonValueSubset(wantValue, gotValue), nil
+}
+
+func jsonValueSubset(want, got interface{}) bool {
+	switch want := want.(type) {
+	case map[string]interface{}:
+		gotMap, ok := got.(map[string]interface{})
+		if !ok {
+			return false
+		}
+		for key, value := range want {
+			if !jsonValueSubset(value, gotMap[key]) {
+				return false
+			}
+		}
+		return true
+	case []interface{}:
+		gotSlice, ok := got.([]interface{})
+		if !ok || len(gotSlice) != len(want) {
+			return false
+		}
+		for i := range want {
+			if !jsonValueSubset(want[i], gotSlice[i]) {
+				return false
+			}
+		}
+		return true
+	default:
+		return reflect.DeepEqual(want, got)
+	}
+}
+
+// doSaveVolume tries to save the volume once. retried tells that a previous
+// attempt failed.
+func (q *queueStore) doSaveVolume(logger klog.Logger, volume *v1.PersistentVolume, retried bool) error {
 	logger.V(5).Info("Saving volume", "volume", volume.Name)
-	_, err := q.client.CoreV1().PersistentVolumes().Create(context.Background(), volume, metav1.CreateOptions{})
-	if err == nil || apierrs.IsAlreadyExists(err) {
+	var err error
+	if q.create != nil {
+		err = q.create(klog.NewContext(context.Background(), logger), volume)
+	} else {
+		_, err = q.client.CoreV1().PersistentVolumes().Create(context.Background(), volume, metav1.CreateOptions{})
+		if apierrs.IsAlreadyExists(err) {
+			err = adoptExistingVolume(context.Background(), logger, q.client, volume)
+		}
+	}
+	if err == nil {
 		logger.V(5).Info("Volume saved", "volume", volume.Name)
-		q.sendSuccessEvent(logger, volume)
+		q.sendEvent(logger, volume, v1.EventTypeNormal, "ProvisioningSucceeded", provisioningSucceededMessage(q.clock, q.provisionStartTimes, volume, retried))
 		return nil
 	}
+	if q.metrics != nil {
+		q.metrics.PersistentVolumeSaveFailedTotal.WithLabelValues(volume.Spec.StorageClassName).Inc()
+	}
 	return fmt.Errorf("error saving volume %s: %s", volume.Name, err)
 }
 
-func (q *queueStore) sendSuccessEvent(logger klog.Logger, volume *v1.PersistentVolume) {
+// warnIfPendingTooLong sends a warning event to the claim of the volume once
+// the volume has not been saved for longer than pendingWarningAge.
+func (q *queueStore) warnIfPendingTooLong(logger klog.Logger, volume *v1.PersistentVolume, err error) {
+	if q.pendingWarningAge == 0 {
+		return
+	}
+	obj, found := q.pendingSince.Load(volume.Name)
+	if !found {
+		return
+	}
+	since, ok := obj.(time.Time)
+	if !ok || since.IsZero() || q.clock.Since(since) < q.pendingWarningAge {
+		return
+	}
+	// Send the event only once per volume, the zero time marks it as reported.
+	q.pendingSince.Store(volume.Name, time.Time{})
+	msg := fmt.Sprintf("Provisioned volume %s is not saved to API server for more than %s: %v", volume.Name, q.pendingWarningAge, err)
+	q.sendEvent(logger, volume, v1.EventTypeWarning, "ProvisioningSavePending", msg)
+}
+
+func (q *queueStore) sendEvent(logger klog.Logger, volume *v1.PersistentVolume, eventType, reason, msg string) {
 	claimObjs, err := q.claimsIndexer.ByIndex(uidIndex, string(volume.Spec.ClaimRef.UID))
 	if err != nil {
 		logger.V(2).Info("Error sending event to claim", "claimUID", volume.Spec.ClaimRef.UID, "err", err)
@@ -176,8 +525,7 @@ func (q *queueStore) sendSuccessEvent(logger klog.Logger, volume *v1.PersistentV
 	if !ok {
 		return
 	}
-	msg := fmt.Sprintf("Successfully provisioned volume %s", volume.Name)
-	q.eventRecorder.Event(claim, v1.EventTypeNormal, "ProvisioningSucceeded", msg)
+	q.event(claim, eventType, reason, msg)
 }
 
 // backoffStore is implementation of VolumeStore that blocks and tries to save
@@ -185,13 +533,34 @@ func (q *queueStore) sendSuccessEvent(logger klog.Logger, volume *v1.PersistentV
 // StoreVolume() deletes the storage asset in the end and returns appropriate
 // error code.
 type backoffStore struct {
-	client        kubernetes.Interface
-	eventRecorder record.EventRecorder
-	backoff       *wait.Backoff
-	ctrl          *ProvisionController
+	client  kubernetes.Interface
+	event   eventFunc
+	backoff *wait.Backoff
+	ctrl    *ProvisionController
+
+	// Number of volumes being saved right now.
+	pending atomic.Int32
+	// Map volume name -> PendingVolumeInfo of the last failed save of
+	// volumes being saved right now.
+	saveStates sync.Map
+	// Map volume name -> *v1.PersistentVolume of volumes whose save is
+	// being retried right now, see Drain.
+	saving sync.Map
+
+	// Closed by Drain, saves are retried every drainRetryInterval.
+	draining  chan struct{}
+	drainOnce sync.Once
+	// Closed when Drain gives up, saves stop and their storage assets are
+	// kept.
+	abandoned   chan struct{}
+	abandonOnce sync.Once
 }
 
-var _ VolumeStore = &backoffStore{}
+var _ DrainableVolumeStore = &backoffStore{}
+var _ PendingVolumeLister = &backoffStore{}
+
+// errSaveAbandoned is returned by retrySave when Drain gave up.
+var errSaveAbandoned = errors.New("save abandoned at shutdown")
 
 // NewBackoffStore returns VolumeStore that uses blocking exponential backoff to save PVs.
 func NewBackoffStore(client kubernetes.Interface,
@@ -199,54 +568,114 @@ func NewBackoffStore(client kubernetes.Interface,
 	backoff *wait.Backoff,
 	ctrl *ProvisionController,
 ) VolumeStore {
+	return newBackoffStore(client, eventRecorder.Event, backoff, ctrl)
+}
+
+// newBackoffStore returns backoffStore that emits events by event.
+func newBackoffStore(client kubernetes.Interface, event eventFunc, backoff *wait.Backoff, ctrl *ProvisionController) *backoffStore {
 	return &backoffStore{
-		client:        client,
-		eventRecorder: eventRecorder,
-		backoff:       backoff,
-		ctrl:          ctrl,
+		client:    client,
+		event:     event,
+		backoff:   backoff,
+		ctrl:      ctrl,
+		draining:  make(chan struct{}),
+		abandoned: make(chan struct{}),
 	}
 }
 
 func (b *backoffStore) StoreVolume(logger klog.Logger, claim *v1.PersistentVolumeClaim, volume *v1.PersistentVolume) error {
+	b.ctrl.metrics.PersistentVolumesPendingSave.Set(float64(b.pending.Add(1)))
+	defer func() {
+		b.saveStates.Delete(volume.Name)
+		b.ctrl.metrics.PersistentVolumesPendingSave.Set(float64(b.pending.Add(-1)))
+	}()
+	// A copy of the backoff to tell when the next attempt is made. It is
+	// approximate when the backoff has jitter.
+	retries := *b.backoff
+
 	// Try to create the PV object several times
 	var lastSaveError error
-	err := wait.ExponentialBackoff(*b.backoff, func() (bool, error) {
+	warned := false
+	attempts := 0
+	start := b.ctrl.clock.Now()
+	b.saving.Store(volume.Name, volume)
+	err := b.retrySave(func() (bool, error) {
+		attempts++
 		logger.V(4).Info("Trying to save persistentvolume", "persistentvolume", volume.Name)
 		var err error
-		if _, err = b.client.CoreV1().PersistentVolumes().Create(context.Background(), volume, metav1.CreateOptions{}); err == nil || apierrs.IsAlreadyExists(err) {
-			// Save succeeded.
-			if err != nil {
-				logger.V(2).Info("Persistentvolume already exists, reusing", "persistentvolume", volume.Name)
-			} else {
-				logger.V(4).Info("Persistentvolume saved", "persistentvolume", volume.Name)
+		if b.ctrl.serverSideApply {
+			err = b.ctrl.createVolumeWithApply(klog.NewContext(context.Background(), logger), volume)
+		} else {
+			_, err = b.client.CoreV1().PersistentVolumes().Create(context.Background(), volume, metav1.CreateOptions{})
+			if apierrs.IsAlreadyExists(err) {
+				err = adoptExistingVolume(context.Background(), logger, b.client, volume)
 			}
+		}
+		if err == nil {
+			// Save succeeded.
+			logger.V(4).Info("Persistentvolume saved", "persistentvolume", volume.Name)
 			return true, nil
 		}
 		// Save failed, try again after a while.
 		logger.Info("Failed to save persistentvolume", "persistentvolume", volume.Name, "err", err)
+		b.ctrl.metrics.PersistentVolumeSaveFailedTotal.WithLabelValues(volume.Spec.StorageClassName).Inc()
+		var nextRetry time.Time
+		if b.isDraining() {
+			nextRetry = b.ctrl.clock.Now().Add(drainRetryInterval)
+		} else if retries.Steps > 1 {
+			nextRetry = b.ctrl.clock.Now().Add(retries.Step())
+		}
+		b.saveStates.Store(volume.Name, newPendingVolumeInfo(volume, attempts, err, nextRetry))
+		if age := b.ctrl.pendingSaveWarningAge; !warned && age != 0 && b.ctrl.clock.Since(start) >= age {
+			msg := fmt.Sprintf("Provisioned volume %s is not saved to API server for more than %s: %v", volume.Name, age, err)
+			b.event(claim, v1.EventTypeWarning, "ProvisioningSavePending", msg)
+			warned = true
+		}
 		lastSaveError = err
 		return false, nil
 	})
+	b.saving.Delete(volume.Name)
 
 	if err == nil {
 		// Save succeeded
-		msg := fmt.Sprintf("Successfully provisioned volume %s", volume.Name)
-		b.eventRecorder.Event(claim, v1.EventTypeNormal, "ProvisioningSucceeded", msg)
+		msg := provisioningSucceededMessage(b.ctrl.clock, &b.ctrl.provisionStartTimes, volume, attempts > 1)
+		b.event(claim, v1.EventTypeNormal, "ProvisioningSucceeded", msg)
 		return nil
 	}
 
 	// Save failed. Now we have a storage asset outside of Kubernetes,
 	// but we don't have appropriate PV object for it.
+	if errors.Is(err, errSaveAbandoned) {
+		// Logged with what is needed to recover it by abandon of the
+		// controller.
+		return lastSaveError
+	}
+	var mismatch *volumeMismatchError
+	if errors.As(lastSaveError, &mismatch) && mismatch.sameSource {
+		// The existing PV uses the storage asset, it must not be deleted.
+		logger.Error(lastSaveError, "Existing PV uses the provisioned volume. Keeping the volume.")
+		strerr := fmt.Sprintf("Error creating provisioned PV object for claim %s: %v. The volume is kept, the existing PV uses it.", klog.KObj(claim), lastSaveError)
+		b.event(claim, v1.EventTypeWarning, "ProvisioningSaveFailed", strerr)
+		return lastSaveError
+	}
+	if b.ctrl.pvSaveFailurePolicy == PVSaveFailureRetain {
+		logger.Error(lastSaveError, "Error creating provisioned PV object for claim. Keeping the volume.")
+		strerr := fmt.Sprintf("Error creating provisioned PV object for claim %s: %v. Volume %s is kept in the storage backend, it is reused if the claim is provisioned again or must be deleted manually.", klog.KObj(claim), lastSaveError, volume.Name)
+		b.event(claim, v1.EventTypeWarning, "ProvisioningSaveFailed", strerr)
+		return lastSaveError
+	}
+
 	// Emit some event here and try to delete the storage asset several
 	// times.
-	logger.Error(lastSaveError, "Error creating provisioned PV object for claim. Deleting the volume.", "claim", klog.KObj(claim))
+	logger.Error(lastSaveError, "Error creating provisioned PV object for claim. Deleting the volume.")
 	strerr := fmt.Sprintf("Error creating provisioned PV object for claim %s: %v. Deleting the volume.", klog.KObj(claim), lastSaveError)
-	b.eventRecorder.Event(claim, v1.EventTypeWarning, "ProvisioningFailed", strerr)
+	b.event(claim, v1.EventTypeWarning, "ProvisioningFailed", strerr)
 
 	var lastDeleteError error
-	err = wait.ExponentialBackoff(*b.backoff, func() (bool, error) {
-		if err = b.ctrl.provisioner.Delete(context.Background(), volume); err == nil {
-			// Delete succeeded
+	err = exponentialBackoffWithClock(b.ctrl.clock, *b.backoff, func() (bool, error) {
+		if err = b.ctrl.provisioner.Delete(context.Background(), volume); err == nil || isIgnoredError(err) {
+			// Delete succeeded, or another provisioner takes care of the volume
+			// like in deleteVolumeOperation.
 			logger.V(4).Info("Cleaning volume succeeded", "volume", volume.Name)
 			return true, nil
 		}
@@ -258,14 +687,87 @@ func (b *backoffStore) StoreVolume(logger klog.Logger, claim *v1.PersistentVolum
 	if err != nil {
 		// Delete failed several times. There is an orphaned volume and there
 		// is nothing we can do about it.
-		logger.Error(lastSaveError, "Error cleaning provisioned volume for claim. Please delete manually.", "claim", klog.KObj(claim))
+		logger.Error(lastSaveError, "Error cleaning provisioned volume for claim. Please delete manually.")
 		strerr := fmt.Sprintf("Error cleaning provisioned volume for claim %s: %v. Please delete manually.", klog.KObj(claim), lastDeleteError)
-		b.eventRecorder.Event(claim, v1.EventTypeWarning, "ProvisioningCleanupFailed", strerr)
+		b.event(claim, v1.EventTypeWarning, "ProvisioningCleanupFailed", strerr)
+	} else {
+		strerr := fmt.Sprintf("Provisioning was rolled back, volume %s was deleted because its PV could not be saved: %v. The claim will be provisioned again.", volume.Name, lastSaveError)
+		b.event(claim, v1.EventTypeWarning, "ProvisioningRolledBack", strerr)
 	}
 
 	return lastSaveError
 }
 
+// retrySave calls save with the backoff of the store until it succeeds or
+// the backoff steps run out. While the store drains, save is retried every
+// drainRetryInterval regardless of the backoff until it succeeds or Drain
+// gives up.
+func (b *backoffStore) retrySave(save wait.ConditionFunc) error {
+	backoff := *b.backoff
+	for {
+		if ok, err := save(); err != nil || ok {
+			return err
+		}
+		if b.isDraining() {
+			select {
+			case <-b.ctrl.clock.After(drainRetryInterval):
+				continue
+			case <-b.abandoned:
+				return errSaveAbandoned
+			}
+		}
+		if backoff.Steps <= 1 {
+			return wait.ErrorInterrupted(nil)
+		}
+		select {
+		case <-b.ctrl.clock.After(backoff.Step()):
+		case <-b.draining:
+		}
+	}
+}
+
+func (b *backoffStore) isDraining() bool {
+	select {
+	case <-b.draining:
+		return true
+	default:
+		return false
+	}
+}
+
+// Drain makes the saves in progress retry every drainRetryInterval and waits
+// until they finish or ctx is done. Then the remaining saves are abandoned:
+// StoreVolume returns without deleting their storage assets and their
+// volumes are returned.
+func (b *backoffStore) Drain(ctx context.Context) []*v1.PersistentVolume {
+	b.drainOnce.Do(func() { close(b.draining) })
+	klog.FromContext(ctx).Info("Draining volumes being saved", "volumes", b.Len())
+	for {
+		var saving []*v1.PersistentVolume
+		b.saving.Range(func(_, value interface{}) bool {
+			saving = append(saving, value.(*v1.PersistentVolume))
+			return true
+		})
+		if len(saving) == 0 {
+			return nil
+		}
+		select {
+		case <-b.ctrl.clock.After(drainRetryInterval):
+		case <-ctx.Done():
+			b.abandonOnce.Do(func() { close(b.abandoned) })
+			return saving
+		}
+	}
+}
+
 func (b *backoffStore) Run(ctx context.Context, threadiness int) {
 	// There is not background processing
 }
+
+func (b *backoffStore) Len() int {
+	return int(b.pending.Load())
+}
+
+func (b *backoffStore) PendingVolumes() []PendingVolumeInfo {
+	return listPendingVolumes(&b.saveStates)
+}
@@ -0,0 +1,144 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+	storage "k8s.io/api/storage/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	klog "k8s.io/klog/v2"
+	"sigs.k8s.io/sig-storage-lib-external-provisioner/v10/util"
+)
+
+var validAccessModes = []v1.PersistentVolumeAccessMode{v1.ReadWriteOnce, v1.ReadOnlyMany, v1.ReadWriteMany, v1.ReadWriteOncePod}
+
+// ValidateProvisionedVolume checks the PV returned by Provision for the
+// claim: its name must be a DNS subdomain, it must have a positive storage
+// capacity, exactly one volume source and valid access modes, only
+// ReadWriteOncePod if the claim requests it, and its claimRef, if set, must
+// refer to the claim. The controller sets claimRef
+// when it is not set. It returns an error listing all violations, each with
+// the path of the field, e.g. "spec.capacity[storage]".
+// The controller calls it before saving the PV, provisioners may call it in
+// their tests.
+func ValidateProvisionedVolume(volume *v1.PersistentVolume, claim *v1.PersistentVolumeClaim) error {
+	if volume == nil {
+		return field.Required(field.NewPath("persistentVolume"), "must not be nil")
+	}
+	var errs field.ErrorList
+
+	namePath := field.NewPath("metadata", "name")
+	if volume.Name == "" {
+		errs = append(errs, field.Required(namePath, ""))
+	} else {
+		for _, msg := range validation.IsDNS1123Subdomain(volume.Name) {
+			errs = append(errs, field.Invalid(namePath, volume.Name, msg))
+		}
+	}
+
+	capacityPath := field.NewPath("spec", "capacity").Key(string(v1.ResourceStorage))
+	if capacity, ok := volume.Spec.Capacity[v1.ResourceStorage]; !ok {
+		errs = append(errs, field.Required(capacityPath, ""))
+	} else if capacity.Sign() <= 0 {
+		errs = append(errs, field.Invalid(capacityPath, capacity.String(), "must be greater than zero"))
+	}
+
+	sourcePath := field.NewPath("spec", "persistentVolumeSource")
+	switch sources := volumeSources(&volume.Spec.PersistentVolumeSource); len(sources) {
+	case 0:
+		errs = append(errs, field.Required(sourcePath, "exactly one volume source must be set"))
+	case 1:
+	default:
+		errs = append(errs, field.Forbidden(sourcePath, fmt.Sprintf("exactly one volume source must be set, got %s", strings.Join(sources, ", "))))
+	}
+
+	accessModesPath := field.NewPath("spec", "accessModes")
+	if len(volume.Spec.AccessModes) == 0 {
+		errs = append(errs, field.Required(accessModesPath, ""))
+	}
+	for i, mode := range volume.Spec.AccessModes {
+		if !slices.Contains(validAccessModes, mode) {
+			errs = append(errs, field.NotSupported(accessModesPath.Index(i), mode, accessModeStrings(validAccessModes)))
+		}
+	}
+	if claim != nil && util.AccessModesContains(claim.Spec.AccessModes, v1.ReadWriteOncePod) && len(volume.Spec.AccessModes) > 0 &&
+		(len(volume.Spec.AccessModes) != 1 || volume.Spec.AccessModes[0] != v1.ReadWriteOncePod) {
+		errs = append(errs, field.Invalid(accessModesPath, accessModeStrings(volume.Spec.AccessModes), "must be only ReadWriteOncePod, requested by the claim"))
+	}
+
+	if claimRef := volume.Spec.ClaimRef; claimRef != nil && claim != nil {
+		claimRefPath := field.NewPath("spec", "claimRef")
+		if claimRef.Namespace != claim.Namespace || claimRef.Name != claim.Name {
+			errs = append(errs, field.Invalid(claimRefPath, klog.KRef(claimRef.Namespace, claimRef.Name).String(), fmt.Sprintf("must refer to claim %s", klog.KObj(claim))))
+		} else if claimRef.UID != "" && claimRef.UID != claim.UID {
+			errs = append(errs, field.Invalid(claimRefPath.Child("uid"), claimRef.UID, fmt.Sprintf("must be UID %s of the claim", claim.UID)))
+		}
+	}
+	return errs.ToAggregate()
+}
+
+// volumeSources returns JSON names of the sources set in source.
+func volumeSources(source *v1.PersistentVolumeSource) []string {
+	var sources []string
+	value := reflect.ValueOf(source).Elem()
+	for i := 0; i < value.NumField(); i++ {
+		if !value.Field(i).IsNil() {
+			name, _, _ := strings.Cut(value.Type().Field(i).Tag.Get("json"), ",")
+			sources = append(sources, name)
+		}
+	}
+	return sources
+}
+
+func accessModeStrings(modes []v1.PersistentVolumeAccessMode) []string {
+	strs := make([]string, 0, len(modes))
+	for _, mode := range modes {
+		strs = append(strs, string(mode))
+	}
+	return strs
+}
+
+// rejectInvalidVolume sends an event about a PV returned by Provision that
+// failed ValidateProvisionedVolume and rolls provisioning back, unless
+// OnPVSaveFailure is Retain, like when the PV could not be saved. The claim
+// is not provisioned again until it changes.
+func (ctrl *ProvisionController) rejectInvalidVolume(ctx context.Context, claim *v1.PersistentVolumeClaim, class *storage.StorageClass, volume *v1.PersistentVolume, err error) (ProvisioningState, error) {
+	logger := klog.FromContext(ctx)
+	logger.Error(err, "Provisioner returned an invalid volume")
+	msg := fmt.Sprintf("Provisioner %s returned an invalid PersistentVolume: %v", class.Provisioner, err)
+	if volume == nil {
+		ctrl.event(claim, v1.EventTypeWarning, "ProvisioningFailed", msg)
+		return ProvisioningFinished, errStopProvision
+	}
+	if ctrl.pvSaveFailurePolicy == PVSaveFailureRetain {
+		ctrl.event(claim, v1.EventTypeWarning, "ProvisioningFailed", fmt.Sprintf("%s. Volume %s is kept in the storage backend.", msg, volume.Name))
+		return ProvisioningFinished, errStopProvision
+	}
+	ctrl.event(claim, v1.EventTypeWarning, "ProvisioningFailed", fmt.Sprintf("%s. Deleting the volume.", msg))
+	if err := ctrl.provisioner.Delete(ctx, volume); err != nil && !isIgnoredError(err) {
+		logger.Error(err, "Error cleaning invalid provisioned volume. Please delete manually.", "PV", volume.Name)
+		ctrl.event(claim, v1.EventTypeWarning, "ProvisioningCleanupFailed", fmt.Sprintf("Error cleaning provisioned volume %s for claim %s: %v. Please delete manually.", volume.Name, klog.KObj(claim), err))
+	}
+	return ProvisioningFinished, errStopProvision
+}
@@ -0,0 +1,76 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+const (
+	// maxProvisionWarnings is the maximum number of ProvisioningWarning
+	// events sent to a claim.
+	maxProvisionWarnings = 5
+	// maxProvisionWarningLength is the maximum length of the message of a
+	// ProvisioningWarning event.
+	maxProvisionWarningLength = 256
+)
+
+// provision calls ProvisionExt of the provisioner if it implements
+// ProvisionerExt, otherwise Provision.
+func (ctrl *ProvisionController) provision(ctx context.Context, options ProvisionOptions) (*v1.PersistentVolume, []string, ProvisioningState, error) {
+	provisioner, ok := ctrl.provisioner.(ProvisionerExt)
+	if !ok {
+		volume, result, err := ctrl.provisioner.Provision(ctx, options)
+		return volume, nil, result, err
+	}
+	res, result, err := provisioner.ProvisionExt(ctx, options)
+	if err != nil || res == nil {
+		return nil, nil, result, err
+	}
+	return res.Volume, res.Warnings, result, nil
+}
+
+// sendProvisionWarnings sends warnings returned by ProvisionExt to the
+// claim, skipping empty ones and the ones already sent to it.
+func (ctrl *ProvisionController) sendProvisionWarnings(claim *v1.PersistentVolumeClaim, warnings []string) {
+	if len(warnings) == 0 {
+		return
+	}
+	// The map is replaced, not modified, so that it is never written while read.
+	sent := map[string]bool{}
+	if obj, ok := ctrl.provisionWarnings.Load(claim.UID); ok {
+		for warning := range obj.(map[string]bool) {
+			sent[warning] = true
+		}
+	}
+	for _, warning := range warnings {
+		if len(sent) == maxProvisionWarnings {
+			break
+		}
+		if runes := []rune(warning); len(runes) > maxProvisionWarningLength {
+			warning = string(runes[:maxProvisionWarningLength-3]) + "..."
+		}
+		if warning == "" || sent[warning] {
+			continue
+		}
+		sent[warning] = true
+		ctrl.event(claim, v1.EventTypeNormal, "ProvisioningWarning", warning)
+	}
+	ctrl.provisionWarnings.Store(claim.UID, sent)
+}
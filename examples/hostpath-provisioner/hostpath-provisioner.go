@@ -137,7 +137,11 @@ func main() {
 
 	// Start the provision controller which will dynamically provision hostPath
 	// PVs
-	pc := controller.NewProvisionController(logger, clientset, provisionerName, hostPathProvisioner)
+	pc, err := controller.NewProvisionControllerOrError(logger, clientset, provisionerName, hostPathProvisioner)
+	if err != nil {
+		logger.Error(err, "Failed to create provision controller")
+		klog.FlushAndExit(klog.ExitFlushTimeout, 1)
+	}
 
 	// Never stops.
 	pc.Run(context.Background())
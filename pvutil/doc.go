@@ -0,0 +1,21 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package pvutil contains helpers for provisioners that construct
+// PersistentVolumes with in-tree volume sources, e.g. NFS, local or iSCSI
+// volumes, so that invalid sources are rejected by Provision instead of API
+// server.
+package pvutil // import "sigs.k8s.io/sig-storage-lib-external-provisioner/v10/pvutil"
@@ -0,0 +1,98 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pvutil
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"path"
+	"strings"
+	"unicode"
+
+	v1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/sig-storage-lib-external-provisioner/v10/topology"
+)
+
+// MakeNFSSource returns the source of an NFS volume exported by server at
+// exportPath. It returns an error when server is empty or has whitespace or
+// when exportPath is not absolute.
+func MakeNFSSource(server, exportPath string, readOnly bool) (v1.PersistentVolumeSource, error) {
+	if server == "" || strings.ContainsFunc(server, unicode.IsSpace) {
+		return v1.PersistentVolumeSource{}, fmt.Errorf("invalid NFS server %q: must not be empty or contain whitespace", server)
+	}
+	if !path.IsAbs(exportPath) {
+		return v1.PersistentVolumeSource{}, fmt.Errorf("invalid NFS path %q: must be absolute", exportPath)
+	}
+	return v1.PersistentVolumeSource{
+		NFS: &v1.NFSVolumeSource{
+			Server:   server,
+			Path:     exportPath,
+			ReadOnly: readOnly,
+		},
+	}, nil
+}
+
+// MakeLocalSource returns the source of a local volume at localPath on the
+// node with the given name, with node affinity that restricts the volume to
+// the node by its kubernetes.io/hostname label. API server rejects local
+// volumes without node affinity. It returns an error when localPath is not
+// absolute or node is empty.
+func MakeLocalSource(localPath, node string) (v1.PersistentVolumeSource, *v1.VolumeNodeAffinity, error) {
+	if !path.IsAbs(localPath) {
+		return v1.PersistentVolumeSource{}, nil, fmt.Errorf("invalid local path %q: must be absolute", localPath)
+	}
+	if node == "" {
+		return v1.PersistentVolumeSource{}, nil, errors.New("invalid node of local volume: must not be empty")
+	}
+	affinity, err := topology.MakeNodeAffinity(map[string][]string{v1.LabelHostname: {node}})
+	if err != nil {
+		return v1.PersistentVolumeSource{}, nil, err
+	}
+	return v1.PersistentVolumeSource{
+		Local: &v1.LocalVolumeSource{Path: localPath},
+	}, affinity, nil
+}
+
+// MakeISCSISource returns the source of the iSCSI volume with the given LUN
+// of target iqn at targetPortal, "host" or "host:port". fsType may be empty
+// for the default file system. It returns an error when targetPortal is
+// empty or has whitespace, iqn is not an iqn., eui. or naa. name or lun is
+// not in 0-255, like API server does.
+func MakeISCSISource(targetPortal, iqn string, lun int32, fsType string, readOnly bool) (v1.PersistentVolumeSource, error) {
+	if targetPortal == "" || strings.ContainsFunc(targetPortal, unicode.IsSpace) {
+		return v1.PersistentVolumeSource{}, fmt.Errorf("invalid iSCSI target portal %q: must not be empty or contain whitespace", targetPortal)
+	}
+	if host, _, err := net.SplitHostPort(targetPortal); err == nil && host == "" {
+		return v1.PersistentVolumeSource{}, fmt.Errorf("invalid iSCSI target portal %q: must have a host", targetPortal)
+	}
+	if !strings.HasPrefix(iqn, "iqn.") && !strings.HasPrefix(iqn, "eui.") && !strings.HasPrefix(iqn, "naa.") {
+		return v1.PersistentVolumeSource{}, fmt.Errorf("invalid iSCSI qualified name %q: must start with iqn., eui. or naa.", iqn)
+	}
+	if lun < 0 || lun > 255 {
+		return v1.PersistentVolumeSource{}, fmt.Errorf("invalid iSCSI LUN %d: must be between 0 and 255", lun)
+	}
+	return v1.PersistentVolumeSource{
+		ISCSI: &v1.ISCSIPersistentVolumeSource{
+			TargetPortal: targetPortal,
+			IQN:          iqn,
+			Lun:          lun,
+			FSType:       fsType,
+			ReadOnly:     readOnly,
+		},
+	}, nil
+}
@@ -0,0 +1,193 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pvutil
+
+import (
+	"reflect"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+func TestMakeNFSSource(t *testing.T) {
+	tests := []struct {
+		name          string
+		server        string
+		path          string
+		expectedError bool
+	}{
+		{
+			name:   "valid",
+			server: "nfs.example.com",
+			path:   "/exports/vol-1",
+		},
+		{
+			name:          "empty server",
+			path:          "/exports/vol-1",
+			expectedError: true,
+		},
+		{
+			name:          "server with whitespace",
+			server:        "nfs.example.com ",
+			path:          "/exports/vol-1",
+			expectedError: true,
+		},
+		{
+			name:          "relative path",
+			server:        "nfs.example.com",
+			path:          "exports/vol-1",
+			expectedError: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			source, err := MakeNFSSource(test.server, test.path, true)
+			if test.expectedError {
+				if err == nil {
+					t.Errorf("expected error, got source %+v", source)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			expected := &v1.NFSVolumeSource{Server: test.server, Path: test.path, ReadOnly: true}
+			if !reflect.DeepEqual(source.NFS, expected) {
+				t.Errorf("expected NFS source %+v, got %+v", expected, source.NFS)
+			}
+		})
+	}
+}
+
+func TestMakeLocalSource(t *testing.T) {
+	tests := []struct {
+		name          string
+		path          string
+		node          string
+		expectedError bool
+	}{
+		{
+			name: "valid",
+			path: "/mnt/disks/vol-1",
+			node: "node-1",
+		},
+		{
+			name:          "relative path",
+			path:          "mnt/disks/vol-1",
+			node:          "node-1",
+			expectedError: true,
+		},
+		{
+			name:          "empty node",
+			path:          "/mnt/disks/vol-1",
+			expectedError: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			source, affinity, err := MakeLocalSource(test.path, test.node)
+			if test.expectedError {
+				if err == nil {
+					t.Errorf("expected error, got source %+v", source)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if source.Local == nil || source.Local.Path != test.path {
+				t.Errorf("expected local source with path %s, got %+v", test.path, source.Local)
+			}
+			expected := []v1.NodeSelectorRequirement{{Key: v1.LabelHostname, Operator: v1.NodeSelectorOpIn, Values: []string{test.node}}}
+			if affinity == nil || affinity.Required == nil || len(affinity.Required.NodeSelectorTerms) != 1 ||
+				!reflect.DeepEqual(affinity.Required.NodeSelectorTerms[0].MatchExpressions, expected) {
+				t.Errorf("expected affinity to node %s, got %+v", test.node, affinity)
+			}
+		})
+	}
+}
+
+func TestMakeISCSISource(t *testing.T) {
+	tests := []struct {
+		name          string
+		targetPortal  string
+		iqn           string
+		lun           int32
+		expectedError bool
+	}{
+		{
+			name:         "valid",
+			targetPortal: "10.0.0.1:3260",
+			iqn:          "iqn.2024-01.com.example:storage.vol-1",
+			lun:          1,
+		},
+		{
+			name:         "portal without port",
+			targetPortal: "10.0.0.1",
+			iqn:          "naa.600a0980383030",
+		},
+		{
+			name:          "empty portal",
+			iqn:           "iqn.2024-01.com.example:storage.vol-1",
+			expectedError: true,
+		},
+		{
+			name:          "portal without host",
+			targetPortal:  ":3260",
+			iqn:           "iqn.2024-01.com.example:storage.vol-1",
+			expectedError: true,
+		},
+		{
+			name:          "invalid IQN",
+			targetPortal:  "10.0.0.1:3260",
+			iqn:           "vol-1",
+			expectedError: true,
+		},
+		{
+			name:          "negative LUN",
+			targetPortal:  "10.0.0.1:3260",
+			iqn:           "iqn.2024-01.com.example:storage.vol-1",
+			lun:           -1,
+			expectedError: true,
+		},
+		{
+			name:          "LUN too large",
+			targetPortal:  "10.0.0.1:3260",
+			iqn:           "iqn.2024-01.com.example:storage.vol-1",
+			lun:           256,
+			expectedError: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			source, err := MakeISCSISource(test.targetPortal, test.iqn, test.lun, "ext4", false)
+			if test.expectedError {
+				if err == nil {
+					t.Errorf("expected error, got source %+v", source)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			expected := &v1.ISCSIPersistentVolumeSource{TargetPortal: test.targetPortal, IQN: test.iqn, Lun: test.lun, FSType: "ext4"}
+			if !reflect.DeepEqual(source.ISCSI, expected) {
+				t.Errorf("expected iSCSI source %+v, got %+v", expected, source.ISCSI)
+			}
+		})
+	}
+}
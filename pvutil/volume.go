@@ -0,0 +1,86 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pvutil
+
+import (
+	"slices"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/sig-storage-lib-external-provisioner/v10/util"
+)
+
+// VolumeOption sets optional fields of the PV made by MakePersistentVolume.
+type VolumeOption func(*v1.PersistentVolume)
+
+// WithReclaimPolicy sets the reclaim policy of the PV, usually the one of the
+// StorageClass. The default is Delete, like for StorageClasses without one.
+func WithReclaimPolicy(policy v1.PersistentVolumeReclaimPolicy) VolumeOption {
+	return func(volume *v1.PersistentVolume) {
+		volume.Spec.PersistentVolumeReclaimPolicy = policy
+	}
+}
+
+// WithNodeAffinity sets the node affinity of the PV, e.g. the one returned by
+// MakeLocalSource.
+func WithNodeAffinity(affinity *v1.VolumeNodeAffinity) VolumeOption {
+	return func(volume *v1.PersistentVolume) {
+		volume.Spec.NodeAffinity = affinity
+	}
+}
+
+// WithMountOptions sets the mount options of the PV, usually the ones of the
+// StorageClass.
+func WithMountOptions(options ...string) VolumeOption {
+	return func(volume *v1.PersistentVolume) {
+		volume.Spec.MountOptions = slices.Clone(options)
+	}
+}
+
+// MakePersistentVolume returns a PV with the given name, capacity and source
+// for claim, e.g. for Provision with ProvisionOptions.PVName and
+// ProvisionOptions.PVC. It gets a claimRef to the claim and the access modes,
+// volume mode and StorageClass of the claim, so that it binds to the claim.
+func MakePersistentVolume(name string, claim *v1.PersistentVolumeClaim, capacity resource.Quantity, source v1.PersistentVolumeSource, opts ...VolumeOption) *v1.PersistentVolume {
+	volume := &v1.PersistentVolume{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: name,
+		},
+		Spec: v1.PersistentVolumeSpec{
+			Capacity: v1.ResourceList{
+				v1.ResourceStorage: capacity,
+			},
+			PersistentVolumeSource: source,
+			AccessModes:            slices.Clone(claim.Spec.AccessModes),
+			ClaimRef: &v1.ObjectReference{
+				Kind:       "PersistentVolumeClaim",
+				APIVersion: "v1",
+				Namespace:  claim.Namespace,
+				Name:       claim.Name,
+				UID:        claim.UID,
+			},
+			PersistentVolumeReclaimPolicy: v1.PersistentVolumeReclaimDelete,
+			StorageClassName:              util.GetPersistentVolumeClaimClass(claim),
+			VolumeMode:                    claim.Spec.VolumeMode,
+		},
+	}
+	for _, opt := range opts {
+		opt(volume)
+	}
+	return volume
+}
@@ -0,0 +1,136 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pvutil
+
+import (
+	"reflect"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/sig-storage-lib-external-provisioner/v10/controller"
+)
+
+func newClaim() *v1.PersistentVolumeClaim {
+	return &v1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "claim-1",
+			Namespace: "default",
+			UID:       "uid-1-1",
+		},
+		Spec: v1.PersistentVolumeClaimSpec{
+			AccessModes:      []v1.PersistentVolumeAccessMode{v1.ReadWriteOnce},
+			StorageClassName: ptr.To("class-1"),
+			VolumeMode:       ptr.To(v1.PersistentVolumeFilesystem),
+		},
+	}
+}
+
+func TestMakePersistentVolume(t *testing.T) {
+	nfs, err := MakeNFSSource("nfs.example.com", "/exports/vol-1", false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	local, affinity, err := MakeLocalSource("/mnt/disks/vol-1", "node-1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	iscsi, err := MakeISCSISource("10.0.0.1:3260", "iqn.2024-01.com.example:storage.vol-1", 0, "", false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	tests := []struct {
+		name   string
+		source v1.PersistentVolumeSource
+		opts   []VolumeOption
+	}{
+		{
+			name:   "NFS",
+			source: nfs,
+			opts:   []VolumeOption{WithMountOptions("nfsvers=4.1")},
+		},
+		{
+			name:   "local",
+			source: local,
+			opts:   []VolumeOption{WithNodeAffinity(affinity), WithReclaimPolicy(v1.PersistentVolumeReclaimRetain)},
+		},
+		{
+			name:   "iSCSI",
+			source: iscsi,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			claim := newClaim()
+			volume := MakePersistentVolume("pvc-uid-1-1", claim, resource.MustParse("1Gi"), test.source, test.opts...)
+			if err := controller.ValidateProvisionedVolume(volume, claim); err != nil {
+				t.Errorf("expected valid volume, got %v", err)
+			}
+			if volume.Spec.ClaimRef == nil || volume.Spec.ClaimRef.UID != claim.UID {
+				t.Errorf("expected claimRef to the claim, got %+v", volume.Spec.ClaimRef)
+			}
+			if !reflect.DeepEqual(volume.Spec.AccessModes, claim.Spec.AccessModes) {
+				t.Errorf("expected access modes %v, got %v", claim.Spec.AccessModes, volume.Spec.AccessModes)
+			}
+			if volume.Spec.StorageClassName != "class-1" {
+				t.Errorf("expected StorageClass class-1, got %q", volume.Spec.StorageClassName)
+			}
+		})
+	}
+}
+
+func TestMakePersistentVolumeOptions(t *testing.T) {
+	claim := newClaim()
+	_, affinity, err := MakeLocalSource("/mnt/disks/vol-1", "node-1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	volume := MakePersistentVolume("pvc-uid-1-1", claim, resource.MustParse("1Gi"), v1.PersistentVolumeSource{})
+	if volume.Spec.PersistentVolumeReclaimPolicy != v1.PersistentVolumeReclaimDelete {
+		t.Errorf("expected default reclaim policy Delete, got %s", volume.Spec.PersistentVolumeReclaimPolicy)
+	}
+
+	mountOptions := []string{"ro"}
+	volume = MakePersistentVolume("pvc-uid-1-1", claim, resource.MustParse("1Gi"), v1.PersistentVolumeSource{},
+		WithReclaimPolicy(v1.PersistentVolumeReclaimRetain), WithNodeAffinity(affinity), WithMountOptions(mountOptions...))
+	if volume.Spec.PersistentVolumeReclaimPolicy != v1.PersistentVolumeReclaimRetain {
+		t.Errorf("expected reclaim policy Retain, got %s", volume.Spec.PersistentVolumeReclaimPolicy)
+	}
+	if volume.Spec.NodeAffinity != affinity {
+		t.Errorf("expected node affinity %+v, got %+v", affinity, volume.Spec.NodeAffinity)
+	}
+	mountOptions[0] = "rw"
+	if !reflect.DeepEqual(volume.Spec.MountOptions, []string{"ro"}) {
+		t.Errorf("expected mount options [ro], got %v", volume.Spec.MountOptions)
+	}
+
+	// The PV must not share the access modes of the claim.
+	claim.Spec.AccessModes[0] = v1.ReadOnlyMany
+	if volume.Spec.AccessModes[0] != v1.ReadWriteOnce {
+		t.Errorf("expected access modes copied from the claim, got %v", volume.Spec.AccessModes)
+	}
+}
+
+func TestMakePersistentVolumeInvalid(t *testing.T) {
+	claim := newClaim()
+	volume := MakePersistentVolume("pvc-uid-1-1", claim, resource.MustParse("0"), v1.PersistentVolumeSource{})
+	if err := controller.ValidateProvisionedVolume(volume, claim); err == nil {
+		t.Errorf("expected invalid volume without capacity and source")
+	}
+}
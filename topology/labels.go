@@ -0,0 +1,86 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package topology
+
+import (
+	v1 "k8s.io/api/core/v1"
+)
+
+// betaKeys maps the GA zone and region label keys to the deprecated beta
+// keys that are still set on nodes of some clusters.
+var betaKeys = map[string]string{
+	v1.LabelTopologyZone:   v1.LabelFailureDomainBetaZone,
+	v1.LabelTopologyRegion: v1.LabelFailureDomainBetaRegion,
+}
+
+// gaKeys maps the beta zone and region label keys to the GA ones.
+var gaKeys = map[string]string{
+	v1.LabelFailureDomainBetaZone:   v1.LabelTopologyZone,
+	v1.LabelFailureDomainBetaRegion: v1.LabelTopologyRegion,
+}
+
+// GetNodeZone returns the zone of node from its topology.kubernetes.io/zone
+// label, or from the deprecated failure-domain.beta.kubernetes.io/zone label
+// if the node does not have the first one.
+func GetNodeZone(node *v1.Node) (string, bool) {
+	_, value, found := nodeLabel(node, v1.LabelTopologyZone)
+	return value, found
+}
+
+// GetNodeRegion returns the region of node from its
+// topology.kubernetes.io/region label, or from the deprecated
+// failure-domain.beta.kubernetes.io/region label if the node does not have
+// the first one.
+func GetNodeRegion(node *v1.Node) (string, bool) {
+	_, value, found := nodeLabel(node, v1.LabelTopologyRegion)
+	return value, found
+}
+
+// SelectedNodeTopology returns the values of the given topology labels of
+// node, keyed by the given keys. Zone and region are looked up like in
+// GetNodeZone and GetNodeRegion, no matter if the GA or beta key is given.
+// Keys the node has no label of are left out.
+func SelectedNodeTopology(node *v1.Node, keys []string) map[string]string {
+	topology := make(map[string]string, len(keys))
+	for _, key := range keys {
+		if _, value, found := nodeLabel(node, key); found {
+			topology[key] = value
+		}
+	}
+	return topology
+}
+
+// nodeLabel returns the key and value of the label of node for the given
+// topology key. For zone and region, the GA label wins over the beta one,
+// which is used only when the node does not have the GA label.
+func nodeLabel(node *v1.Node, key string) (string, string, bool) {
+	if node == nil {
+		return "", "", false
+	}
+	if ga, found := gaKeys[key]; found {
+		key = ga
+	}
+	if value, found := node.Labels[key]; found {
+		return key, value, true
+	}
+	if beta, found := betaKeys[key]; found {
+		if value, found := node.Labels[beta]; found {
+			return beta, value, true
+		}
+	}
+	return "", "", false
+}
@@ -0,0 +1,134 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package topology
+
+import (
+	"reflect"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+func TestGetNodeZoneAndRegion(t *testing.T) {
+	tests := []struct {
+		name           string
+		node           *v1.Node
+		expectedZone   string
+		expectedRegion string
+		expectedFound  bool
+	}{
+		{
+			name: "nil node",
+		},
+		{
+			name: "no labels",
+			node: newNode("node-1", nil),
+		},
+		{
+			name: "only legacy labels",
+			node: newNode("node-1", map[string]string{
+				v1.LabelFailureDomainBetaZone:   "zone-beta",
+				v1.LabelFailureDomainBetaRegion: "region-beta",
+			}),
+			expectedZone:   "zone-beta",
+			expectedRegion: "region-beta",
+			expectedFound:  true,
+		},
+		{
+			name: "only GA labels",
+			node: newNode("node-1", map[string]string{
+				v1.LabelTopologyZone:   "zone-ga",
+				v1.LabelTopologyRegion: "region-ga",
+			}),
+			expectedZone:   "zone-ga",
+			expectedRegion: "region-ga",
+			expectedFound:  true,
+		},
+		{
+			name: "conflicting labels",
+			node: newNode("node-1", map[string]string{
+				v1.LabelFailureDomainBetaZone:   "zone-beta",
+				v1.LabelFailureDomainBetaRegion: "region-beta",
+				v1.LabelTopologyZone:            "zone-ga",
+				v1.LabelTopologyRegion:          "region-ga",
+			}),
+			expectedZone:   "zone-ga",
+			expectedRegion: "region-ga",
+			expectedFound:  true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			zone, found := GetNodeZone(test.node)
+			if zone != test.expectedZone || found != test.expectedFound {
+				t.Errorf("expected zone %q, %v, got %q, %v", test.expectedZone, test.expectedFound, zone, found)
+			}
+			region, found := GetNodeRegion(test.node)
+			if region != test.expectedRegion || found != test.expectedFound {
+				t.Errorf("expected region %q, %v, got %q, %v", test.expectedRegion, test.expectedFound, region, found)
+			}
+		})
+	}
+}
+
+func TestSelectedNodeTopology(t *testing.T) {
+	legacy := newNode("node-1", map[string]string{v1.LabelFailureDomainBetaZone: "zone-beta", "rack": "1"})
+	ga := newNode("node-1", map[string]string{v1.LabelTopologyZone: "zone-ga", "rack": "1"})
+	both := newNode("node-1", map[string]string{v1.LabelFailureDomainBetaZone: "zone-beta", v1.LabelTopologyZone: "zone-ga"})
+	tests := []struct {
+		name     string
+		node     *v1.Node
+		keys     []string
+		expected map[string]string
+	}{
+		{
+			name:     "nil node",
+			keys:     []string{v1.LabelTopologyZone},
+			expected: map[string]string{},
+		},
+		{
+			name:     "no keys",
+			node:     ga,
+			expected: map[string]string{},
+		},
+		{
+			name:     "only legacy labels, GA key",
+			node:     legacy,
+			keys:     []string{v1.LabelTopologyZone, "rack", "missing"},
+			expected: map[string]string{v1.LabelTopologyZone: "zone-beta", "rack": "1"},
+		},
+		{
+			name:     "only GA labels, beta key",
+			node:     ga,
+			keys:     []string{v1.LabelFailureDomainBetaZone},
+			expected: map[string]string{v1.LabelFailureDomainBetaZone: "zone-ga"},
+		},
+		{
+			name:     "conflicting labels",
+			node:     both,
+			keys:     []string{v1.LabelTopologyZone, v1.LabelFailureDomainBetaZone},
+			expected: map[string]string{v1.LabelTopologyZone: "zone-ga", v1.LabelFailureDomainBetaZone: "zone-ga"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if actual := SelectedNodeTopology(test.node, test.keys); !reflect.DeepEqual(actual, test.expected) {
+				t.Errorf("expected %v, got %v", test.expected, actual)
+			}
+		})
+	}
+}
@@ -0,0 +1,201 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package topology
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/selection"
+)
+
+// MakeNodeAffinity returns node affinity of a PersistentVolume usable only on
+// nodes whose label of each key has one of its values. It has a single node
+// selector term with a matchExpression per key, sorted by key. It returns an
+// error for empty requirements and for keys without values: the first would
+// make the volume usable on any node, the second on none.
+func MakeNodeAffinity(requirements map[string][]string) (*v1.VolumeNodeAffinity, error) {
+	if len(requirements) == 0 {
+		return nil, errors.New("no topology requirements")
+	}
+	keys := make([]string, 0, len(requirements))
+	for key := range requirements {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	term := v1.NodeSelectorTerm{}
+	for _, key := range keys {
+		if key == "" {
+			return nil, errors.New("empty topology key")
+		}
+		values := requirements[key]
+		if len(values) == 0 {
+			return nil, fmt.Errorf("no values of topology key %q", key)
+		}
+		term.MatchExpressions = append(term.MatchExpressions, v1.NodeSelectorRequirement{
+			Key:      key,
+			Operator: v1.NodeSelectorOpIn,
+			Values:   append([]string(nil), values...),
+		})
+	}
+	return &v1.VolumeNodeAffinity{
+		Required: &v1.NodeSelector{NodeSelectorTerms: []v1.NodeSelectorTerm{term}},
+	}, nil
+}
+
+// MakeNodeAffinityForNode returns node affinity of a PersistentVolume usable
+// only on nodes with the same values of the given topology labels as node,
+// e.g. the node selected by the scheduler. Zone and region keys are matched
+// against the label the node actually has, GA or beta, see SelectedNodeTopology.
+// It returns an error when node is nil, keys is empty, or node has no label
+// of one of the keys.
+func MakeNodeAffinityForNode(node *v1.Node, keys []string) (*v1.VolumeNodeAffinity, error) {
+	if node == nil {
+		return nil, errors.New("no node")
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("no topology keys")
+	}
+	requirements := make(map[string][]string, len(keys))
+	for _, key := range keys {
+		label, value, found := nodeLabel(node, key)
+		if !found {
+			return nil, fmt.Errorf("node %q has no label %q", node.Name, key)
+		}
+		requirements[label] = []string{value}
+	}
+	return MakeNodeAffinity(requirements)
+}
+
+// NodeMatchesAffinity returns true when a PersistentVolume with the given
+// node affinity can be used on node, i.e. node matches at least one of its
+// node selector terms. A volume without affinity can be used on any node.
+// Like the scheduler, an empty term or invalid requirement matches no node.
+func NodeMatchesAffinity(node *v1.Node, affinity *v1.VolumeNodeAffinity) bool {
+	if affinity == nil || affinity.Required == nil {
+		return true
+	}
+	if node == nil {
+		return false
+	}
+	for _, term := range affinity.Required.NodeSelectorTerms {
+		if nodeMatchesTerm(node, term) {
+			return true
+		}
+	}
+	return false
+}
+
+// AffinityValues returns the values of key that the given node affinity of a
+// PersistentVolume allows, i.e. values of its In requirements of key, in the
+// order of their first appearance. The GA and beta zone and region keys are
+// treated as the same key. It returns nil for a volume without affinity or
+// without a requirement of key.
+func AffinityValues(affinity *v1.VolumeNodeAffinity, key string) []string {
+	if affinity == nil || affinity.Required == nil {
+		return nil
+	}
+	if ga, found := gaKeys[key]; found {
+		key = ga
+	}
+	var values []string
+	for _, term := range affinity.Required.NodeSelectorTerms {
+		for _, requirement := range term.MatchExpressions {
+			requirementKey := requirement.Key
+			if ga, found := gaKeys[requirementKey]; found {
+				requirementKey = ga
+			}
+			if requirementKey != key || requirement.Operator != v1.NodeSelectorOpIn {
+				continue
+			}
+			for _, value := range requirement.Values {
+				if !slices.Contains(values, value) {
+					values = append(values, value)
+				}
+			}
+		}
+	}
+	return values
+}
+
+func nodeMatchesTerm(node *v1.Node, term v1.NodeSelectorTerm) bool {
+	if len(term.MatchExpressions) == 0 && len(term.MatchFields) == 0 {
+		return false
+	}
+	if len(term.MatchExpressions) > 0 {
+		selector, err := nodeSelector(term.MatchExpressions)
+		if err != nil || !selector.Matches(labels.Set(node.Labels)) {
+			return false
+		}
+	}
+	for _, field := range term.MatchFields {
+		// metadata.name is the only supported field. Node names may be
+		// longer than label values, they are not matched by a selector.
+		if field.Key != "metadata.name" {
+			return false
+		}
+		found := slices.Contains(field.Values, node.Name)
+		switch field.Operator {
+		case v1.NodeSelectorOpIn:
+			if !found {
+				return false
+			}
+		case v1.NodeSelectorOpNotIn:
+			if found {
+				return false
+			}
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// nodeSelector converts node selector requirements to a label selector.
+func nodeSelector(requirements []v1.NodeSelectorRequirement) (labels.Selector, error) {
+	selector := labels.NewSelector()
+	for _, requirement := range requirements {
+		var op selection.Operator
+		switch requirement.Operator {
+		case v1.NodeSelectorOpIn:
+			op = selection.In
+		case v1.NodeSelectorOpNotIn:
+			op = selection.NotIn
+		case v1.NodeSelectorOpExists:
+			op = selection.Exists
+		case v1.NodeSelectorOpDoesNotExist:
+			op = selection.DoesNotExist
+		case v1.NodeSelectorOpGt:
+			op = selection.GreaterThan
+		case v1.NodeSelectorOpLt:
+			op = selection.LessThan
+		default:
+			return nil, fmt.Errorf("invalid node selector operator %q", requirement.Operator)
+		}
+		r, err := labels.NewRequirement(requirement.Key, op, requirement.Values)
+		if err != nil {
+			return nil, err
+		}
+		selector = selector.Add(*r)
+	}
+	return selector, nil
+}
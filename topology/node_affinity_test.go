@@ -0,0 +1,360 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package topology
+
+import (
+	"reflect"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestMakeNodeAffinity(t *testing.T) {
+	tests := []struct {
+		name          string
+		requirements  map[string][]string
+		expected      []v1.NodeSelectorRequirement
+		expectedError bool
+	}{
+		{
+			name:          "nil requirements",
+			expectedError: true,
+		},
+		{
+			name:          "empty requirements",
+			requirements:  map[string][]string{},
+			expectedError: true,
+		},
+		{
+			name:          "key without values",
+			requirements:  map[string][]string{"zone": {"a"}, "rack": nil},
+			expectedError: true,
+		},
+		{
+			name:          "empty key",
+			requirements:  map[string][]string{"": {"a"}},
+			expectedError: true,
+		},
+		{
+			name:         "single key and value",
+			requirements: map[string][]string{"zone": {"a"}},
+			expected: []v1.NodeSelectorRequirement{
+				{Key: "zone", Operator: v1.NodeSelectorOpIn, Values: []string{"a"}},
+			},
+		},
+		{
+			name:         "multiple keys and values",
+			requirements: map[string][]string{"zone": {"a", "b"}, "rack": {"1"}, "region": {"x", "y", "z"}},
+			expected: []v1.NodeSelectorRequirement{
+				{Key: "rack", Operator: v1.NodeSelectorOpIn, Values: []string{"1"}},
+				{Key: "region", Operator: v1.NodeSelectorOpIn, Values: []string{"x", "y", "z"}},
+				{Key: "zone", Operator: v1.NodeSelectorOpIn, Values: []string{"a", "b"}},
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			affinity, err := MakeNodeAffinity(test.requirements)
+			if test.expectedError {
+				if err == nil {
+					t.Errorf("expected error, got %+v", affinity)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if terms := affinity.Required.NodeSelectorTerms; len(terms) != 1 {
+				t.Fatalf("expected 1 node selector term, got %+v", terms)
+			}
+			if actual := affinity.Required.NodeSelectorTerms[0].MatchExpressions; !reflect.DeepEqual(actual, test.expected) {
+				t.Errorf("expected match expressions %+v, got %+v", test.expected, actual)
+			}
+		})
+	}
+}
+
+func TestMakeNodeAffinityCopiesValues(t *testing.T) {
+	values := []string{"a"}
+	affinity, err := MakeNodeAffinity(map[string][]string{"zone": values})
+	if err != nil {
+		t.Fatal(err)
+	}
+	values[0] = "b"
+	if actual := affinity.Required.NodeSelectorTerms[0].MatchExpressions[0].Values; !reflect.DeepEqual(actual, []string{"a"}) {
+		t.Errorf("expected values [a], got %v", actual)
+	}
+}
+
+func TestMakeNodeAffinityForNode(t *testing.T) {
+	node := newNode("node-1", map[string]string{"zone": "a", "rack": "1", "other": "x"})
+	tests := []struct {
+		name          string
+		node          *v1.Node
+		keys          []string
+		expected      []v1.NodeSelectorRequirement
+		expectedError bool
+	}{
+		{
+			name:          "nil node",
+			keys:          []string{"zone"},
+			expectedError: true,
+		},
+		{
+			name:          "no keys",
+			node:          node,
+			expectedError: true,
+		},
+		{
+			name:          "missing label",
+			node:          node,
+			keys:          []string{"zone", "region"},
+			expectedError: true,
+		},
+		{
+			name: "legacy zone label",
+			node: newNode("node-2", map[string]string{v1.LabelFailureDomainBetaZone: "a"}),
+			keys: []string{v1.LabelTopologyZone},
+			expected: []v1.NodeSelectorRequirement{
+				{Key: v1.LabelFailureDomainBetaZone, Operator: v1.NodeSelectorOpIn, Values: []string{"a"}},
+			},
+		},
+		{
+			name: "GA zone label wins",
+			node: newNode("node-2", map[string]string{v1.LabelFailureDomainBetaZone: "a", v1.LabelTopologyZone: "b"}),
+			keys: []string{v1.LabelFailureDomainBetaZone},
+			expected: []v1.NodeSelectorRequirement{
+				{Key: v1.LabelTopologyZone, Operator: v1.NodeSelectorOpIn, Values: []string{"b"}},
+			},
+		},
+		{
+			name: "copies only given keys",
+			node: node,
+			keys: []string{"zone", "rack"},
+			expected: []v1.NodeSelectorRequirement{
+				{Key: "rack", Operator: v1.NodeSelectorOpIn, Values: []string{"1"}},
+				{Key: "zone", Operator: v1.NodeSelectorOpIn, Values: []string{"a"}},
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			affinity, err := MakeNodeAffinityForNode(test.node, test.keys)
+			if test.expectedError {
+				if err == nil {
+					t.Errorf("expected error, got %+v", affinity)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if actual := affinity.Required.NodeSelectorTerms[0].MatchExpressions; !reflect.DeepEqual(actual, test.expected) {
+				t.Errorf("expected match expressions %+v, got %+v", test.expected, actual)
+			}
+			if !NodeMatchesAffinity(test.node, affinity) {
+				t.Errorf("expected the node to match its own affinity")
+			}
+		})
+	}
+}
+
+func TestAffinityValues(t *testing.T) {
+	tests := []struct {
+		name     string
+		affinity *v1.VolumeNodeAffinity
+		key      string
+		expected []string
+	}{
+		{
+			name: "nil affinity",
+			key:  "zone",
+		},
+		{
+			name:     "nil required",
+			affinity: &v1.VolumeNodeAffinity{},
+			key:      "zone",
+		},
+		{
+			name: "single term",
+			affinity: &v1.VolumeNodeAffinity{Required: &v1.NodeSelector{NodeSelectorTerms: []v1.NodeSelectorTerm{
+				{MatchExpressions: []v1.NodeSelectorRequirement{
+					{Key: "rack", Operator: v1.NodeSelectorOpIn, Values: []string{"1"}},
+					{Key: "zone", Operator: v1.NodeSelectorOpIn, Values: []string{"b", "a"}},
+				}},
+			}}},
+			key:      "zone",
+			expected: []string{"b", "a"},
+		},
+		{
+			name: "several terms",
+			affinity: &v1.VolumeNodeAffinity{Required: &v1.NodeSelector{NodeSelectorTerms: []v1.NodeSelectorTerm{
+				{MatchExpressions: []v1.NodeSelectorRequirement{{Key: "zone", Operator: v1.NodeSelectorOpIn, Values: []string{"a"}}}},
+				{MatchExpressions: []v1.NodeSelectorRequirement{{Key: "zone", Operator: v1.NodeSelectorOpIn, Values: []string{"a", "c"}}}},
+			}}},
+			key:      "zone",
+			expected: []string{"a", "c"},
+		},
+		{
+			name: "other operators",
+			affinity: &v1.VolumeNodeAffinity{Required: &v1.NodeSelector{NodeSelectorTerms: []v1.NodeSelectorTerm{
+				{MatchExpressions: []v1.NodeSelectorRequirement{
+					{Key: "zone", Operator: v1.NodeSelectorOpNotIn, Values: []string{"a"}},
+					{Key: "zone", Operator: v1.NodeSelectorOpExists},
+				}},
+			}}},
+			key: "zone",
+		},
+		{
+			name: "missing key",
+			affinity: &v1.VolumeNodeAffinity{Required: &v1.NodeSelector{NodeSelectorTerms: []v1.NodeSelectorTerm{
+				{MatchFields: []v1.NodeSelectorRequirement{{Key: "metadata.name", Operator: v1.NodeSelectorOpIn, Values: []string{"node-1"}}}},
+			}}},
+			key: "zone",
+		},
+		{
+			name: "beta zone key",
+			affinity: &v1.VolumeNodeAffinity{Required: &v1.NodeSelector{NodeSelectorTerms: []v1.NodeSelectorTerm{
+				{MatchExpressions: []v1.NodeSelectorRequirement{{Key: v1.LabelFailureDomainBetaZone, Operator: v1.NodeSelectorOpIn, Values: []string{"a"}}}},
+				{MatchExpressions: []v1.NodeSelectorRequirement{{Key: v1.LabelTopologyZone, Operator: v1.NodeSelectorOpIn, Values: []string{"b"}}}},
+			}}},
+			key:      v1.LabelTopologyZone,
+			expected: []string{"a", "b"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if values := AffinityValues(test.affinity, test.key); !reflect.DeepEqual(values, test.expected) {
+				t.Errorf("expected %v, got %v", test.expected, values)
+			}
+		})
+	}
+}
+
+func TestNodeMatchesAffinity(t *testing.T) {
+	affinity, err := MakeNodeAffinity(map[string][]string{"zone": {"a", "b"}, "rack": {"1"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	twoTerms := &v1.VolumeNodeAffinity{Required: &v1.NodeSelector{NodeSelectorTerms: []v1.NodeSelectorTerm{
+		{MatchExpressions: []v1.NodeSelectorRequirement{{Key: "zone", Operator: v1.NodeSelectorOpIn, Values: []string{"a"}}}},
+		{MatchFields: []v1.NodeSelectorRequirement{{Key: "metadata.name", Operator: v1.NodeSelectorOpIn, Values: []string{"node-2"}}}},
+	}}}
+	operators := &v1.VolumeNodeAffinity{Required: &v1.NodeSelector{NodeSelectorTerms: []v1.NodeSelectorTerm{
+		{MatchExpressions: []v1.NodeSelectorRequirement{
+			{Key: "zone", Operator: v1.NodeSelectorOpNotIn, Values: []string{"c"}},
+			{Key: "ssd", Operator: v1.NodeSelectorOpExists},
+			{Key: "tainted", Operator: v1.NodeSelectorOpDoesNotExist},
+			{Key: "cpus", Operator: v1.NodeSelectorOpGt, Values: []string{"4"}},
+		}},
+	}}}
+	tests := []struct {
+		name     string
+		node     *v1.Node
+		affinity *v1.VolumeNodeAffinity
+		expected bool
+	}{
+		{
+			name:     "nil affinity",
+			node:     newNode("node-1", nil),
+			expected: true,
+		},
+		{
+			name:     "nil required",
+			node:     newNode("node-1", nil),
+			affinity: &v1.VolumeNodeAffinity{},
+			expected: true,
+		},
+		{
+			name:     "nil node",
+			affinity: affinity,
+		},
+		{
+			name:     "no terms",
+			node:     newNode("node-1", map[string]string{"zone": "a"}),
+			affinity: &v1.VolumeNodeAffinity{Required: &v1.NodeSelector{}},
+		},
+		{
+			name:     "empty term",
+			node:     newNode("node-1", map[string]string{"zone": "a"}),
+			affinity: &v1.VolumeNodeAffinity{Required: &v1.NodeSelector{NodeSelectorTerms: []v1.NodeSelectorTerm{{}}}},
+		},
+		{
+			name:     "all keys match",
+			node:     newNode("node-1", map[string]string{"zone": "b", "rack": "1", "other": "x"}),
+			affinity: affinity,
+			expected: true,
+		},
+		{
+			name:     "value mismatch",
+			node:     newNode("node-1", map[string]string{"zone": "c", "rack": "1"}),
+			affinity: affinity,
+		},
+		{
+			name:     "missing label",
+			node:     newNode("node-1", map[string]string{"zone": "a"}),
+			affinity: affinity,
+		},
+		{
+			name:     "first term matches",
+			node:     newNode("node-1", map[string]string{"zone": "a"}),
+			affinity: twoTerms,
+			expected: true,
+		},
+		{
+			name:     "second term matches by name",
+			node:     newNode("node-2", nil),
+			affinity: twoTerms,
+			expected: true,
+		},
+		{
+			name:     "no term matches",
+			node:     newNode("node-1", map[string]string{"zone": "b"}),
+			affinity: twoTerms,
+		},
+		{
+			name:     "other operators match",
+			node:     newNode("node-1", map[string]string{"zone": "a", "ssd": "", "cpus": "8"}),
+			affinity: operators,
+			expected: true,
+		},
+		{
+			name:     "other operators mismatch",
+			node:     newNode("node-1", map[string]string{"zone": "a", "ssd": "", "cpus": "8", "tainted": "yes"}),
+			affinity: operators,
+		},
+		{
+			name: "invalid operator",
+			node: newNode("node-1", map[string]string{"zone": "a"}),
+			affinity: &v1.VolumeNodeAffinity{Required: &v1.NodeSelector{NodeSelectorTerms: []v1.NodeSelectorTerm{
+				{MatchExpressions: []v1.NodeSelectorRequirement{{Key: "zone", Operator: "Equals", Values: []string{"a"}}}},
+			}}},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if actual := NodeMatchesAffinity(test.node, test.affinity); actual != test.expected {
+				t.Errorf("expected %v, got %v", test.expected, actual)
+			}
+		})
+	}
+}
+
+func newNode(name string, labels map[string]string) *v1.Node {
+	return &v1.Node{ObjectMeta: metav1.ObjectMeta{Name: name, Labels: labels}}
+}
@@ -0,0 +1,55 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// FSTypeParameter and LegacyFSTypeParameter are the StorageClass parameters
+// with the file system of a volume, older provisioners use the legacy
+// spelling.
+const (
+	FSTypeParameter       = "fsType"
+	LegacyFSTypeParameter = "fstype"
+)
+
+// GetFSType returns the file system requested by the fsType or fstype
+// parameter, lowercased and trimmed, or defaultFS when neither is set. Both
+// may be set only to the same file system. When allowed is not empty, the
+// file system must be one of allowed, the error then lists allowed values so
+// that it can be sent in an event of the claim.
+func GetFSType(params map[string]string, allowed []string, defaultFS string) (string, error) {
+	fsType, found := params[FSTypeParameter]
+	fsType = strings.ToLower(strings.TrimSpace(fsType))
+	if legacy, legacyFound := params[LegacyFSTypeParameter]; legacyFound {
+		legacy = strings.ToLower(strings.TrimSpace(legacy))
+		if found && legacy != fsType {
+			return "", fmt.Errorf("parameters %s %q and %s %q of StorageClass conflict", FSTypeParameter, params[FSTypeParameter], LegacyFSTypeParameter, params[LegacyFSTypeParameter])
+		}
+		fsType = legacy
+	}
+	if fsType == "" {
+		return defaultFS, nil
+	}
+	if len(allowed) > 0 && !slices.ContainsFunc(allowed, func(fs string) bool { return strings.EqualFold(fs, fsType) }) {
+		return "", fmt.Errorf("invalid %s %q: must be one of %s", FSTypeParameter, fsType, strings.Join(allowed, ", "))
+	}
+	return fsType, nil
+}
@@ -0,0 +1,104 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestGetFSType(t *testing.T) {
+	allowed := []string{"ext4", "xfs"}
+	tests := []struct {
+		name          string
+		params        map[string]string
+		allowed       []string
+		expected      string
+		expectedError string
+	}{
+		{
+			name:     "unset",
+			params:   map[string]string{"foo": "bar"},
+			allowed:  allowed,
+			expected: "ext4",
+		},
+		{
+			name:     "empty",
+			params:   map[string]string{FSTypeParameter: " "},
+			allowed:  allowed,
+			expected: "ext4",
+		},
+		{
+			name:     "fsType",
+			params:   map[string]string{FSTypeParameter: "xfs"},
+			allowed:  allowed,
+			expected: "xfs",
+		},
+		{
+			name:     "legacy fstype",
+			params:   map[string]string{LegacyFSTypeParameter: "xfs"},
+			allowed:  allowed,
+			expected: "xfs",
+		},
+		{
+			name:     "normalized",
+			params:   map[string]string{FSTypeParameter: " XFS "},
+			allowed:  allowed,
+			expected: "xfs",
+		},
+		{
+			name:     "both spellings agree",
+			params:   map[string]string{FSTypeParameter: "xfs", LegacyFSTypeParameter: "XFS"},
+			allowed:  allowed,
+			expected: "xfs",
+		},
+		{
+			name:          "both spellings conflict",
+			params:        map[string]string{FSTypeParameter: "xfs", LegacyFSTypeParameter: "ext4"},
+			allowed:       allowed,
+			expectedError: `parameters fsType "xfs" and fstype "ext4" of StorageClass conflict`,
+		},
+		{
+			name:          "not allowed",
+			params:        map[string]string{FSTypeParameter: "ntfs "},
+			allowed:       allowed,
+			expectedError: `invalid fsType "ntfs": must be one of ext4, xfs`,
+		},
+		{
+			name:     "any allowed",
+			params:   map[string]string{FSTypeParameter: "NTFS"},
+			expected: "ntfs",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fsType, err := GetFSType(test.params, test.allowed, "ext4")
+			if test.expectedError != "" {
+				if err == nil || !strings.Contains(err.Error(), test.expectedError) {
+					t.Fatalf("expected error %q, got %v", test.expectedError, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if fsType != test.expected {
+				t.Errorf("expected fsType %q, got %q", test.expected, fsType)
+			}
+		})
+	}
+}
@@ -0,0 +1,150 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/client-go/kubernetes"
+)
+
+// TemplateError is returned by ResolveSecretRef for invalid or missing
+// secret parameters of a StorageClass. It is terminal: retrying does not help
+// until the StorageClass or the claim changes, so Provision should return it
+// with ProvisioningFinished.
+type TemplateError struct {
+	// Key of the parameter.
+	Key string
+	// Reason why the parameter is invalid.
+	Reason string
+}
+
+func (e *TemplateError) Error() string {
+	return fmt.Sprintf("invalid StorageClass parameter %q: %s", e.Key, e.Reason)
+}
+
+// ResolveSecretRef returns the secret referenced by the parameters nameKey
+// and namespaceKey of a StorageClass, e.g. "provisioner-secret-name" and
+// "provisioner-secret-namespace", with templates expanded like
+// external-provisioner does:
+//   - the name may contain ${pvc.name}, ${pvc.namespace} and
+//     ${pvc.annotations['<key>']}, the value of an annotation of the claim,
+//   - the namespace may contain ${pvc.namespace}.
+//
+// It returns nil when neither parameter is set. It returns a TemplateError
+// when only one of them is set, a template is unknown, refers to a missing
+// annotation or to a nil claim, or the expanded name or namespace is not a
+// valid object name.
+func ResolveSecretRef(params map[string]string, nameKey, namespaceKey string, claim *v1.PersistentVolumeClaim) (*v1.SecretReference, error) {
+	nameTemplate, nameFound := params[nameKey]
+	namespaceTemplate, namespaceFound := params[namespaceKey]
+	switch {
+	case !nameFound && !namespaceFound:
+		return nil, nil
+	case !nameFound:
+		return nil, &TemplateError{Key: nameKey, Reason: fmt.Sprintf("must be set with %q", namespaceKey)}
+	case !namespaceFound:
+		return nil, &TemplateError{Key: namespaceKey, Reason: fmt.Sprintf("must be set with %q", nameKey)}
+	}
+
+	namespace, err := expandSecretTemplate(namespaceTemplate, claim, false)
+	if err != nil {
+		return nil, &TemplateError{Key: namespaceKey, Reason: err.Error()}
+	}
+	if msgs := validation.IsDNS1123Label(namespace); len(msgs) > 0 {
+		return nil, &TemplateError{Key: namespaceKey, Reason: fmt.Sprintf("namespace %q is invalid: %s", namespace, strings.Join(msgs, ", "))}
+	}
+	name, err := expandSecretTemplate(nameTemplate, claim, true)
+	if err != nil {
+		return nil, &TemplateError{Key: nameKey, Reason: err.Error()}
+	}
+	if msgs := validation.IsDNS1123Subdomain(name); len(msgs) > 0 {
+		return nil, &TemplateError{Key: nameKey, Reason: fmt.Sprintf("name %q is invalid: %s", name, strings.Join(msgs, ", "))}
+	}
+	return &v1.SecretReference{Name: name, Namespace: namespace}, nil
+}
+
+// expandSecretTemplate replaces the ${...} templates in s with fields of
+// claim. Only ${pvc.namespace} is allowed unless full is true.
+func expandSecretTemplate(s string, claim *v1.PersistentVolumeClaim, full bool) (string, error) {
+	var expanded strings.Builder
+	for {
+		start := strings.Index(s, "${")
+		if start < 0 {
+			expanded.WriteString(s)
+			return expanded.String(), nil
+		}
+		end := strings.Index(s[start:], "}")
+		if end < 0 {
+			return "", fmt.Errorf("unterminated template in %q", s)
+		}
+		template := s[start+2 : start+end]
+		value, err := secretTemplateValue(template, claim, full)
+		if err != nil {
+			return "", err
+		}
+		expanded.WriteString(s[:start])
+		expanded.WriteString(value)
+		s = s[start+end+1:]
+	}
+}
+
+// secretTemplateValue returns the value of the template inside ${...}.
+func secretTemplateValue(template string, claim *v1.PersistentVolumeClaim, full bool) (string, error) {
+	annotation, isAnnotation := strings.CutPrefix(template, "pvc.annotations['")
+	if isAnnotation {
+		annotation, isAnnotation = strings.CutSuffix(annotation, "']")
+	}
+	known := template == "pvc.namespace" || (full && (template == "pvc.name" || isAnnotation))
+	if !known {
+		return "", fmt.Errorf("unknown template ${%s}", template)
+	}
+	if claim == nil {
+		return "", fmt.Errorf("template ${%s} requires a claim", template)
+	}
+	switch {
+	case template == "pvc.namespace":
+		return claim.Namespace, nil
+	case template == "pvc.name":
+		return claim.Name, nil
+	}
+	value, found := claim.Annotations[annotation]
+	if !found {
+		return "", fmt.Errorf("template ${%s}: claim has no annotation %q", template, annotation)
+	}
+	return value, nil
+}
+
+// GetSecretData returns the data of the secret referenced by ref, e.g. by
+// ResolveSecretRef, or nil when ref is nil. It GETs the secret from API
+// server, the provisioner needs only the permission to get secrets, not to
+// list or watch them.
+func GetSecretData(ctx context.Context, client kubernetes.Interface, ref *v1.SecretReference) (map[string][]byte, error) {
+	if ref == nil {
+		return nil, nil
+	}
+	secret, err := client.CoreV1().Secrets(ref.Namespace).Get(ctx, ref.Name, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get secret %s/%s: %w", ref.Namespace, ref.Name, err)
+	}
+	return secret.Data, nil
+}
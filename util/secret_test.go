@@ -0,0 +1,226 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	apierrs "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+const (
+	secretNameKey      = "provisioner-secret-name"
+	secretNamespaceKey = "provisioner-secret-namespace"
+)
+
+func TestResolveSecretRef(t *testing.T) {
+	claim := &v1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "claim-1",
+			Namespace:   "team-a",
+			Annotations: map[string]string{"example.com/secret": "backend-credentials"},
+		},
+	}
+	tests := []struct {
+		name              string
+		params            map[string]string
+		claim             *v1.PersistentVolumeClaim
+		expected          *v1.SecretReference
+		expectedErrorKey  string
+		expectedErrorText string
+	}{
+		{
+			name:  "no parameters",
+			claim: claim,
+		},
+		{
+			name:   "nil parameters without claim",
+			params: nil,
+		},
+		{
+			name:     "literal",
+			params:   map[string]string{secretNameKey: "credentials", secretNamespaceKey: "kube-system"},
+			claim:    claim,
+			expected: &v1.SecretReference{Name: "credentials", Namespace: "kube-system"},
+		},
+		{
+			name:     "literal without claim",
+			params:   map[string]string{secretNameKey: "credentials", secretNamespaceKey: "kube-system"},
+			expected: &v1.SecretReference{Name: "credentials", Namespace: "kube-system"},
+		},
+		{
+			name:     "pvc.name",
+			params:   map[string]string{secretNameKey: "${pvc.name}", secretNamespaceKey: "kube-system"},
+			claim:    claim,
+			expected: &v1.SecretReference{Name: "claim-1", Namespace: "kube-system"},
+		},
+		{
+			name:     "pvc.namespace",
+			params:   map[string]string{secretNameKey: "credentials", secretNamespaceKey: "${pvc.namespace}"},
+			claim:    claim,
+			expected: &v1.SecretReference{Name: "credentials", Namespace: "team-a"},
+		},
+		{
+			name:     "pvc.annotations",
+			params:   map[string]string{secretNameKey: "${pvc.annotations['example.com/secret']}", secretNamespaceKey: "${pvc.namespace}"},
+			claim:    claim,
+			expected: &v1.SecretReference{Name: "backend-credentials", Namespace: "team-a"},
+		},
+		{
+			name:     "several templates with literals",
+			params:   map[string]string{secretNameKey: "${pvc.namespace}-${pvc.name}-secret", secretNamespaceKey: "ns-${pvc.namespace}"},
+			claim:    claim,
+			expected: &v1.SecretReference{Name: "team-a-claim-1-secret", Namespace: "ns-team-a"},
+		},
+		{
+			name:             "name without namespace",
+			params:           map[string]string{secretNameKey: "credentials"},
+			claim:            claim,
+			expectedErrorKey: secretNamespaceKey,
+		},
+		{
+			name:             "namespace without name",
+			params:           map[string]string{secretNamespaceKey: "kube-system"},
+			claim:            claim,
+			expectedErrorKey: secretNameKey,
+		},
+		{
+			name:              "unknown template",
+			params:            map[string]string{secretNameKey: "${pvc.uid}", secretNamespaceKey: "kube-system"},
+			claim:             claim,
+			expectedErrorKey:  secretNameKey,
+			expectedErrorText: `invalid StorageClass parameter "provisioner-secret-name": unknown template ${pvc.uid}`,
+		},
+		{
+			name:             "pvc.name in namespace",
+			params:           map[string]string{secretNameKey: "credentials", secretNamespaceKey: "${pvc.name}"},
+			claim:            claim,
+			expectedErrorKey: secretNamespaceKey,
+		},
+		{
+			name:             "pvc.annotations in namespace",
+			params:           map[string]string{secretNameKey: "credentials", secretNamespaceKey: "${pvc.annotations['example.com/secret']}"},
+			claim:            claim,
+			expectedErrorKey: secretNamespaceKey,
+		},
+		{
+			name:              "missing annotation",
+			params:            map[string]string{secretNameKey: "${pvc.annotations['example.com/other']}", secretNamespaceKey: "kube-system"},
+			claim:             claim,
+			expectedErrorKey:  secretNameKey,
+			expectedErrorText: `invalid StorageClass parameter "provisioner-secret-name": template ${pvc.annotations['example.com/other']}: claim has no annotation "example.com/other"`,
+		},
+		{
+			name:             "annotation without quotes",
+			params:           map[string]string{secretNameKey: "${pvc.annotations[example.com/secret]}", secretNamespaceKey: "kube-system"},
+			claim:            claim,
+			expectedErrorKey: secretNameKey,
+		},
+		{
+			name:             "unterminated template",
+			params:           map[string]string{secretNameKey: "${pvc.name", secretNamespaceKey: "kube-system"},
+			claim:            claim,
+			expectedErrorKey: secretNameKey,
+		},
+		{
+			name:             "template without claim",
+			params:           map[string]string{secretNameKey: "credentials", secretNamespaceKey: "${pvc.namespace}"},
+			expectedErrorKey: secretNamespaceKey,
+		},
+		{
+			name:             "invalid name after expansion",
+			params:           map[string]string{secretNameKey: "${pvc.name}_secret", secretNamespaceKey: "kube-system"},
+			claim:            claim,
+			expectedErrorKey: secretNameKey,
+		},
+		{
+			name:             "invalid namespace",
+			params:           map[string]string{secretNameKey: "credentials", secretNamespaceKey: "kube.system"},
+			claim:            claim,
+			expectedErrorKey: secretNamespaceKey,
+		},
+		{
+			name:             "empty name",
+			params:           map[string]string{secretNameKey: "", secretNamespaceKey: "kube-system"},
+			claim:            claim,
+			expectedErrorKey: secretNameKey,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ref, err := ResolveSecretRef(test.params, secretNameKey, secretNamespaceKey, test.claim)
+			if test.expectedErrorKey != "" {
+				var terr *TemplateError
+				if !errors.As(err, &terr) {
+					t.Fatalf("expected TemplateError, got %v", err)
+				}
+				if terr.Key != test.expectedErrorKey {
+					t.Errorf("expected error of parameter %q, got %q", test.expectedErrorKey, terr.Key)
+				}
+				if test.expectedErrorText != "" && err.Error() != test.expectedErrorText {
+					t.Errorf("expected error %q, got %q", test.expectedErrorText, err.Error())
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(ref, test.expected) {
+				t.Errorf("expected %+v, got %+v", test.expected, ref)
+			}
+		})
+	}
+}
+
+func TestGetSecretData(t *testing.T) {
+	ctx := context.Background()
+	secret := &v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "credentials", Namespace: "kube-system"},
+		Data:       map[string][]byte{"password": []byte("secret")},
+	}
+	client := fake.NewSimpleClientset(secret)
+
+	data, err := GetSecretData(ctx, client, &v1.SecretReference{Name: "credentials", Namespace: "kube-system"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(data, secret.Data) {
+		t.Errorf("expected data %v, got %v", secret.Data, data)
+	}
+
+	_, err = GetSecretData(ctx, client, &v1.SecretReference{Name: "other", Namespace: "kube-system"})
+	if !apierrs.IsNotFound(err) {
+		t.Errorf("expected NotFound error, got %v", err)
+	}
+
+	data, err = GetSecretData(ctx, client, nil)
+	if data != nil || err != nil {
+		t.Errorf("expected no data and no error for nil reference, got %v, %v", data, err)
+	}
+
+	for _, action := range client.Actions() {
+		if action.GetVerb() != "get" {
+			t.Errorf("expected only GETs of secrets, got %s", action.GetVerb())
+		}
+	}
+}
@@ -0,0 +1,66 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"fmt"
+
+	storage "k8s.io/api/storage/v1"
+)
+
+// AnnIsDefaultStorageClass and AnnBetaIsDefaultStorageClass mark a
+// StorageClass as the default one when set to "true". Older clusters may
+// still carry the beta key.
+const (
+	AnnIsDefaultStorageClass     = "storageclass.kubernetes.io/is-default-class"
+	AnnBetaIsDefaultStorageClass = "storageclass.beta.kubernetes.io/is-default-class"
+)
+
+// IsDefaultStorageClass returns whether class is marked as default by its
+// GA is-default-class annotation or, when it is not set, the beta one.
+func IsDefaultStorageClass(class *storage.StorageClass) bool {
+	if value, found := class.Annotations[AnnIsDefaultStorageClass]; found {
+		return value == "true"
+	}
+	return class.Annotations[AnnBetaIsDefaultStorageClass] == "true"
+}
+
+// GetDefaultStorageClass returns the default class of classes, like API
+// server does for claims without a class: of the classes marked by
+// IsDefaultStorageClass, the newest one wins, on equal creation timestamps
+// the one with the lowest name. It returns nil when no class is marked
+// default and an error when classes contains nil.
+func GetDefaultStorageClass(classes []*storage.StorageClass) (*storage.StorageClass, error) {
+	var defaultClass *storage.StorageClass
+	for i, class := range classes {
+		if class == nil {
+			return nil, fmt.Errorf("class %d is nil", i)
+		}
+		if !IsDefaultStorageClass(class) {
+			continue
+		}
+		if defaultClass == nil {
+			defaultClass = class
+			continue
+		}
+		created, defaultCreated := class.CreationTimestamp.UnixNano(), defaultClass.CreationTimestamp.UnixNano()
+		if created > defaultCreated || (created == defaultCreated && class.Name < defaultClass.Name) {
+			defaultClass = class
+		}
+	}
+	return defaultClass, nil
+}
@@ -0,0 +1,127 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"testing"
+	"time"
+
+	storage "k8s.io/api/storage/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func newDefaultTestClass(name string, created time.Time, annotations map[string]string) *storage.StorageClass {
+	return &storage.StorageClass{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              name,
+			CreationTimestamp: metav1.NewTime(created),
+			Annotations:       annotations,
+		},
+	}
+}
+
+func TestGetDefaultStorageClass(t *testing.T) {
+	older := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	newer := older.Add(time.Hour)
+	ga := map[string]string{AnnIsDefaultStorageClass: "true"}
+	beta := map[string]string{AnnBetaIsDefaultStorageClass: "true"}
+	tests := []struct {
+		name     string
+		classes  []*storage.StorageClass
+		expected string
+	}{
+		{
+			name:    "no classes",
+			classes: nil,
+		},
+		{
+			name: "no default",
+			classes: []*storage.StorageClass{
+				newDefaultTestClass("class-1", older, nil),
+				newDefaultTestClass("class-2", older, map[string]string{AnnIsDefaultStorageClass: "false"}),
+			},
+		},
+		{
+			name: "beta only",
+			classes: []*storage.StorageClass{
+				newDefaultTestClass("class-1", older, nil),
+				newDefaultTestClass("class-2", older, beta),
+			},
+			expected: "class-2",
+		},
+		{
+			name: "GA only",
+			classes: []*storage.StorageClass{
+				newDefaultTestClass("class-1", older, ga),
+				newDefaultTestClass("class-2", older, nil),
+			},
+			expected: "class-1",
+		},
+		{
+			name: "GA and beta on different classes",
+			classes: []*storage.StorageClass{
+				newDefaultTestClass("class-1", newer, beta),
+				newDefaultTestClass("class-2", older, ga),
+			},
+			expected: "class-1",
+		},
+		{
+			name: "GA false wins over beta true",
+			classes: []*storage.StorageClass{
+				newDefaultTestClass("class-1", newer, map[string]string{AnnIsDefaultStorageClass: "false", AnnBetaIsDefaultStorageClass: "true"}),
+				newDefaultTestClass("class-2", older, ga),
+			},
+			expected: "class-2",
+		},
+		{
+			name: "multiple GA defaults",
+			classes: []*storage.StorageClass{
+				newDefaultTestClass("class-1", older, ga),
+				newDefaultTestClass("class-2", newer, ga),
+				newDefaultTestClass("class-3", older, ga),
+			},
+			expected: "class-2",
+		},
+		{
+			name: "multiple GA defaults with equal timestamps",
+			classes: []*storage.StorageClass{
+				newDefaultTestClass("class-2", older, ga),
+				newDefaultTestClass("class-1", older, ga),
+			},
+			expected: "class-1",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			class, err := GetDefaultStorageClass(test.classes)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			name := ""
+			if class != nil {
+				name = class.Name
+			}
+			if name != test.expected {
+				t.Errorf("expected default class %q, got %q", test.expected, name)
+			}
+		})
+	}
+
+	if _, err := GetDefaultStorageClass([]*storage.StorageClass{nil}); err == nil {
+		t.Errorf("expected error for nil class, got none")
+	}
+}
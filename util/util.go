@@ -19,7 +19,9 @@ package util
 import (
 	"context"
 	"fmt"
+	"math"
 	"net"
+	"strconv"
 
 	"github.com/miekg/dns"
 	v1 "k8s.io/api/core/v1"
@@ -50,6 +52,21 @@ func RoundUpToGiB(sizeBytes int64) int64 {
 	return RoundUpSize(sizeBytes, GiB)
 }
 
+// FormatSize returns a human readable form of given size in bytes using the
+// largest binary unit that fits, rounded to two decimal places, e.g. 1536 MiB
+// is "1.5GiB".
+func FormatSize(sizeBytes int64) string {
+	for _, unit := range []struct {
+		size int64
+		name string
+	}{{TiB, "TiB"}, {GiB, "GiB"}, {MiB, "MiB"}, {KiB, "KiB"}} {
+		if sizeBytes >= unit.size {
+			return strconv.FormatFloat(math.Round(float64(sizeBytes)*100/float64(unit.size))/100, 'f', -1, 64) + unit.name
+		}
+	}
+	return strconv.FormatInt(sizeBytes, 10) + "B"
+}
+
 // AccessModesContains returns whether the requested mode is contained by modes
 func AccessModesContains(modes []v1.PersistentVolumeAccessMode, mode v1.PersistentVolumeAccessMode) bool {
 	for _, m := range modes {
@@ -80,6 +97,31 @@ func GetPersistentVolumeClass(volume *v1.PersistentVolume) string {
 	return volume.Spec.StorageClassName
 }
 
+// AnnStorageProvisioner and AnnBetaStorageProvisioner are set on a PVC by
+// Kubernetes to the provisioner that is expected to provision it. Newer
+// Kubernetes versions set only the GA key.
+const (
+	AnnStorageProvisioner     = "volume.kubernetes.io/storage-provisioner"
+	AnnBetaStorageProvisioner = "volume.beta.kubernetes.io/storage-provisioner"
+)
+
+// GetPersistentVolumeClaimProvisioner returns the provisioner that is
+// expected to provision claim from its GA storage-provisioner annotation or,
+// when it is not set, the beta one. When both are set to different values,
+// e.g. after the provisioner was renamed, it logs a warning and returns the
+// GA value. found is false when neither is set.
+func GetPersistentVolumeClaimProvisioner(logger klog.Logger, claim *v1.PersistentVolumeClaim) (provisioner string, found bool) {
+	provisioner, found = claim.Annotations[AnnStorageProvisioner]
+	beta, betaFound := claim.Annotations[AnnBetaStorageProvisioner]
+	if !found {
+		return beta, betaFound
+	}
+	if betaFound && beta != provisioner {
+		logger.Info("Warning: storage-provisioner annotations of the claim disagree, using the GA one", "claim", klog.KObj(claim), "provisioner", provisioner, "betaProvisioner", beta)
+	}
+	return provisioner, true
+}
+
 // GetPersistentVolumeClaimClass returns StorageClassName. If no storage class was
 // requested, it returns "".
 func GetPersistentVolumeClaimClass(claim *v1.PersistentVolumeClaim) string {